@@ -10,32 +10,57 @@ import (
 	"bufio"
 	"context"
 	"embed"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/fs"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/chzyer/readline"
+	"github.com/sipeed/picoclaw"
+	"github.com/sipeed/picoclaw/pkg/admin"
 	"github.com/sipeed/picoclaw/pkg/agent"
 	"github.com/sipeed/picoclaw/pkg/auth"
+	"github.com/sipeed/picoclaw/pkg/backup"
+	"github.com/sipeed/picoclaw/pkg/broadcast"
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/channels"
 	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/contacts"
 	"github.com/sipeed/picoclaw/pkg/cron"
 	"github.com/sipeed/picoclaw/pkg/devices"
+	"github.com/sipeed/picoclaw/pkg/events"
+	"github.com/sipeed/picoclaw/pkg/health"
 	"github.com/sipeed/picoclaw/pkg/heartbeat"
+	"github.com/sipeed/picoclaw/pkg/history"
+	"github.com/sipeed/picoclaw/pkg/i18n"
+	"github.com/sipeed/picoclaw/pkg/leader"
+	"github.com/sipeed/picoclaw/pkg/loadtest"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/media"
 	"github.com/sipeed/picoclaw/pkg/migrate"
 	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/rag"
+	"github.com/sipeed/picoclaw/pkg/rpc"
+	"github.com/sipeed/picoclaw/pkg/session"
 	"github.com/sipeed/picoclaw/pkg/skills"
 	"github.com/sipeed/picoclaw/pkg/state"
+	"github.com/sipeed/picoclaw/pkg/systemd"
 	"github.com/sipeed/picoclaw/pkg/tools"
+	"github.com/sipeed/picoclaw/pkg/top"
+	"github.com/sipeed/picoclaw/pkg/usage"
 	"github.com/sipeed/picoclaw/pkg/voice"
+	"github.com/sipeed/picoclaw/pkg/webhooks"
+	"golang.org/x/term"
 )
 
 //go:generate cp -r ../../workspace .
@@ -51,6 +76,11 @@ var (
 
 const logo = "🦞"
 
+// stallTimeout is how long messages may wait while the agent or the channel
+// dispatcher takes none before the systemd watchdog is no longer pinged.
+// It is well above the longest turn the agent should take.
+const stallTimeout = 10 * time.Minute
+
 // formatVersion returns the version string with optional git commit
 func formatVersion() string {
 	v := version
@@ -124,6 +154,7 @@ func main() {
 	}
 
 	command := os.Args[1]
+	ensureTempDir()
 
 	switch command {
 	case "onboard":
@@ -140,6 +171,20 @@ func main() {
 		authCmd()
 	case "cron":
 		cronCmd()
+	case "feedback":
+		feedbackCmd()
+	case "send":
+		sendCmd()
+	case "top":
+		topCmd()
+	case "export":
+		exportCmd()
+	case "backup":
+		backupCmd()
+	case "restore":
+		restoreCmd()
+	case "whatsapp":
+		whatsappCmd()
 	case "skills":
 		if len(os.Args) < 3 {
 			skillsHelp()
@@ -203,12 +248,19 @@ func printHelp() {
 	fmt.Println("Usage: picoclaw <command>")
 	fmt.Println()
 	fmt.Println("Commands:")
-	fmt.Println("  onboard     Initialize picoclaw configuration and workspace")
+	fmt.Println("  onboard     Initialize picoclaw configuration and workspace (--local for Ollama/llama.cpp)")
 	fmt.Println("  agent       Interact with the agent directly")
 	fmt.Println("  auth        Manage authentication (login, logout, status)")
 	fmt.Println("  gateway     Start picoclaw gateway")
 	fmt.Println("  status      Show picoclaw status")
 	fmt.Println("  cron        Manage scheduled tasks")
+	fmt.Println("  feedback    Summarize or export ratings of agent replies")
+	fmt.Println("  send        Send a message through the running gateway (--channel, --to)")
+	fmt.Println("  top         Live monitor of the running gateway")
+	fmt.Println("  export      Export chat history (--chat channel:id --format jsonl|md)")
+	fmt.Println("  backup      Save config, workspace, and WhatsApp session to an encrypted archive")
+	fmt.Println("  restore     Restore an archive made by backup")
+	fmt.Println("  whatsapp    Manage the WhatsApp session store (migrate-store)")
 	fmt.Println("  migrate     Migrate from OpenClaw to PicoClaw")
 	fmt.Println("  skills      Manage skills (install, list, remove)")
 	fmt.Println("  version     Show version information")
@@ -228,7 +280,19 @@ func onboard() {
 		}
 	}
 
+	local := false
+	for _, arg := range os.Args[2:] {
+		if arg == "--local" {
+			local = true
+		}
+	}
+
 	cfg := config.DefaultConfig()
+	if local {
+		cfg.Agents.Defaults.LocalMode = true
+		cfg.Agents.Defaults.Provider = "ollama"
+		cfg.Agents.Defaults.Model = config.LocalModel
+	}
 	if err := config.SaveConfig(configPath, cfg); err != nil {
 		fmt.Printf("Error saving config: %v\n", err)
 		os.Exit(1)
@@ -239,8 +303,14 @@ func onboard() {
 
 	fmt.Printf("%s picoclaw is ready!\n", logo)
 	fmt.Println("\nNext steps:")
-	fmt.Println("  1. Add your API key to", configPath)
-	fmt.Println("     Get one at: https://openrouter.ai/keys")
+	if local {
+		fmt.Println("  1. Install Ollama (https://ollama.com) and pull the model:")
+		fmt.Printf("     ollama pull %s\n", config.LocalModel)
+		fmt.Println("     For llama.cpp, set agents.defaults.provider to \"llamacpp\" in", configPath)
+	} else {
+		fmt.Println("  1. Add your API key to", configPath)
+		fmt.Println("     Get one at: https://openrouter.ai/keys")
+	}
 	fmt.Println("  2. Chat: picoclaw agent -m \"Hello!\"")
 }
 
@@ -405,6 +475,17 @@ func agentCmd() {
 
 	msgBus := bus.NewMessageBus()
 	agentLoop := agent.NewAgentLoop(cfg, msgBus, provider)
+	if tracker := setupUsage(agentLoop, cfg); tracker != nil {
+		defer tracker.Close()
+	}
+	if store, err := openStateStore(cfg); err != nil {
+		fmt.Printf("Warning: preferences will not be saved: %v\n", err)
+		setupLocales(cfg, nil)
+	} else {
+		agentLoop.SetStateStore(store)
+		setupLocales(cfg, store)
+		defer store.Close()
+	}
 
 	// Print agent startup info (only for interactive mode)
 	startupInfo := agentLoop.GetStartupInfo()
@@ -525,6 +606,12 @@ func gatewayCmd() {
 			break
 		}
 	}
+	for _, arg := range args {
+		if arg == "--loadtest" {
+			loadtestCmd(args)
+			return
+		}
+	}
 
 	cfg, err := loadConfig()
 	if err != nil {
@@ -532,14 +619,29 @@ func gatewayCmd() {
 		os.Exit(1)
 	}
 
+	// A fresh container volume has no workspace until the first start
+	if config.ContainerMode() {
+		if _, err := os.Stat(cfg.WorkspacePath()); os.IsNotExist(err) {
+			createWorkspaceTemplates(cfg.WorkspacePath())
+		}
+	}
+
 	provider, err := providers.CreateProvider(cfg)
 	if err != nil {
 		fmt.Printf("Error creating provider: %v\n", err)
 		os.Exit(1)
 	}
 
+	stateStore, err := openStateStore(cfg)
+	if err != nil {
+		fmt.Printf("Error opening state store: %v\n", err)
+		os.Exit(1)
+	}
+	setupLocales(cfg, stateStore)
+
 	msgBus := bus.NewMessageBus()
 	agentLoop := agent.NewAgentLoop(cfg, msgBus, provider)
+	agentLoop.SetStateStore(stateStore)
 
 	// Print agent startup info
 	fmt.Println("\n📦 Agent Status:")
@@ -560,7 +662,18 @@ func gatewayCmd() {
 		})
 
 	// Setup cron tool and service
-	cronService := setupCronTool(agentLoop, msgBus, cfg.WorkspacePath())
+	cronService := setupCronTool(agentLoop, msgBus, stateStore, cfg.WorkspacePath())
+	if err := cronService.SyncConfigJobs(configCronJobs(cfg)); err != nil {
+		fmt.Printf("Error loading cron jobs from config: %v\n", err)
+	}
+
+	ragStore := setupRAG(agentLoop, cfg)
+	usageTracker := setupUsage(agentLoop, cfg)
+	historyStore := setupHistory(msgBus, cfg)
+	if historyStore != nil {
+		agentLoop.SetHistory(historyStore)
+	}
+	contactDir := setupContacts(agentLoop, msgBus, stateStore, cfg)
 
 	heartbeatService := heartbeat.NewHeartbeatService(
 		cfg.WorkspacePath(),
@@ -586,11 +699,21 @@ func gatewayCmd() {
 		return tools.SilentResult(response)
 	})
 
-	channelManager, err := channels.NewManager(cfg, msgBus)
+	gatewayOpts := []picoclaw.Option{picoclaw.WithBus(msgBus), picoclaw.WithStateStore(stateStore)}
+	mediaStore := setupMedia(cfg)
+	if mediaStore != nil {
+		gatewayOpts = append(gatewayOpts, picoclaw.WithMediaStore(mediaStore))
+	}
+	elector := setupElector(cfg, stateStore)
+	if elector != nil {
+		gatewayOpts = append(gatewayOpts, picoclaw.WithElector(elector))
+	}
+	gateway, err := picoclaw.New(cfg, gatewayOpts...)
 	if err != nil {
 		fmt.Printf("Error creating channel manager: %v\n", err)
 		os.Exit(1)
 	}
+	channelManager := gateway.Channels()
 
 	var transcriber *voice.GroqTranscriber
 	if cfg.Providers.Groq.APIKey != "" {
@@ -617,6 +740,24 @@ func gatewayCmd() {
 				logger.InfoC("voice", "Groq transcription attached to Slack channel")
 			}
 		}
+		if zulipChannel, ok := channelManager.GetChannel("zulip"); ok {
+			if zc, ok := zulipChannel.(*channels.ZulipChannel); ok {
+				zc.SetTranscriber(transcriber)
+				logger.InfoC("voice", "Groq transcription attached to Zulip channel")
+			}
+		}
+		if signalChannel, ok := channelManager.GetChannel("signal"); ok {
+			if sc, ok := signalChannel.(*channels.SignalChannel); ok {
+				sc.SetTranscriber(transcriber)
+				logger.InfoC("voice", "Groq transcription attached to Signal channel")
+			}
+		}
+		if twilioChannel, ok := channelManager.GetChannel("twilio"); ok {
+			if tc, ok := twilioChannel.(*channels.TwilioChannel); ok {
+				tc.SetTranscriber(transcriber)
+				logger.InfoC("voice", "Groq transcription attached to Twilio channel")
+			}
+		}
 		if whatsappChannel, ok := channelManager.GetChannel("whatsapp"); ok {
 			if wc, ok := whatsappChannel.(*channels.WhatsAppChannel); ok {
 				wc.SetTranscriber(transcriber)
@@ -625,6 +766,48 @@ func gatewayCmd() {
 		}
 	}
 
+	// Presence watching is opt-in, and offered only where a channel can report it
+	if cfg.Tools.Presence.Enabled {
+		for _, name := range channelManager.GetEnabledChannels() {
+			if ch, ok := channelManager.GetChannel(name); ok {
+				if _, ok := ch.(channels.PresenceChannel); ok {
+					presenceTool := tools.NewPresenceTool(channelManager)
+					presenceTool.SetOperators(cfg.Admin.Operators)
+					if contactDir != nil && cfg.Contacts.Presence {
+						presenceTool.SetHistory(contactDir)
+					}
+					agentLoop.RegisterTool(presenceTool)
+					break
+				}
+			}
+		}
+	}
+
+	broadcaster, err := broadcast.New(channelManager, cfg.Broadcast.Lists, time.Duration(cfg.Broadcast.IntervalMS)*time.Millisecond)
+	if err != nil {
+		fmt.Printf("Error configuring broadcasts: %v\n", err)
+		os.Exit(1)
+	}
+	broadcaster.SetTemplates(agentLoop.Templates())
+
+	if len(cfg.Admin.Operators) > 0 {
+		chatAdmin := admin.NewChatCommands(cfg.Admin.Operators, channelManager, msgBus)
+		chatAdmin.SetBroadcaster(broadcaster)
+		for _, cmd := range chatAdmin.Commands() {
+			if err := agentLoop.RegisterCommand(cmd); err != nil {
+				fmt.Printf("Error registering admin command: %v\n", err)
+			}
+		}
+		fmt.Printf("✓ Admin chat commands enabled for %d operator(s)\n", len(cfg.Admin.Operators))
+	}
+
+	for _, cmd := range channelManager.Commands() {
+		if err := agentLoop.RegisterCommand(cmd); err != nil {
+			fmt.Printf("Error registering privacy command: %v\n", err)
+		}
+	}
+	channelManager.SetCommands(agentLoop.Commands())
+
 	enabledChannels := channelManager.GetEnabledChannels()
 	if len(enabledChannels) > 0 {
 		fmt.Printf("✓ Channels enabled: %s\n", enabledChannels)
@@ -638,15 +821,38 @@ func gatewayCmd() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	if err := cronService.Start(); err != nil {
-		fmt.Printf("Error starting cron service: %v\n", err)
-	}
-	fmt.Println("✓ Cron service started")
+	healthServer := setupHealth(ctx, cfg, channelManager, mediaStore)
 
-	if err := heartbeatService.Start(); err != nil {
-		fmt.Printf("Error starting heartbeat service: %v\n", err)
+	startScheduler := func() {
+		if err := cronService.Start(); err != nil {
+			fmt.Printf("Error starting cron service: %v\n", err)
+		}
+		fmt.Println("✓ Cron service started")
+
+		if err := heartbeatService.Start(); err != nil {
+			fmt.Printf("Error starting heartbeat service: %v\n", err)
+		}
+		fmt.Println("✓ Heartbeat service started")
+	}
+	stopScheduler := func() {
+		heartbeatService.Stop()
+		cronService.Stop()
+	}
+	if elector != nil {
+		// Only one instance fires cron jobs and heartbeats
+		schedulerCtx, cancelScheduler := context.WithCancel(ctx)
+		schedulerDone := make(chan struct{})
+		go func() {
+			defer close(schedulerDone)
+			elector.Run(schedulerCtx, "scheduler", startScheduler, stopScheduler)
+		}()
+		stopScheduler = func() {
+			cancelScheduler()
+			<-schedulerDone
+		}
+	} else {
+		startScheduler()
 	}
-	fmt.Println("✓ Heartbeat service started")
 
 	stateManager := state.NewManager(cfg.WorkspacePath())
 	deviceService := devices.NewService(devices.Config{
@@ -660,23 +866,157 @@ func gatewayCmd() {
 		fmt.Println("✓ Device event service started")
 	}
 
-	if err := channelManager.StartAll(ctx); err != nil {
+	adminServer := admin.NewServer(admin.Config{
+		Enabled: cfg.Admin.Enabled,
+		Host:    cfg.Admin.Host,
+		Port:    cfg.Admin.Port,
+		Token:   cfg.Admin.Token,
+	})
+	if cfg.Admin.Enabled || cfg.Webhooks.Enabled {
+		msgBus.AddRecorder(events.Default)
+		msgBus.OnChatEvent(events.Default.RecordChatEvent)
+		msgBus.OnInteraction(events.Default.RecordInteraction)
+		logger.AddHook(events.Default.HandleLog)
+	}
+	setupWebhooks(ctx, cfg)
+	if cfg.Admin.Enabled {
+		adminServer.Handle("/events", admin.EventsHandler(events.Default))
+		adminServer.Handle("/broadcast", admin.BroadcastHandler(broadcaster))
+		adminServer.Handle("/deliveries/", admin.DeliveriesHandler(channelManager))
+		adminServer.Handle("/outbox", admin.OutboxHandler(channelManager))
+		adminServer.Handle("/send", admin.SendHandler(channelManager))
+		adminServer.Handle("/status", admin.StatusHandler(channelManager, msgBus))
+		if contactDir != nil {
+			adminServer.Handle("/contacts", admin.ContactsHandler(contactDir))
+			adminServer.Handle("/contacts/", admin.ContactsHandler(contactDir))
+		}
+	}
+	if err := adminServer.Start(ctx); err != nil {
+		fmt.Printf("Error starting admin server: %v\n", err)
+	} else if cfg.Admin.Enabled {
+		fmt.Printf("✓ Admin server listening on %s\n", adminServer.Addr())
+	}
+
+	if ragStore != nil {
+		go ragStore.Watch(ctx, ragDocumentsDir(cfg), time.Duration(cfg.RAG.ScanInterval)*time.Second)
+		fmt.Printf("✓ Knowledge base watching %s\n", ragDocumentsDir(cfg))
+	}
+
+	if historyStore != nil && cfg.History.RetentionDays > 0 {
+		go historyStore.Retain(ctx, time.Duration(cfg.History.RetentionDays)*24*time.Hour)
+	}
+
+	if err := gateway.Start(ctx); err != nil {
 		fmt.Printf("Error starting channels: %v\n", err)
 	}
+	rpcServer := rpc.NewServer(rpc.Config{
+		Enabled: cfg.GRPC.Enabled,
+		Host:    cfg.GRPC.Host,
+		Port:    cfg.GRPC.Port,
+		Token:   cfg.GRPC.Token,
+	}, channelManager)
+	if cfg.GRPC.Enabled {
+		msgBus.AddRecorder(rpcServer)
+	}
+	if err := rpcServer.Start(ctx); err != nil {
+		fmt.Printf("Error starting gRPC server: %v\n", err)
+	} else if cfg.GRPC.Enabled {
+		fmt.Printf("✓ gRPC server listening on %s\n", rpcServer.Addr())
+	}
+	if contactDir != nil && cfg.Contacts.AddressBook && cfg.Contacts.SyncHours > 0 {
+		// Give channels a minute to connect before the first sync
+		go contactDir.Sync(ctx, channelManager.Contacts, time.Minute, time.Duration(cfg.Contacts.SyncHours)*time.Hour)
+	}
+
+	agentDone := make(chan struct{})
+	go func() {
+		defer close(agentDone)
+		agentLoop.Run(ctx)
+	}()
+
+	pendingPath := filepath.Join(cfg.WorkspacePath(), "state", "pending_inbound.json")
+	if pending, err := bus.LoadPending(pendingPath); err != nil {
+		logger.ErrorCF("gateway", "Failed to load pending messages", map[string]interface{}{
+			"error": err.Error(),
+		})
+	} else if len(pending) > 0 {
+		fmt.Printf("✓ Replaying %d message(s) pending from last shutdown\n", len(pending))
+		go func() {
+			for _, msg := range pending {
+				msgBus.PublishInbound(msg)
+			}
+		}()
+	}
 
-	go agentLoop.Run(ctx)
+	go func() {
+		alive := func() bool {
+			if !msgBus.Stalled(stallTimeout) {
+				return true
+			}
+			inbound, outbound := msgBus.QueueLengths()
+			logger.ErrorCF("gateway", "Messages are not being processed, withholding the watchdog ping",
+				map[string]interface{}{"inbound": inbound, "outbound": outbound})
+			return false
+		}
+		if err := systemd.Run(ctx, channelManager.StatusLine, alive); err != nil {
+			logger.WarnCF("gateway", "Failed to notify systemd", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}()
 
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 	<-sigChan
 
 	fmt.Println("\nShutting down...")
-	cancel()
+	systemd.Stopping()
+	shutdownTimeout := time.Duration(cfg.Gateway.ShutdownTimeout) * time.Second
+	if shutdownTimeout <= 0 {
+		shutdownTimeout = 30 * time.Second
+	}
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer shutdownCancel()
+
+	// Stop accepting new work, then let the agent finish what is queued.
+	msgBus.CloseInbound()
 	deviceService.Stop()
-	heartbeatService.Stop()
-	cronService.Stop()
+	stopScheduler()
+
+	select {
+	case <-agentDone:
+	case <-shutdownCtx.Done():
+		fmt.Println("⚠ Shutdown deadline reached, abandoning in-flight messages")
+	}
 	agentLoop.Stop()
-	channelManager.StopAll(ctx)
+
+	rpcServer.Stop(shutdownCtx)
+	gateway.Stop(shutdownCtx)
+	cancel()
+	adminServer.Stop(shutdownCtx)
+	if healthServer != nil {
+		healthServer.Stop(shutdownCtx)
+	}
+
+	if pending := msgBus.DrainInbound(); len(pending) > 0 {
+		if err := bus.SavePending(pendingPath, pending); err != nil {
+			fmt.Printf("Error saving pending messages: %v\n", err)
+		} else {
+			fmt.Printf("✓ Saved %d unprocessed message(s) for next start\n", len(pending))
+		}
+	}
+	if ragStore != nil {
+		ragStore.Close()
+	}
+	if usageTracker != nil {
+		usageTracker.Close()
+	}
+	if historyStore != nil {
+		msgBus.RemoveRecorder(historyStore)
+		historyStore.Close()
+	}
+	cronService.Close()
+	stateStore.Close()
 	fmt.Println("✓ Gateway stopped")
 }
 
@@ -717,7 +1057,6 @@ func statusCmd() {
 		hasAnthropic := cfg.Providers.Anthropic.APIKey != ""
 		hasOpenAI := cfg.Providers.OpenAI.APIKey != ""
 		hasGemini := cfg.Providers.Gemini.APIKey != ""
-		hasZhipu := cfg.Providers.Zhipu.APIKey != ""
 		hasGroq := cfg.Providers.Groq.APIKey != ""
 		hasVLLM := cfg.Providers.VLLM.APIBase != ""
 
@@ -731,7 +1070,6 @@ func statusCmd() {
 		fmt.Println("Anthropic API:", status(hasAnthropic))
 		fmt.Println("OpenAI API:", status(hasOpenAI))
 		fmt.Println("Gemini API:", status(hasGemini))
-		fmt.Println("Zhipu API:", status(hasZhipu))
 		fmt.Println("Groq API:", status(hasGroq))
 		if hasVLLM {
 			fmt.Printf("vLLM/Local: ✓ %s\n", cfg.Providers.VLLM.APIBase)
@@ -975,15 +1313,12 @@ func authStatusCmd() {
 }
 
 func getConfigPath() string {
-	home, _ := os.UserHomeDir()
-	return filepath.Join(home, ".picoclaw", "config.json")
+	return filepath.Join(config.HomeDir(), "config.json")
 }
 
-func setupCronTool(agentLoop *agent.AgentLoop, msgBus *bus.MessageBus, workspace string) *cron.CronService {
-	cronStorePath := filepath.Join(workspace, "cron", "jobs.json")
-
+func setupCronTool(agentLoop *agent.AgentLoop, msgBus *bus.MessageBus, store state.Store, workspace string) *cron.CronService {
 	// Create cron service
-	cronService := cron.NewCronService(cronStorePath, nil)
+	cronService := cron.NewCronService(store, nil)
 
 	// Create and register CronTool
 	cronTool := tools.NewCronTool(cronService, agentLoop, msgBus, workspace)
@@ -998,6 +1333,337 @@ func setupCronTool(agentLoop *agent.AgentLoop, msgBus *bus.MessageBus, workspace
 	return cronService
 }
 
+// configCronJobs converts the cron.jobs config section for the scheduler.
+func configCronJobs(cfg *config.Config) []cron.ConfigJob {
+	jobs := make([]cron.ConfigJob, 0, len(cfg.Cron.Jobs))
+	for _, j := range cfg.Cron.Jobs {
+		jobs = append(jobs, cron.ConfigJob{
+			Name:    j.Name,
+			Expr:    j.Schedule,
+			TZ:      j.TZ,
+			Prompt:  j.Prompt,
+			Channel: j.Channel,
+			ChatID:  j.ChatID,
+		})
+	}
+	return jobs
+}
+
+// setupRAG opens the local knowledge base and registers its tools. It returns
+// nil when RAG is disabled or the store cannot be opened.
+func setupRAG(agentLoop *agent.AgentLoop, cfg *config.Config) *rag.Store {
+	if !cfg.RAG.Enabled {
+		return nil
+	}
+
+	embedder := rag.NewHTTPEmbedder(cfg.RAG.EmbeddingAPIBase, cfg.RAG.EmbeddingAPIKey, cfg.RAG.EmbeddingModel)
+	store, err := rag.Open(filepath.Join(cfg.WorkspacePath(), "rag", "index.db"), embedder, rag.Options{
+		ChunkSize:    cfg.RAG.ChunkSize,
+		ChunkOverlap: cfg.RAG.ChunkOverlap,
+	})
+	if err != nil {
+		fmt.Printf("Error opening knowledge base: %v\n", err)
+		return nil
+	}
+
+	agentLoop.RegisterTool(tools.NewKnowledgeSearchTool(store, cfg.RAG.TopK))
+	agentLoop.RegisterTool(tools.NewKnowledgeAddTool(store))
+	agentLoop.SetKnowledgeStore(store)
+	if cfg.RAG.AutoRetrieve {
+		agentLoop.SetKnowledgeBase(store, cfg.RAG.TopK, cfg.RAG.MinScore)
+	}
+	return store
+}
+
+// setupUsage opens the usage ledger and hands it to the agent. It returns nil
+// when tracking is disabled or the ledger cannot be opened.
+func setupUsage(agentLoop *agent.AgentLoop, cfg *config.Config) *usage.Tracker {
+	if !cfg.Usage.Enabled {
+		return nil
+	}
+
+	prices := make(map[string]usage.Price, len(cfg.Usage.Prices))
+	for model, p := range cfg.Usage.Prices {
+		prices[model] = usage.Price{Input: p.Input, Output: p.Output}
+	}
+	tracker, err := usage.Open(filepath.Join(cfg.WorkspacePath(), "usage", "usage.db"), usage.Options{
+		Prices:                 prices,
+		TranscriptionPerMinute: cfg.Usage.TranscriptionPerMinute,
+	})
+	if err != nil {
+		fmt.Printf("Error opening usage ledger: %v\n", err)
+		return nil
+	}
+
+	agentLoop.SetUsageTracker(tracker, cfg.Usage.MonthlyBudgetPerUser, cfg.Usage.MonthlyBudgetPerChat)
+	return tracker
+}
+
+// setupWebhooks posts gateway events to the configured webhook targets.
+func setupWebhooks(ctx context.Context, cfg *config.Config) {
+	if !cfg.Webhooks.Enabled {
+		return
+	}
+	targets := make([]webhooks.Target, len(cfg.Webhooks.Targets))
+	for i, t := range cfg.Webhooks.Targets {
+		targets[i] = webhooks.Target{URL: t.URL, Secret: t.Secret, Events: t.Events}
+	}
+	dispatcher := webhooks.New(targets, cfg.Webhooks.MaxRetries)
+	if dispatcher.Len() == 0 {
+		fmt.Println("Webhooks are enabled but no valid targets are configured")
+		return
+	}
+	dispatcher.Start(ctx, events.Default)
+	fmt.Printf("✓ Webhooks posting to %d target(s)\n", dispatcher.Len())
+}
+
+// setupContacts opens the contact directory in the state store, records
+// the people who message the bot in it, and gives the agent the contacts
+// tool. With contacts.presence it also records when watched users were
+// last online, and offers /lastseen to opt out.
+func setupContacts(agentLoop *agent.AgentLoop, msgBus *bus.MessageBus, store state.Store, cfg *config.Config) *contacts.Directory {
+	if !cfg.Contacts.Enabled {
+		return nil
+	}
+	dir := contacts.New(store, contacts.Policy{
+		Avatars:      cfg.Contacts.Avatars,
+		GroupMembers: cfg.Contacts.GroupMembers,
+		Exclude:      cfg.Contacts.Exclude,
+	})
+	msgBus.AddRecorder(dir)
+	agentLoop.RegisterTool(tools.NewContactsTool(dir))
+	if cfg.Contacts.Presence {
+		msgBus.OnPresence(dir.RecordPresence)
+		for _, cmd := range dir.Commands() {
+			if err := agentLoop.RegisterCommand(cmd); err != nil {
+				fmt.Printf("Error registering contacts command: %v\n", err)
+			}
+		}
+	}
+	return dir
+}
+
+// openStateStore opens the configured state store and imports the
+// scheduler jobs and preferences older versions kept in their own files.
+func openStateStore(cfg *config.Config) (state.Store, error) {
+	opts := state.Options{
+		Backend:     cfg.State.Backend,
+		Path:        cfg.State.Path,
+		RedisURL:    cfg.State.RedisURL,
+		RedisPrefix: cfg.State.RedisPrefix,
+	}
+	if opts.Path == "" {
+		name := "state.db"
+		if opts.Backend == state.BackendBolt {
+			name = "state.bolt"
+		}
+		opts.Path = filepath.Join(cfg.WorkspacePath(), "state", name)
+	}
+
+	store, err := state.Open(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := cron.ImportLegacyJobs(store, filepath.Join(cfg.WorkspacePath(), "cron")); err != nil {
+		fmt.Printf("Error importing cron jobs: %v\n", err)
+	}
+	if err := tools.ImportLegacyPreferences(store, filepath.Join(cfg.WorkspacePath(), "memory", "preferences.json")); err != nil {
+		fmt.Printf("Error importing preferences: %v\n", err)
+	}
+	return store, nil
+}
+
+// setupLocales loads the built-in reply catalog plus the workspace's
+// locales directory and makes it the process-wide localizer. Chats'
+// language choices are kept in store.
+func setupLocales(cfg *config.Config, store state.Store) {
+	catalog, err := i18n.Load(filepath.Join(cfg.WorkspacePath(), "locales"))
+	if err != nil {
+		logger.WarnCF("i18n", "Failed to load workspace locales", map[string]interface{}{
+			"error": err.Error(),
+		})
+	}
+	i18n.Default.Configure(catalog, cfg.Agents.Defaults.Locale, store)
+}
+
+// setupElector returns the elector deciding which instance runs each
+// channel and the scheduler, or nil unless high availability is enabled.
+func setupElector(cfg *config.Config, store state.Store) *leader.Elector {
+	if !cfg.HA.Enabled {
+		return nil
+	}
+	if cfg.State.Backend != state.BackendRedis {
+		logger.WarnCF("gateway", "High availability needs a state store shared by all instances", map[string]interface{}{
+			"backend": cfg.State.Backend,
+		})
+	}
+	id := cfg.HA.InstanceID
+	if id == "" {
+		id = leader.DefaultID()
+	}
+	ttl := time.Duration(cfg.HA.LeaseTTL) * time.Second
+	if ttl <= 0 {
+		ttl = 15 * time.Second
+	}
+	fmt.Printf("✓ High availability enabled as instance %s\n", id)
+	return leader.NewElector(store, id, ttl)
+}
+
+// setupMedia returns the store attachments are shared from by link, or nil
+// unless it is enabled.
+func setupMedia(cfg *config.Config) *media.Store {
+	if !cfg.Media.Enabled {
+		return nil
+	}
+	dir := config.ExpandPath(cfg.Media.Dir)
+	if dir == "" {
+		dir = filepath.Join(cfg.WorkspacePath(), "media")
+	}
+	ttl := time.Duration(cfg.Media.LinkTTL) * time.Hour
+	if ttl <= 0 {
+		ttl = 72 * time.Hour
+	}
+	store, err := media.NewStore(dir, cfg.Media.PublicURL, ttl)
+	if err != nil {
+		fmt.Printf("Error setting up media store: %v\n", err)
+		return nil
+	}
+	fmt.Printf("✓ Media store sharing links from %s\n", cfg.Media.PublicURL)
+	return store
+}
+
+// setupHealth starts the health endpoints when enabled. Media links and
+// channel webhooks share their listener, which serves only those when the
+// health endpoints are off. In container mode
+// WhatsApp pairing QR codes are served there, behind the admin token,
+// instead of being drawn in the terminal.
+func setupHealth(ctx context.Context, cfg *config.Config, channelManager *channels.Manager, mediaStore *media.Store) *health.Server {
+	webhooks := make(map[string]http.Handler)
+	for _, name := range channelManager.GetEnabledChannels() {
+		if ch, ok := channelManager.GetChannel(name); ok {
+			if wc, ok := ch.(channels.WebhookChannel); ok {
+				path, handler := wc.Webhook()
+				webhooks[path] = handler
+			}
+		}
+	}
+
+	var server *health.Server
+	if cfg.Gateway.Health || mediaStore != nil || len(webhooks) > 0 {
+		// Media links and webhooks alone do not publish the probes and
+		// pairing
+		var ready health.ReadyFunc
+		if cfg.Gateway.Health {
+			ready = func() (bool, map[string]string) {
+				states := channelManager.ChannelStates()
+				for _, state := range states {
+					if state != "connected" && state != "running" && state != "standby" {
+						return false, states
+					}
+				}
+				return true, states
+			}
+		}
+		server = health.NewServer(cfg.Gateway.Host, cfg.Gateway.Port, ready)
+		server.SetPairingToken(cfg.Admin.Token)
+		if mediaStore != nil {
+			server.Handle(media.Prefix, mediaStore.Handler())
+		}
+		for path, handler := range webhooks {
+			server.Handle(path, handler)
+		}
+		if err := server.Start(ctx); err != nil {
+			fmt.Printf("Error starting health endpoints: %v\n", err)
+			server = nil
+		} else {
+			if cfg.Gateway.Health {
+				fmt.Printf("✓ Health endpoints on %s\n", server.Addr())
+			} else {
+				fmt.Printf("✓ Media links and webhooks on %s\n", server.Addr())
+			}
+		}
+	}
+
+	if !config.ContainerMode() {
+		return server
+	}
+	ch, ok := channelManager.GetChannel("whatsapp")
+	if !ok {
+		return server
+	}
+	if qc, ok := ch.(channels.QRChannel); ok {
+		pairURL := ""
+		if server != nil && cfg.Gateway.Health {
+			host := cfg.Gateway.Host
+			if host == "" || host == "0.0.0.0" || host == "::" {
+				host = "localhost"
+			}
+			pairURL = fmt.Sprintf("http://%s/pair", net.JoinHostPort(host, strconv.Itoa(cfg.Gateway.Port)))
+		}
+		qc.SetQRHandler(func(code string) {
+			if server != nil {
+				server.SetPairingCode(code)
+			}
+			if code == "" {
+				return
+			}
+			// The code itself is never logged: whoever scans it links
+			// their phone to the bot's account
+			if pairURL == "" {
+				logger.WarnC("whatsapp", "WhatsApp is waiting to pair; enable gateway.health to scan the QR code at /pair, or set a pairing phone")
+				return
+			}
+			logger.InfoCF("whatsapp", "Scan the pairing QR code with WhatsApp on your phone", map[string]interface{}{
+				"url": pairURL,
+			})
+		})
+	}
+	return server
+}
+
+// ensureTempDir points TMPDIR into the home directory when the system temp
+// directory is not writable, as in a container with a read-only root
+// filesystem.
+func ensureTempDir() {
+	if f, err := os.CreateTemp("", ".picoclaw-probe-*"); err == nil {
+		f.Close()
+		os.Remove(f.Name())
+		return
+	}
+	dir := filepath.Join(config.HomeDir(), "tmp")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return
+	}
+	os.Setenv("TMPDIR", dir)
+}
+
+// setupHistory opens the chat history log and attaches it to the bus. It
+// returns nil when the log is disabled or cannot be opened.
+func setupHistory(msgBus *bus.MessageBus, cfg *config.Config) *history.Store {
+	if !cfg.History.Enabled {
+		return nil
+	}
+
+	store, err := history.Open(historyPath(cfg))
+	if err != nil {
+		fmt.Printf("Error opening chat history: %v\n", err)
+		return nil
+	}
+	msgBus.AddRecorder(store)
+	return store
+}
+
+func historyPath(cfg *config.Config) string {
+	return filepath.Join(cfg.WorkspacePath(), "history", "history.db")
+}
+
+func ragDocumentsDir(cfg *config.Config) string {
+	if cfg.RAG.DocumentsDir != "" {
+		return cfg.RAG.DocumentsDir
+	}
+	return filepath.Join(cfg.WorkspacePath(), "documents")
+}
+
 func loadConfig() (*config.Config, error) {
 	return config.LoadConfig(getConfigPath())
 }
@@ -1017,29 +1683,862 @@ func cronCmd() {
 		return
 	}
 
-	cronStorePath := filepath.Join(cfg.WorkspacePath(), "cron", "jobs.json")
+	store, err := openStateStore(cfg)
+	if err != nil {
+		fmt.Printf("Error opening state store: %v\n", err)
+		return
+	}
+	defer store.Close()
+	cs := cron.NewCronService(store, nil)
+	defer cs.Close()
 
 	switch subcommand {
 	case "list":
-		cronListCmd(cronStorePath)
+		cronListCmd(cs)
 	case "add":
-		cronAddCmd(cronStorePath)
+		cronAddCmd(cs)
 	case "remove":
 		if len(os.Args) < 4 {
 			fmt.Println("Usage: picoclaw cron remove <job_id>")
 			return
 		}
-		cronRemoveCmd(cronStorePath, os.Args[3])
+		cronRemoveCmd(cs, os.Args[3])
 	case "enable":
-		cronEnableCmd(cronStorePath, false)
+		cronEnableCmd(cs, false)
 	case "disable":
-		cronEnableCmd(cronStorePath, true)
+		cronEnableCmd(cs, true)
 	default:
 		fmt.Printf("Unknown cron command: %s\n", subcommand)
 		cronHelp()
 	}
 }
 
+func feedbackCmd() {
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		return
+	}
+	feedback := session.NewSessionManager(filepath.Join(cfg.WorkspacePath(), "sessions")).AllFeedback()
+
+	if len(os.Args) < 3 {
+		good := 0
+		for _, fb := range feedback {
+			if fb.Rating == "good" {
+				good++
+			}
+		}
+		fmt.Printf("Feedback: %d good, %d bad\n", good, len(feedback)-good)
+		fmt.Println("Run 'picoclaw feedback export' to write it as JSON lines.")
+		return
+	}
+	if os.Args[2] != "export" {
+		fmt.Printf("Unknown feedback command: %s\n", os.Args[2])
+		feedbackHelp()
+		return
+	}
+
+	rating, output := "", ""
+	args := os.Args[3:]
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--rating":
+			if i+1 < len(args) {
+				rating = args[i+1]
+				i++
+			}
+		case "-o", "--output":
+			if i+1 < len(args) {
+				output = args[i+1]
+				i++
+			}
+		default:
+			fmt.Printf("Unknown option: %s\n", args[i])
+			feedbackHelp()
+			return
+		}
+	}
+
+	out := os.Stdout
+	if output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			fmt.Printf("Error creating %s: %v\n", output, err)
+			return
+		}
+		defer f.Close()
+		out = f
+	}
+
+	enc := json.NewEncoder(out)
+	count := 0
+	for _, fb := range feedback {
+		if rating != "" && fb.Rating != rating {
+			continue
+		}
+		if err := enc.Encode(fb); err != nil {
+			fmt.Printf("Error writing feedback: %v\n", err)
+			return
+		}
+		count++
+	}
+	if output != "" {
+		fmt.Printf("Exported %d ratings to %s\n", count, output)
+	}
+}
+
+// sendCmd sends a message through the admin API of the running gateway,
+// for shell scripts and cron jobs. The message is the remaining arguments,
+// or stdin when there are none.
+func sendCmd() {
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+
+	var req admin.SendRequest
+	var words []string
+	adminURL := ""
+	args := os.Args[2:]
+	for i := 0; i < len(args); i++ {
+		value := func() string {
+			if i+1 >= len(args) {
+				fmt.Printf("Missing value for %s\n", args[i])
+				sendHelp()
+				os.Exit(2)
+			}
+			i++
+			return args[i]
+		}
+		switch args[i] {
+		case "-c", "--channel":
+			req.Channel = value()
+		case "-t", "--to":
+			req.ChatID = value()
+		case "--thread":
+			req.ThreadID = value()
+		case "--low":
+			req.Priority = bus.PriorityLow
+		case "--admin-url":
+			adminURL = value()
+		case "-h", "--help":
+			sendHelp()
+			return
+		default:
+			words = append(words, args[i])
+		}
+	}
+	req.Message = strings.Join(words, " ")
+	if len(words) == 0 || req.Message == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Printf("Error reading message from stdin: %v\n", err)
+			os.Exit(1)
+		}
+		req.Message = strings.TrimRight(string(data), "\n")
+	}
+	if req.Channel == "" || req.ChatID == "" || strings.TrimSpace(req.Message) == "" {
+		sendHelp()
+		os.Exit(2)
+	}
+
+	client, _ := adminClient(cfg, adminURL)
+	resp, err := client.Send(context.Background(), req)
+	if err != nil {
+		fmt.Printf("Error sending message: %v\n", err)
+		os.Exit(1)
+	}
+	if resp.Error != "" {
+		fmt.Printf("Queued for retry (delivery %s): %s\n", resp.ID, resp.Error)
+		return
+	}
+	fmt.Printf("✓ Sent (delivery %s)\n", resp.ID)
+}
+
+// adminClient returns a client for the running gateway's admin API at
+// adminURL, or at admin.host and admin.port from cfg, and the URL used.
+// It exits when no token is configured.
+func adminClient(cfg *config.Config, adminURL string) (*admin.Client, string) {
+	if adminURL == "" {
+		host := cfg.Admin.Host
+		if host == "" || host == "0.0.0.0" || host == "::" {
+			host = "127.0.0.1"
+		}
+		adminURL = "http://" + net.JoinHostPort(host, strconv.Itoa(cfg.Admin.Port))
+	}
+	if cfg.Admin.Token == "" {
+		fmt.Println("No admin token configured; set admin.token or PICOCLAW_ADMIN_TOKEN")
+		os.Exit(1)
+	}
+	return admin.NewClient(adminURL, cfg.Admin.Token), adminURL
+}
+
+// topCmd shows a live monitor of the running gateway.
+func topCmd() {
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	adminURL := ""
+	m := top.New()
+	args := os.Args[2:]
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--content":
+			m.ShowContent = true
+		case "--admin-url":
+			if i+1 < len(args) {
+				adminURL = args[i+1]
+				i++
+			}
+		case "-h", "--help":
+			topHelp()
+			return
+		default:
+			fmt.Printf("Unknown option: %s\n", args[i])
+			topHelp()
+			os.Exit(2)
+		}
+	}
+	client, adminURL := adminClient(cfg, adminURL)
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		fmt.Println("picoclaw top needs a terminal")
+		os.Exit(1)
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	if st, err := client.Status(ctx); err != nil {
+		fmt.Printf("Error reaching the gateway: %v\n", err)
+		os.Exit(1)
+	} else {
+		m.SetStatus(st, nil)
+	}
+
+	oldState, err := term.MakeRaw(fd)
+	if err != nil {
+		fmt.Printf("Error setting up the terminal: %v\n", err)
+		os.Exit(1)
+	}
+	// Alternate screen, hidden cursor; both restored on exit
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	defer func() {
+		fmt.Print("\x1b[?25h\x1b[?1049l")
+		term.Restore(fd, oldState)
+	}()
+
+	go func() {
+		defer cancel()
+		buf := make([]byte, 8)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				return
+			}
+			switch key := string(buf[:n]); key {
+			case "q", "Q", "\x03", "\x1b":
+				return
+			case "\x1b[A", "k":
+				m.Scroll(1)
+			case "\x1b[B", "j":
+				m.Scroll(-1)
+			case "\x1b[5~":
+				m.Scroll(10)
+			case "\x1b[6~":
+				m.Scroll(-10)
+			}
+		}
+	}()
+
+	top.Run(ctx, client, m, adminURL, os.Stdout, func() (int, int) {
+		w, h, err := term.GetSize(int(os.Stdout.Fd()))
+		if err != nil {
+			return 80, 24
+		}
+		return w, h
+	})
+}
+
+// loadtestCmd measures the bus and channel manager with synthetic
+// messages on a fake channel, without connecting real channels or calling
+// the model.
+func loadtestCmd(args []string) {
+	var opts loadtest.Options
+	useAgent, useState := false, false
+	for i := 0; i < len(args); i++ {
+		var err error
+		switch args[i] {
+		case "--loadtest", "--debug", "-d":
+		case "--rate":
+			if i+1 < len(args) {
+				opts.Rate, err = strconv.ParseFloat(args[i+1], 64)
+				i++
+			}
+		case "--duration":
+			if i+1 < len(args) {
+				opts.Duration, err = time.ParseDuration(args[i+1])
+				i++
+			}
+		case "--chats":
+			if i+1 < len(args) {
+				opts.Chats, err = strconv.Atoi(args[i+1])
+				i++
+			}
+		case "--size":
+			if i+1 < len(args) {
+				opts.Size, err = strconv.Atoi(args[i+1])
+				i++
+			}
+		case "--agent":
+			useAgent = true
+		case "--state":
+			useState = true
+		case "-h", "--help":
+			loadtestHelp()
+			return
+		default:
+			fmt.Printf("Unknown option: %s\n", args[i])
+			loadtestHelp()
+			os.Exit(2)
+		}
+		if err != nil {
+			fmt.Printf("Invalid value for %s: %v\n", args[i-1], err)
+			os.Exit(2)
+		}
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		os.Exit(1)
+	}
+	// Only the fake channel runs
+	cfg.Channels = config.ChannelsConfig{}
+	if logger.GetLevel() != logger.DEBUG {
+		// Per-message logging would dominate the measurement
+		logger.SetLevel(logger.WARN)
+	}
+
+	var store state.Store = state.NewMemoryStore()
+	if useState {
+		if store, err = openStateStore(cfg); err != nil {
+			fmt.Printf("Error opening state store: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	defer store.Close()
+
+	msgBus := bus.NewMessageBus()
+	manager, err := channels.NewManager(cfg, msgBus)
+	if err != nil {
+		fmt.Printf("Error creating channel manager: %v\n", err)
+		os.Exit(1)
+	}
+	manager.SetStateStore(store)
+	fake := channels.NewFake("loadtest", msgBus, nil)
+	manager.RegisterChannel("loadtest", fake)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	if err := manager.StartAll(ctx); err != nil {
+		fmt.Printf("Error starting channels: %v\n", err)
+		os.Exit(1)
+	}
+	defer manager.StopAll(context.Background())
+
+	responder := "echo"
+	if useAgent {
+		// Sessions go to a scratch workspace, not the real one
+		workspace, err := os.MkdirTemp("", "picoclaw-loadtest-*")
+		if err != nil {
+			fmt.Printf("Error creating workspace: %v\n", err)
+			os.Exit(1)
+		}
+		defer os.RemoveAll(workspace)
+		cfg.Agents.Defaults.Workspace = workspace
+		agentLoop := agent.NewAgentLoop(cfg, msgBus, loadtest.Model{})
+		go agentLoop.Run(ctx)
+		defer agentLoop.Stop()
+		responder = "agent loop with a stub model"
+	} else {
+		go loadtest.Echo(ctx, msgBus)
+	}
+
+	opts.Progress = func(r loadtest.Report) {
+		inbound, outbound := msgBus.QueueLengths()
+		fmt.Printf("  %5.0fs  sent %d  replied %d  queued %d/%d\n",
+			r.Elapsed.Seconds(), r.Sent, r.Replied, inbound, outbound)
+	}
+	storeName := "in-memory state"
+	if useState {
+		storeName = "the configured state store"
+	}
+	fmt.Printf("Load test: %s, %s (Ctrl-C to stop early)\n", responder, storeName)
+	report, err := loadtest.Run(ctx, opts, msgBus, fake)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println()
+	report.Print(os.Stdout)
+}
+
+func loadtestHelp() {
+	fmt.Println("Usage: picoclaw gateway --loadtest [options]")
+	fmt.Println()
+	fmt.Println("Sends synthetic messages through the bus and channel manager on a fake")
+	fmt.Println("channel and reports throughput, reply latency, queue depths, and memory.")
+	fmt.Println("No real channel connects and no model is called.")
+	fmt.Println()
+	fmt.Println("Options:")
+	fmt.Println("  --rate N         Messages per second (default 10)")
+	fmt.Println("  --duration D     How long to send, e.g. 30s or 2m (default 30s)")
+	fmt.Println("  --chats N        Distinct chats the messages come from (default 10)")
+	fmt.Println("  --size N         Characters per message (default 100)")
+	fmt.Println("  --agent          Answer through the agent loop with a stub model instead of echoing")
+	fmt.Println("  --state          Use the configured state store instead of memory (stop the gateway first)")
+}
+
+func topHelp() {
+	fmt.Println("Usage: picoclaw top [--content] [--admin-url URL]")
+	fmt.Println()
+	fmt.Println("Live monitor of the running gateway: channel states, queue depths,")
+	fmt.Println("message rates, and an event feed. Needs the admin server.")
+	fmt.Println()
+	fmt.Println("Options:")
+	fmt.Println("  --content        Show message text in the feed instead of its length")
+	fmt.Println("  --admin-url      Admin API address (default from admin.host and admin.port)")
+	fmt.Println()
+	fmt.Println("Keys: q quit, ↑/↓ or j/k scroll, PgUp/PgDn scroll by 10")
+}
+
+func sendHelp() {
+	fmt.Println("Usage: picoclaw send --channel <channel> --to <chat_id> [message]")
+	fmt.Println()
+	fmt.Println("Sends a message through the running gateway's admin API. Without a")
+	fmt.Println("message, or with -, it is read from stdin.")
+	fmt.Println()
+	fmt.Println("Options:")
+	fmt.Println("  -c, --channel    Channel to send on, e.g. whatsapp")
+	fmt.Println("  -t, --to         Chat ID; on WhatsApp also a phone number")
+	fmt.Println("  --thread         Thread to post in, on channels with threads")
+	fmt.Println("  --low            Minor notification, held for the chat's digest when enabled")
+	fmt.Println("  --admin-url      Admin API address (default from admin.host and admin.port)")
+}
+
+func exportCmd() {
+	chat, format, since, output, correlation, trace := "", "jsonl", "", "", "", ""
+	args := os.Args[2:]
+	for i := 0; i < len(args); i++ {
+		if i+1 >= len(args) {
+			fmt.Printf("Missing value for %s\n", args[i])
+			exportHelp()
+			return
+		}
+		switch args[i] {
+		case "--chat":
+			chat = args[i+1]
+		case "--format":
+			format = args[i+1]
+		case "--since":
+			since = args[i+1]
+		case "--correlation":
+			correlation = args[i+1]
+		case "--trace":
+			trace = args[i+1]
+		case "-o", "--output":
+			output = args[i+1]
+		default:
+			fmt.Printf("Unknown option: %s\n", args[i])
+			exportHelp()
+			return
+		}
+		i++
+	}
+	if format != "jsonl" && format != "md" {
+		fmt.Printf("Unknown format %q, use jsonl or md\n", format)
+		return
+	}
+	var sinceTime time.Time
+	if since != "" {
+		t, err := time.ParseInLocation("2006-01-02", since, time.Local)
+		if err != nil {
+			fmt.Printf("Invalid --since date %q, use YYYY-MM-DD\n", since)
+			return
+		}
+		sinceTime = t
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		return
+	}
+	if _, err := os.Stat(historyPath(cfg)); err != nil {
+		fmt.Println("No chat history recorded yet.")
+		return
+	}
+	store, err := history.Open(historyPath(cfg))
+	if err != nil {
+		fmt.Printf("Error opening chat history: %v\n", err)
+		return
+	}
+	defer store.Close()
+	ctx := context.Background()
+
+	if chat == "" && correlation == "" && trace == "" {
+		chats, err := store.Chats(ctx)
+		if err != nil {
+			fmt.Printf("Error listing chats: %v\n", err)
+			return
+		}
+		if len(chats) == 0 {
+			fmt.Println("No chat history recorded yet.")
+			return
+		}
+		fmt.Println("Chats (export one with --chat):")
+		for _, c := range chats {
+			fmt.Printf("  %s:%s  %d messages, %s to %s\n", c.Channel, c.ChatID, c.Messages,
+				c.First.Format("2006-01-02"), c.Last.Format("2006-01-02"))
+		}
+		return
+	}
+
+	var msgs []history.Message
+	title := chat
+	if correlation != "" {
+		// The message with this correlation ID and the replies it led to
+		title = "Correlation " + correlation
+		msgs, err = store.Correlated(ctx, correlation)
+	} else if trace != "" {
+		title = "Trace " + trace
+		msgs, err = store.Traced(ctx, trace)
+	} else {
+		channel, chatID, ok := strings.Cut(chat, ":")
+		if !ok || channel == "" || chatID == "" {
+			fmt.Println("--chat must be channel:chat_id, e.g. telegram:123456")
+			return
+		}
+		msgs, err = store.Messages(ctx, channel, chatID, sinceTime)
+	}
+	if err != nil {
+		fmt.Printf("Error reading chat history: %v\n", err)
+		return
+	}
+
+	out := os.Stdout
+	if output != "" {
+		f, err := os.Create(output)
+		if err != nil {
+			fmt.Printf("Error creating %s: %v\n", output, err)
+			return
+		}
+		defer f.Close()
+		out = f
+	}
+	if format == "md" {
+		err = history.WriteMarkdown(out, title, msgs)
+	} else {
+		err = history.WriteJSONL(out, msgs)
+	}
+	if err != nil {
+		fmt.Printf("Error writing export: %v\n", err)
+		return
+	}
+	if output != "" {
+		fmt.Printf("Exported %d messages to %s\n", len(msgs), output)
+	}
+}
+
+func whatsappCmd() {
+	if len(os.Args) < 3 || os.Args[2] != "migrate-store" {
+		whatsappHelp()
+		return
+	}
+	from, dryRun := "", false
+	args := os.Args[3:]
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--from":
+			if i+1 < len(args) {
+				from = args[i+1]
+				i++
+			}
+		case "--dry-run":
+			dryRun = true
+		default:
+			fmt.Printf("Unknown option: %s\n", args[i])
+			whatsappHelp()
+			return
+		}
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		return
+	}
+	wa := cfg.Channels.WhatsApp
+	if from == "" {
+		found := channels.LegacyWhatsAppStores(wa)
+		if len(found) == 0 {
+			fmt.Println("No WhatsApp session to migrate.")
+			return
+		}
+		from = found[0]
+		for _, other := range found[1:] {
+			fmt.Printf("Also found %s; move it with --from and another account if needed.\n", other)
+		}
+	}
+
+	// A store_path naming the old file becomes the directory next to it
+	layout := wa
+	if layout.LegacyStore() {
+		layout.StorePath = strings.TrimSuffix(layout.StorePath, ".db")
+	}
+	if dryRun {
+		fmt.Printf("Would move %s to %s\n", from, layout.SessionPath())
+		if layout.StorePath != wa.StorePath {
+			fmt.Printf("Would set channels.whatsapp.store_path to %s\n", layout.StorePath)
+		}
+		return
+	}
+
+	to, err := channels.MigrateWhatsAppStore(from, layout)
+	if err != nil {
+		fmt.Printf("Migration failed: %v\n", err)
+		return
+	}
+	fmt.Printf("✓ Moved WhatsApp session from %s to %s\n", from, to)
+	if layout.StorePath != wa.StorePath {
+		cfg.Channels.WhatsApp.StorePath = layout.StorePath
+		if err := config.SaveConfig(getConfigPath(), cfg); err != nil {
+			fmt.Printf("Error saving config: %v\n", err)
+			fmt.Printf("Set channels.whatsapp.store_path to %s by hand.\n", layout.StorePath)
+			return
+		}
+		fmt.Printf("✓ Set channels.whatsapp.store_path to %s\n", layout.StorePath)
+	}
+}
+
+func backupCmd() {
+	output := fmt.Sprintf("picoclaw-backup-%s.pcbak", time.Now().Format("20060102-150405"))
+	args := os.Args[2:]
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "-o", "--output":
+			if i+1 >= len(args) {
+				fmt.Println("Missing value for -o")
+				return
+			}
+			output = args[i+1]
+			i++
+		default:
+			fmt.Printf("Unknown option: %s\n", args[i])
+			fmt.Println("Usage: picoclaw backup [-o file]")
+			return
+		}
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		fmt.Printf("Error loading config: %v\n", err)
+		return
+	}
+	if cfg.State.Backend == state.BackendBolt {
+		fmt.Println("Note: the bolt state store is copied as-is; stop the gateway first for a consistent copy.")
+	}
+	if cfg.State.Backend == state.BackendRedis {
+		fmt.Println("Note: state kept in Redis is not included; back up the Redis server separately.")
+	}
+
+	passphrase, err := readPassphrase(true)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	workspace := cfg.WorkspacePath()
+	sources := []backup.Source{
+		{Name: "config.json", Path: getConfigPath()},
+		{Name: "auth.json", Path: filepath.Join(config.HomeDir(), "auth.json")},
+	}
+	if wa := cfg.Channels.WhatsApp; wa.LegacyStore() {
+		if store := wa.SessionPath(); !isWithin(store, workspace) {
+			sources = append(sources, backup.Source{Name: "whatsapp/" + filepath.Base(store), Path: store})
+		}
+	} else if store := wa.StoreDir(); !isWithin(store, workspace) {
+		sources = append(sources, backup.Source{Name: "whatsapp", Path: store})
+	}
+	sources = append(sources, backup.Source{Name: "workspace", Path: workspace})
+
+	f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		fmt.Printf("Error creating %s: %v\n", output, err)
+		return
+	}
+	n, err := backup.Write(f, passphrase, sources)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(output)
+		fmt.Printf("Backup failed: %v\n", err)
+		return
+	}
+	fmt.Printf("✓ Backed up %d files to %s\n", n, output)
+}
+
+func restoreCmd() {
+	file, skipConfig := "", false
+	for _, arg := range os.Args[2:] {
+		switch {
+		case arg == "--skip-config":
+			skipConfig = true
+		case strings.HasPrefix(arg, "-"):
+			fmt.Printf("Unknown option: %s\n", arg)
+			return
+		default:
+			file = arg
+		}
+	}
+	if file == "" {
+		fmt.Println("Usage: picoclaw restore <file> [--skip-config]")
+		fmt.Println("Stop the gateway first. Existing files are overwritten.")
+		return
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		fmt.Printf("Error opening %s: %v\n", file, err)
+		return
+	}
+	defer f.Close()
+
+	passphrase, err := readPassphrase(false)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	// config.json is the first entry, so the paths of everything after it
+	// come from the restored config.
+	var cfg *config.Config
+	resolve := func(name string) string {
+		switch name {
+		case "config.json":
+			if skipConfig {
+				return ""
+			}
+			return getConfigPath()
+		case "auth.json":
+			return filepath.Join(config.HomeDir(), "auth.json")
+		}
+		if cfg == nil {
+			loaded, err := loadConfig()
+			if err != nil {
+				loaded = config.DefaultConfig()
+			}
+			cfg = loaded
+		}
+		if rest, ok := strings.CutPrefix(name, "workspace/"); ok {
+			return filepath.Join(cfg.WorkspacePath(), filepath.FromSlash(rest))
+		}
+		if rest, ok := strings.CutPrefix(name, "whatsapp/"); ok {
+			wa := cfg.Channels.WhatsApp
+			if wa.LegacyStore() || !strings.Contains(rest, "/") {
+				// A single session file, from or to before per-account stores
+				return wa.SessionPath()
+			}
+			return filepath.Join(wa.StoreDir(), filepath.FromSlash(rest))
+		}
+		return ""
+	}
+
+	n, err := backup.Restore(f, passphrase, resolve)
+	if err != nil {
+		fmt.Printf("Restore failed after %d files: %v\n", n, err)
+		return
+	}
+	fmt.Printf("✓ Restored %d files\n", n)
+}
+
+// readPassphrase takes the backup passphrase from PICOCLAW_BACKUP_PASSPHRASE
+// or prompts for it, twice when confirm is set.
+func readPassphrase(confirm bool) (string, error) {
+	if p := os.Getenv("PICOCLAW_BACKUP_PASSPHRASE"); p != "" {
+		return p, nil
+	}
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("set PICOCLAW_BACKUP_PASSPHRASE or run in a terminal")
+	}
+
+	fmt.Print("Passphrase: ")
+	p, err := term.ReadPassword(fd)
+	fmt.Println()
+	if err != nil {
+		return "", err
+	}
+	if len(p) == 0 {
+		return "", fmt.Errorf("a passphrase is required")
+	}
+	if confirm {
+		fmt.Print("Repeat passphrase: ")
+		again, err := term.ReadPassword(fd)
+		fmt.Println()
+		if err != nil {
+			return "", err
+		}
+		if string(again) != string(p) {
+			return "", fmt.Errorf("passphrases do not match")
+		}
+	}
+	return string(p), nil
+}
+
+// isWithin reports whether path is dir or inside it.
+func isWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func exportHelp() {
+	fmt.Println("\nExport options:")
+	fmt.Println("  --chat           Chat to export as channel:chat_id; omit to list chats")
+	fmt.Println("  --format         jsonl (default) or md")
+	fmt.Println("  --since          Only messages from this date on (YYYY-MM-DD)")
+	fmt.Println("  --correlation    Export a message and the replies it led to")
+	fmt.Println("  --trace          Export every message in a trace, across chats")
+	fmt.Println("  -o, --output     Write to a file instead of stdout")
+}
+
+func feedbackHelp() {
+	fmt.Println("\nFeedback commands:")
+	fmt.Println("  (none)            Count good and bad ratings")
+	fmt.Println("  export            Write ratings as JSON lines")
+	fmt.Println()
+	fmt.Println("Export options:")
+	fmt.Println("  --rating         Only good or bad ratings")
+	fmt.Println("  -o, --output     Write to a file instead of stdout")
+}
+
+func whatsappHelp() {
+	fmt.Println("\nWhatsApp commands:")
+	fmt.Println("  migrate-store     Move a session from before per-account stores into")
+	fmt.Println("                    store_path/<account>/ without pairing again")
+	fmt.Println()
+	fmt.Println("Options:")
+	fmt.Println("  --from <file>    Session database to move (default: the old store_path")
+	fmt.Println("                   file, or the temp directory default)")
+	fmt.Println("  --dry-run        Show what would be moved")
+	fmt.Println()
+	fmt.Println("Stop the gateway first.")
+}
+
 func cronHelp() {
 	fmt.Println("\nCron commands:")
 	fmt.Println("  list              List all scheduled jobs")
@@ -1058,8 +2557,7 @@ func cronHelp() {
 	fmt.Println("  --channel        Channel for delivery")
 }
 
-func cronListCmd(storePath string) {
-	cs := cron.NewCronService(storePath, nil)
+func cronListCmd(cs *cron.CronService) {
 	jobs := cs.ListJobs(true) // Show all jobs, including disabled
 
 	if len(jobs) == 0 {
@@ -1097,7 +2595,7 @@ func cronListCmd(storePath string) {
 	}
 }
 
-func cronAddCmd(storePath string) {
+func cronAddCmd(cs *cron.CronService) {
 	name := ""
 	message := ""
 	var everySec *int64
@@ -1175,7 +2673,6 @@ func cronAddCmd(storePath string) {
 		}
 	}
 
-	cs := cron.NewCronService(storePath, nil)
 	job, err := cs.AddJob(name, schedule, message, deliver, channel, to)
 	if err != nil {
 		fmt.Printf("Error adding job: %v\n", err)
@@ -1185,8 +2682,7 @@ func cronAddCmd(storePath string) {
 	fmt.Printf("✓ Added job '%s' (%s)\n", job.Name, job.ID)
 }
 
-func cronRemoveCmd(storePath, jobID string) {
-	cs := cron.NewCronService(storePath, nil)
+func cronRemoveCmd(cs *cron.CronService, jobID string) {
 	if cs.RemoveJob(jobID) {
 		fmt.Printf("✓ Removed job %s\n", jobID)
 	} else {
@@ -1194,14 +2690,13 @@ func cronRemoveCmd(storePath, jobID string) {
 	}
 }
 
-func cronEnableCmd(storePath string, disable bool) {
+func cronEnableCmd(cs *cron.CronService, disable bool) {
 	if len(os.Args) < 4 {
 		fmt.Println("Usage: picoclaw cron enable/disable <job_id>")
 		return
 	}
 
 	jobID := os.Args[3]
-	cs := cron.NewCronService(storePath, nil)
 	enabled := !disable
 
 	job := cs.EnableJob(jobID, enabled)
@@ -0,0 +1,234 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+// Package picoclaw embeds the gateway's chat channels in other Go programs.
+// A Gateway owns the message bus and the channels configured in cfg, and
+// takes care of their lifecycle; the program decides what to do with the
+// messages that arrive:
+//
+//	cfg := config.DefaultConfig()
+//	cfg.Channels.Telegram.Enabled = true
+//	cfg.Channels.Telegram.Token = os.Getenv("TELEGRAM_TOKEN")
+//
+//	var gw *picoclaw.Gateway
+//	gw, err := picoclaw.New(cfg, picoclaw.WithHandler(func(ctx context.Context, msg bus.InboundMessage) {
+//		gw.Reply(msg, "You said: "+msg.Content)
+//	}))
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	if err := gw.Start(ctx); err != nil {
+//		log.Fatal(err)
+//	}
+//	defer gw.Stop(context.Background())
+//
+// Without a handler, inbound messages queue on Bus for the program to
+// consume, which is how the picoclaw binary hands them to its agent.
+package picoclaw
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/crash"
+	"github.com/sipeed/picoclaw/pkg/leader"
+	"github.com/sipeed/picoclaw/pkg/media"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+// Handler handles one inbound message. Handlers run one at a time, in the
+// order messages arrive.
+type Handler func(ctx context.Context, msg bus.InboundMessage)
+
+// Option configures a Gateway.
+type Option func(*options)
+
+type options struct {
+	bus     *bus.MessageBus
+	state   state.Store
+	media   *media.Store
+	elector *leader.Elector
+	handler Handler
+	filters []filter
+}
+
+type filter struct {
+	name   string
+	filter channels.InboundFilter
+}
+
+// WithBus uses b instead of a new message bus, e.g. to share it with an
+// agent.
+func WithBus(b *bus.MessageBus) Option {
+	return func(o *options) { o.bus = b }
+}
+
+// WithStateStore keeps the outbox, delivery statuses, and other channel
+// state in store, so they survive restarts. Without it nothing is kept.
+func WithStateStore(store state.Store) Option {
+	return func(o *options) { o.state = store }
+}
+
+// WithMediaStore shares attachments a channel cannot take as links from
+// store.
+func WithMediaStore(store *media.Store) Option {
+	return func(o *options) { o.media = store }
+}
+
+// WithElector runs each channel only on the instance elector wins it for,
+// for high availability. The state store must be shared by all instances.
+func WithElector(elector *leader.Elector) Option {
+	return func(o *options) { o.elector = elector }
+}
+
+// WithInboundFilter passes every channel's inbound messages through f,
+// after the allowlist and any filters added before it. See
+// channels.InboundFilter.
+func WithInboundFilter(name string, f channels.InboundFilter) Option {
+	return func(o *options) { o.filters = append(o.filters, filter{name: name, filter: f}) }
+}
+
+// WithHandler passes every inbound message to h once the gateway starts.
+func WithHandler(h Handler) Option {
+	return func(o *options) { o.handler = h }
+}
+
+// Gateway runs the chat channels configured in a config.Config.
+type Gateway struct {
+	bus      *bus.MessageBus
+	channels *channels.Manager
+	handler  Handler
+
+	mu          sync.Mutex
+	running     bool
+	stopHandler context.CancelFunc
+	handlerDone chan struct{}
+}
+
+// New creates the channels enabled in cfg, or config.DefaultConfig when
+// cfg is nil. Nothing connects until Start.
+func New(cfg *config.Config, opts ...Option) (*Gateway, error) {
+	if cfg == nil {
+		cfg = config.DefaultConfig()
+	}
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.bus == nil {
+		o.bus = bus.NewMessageBus()
+	}
+
+	manager, err := channels.NewManager(cfg, o.bus)
+	if err != nil {
+		return nil, err
+	}
+	if o.state != nil {
+		manager.SetStateStore(o.state)
+	}
+	if o.media != nil {
+		manager.SetMediaStore(o.media)
+	}
+	if o.elector != nil {
+		manager.SetElector(o.elector)
+	}
+	for _, f := range o.filters {
+		manager.AddInboundFilter(f.name, f.filter)
+	}
+	return &Gateway{bus: o.bus, channels: manager, handler: o.handler}, nil
+}
+
+// Bus returns the message bus the channels publish to and send from.
+func (g *Gateway) Bus() *bus.MessageBus {
+	return g.bus
+}
+
+// Channels returns the channel manager, for features beyond sending and
+// receiving, such as delivery tracking and presence.
+func (g *Gateway) Channels() *channels.Manager {
+	return g.channels
+}
+
+// Start connects the channels and, with a handler, starts passing it
+// inbound messages. The channels run until Stop or until ctx is cancelled.
+func (g *Gateway) Start(ctx context.Context) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.running {
+		return errors.New("gateway already started")
+	}
+	if err := g.channels.StartAll(ctx); err != nil {
+		return err
+	}
+	g.running = true
+
+	if g.handler != nil {
+		handlerCtx, cancel := context.WithCancel(ctx)
+		g.stopHandler = cancel
+		g.handlerDone = make(chan struct{})
+		go func() {
+			defer close(g.handlerDone)
+			crash.Supervise(handlerCtx, "gateway.handler", g.handle)
+		}()
+	}
+	return nil
+}
+
+// handle passes inbound messages to the handler until ctx is cancelled or
+// the bus stops taking messages.
+func (g *Gateway) handle(ctx context.Context) {
+	for {
+		msg, ok := g.bus.ConsumeInbound(ctx)
+		if !ok {
+			return
+		}
+		done := g.bus.StartProcessing(msg)
+		g.handler(ctx, msg)
+		done()
+	}
+}
+
+// Stop stops the handler, then the channels, waiting for them until ctx
+// expires. Messages that have not reached the handler stay on the bus.
+func (g *Gateway) Stop(ctx context.Context) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.running {
+		return nil
+	}
+	g.running = false
+
+	if g.stopHandler != nil {
+		g.stopHandler()
+		select {
+		case <-g.handlerDone:
+		case <-ctx.Done():
+		}
+		g.stopHandler = nil
+	}
+	return g.channels.StopAll(ctx)
+}
+
+// Send delivers msg to its chat now and returns the ID under which
+// Channels().Delivery reports its progress; see channels.Manager.Send.
+func (g *Gateway) Send(ctx context.Context, msg bus.OutboundMessage) (string, error) {
+	return g.channels.Send(ctx, msg)
+}
+
+// Reply queues content as a reply in the chat, and thread, msg came from.
+// Replies go out in order, linked to msg like the agent's replies.
+func (g *Gateway) Reply(msg bus.InboundMessage, content string) {
+	g.bus.PublishOutbound(bus.OutboundMessage{
+		Channel:  msg.Channel,
+		ChatID:   msg.ChatID,
+		ThreadID: msg.ThreadID,
+		Content:  content,
+	})
+}
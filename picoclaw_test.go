@@ -0,0 +1,64 @@
+package picoclaw
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+func TestGatewayHandler(t *testing.T) {
+	b := bus.NewMessageBus()
+	got := make(chan bus.InboundMessage, 1)
+	var gw *Gateway
+	gw, err := New(nil, WithBus(b), WithHandler(func(ctx context.Context, msg bus.InboundMessage) {
+		gw.Reply(msg, "echo: "+msg.Content)
+		got <- msg
+	}))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if gw.Bus() != b || gw.Channels() == nil {
+		t.Fatal("gateway does not expose its bus and channels")
+	}
+
+	ctx := context.Background()
+	if err := gw.Start(ctx); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if err := gw.Start(ctx); err == nil {
+		t.Error("second Start() should fail")
+	}
+
+	b.PublishInbound(bus.InboundMessage{Channel: "slack", ChatID: "C1", ThreadID: "17.1", Content: "hi"})
+	select {
+	case msg := <-got:
+		if msg.Content != "hi" {
+			t.Errorf("handled %+v", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("handler did not get the message")
+	}
+	reply, ok := b.SubscribeOutbound(ctx)
+	if !ok || reply.Content != "echo: hi" || reply.ChatID != "C1" || reply.ThreadID != "17.1" || len(reply.CorrelationIDs) != 1 {
+		t.Errorf("reply = %+v", reply)
+	}
+
+	if err := gw.Stop(ctx); err != nil {
+		t.Fatalf("Stop() error = %v", err)
+	}
+	if err := gw.Stop(ctx); err != nil {
+		t.Errorf("second Stop() error = %v", err)
+	}
+	// Messages after Stop wait on the bus
+	b.PublishInbound(bus.InboundMessage{Channel: "slack", ChatID: "C1", Content: "later"})
+	select {
+	case msg := <-got:
+		t.Errorf("handled %+v after Stop", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if n, _ := b.QueueLengths(); n != 1 {
+		t.Errorf("inbound queue = %d, want 1", n)
+	}
+}
@@ -0,0 +1,45 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/sipeed/picoclaw/pkg/broadcast"
+)
+
+// maxBroadcastBody bounds a broadcast request.
+const maxBroadcastBody = 1 << 20
+
+// BroadcastHandler serves the broadcast API. GET lists the configured
+// recipient lists. POST sends a broadcast.Request and responds with the
+// delivery report once every recipient has been tried, so alerting systems
+// can check what got through.
+func BroadcastHandler(b *broadcast.Broadcaster) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			WriteJSON(w, http.StatusOK, map[string]interface{}{"lists": b.Lists()})
+		case http.MethodPost:
+			var req broadcast.Request
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBroadcastBody)).Decode(&req); err != nil {
+				WriteJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request: " + err.Error()})
+				return
+			}
+			report, err := b.Send(r.Context(), req)
+			if err != nil {
+				WriteJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+				return
+			}
+			WriteJSON(w, http.StatusOK, report)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
@@ -0,0 +1,108 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/broadcast"
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+type fakeSender struct {
+	mu   sync.Mutex
+	sent []string
+}
+
+func (f *fakeSender) Send(ctx context.Context, msg bus.OutboundMessage) (string, error) {
+	if msg.ChatID == "404" {
+		return "", errors.New("chat not found")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent = append(f.sent, msg.Channel+":"+msg.ChatID+" "+msg.Content)
+	return "", nil
+}
+
+func TestBroadcastHandler(t *testing.T) {
+	sender := &fakeSender{}
+	b, err := broadcast.New(sender, map[string][]string{"ops": {"telegram:1", "telegram:404"}}, 0)
+	if err != nil {
+		t.Fatalf("broadcast.New() error = %v", err)
+	}
+	h := BroadcastHandler(b)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/broadcast", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"chat_id": "404"`) {
+		t.Errorf("GET = %d %s", rec.Code, rec.Body)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/broadcast", strings.NewReader(`{"list":"ops","message":"deploy done"}`)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST = %d %s", rec.Code, rec.Body)
+	}
+	var report broadcast.Report
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("report: %v", err)
+	}
+	if report.Sent != 1 || report.Failed != 1 || report.Results[1].Error != "chat not found" {
+		t.Errorf("report = %+v", report)
+	}
+
+	for _, body := range []string{`{"list":"nope","message":"x"}`, `not json`} {
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/broadcast", strings.NewReader(body)))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("POST %s = %d, want 400", body, rec.Code)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/broadcast", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("DELETE = %d, want 405", rec.Code)
+	}
+}
+
+func TestChatCommandsBroadcast(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	c := NewChatCommands([]string{"telegram:op"}, &fakeChannels{}, msgBus)
+	if got := runAdmin(c, "telegram", "op", "broadcast ops hi"); got != "Broadcasts are not available." {
+		t.Errorf("broadcast without broadcaster = %q", got)
+	}
+
+	sender := &fakeSender{}
+	b, _ := broadcast.New(sender, map[string][]string{"ops": {"slack:C1", "slack:404"}}, 0)
+	c.SetBroadcaster(b)
+
+	if got := runAdmin(c, "telegram", "op", "broadcast"); !strings.Contains(got, "Lists: ops") {
+		t.Errorf("broadcast usage = %q", got)
+	}
+	if got := runAdmin(c, "telegram", "op", "broadcast nope hi"); !strings.HasPrefix(got, "Broadcast failed") {
+		t.Errorf("broadcast to unknown list = %q", got)
+	}
+	if got := runAdmin(c, "telegram", "op", "broadcast ops **Heads up**\nsecond line"); got != "Broadcasting to 2 chat(s) on list ops." {
+		t.Errorf("broadcast = %q", got)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	out, ok := msgBus.SubscribeOutbound(ctx)
+	if !ok {
+		t.Fatal("no delivery report")
+	}
+	if out.ChatID != "op" || out.Channel != "telegram" || !strings.Contains(out.Content, "Sent 1 of 2, 1 failed") || !strings.Contains(out.Content, "- slack:404: chat not found") {
+		t.Errorf("report = %+v", out)
+	}
+	if len(sender.sent) != 1 || sender.sent[0] != "slack:C1 **Heads up**\nsecond line" {
+		t.Errorf("sent = %q", sender.sent)
+	}
+}
@@ -0,0 +1,633 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package admin
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/sipeed/picoclaw/pkg/broadcast"
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/commands"
+	"github.com/sipeed/picoclaw/pkg/crash"
+	"github.com/sipeed/picoclaw/pkg/events"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+const (
+	defaultLogLines = 20
+	maxLogLines     = 50
+)
+
+const chatUsage = "Usage: /admin health | logs [n] | restart <channel> | flush | outbox [channel] | repair <channel> [phone] | allow <channel> <sender_id> | revoke <channel> <sender_id> | grants | block <channel> <sender_id> [reason] | unblock <channel> <sender_id> | blocks | broadcast <list> <message> | drafts [on|off <channel> <chat_id>] | approve <id> [text] | reject <id> | groups | accept <channel:chat_id> | decline <channel:chat_id>"
+
+// ChannelOperations are the channel controls available over chat. It is
+// implemented by channels.Manager.
+type ChannelOperations interface {
+	GetStatus() map[string]interface{}
+	RestartChannel(ctx context.Context, name string) error
+	RepairChannel(ctx context.Context, name, phone string) (string, error)
+}
+
+// AccessGrants manages senders allowed at runtime in addition to the
+// configured allowlists. It is implemented by channels.Manager; "/admin
+// allow" and friends are unavailable when ChannelOperations lacks it.
+type AccessGrants interface {
+	Grant(ctx context.Context, channel, senderID, by string) error
+	Revoke(ctx context.Context, channel, senderID string) (bool, error)
+	Grants(ctx context.Context) ([]channels.Grant, error)
+}
+
+// Blocklist blocks senders whatever the allowlists say, and lists the
+// blocks in force, including automatic ones for flooding. It is
+// implemented by channels.Manager; "/admin block" and friends are
+// unavailable when ChannelOperations lacks it.
+type Blocklist interface {
+	Block(ctx context.Context, channel, senderID, by, reason string) error
+	Unblock(ctx context.Context, channel, senderID string) (bool, error)
+	Blocks(ctx context.Context) ([]channels.Block, error)
+}
+
+// DraftReview reviews replies held for approval. It is implemented by
+// channels.Manager; "/admin drafts" and friends are unavailable when
+// ChannelOperations lacks it.
+type DraftReview interface {
+	Drafts(ctx context.Context) ([]channels.Draft, error)
+	ApproveDraft(ctx context.Context, id, content string) (channels.Draft, error)
+	RejectDraft(ctx context.Context, id string) (channels.Draft, error)
+	SetDraftMode(ctx context.Context, channel, chatID string, on bool) error
+}
+
+// GroupReview accepts or declines groups held for approval. It is
+// implemented by channels.Manager; "/admin groups" and friends are
+// unavailable when ChannelOperations lacks it.
+type GroupReview interface {
+	GroupRequests(ctx context.Context) ([]channels.GroupRequest, error)
+	AcceptGroup(ctx context.Context, key string) (channels.GroupRequest, error)
+	DeclineGroup(ctx context.Context, key string) (channels.GroupRequest, error)
+}
+
+// ChatCommands provides the "/admin" command, which lets operators run a
+// headless gateway from their own chat. Only senders listed as operators
+// may use it.
+type ChatCommands struct {
+	operators map[string]bool // "channel:sender_id"
+	channels  ChannelOperations
+	bus       *bus.MessageBus
+	broadcast *broadcast.Broadcaster // nil until SetBroadcaster
+	started   time.Time
+}
+
+// NewChatCommands creates the admin commands. operators are
+// "channel:sender_id" entries, e.g. "whatsapp:4915112345678@s.whatsapp.net".
+func NewChatCommands(operators []string, channels ChannelOperations, msgBus *bus.MessageBus) *ChatCommands {
+	c := &ChatCommands{
+		operators: make(map[string]bool),
+		channels:  channels,
+		bus:       msgBus,
+		started:   time.Now(),
+	}
+	for _, op := range operators {
+		if op = strings.TrimSpace(op); op != "" {
+			c.operators[op] = true
+		}
+	}
+	return c
+}
+
+// SetBroadcaster enables "/admin broadcast".
+func (c *ChatCommands) SetBroadcaster(b *broadcast.Broadcaster) {
+	c.broadcast = b
+}
+
+// Commands implements commands.Provider. The command is left out of /help.
+func (c *ChatCommands) Commands() []commands.Command {
+	return []commands.Command{{
+		Name:        "admin",
+		Usage:       "<health|logs|restart|flush|outbox|repair|allow|revoke|grants|block|unblock|blocks|broadcast|drafts|approve|reject|groups|accept|decline>",
+		Description: "Operate the gateway",
+		Hidden:      true,
+		Handler:     c.handle,
+	}}
+}
+
+// isOperator reports whether the sender is a configured operator. Channels
+// that report composite sender IDs ("123|username") match on any part; a
+// sender the message only claimed never does.
+func (c *ChatCommands) isOperator(channel, senderID string) bool {
+	if bus.IsClaimedSender(senderID) {
+		return false
+	}
+	if c.operators[channel+":"+senderID] {
+		return true
+	}
+	for _, part := range strings.Split(senderID, "|") {
+		if part != "" && c.operators[channel+":"+part] {
+			return true
+		}
+	}
+	return false
+}
+
+// directMessage reports whether msg came from a direct message with the
+// bot. Channels say so with "is_dm" or "is_group"; a message from a channel
+// that says neither counts as direct only when its chat is the sender's.
+func directMessage(msg bus.InboundMessage) bool {
+	switch {
+	case msg.Metadata["is_dm"] == "true" || msg.Metadata["is_group"] == "false":
+		return true
+	case msg.Metadata["is_dm"] != "" || msg.Metadata["is_group"] != "":
+		return false
+	}
+	if msg.ChatID == "" {
+		return false
+	}
+	for _, part := range append([]string{msg.SenderID}, strings.Split(msg.SenderID, "|")...) {
+		if part == msg.ChatID {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *ChatCommands) handle(ctx context.Context, req commands.Request) string {
+	msg := req.Msg
+	if !c.isOperator(msg.Channel, msg.SenderID) {
+		events.Security("admin", "Rejected admin command from non-operator",
+			map[string]interface{}{"channel": msg.Channel, "sender_id": msg.SenderID})
+		return "Not authorized."
+	}
+	// Replies carry logs and grants, which a group's other members must not see
+	if !directMessage(msg) {
+		return "Admin commands work only in a direct message with the bot."
+	}
+	if len(req.Args) == 0 {
+		return chatUsage
+	}
+
+	sub, args := strings.ToLower(req.Args[0]), req.Args[1:]
+	logger.InfoCF("admin", "Admin command",
+		map[string]interface{}{
+			"command":   sub,
+			"args":      strings.Join(args, " "),
+			"channel":   msg.Channel,
+			"sender_id": msg.SenderID,
+		})
+
+	switch sub {
+	case "health", "status":
+		return c.health()
+	case "logs", "log":
+		return c.logs(args)
+	case "restart":
+		if len(args) != 1 {
+			return "Usage: /admin restart <channel>"
+		}
+		if err := c.channels.RestartChannel(ctx, args[0]); err != nil {
+			return fmt.Sprintf("Restart failed: %v", err)
+		}
+		return fmt.Sprintf("Restarted %s.", args[0])
+	case "flush":
+		return c.flush()
+	case "outbox":
+		return c.outbox(ctx, args)
+	case "repair", "pair":
+		return c.repair(ctx, args)
+	case "allow", "revoke", "grants":
+		return c.grants(ctx, sub, args, msg.Channel+":"+msg.SenderID)
+	case "block", "unblock", "blocks":
+		return c.blocks(ctx, sub, args, req.Raw, msg.Channel+":"+msg.SenderID)
+	case "broadcast":
+		return c.sendBroadcast(msg, req.Raw)
+	case "drafts", "approve", "reject":
+		return c.drafts(ctx, sub, args, req.Raw)
+	case "groups", "accept", "decline":
+		return c.groups(ctx, sub, args)
+	default:
+		return chatUsage
+	}
+}
+
+// health summarizes process, queue, and channel state.
+func (c *ChatCommands) health() string {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	inbound, outbound := c.bus.QueueLengths()
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Uptime: %s\n", time.Since(c.started).Round(time.Second))
+	fmt.Fprintf(&sb, "Goroutines: %d, heap %.1f MB\n", runtime.NumGoroutine(), float64(mem.HeapAlloc)/(1<<20))
+	fmt.Fprintf(&sb, "Crashes recovered: %d\n", crash.Count())
+	fmt.Fprintf(&sb, "Queues: %d inbound, %d outbound\n", inbound, outbound)
+
+	status := c.channels.GetStatus()
+	names := make([]string, 0, len(status))
+	for name := range status {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	sb.WriteString("Channels:")
+	if len(names) == 0 {
+		sb.WriteString(" none")
+	}
+	for _, name := range names {
+		state := "stopped"
+		if s, ok := status[name].(map[string]interface{}); ok {
+			if v, ok := s["state"].(string); ok {
+				state = v
+			}
+		}
+		fmt.Fprintf(&sb, "\n- %s: %s", name, state)
+	}
+	return sb.String()
+}
+
+func (c *ChatCommands) logs(args []string) string {
+	n := defaultLogLines
+	if len(args) > 0 {
+		v, err := strconv.Atoi(args[0])
+		if err != nil || v <= 0 {
+			return "Usage: /admin logs [n]"
+		}
+		n = min(v, maxLogLines)
+	}
+	lines := logger.Recent(n)
+	if len(lines) == 0 {
+		return "No log lines yet."
+	}
+	return strings.Join(lines, "\n")
+}
+
+// flush drops queued messages, e.g. after a flood or a stuck backlog. The
+// message being handled is not affected.
+func (c *ChatCommands) flush() string {
+	dropped := c.bus.DrainInbound()
+	for _, msg := range dropped {
+		utils.RemoveMedia(msg.Media)
+	}
+	outbound := c.bus.DiscardOutbound()
+	logger.InfoCF("admin", "Flushed message queues",
+		map[string]interface{}{"inbound": len(dropped), "outbound": outbound})
+	return fmt.Sprintf("Dropped %d inbound and %d outbound message(s).", len(dropped), outbound)
+}
+
+// outbox lists how many messages wait in each channel's retry queue, or
+// the messages waiting for one channel.
+func (c *ChatCommands) outbox(ctx context.Context, args []string) string {
+	review, ok := c.channels.(OutboxReview)
+	if !ok {
+		return "The outbox is not available."
+	}
+	if len(args) > 1 {
+		return "Usage: /admin outbox [channel]"
+	}
+	pending, err := review.Pending(ctx)
+	if err != nil {
+		return fmt.Sprintf("Failed to read the outbox: %v", err)
+	}
+
+	var sb strings.Builder
+	if len(args) == 1 {
+		list := pending[args[0]]
+		if len(list) == 0 {
+			return fmt.Sprintf("Nothing waiting for %s.", args[0])
+		}
+		fmt.Fprintf(&sb, "Waiting for %s:", args[0])
+		for _, p := range list {
+			fmt.Fprintf(&sb, "\n- %s to %s, queued %s, %d attempt(s)", p.Key, p.ChatID, p.Queued.Format("2006-01-02 15:04"), p.Attempts)
+			if p.Collapsed > 0 {
+				fmt.Fprintf(&sb, ", %d duplicate(s) collapsed", p.Collapsed)
+			}
+			if p.Held {
+				sb.WriteString(", held")
+			}
+			if p.LastError != "" {
+				fmt.Fprintf(&sb, ": %s", p.LastError)
+			}
+		}
+		return sb.String()
+	}
+
+	names := make([]string, 0, len(pending))
+	for name := range pending {
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return "The outbox is empty."
+	}
+	sort.Strings(names)
+	sb.WriteString("Outbox:")
+	for _, name := range names {
+		fmt.Fprintf(&sb, "\n- %s: %d message(s), oldest queued %s", name, len(pending[name]), pending[name][0].Queued.Format("2006-01-02 15:04"))
+	}
+	return sb.String()
+}
+
+func (c *ChatCommands) repair(ctx context.Context, args []string) string {
+	if len(args) == 0 || len(args) > 2 {
+		return "Usage: /admin repair <channel> [phone]"
+	}
+	phone := ""
+	if len(args) == 2 {
+		phone = args[1]
+	}
+	code, err := c.channels.RepairChannel(ctx, args[0], phone)
+	if err != nil {
+		return fmt.Sprintf("Re-pairing failed: %v", err)
+	}
+	if code != "" {
+		return fmt.Sprintf("Pairing code for %s: %s\nEnter it on the phone under Linked devices > Link with phone number.", args[0], code)
+	}
+	return fmt.Sprintf("Re-pairing %s. Scan the QR code shown on the device console.", args[0])
+}
+
+// grants adds, removes, or lists runtime allowlist grants.
+func (c *ChatCommands) grants(ctx context.Context, sub string, args []string, by string) string {
+	grants, ok := c.channels.(AccessGrants)
+	if !ok {
+		return "Allowlist grants are not available."
+	}
+
+	if sub == "grants" {
+		list, err := grants.Grants(ctx)
+		if err != nil {
+			return fmt.Sprintf("Failed to list grants: %v", err)
+		}
+		if len(list) == 0 {
+			return "No senders have been granted access."
+		}
+		var sb strings.Builder
+		sb.WriteString("Granted senders:")
+		for _, g := range list {
+			fmt.Fprintf(&sb, "\n- %s (by %s, %s)", g.Account, g.By, g.Time.Format("2006-01-02"))
+		}
+		return sb.String()
+	}
+
+	if len(args) != 2 {
+		return fmt.Sprintf("Usage: /admin %s <channel> <sender_id>", sub)
+	}
+	channel, senderID := args[0], args[1]
+	if sub == "allow" {
+		if err := grants.Grant(ctx, channel, senderID, by); err != nil {
+			return fmt.Sprintf("Allow failed: %v", err)
+		}
+		return fmt.Sprintf("Allowed %s on %s.", senderID, channel)
+	}
+	removed, err := grants.Revoke(ctx, channel, senderID)
+	if err != nil {
+		return fmt.Sprintf("Revoke failed: %v", err)
+	}
+	if !removed {
+		return fmt.Sprintf("%s has no grant on %s.", senderID, channel)
+	}
+	return fmt.Sprintf("Revoked %s on %s.", senderID, channel)
+}
+
+// blocks blocks or unblocks a sender, or lists the blocks in force. raw is
+// the whole argument string, for the reason given when blocking.
+func (c *ChatCommands) blocks(ctx context.Context, sub string, args []string, raw, by string) string {
+	blocklist, ok := c.channels.(Blocklist)
+	if !ok {
+		return "The blocklist is not available."
+	}
+
+	if sub == "blocks" {
+		list, err := blocklist.Blocks(ctx)
+		if err != nil {
+			return fmt.Sprintf("Failed to list blocks: %v", err)
+		}
+		if len(list) == 0 {
+			return "No senders are blocked."
+		}
+		var sb strings.Builder
+		sb.WriteString("Blocked senders:")
+		for _, b := range list {
+			fmt.Fprintf(&sb, "\n- %s (by %s, %s", b.Account, b.By, b.Time.Format("2006-01-02 15:04"))
+			if !b.Permanent() {
+				fmt.Fprintf(&sb, ", until %s", b.Until.Format("2006-01-02 15:04"))
+			}
+			if b.Count > 0 {
+				fmt.Fprintf(&sb, ", %d automatic block(s)", b.Count)
+			}
+			sb.WriteString(")")
+			if b.Reason != "" {
+				fmt.Fprintf(&sb, ": %s", b.Reason)
+			}
+		}
+		return sb.String()
+	}
+
+	if sub == "block" {
+		_, rest := cutWord(raw) // "block"
+		channel, rest := cutWord(rest)
+		senderID, reason := cutWord(rest)
+		if senderID == "" {
+			return "Usage: /admin block <channel> <sender_id> [reason]"
+		}
+		if err := blocklist.Block(ctx, channel, senderID, by, reason); err != nil {
+			return fmt.Sprintf("Block failed: %v", err)
+		}
+		return fmt.Sprintf("Blocked %s on %s.", senderID, channel)
+	}
+
+	if len(args) != 2 {
+		return "Usage: /admin unblock <channel> <sender_id>"
+	}
+	channel, senderID := args[0], args[1]
+	unblocked, err := blocklist.Unblock(ctx, channel, senderID)
+	if err != nil {
+		return fmt.Sprintf("Unblock failed: %v", err)
+	}
+	if !unblocked {
+		return fmt.Sprintf("%s is not blocked on %s.", senderID, channel)
+	}
+	return fmt.Sprintf("Unblocked %s on %s.", senderID, channel)
+}
+
+// drafts lists, approves, and rejects replies held for approval, and
+// switches draft mode for a chat. raw is the whole argument string, so an
+// approved reply's corrected text keeps its line breaks.
+func (c *ChatCommands) drafts(ctx context.Context, sub string, args []string, raw string) string {
+	review, ok := c.channels.(DraftReview)
+	if !ok {
+		return "Drafts are not available."
+	}
+
+	switch sub {
+	case "approve":
+		_, rest := cutWord(raw) // "approve"
+		id, text := cutWord(rest)
+		if id == "" {
+			return "Usage: /admin approve <id> [corrected text]"
+		}
+		d, err := review.ApproveDraft(ctx, id, text)
+		if err != nil {
+			return fmt.Sprintf("Approve failed: %v", err)
+		}
+		return fmt.Sprintf("Sent draft %s to %s:%s.", id, d.Message.Channel, d.Message.ChatID)
+	case "reject":
+		if len(args) != 1 {
+			return "Usage: /admin reject <id>"
+		}
+		d, err := review.RejectDraft(ctx, args[0])
+		if err != nil {
+			return fmt.Sprintf("Reject failed: %v", err)
+		}
+		return fmt.Sprintf("Dropped draft %s to %s:%s.", args[0], d.Message.Channel, d.Message.ChatID)
+	}
+
+	if len(args) > 0 {
+		mode := strings.ToLower(args[0])
+		if len(args) != 3 || (mode != "on" && mode != "off") {
+			return "Usage: /admin drafts [on|off <channel> <chat_id>]"
+		}
+		if err := review.SetDraftMode(ctx, args[1], args[2], mode == "on"); err != nil {
+			return fmt.Sprintf("Drafts %s failed: %v", mode, err)
+		}
+		if mode == "on" {
+			return fmt.Sprintf("Replies to %s:%s are now held for approval.", args[1], args[2])
+		}
+		return fmt.Sprintf("Replies to %s:%s are now sent directly.", args[1], args[2])
+	}
+
+	list, err := review.Drafts(ctx)
+	if err != nil {
+		return fmt.Sprintf("Failed to list drafts: %v", err)
+	}
+	if len(list) == 0 {
+		return "No drafts are waiting for approval."
+	}
+	var sb strings.Builder
+	sb.WriteString("Drafts waiting for approval:")
+	for _, d := range list {
+		fmt.Fprintf(&sb, "\n- %s to %s:%s (%s): %s", d.ID, d.Message.Channel, d.Message.ChatID,
+			d.Created.Format("2006-01-02 15:04"), utils.Truncate(d.Message.Content, 80))
+	}
+	return sb.String()
+}
+
+// groups lists the groups held for approval, or accepts or declines one.
+func (c *ChatCommands) groups(ctx context.Context, sub string, args []string) string {
+	review, ok := c.channels.(GroupReview)
+	if !ok {
+		return "Group approval is not available."
+	}
+
+	switch sub {
+	case "accept":
+		if len(args) != 1 {
+			return "Usage: /admin accept <channel:chat_id>"
+		}
+		if _, err := review.AcceptGroup(ctx, args[0]); err != nil {
+			return fmt.Sprintf("Accept failed: %v", err)
+		}
+		return fmt.Sprintf("The bot now takes part in %s.", args[0])
+	case "decline":
+		if len(args) != 1 {
+			return "Usage: /admin decline <channel:chat_id>"
+		}
+		if _, err := review.DeclineGroup(ctx, args[0]); err != nil {
+			return fmt.Sprintf("Decline failed: %v", err)
+		}
+		return fmt.Sprintf("Declined %s.", args[0])
+	}
+
+	list, err := review.GroupRequests(ctx)
+	if err != nil {
+		return fmt.Sprintf("Failed to list groups: %v", err)
+	}
+	if len(list) == 0 {
+		return "No groups are waiting for approval."
+	}
+	var sb strings.Builder
+	sb.WriteString("Groups waiting for approval:")
+	for _, r := range list {
+		fmt.Fprintf(&sb, "\n- %s", r.Key())
+		if r.Name != "" {
+			fmt.Fprintf(&sb, " %q", r.Name)
+		}
+		if r.By != "" {
+			fmt.Fprintf(&sb, " by %s", r.By)
+		}
+		fmt.Fprintf(&sb, " (%s", r.Created.Format("2006-01-02 15:04"))
+		if r.Status == channels.GroupDeclined {
+			sb.WriteString(", declined")
+		}
+		sb.WriteString(")")
+	}
+	return sb.String()
+}
+
+// sendBroadcast starts a broadcast to a configured list and sends the
+// delivery report to the operator's chat once it is done, since pacing can
+// make a long list take minutes. raw is the whole argument string, so the
+// message keeps its line breaks.
+func (c *ChatCommands) sendBroadcast(msg bus.InboundMessage, raw string) string {
+	if c.broadcast == nil {
+		return "Broadcasts are not available."
+	}
+	_, rest := cutWord(raw) // "broadcast"
+	list, message := cutWord(rest)
+	if list == "" || message == "" {
+		names := c.broadcast.ListNames()
+		if len(names) == 0 {
+			return "Usage: /admin broadcast <list> <message>\nNo broadcast lists are configured."
+		}
+		return "Usage: /admin broadcast <list> <message>\nLists: " + strings.Join(names, ", ")
+	}
+
+	req := broadcast.Request{List: list, Message: message}
+	targets, err := c.broadcast.Recipients(req)
+	if err != nil {
+		return fmt.Sprintf("Broadcast failed: %v", err)
+	}
+	go func() {
+		reply := ""
+		if report, err := c.broadcast.Send(context.Background(), req); err != nil {
+			reply = fmt.Sprintf("Broadcast failed: %v", err)
+		} else {
+			reply = formatReport(report)
+		}
+		c.bus.PublishOutbound(bus.OutboundMessage{Channel: msg.Channel, ChatID: msg.ChatID, Content: reply})
+	}()
+	return fmt.Sprintf("Broadcasting to %d chat(s) on list %s.", len(targets), list)
+}
+
+// formatReport lists the chats a broadcast did not reach.
+func formatReport(report *broadcast.Report) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Broadcast to %s: %s.", report.List, report.Summary())
+	for _, r := range report.Results {
+		switch r.Status {
+		case broadcast.StatusFailed:
+			fmt.Fprintf(&sb, "\n- %s: %s", r.Target, r.Error)
+		case broadcast.StatusSkipped:
+			fmt.Fprintf(&sb, "\n- %s: skipped", r.Target)
+		}
+	}
+	return sb.String()
+}
+
+// cutWord splits s into its first whitespace-delimited word and the rest,
+// with surrounding whitespace trimmed.
+func cutWord(s string) (word, rest string) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, unicode.IsSpace)
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], strings.TrimSpace(s[i:])
+}
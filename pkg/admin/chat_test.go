@@ -0,0 +1,454 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/commands"
+)
+
+type fakeChannels struct {
+	restarted []string
+	repaired  []string
+	code      string
+	err       error
+}
+
+func (f *fakeChannels) GetStatus() map[string]interface{} {
+	return map[string]interface{}{
+		"whatsapp": map[string]interface{}{"enabled": true, "running": true, "state": "reconnecting"},
+		"telegram": map[string]interface{}{"enabled": true, "running": false, "state": "stopped"},
+	}
+}
+
+func (f *fakeChannels) RestartChannel(ctx context.Context, name string) error {
+	f.restarted = append(f.restarted, name)
+	return f.err
+}
+
+func (f *fakeChannels) RepairChannel(ctx context.Context, name, phone string) (string, error) {
+	f.repaired = append(f.repaired, name+" "+phone)
+	return f.code, f.err
+}
+
+type fakeGrants struct {
+	fakeChannels
+	granted map[string]string
+}
+
+func (f *fakeGrants) Grant(ctx context.Context, channel, senderID, by string) error {
+	f.granted[channel+":"+senderID] = by
+	return nil
+}
+
+func (f *fakeGrants) Revoke(ctx context.Context, channel, senderID string) (bool, error) {
+	_, ok := f.granted[channel+":"+senderID]
+	delete(f.granted, channel+":"+senderID)
+	return ok, nil
+}
+
+func (f *fakeGrants) Grants(ctx context.Context) ([]channels.Grant, error) {
+	var out []channels.Grant
+	for account, by := range f.granted {
+		out = append(out, channels.Grant{Account: account, By: by, Time: time.Now()})
+	}
+	return out, nil
+}
+
+func runAdmin(c *ChatCommands, channel, sender, args string) string {
+	return c.handle(context.Background(), commands.Request{
+		Msg:  bus.InboundMessage{Channel: channel, SenderID: sender, ChatID: sender},
+		Name: "admin",
+		Args: strings.Fields(args),
+		Raw:  args,
+	})
+}
+
+func TestChatCommandsRequireOperator(t *testing.T) {
+	fake := &fakeChannels{}
+	c := NewChatCommands([]string{"whatsapp:123@s.whatsapp.net", " telegram:42 ", "mqtt:claimed:alice"}, fake, bus.NewMessageBus())
+
+	tests := []struct {
+		name    string
+		channel string
+		sender  string
+		allowed bool
+	}{
+		{"operator", "whatsapp", "123@s.whatsapp.net", true},
+		{"composite sender id", "telegram", "42|alice", true},
+		{"other sender", "whatsapp", "999@s.whatsapp.net", false},
+		{"operator id on other channel", "discord", "42", false},
+		{"claimed sender", "mqtt", "claimed:alice", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := runAdmin(c, tt.channel, tt.sender, "restart whatsapp")
+			if denied := got == "Not authorized."; denied == tt.allowed {
+				t.Errorf("reply = %q, allowed = %v", got, tt.allowed)
+			}
+		})
+	}
+	if len(fake.restarted) != 2 {
+		t.Errorf("restarted = %v, want two restarts", fake.restarted)
+	}
+}
+
+func TestChatCommandsOnlyInDirectMessages(t *testing.T) {
+	fake := &fakeChannels{}
+	c := NewChatCommands([]string{"whatsapp:123@s.whatsapp.net", "slack:U1"}, fake, bus.NewMessageBus())
+
+	for _, msg := range []bus.InboundMessage{
+		{Channel: "whatsapp", SenderID: "123@s.whatsapp.net", ChatID: "456@g.us", Metadata: map[string]string{"is_group": "true"}},
+		{Channel: "slack", SenderID: "U1", ChatID: "C1", Metadata: map[string]string{"is_dm": "false"}},
+		// A channel that says nothing about the chat, in a chat not the sender's
+		{Channel: "whatsapp", SenderID: "123@s.whatsapp.net", ChatID: "456@g.us"},
+		{Channel: "whatsapp", SenderID: "123@s.whatsapp.net"},
+	} {
+		got := c.handle(context.Background(), commands.Request{Msg: msg, Name: "admin", Args: []string{"logs"}, Raw: "logs"})
+		if !strings.Contains(got, "only in a direct message") {
+			t.Errorf("%s group: reply = %q", msg.Channel, got)
+		}
+	}
+	got := c.handle(context.Background(), commands.Request{
+		Msg:  bus.InboundMessage{Channel: "slack", SenderID: "U1", ChatID: "D1", Metadata: map[string]string{"is_dm": "true"}},
+		Name: "admin", Args: []string{"restart", "slack"}, Raw: "restart slack",
+	})
+	if got != "Restarted slack." {
+		t.Errorf("DM reply = %q", got)
+	}
+	// Without metadata, the sender's own chat is a direct message
+	got = c.handle(context.Background(), commands.Request{
+		Msg:  bus.InboundMessage{Channel: "whatsapp", SenderID: "123@s.whatsapp.net", ChatID: "123@s.whatsapp.net"},
+		Name: "admin", Args: []string{"restart", "whatsapp"}, Raw: "restart whatsapp",
+	})
+	if got != "Restarted whatsapp." {
+		t.Errorf("DM without metadata reply = %q", got)
+	}
+}
+
+func TestChatCommandsHealth(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	msgBus.PublishInbound(bus.InboundMessage{Content: "queued"})
+	c := NewChatCommands([]string{"cli:op"}, &fakeChannels{}, msgBus)
+
+	got := runAdmin(c, "cli", "op", "health")
+	for _, want := range []string{"Uptime:", "Queues: 1 inbound, 0 outbound", "- telegram: stopped", "- whatsapp: reconnecting"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("health missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestChatCommandsFlush(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	msgBus.PublishInbound(bus.InboundMessage{Content: "a"})
+	msgBus.PublishInbound(bus.InboundMessage{Content: "b"})
+	msgBus.PublishOutbound(bus.OutboundMessage{Content: "c"})
+	c := NewChatCommands([]string{"cli:op"}, &fakeChannels{}, msgBus)
+
+	got := runAdmin(c, "cli", "op", "flush")
+	if got != "Dropped 2 inbound and 1 outbound message(s)." {
+		t.Errorf("flush = %q", got)
+	}
+	if in, out := msgBus.QueueLengths(); in != 0 || out != 0 {
+		t.Errorf("queues = %d/%d after flush", in, out)
+	}
+}
+
+func TestChatCommandsRepair(t *testing.T) {
+	fake := &fakeChannels{code: "ABCD-EFGH"}
+	c := NewChatCommands([]string{"cli:op"}, fake, bus.NewMessageBus())
+
+	if got := runAdmin(c, "cli", "op", "repair whatsapp 4915112345678"); !strings.Contains(got, "ABCD-EFGH") {
+		t.Errorf("repair with phone = %q, want the pairing code", got)
+	}
+	fake.code = ""
+	if got := runAdmin(c, "cli", "op", "repair whatsapp"); !strings.Contains(got, "QR code") {
+		t.Errorf("repair without phone = %q", got)
+	}
+	if want := []string{"whatsapp 4915112345678", "whatsapp "}; strings.Join(fake.repaired, ",") != strings.Join(want, ",") {
+		t.Errorf("repaired = %q, want %q", fake.repaired, want)
+	}
+
+	fake.err = errors.New("channel telegram does not support re-pairing")
+	if got := runAdmin(c, "cli", "op", "repair telegram"); !strings.HasPrefix(got, "Re-pairing failed") {
+		t.Errorf("repair error = %q", got)
+	}
+}
+
+func TestChatCommandsLogsAndUsage(t *testing.T) {
+	c := NewChatCommands([]string{"cli:op"}, &fakeChannels{}, bus.NewMessageBus())
+
+	tests := []struct {
+		args string
+		want string
+	}{
+		{"", chatUsage},
+		{"bogus", chatUsage},
+		{"logs x", "Usage: /admin logs [n]"},
+		{"restart", "Usage: /admin restart <channel>"},
+		{"logs 3", "Admin command"}, // the command itself was just logged
+	}
+	for _, tt := range tests {
+		if got := runAdmin(c, "cli", "op", tt.args); !strings.Contains(got, tt.want) {
+			t.Errorf("/admin %s = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestChatCommandsGrants(t *testing.T) {
+	if got := runAdmin(NewChatCommands([]string{"cli:op"}, &fakeChannels{}, bus.NewMessageBus()), "cli", "op", "grants"); got != "Allowlist grants are not available." {
+		t.Errorf("grants without support = %q", got)
+	}
+
+	fake := &fakeGrants{granted: make(map[string]string)}
+	c := NewChatCommands([]string{"telegram:1"}, fake, bus.NewMessageBus())
+
+	if got := runAdmin(c, "telegram", "1", "allow telegram"); !strings.HasPrefix(got, "Usage:") {
+		t.Errorf("allow without sender = %q", got)
+	}
+	if got := runAdmin(c, "telegram", "1", "allow telegram 2"); got != "Allowed 2 on telegram." {
+		t.Errorf("allow = %q", got)
+	}
+	if fake.granted["telegram:2"] != "telegram:1" {
+		t.Errorf("granted = %v", fake.granted)
+	}
+	if got := runAdmin(c, "telegram", "1", "grants"); !strings.Contains(got, "- telegram:2 (by telegram:1") {
+		t.Errorf("grants = %q", got)
+	}
+	if got := runAdmin(c, "telegram", "1", "revoke telegram 2"); got != "Revoked 2 on telegram." {
+		t.Errorf("revoke = %q", got)
+	}
+	if got := runAdmin(c, "telegram", "1", "revoke telegram 2"); got != "2 has no grant on telegram." {
+		t.Errorf("second revoke = %q", got)
+	}
+}
+
+type fakeBlocklist struct {
+	fakeChannels
+	blocked map[string]channels.Block
+}
+
+func (f *fakeBlocklist) Block(ctx context.Context, channel, senderID, by, reason string) error {
+	f.blocked[channel+":"+senderID] = channels.Block{Account: channel + ":" + senderID, By: by, Reason: reason, Time: time.Now()}
+	return nil
+}
+
+func (f *fakeBlocklist) Unblock(ctx context.Context, channel, senderID string) (bool, error) {
+	_, ok := f.blocked[channel+":"+senderID]
+	delete(f.blocked, channel+":"+senderID)
+	return ok, nil
+}
+
+func (f *fakeBlocklist) Blocks(ctx context.Context) ([]channels.Block, error) {
+	var out []channels.Block
+	for _, b := range f.blocked {
+		out = append(out, b)
+	}
+	return out, nil
+}
+
+func TestChatCommandsBlocklist(t *testing.T) {
+	if got := runAdmin(NewChatCommands([]string{"cli:op"}, &fakeChannels{}, bus.NewMessageBus()), "cli", "op", "blocks"); got != "The blocklist is not available." {
+		t.Errorf("blocks without support = %q", got)
+	}
+
+	fake := &fakeBlocklist{blocked: map[string]channels.Block{
+		"whatsapp:3": {Account: "whatsapp:3", By: channels.BlockedAuto, Reason: "flooding", Time: time.Now(), Until: time.Now().Add(time.Hour), Count: 1},
+	}}
+	c := NewChatCommands([]string{"telegram:1"}, fake, bus.NewMessageBus())
+
+	if got := runAdmin(c, "telegram", "1", "block telegram"); !strings.HasPrefix(got, "Usage:") {
+		t.Errorf("block without sender = %q", got)
+	}
+	if got := runAdmin(c, "telegram", "1", "block telegram 2 sends  spam"); got != "Blocked 2 on telegram." {
+		t.Errorf("block = %q", got)
+	}
+	if b := fake.blocked["telegram:2"]; b.By != "telegram:1" || b.Reason != "sends  spam" {
+		t.Errorf("blocked = %+v", b)
+	}
+	got := runAdmin(c, "telegram", "1", "blocks")
+	for _, want := range []string{"- telegram:2 (by telegram:1", "): sends  spam", "- whatsapp:3 (by auto", "until", "1 automatic block(s)"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("blocks = %q, want it to contain %q", got, want)
+		}
+	}
+	if got := runAdmin(c, "telegram", "1", "unblock telegram 2"); got != "Unblocked 2 on telegram." {
+		t.Errorf("unblock = %q", got)
+	}
+	if got := runAdmin(c, "telegram", "1", "unblock telegram 2"); got != "2 is not blocked on telegram." {
+		t.Errorf("second unblock = %q", got)
+	}
+}
+
+type fakeDrafts struct {
+	fakeChannels
+	drafts map[string]channels.Draft
+	sent   []string
+	modes  map[string]bool
+}
+
+func (f *fakeDrafts) Drafts(ctx context.Context) ([]channels.Draft, error) {
+	var out []channels.Draft
+	for _, d := range f.drafts {
+		out = append(out, d)
+	}
+	return out, nil
+}
+
+func (f *fakeDrafts) ApproveDraft(ctx context.Context, id, content string) (channels.Draft, error) {
+	d, ok := f.drafts[id]
+	if !ok {
+		return d, errors.New("no draft " + id)
+	}
+	delete(f.drafts, id)
+	if content == "" {
+		content = d.Message.Content
+	}
+	f.sent = append(f.sent, content)
+	return d, nil
+}
+
+func (f *fakeDrafts) RejectDraft(ctx context.Context, id string) (channels.Draft, error) {
+	d, ok := f.drafts[id]
+	if !ok {
+		return d, errors.New("no draft " + id)
+	}
+	delete(f.drafts, id)
+	return d, nil
+}
+
+func (f *fakeDrafts) SetDraftMode(ctx context.Context, channel, chatID string, on bool) error {
+	f.modes[channel+":"+chatID] = on
+	return nil
+}
+
+func TestChatCommandsDrafts(t *testing.T) {
+	if got := runAdmin(NewChatCommands([]string{"cli:op"}, &fakeChannels{}, bus.NewMessageBus()), "cli", "op", "drafts"); got != "Drafts are not available." {
+		t.Errorf("drafts without support = %q", got)
+	}
+
+	msg := bus.OutboundMessage{Channel: "whatsapp", ChatID: "49@s.whatsapp.net", Content: "Your order has shipped."}
+	fake := &fakeDrafts{
+		drafts: map[string]channels.Draft{"a1": {ID: "a1", Message: msg}, "b2": {ID: "b2", Message: msg}},
+		modes:  make(map[string]bool),
+	}
+	c := NewChatCommands([]string{"telegram:1"}, fake, bus.NewMessageBus())
+
+	tests := []struct {
+		args string
+		want string
+	}{
+		{"drafts", "- a1 to whatsapp:49@s.whatsapp.net"},
+		{"approve a1 Your order has shipped!\nTracking: 123", "Sent draft a1 to whatsapp:49@s.whatsapp.net."},
+		{"approve a1", "Approve failed: no draft a1"},
+		{"reject b2", "Dropped draft b2 to whatsapp:49@s.whatsapp.net."},
+		{"drafts", "No drafts are waiting for approval."},
+		{"drafts on whatsapp", "Usage: /admin drafts"},
+		{"drafts off whatsapp 49@s.whatsapp.net", "Replies to whatsapp:49@s.whatsapp.net are now sent directly."},
+	}
+	for _, tt := range tests {
+		if got := runAdmin(c, "telegram", "1", tt.args); !strings.Contains(got, tt.want) {
+			t.Errorf("/admin %s = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+	if len(fake.sent) != 1 || fake.sent[0] != "Your order has shipped!\nTracking: 123" {
+		t.Errorf("sent = %q, want the corrected text", fake.sent)
+	}
+	if on, ok := fake.modes["whatsapp:49@s.whatsapp.net"]; !ok || on {
+		t.Errorf("modes = %v", fake.modes)
+	}
+}
+
+type fakeGroups struct {
+	fakeChannels
+	groups map[string]channels.GroupRequest
+}
+
+func (f *fakeGroups) GroupRequests(ctx context.Context) ([]channels.GroupRequest, error) {
+	var out []channels.GroupRequest
+	for _, r := range f.groups {
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+func (f *fakeGroups) AcceptGroup(ctx context.Context, key string) (channels.GroupRequest, error) {
+	r, ok := f.groups[key]
+	if !ok {
+		return r, errors.New("no group " + key)
+	}
+	delete(f.groups, key)
+	return r, nil
+}
+
+func (f *fakeGroups) DeclineGroup(ctx context.Context, key string) (channels.GroupRequest, error) {
+	r, ok := f.groups[key]
+	if !ok {
+		return r, errors.New("no group " + key)
+	}
+	r.Status = channels.GroupDeclined
+	f.groups[key] = r
+	return r, nil
+}
+
+func TestChatCommandsGroups(t *testing.T) {
+	if got := runAdmin(NewChatCommands([]string{"cli:op"}, &fakeChannels{}, bus.NewMessageBus()), "cli", "op", "groups"); got != "Group approval is not available." {
+		t.Errorf("groups without support = %q", got)
+	}
+
+	fake := &fakeGroups{groups: map[string]channels.GroupRequest{
+		"whatsapp:club@g.us": {Channel: "whatsapp", ChatID: "club@g.us", Name: "Book club", By: "49@s.whatsapp.net", Status: channels.GroupPending},
+	}}
+	c := NewChatCommands([]string{"telegram:1"}, fake, bus.NewMessageBus())
+
+	tests := []struct {
+		args string
+		want string
+	}{
+		{"groups", `- whatsapp:club@g.us "Book club" by 49@s.whatsapp.net`},
+		{"decline whatsapp:club@g.us", "Declined whatsapp:club@g.us."},
+		{"groups", ", declined)"},
+		{"accept", "Usage: /admin accept <channel:chat_id>"},
+		{"accept whatsapp:club@g.us", "The bot now takes part in whatsapp:club@g.us."},
+		{"accept whatsapp:club@g.us", "Accept failed: no group whatsapp:club@g.us"},
+		{"groups", "No groups are waiting for approval."},
+	}
+	for _, tt := range tests {
+		if got := runAdmin(c, "telegram", "1", tt.args); !strings.Contains(got, tt.want) {
+			t.Errorf("/admin %s = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestChatCommandsOutbox(t *testing.T) {
+	queued := time.Date(2026, 3, 1, 9, 12, 0, 0, time.UTC)
+	fake := &struct {
+		fakeChannels
+		fakeOutbox
+	}{fakeOutbox: fakeOutbox{
+		"telegram": {{Key: "k1", ChatID: "42", Queued: queued, Attempts: 3, Collapsed: 2, LastError: "Forbidden"}},
+	}}
+	c := NewChatCommands([]string{"cli:op"}, fake, bus.NewMessageBus())
+
+	tests := []struct {
+		args string
+		want string
+	}{
+		{"outbox", "- telegram: 1 message(s), oldest queued 2026-03-01 09:12"},
+		{"outbox telegram", "- k1 to 42, queued 2026-03-01 09:12, 3 attempt(s), 2 duplicate(s) collapsed: Forbidden"},
+		{"outbox slack", "Nothing waiting for slack."},
+		{"outbox a b", "Usage: /admin outbox [channel]"},
+	}
+	for _, tt := range tests {
+		if got := runAdmin(c, "cli", "op", tt.args); !strings.Contains(got, tt.want) {
+			t.Errorf("/admin %s = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package admin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sipeed/picoclaw/pkg/events"
+)
+
+// Client calls the admin API of a running gateway, for CLI commands.
+type Client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+// NewClient returns a client for the admin server at baseURL, e.g.
+// "http://127.0.0.1:18791".
+func NewClient(baseURL, token string) *Client {
+	return &Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		token:   token,
+		http:    &http.Client{Timeout: 2 * time.Minute},
+	}
+}
+
+// Send sends one message through POST /send. A message queued for retry
+// is not an error; its SendResponse.Error says why the first attempt
+// failed.
+func (c *Client) Send(ctx context.Context, req SendRequest) (SendResponse, error) {
+	var resp SendResponse
+	err := c.do(ctx, http.MethodPost, "/send", req, &resp)
+	return resp, err
+}
+
+// Status returns the channel states and queue depths from GET /status.
+func (c *Client) Status(ctx context.Context) (Status, error) {
+	var st Status
+	err := c.do(ctx, http.MethodGet, "/status", nil, &st)
+	return st, err
+}
+
+// Events connects to the event stream and returns its events, optionally
+// only of the given types. The channel is closed when the stream ends or
+// ctx is cancelled.
+func (c *Client) Events(ctx context.Context, types ...string) (<-chan events.Event, error) {
+	u, err := url.Parse(c.baseURL + "/events")
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	default:
+		u.Scheme = "ws"
+	}
+	if len(types) > 0 {
+		u.RawQuery = url.Values{"types": {strings.Join(types, ",")}}.Encode()
+	}
+	header := http.Header{"Authorization": {"Bearer " + c.token}}
+	conn, resp, err := websocket.DefaultDialer.DialContext(ctx, u.String(), header)
+	if err != nil {
+		if resp != nil {
+			return nil, fmt.Errorf("event stream: %s", resp.Status)
+		}
+		return nil, fmt.Errorf("admin API unreachable, is the gateway running with admin enabled? %w", err)
+	}
+
+	ch := make(chan events.Event, 64)
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+	go func() {
+		defer close(ch)
+		defer conn.Close()
+		for {
+			var e events.Event
+			if err := conn.ReadJSON(&e); err != nil {
+				return
+			}
+			select {
+			case ch <- e:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// do sends body as JSON and decodes the JSON response into out. Responses
+// other than 2xx become errors carrying the server's message.
+func (c *Client) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("admin API unreachable, is the gateway running with admin enabled? %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error != "" {
+			return fmt.Errorf("%s", apiErr.Error)
+		}
+		return fmt.Errorf("admin API: %s", strings.TrimSpace(resp.Status+" "+string(data)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
@@ -0,0 +1,63 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package admin
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/contacts"
+)
+
+// ContactDirectory is the contact directory, as contacts.Directory
+// implements it.
+type ContactDirectory interface {
+	List(ctx context.Context) ([]contacts.Contact, error)
+	Resolve(ctx context.Context, query, channel string) ([]contacts.Contact, error)
+	Forget(ctx context.Context, channel, id string) error
+}
+
+// ContactsHandler serves the contact directory: GET /contacts lists every
+// contact, or with ?q= the ones a name resolves to (on ?channel= if given),
+// and DELETE /contacts/{channel}/{id} forgets one.
+func ContactsHandler(dir ContactDirectory) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			var list []contacts.Contact
+			var err error
+			if q := r.URL.Query().Get("q"); q != "" {
+				list, err = dir.Resolve(r.Context(), q, r.URL.Query().Get("channel"))
+			} else {
+				list, err = dir.List(r.Context())
+			}
+			if err != nil {
+				WriteJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+				return
+			}
+			if list == nil {
+				list = []contacts.Contact{}
+			}
+			WriteJSON(w, http.StatusOK, list)
+		case http.MethodDelete:
+			channel, id, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/contacts/"), "/")
+			if !ok || channel == "" || id == "" {
+				WriteJSON(w, http.StatusNotFound, map[string]string{"error": "use DELETE /contacts/{channel}/{id}"})
+				return
+			}
+			if err := dir.Forget(r.Context(), channel, id); err != nil {
+				WriteJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Header().Set("Allow", "GET, DELETE")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
@@ -0,0 +1,44 @@
+package admin
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/contacts"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+func TestContactsHandler(t *testing.T) {
+	dir := contacts.New(state.NewMemoryStore(), contacts.Policy{})
+	ctx := context.Background()
+	dir.Update(ctx, contacts.Contact{Channel: "telegram", ID: "7", Name: "Alice", ChatID: "7"})
+	dir.Update(ctx, contacts.Contact{Channel: "slack", ID: "U2", Name: "Bob"})
+	h := ContactsHandler(dir)
+
+	tests := []struct {
+		method string
+		path   string
+		code   int
+		body   string
+	}{
+		{http.MethodGet, "/contacts", http.StatusOK, `"name": "Bob"`},
+		{http.MethodGet, "/contacts?q=alice", http.StatusOK, `"chat_id": "7"`},
+		{http.MethodGet, "/contacts?q=alice&channel=slack", http.StatusOK, "[]"},
+		{http.MethodDelete, "/contacts/slack", http.StatusNotFound, "DELETE /contacts/{channel}/{id}"},
+		{http.MethodDelete, "/contacts/slack/U2", http.StatusNoContent, ""},
+		{http.MethodPost, "/contacts", http.StatusMethodNotAllowed, "method not allowed"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+		if rec.Code != tt.code || !strings.Contains(rec.Body.String(), tt.body) {
+			t.Errorf("%s %s = %d %s, want %d containing %q", tt.method, tt.path, rec.Code, rec.Body, tt.code, tt.body)
+		}
+	}
+	if _, ok, _ := dir.Get(ctx, "slack", "U2"); ok {
+		t.Error("DELETE did not forget the contact")
+	}
+}
@@ -0,0 +1,49 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package admin
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/channels"
+)
+
+// DeliveryLookup finds tracked messages. It is implemented by
+// channels.Manager.
+type DeliveryLookup interface {
+	Delivery(ctx context.Context, id string) (channels.Delivery, bool, error)
+}
+
+// DeliveriesHandler serves GET /deliveries/{id}, the delivery status of a
+// message sent through the broadcast API, so alerting systems can escalate
+// notifications that are not read in time.
+func DeliveriesHandler(lookup DeliveryLookup) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		id := strings.TrimPrefix(r.URL.Path, "/deliveries/")
+		if id == "" || strings.Contains(id, "/") {
+			WriteJSON(w, http.StatusNotFound, map[string]string{"error": "unknown delivery"})
+			return
+		}
+		d, ok, err := lookup.Delivery(r.Context(), id)
+		if err != nil {
+			WriteJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		if !ok {
+			WriteJSON(w, http.StatusNotFound, map[string]string{"error": "unknown delivery"})
+			return
+		}
+		WriteJSON(w, http.StatusOK, d)
+	})
+}
@@ -0,0 +1,48 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/channels"
+)
+
+type fakeDeliveries map[string]channels.Delivery
+
+func (f fakeDeliveries) Delivery(ctx context.Context, id string) (channels.Delivery, bool, error) {
+	if id == "broken" {
+		return channels.Delivery{}, false, errors.New("store unavailable")
+	}
+	d, ok := f[id]
+	return d, ok, nil
+}
+
+func TestDeliveriesHandler(t *testing.T) {
+	h := DeliveriesHandler(fakeDeliveries{
+		"abc": {ID: "abc", Channel: "whatsapp", ChatID: "1@s.whatsapp.net", Status: channels.DeliveryRead},
+	})
+
+	tests := []struct {
+		method string
+		path   string
+		code   int
+		body   string
+	}{
+		{http.MethodGet, "/deliveries/abc", http.StatusOK, `"status": "read"`},
+		{http.MethodGet, "/deliveries/nope", http.StatusNotFound, "unknown delivery"},
+		{http.MethodGet, "/deliveries/", http.StatusNotFound, "unknown delivery"},
+		{http.MethodGet, "/deliveries/broken", http.StatusInternalServerError, "store unavailable"},
+		{http.MethodPost, "/deliveries/abc", http.StatusMethodNotAllowed, "method not allowed"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+		if rec.Code != tt.code || !strings.Contains(rec.Body.String(), tt.body) {
+			t.Errorf("%s %s = %d %s, want %d containing %q", tt.method, tt.path, rec.Code, rec.Body, tt.code, tt.body)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package admin
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sipeed/picoclaw/pkg/events"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+const (
+	eventBuffer       = 256
+	eventWriteTimeout = 10 * time.Second
+	eventPingInterval = 30 * time.Second
+)
+
+var eventUpgrader = websocket.Upgrader{
+	// Every request already carries the admin token, which a foreign page
+	// cannot know, so cross-origin clients are allowed.
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// EventsHandler streams events from hub over a WebSocket, one JSON object
+// per text message. The optional "types" query parameter is a
+// comma-separated list of event types to receive, e.g. "types=error,security".
+// A client that reads too slowly misses events rather than slowing the
+// gateway down.
+func EventsHandler(hub *events.Hub) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var types map[string]bool
+		if q := r.URL.Query().Get("types"); q != "" {
+			types = make(map[string]bool)
+			for _, t := range strings.Split(q, ",") {
+				types[strings.TrimSpace(t)] = true
+			}
+		}
+
+		conn, err := eventUpgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return // Upgrade has already replied
+		}
+		defer conn.Close()
+
+		ch, cancel := hub.Subscribe(eventBuffer)
+		defer cancel()
+
+		logger.InfoCF("admin", "Event stream client connected", map[string]interface{}{"remote": r.RemoteAddr})
+		defer logger.InfoCF("admin", "Event stream client disconnected", map[string]interface{}{"remote": r.RemoteAddr})
+
+		// The client sends nothing but control frames; reading is what
+		// notices it going away.
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			for {
+				if _, _, err := conn.NextReader(); err != nil {
+					return
+				}
+			}
+		}()
+
+		ping := time.NewTicker(eventPingInterval)
+		defer ping.Stop()
+
+		for {
+			select {
+			case e, ok := <-ch:
+				if !ok {
+					return
+				}
+				if types != nil && !types[e.Type] {
+					continue
+				}
+				conn.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+				if err := conn.WriteJSON(e); err != nil {
+					return
+				}
+			case <-ping.C:
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(eventWriteTimeout)); err != nil {
+					return
+				}
+			case <-closed:
+				return
+			case <-r.Context().Done():
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,59 @@
+package admin
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sipeed/picoclaw/pkg/events"
+)
+
+func TestEventsHandler(t *testing.T) {
+	hub := events.NewHub()
+	s := NewServer(Config{Enabled: true, Token: "secret"})
+	s.Handle("/events", EventsHandler(hub))
+	srv := httptest.NewServer(s.requireToken(s.mux))
+	defer srv.Close()
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/events"
+	if _, resp, err := websocket.DefaultDialer.Dial(url, nil); err == nil || resp == nil || resp.StatusCode != 401 {
+		t.Fatalf("dial without token: err = %v, resp = %v; want 401", err, resp)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(url+"?token=secret&types=security", nil)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+
+	// The subscription starts once the handler runs; publish until it lands
+	deadline := time.Now().Add(2 * time.Second)
+	conn.SetReadDeadline(deadline)
+	received := make(chan events.Event, 1)
+	go func() {
+		var e events.Event
+		if err := conn.ReadJSON(&e); err == nil {
+			received <- e
+		}
+		close(received)
+	}()
+	for time.Now().Before(deadline) {
+		hub.Publish(events.Event{Type: events.TypeInbound, Content: "filtered out"})
+		hub.Publish(events.Event{Type: events.TypeSecurity, Message: "blocked"})
+		select {
+		case e, ok := <-received:
+			if !ok {
+				t.Fatal("stream closed without an event")
+			}
+			if e.Type != events.TypeSecurity || e.Message != "blocked" {
+				t.Errorf("event = %+v, want the security event", e)
+			}
+			return
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+	t.Fatal("no event received")
+}
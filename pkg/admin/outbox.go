@@ -0,0 +1,41 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package admin
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/sipeed/picoclaw/pkg/channels"
+)
+
+// OutboxReview lists the messages waiting to be sent or retried. It is
+// implemented by channels.Manager.
+type OutboxReview interface {
+	Pending(ctx context.Context) (map[string][]channels.PendingMessage, error)
+}
+
+// OutboxHandler serves GET /outbox, the messages waiting in each
+// channel's retry queue, oldest first. ?channel= limits it to one channel.
+func OutboxHandler(outbox OutboxReview) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		pending, err := outbox.Pending(r.Context())
+		if err != nil {
+			WriteJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		if name := r.URL.Query().Get("channel"); name != "" {
+			pending = map[string][]channels.PendingMessage{name: pending[name]}
+		}
+		WriteJSON(w, http.StatusOK, map[string]interface{}{"channels": pending})
+	})
+}
@@ -0,0 +1,60 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/channels"
+)
+
+type fakeOutbox map[string][]channels.PendingMessage
+
+func (f fakeOutbox) Pending(ctx context.Context) (map[string][]channels.PendingMessage, error) {
+	if f == nil {
+		return nil, errors.New("store unavailable")
+	}
+	return f, nil
+}
+
+func TestOutboxHandler(t *testing.T) {
+	h := OutboxHandler(fakeOutbox{
+		"telegram": {{Key: "1", ChatID: "42", Content: "disk full", Attempts: 3, Collapsed: 2}},
+		"slack":    {{Key: "2", ChatID: "C1", Held: true}},
+	})
+
+	tests := []struct {
+		path string
+		code int
+		want []string
+		not  string
+	}{
+		{"/outbox", http.StatusOK, []string{`"telegram"`, `"collapsed": 2`, `"held": true`}, ""},
+		{"/outbox?channel=telegram", http.StatusOK, []string{`"disk full"`}, `"slack"`},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		body := rec.Body.String()
+		if rec.Code != tt.code {
+			t.Errorf("GET %s = %d %s", tt.path, rec.Code, body)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(body, want) {
+				t.Errorf("GET %s = %s, want %s", tt.path, body, want)
+			}
+		}
+		if tt.not != "" && strings.Contains(body, tt.not) {
+			t.Errorf("GET %s = %s, should not list %s", tt.path, body, tt.not)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	OutboxHandler(fakeOutbox(nil)).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/outbox", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("GET /outbox with a broken store = %d", rec.Code)
+	}
+}
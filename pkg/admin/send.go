@@ -0,0 +1,89 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+// maxSendBody bounds a send request.
+const maxSendBody = 1 << 20
+
+// MessageSender delivers one message. It is implemented by
+// channels.Manager.
+type MessageSender interface {
+	Send(ctx context.Context, msg bus.OutboundMessage) (string, error)
+}
+
+// SendRequest is a message for POST /send. Message is Markdown, rendered
+// for the channel. On WhatsApp, ChatID may be a phone number. Priority
+// "low" lets the message wait for the chat's digest.
+type SendRequest struct {
+	Channel  string `json:"channel"`
+	ChatID   string `json:"chat_id"`
+	Message  string `json:"message"`
+	ThreadID string `json:"thread_id,omitempty"`
+	Priority string `json:"priority,omitempty"`
+}
+
+// SendResponse reports a send. ID is the delivery ID for GET
+// /deliveries/{id}. Error is set when the first attempt failed; the
+// message then stays in the outbox and is retried.
+type SendResponse struct {
+	ID    string `json:"id"`
+	Error string `json:"error,omitempty"`
+}
+
+// SendHandler serves POST /send, which sends one message to one chat, so
+// scripts and cron jobs can notify through the bot. It responds 200 once
+// the channel took the message, and 202 when it is queued for retry. A
+// W3C traceparent header puts the message in the caller's trace.
+func SendHandler(sender MessageSender) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req SendRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSendBody)).Decode(&req); err != nil {
+			WriteJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request: " + err.Error()})
+			return
+		}
+		if req.Channel == "" || req.ChatID == "" || strings.TrimSpace(req.Message) == "" {
+			WriteJSON(w, http.StatusBadRequest, map[string]string{"error": "channel, chat_id, and message are required"})
+			return
+		}
+		if req.Priority != "" && req.Priority != bus.PriorityLow {
+			WriteJSON(w, http.StatusBadRequest, map[string]string{"error": `priority must be "low" or empty`})
+			return
+		}
+
+		msg := bus.OutboundMessage{
+			Channel:  req.Channel,
+			ChatID:   req.ChatID,
+			Content:  req.Message,
+			ThreadID: req.ThreadID,
+			Priority: req.Priority,
+		}
+		msg.TraceID, msg.ParentID, _ = bus.ParseTraceparent(r.Header.Get("traceparent"))
+		id, err := sender.Send(r.Context(), msg)
+		switch {
+		case err == nil:
+			WriteJSON(w, http.StatusOK, SendResponse{ID: id})
+		case id == "":
+			WriteJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		default:
+			WriteJSON(w, http.StatusAccepted, SendResponse{ID: id, Error: err.Error()})
+		}
+	})
+}
@@ -0,0 +1,99 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+type fakeMessageSender struct {
+	sent []bus.OutboundMessage
+}
+
+func (f *fakeMessageSender) Send(ctx context.Context, msg bus.OutboundMessage) (string, error) {
+	switch msg.Channel {
+	case "irc":
+		return "", errors.New("channel irc not found")
+	case "slack":
+		return "d2", errors.New("rate limited")
+	}
+	f.sent = append(f.sent, msg)
+	return "d1", nil
+}
+
+func TestSendHandler(t *testing.T) {
+	sender := &fakeMessageSender{}
+	h := SendHandler(sender)
+
+	tests := []struct {
+		method string
+		body   string
+		code   int
+		want   string
+	}{
+		{http.MethodPost, `{"channel":"whatsapp","chat_id":"+4915112345678","message":"backup finished"}`, http.StatusOK, `"id": "d1"`},
+		{http.MethodPost, `{"channel":"slack","chat_id":"C1","message":"hi"}`, http.StatusAccepted, "rate limited"},
+		{http.MethodPost, `{"channel":"irc","chat_id":"#ops","message":"hi"}`, http.StatusBadRequest, "not found"},
+		{http.MethodPost, `{"channel":"whatsapp","chat_id":"1","message":"  "}`, http.StatusBadRequest, "required"},
+		{http.MethodPost, `{"channel":"whatsapp","chat_id":"1","message":"hi","priority":"urgent"}`, http.StatusBadRequest, "priority"},
+		{http.MethodPost, `not json`, http.StatusBadRequest, "invalid request"},
+		{http.MethodGet, ``, http.StatusMethodNotAllowed, "method not allowed"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(tt.method, "/send", strings.NewReader(tt.body)))
+		if rec.Code != tt.code || !strings.Contains(rec.Body.String(), tt.want) {
+			t.Errorf("%s %s = %d %s, want %d containing %q", tt.method, tt.body, rec.Code, rec.Body, tt.code, tt.want)
+		}
+	}
+	if len(sender.sent) != 1 || sender.sent[0].ChatID != "+4915112345678" || sender.sent[0].Content != "backup finished" {
+		t.Errorf("sent = %+v", sender.sent)
+	}
+}
+
+func TestSendHandlerPriority(t *testing.T) {
+	sender := &fakeMessageSender{}
+	body := `{"channel":"telegram","chat_id":"42","message":"disk 81% full","priority":"low"}`
+	SendHandler(sender).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/send", strings.NewReader(body)))
+	if len(sender.sent) != 1 || sender.sent[0].Priority != bus.PriorityLow {
+		t.Errorf("sent = %+v, want a low-priority message", sender.sent)
+	}
+}
+
+func TestSendHandlerTraceparent(t *testing.T) {
+	sender := &fakeMessageSender{}
+	req := httptest.NewRequest(http.MethodPost, "/send", strings.NewReader(`{"channel":"telegram","chat_id":"42","message":"deployed"}`))
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	SendHandler(sender).ServeHTTP(httptest.NewRecorder(), req)
+	if len(sender.sent) != 1 || sender.sent[0].TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || sender.sent[0].ParentID != "00f067aa0ba902b7" {
+		t.Errorf("sent = %+v, want the caller's trace", sender.sent)
+	}
+}
+
+func TestClientSend(t *testing.T) {
+	s := NewServer(Config{Enabled: true, Token: "secret"})
+	s.Handle("/send", SendHandler(&fakeMessageSender{}))
+	srv := httptest.NewServer(s.requireToken(s.mux))
+	defer srv.Close()
+	ctx := context.Background()
+
+	resp, err := NewClient(srv.URL+"/", "secret").Send(ctx, SendRequest{Channel: "whatsapp", ChatID: "1", Message: "hi"})
+	if err != nil || resp.ID != "d1" || resp.Error != "" {
+		t.Errorf("Send = %+v, %v", resp, err)
+	}
+	resp, err = NewClient(srv.URL, "secret").Send(ctx, SendRequest{Channel: "slack", ChatID: "C1", Message: "hi"})
+	if err != nil || resp.ID != "d2" || resp.Error != "rate limited" {
+		t.Errorf("queued Send = %+v, %v", resp, err)
+	}
+	if _, err := NewClient(srv.URL, "secret").Send(ctx, SendRequest{Channel: "irc", ChatID: "#ops", Message: "hi"}); err == nil || err.Error() != "channel irc not found" {
+		t.Errorf("failed Send error = %v", err)
+	}
+	if _, err := NewClient(srv.URL, "wrong").Send(ctx, SendRequest{Channel: "whatsapp", ChatID: "1", Message: "hi"}); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("unauthorized Send error = %v", err)
+	}
+}
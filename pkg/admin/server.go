@@ -0,0 +1,222 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+// Package admin provides the authenticated admin HTTP server used for
+// runtime diagnostics (pprof, goroutine dumps, memory stats) on headless
+// deployments.
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/crash"
+	"github.com/sipeed/picoclaw/pkg/events"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// Config holds the admin server settings.
+type Config struct {
+	Enabled bool
+	Host    string
+	Port    int
+	Token   string
+}
+
+// Server is the admin HTTP server. All endpoints require a bearer token.
+type Server struct {
+	config  Config
+	mux     *http.ServeMux
+	server  *http.Server
+	started time.Time
+	mu      sync.Mutex
+}
+
+// NewServer creates an admin server with the diagnostics endpoints registered.
+func NewServer(cfg Config) *Server {
+	s := &Server{
+		config: cfg,
+		mux:    http.NewServeMux(),
+	}
+	s.registerDiagnostics()
+	return s
+}
+
+// Handle registers an additional authenticated endpoint on the admin server.
+// It must be called before Start.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// HandleFunc registers an additional authenticated handler function.
+func (s *Server) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	s.mux.HandleFunc(pattern, handler)
+}
+
+// Addr returns the configured listen address.
+func (s *Server) Addr() string {
+	return net.JoinHostPort(s.config.Host, fmt.Sprintf("%d", s.config.Port))
+}
+
+// Start begins serving in the background. It is a no-op when disabled.
+func (s *Server) Start(ctx context.Context) error {
+	if !s.config.Enabled {
+		logger.InfoC("admin", "Admin server disabled")
+		return nil
+	}
+	if s.config.Token == "" {
+		return errors.New("admin server enabled but no token configured")
+	}
+
+	listener, err := net.Listen("tcp", s.Addr())
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.Addr(), err)
+	}
+
+	s.mu.Lock()
+	s.started = time.Now()
+	s.server = &http.Server{
+		Handler:           s.requireToken(s.mux),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	srv := s.server
+	s.mu.Unlock()
+
+	go func() {
+		if err := srv.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.ErrorCF("admin", "Admin server error", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}()
+
+	logger.InfoCF("admin", "Admin server started", map[string]interface{}{
+		"addr": s.Addr(),
+	})
+	return nil
+}
+
+// Stop shuts the server down, waiting for in-flight requests until ctx expires.
+func (s *Server) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	srv := s.server
+	s.server = nil
+	s.mu.Unlock()
+
+	if srv == nil {
+		return nil
+	}
+	return srv.Shutdown(ctx)
+}
+
+// requireToken rejects requests that do not carry the configured token,
+// either as "Authorization: Bearer <token>" or as the "token" query parameter
+// (the latter is convenient for `go tool pprof` URLs).
+func (s *Server) requireToken(next http.Handler) http.Handler {
+	expected := []byte(s.config.Token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		provided := r.URL.Query().Get("token")
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			provided = strings.TrimPrefix(auth, "Bearer ")
+		}
+
+		if len(expected) == 0 || subtle.ConstantTimeCompare([]byte(provided), expected) != 1 {
+			events.Security("admin", "Rejected unauthenticated admin request", map[string]interface{}{
+				"remote": r.RemoteAddr,
+				"path":   r.URL.Path,
+			})
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) registerDiagnostics() {
+	s.mux.HandleFunc("/debug/pprof/", pprof.Index)
+	s.mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	s.mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	s.mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	s.mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	s.mux.HandleFunc("/debug/goroutines", s.handleGoroutines)
+	s.mux.HandleFunc("/debug/runtime", s.handleRuntime)
+	s.mux.HandleFunc("/debug/crashes", s.handleCrashes)
+}
+
+// handleCrashes returns recent recovered panics reported by pkg/crash.
+func (s *Server) handleCrashes(w http.ResponseWriter, r *http.Request) {
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"total":   crash.Count(),
+		"reports": crash.Reports(),
+	})
+}
+
+// handleGoroutines writes a full stack dump of all goroutines as plain text.
+func (s *Server) handleGoroutines(w http.ResponseWriter, r *http.Request) {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		if len(buf) >= 64<<20 {
+			break
+		}
+		buf = make([]byte, len(buf)*2)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(buf)
+}
+
+// handleRuntime reports goroutine count and memory statistics as JSON.
+func (s *Server) handleRuntime(w http.ResponseWriter, r *http.Request) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	s.mu.Lock()
+	started := s.started
+	s.mu.Unlock()
+
+	WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"goroutines":     runtime.NumGoroutine(),
+		"num_cpu":        runtime.NumCPU(),
+		"go_version":     runtime.Version(),
+		"uptime_seconds": int64(time.Since(started).Seconds()),
+		"memory": map[string]interface{}{
+			"alloc_bytes":       mem.Alloc,
+			"total_alloc_bytes": mem.TotalAlloc,
+			"sys_bytes":         mem.Sys,
+			"heap_alloc_bytes":  mem.HeapAlloc,
+			"heap_inuse_bytes":  mem.HeapInuse,
+			"heap_objects":      mem.HeapObjects,
+			"num_gc":            mem.NumGC,
+			"pause_total_ns":    mem.PauseTotalNs,
+		},
+	})
+}
+
+// WriteJSON writes v as an indented JSON response with the given status.
+func WriteJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
@@ -0,0 +1,83 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireToken(t *testing.T) {
+	s := NewServer(Config{Enabled: true, Token: "secret"})
+	handler := s.requireToken(s.mux)
+
+	tests := []struct {
+		name       string
+		path       string
+		header     string
+		wantStatus int
+	}{
+		{
+			name:       "missing token",
+			path:       "/debug/runtime",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "wrong bearer token",
+			path:       "/debug/runtime",
+			header:     "Bearer nope",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "valid bearer token",
+			path:       "/debug/runtime",
+			header:     "Bearer secret",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "valid query token",
+			path:       "/debug/goroutines?token=secret",
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestHandleRuntime(t *testing.T) {
+	s := NewServer(Config{Token: "secret"})
+	rec := httptest.NewRecorder()
+	s.handleRuntime(rec, httptest.NewRequest(http.MethodGet, "/debug/runtime", nil))
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if _, ok := body["goroutines"]; !ok {
+		t.Error("expected goroutines field")
+	}
+	if _, ok := body["memory"].(map[string]interface{}); !ok {
+		t.Error("expected memory object")
+	}
+}
+
+func TestStartRequiresToken(t *testing.T) {
+	s := NewServer(Config{Enabled: true, Host: "127.0.0.1", Port: 0})
+	if err := s.Start(context.Background()); err == nil {
+		t.Fatal("expected error when token is empty")
+	}
+}
@@ -0,0 +1,63 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package admin
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/sipeed/picoclaw/pkg/channels"
+)
+
+// ChannelStatus reports the channels and their outbox. It is implemented
+// by channels.Manager.
+type ChannelStatus interface {
+	ChannelStates() map[string]string
+	ChannelStats() map[string]channels.Stats
+	OutboxLength(ctx context.Context) (int, error)
+}
+
+// QueueStatus reports the message bus queues. It is implemented by
+// bus.MessageBus.
+type QueueStatus interface {
+	QueueLengths() (inbound, outbound int)
+}
+
+// Status is the response of GET /status.
+type Status struct {
+	// Channels maps each channel to "connected", "reconnecting",
+	// "running", "degraded", "stopped", or "standby".
+	Channels map[string]string `json:"channels"`
+	// Stats counts each channel's traffic since the gateway started.
+	Stats map[string]channels.Stats `json:"stats,omitempty"`
+	// InboundQueue is messages waiting for the agent, OutboundQueue
+	// replies waiting for a channel, and Outbox messages waiting to be
+	// sent or retried.
+	InboundQueue  int `json:"inbound_queue"`
+	OutboundQueue int `json:"outbound_queue"`
+	Outbox        int `json:"outbox"`
+}
+
+// StatusHandler serves GET /status, the channel states and queue depths,
+// for monitors such as picoclaw top.
+func StatusHandler(channelStatus ChannelStatus, queues QueueStatus) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		outbox, err := channelStatus.OutboxLength(r.Context())
+		if err != nil {
+			WriteJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+			return
+		}
+		st := Status{Channels: channelStatus.ChannelStates(), Stats: channelStatus.ChannelStats(), Outbox: outbox}
+		st.InboundQueue, st.OutboundQueue = queues.QueueLengths()
+		WriteJSON(w, http.StatusOK, st)
+	})
+}
@@ -0,0 +1,88 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/events"
+)
+
+type fakeChannelStatus struct {
+	outboxErr error
+}
+
+func (f fakeChannelStatus) ChannelStates() map[string]string {
+	return map[string]string{"whatsapp": "reconnecting"}
+}
+
+func (f fakeChannelStatus) ChannelStats() map[string]channels.Stats {
+	return map[string]channels.Stats{"whatsapp": {Received: 5, Sent: 4, Dropped: 1}}
+}
+
+func (f fakeChannelStatus) OutboxLength(ctx context.Context) (int, error) {
+	return 3, f.outboxErr
+}
+
+type fakeQueues struct{}
+
+func (fakeQueues) QueueLengths() (int, int) { return 2, 1 }
+
+func TestStatusHandlerAndClient(t *testing.T) {
+	hub := events.NewHub()
+	s := NewServer(Config{Enabled: true, Token: "secret"})
+	s.Handle("/status", StatusHandler(fakeChannelStatus{}, fakeQueues{}))
+	s.Handle("/events", EventsHandler(hub))
+	srv := httptest.NewServer(s.requireToken(s.mux))
+	defer srv.Close()
+	client := NewClient(srv.URL, "secret")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	st, err := client.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if st.Channels["whatsapp"] != "reconnecting" || st.InboundQueue != 2 || st.OutboundQueue != 1 || st.Outbox != 3 ||
+		st.Stats["whatsapp"].Received != 5 {
+		t.Errorf("Status() = %+v", st)
+	}
+
+	rec := httptest.NewRecorder()
+	StatusHandler(fakeChannelStatus{outboxErr: errors.New("store down")}, fakeQueues{}).
+		ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status with a broken store = %d", rec.Code)
+	}
+
+	if _, err := NewClient(srv.URL, "wrong").Events(ctx); err == nil {
+		t.Error("Events() with a wrong token should fail")
+	}
+	ch, err := client.Events(ctx, events.TypeSecurity)
+	if err != nil {
+		t.Fatalf("Events() error = %v", err)
+	}
+	// The subscription starts once the handler runs; publish until it lands
+	deadline := time.After(2 * time.Second)
+	for {
+		hub.Publish(events.Event{Type: events.TypeInbound})
+		hub.Publish(events.Event{Type: events.TypeSecurity, Message: "blocked"})
+		select {
+		case e := <-ch:
+			if e.Type != events.TypeSecurity || e.Message != "blocked" {
+				t.Errorf("event = %+v", e)
+			}
+			cancel()
+			for range ch {
+			}
+			return
+		case <-deadline:
+			t.Fatal("no event received")
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+}
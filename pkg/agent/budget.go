@@ -0,0 +1,279 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package agent
+
+import (
+	"encoding/json"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+const (
+	// defaultContextWindow is assumed for models missing from
+	// modelContextWindows.
+	defaultContextWindow = 32768
+	// messageOverheadTokens covers role markers and separators per message.
+	messageOverheadTokens = 4
+	// imageTokens approximates one attached image after downscaling.
+	imageTokens = 1500
+	// minTruncatedTokens is the smallest size a message is cut down to.
+	minTruncatedTokens = 256
+)
+
+const truncatedNote = "\n[... truncated to fit the context window]"
+
+// modelContextWindows maps model name prefixes to context window sizes.
+// More specific prefixes come first.
+var modelContextWindows = []struct {
+	prefix string
+	tokens int
+}{
+	{"claude", 200000},
+	{"gpt-5", 400000},
+	{"gpt-4.1", 1000000},
+	{"gpt-4o", 128000},
+	{"gpt-4-turbo", 128000},
+	{"gpt-4", 8192},
+	{"gpt-3.5", 16385},
+	{"o1", 200000},
+	{"o3", 200000},
+	{"o4", 200000},
+	{"gemini", 1000000},
+	{"deepseek", 128000},
+	{"llama-3", 128000},
+	{"moonshot", 128000},
+	{"kimi", 128000},
+	{"glm", 128000},
+	{"qwen", 32768},
+	{"mistral", 32768},
+}
+
+// contextWindowFor returns the context window of model, ignoring any
+// "vendor/" routing prefix such as "anthropic/claude-sonnet-4".
+func contextWindowFor(model string) int {
+	name := strings.ToLower(model)
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	for _, m := range modelContextWindows {
+		if strings.HasPrefix(name, m.prefix) {
+			return m.tokens
+		}
+	}
+	return defaultContextWindow
+}
+
+// charsPerToken is the average number of ASCII characters per token for the
+// tokenizer family behind model.
+func charsPerToken(model string) float64 {
+	name := strings.ToLower(model)
+	switch {
+	case strings.Contains(name, "claude"):
+		return 3.5
+	case strings.Contains(name, "gpt"), strings.Contains(name, "gemini"),
+		strings.HasPrefix(name, "o1"), strings.HasPrefix(name, "o3"), strings.HasPrefix(name, "o4"):
+		return 4
+	default:
+		return 3.5
+	}
+}
+
+// countTextTokens estimates the tokens in s for model. Non-ASCII runes (CJK
+// in particular) are counted as a token each, which errs on the high side.
+func countTextTokens(model, s string) int {
+	ascii, other := 0, 0
+	for _, r := range s {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return int(float64(ascii)/charsPerToken(model)+0.5) + other
+}
+
+// countMessageTokens estimates the tokens one message occupies in a request.
+func countMessageTokens(model string, m providers.Message) int {
+	n := messageOverheadTokens + countTextTokens(model, m.Content)
+	for _, tc := range m.ToolCalls {
+		n += messageOverheadTokens + countTextTokens(model, tc.Name)
+		if tc.Function != nil {
+			n += countTextTokens(model, tc.Function.Name+tc.Function.Arguments)
+		}
+	}
+	n += len(m.Images) * imageTokens
+	return n
+}
+
+// countTokens estimates the tokens a message list occupies in a request.
+func countTokens(model string, messages []providers.Message) int {
+	total := 0
+	for _, m := range messages {
+		total += countMessageTokens(model, m)
+	}
+	return total
+}
+
+// countToolTokens estimates the tokens taken by tool definitions.
+func countToolTokens(model string, defs []providers.ToolDefinition) int {
+	if len(defs) == 0 {
+		return 0
+	}
+	data, _ := json.Marshal(defs)
+	return countTextTokens(model, string(data))
+}
+
+// inputBudget returns how many tokens of messages fit in a request that
+// offers toolDefs, after reserving room for the model's reply.
+func (al *AgentLoop) inputBudget(toolDefs []providers.ToolDefinition) int {
+	limit := al.contextWindow - al.maxTokens - countToolTokens(al.model, toolDefs)
+	if floor := al.contextWindow / 4; limit < floor {
+		limit = floor
+	}
+	return limit
+}
+
+// historyBudget is the input budget left for history once room for the
+// turn's tool output is set aside.
+func (al *AgentLoop) historyBudget(toolDefs []providers.ToolDefinition) int {
+	limit := al.inputBudget(toolDefs) - al.toolOutputReserve
+	if floor := al.inputBudget(toolDefs) / 2; limit < floor {
+		limit = floor
+	}
+	return limit
+}
+
+// fitMessages trims messages to at most limit tokens. The system prompt is
+// always kept. Whole turns of history are dropped oldest first; if that is
+// not enough, the largest tool results and finally the current user message
+// are truncated. It returns the fitted list and the number of history
+// messages dropped. The input slice is not modified.
+func fitMessages(model string, messages []providers.Message, limit int) ([]providers.Message, int) {
+	total := countTokens(model, messages)
+	if total <= limit || len(messages) < 2 {
+		return messages, 0
+	}
+
+	// The current turn starts at the last user message.
+	turn := len(messages) - 1
+	for turn > 1 && messages[turn].Role != "user" {
+		turn--
+	}
+
+	// Drop history oldest first, always up to the next user message so no
+	// tool result is left without its assistant tool call.
+	cut := 1
+	for cut < turn && total > limit {
+		total -= countMessageTokens(model, messages[cut])
+		cut++
+		for cut < turn && messages[cut].Role != "user" {
+			total -= countMessageTokens(model, messages[cut])
+			cut++
+		}
+	}
+	dropped := cut - 1
+
+	fitted := make([]providers.Message, 0, len(messages)-dropped)
+	fitted = append(fitted, messages[0])
+	fitted = append(fitted, messages[cut:]...)
+
+	// Halve the largest remaining tool result until the request fits.
+	for total > limit {
+		largest, size := -1, minTruncatedTokens
+		for i := 1; i < len(fitted); i++ {
+			if fitted[i].Role != "tool" {
+				continue
+			}
+			if n := countMessageTokens(model, fitted[i]); n > size {
+				largest, size = i, n
+			}
+		}
+		if largest < 0 {
+			break
+		}
+		target := size / 2
+		if over := total - limit; size-over > target {
+			target = size - over
+		}
+		fitted[largest].Content = truncateToTokens(model, fitted[largest].Content, target-messageOverheadTokens)
+		shrunk := countMessageTokens(model, fitted[largest])
+		if shrunk >= size {
+			break
+		}
+		total += shrunk - size
+	}
+
+	// Last resort: shorten an oversized user message such as a pasted file.
+	if total > limit {
+		user := len(fitted) - 1
+		for user > 0 && fitted[user].Role != "user" {
+			user--
+		}
+		if user > 0 {
+			size := countMessageTokens(model, fitted[user])
+			target := size - (total - limit)
+			if target < minTruncatedTokens {
+				target = minTruncatedTokens
+			}
+			if target < size {
+				fitted[user].Content = truncateToTokens(model, fitted[user].Content, target-messageOverheadTokens)
+			}
+		}
+	}
+
+	return fitted, dropped
+}
+
+// truncateToTokens shortens s to roughly maxTokens tokens, marking the cut.
+func truncateToTokens(model, s string, maxTokens int) string {
+	if countTextTokens(model, s) <= maxTokens {
+		return s
+	}
+	budget := maxTokens - countTextTokens(model, truncatedNote)
+	if budget < 0 {
+		budget = 0
+	}
+
+	perASCII := 1 / charsPerToken(model)
+	used := 0.0
+	for i, r := range s {
+		if r < utf8.RuneSelf {
+			used += perASCII
+		} else {
+			used++
+		}
+		if used > float64(budget) {
+			return s[:i] + truncatedNote
+		}
+	}
+	return s
+}
+
+// isContextOverflow reports whether err is a provider rejecting a request
+// for exceeding the model's context window.
+func isContextOverflow(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	for _, marker := range []string{
+		"context_length_exceeded",
+		"maximum context length",
+		"context window",
+		"prompt is too long",
+		"too many tokens",
+		"input is too long",
+		"request too large",
+	} {
+		if strings.Contains(msg, marker) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,224 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+func TestContextWindowFor(t *testing.T) {
+	tests := []struct {
+		model string
+		want  int
+	}{
+		{"claude-sonnet-4-5", 200000},
+		{"anthropic/claude-opus-4", 200000},
+		{"gpt-4o-mini", 128000},
+		{"gpt-4", 8192},
+		{"gpt-4.1-mini", 1000000},
+		{"openai/gpt-5.3", 400000},
+		{"llama-3.3-70b-versatile", 128000},
+		{"some-local-model", defaultContextWindow},
+	}
+
+	for _, tt := range tests {
+		if got := contextWindowFor(tt.model); got != tt.want {
+			t.Errorf("contextWindowFor(%q) = %d, want %d", tt.model, got, tt.want)
+		}
+	}
+}
+
+func TestCountTextTokens(t *testing.T) {
+	if got := countTextTokens("gpt-4o", strings.Repeat("a", 400)); got != 100 {
+		t.Errorf("ASCII tokens = %d, want 100", got)
+	}
+	if got := countTextTokens("gpt-4o", "你好世界"); got != 4 {
+		t.Errorf("CJK tokens = %d, want 4", got)
+	}
+	if claude, gpt := countTextTokens("claude-3", strings.Repeat("a", 700)), countTextTokens("gpt-4o", strings.Repeat("a", 700)); claude <= gpt {
+		t.Errorf("expected Claude estimate (%d) above GPT estimate (%d)", claude, gpt)
+	}
+}
+
+func TestFitMessages(t *testing.T) {
+	const model = "gpt-4o"
+	long := strings.Repeat("x", 4000) // ~1000 tokens
+
+	history := []providers.Message{
+		{Role: "system", Content: "system"},
+		{Role: "user", Content: long},
+		{Role: "assistant", ToolCalls: []providers.ToolCall{{ID: "1", Name: "read_file"}}},
+		{Role: "tool", Content: long, ToolCallID: "1"},
+		{Role: "assistant", Content: "done"},
+		{Role: "user", Content: "second"},
+		{Role: "assistant", Content: "answer"},
+		{Role: "user", Content: "current"},
+	}
+
+	t.Run("fits unchanged", func(t *testing.T) {
+		got, dropped := fitMessages(model, history, 100000)
+		if dropped != 0 || len(got) != len(history) {
+			t.Errorf("expected no trimming, dropped %d", dropped)
+		}
+	})
+
+	t.Run("drops whole oldest turn", func(t *testing.T) {
+		got, dropped := fitMessages(model, history, 500)
+		if dropped != 4 {
+			t.Fatalf("dropped = %d, want 4", dropped)
+		}
+		if got[0].Role != "system" || got[1].Role != "user" || got[1].Content != "second" {
+			t.Errorf("unexpected first messages: %+v", got[:2])
+		}
+		if got[len(got)-1].Content != "current" {
+			t.Errorf("current message lost")
+		}
+		if history[1].Content != long {
+			t.Errorf("input slice was modified")
+		}
+	})
+
+	t.Run("truncates tool results in the current turn", func(t *testing.T) {
+		turn := []providers.Message{
+			{Role: "system", Content: "system"},
+			{Role: "user", Content: "read it"},
+			{Role: "assistant", ToolCalls: []providers.ToolCall{{ID: "1", Name: "read_file"}}},
+			{Role: "tool", Content: long + long, ToolCallID: "1"},
+		}
+		got, dropped := fitMessages(model, turn, 800)
+		if dropped != 0 {
+			t.Errorf("dropped = %d, want 0", dropped)
+		}
+		if n := countTokens(model, got); n > 800 {
+			t.Errorf("fitted tokens = %d, want <= 800", n)
+		}
+		if !strings.HasSuffix(got[3].Content, truncatedNote) {
+			t.Errorf("tool result not marked as truncated")
+		}
+		if turn[3].Content != long+long {
+			t.Errorf("input slice was modified")
+		}
+	})
+}
+
+func TestIsContextOverflow(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{errors.New(`API error: {"error":{"code":"context_length_exceeded"}}`), true},
+		{errors.New("prompt is too long: 210000 tokens > 200000 maximum"), true},
+		{errors.New("rate limit exceeded"), false},
+	}
+	for _, tt := range tests {
+		if got := isContextOverflow(tt.err); got != tt.want {
+			t.Errorf("isContextOverflow(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+// overflowProvider rejects the first request as too long.
+type overflowProvider struct {
+	calls    int
+	messages [][]providers.Message
+}
+
+func (p *overflowProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	p.calls++
+	p.messages = append(p.messages, messages)
+	if p.calls == 1 {
+		return nil, errors.New("This model's maximum context length is 8192 tokens")
+	}
+	return &providers.LLMResponse{Content: "ok"}, nil
+}
+
+func (p *overflowProvider) GetDefaultModel() string {
+	return "mock-model"
+}
+
+func TestRunAgentLoop_RetriesOnContextOverflow(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         1024,
+				ContextWindow:     200000,
+				MaxToolIterations: 5,
+			},
+		},
+	}
+	provider := &overflowProvider{}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+
+	for i := 0; i < 30; i++ {
+		al.sessions.AddMessage("s1", "user", strings.Repeat("history ", 2000))
+		al.sessions.AddMessage("s1", "assistant", "ok")
+	}
+
+	// Keep background summarization out of the call count
+	al.summarizing.Store("s1", true)
+
+	resp, err := al.ProcessDirect(context.Background(), "hello", "s1")
+	if err != nil {
+		t.Fatalf("ProcessDirect failed: %v", err)
+	}
+	if resp != "ok" || provider.calls != 2 {
+		t.Fatalf("resp = %q after %d calls, want ok after 2", resp, provider.calls)
+	}
+	if len(provider.messages[1]) >= len(provider.messages[0]) {
+		t.Errorf("retry did not trim context: %d -> %d messages", len(provider.messages[0]), len(provider.messages[1]))
+	}
+}
+
+func TestRunAgentLoop_SummarizesAfterOverflowRetry(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         1024,
+				ContextWindow:     200000,
+				MaxToolIterations: 5,
+			},
+		},
+	}
+	provider := &overflowProvider{}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+
+	for i := 0; i < 30; i++ {
+		al.sessions.AddMessage("s1", "user", strings.Repeat("history ", 2000))
+		al.sessions.AddMessage("s1", "assistant", "ok")
+	}
+
+	if _, err := al.ProcessDirect(context.Background(), "hello", "s1"); err != nil {
+		t.Fatalf("ProcessDirect failed: %v", err)
+	}
+	// Summarization runs in the background once the reply is saved
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, busy := al.summarizing.Load("s1"); !busy {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("summarization did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if provider.calls <= 2 {
+		t.Errorf("provider called %d times, want the summarizer after the retry", provider.calls)
+	}
+	if al.sessions.GetSummary("s1") == "" {
+		t.Error("no summary after a turn over the history budget")
+	}
+	if history := al.sessions.GetHistory("s1"); len(history) >= 62 {
+		t.Errorf("history has %d messages, want the summarized part dropped", len(history))
+	}
+}
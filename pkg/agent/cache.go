@@ -0,0 +1,107 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package agent
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+)
+
+// responseCache remembers answers to repeated prompts for a limited time.
+// Entries are scoped to one chat and shared by its members. They are keyed by
+// a hash of the normalized prompt together with the model, persona, and the
+// shared system context, so the same question asked again in a group is
+// answered without another model call.
+type responseCache struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	entries    map[string]cacheEntry
+	now        func() time.Time
+}
+
+type cacheEntry struct {
+	response string
+	expires  time.Time
+}
+
+func newResponseCache(ttl time.Duration, maxEntries int) *responseCache {
+	if maxEntries <= 0 {
+		maxEntries = 500
+	}
+	return &responseCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]cacheEntry),
+		now:        time.Now,
+	}
+}
+
+// cacheKey hashes a prompt and its context. Prompts differing only in case,
+// spacing, or trailing punctuation share a key.
+func cacheKey(model, persona, chat, context, prompt string) string {
+	h := sha256.New()
+	for _, part := range []string{model, persona, chat, context, normalizePrompt(prompt)} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func normalizePrompt(prompt string) string {
+	p := strings.ToLower(strings.Join(strings.Fields(prompt), " "))
+	return strings.TrimRight(p, " ?!.")
+}
+
+func (c *responseCache) get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+	if c.now().After(e.expires) {
+		delete(c.entries, key)
+		return "", false
+	}
+	return e.response, true
+}
+
+func (c *responseCache) put(key, response string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if len(c.entries) >= c.maxEntries {
+		c.evict(now)
+	}
+	c.entries[key] = cacheEntry{response: response, expires: now.Add(c.ttl)}
+}
+
+// evict drops expired entries, then the ones closest to expiry until there
+// is room for one more.
+func (c *responseCache) evict(now time.Time) {
+	for key, e := range c.entries {
+		if now.After(e.expires) {
+			delete(c.entries, key)
+		}
+	}
+	for len(c.entries) >= c.maxEntries {
+		var oldest string
+		var oldestExpiry time.Time
+		for key, e := range c.entries {
+			if oldest == "" || e.expires.Before(oldestExpiry) {
+				oldest, oldestExpiry = key, e.expires
+			}
+		}
+		delete(c.entries, oldest)
+	}
+}
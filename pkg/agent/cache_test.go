@@ -0,0 +1,142 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+func TestCacheKey(t *testing.T) {
+	base := cacheKey("gpt-4o", "", "telegram:1", "", "What are the opening hours?")
+
+	tests := []struct {
+		name string
+		key  string
+		same bool
+	}{
+		{"normalized prompt", cacheKey("gpt-4o", "", "telegram:1", "", "  what are the OPENING hours "), true},
+		{"other chat", cacheKey("gpt-4o", "", "telegram:2", "", "What are the opening hours?"), false},
+		{"other persona", cacheKey("gpt-4o", "formal", "telegram:1", "", "What are the opening hours?"), false},
+		{"changed context", cacheKey("gpt-4o", "", "telegram:1", "Reply in German.", "What are the opening hours?"), false},
+		{"other model", cacheKey("claude-sonnet-4", "", "telegram:1", "", "What are the opening hours?"), false},
+	}
+	for _, tt := range tests {
+		if (tt.key == base) != tt.same {
+			t.Errorf("%s: same key = %v, want %v", tt.name, tt.key == base, tt.same)
+		}
+	}
+}
+
+func TestResponseCacheExpiryAndEviction(t *testing.T) {
+	now := time.Now()
+	c := newResponseCache(time.Minute, 2)
+	c.now = func() time.Time { return now }
+
+	c.put("a", "A")
+	now = now.Add(time.Second)
+	c.put("b", "B")
+	now = now.Add(time.Second)
+	c.put("c", "C") // evicts "a", the entry closest to expiry
+
+	if _, ok := c.get("a"); ok {
+		t.Errorf("oldest entry should have been evicted")
+	}
+	if got, ok := c.get("c"); !ok || got != "C" {
+		t.Errorf("get(c) = %q, %v", got, ok)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, ok := c.get("b"); ok {
+		t.Errorf("expired entry returned")
+	}
+}
+
+// countingProvider counts calls and optionally requests one tool call.
+type countingProvider struct {
+	calls    int
+	useTools bool
+}
+
+func (p *countingProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	p.calls++
+	if p.useTools && messages[len(messages)-1].Role == "user" {
+		return &providers.LLMResponse{ToolCalls: []providers.ToolCall{{ID: "t1", Name: "list_dir", Arguments: map[string]interface{}{"path": "."}}}}, nil
+	}
+	return &providers.LLMResponse{Content: "We open at 9."}, nil
+}
+
+func (p *countingProvider) GetDefaultModel() string {
+	return "mock-model"
+}
+
+func TestResponseCache_AgentLoop(t *testing.T) {
+	tests := []struct {
+		name        string
+		useTools    bool
+		reset       bool   // start the session over before asking again
+		otherSender string // ask again as someone else
+		preferences bool   // the second sender has saved preferences
+		wantCalls   int
+	}{
+		{"plain answer is reused", false, true, "", false, 1},
+		{"tool turns are not cached", true, true, "", false, 4},
+		{"later in the conversation", false, false, "", false, 1},
+		{"other sender in the chat", false, false, "u2", false, 1},
+		{"sender with preferences", false, false, "u2", true, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				Agents: config.AgentsConfig{
+					Defaults: config.AgentDefaults{
+						Workspace:         t.TempDir(),
+						Model:             "test-model",
+						MaxTokens:         1024,
+						MaxToolIterations: 5,
+						ResponseCacheTTL:  60,
+					},
+				},
+				Preferences: config.PreferencesConfig{Enabled: true},
+			}
+			provider := &countingProvider{useTools: tt.useTools}
+			al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+			if tt.preferences {
+				if err := al.preferences.Set("telegram:"+tt.otherSender, "tone", "casual"); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			msg := bus.InboundMessage{Channel: "telegram", ChatID: "g1", SenderID: "u1", SessionKey: "telegram:g1", Content: "When do you open?"}
+			for i := 0; i < 2; i++ {
+				if i > 0 && tt.reset {
+					al.sessions.Reset(msg.SessionKey)
+				}
+				if i > 0 && tt.otherSender != "" {
+					msg.SenderID = tt.otherSender
+				}
+				resp, err := al.processMessage(context.Background(), msg)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if resp != "We open at 9." {
+					t.Fatalf("resp = %q", resp)
+				}
+			}
+			if provider.calls != tt.wantCalls {
+				t.Errorf("provider calls = %d, want %d", provider.calls, tt.wantCalls)
+			}
+			want := 4
+			if tt.reset {
+				want = 2
+			}
+			if n := len(al.sessions.GetHistory(msg.SessionKey)); n < want {
+				t.Errorf("history has %d messages, want at least %d", n, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package agent
+
+import (
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+const (
+	// maxRecentMessages is how many of a session's latest user messages
+	// can still be edited or deleted in it.
+	maxRecentMessages = 50
+	// deletedMessage stands in the session for a message its sender
+	// deleted.
+	deletedMessage = "[message deleted by the user]"
+)
+
+// recentMessages remembers what the latest user messages of each session
+// were saved as, by platform message ID, so an edit or deletion can find
+// them again.
+type recentMessages struct {
+	mu       sync.Mutex
+	sessions map[string][]recentMessage
+}
+
+type recentMessage struct {
+	id      string
+	content string
+}
+
+func newRecentMessages() *recentMessages {
+	return &recentMessages{sessions: make(map[string][]recentMessage)}
+}
+
+// remember records that the message with platform ID id was saved to the
+// session as content.
+func (r *recentMessages) remember(sessionKey, id, content string) {
+	if id == "" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	msgs := append(r.sessions[sessionKey], recentMessage{id, content})
+	if len(msgs) > maxRecentMessages {
+		msgs = msgs[len(msgs)-maxRecentMessages:]
+	}
+	r.sessions[sessionKey] = msgs
+}
+
+// find returns what the message with platform ID id was saved as.
+func (r *recentMessages) find(sessionKey, id string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	msgs := r.sessions[sessionKey]
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i].id == id {
+			return msgs[i].content, true
+		}
+	}
+	return "", false
+}
+
+// replace returns what the message with platform ID id was saved as, and
+// remembers replacement in its place.
+func (r *recentMessages) replace(sessionKey, id, replacement string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	msgs := r.sessions[sessionKey]
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i].id == id {
+			content := msgs[i].content
+			msgs[i].content = replacement
+			return content, true
+		}
+	}
+	return "", false
+}
+
+// applyChange brings the session in line with a user's edit or deletion
+// of one of their messages: the message is replaced by its new text, or
+// by a note that it was deleted, so later turns no longer act on what the
+// user took back. The change gets no reply of its own.
+func (al *AgentLoop) applyChange(msg bus.InboundMessage) {
+	replacement := msg.Content
+	if msg.Change.Deleted {
+		replacement = deletedMessage
+	}
+	fields := map[string]interface{}{
+		"channel":    msg.Channel,
+		"chat_id":    msg.ChatID,
+		"message_id": msg.Change.MessageID,
+		"deleted":    msg.Change.Deleted,
+	}
+
+	content, ok := al.recent.replace(msg.SessionKey, msg.Change.MessageID, replacement)
+	if !ok || !al.sessions.ReplaceMessage(msg.SessionKey, "user", content, replacement) {
+		// Commands, and messages long gone from the session
+		logger.DebugCF("agent", "Changed message not in session", fields)
+		return
+	}
+	al.sessions.Save(msg.SessionKey)
+	logger.InfoCF("agent", "Applied message change to session", fields)
+}
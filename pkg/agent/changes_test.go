@@ -0,0 +1,67 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestMessageChanges(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         1024,
+				MaxToolIterations: 5,
+			},
+		},
+	}
+	provider := &captureProvider{}
+	msgBus := bus.NewMessageBus()
+	al := NewAgentLoop(cfg, msgBus, provider)
+
+	inbound := func(id, content string, change *bus.Change) bus.InboundMessage {
+		return bus.InboundMessage{
+			Channel: "whatsapp", ChatID: "42", SenderID: "alice", SessionKey: "whatsapp:42",
+			Content: content, Metadata: map[string]string{"message_id": id}, Change: change,
+		}
+	}
+	ask := func(content string) string {
+		t.Helper()
+		if _, err := al.processMessage(t.Context(), inbound("", content, nil)); err != nil {
+			t.Fatal(err)
+		}
+		var turns []string
+		for _, m := range provider.messages[1:] {
+			turns = append(turns, m.Content)
+		}
+		return strings.Join(turns, " | ")
+	}
+
+	al.processMessage(t.Context(), inbound("m1", "book the table for 5", nil))
+	al.processMessage(t.Context(), inbound("m2", "my card is 4111", nil))
+
+	al.handleInbound(t.Context(), inbound("m1", "book the table for 6", &bus.Change{MessageID: "m1"}))
+	al.handleInbound(t.Context(), inbound("m2", "", &bus.Change{MessageID: "m2", Deleted: true}))
+	al.handleInbound(t.Context(), inbound("m9", "unknown", &bus.Change{MessageID: "m9"}))
+
+	got := ask("anything else?")
+	want := "book the table for 6 | ok | " + deletedMessage + " | ok | anything else?"
+	if got != want {
+		t.Errorf("model saw %q, want %q", got, want)
+	}
+
+	// A second edit of the same message applies too
+	al.handleInbound(t.Context(), inbound("m1", "book the table for 7", &bus.Change{MessageID: "m1"}))
+	if got := ask("thanks"); !strings.HasPrefix(got, "book the table for 7 | ") {
+		t.Errorf("after a second edit the model saw %q", got)
+	}
+
+	// Changes get no reply
+	if _, out := msgBus.QueueLengths(); out != 0 {
+		t.Errorf("changes were answered: %d outbound messages", out)
+	}
+}
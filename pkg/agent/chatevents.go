@@ -0,0 +1,85 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package agent
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/crash"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// welcomeTemplate is the message template greeting members who join a
+// group, when it is defined.
+const welcomeTemplate = "welcome"
+
+// handleChatEvent greets new members with the welcome template and closes
+// the conversation of a chat the bot can no longer take part in. It runs
+// in the background so channels are not held up.
+func (al *AgentLoop) handleChatEvent(e bus.ChatEvent) {
+	go func() {
+		defer crash.Recover("agent", nil)
+		switch e.Type {
+		case bus.ChatMemberJoined:
+			al.welcome(e)
+		case bus.ChatBotRemoved, bus.ChatArchived:
+			al.closeChat(e)
+		}
+	}()
+}
+
+// welcome sends the welcome template to a chat members joined. It gets
+// .channel, .chat_id, .members (names, or IDs when the platform gave no
+// name), and .member_ids.
+func (al *AgentLoop) welcome(e bus.ChatEvent) {
+	if al.templates == nil || !al.templates.Has(welcomeTemplate) || len(e.Members) == 0 {
+		return
+	}
+	names := make([]string, len(e.Members))
+	ids := make([]string, len(e.Members))
+	for i, m := range e.Members {
+		ids[i] = m.ID
+		names[i] = m.Name
+		if names[i] == "" {
+			names[i] = m.ID
+		}
+	}
+	content, err := al.templates.Render(welcomeTemplate, map[string]interface{}{
+		"channel":    e.Channel,
+		"chat_id":    e.ChatID,
+		"members":    names,
+		"member_ids": ids,
+	})
+	if err != nil {
+		logger.WarnCF("agent", "Failed to render welcome message",
+			map[string]interface{}{"channel": e.Channel, "chat_id": e.ChatID, "error": err.Error()})
+		return
+	}
+	al.bus.PublishOutbound(bus.OutboundMessage{Channel: e.Channel, ChatID: e.ChatID, Content: content})
+}
+
+// closeChat archives and clears the conversation of a chat that is gone,
+// as "/new" would, so it is not kept in memory and on disk as live.
+func (al *AgentLoop) closeChat(e bus.ChatEvent) {
+	sessionKey := fmt.Sprintf("%s:%s", e.Channel, strings.ReplaceAll(e.ChatID, "/", "#"))
+	al.awaitSummary(sessionKey)
+	archived, err := al.archiveConversation(sessionKey)
+	if err != nil {
+		logger.WarnCF("agent", "Failed to archive conversation of closed chat",
+			map[string]interface{}{"session_key": sessionKey, "error": err.Error()})
+		return
+	}
+	if !archived {
+		return
+	}
+	al.sessions.Reset(sessionKey)
+	al.sessions.Save(sessionKey)
+	logger.InfoCF("agent", "Archived conversation of closed chat",
+		map[string]interface{}{"session_key": sessionKey, "event": e.Type})
+}
@@ -0,0 +1,45 @@
+package agent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestChatEvents(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         1024,
+				MaxToolIterations: 5,
+			},
+		},
+		Templates: map[string]string{"welcome": `Welcome, {{join ", " .members}}!`},
+	}
+	msgBus := bus.NewMessageBus()
+	al := NewAgentLoop(cfg, msgBus, &simpleMockProvider{response: "ok"})
+
+	msgBus.PublishChatEvent(bus.ChatEvent{Channel: "telegram", ChatID: "-100", Type: bus.ChatMemberJoined,
+		Members: []bus.ChatMember{{ID: "1|ann", Name: "Ann"}, {ID: "2"}}})
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	out, ok := msgBus.SubscribeOutbound(ctx)
+	if !ok || out.ChatID != "-100" || out.Content != "Welcome, Ann, 2!" {
+		t.Errorf("welcome = %+v, %v", out, ok)
+	}
+
+	al.sessions.AddMessage("slack:C1#1700.1", "user", "hello")
+	msgBus.PublishChatEvent(bus.ChatEvent{Channel: "slack", ChatID: "C1/1700.1", Type: bus.ChatArchived})
+	deadline := time.Now().Add(2 * time.Second)
+	for len(al.sessions.GetHistory("slack:C1#1700.1")) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("conversation of the archived chat was not cleared")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
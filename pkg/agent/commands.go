@@ -0,0 +1,252 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/commands"
+	"github.com/sipeed/picoclaw/pkg/i18n"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// RegisterCommand adds a slash command that is answered without the agent.
+func (al *AgentLoop) RegisterCommand(cmd commands.Command) error {
+	return al.commands.Register(cmd)
+}
+
+// Options of the commands sharing a handler.
+var (
+	feedbackOptions = []commands.Option{{Name: "comment", Description: "What about the reply"}}
+	approvalOptions = []commands.Option{{Name: "id", Description: "ID from the approval request", Required: true}}
+)
+
+// Commands returns the visible slash commands, for channels that offer
+// them in a native menu.
+func (al *AgentLoop) Commands() []commands.Command {
+	return al.commands.List()
+}
+
+// registerCommands installs the built-in commands and those contributed by
+// tools implementing commands.Provider.
+func (al *AgentLoop) registerCommands() {
+	builtin := []commands.Command{
+		{Name: "help", Aliases: []string{"start"}, Description: "List commands", Handler: al.helpCommand},
+		{Name: "status", Description: "Show model, uptime, and this chat's settings", Handler: al.statusCommand},
+		{Name: "new", Description: "Archive this conversation and start a new one", Handler: al.threadCommand},
+		{Name: "reset", Description: "Forget this conversation", Handler: al.threadCommand},
+		{Name: "mute", Usage: "<duration>|off", Description: "Stop replying in this chat for a while, e.g. /mute 1h", Handler: al.muteCommand,
+			Options: []commands.Option{{Name: "duration", Description: "How long, e.g. 1h, or off", Required: true}}},
+		{Name: "lang", Usage: "<language>|off", Description: "Always reply in a language, e.g. /lang de", Handler: al.langCommand,
+			Options: []commands.Option{{Name: "language", Description: "Language, e.g. de, or off", Required: true}}},
+		{Name: "translate", Usage: "on|off|default", Description: "Translate messages in other languages for this chat", Handler: al.translateCommand,
+			Options: []commands.Option{{Name: "mode", Description: "Translate or not", Required: true, Choices: []string{"on", "off", "default"}}}},
+		{Name: "persona", Usage: "[name|default]", Description: "Show or switch the persona", Handler: al.personaCommand,
+			Options: []commands.Option{{Name: "name", Description: "Persona to switch to, or default"}}},
+		{Name: "usage", Description: "Show this month's usage and cost", Handler: al.usageCommand},
+		{Name: "good", Usage: "[comment]", Description: "Rate the last reply as good", Handler: al.feedbackCommand, Options: feedbackOptions},
+		{Name: "bad", Usage: "[comment]", Description: "Rate the last reply as bad", Handler: al.feedbackCommand, Options: feedbackOptions},
+	}
+	if al.approvals != nil {
+		builtin = append(builtin,
+			commands.Command{Name: "approve", Usage: "<id>", Description: "Run a command waiting for approval", Handler: al.approvalCommand, Options: approvalOptions},
+			commands.Command{Name: "deny", Usage: "<id>", Description: "Cancel a command waiting for approval", Handler: al.approvalCommand, Options: approvalOptions},
+		)
+	}
+	for _, cmd := range builtin {
+		al.commands.Register(cmd)
+	}
+
+	names := al.tools.List()
+	sort.Strings(names)
+	for _, name := range names {
+		tool, _ := al.tools.Get(name)
+		provider, ok := tool.(commands.Provider)
+		if !ok {
+			continue
+		}
+		for _, cmd := range provider.Commands() {
+			if err := al.commands.Register(cmd); err != nil {
+				logger.WarnCF("agent", "Skipping tool command",
+					map[string]interface{}{"tool": name, "error": err.Error()})
+			}
+		}
+	}
+}
+
+// helpCommand implements "/help", listing commands and workflows in the
+// chat's language. Commands without a translation keep their description.
+func (al *AgentLoop) helpCommand(ctx context.Context, req commands.Request) string {
+	msg := req.Msg
+	catalog := i18n.Default.Catalog()
+	locale := i18n.Default.Locale(msg.Channel, msg.ChatID)
+
+	var sb strings.Builder
+	sb.WriteString(catalog.T(locale, "help.commands"))
+	for _, c := range al.commands.List() {
+		sb.WriteString("\n/" + c.Name)
+		if c.Usage != "" {
+			sb.WriteString(" " + c.Usage)
+		}
+		desc := c.Description
+		if tr, ok := catalog.Lookup(locale, "cmd."+c.Name); ok {
+			desc = tr
+		}
+		if desc != "" {
+			sb.WriteString(" - " + desc)
+		}
+	}
+	help := sb.String()
+
+	sb.Reset()
+	for _, wf := range al.workflows {
+		if wf.command == "" {
+			continue
+		}
+		sb.WriteString("\n" + wf.command)
+		if wf.description != "" {
+			sb.WriteString(" - " + wf.description)
+		}
+	}
+	if sb.Len() > 0 {
+		help += "\n\n" + catalog.T(locale, "help.workflows") + sb.String()
+	}
+	return help
+}
+
+// statusCommand implements "/status".
+func (al *AgentLoop) statusCommand(ctx context.Context, req commands.Request) string {
+	msg := req.Msg
+
+	persona := t(msg, "status.default")
+	p := al.resolvePersona(msg.SessionKey, msg.Channel, msg.ChatID, "")
+	if p != nil {
+		persona = p.name
+	}
+	language := al.sessions.GetLanguage(msg.SessionKey)
+	if language == "" {
+		language = t(msg, "status.auto")
+	}
+	muted := t(msg, "status.no")
+	if until := al.sessions.MutedUntil(msg.SessionKey); time.Now().Before(until) {
+		muted = t(msg, "status.until", until.Format("2006-01-02 15:04"))
+	}
+
+	lines := []string{
+		t(msg, "status.model", al.modelFor(p), al.contextWindow),
+		t(msg, "status.uptime", time.Since(al.started).Round(time.Second)),
+		t(msg, "status.tools", al.tools.Count()),
+		t(msg, "status.chat", len(al.sessions.GetHistory(msg.SessionKey)), persona, language, muted),
+	}
+	return strings.Join(lines, "\n")
+}
+
+// muteCommand implements "/mute <duration>|off". While muted the agent
+// ignores the chat; commands still work.
+func (al *AgentLoop) muteCommand(ctx context.Context, req commands.Request) string {
+	msg := req.Msg
+	if len(req.Args) != 1 {
+		if until := al.sessions.MutedUntil(msg.SessionKey); time.Now().Before(until) {
+			return t(msg, "mute.until", until.Format("2006-01-02 15:04"))
+		}
+		return t(msg, "mute.usage")
+	}
+
+	if arg := strings.ToLower(req.Args[0]); arg == "off" {
+		al.sessions.SetMutedUntil(msg.SessionKey, time.Time{})
+		al.sessions.Save(msg.SessionKey)
+		return t(msg, "mute.off")
+	}
+
+	d, err := parseMuteDuration(req.Args[0])
+	if err != nil {
+		return t(msg, "mute.invalid", req.Args[0])
+	}
+	until := time.Now().Add(d)
+	al.sessions.SetMutedUntil(msg.SessionKey, until)
+	al.sessions.Save(msg.SessionKey)
+	return t(msg, "mute.until", until.Format("2006-01-02 15:04"))
+}
+
+// parseMuteDuration accepts Go durations plus whole days ("1d").
+func parseMuteDuration(s string) (time.Duration, error) {
+	s = strings.ToLower(s)
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid days %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	return d, nil
+}
+
+func (al *AgentLoop) isMuted(sessionKey string) bool {
+	return time.Now().Before(al.sessions.MutedUntil(sessionKey))
+}
+
+// t formats a built-in reply in the chat's language.
+func t(msg bus.InboundMessage, key string, args ...interface{}) string {
+	return i18n.T(msg.Channel, msg.ChatID, key, args...)
+}
+
+// langCommand implements "/lang <language>|off".
+func (al *AgentLoop) langCommand(ctx context.Context, req commands.Request) string {
+	msg := req.Msg
+	if req.Raw == "" {
+		if lang := al.sessions.GetLanguage(msg.SessionKey); lang != "" {
+			return t(msg, "lang.current", lang)
+		}
+		return t(msg, "lang.auto_hint")
+	}
+
+	lang := req.Raw
+	switch strings.ToLower(lang) {
+	case "off", "auto", "default":
+		lang = ""
+	}
+	if len(lang) > 40 {
+		return t(msg, "lang.too_long")
+	}
+	al.sessions.SetLanguage(msg.SessionKey, lang)
+	al.sessions.Save(msg.SessionKey)
+
+	// Built-in replies follow the language too when the catalog has it;
+	// otherwise they fall back to the default locale.
+	locale := i18n.Default.Catalog().Match(lang)
+	if err := i18n.Default.SetLocale(msg.Channel, msg.ChatID, locale); err != nil {
+		logger.WarnCF("agent", "Failed to save chat locale",
+			map[string]interface{}{"session_key": msg.SessionKey, "error": err.Error()})
+	}
+	if lang == "" {
+		return t(msg, "lang.auto")
+	}
+	return t(msg, "lang.set", lang)
+}
+
+// languageSection renders the chat's /lang setting for the system prompt,
+// or else the language the user writes in.
+func (al *AgentLoop) languageSection(opts processOptions) string {
+	if lang := al.sessions.GetLanguage(opts.SessionKey); lang != "" {
+		return fmt.Sprintf("\n\n---\n\n# Reply Language\n\nAlways reply in %s (as set by the user with /lang), even if the user writes in another language.", lang)
+	}
+	if opts.ReplyLanguage == "" {
+		return ""
+	}
+	name := i18n.LanguageName(opts.ReplyLanguage)
+	return fmt.Sprintf("\n\n---\n\n# Reply Language\n\nThe user writes in %s. Reply in %s unless they ask for another language.", name, name)
+}
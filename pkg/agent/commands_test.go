@@ -0,0 +1,172 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/commands"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// pingTool contributes a /ping command.
+type pingTool struct {
+	*tools.FuncTool
+}
+
+func (pingTool) Commands() []commands.Command {
+	return []commands.Command{{
+		Name:        "ping",
+		Description: "Check the bot is alive",
+		Handler:     func(ctx context.Context, req commands.Request) string { return "pong " + req.Raw },
+	}}
+}
+
+func TestBuiltinCommands(t *testing.T) {
+	provider := &captureProvider{}
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         1024,
+				MaxToolIterations: 5,
+			},
+		},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+
+	send := func(content string) string {
+		t.Helper()
+		resp, err := al.processMessage(t.Context(), bus.InboundMessage{
+			Channel: "telegram", ChatID: "c1", SenderID: "u1", SessionKey: "telegram:c1", Content: content,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	if help := send("/help@picoclaw_bot"); !strings.Contains(help, "/mute <duration>|off") {
+		t.Errorf("help missing /mute:\n%s", help)
+	}
+	if status := send("/status"); !strings.Contains(status, "Model: test-model") {
+		t.Errorf("status = %q", status)
+	}
+
+	// Muted chats get no reply and the model is not called
+	if resp := send("/mute 1h"); !strings.Contains(resp, "Muted until") {
+		t.Errorf("mute = %q", resp)
+	}
+	provider.messages = nil
+	if resp := send("hello"); resp != "" || provider.messages != nil {
+		t.Errorf("muted chat answered %q", resp)
+	}
+	if resp := send("/mute soon"); !strings.Contains(resp, "Invalid duration") {
+		t.Errorf("bad duration = %q", resp)
+	}
+	send("/mute off")
+	if resp := send("hello"); resp != "ok" {
+		t.Errorf("unmuted chat answered %q", resp)
+	}
+
+	send("/lang German")
+	send("hello")
+	if !strings.Contains(provider.messages[0].Content, "Always reply in German") {
+		t.Error("language missing from system prompt")
+	}
+	send("/lang off")
+	send("hello")
+	if strings.Contains(provider.messages[0].Content, "Reply Language") {
+		t.Error("language should be cleared")
+	}
+
+	// Unknown commands reach the agent
+	if resp := send("/shrug"); resp != "ok" {
+		t.Errorf("unknown command answered %q", resp)
+	}
+}
+
+func TestLocalizedCommands(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         1024,
+				MaxToolIterations: 5,
+			},
+		},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &captureProvider{})
+	al.tools.Register(pingTool{tools.NewFuncTool("ping", "Ping", nil, nil)})
+	al.commands = commands.NewRouter()
+	al.registerCommands()
+
+	send := func(content string) string {
+		t.Helper()
+		resp, err := al.processMessage(t.Context(), bus.InboundMessage{
+			Channel: "telegram", ChatID: "i18n", SenderID: "u1", SessionKey: "telegram:i18n", Content: content,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	if resp := send("/lang Deutsch"); resp != "Ich antworte ab jetzt auf Deutsch." {
+		t.Errorf("lang = %q", resp)
+	}
+	help := send("/help")
+	if !strings.HasPrefix(help, "Befehle:") || !strings.Contains(help, "/mute <duration>|off - In diesem Chat") {
+		t.Errorf("help not translated:\n%s", help)
+	}
+	// Tool commands without a translation keep their description
+	if !strings.Contains(help, "/ping - Check the bot is alive") {
+		t.Errorf("help missing /ping:\n%s", help)
+	}
+
+	// A language the catalog lacks leaves replies in the default locale
+	if resp := send("/lang Klingon"); resp != "Replying in Klingon from now on." {
+		t.Errorf("lang = %q", resp)
+	}
+	send("/lang off")
+	if help := send("/help"); !strings.HasPrefix(help, "Commands:") {
+		t.Errorf("help after /lang off:\n%s", help)
+	}
+}
+
+func TestToolCommands(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         1024,
+				MaxToolIterations: 5,
+			},
+		},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &captureProvider{})
+	al.tools.Register(pingTool{tools.NewFuncTool("ping", "Ping", nil, nil)})
+	al.commands = commands.NewRouter()
+	al.registerCommands()
+
+	resp, _ := al.processMessage(t.Context(), bus.InboundMessage{
+		Channel: "slack", ChatID: "c1", SenderID: "u1", SessionKey: "slack:c1", Content: "!ping there",
+	})
+	if resp != "pong there" {
+		t.Errorf("resp = %q", resp)
+	}
+}
+
+func TestParseMuteDuration(t *testing.T) {
+	tests := map[string]bool{"30m": true, "2h": true, "1d": true, "1h30m": true, "0m": false, "-1h": false, "xd": false, "soon": false}
+	for in, ok := range tests {
+		if _, err := parseMuteDuration(in); (err == nil) != ok {
+			t.Errorf("parseMuteDuration(%q) error = %v", in, err)
+		}
+	}
+}
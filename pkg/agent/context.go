@@ -5,9 +5,12 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 	"time"
+	"unicode/utf8"
 
+	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/logger"
 	"github.com/sipeed/picoclaw/pkg/providers"
 	"github.com/sipeed/picoclaw/pkg/skills"
@@ -19,14 +22,18 @@ type ContextBuilder struct {
 	skillsLoader *skills.SkillsLoader
 	memory       *MemoryStore
 	tools        *tools.ToolRegistry // Direct reference to tool registry
+	compact      bool                // Short system prompt for small local models
 }
 
+// Compact prompt limits. Tool schemas already reach the model with every
+// request, so the compact prompt lists tools by name only.
+const (
+	compactBootstrapChars = 1500
+	compactMemoryChars    = 1000
+)
+
 func getGlobalConfigDir() string {
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return ""
-	}
-	return filepath.Join(home, ".picoclaw")
+	return config.HomeDir()
 }
 
 func NewContextBuilder(workspace string) *ContextBuilder {
@@ -48,6 +55,12 @@ func (cb *ContextBuilder) SetToolsRegistry(registry *tools.ToolRegistry) {
 	cb.tools = registry
 }
 
+// SetCompact switches to a short system prompt for models with a small
+// context window.
+func (cb *ContextBuilder) SetCompact(compact bool) {
+	cb.compact = compact
+}
+
 func (cb *ContextBuilder) getIdentity() string {
 	now := time.Now().Format("2006-01-02 15:04 (Monday)")
 	workspacePath, _ := filepath.Abs(filepath.Join(cb.workspace))
@@ -106,7 +119,36 @@ func (cb *ContextBuilder) buildToolsSection() string {
 	return sb.String()
 }
 
+// getCompactIdentity is the local mode counterpart of getIdentity.
+func (cb *ContextBuilder) getCompactIdentity() string {
+	now := time.Now().Format("2006-01-02 15:04 (Monday)")
+	workspacePath, _ := filepath.Abs(filepath.Join(cb.workspace))
+
+	var names []string
+	if cb.tools != nil {
+		names = cb.tools.List()
+		sort.Strings(names)
+	}
+
+	return fmt.Sprintf(`# picoclaw
+
+You are picoclaw, a helpful assistant on a small device. Keep answers short.
+
+Time: %s
+Workspace: %s
+Tools: %s
+
+Rules:
+1. To act (files, commands, reminders, messages), call a tool. Never pretend.
+2. Save lasting notes to %s/memory/MEMORY.md.`,
+		now, workspacePath, strings.Join(names, ", "), workspacePath)
+}
+
 func (cb *ContextBuilder) BuildSystemPrompt() string {
+	if cb.compact {
+		return cb.buildCompactSystemPrompt()
+	}
+
 	parts := []string{}
 
 	// Core identity section
@@ -138,6 +180,32 @@ The following skills extend your capabilities. To use a skill, read its SKILL.md
 	return strings.Join(parts, "\n\n---\n\n")
 }
 
+// buildCompactSystemPrompt keeps the identity, trimmed bootstrap files, and
+// trimmed memory, and leaves out the skills summary.
+func (cb *ContextBuilder) buildCompactSystemPrompt() string {
+	parts := []string{cb.getCompactIdentity()}
+
+	if bootstrap := cb.LoadBootstrapFiles(); bootstrap != "" {
+		parts = append(parts, truncateChars(strings.TrimSpace(bootstrap), compactBootstrapChars))
+	}
+	if memoryContext := cb.memory.GetMemoryContext(); memoryContext != "" {
+		parts = append(parts, "# Memory\n\n"+truncateChars(memoryContext, compactMemoryChars))
+	}
+
+	return strings.Join(parts, "\n\n---\n\n")
+}
+
+// truncateChars cuts s to at most n bytes on a rune boundary.
+func truncateChars(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "\n[...]"
+}
+
 func (cb *ContextBuilder) LoadBootstrapFiles() string {
 	bootstrapFiles := []string{
 		"AGENTS.md",
@@ -0,0 +1,39 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+func TestCompactSystemPrompt(t *testing.T) {
+	workspace := t.TempDir()
+	os.WriteFile(filepath.Join(workspace, "AGENTS.md"), []byte(strings.Repeat("be nice. ", 1000)), 0644)
+
+	registry := tools.NewToolRegistry()
+	registry.Register(tools.NewMessageTool())
+	registry.Register(tools.NewReadFileTool(workspace, true))
+
+	cb := NewContextBuilder(workspace)
+	cb.SetToolsRegistry(registry)
+	full := cb.BuildSystemPrompt()
+
+	cb.SetCompact(true)
+	compact := cb.BuildSystemPrompt()
+
+	if len(compact) >= len(full)/2 {
+		t.Errorf("compact prompt is %d chars, full is %d", len(compact), len(full))
+	}
+	if !strings.Contains(compact, "Tools: message, read_file") {
+		t.Errorf("compact prompt should list tool names:\n%s", compact)
+	}
+	if strings.Contains(compact, "Send a message to user") {
+		t.Error("compact prompt should not repeat tool descriptions")
+	}
+	if !strings.Contains(compact, "be nice.") || !strings.Contains(compact, "[...]") {
+		t.Error("bootstrap files should be kept but trimmed")
+	}
+}
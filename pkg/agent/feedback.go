@@ -0,0 +1,64 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package agent
+
+import (
+	"context"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/commands"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/session"
+)
+
+// feedbackCommand implements "/good [comment]" and "/bad [comment]", which
+// rate the latest reply in the chat. Channels send them for 👍 and 👎
+// reactions too, which are acknowledged silently.
+func (al *AgentLoop) feedbackCommand(ctx context.Context, req commands.Request) string {
+	msg := req.Msg
+	reaction := msg.Metadata["reaction"] != ""
+
+	prompt, response, ok := al.sessions.LastExchange(msg.SessionKey)
+	if !ok {
+		if reaction {
+			return ""
+		}
+		return t(msg, "feedback.none")
+	}
+
+	fb := session.Feedback{
+		Rating:   req.Name,
+		SenderID: msg.SenderID,
+		Comment:  req.Raw,
+		Prompt:   prompt,
+		Response: response,
+		Model:    al.model,
+		Time:     time.Now(),
+	}
+	if p := al.resolvePersona(msg.SessionKey, msg.Channel, msg.ChatID, prompt); p != nil {
+		fb.Persona = p.name
+		fb.Model = al.modelFor(p)
+	}
+	al.sessions.AddFeedback(msg.SessionKey, fb)
+	if err := al.sessions.Save(msg.SessionKey); err != nil {
+		logger.WarnCF("agent", "Failed to save feedback",
+			map[string]interface{}{"session_key": msg.SessionKey, "error": err.Error()})
+		if !reaction {
+			return t(msg, "feedback.save_failed")
+		}
+	}
+
+	logger.InfoCF("agent", "Recorded feedback",
+		map[string]interface{}{"session_key": msg.SessionKey, "rating": req.Name})
+	if reaction {
+		return ""
+	}
+	if req.Name == "bad" {
+		return t(msg, "feedback.bad")
+	}
+	return t(msg, "feedback.good")
+}
@@ -0,0 +1,64 @@
+package agent
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/session"
+)
+
+func TestFeedbackCommands(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         dir,
+				Model:             "test-model",
+				MaxTokens:         1024,
+				MaxToolIterations: 5,
+			},
+		},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &captureProvider{})
+
+	send := func(content string, metadata map[string]string) string {
+		t.Helper()
+		resp, err := al.processMessage(t.Context(), bus.InboundMessage{
+			Channel: "telegram", ChatID: "c1", SenderID: "u1", SessionKey: "telegram:c1", Content: content, Metadata: metadata,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	if resp := send("/good", nil); !strings.Contains(resp, "no reply") {
+		t.Errorf("/good before any reply = %q", resp)
+	}
+
+	send("what is 2+2", nil)
+	if resp := send("/bad wrong units", nil); !strings.Contains(resp, "noted") {
+		t.Errorf("/bad = %q", resp)
+	}
+	if resp := send("/good", map[string]string{"reaction": "👍"}); resp != "" {
+		t.Errorf("reaction feedback replied %q", resp)
+	}
+
+	// Feedback is stored with the session and survives a restart
+	reloaded := session.NewSessionManager(filepath.Join(dir, "sessions"))
+	got := reloaded.AllFeedback()
+	if len(got) != 2 {
+		t.Fatalf("feedback = %+v, want 2 entries", got)
+	}
+	first := got[0]
+	if first.Rating != "bad" || first.Comment != "wrong units" || first.Prompt != "what is 2+2" || first.Response != "ok" ||
+		first.Session != "telegram:c1" || first.SenderID != "u1" || first.Model != "test-model" {
+		t.Errorf("feedback = %+v", first)
+	}
+	if got[1].Rating != "good" {
+		t.Errorf("reaction rating = %q, want good", got[1].Rating)
+	}
+}
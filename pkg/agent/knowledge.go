@@ -0,0 +1,65 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/rag"
+)
+
+// SetKnowledgeBase grounds answers in the local knowledge base: every
+// message is looked up first, and the topK passages scoring at least
+// minScore are put in front of the model with their sources.
+func (al *AgentLoop) SetKnowledgeBase(store *rag.Store, topK int, minScore float64) {
+	if topK <= 0 {
+		topK = 4
+	}
+	al.knowledge = store
+	al.knowledgeTopK = topK
+	al.knowledgeMinScore = minScore
+}
+
+// SetKnowledgeStore gives the agent the knowledge base to save messages to
+// when a reaction trigger asks for it.
+func (al *AgentLoop) SetKnowledgeStore(store *rag.Store) {
+	al.knowledgeStore = store
+}
+
+// knowledgeSection returns the passages relevant to message as a system
+// prompt section, or "" when none are close enough.
+func (al *AgentLoop) knowledgeSection(ctx context.Context, message string) string {
+	if al.knowledge == nil || strings.TrimSpace(message) == "" {
+		return ""
+	}
+
+	results, err := al.knowledge.Search(ctx, message, al.knowledgeTopK)
+	if err != nil {
+		logger.WarnCF("agent", "Knowledge base lookup failed",
+			map[string]interface{}{"error": err.Error()})
+		return ""
+	}
+
+	var sb strings.Builder
+	for _, r := range results {
+		if r.Score < al.knowledgeMinScore {
+			continue
+		}
+		fmt.Fprintf(&sb, "\n\n[%s]\n%s", r.Citation(), strings.TrimSpace(r.Content))
+	}
+	if sb.Len() == 0 {
+		return ""
+	}
+	return "\n\n---\n\n# Knowledge Base\n\n" +
+		"These passages from the user's own documents may answer the message. Prefer them over general knowledge, " +
+		"and cite the source of each fact you use in brackets, e.g. [manuals/router.md]. " +
+		"If they do not answer the question, say so before answering from general knowledge." +
+		sb.String()
+}
@@ -0,0 +1,60 @@
+package agent
+
+import (
+	"context"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/rag"
+)
+
+// wordEmbedder is a deterministic bag-of-words embedder for tests.
+type wordEmbedder struct{}
+
+func (wordEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	out := make([][]float32, len(texts))
+	for i, text := range texts {
+		v := make([]float32, 64)
+		for _, w := range strings.Fields(strings.ToLower(text)) {
+			h := fnv.New32a()
+			h.Write([]byte(strings.Trim(w, ".,!?")))
+			v[h.Sum32()%64]++
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+func TestKnowledgeSection(t *testing.T) {
+	dir := t.TempDir()
+	store, err := rag.Open(filepath.Join(dir, "rag.db"), wordEmbedder{}, rag.Options{ChunkSize: 200})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	docs := filepath.Join(dir, "documents")
+	os.MkdirAll(filepath.Join(docs, "manuals"), 0755)
+	os.WriteFile(filepath.Join(docs, "manuals", "router.md"), []byte("The wifi router password is hunter2."), 0644)
+	if err := store.IngestDir(context.Background(), docs); err != nil {
+		t.Fatal(err)
+	}
+
+	al := &AgentLoop{}
+	if got := al.knowledgeSection(context.Background(), "what is the wifi password"); got != "" {
+		t.Errorf("section without a knowledge base = %q", got)
+	}
+
+	al.SetKnowledgeBase(store, 2, 0.3)
+	got := al.knowledgeSection(context.Background(), "what is the wifi router password")
+	if !strings.Contains(got, "[manuals/router.md]\nThe wifi router password is hunter2.") {
+		t.Errorf("section missing cited passage:\n%s", got)
+	}
+
+	if got := al.knowledgeSection(context.Background(), "basil watering schedule"); got != "" {
+		t.Errorf("unrelated message got passages:\n%s", got)
+	}
+}
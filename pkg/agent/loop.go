@@ -16,49 +16,94 @@ import (
 	"sync"
 	"sync/atomic"
 	"time"
-	"unicode/utf8"
 
 	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/commands"
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/crash"
+	"github.com/sipeed/picoclaw/pkg/history"
 	"github.com/sipeed/picoclaw/pkg/logger"
 	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/rag"
 	"github.com/sipeed/picoclaw/pkg/session"
 	"github.com/sipeed/picoclaw/pkg/state"
+	"github.com/sipeed/picoclaw/pkg/templates"
 	"github.com/sipeed/picoclaw/pkg/tools"
+	"github.com/sipeed/picoclaw/pkg/translation"
+	"github.com/sipeed/picoclaw/pkg/usage"
 	"github.com/sipeed/picoclaw/pkg/utils"
 )
 
 type AgentLoop struct {
-	bus            *bus.MessageBus
-	provider       providers.LLMProvider
-	workspace      string
-	model          string
-	contextWindow  int // Maximum context window size in tokens
-	maxIterations  int
-	sessions       *session.SessionManager
-	state          *state.Manager
-	contextBuilder *ContextBuilder
-	tools          *tools.ToolRegistry
-	running        atomic.Bool
-	summarizing    sync.Map // Tracks which sessions are currently being summarized
+	bus               *bus.MessageBus
+	provider          providers.LLMProvider
+	workspace         string
+	model             string
+	contextWindow     int // Model context window in tokens
+	maxTokens         int // Tokens reserved for each reply
+	toolOutputReserve int // Tokens kept free for tool output during a turn
+	maxIterations     int
+	temperature       float64
+	streaming         bool
+	matchLanguage     bool // Reply in the language each message is written in
+	vision            bool // Attach incoming images to the LLM call
+	visionMaxDim      int
+	summarizeAt       int // History length that triggers summarization
+	keepRecent        int // Messages kept verbatim after summarization
+	sessions          *session.SessionManager
+	state             *state.Manager
+	contextBuilder    *ContextBuilder
+	tools             *tools.ToolRegistry
+	running           atomic.Bool
+	summarizing       sync.Map // Tracks which sessions are currently being summarized
+	approvals         *tools.ApprovalStore
+	personas          map[string]config.PersonaConfig
+	chatPersonas      map[string]string                // "channel:chat_id" -> persona name
+	personaProviders  map[string]providers.LLMProvider // personas with their own provider or model
+	routes            []route
+	usage             *usage.Tracker
+	userBudget        float64                // Monthly USD limit per sender, 0 = unlimited
+	chatBudget        float64                // Monthly USD limit per chat, 0 = unlimited
+	cache             *responseCache         // nil when response caching is disabled
+	preferences       *tools.PreferenceStore // nil when preference memory is disabled
+	knowledge         *rag.Store             // nil unless answers are grounded automatically
+	knowledgeTopK     int
+	knowledgeMinScore float64
+	knowledgeStore    *rag.Store        // nil unless the knowledge base is enabled
+	history           *history.Store    // nil unless the chat history log is kept
+	recent            *recentMessages   // Session messages by platform ID, for edits
+	reactionTriggers  map[string]string // Emoji -> reaction trigger action
+	workflows         []*workflow
+	templates         *templates.Engine
+	commands          *commands.Router
+	started           time.Time
+	translation       config.TranslationConfig
+	translator        *translation.Client // nil translates with the model
 }
 
 // processOptions configures how a message is processed
 type processOptions struct {
-	SessionKey      string // Session identifier for history/context
-	Channel         string // Target channel for tool execution
-	ChatID          string // Target chat ID for tool execution
-	UserMessage     string // User message content (may include prefix)
-	DefaultResponse string // Response when LLM returns empty
-	EnableSummary   bool   // Whether to trigger summarization
-	SendResponse    bool   // Whether to send response via bus
-	NoHistory       bool   // If true, don't load session history (for heartbeat)
+	SessionKey      string   // Session identifier for history/context
+	Channel         string   // Target channel for tool execution
+	ChatID          string   // Target chat ID for tool execution
+	SenderID        string   // Sender charged for usage and whose preferences apply
+	UserMessage     string   // User message content (may include prefix)
+	DefaultResponse string   // Response when LLM returns empty
+	EnableSummary   bool     // Whether to trigger summarization
+	SendResponse    bool     // Whether to send response via bus
+	NoHistory       bool     // If true, don't load session history (for heartbeat)
+	Stream          bool     // Whether to stream partial output to the channel
+	Persona         *persona // Optional persona applied to this turn
+	Media           []string // Local attachment paths from the inbound message
+	Cacheable       bool     // Whether the answer may be served from or stored in the response cache
+	MessageID       string   // Platform ID of the inbound message, for reacting to it
+	ReplyLanguage   string   // Language the user writes in, unless the chat set one with /lang
 }
 
 // createToolRegistry creates a tool registry with common tools.
 // This is shared between main agent and subagents.
-func createToolRegistry(workspace string, restrict bool, cfg *config.Config, msgBus *bus.MessageBus) *tools.ToolRegistry {
+func createToolRegistry(workspace string, restrict bool, cfg *config.Config, msgBus *bus.MessageBus, approvals *tools.ApprovalStore, msgTemplates *templates.Engine) *tools.ToolRegistry {
 	registry := tools.NewToolRegistry()
 
 	// File system tools
@@ -69,9 +114,12 @@ func createToolRegistry(workspace string, restrict bool, cfg *config.Config, msg
 	registry.Register(tools.NewAppendFileTool(workspace, restrict))
 
 	// Shell execution
-	registry.Register(tools.NewExecTool(workspace, restrict))
+	registry.Register(newExecTool(workspace, restrict, cfg, approvals))
 
 	if searchTool := tools.NewWebSearchTool(tools.WebSearchToolOptions{
+		SearxNGURL:           cfg.Tools.Web.SearxNG.URL,
+		SearxNGMaxResults:    cfg.Tools.Web.SearxNG.MaxResults,
+		SearxNGEnabled:       cfg.Tools.Web.SearxNG.Enabled,
 		BraveAPIKey:          cfg.Tools.Web.Brave.APIKey,
 		BraveMaxResults:      cfg.Tools.Web.Brave.MaxResults,
 		BraveEnabled:         cfg.Tools.Web.Brave.Enabled,
@@ -97,23 +145,140 @@ func createToolRegistry(workspace string, restrict bool, cfg *config.Config, msg
 		})
 		return nil
 	})
+	messageTool.SetButtonSender(func(msg bus.OutboundMessage) error {
+		msgBus.PublishOutbound(msg)
+		return nil
+	})
+	messageTool.SetTemplates(msgTemplates)
 	registry.Register(messageTool)
+	registry.Register(tools.NewReactTool(func(channel, chatID string, reaction bus.Reaction) error {
+		msgBus.PublishOutbound(bus.OutboundMessage{
+			Channel:  channel,
+			ChatID:   chatID,
+			Reaction: &reaction,
+		})
+		return nil
+	}))
 
 	return registry
 }
 
+// newExecTool builds the shell tool from the tools.exec settings.
+func newExecTool(workspace string, restrict bool, cfg *config.Config, approvals *tools.ApprovalStore) *tools.ExecTool {
+	execTool := tools.NewExecTool(workspace, restrict)
+	if cfg.Tools.Exec.Timeout > 0 {
+		execTool.SetTimeout(time.Duration(cfg.Tools.Exec.Timeout) * time.Second)
+	}
+	if len(cfg.Tools.Exec.AllowPatterns) > 0 {
+		if err := execTool.SetAllowPatterns(cfg.Tools.Exec.AllowPatterns); err != nil {
+			logger.ErrorCF("agent", "Invalid exec allow pattern, exec tool will reject all commands",
+				map[string]interface{}{"error": err.Error()})
+			// Fail closed: a pattern that matches no command
+			execTool.SetAllowPatterns([]string{`^\b$`})
+		}
+	}
+	if approvals != nil {
+		execTool.SetApprovalStore(approvals)
+	}
+	return execTool
+}
+
+// newImageGenTool builds the generate_image tool from the tools.image_gen
+// settings. Generated images are delivered as native media messages.
+func newImageGenTool(workspace string, cfg *config.Config, msgBus *bus.MessageBus) *tools.ImageGenTool {
+	ig := cfg.Tools.ImageGen
+	apiKey := ig.APIKey
+	if apiKey == "" && (ig.Provider == "" || ig.Provider == "openai") {
+		apiKey = cfg.Providers.OpenAI.APIKey
+	}
+	imageTool := tools.NewImageGenTool(tools.ImageGenToolOptions{
+		Provider:  ig.Provider,
+		APIKey:    apiKey,
+		APIBase:   ig.APIBase,
+		Model:     ig.Model,
+		Size:      ig.Size,
+		OutputDir: filepath.Join(workspace, "images"),
+	})
+	imageTool.SetSendCallback(func(channel, chatID, caption string, media []string) error {
+		msgBus.PublishOutbound(bus.OutboundMessage{
+			Channel: channel,
+			ChatID:  chatID,
+			Content: caption,
+			Media:   media,
+		})
+		return nil
+	})
+	return imageTool
+}
+
+func newEmailTool(cfg *config.Config, msgBus *bus.MessageBus) *tools.EmailTool {
+	ec := cfg.Tools.Email
+	emailTool := tools.NewEmailTool(tools.EmailToolOptions{
+		Host:     ec.SMTPHost,
+		Port:     ec.SMTPPort,
+		Username: ec.Username,
+		Password: ec.Password,
+		From:     ec.From,
+		Contacts: ec.Contacts,
+	})
+	emailTool.SetSendCallback(func(channel, chatID, content string) error {
+		msgBus.PublishOutbound(bus.OutboundMessage{
+			Channel: channel,
+			ChatID:  chatID,
+			Content: content,
+		})
+		return nil
+	})
+	return emailTool
+}
+
+func newHomeAssistantTool(cfg *config.Config) *tools.HomeAssistantTool {
+	hc := cfg.Tools.HomeAssistant
+	rules := make([]tools.HomeAssistantRule, 0, len(hc.Rules))
+	for _, r := range hc.Rules {
+		rules = append(rules, tools.HomeAssistantRule{Entities: r.Entities, Access: r.Access, Senders: r.Senders})
+	}
+	return tools.NewHomeAssistantTool(tools.HomeAssistantToolOptions{
+		URL:        hc.URL,
+		Token:      hc.Token,
+		Rules:      rules,
+		MQTTTopics: hc.MQTTTopics,
+	})
+}
+
 func NewAgentLoop(cfg *config.Config, msgBus *bus.MessageBus, provider providers.LLMProvider) *AgentLoop {
 	workspace := cfg.WorkspacePath()
 	os.MkdirAll(workspace, 0755)
 
 	restrict := cfg.Agents.Defaults.RestrictToWorkspace
 
+	// Shell commands from chat channels can require explicit approval
+	var approvals *tools.ApprovalStore
+	if cfg.Tools.Exec.RequireApproval {
+		approvals = tools.NewApprovalStore(tools.DefaultApprovalTTL)
+		approvals.SetNotifier(func(channel, chatID, content string) error {
+			msgBus.PublishOutbound(bus.OutboundMessage{
+				Channel: channel,
+				ChatID:  chatID,
+				Content: content,
+			})
+			return nil
+		})
+	}
+
+	msgTemplates, err := templates.Load(cfg.Templates, filepath.Join(workspace, "templates"))
+	if err != nil {
+		logger.ErrorCF("agent", "Invalid message templates, none loaded",
+			map[string]interface{}{"error": err.Error()})
+		msgTemplates, _ = templates.Load(nil, "")
+	}
+
 	// Create tool registry for main agent
-	toolsRegistry := createToolRegistry(workspace, restrict, cfg, msgBus)
+	toolsRegistry := createToolRegistry(workspace, restrict, cfg, msgBus, approvals, msgTemplates)
 
 	// Create subagent manager with its own tool registry
 	subagentManager := tools.NewSubagentManager(provider, cfg.Agents.Defaults.Model, workspace, msgBus)
-	subagentTools := createToolRegistry(workspace, restrict, cfg, msgBus)
+	subagentTools := createToolRegistry(workspace, restrict, cfg, msgBus, approvals, msgTemplates)
 	// Subagent doesn't need spawn/subagent tools to avoid recursion
 	subagentManager.SetTools(subagentTools)
 
@@ -125,28 +290,96 @@ func NewAgentLoop(cfg *config.Config, msgBus *bus.MessageBus, provider providers
 	subagentTool := tools.NewSubagentTool(subagentManager)
 	toolsRegistry.Register(subagentTool)
 
+	if cfg.Tools.ImageGen.Enabled {
+		toolsRegistry.Register(newImageGenTool(workspace, cfg, msgBus))
+	}
+	if cfg.Tools.Email.Enabled {
+		toolsRegistry.Register(newEmailTool(cfg, msgBus))
+	}
+	if cfg.Tools.HomeAssistant.Enabled {
+		toolsRegistry.Register(newHomeAssistantTool(cfg))
+	}
+
+	// Preferences stay in memory until SetStateStore provides the shared
+	// state store.
+	var preferences *tools.PreferenceStore
+	if cfg.Preferences.Enabled {
+		preferences = tools.NewPreferenceStore(state.NewMemoryStore(), cfg.Preferences.Identities)
+		toolsRegistry.Register(tools.NewPreferencesTool(preferences))
+	}
+
 	sessionsManager := session.NewSessionManager(filepath.Join(workspace, "sessions"))
 
+	contextWindow := cfg.Agents.Defaults.ContextWindow
+	if contextWindow <= 0 {
+		contextWindow = contextWindowFor(cfg.Agents.Defaults.Model)
+	}
+	maxTokens := cfg.Agents.Defaults.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = 8192
+	}
+
+	toolsRegistry.Register(tools.NewSummarizeTool(provider, cfg.Agents.Defaults.Model, contextWindow, workspace, restrict))
+
 	// Create state manager for atomic state persistence
 	stateManager := state.NewManager(workspace)
 
 	// Create context builder and set tools registry
 	contextBuilder := NewContextBuilder(workspace)
 	contextBuilder.SetToolsRegistry(toolsRegistry)
+	contextBuilder.SetCompact(cfg.Agents.Defaults.LocalMode)
+
+	var cache *responseCache
+	if cfg.Agents.Defaults.ResponseCacheTTL > 0 {
+		cache = newResponseCache(time.Duration(cfg.Agents.Defaults.ResponseCacheTTL)*time.Second, cfg.Agents.Defaults.ResponseCacheSize)
+	}
 
-	return &AgentLoop{
-		bus:            msgBus,
-		provider:       provider,
-		workspace:      workspace,
-		model:          cfg.Agents.Defaults.Model,
-		contextWindow:  cfg.Agents.Defaults.MaxTokens, // Restore context window for summarization
-		maxIterations:  cfg.Agents.Defaults.MaxToolIterations,
-		sessions:       sessionsManager,
-		state:          stateManager,
-		contextBuilder: contextBuilder,
-		tools:          toolsRegistry,
-		summarizing:    sync.Map{},
+	al := &AgentLoop{
+		bus:               msgBus,
+		provider:          provider,
+		workspace:         workspace,
+		model:             cfg.Agents.Defaults.Model,
+		contextWindow:     contextWindow,
+		maxTokens:         maxTokens,
+		toolOutputReserve: cfg.Agents.Defaults.ToolOutputReserve,
+		maxIterations:     cfg.Agents.Defaults.MaxToolIterations,
+		temperature:       cfg.Agents.Defaults.Temperature,
+		vision:            cfg.Agents.Defaults.Vision,
+		visionMaxDim:      cfg.Agents.Defaults.VisionMaxDimension,
+		streaming:         cfg.Agents.Defaults.Streaming,
+		matchLanguage:     cfg.Agents.Defaults.MatchLanguage,
+		summarizeAt:       cfg.Agents.Defaults.SummarizeThreshold,
+		keepRecent:        cfg.Agents.Defaults.KeepRecentMessages,
+		sessions:          sessionsManager,
+		state:             stateManager,
+		contextBuilder:    contextBuilder,
+		tools:             toolsRegistry,
+		summarizing:       sync.Map{},
+		approvals:         approvals,
+		personas:          cfg.Agents.Personas,
+		chatPersonas:      cfg.Agents.ChatPersonas,
+		personaProviders:  newPersonaProviders(cfg),
+		routes:            compileRoutes(cfg.Agents.Routes, cfg.Agents.Personas),
+		cache:             cache,
+		preferences:       preferences,
+		workflows:         compileWorkflows(cfg.Agents.Workflows),
+		templates:         msgTemplates,
+		commands:          commands.NewRouter(),
+		recent:            newRecentMessages(),
+		reactionTriggers:  newReactionTriggers(cfg.Agents.Defaults.ReactionTriggers),
+		started:           time.Now(),
+		translation:       cfg.Translation,
 	}
+	if al.translation.Language == "" {
+		al.translation.Language = "en"
+	}
+	if cfg.Translation.APIBase != "" {
+		al.translator = translation.NewClient(cfg.Translation.APIBase, cfg.Translation.APIKey)
+	}
+	al.registerCommands()
+	msgBus.OnChatEvent(al.handleChatEvent)
+
+	return al
 }
 
 func (al *AgentLoop) Run(ctx context.Context) error {
@@ -159,36 +392,75 @@ func (al *AgentLoop) Run(ctx context.Context) error {
 		default:
 			msg, ok := al.bus.ConsumeInbound(ctx)
 			if !ok {
+				if al.bus.InboundClosed() {
+					// Shutdown: inbound closed and the queue has been drained.
+					return nil
+				}
 				continue
 			}
 
-			response, err := al.processMessage(ctx, msg)
-			if err != nil {
-				response = fmt.Sprintf("Error processing message: %v", err)
-			}
+			al.handleInbound(ctx, msg)
+		}
+	}
 
-			if response != "" {
-				// Check if the message tool already sent a response during this round.
-				// If so, skip publishing to avoid duplicate messages to the user.
-				alreadySent := false
-				if tool, ok := al.tools.Get("message"); ok {
-					if mt, ok := tool.(*tools.MessageTool); ok {
-						alreadySent = mt.HasSentInRound()
-					}
-				}
+	return nil
+}
 
-				if !alreadySent {
-					al.bus.PublishOutbound(bus.OutboundMessage{
-						Channel: msg.Channel,
-						ChatID:  msg.ChatID,
-						Content: response,
-					})
-				}
-			}
+// handleInbound processes a single inbound message and publishes the reply.
+// A panic while handling one message is recovered and reported so the loop
+// keeps consuming subsequent messages.
+func (al *AgentLoop) handleInbound(ctx context.Context, msg bus.InboundMessage) {
+	defer crash.Recover("agent", crash.MessageContext(msg.Channel, msg.ChatID, msg.SenderID, msg.Content))
+	// Channels hand downloaded attachments over to the agent
+	defer utils.RemoveMedia(msg.Media)
+	if msg.Change != nil {
+		al.applyChange(msg)
+		return
+	}
+	// Reactions that stand for no command are only there for recorders,
+	// unless they are configured as triggers
+	if msg.Reaction != nil && msg.Content == "" {
+		var rerun bool
+		if msg, rerun = al.reactionTrigger(ctx, msg); !rerun {
+			return
 		}
 	}
+	// Channels show their "working on it" indicator until the agent answers
+	defer al.bus.StartProcessing(msg)()
+	ctx = bus.WithTrace(ctx, msg.TraceID, msg.CorrelationID)
 
-	return nil
+	response, err := al.processMessage(ctx, msg)
+	if err != nil {
+		response = t(msg, "error.processing", err)
+	}
+
+	al.publishResponse(msg.Channel, msg.ChatID, replyTarget(msg), response)
+}
+
+// publishResponse sends a turn's final answer to the chat, as a reply to
+// the message with platform ID replyTo unless that is "".
+func (al *AgentLoop) publishResponse(channel, chatID, replyTo, response string) {
+	if response == "" {
+		return
+	}
+
+	// Check if the message tool already sent a response during this round.
+	// If so, skip publishing to avoid duplicate messages to the user.
+	alreadySent := false
+	if tool, ok := al.tools.Get("message"); ok {
+		if mt, ok := tool.(*tools.MessageTool); ok {
+			alreadySent = mt.HasSentInRound()
+		}
+	}
+
+	if !alreadySent {
+		al.bus.PublishOutbound(bus.OutboundMessage{
+			Channel:   channel,
+			ChatID:    chatID,
+			Content:   response,
+			ReplyToID: replyTo,
+		})
+	}
 }
 
 func (al *AgentLoop) Stop() {
@@ -199,6 +471,12 @@ func (al *AgentLoop) RegisterTool(tool tools.Tool) {
 	al.tools.Register(tool)
 }
 
+// Templates returns the named message templates from config and
+// workspace/templates.
+func (al *AgentLoop) Templates() *templates.Engine {
+	return al.templates
+}
+
 // RecordLastChannel records the last active channel for this workspace.
 // This uses the atomic state save mechanism to prevent data loss on crash.
 func (al *AgentLoop) RecordLastChannel(channel string) error {
@@ -227,6 +505,19 @@ func (al *AgentLoop) ProcessDirectWithChannel(ctx context.Context, content, sess
 	return al.processMessage(ctx, msg)
 }
 
+// ProcessScheduled runs a scheduled prompt as a user turn in sessionKey and
+// sends the answer to channel/chatID.
+func (al *AgentLoop) ProcessScheduled(ctx context.Context, content, sessionKey, channel, chatID string) (string, error) {
+	response, err := al.ProcessDirectWithChannel(ctx, content, sessionKey, channel, chatID)
+	if err != nil {
+		return "", err
+	}
+	if !constants.IsInternalChannel(channel) {
+		al.publishResponse(channel, chatID, "", response)
+	}
+	return response, nil
+}
+
 // ProcessHeartbeat processes a heartbeat request without session history.
 // Each heartbeat is independent and doesn't accumulate context.
 func (al *AgentLoop) ProcessHeartbeat(ctx context.Context, content, channel, chatID string) (string, error) {
@@ -234,6 +525,7 @@ func (al *AgentLoop) ProcessHeartbeat(ctx context.Context, content, channel, cha
 		SessionKey:      "heartbeat",
 		Channel:         channel,
 		ChatID:          chatID,
+		SenderID:        "heartbeat",
 		UserMessage:     content,
 		DefaultResponse: "I've completed processing but have no response to give.",
 		EnableSummary:   false,
@@ -252,10 +544,12 @@ func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage)
 	}
 	logger.InfoCF("agent", fmt.Sprintf("Processing message from %s:%s: %s", msg.Channel, msg.SenderID, logContent),
 		map[string]interface{}{
-			"channel":     msg.Channel,
-			"chat_id":     msg.ChatID,
-			"sender_id":   msg.SenderID,
-			"session_key": msg.SessionKey,
+			"channel":        msg.Channel,
+			"chat_id":        msg.ChatID,
+			"sender_id":      msg.SenderID,
+			"session_key":    msg.SessionKey,
+			"correlation_id": msg.CorrelationID,
+			"trace_id":       msg.TraceID,
 		})
 
 	// Route system messages to processSystemMessage
@@ -263,16 +557,87 @@ func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage)
 		return al.processSystemMessage(ctx, msg)
 	}
 
+	if response, handled := al.commands.Handle(ctx, msg); handled {
+		return response, nil
+	}
+
+	al.recordTranscriptionUsage(msg)
+	if al.isMuted(msg.SessionKey) {
+		return "", nil
+	}
+	if refusal, over := al.checkBudget(msg); over {
+		return refusal, nil
+	}
+	if response, handled := al.handleWorkflow(ctx, msg); handled {
+		return response, nil
+	}
+
 	// Process as user message
-	return al.runAgentLoop(ctx, processOptions{
+	userMessage, replyLang := al.translateInbound(ctx, msg)
+	userMessage = al.withQuote(ctx, msg, userMessage)
+	response, err := al.runAgentLoop(ctx, processOptions{
 		SessionKey:      msg.SessionKey,
 		Channel:         msg.Channel,
 		ChatID:          msg.ChatID,
-		UserMessage:     msg.Content,
+		SenderID:        msg.SenderID,
+		UserMessage:     userMessage,
 		DefaultResponse: "I've completed processing but have no response to give.",
 		EnableSummary:   true,
 		SendResponse:    false,
+		// A reply that is translated afterwards cannot be streamed
+		Stream:    al.streaming && replyLang == "",
+		Persona:   al.resolvePersona(msg.SessionKey, msg.Channel, msg.ChatID, userMessage),
+		Media:     msg.Media,
+		Cacheable: len(msg.Media) == 0,
+		MessageID: msg.Metadata["message_id"],
+		// Detected in the message as written, before any translation
+		ReplyLanguage: al.replyLanguage(msg),
 	})
+	if err != nil || replyLang == "" {
+		return response, err
+	}
+	return al.translateReply(ctx, msg, response, replyLang), nil
+}
+
+// approvalCommand implements "/approve <id>" and "/deny <id>", which answer
+// a pending exec approval.
+func (al *AgentLoop) approvalCommand(ctx context.Context, req commands.Request) string {
+	msg := req.Msg
+	if len(req.Args) != 1 {
+		return t(msg, "approval.usage", req.Name)
+	}
+
+	pending, ok := al.approvals.Take(req.Args[0], msg.Channel, msg.ChatID, msg.SenderID)
+	if !ok {
+		return t(msg, "approval.not_found", req.Args[0])
+	}
+
+	var response string
+	if req.Name == "deny" {
+		response = t(msg, "approval.cancelled", pending.Command)
+	} else {
+		tool, _ := al.tools.Get("exec")
+		execTool, _ := tool.(*tools.ExecTool)
+		if execTool == nil {
+			return t(msg, "approval.no_exec")
+		}
+
+		logger.InfoCF("agent", "Running approved command",
+			map[string]interface{}{
+				"approval_id": pending.ID,
+				"channel":     msg.Channel,
+				"sender_id":   msg.SenderID,
+			})
+		result := execTool.Run(ctx, pending.Command, pending.WorkingDir)
+		response = fmt.Sprintf("$ %s\n%s", pending.Command, result.ForLLM)
+	}
+
+	// Record the outcome so the model knows what happened on the next turn
+	al.sessions.AddMessage(msg.SessionKey, "user", msg.Content)
+	al.sessions.AddMessage(msg.SessionKey, "assistant", response)
+	al.sessions.Save(msg.SessionKey)
+
+	return response
 }
 
 func (al *AgentLoop) processSystemMessage(ctx context.Context, msg bus.InboundMessage) (string, error) {
@@ -342,7 +707,7 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, opts processOptions) (str
 	}
 
 	// 1. Update tool contexts
-	al.updateToolContexts(opts.Channel, opts.ChatID)
+	al.updateToolContexts(opts.Channel, opts.ChatID, opts.SenderID, opts.MessageID)
 
 	// 2. Build messages (skip history for heartbeat)
 	var history []providers.Message
@@ -351,6 +716,35 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, opts processOptions) (str
 		history = al.sessions.GetHistory(opts.SessionKey)
 		summary = al.sessions.GetSummary(opts.SessionKey)
 	}
+
+	// Per-user and per-chat settings that shape the answer
+	personal := al.preferencesSection(opts.Channel, opts.SenderID)
+	shared := al.languageSection(opts) + al.knowledgeSection(ctx, opts.UserMessage)
+	userContext := personal + shared
+
+	// Repeated prompts in a chat reuse the earlier answer. Turns shaped by the
+	// sender's own preferences are neither served from nor stored in the cache.
+	var key string
+	if opts.Cacheable && al.cache != nil && personal == "" {
+		personaName := ""
+		if opts.Persona != nil {
+			personaName = opts.Persona.name
+		}
+		key = cacheKey(al.modelFor(opts.Persona), personaName, opts.Channel+":"+opts.ChatID, shared, opts.UserMessage)
+		if cached, ok := al.cache.get(key); ok {
+			logger.InfoCF("agent", "Serving cached response",
+				map[string]interface{}{"session_key": opts.SessionKey})
+			al.sessions.AddMessage(opts.SessionKey, "user", opts.UserMessage)
+			al.recent.remember(opts.SessionKey, opts.MessageID, opts.UserMessage)
+			al.sessions.AddMessage(opts.SessionKey, "assistant", cached)
+			al.sessions.Save(opts.SessionKey)
+			if opts.EnableSummary {
+				al.maybeSummarize(opts.SessionKey)
+			}
+			return cached, nil
+		}
+	}
+
 	messages := al.contextBuilder.BuildMessages(
 		history,
 		summary,
@@ -359,9 +753,23 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, opts processOptions) (str
 		opts.Channel,
 		opts.ChatID,
 	)
+	messages[0].Content += opts.Persona.promptSection() + userContext
+	messages[len(messages)-1].Images = al.loadImages(opts.Media)
+
+	// Fit history into the model's window, leaving room for tool output
+	messages, dropped := fitMessages(al.modelFor(opts.Persona), messages, al.historyBudget(opts.Persona.filterTools(al.tools.ToProviderDefs())))
+	if dropped > 0 {
+		logger.InfoCF("agent", "Trimmed history to fit context window",
+			map[string]interface{}{
+				"session_key": opts.SessionKey,
+				"dropped":     dropped,
+				"window":      al.contextWindow,
+			})
+	}
 
 	// 3. Save user message to session
 	al.sessions.AddMessage(opts.SessionKey, "user", opts.UserMessage)
+	al.recent.remember(opts.SessionKey, opts.MessageID, opts.UserMessage)
 
 	// 4. Run LLM iteration loop
 	finalContent, iteration, err := al.runLLMIteration(ctx, messages, opts)
@@ -377,6 +785,12 @@ func (al *AgentLoop) runAgentLoop(ctx context.Context, opts processOptions) (str
 		finalContent = opts.DefaultResponse
 	}
 
+	// Only plain answers are cached; turns that called tools may depend on
+	// live data or have side effects
+	if key != "" && iteration == 1 && finalContent != "" {
+		al.cache.put(key, finalContent)
+	}
+
 	// 6. Save final assistant message to session
 	al.sessions.AddMessage(opts.SessionKey, "assistant", finalContent)
 	al.sessions.Save(opts.SessionKey)
@@ -417,23 +831,26 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 		iteration++
 
 		logger.DebugCF("agent", "LLM iteration",
-			map[string]interface{}{
+			bus.TraceFields(ctx, map[string]interface{}{
 				"iteration": iteration,
 				"max":       al.maxIterations,
-			})
+			}))
 
 		// Build tool definitions
-		providerToolDefs := al.tools.ToProviderDefs()
+		providerToolDefs := opts.Persona.filterTools(al.tools.ToProviderDefs())
+
+		// Tool results from earlier iterations may have grown the request
+		messages, _ = fitMessages(al.modelFor(opts.Persona), messages, al.inputBudget(providerToolDefs))
 
 		// Log LLM request details
 		logger.DebugCF("agent", "LLM request",
 			map[string]interface{}{
 				"iteration":         iteration,
-				"model":             al.model,
+				"model":             al.modelFor(opts.Persona),
 				"messages_count":    len(messages),
 				"tools_count":       len(providerToolDefs),
-				"max_tokens":        8192,
-				"temperature":       0.7,
+				"max_tokens":        al.maxTokens,
+				"temperature":       al.temperatureFor(opts.Persona),
 				"system_prompt_len": len(messages[0].Content),
 			})
 
@@ -446,28 +863,37 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 			})
 
 		// Call LLM
-		response, err := al.provider.Chat(ctx, messages, providerToolDefs, al.model, map[string]interface{}{
-			"max_tokens":  8192,
-			"temperature": 0.7,
-		})
+		response, err := al.callLLM(ctx, messages, providerToolDefs, opts)
 
-		if err != nil {
-			logger.ErrorCF("agent", "LLM call failed",
+		// The estimate can undercount; retry once with half the budget
+		if isContextOverflow(err) {
+			logger.WarnCF("agent", "Request exceeded context window, retrying with trimmed context",
 				map[string]interface{}{
 					"iteration": iteration,
 					"error":     err.Error(),
 				})
+			messages, _ = fitMessages(al.modelFor(opts.Persona), messages, al.inputBudget(providerToolDefs)/2)
+			response, err = al.callLLM(ctx, messages, providerToolDefs, opts)
+		}
+
+		if err != nil {
+			logger.ErrorCF("agent", "LLM call failed",
+				bus.TraceFields(ctx, map[string]interface{}{
+					"iteration": iteration,
+					"error":     err.Error(),
+				}))
 			return "", iteration, fmt.Errorf("LLM call failed: %w", err)
 		}
+		al.recordLLMUsage(opts, messages, providerToolDefs, response)
 
 		// Check if no tool calls - we're done
 		if len(response.ToolCalls) == 0 {
 			finalContent = response.Content
 			logger.InfoCF("agent", "LLM response without tool calls (direct answer)",
-				map[string]interface{}{
+				bus.TraceFields(ctx, map[string]interface{}{
 					"iteration":     iteration,
 					"content_chars": len(finalContent),
-				})
+				}))
 			break
 		}
 
@@ -477,11 +903,11 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 			toolNames = append(toolNames, tc.Name)
 		}
 		logger.InfoCF("agent", "LLM requested tool calls",
-			map[string]interface{}{
+			bus.TraceFields(ctx, map[string]interface{}{
 				"tools":     toolNames,
 				"count":     len(response.ToolCalls),
 				"iteration": iteration,
-			})
+			}))
 
 		// Build assistant message with tool calls
 		assistantMsg := providers.Message{
@@ -531,7 +957,12 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 				}
 			}
 
-			toolResult := al.tools.ExecuteWithContext(ctx, tc.Name, tc.Arguments, opts.Channel, opts.ChatID, asyncCallback)
+			var toolResult *tools.ToolResult
+			if opts.Persona.allowsTool(tc.Name) {
+				toolResult = al.tools.ExecuteWithContext(ctx, tc.Name, tc.Arguments, opts.Channel, opts.ChatID, asyncCallback)
+			} else {
+				toolResult = tools.ErrorResult(fmt.Sprintf("tool %s is not available to persona %s", tc.Name, opts.Persona.name))
+			}
 
 			// Send ForUser content to user immediately if not Silent
 			if !toolResult.Silent && toolResult.ForUser != "" && opts.SendResponse {
@@ -552,6 +983,9 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 			if contentForLLM == "" && toolResult.Err != nil {
 				contentForLLM = toolResult.Err.Error()
 			}
+			if al.toolOutputReserve > 0 {
+				contentForLLM = truncateToTokens(al.modelFor(opts.Persona), contentForLLM, al.toolOutputReserve)
+			}
 
 			toolResultMsg := providers.Message{
 				Role:       "tool",
@@ -568,8 +1002,9 @@ func (al *AgentLoop) runLLMIteration(ctx context.Context, messages []providers.M
 	return finalContent, iteration, nil
 }
 
-// updateToolContexts updates the context for tools that need channel/chatID info.
-func (al *AgentLoop) updateToolContexts(channel, chatID string) {
+// updateToolContexts updates the context for tools that need channel/chatID,
+// sender, or message info.
+func (al *AgentLoop) updateToolContexts(channel, chatID, senderID, messageID string) {
 	// Use ContextualTool interface instead of type assertions
 	if tool, ok := al.tools.Get("message"); ok {
 		if mt, ok := tool.(tools.ContextualTool); ok {
@@ -586,15 +1021,66 @@ func (al *AgentLoop) updateToolContexts(channel, chatID string) {
 			st.SetContext(channel, chatID)
 		}
 	}
+	if tool, ok := al.tools.Get("exec"); ok {
+		if et, ok := tool.(tools.ContextualTool); ok {
+			et.SetContext(channel, chatID)
+		}
+		if et, ok := tool.(tools.SenderAwareTool); ok {
+			et.SetSender(channel, senderID)
+		}
+	}
+	if tool, ok := al.tools.Get("generate_image"); ok {
+		if it, ok := tool.(tools.ContextualTool); ok {
+			it.SetContext(channel, chatID)
+		}
+	}
+	if tool, ok := al.tools.Get("presence"); ok {
+		if pt, ok := tool.(tools.ContextualTool); ok {
+			pt.SetContext(channel, chatID)
+		}
+		if pt, ok := tool.(tools.SenderAwareTool); ok {
+			pt.SetSender(channel, senderID)
+		}
+	}
+	if tool, ok := al.tools.Get("react"); ok {
+		if rt, ok := tool.(tools.MessageAwareTool); ok {
+			rt.SetMessage(channel, chatID, messageID, senderID)
+		}
+	}
+	if tool, ok := al.tools.Get("preferences"); ok {
+		if pt, ok := tool.(tools.SenderAwareTool); ok {
+			pt.SetSender(channel, senderID)
+		}
+	}
+	if tool, ok := al.tools.Get("summarize"); ok {
+		if st, ok := tool.(tools.SenderAwareTool); ok {
+			st.SetSender(channel, senderID)
+		}
+	}
+	if tool, ok := al.tools.Get("email"); ok {
+		if et, ok := tool.(tools.SenderAwareTool); ok {
+			et.SetSender(channel, senderID)
+		}
+	}
+	if tool, ok := al.tools.Get("home_assistant"); ok {
+		if ht, ok := tool.(tools.SenderAwareTool); ok {
+			ht.SetSender(channel, senderID)
+		}
+	}
 }
 
 // maybeSummarize triggers summarization if the session history exceeds thresholds.
 func (al *AgentLoop) maybeSummarize(sessionKey string) {
 	newHistory := al.sessions.GetHistory(sessionKey)
 	tokenEstimate := al.estimateTokens(newHistory)
-	threshold := al.contextWindow * 75 / 100
+	threshold := al.historyBudget(al.tools.ToProviderDefs()) * 75 / 100
+
+	summarizeAt := al.summarizeAt
+	if summarizeAt <= 0 {
+		summarizeAt = 20
+	}
 
-	if len(newHistory) > 20 || tokenEstimate > threshold {
+	if len(newHistory) > summarizeAt || tokenEstimate > threshold {
 		if _, loading := al.summarizing.LoadOrStore(sessionKey, true); !loading {
 			go func() {
 				defer al.summarizing.Delete(sessionKey)
@@ -680,12 +1166,12 @@ func (al *AgentLoop) summarizeSession(sessionKey string) {
 	history := al.sessions.GetHistory(sessionKey)
 	summary := al.sessions.GetSummary(sessionKey)
 
-	// Keep last 4 messages for continuity
-	if len(history) <= 4 {
+	split := summarySplitIndex(history, al.keepRecent)
+	if split == 0 {
 		return
 	}
 
-	toSummarize := history[:len(history)-4]
+	toSummarize := history[:split]
 
 	// Oversized Message Guard
 	// Skip messages larger than 50% of context window to prevent summarizer overflow
@@ -698,7 +1184,7 @@ func (al *AgentLoop) summarizeSession(sessionKey string) {
 			continue
 		}
 		// Estimate tokens for this message
-		msgTokens := len(m.Content) / 4
+		msgTokens := countMessageTokens(al.model, m)
 		if msgTokens > maxMessageTokens {
 			omitted = true
 			continue
@@ -718,10 +1204,10 @@ func (al *AgentLoop) summarizeSession(sessionKey string) {
 		part1 := validMessages[:mid]
 		part2 := validMessages[mid:]
 
-		s1, _ := al.summarizeBatch(ctx, part1, "")
+		s1, _ := al.summarizeBatch(ctx, part1, summary)
 		s2, _ := al.summarizeBatch(ctx, part2, "")
 
-		// Merge them
+		// Merge them (part 1 already folds in the previous rolling summary)
 		mergePrompt := fmt.Sprintf("Merge these two conversation summaries into one cohesive summary:\n\n1: %s\n\n2: %s", s1, s2)
 		resp, err := al.provider.Chat(ctx, []providers.Message{{Role: "user", Content: mergePrompt}}, nil, al.model, map[string]interface{}{
 			"max_tokens":  1024,
@@ -742,11 +1228,30 @@ func (al *AgentLoop) summarizeSession(sessionKey string) {
 
 	if finalSummary != "" {
 		al.sessions.SetSummary(sessionKey, finalSummary)
-		al.sessions.TruncateHistory(sessionKey, 4)
+		al.sessions.DropOldest(sessionKey, split)
 		al.sessions.Save(sessionKey)
 	}
 }
 
+// summarySplitIndex returns how many leading messages of history should be
+// folded into the summary, keeping at least keepRecent messages verbatim.
+// The split is moved back so the kept part starts at a user turn and never
+// begins with an orphaned tool result.
+func summarySplitIndex(history []providers.Message, keepRecent int) int {
+	if keepRecent <= 0 {
+		keepRecent = 4
+	}
+	if len(history) <= keepRecent {
+		return 0
+	}
+
+	split := len(history) - keepRecent
+	for split > 0 && history[split].Role != "user" {
+		split--
+	}
+	return split
+}
+
 // summarizeBatch summarizes a batch of messages.
 func (al *AgentLoop) summarizeBatch(ctx context.Context, batch []providers.Message, existingSummary string) (string, error) {
 	prompt := "Provide a concise summary of this conversation segment, preserving core context and key points.\n"
@@ -768,14 +1273,8 @@ func (al *AgentLoop) summarizeBatch(ctx context.Context, batch []providers.Messa
 	return response.Content, nil
 }
 
-// estimateTokens estimates the number of tokens in a message list.
-// Uses rune count instead of byte length so that CJK and other multi-byte
-// characters are not over-counted (a Chinese character is 3 bytes but roughly
-// one token).
+// estimateTokens estimates the number of tokens in a message list for the
+// configured model.
 func (al *AgentLoop) estimateTokens(messages []providers.Message) int {
-	total := 0
-	for _, m := range messages {
-		total += utf8.RuneCountInString(m.Content) / 3
-	}
-	return total
+	return countTokens(al.model, messages)
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -527,3 +528,91 @@ func TestToolResult_UserFacingToolDoesSendMessage(t *testing.T) {
 		t.Errorf("Expected 'Command output: hello world', got: %s", response)
 	}
 }
+
+// execProvider asks for one shell command and records the tool result.
+type execProvider struct {
+	result string
+}
+
+func (p *execProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	last := messages[len(messages)-1]
+	if last.Role == "tool" {
+		p.result = last.Content
+		return &providers.LLMResponse{Content: "done"}, nil
+	}
+	return &providers.LLMResponse{ToolCalls: []providers.ToolCall{{ID: "t1", Name: "exec", Arguments: map[string]interface{}{"command": "echo hi"}}}}, nil
+}
+
+func (p *execProvider) GetDefaultModel() string {
+	return "mock-model"
+}
+
+// TestSubagentExecWithApprovals verifies a subagent's command is refused
+// rather than left waiting for an approval no one can give.
+func TestSubagentExecWithApprovals(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Workspace = t.TempDir()
+	cfg.Tools.Exec.RequireApproval = true
+	msgBus := bus.NewMessageBus()
+	provider := &execProvider{}
+	al := NewAgentLoop(cfg, msgBus, provider)
+
+	al.updateToolContexts("telegram", "chat1", "u1", "")
+	tool, _ := al.tools.Get("subagent")
+	if r := tool.Execute(context.Background(), map[string]interface{}{"task": "say hi"}); r.IsError {
+		t.Fatalf("subagent failed: %s", r.ForLLM)
+	}
+	if !strings.Contains(provider.result, "subagents") || strings.Contains(provider.result, "/approve") {
+		t.Errorf("exec result = %q, want a refusal", provider.result)
+	}
+	if out, ok := msgBus.TryConsumeOutbound(); ok {
+		t.Errorf("unexpected approval prompt %q", out.Content)
+	}
+}
+
+func TestSummarySplitIndex(t *testing.T) {
+	msg := func(role string) providers.Message { return providers.Message{Role: role} }
+
+	tests := []struct {
+		name       string
+		history    []providers.Message
+		keepRecent int
+		want       int
+	}{
+		{
+			name:       "short history is not summarized",
+			history:    []providers.Message{msg("user"), msg("assistant")},
+			keepRecent: 4,
+			want:       0,
+		},
+		{
+			name:       "split on user turn",
+			history:    []providers.Message{msg("user"), msg("assistant"), msg("user"), msg("assistant")},
+			keepRecent: 2,
+			want:       2,
+		},
+		{
+			name: "split moves back past tool results",
+			history: []providers.Message{
+				msg("user"), msg("assistant"),
+				msg("user"), msg("assistant"), msg("tool"), msg("assistant"),
+			},
+			keepRecent: 2,
+			want:       2,
+		},
+		{
+			name:       "default keep when unset",
+			history:    []providers.Message{msg("user"), msg("assistant"), msg("user"), msg("assistant"), msg("user"), msg("assistant")},
+			keepRecent: 0,
+			want:       2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := summarySplitIndex(tt.history, tt.keepRecent); got != tt.want {
+				t.Errorf("summarySplitIndex() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package agent
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/commands"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// persona is a resolved persona preset applied to one turn.
+type persona struct {
+	name         string
+	systemPrompt string
+	temperature  *float64
+	tools        map[string]bool       // nil allows every tool
+	model        string                // Empty uses the default model
+	provider     providers.LLMProvider // nil uses the default provider
+}
+
+func newPersona(name string, cfg config.PersonaConfig) *persona {
+	p := &persona{
+		name:         name,
+		systemPrompt: cfg.SystemPrompt,
+		temperature:  cfg.Temperature,
+		model:        cfg.Model,
+	}
+	if len(cfg.Tools) > 0 {
+		p.tools = make(map[string]bool, len(cfg.Tools))
+		for _, name := range cfg.Tools {
+			p.tools[name] = true
+		}
+	}
+	return p
+}
+
+// allowsTool reports whether the persona may call the named tool.
+func (p *persona) allowsTool(name string) bool {
+	return p == nil || p.tools == nil || p.tools[name]
+}
+
+// filterTools drops tool definitions the persona may not call.
+func (p *persona) filterTools(defs []providers.ToolDefinition) []providers.ToolDefinition {
+	if p == nil || p.tools == nil {
+		return defs
+	}
+	filtered := make([]providers.ToolDefinition, 0, len(defs))
+	for _, def := range defs {
+		if p.tools[def.Function.Name] {
+			filtered = append(filtered, def)
+		}
+	}
+	return filtered
+}
+
+// promptSection renders the persona instructions appended to the system prompt.
+func (p *persona) promptSection() string {
+	if p == nil || strings.TrimSpace(p.systemPrompt) == "" {
+		return ""
+	}
+	return fmt.Sprintf("\n\n---\n\n# Persona: %s\n\n%s", p.name, p.systemPrompt)
+}
+
+// temperatureFor returns the sampling temperature for a turn.
+func (al *AgentLoop) temperatureFor(p *persona) float64 {
+	if p != nil && p.temperature != nil {
+		return *p.temperature
+	}
+	return al.temperature
+}
+
+// modelFor returns the model a turn runs on.
+func (al *AgentLoop) modelFor(p *persona) string {
+	if p != nil && p.model != "" {
+		return p.model
+	}
+	return al.model
+}
+
+// providerFor returns the provider a turn runs on.
+func (al *AgentLoop) providerFor(p *persona) providers.LLMProvider {
+	if p != nil && p.provider != nil {
+		return p.provider
+	}
+	return al.provider
+}
+
+// newPersonaProviders builds a provider for each persona that names its own
+// provider or model. Personas whose provider cannot be built fall back to
+// the default one.
+func newPersonaProviders(cfg *config.Config) map[string]providers.LLMProvider {
+	out := make(map[string]providers.LLMProvider)
+	for name, pc := range cfg.Agents.Personas {
+		if pc.Provider == "" && pc.Model == "" {
+			continue
+		}
+		model := pc.Model
+		if model == "" {
+			model = cfg.Agents.Defaults.Model
+		}
+		provider, err := providers.CreateModelProvider(cfg, pc.Provider, model)
+		if err != nil {
+			logger.ErrorCF("agent", "Failed to create persona provider, using the default",
+				map[string]interface{}{"persona": name, "error": err.Error()})
+			continue
+		}
+		out[name] = provider
+	}
+	return out
+}
+
+// route is a compiled config.RouteConfig.
+type route struct {
+	persona  string
+	channels map[string]bool
+	chats    map[string]bool
+	keywords []*regexp.Regexp
+}
+
+// compileRoutes prepares routes for matching. Routes naming an unknown
+// persona are logged and skipped.
+func compileRoutes(defs []config.RouteConfig, personas map[string]config.PersonaConfig) []route {
+	var out []route
+	for i, def := range defs {
+		if _, ok := personas[def.Persona]; !ok {
+			logger.ErrorCF("agent", "Route names an unknown persona, skipping",
+				map[string]interface{}{"route": i + 1, "persona": def.Persona})
+			continue
+		}
+		r := route{persona: def.Persona}
+		if len(def.Channels) > 0 {
+			r.channels = make(map[string]bool, len(def.Channels))
+			for _, c := range def.Channels {
+				r.channels[c] = true
+			}
+		}
+		if len(def.Chats) > 0 {
+			r.chats = make(map[string]bool, len(def.Chats))
+			for _, c := range def.Chats {
+				r.chats[c] = true
+			}
+		}
+		for _, kw := range def.Keywords {
+			if kw = strings.TrimSpace(kw); kw != "" {
+				r.keywords = append(r.keywords, regexp.MustCompile(`(?i)(^|\W)`+regexp.QuoteMeta(kw)+`($|\W)`))
+			}
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+func (r route) matches(channel, chatID, content string) bool {
+	if r.channels != nil && !r.channels[channel] {
+		return false
+	}
+	if r.chats != nil && !r.chats[channel+":"+chatID] {
+		return false
+	}
+	if len(r.keywords) == 0 {
+		return true
+	}
+	for _, re := range r.keywords {
+		if re.MatchString(content) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolvePersona picks the persona for a message: a /persona selection
+// stored on the session wins over the chat_personas mapping in config,
+// which wins over the first matching route. Keyword routes only apply when
+// content is given.
+func (al *AgentLoop) resolvePersona(sessionKey, channel, chatID, content string) *persona {
+	if len(al.personas) == 0 {
+		return nil
+	}
+
+	name := al.sessions.GetPersona(sessionKey)
+	if name == "" {
+		name = al.chatPersonas[channel+":"+chatID]
+	}
+	if name == "" {
+		for _, r := range al.routes {
+			if r.matches(channel, chatID, content) {
+				name = r.persona
+				break
+			}
+		}
+	}
+	if name == "" {
+		return nil
+	}
+
+	cfg, ok := al.personas[name]
+	if !ok {
+		return nil
+	}
+	p := newPersona(name, cfg)
+	p.provider = al.personaProviders[name]
+	return p
+}
+
+// personaCommand implements "/persona [name|default]".
+func (al *AgentLoop) personaCommand(ctx context.Context, req commands.Request) string {
+	msg := req.Msg
+	if len(req.Args) > 1 {
+		return t(msg, "persona.usage")
+	}
+
+	if len(al.personas) == 0 {
+		return t(msg, "persona.none")
+	}
+
+	names := make([]string, 0, len(al.personas))
+	for name := range al.personas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if len(req.Args) == 0 {
+		current := "default"
+		if p := al.resolvePersona(msg.SessionKey, msg.Channel, msg.ChatID, ""); p != nil {
+			current = p.name
+		}
+		return t(msg, "persona.current", current, strings.Join(names, ", "))
+	}
+
+	name := req.Args[0]
+	if name == "default" {
+		al.sessions.SetPersona(msg.SessionKey, "")
+		al.sessions.Save(msg.SessionKey)
+		return t(msg, "persona.reset")
+	}
+	if _, ok := al.personas[name]; !ok {
+		return t(msg, "persona.unknown", name, strings.Join(names, ", "))
+	}
+
+	al.sessions.SetPersona(msg.SessionKey, name)
+	al.sessions.Save(msg.SessionKey)
+	return t(msg, "persona.switched", name)
+}
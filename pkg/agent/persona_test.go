@@ -0,0 +1,188 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// captureProvider records the last request it received.
+type captureProvider struct {
+	messages []providers.Message
+	tools    []providers.ToolDefinition
+	opts     map[string]interface{}
+}
+
+func (p *captureProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	p.messages, p.tools, p.opts = messages, tools, opts
+	return &providers.LLMResponse{Content: "ok"}, nil
+}
+
+func (p *captureProvider) GetDefaultModel() string {
+	return "capture-model"
+}
+
+func newPersonaTestLoop(t *testing.T, provider providers.LLMProvider) *AgentLoop {
+	t.Helper()
+	formalTemp := 0.2
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 5,
+				Temperature:       0.7,
+			},
+			Personas: map[string]config.PersonaConfig{
+				"formal":  {SystemPrompt: "Answer formally.", Temperature: &formalTemp, Tools: []string{"web_fetch"}},
+				"playful": {SystemPrompt: "Be playful and use emoji."},
+			},
+			ChatPersonas: map[string]string{"telegram:work": "formal"},
+		},
+	}
+	return NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+}
+
+func TestPersona_ChatMappingAppliesPromptTemperatureAndTools(t *testing.T) {
+	provider := &captureProvider{}
+	al := newPersonaTestLoop(t, provider)
+
+	msg := bus.InboundMessage{Channel: "telegram", ChatID: "work", SenderID: "u", Content: "hello", SessionKey: "telegram:work"}
+	if _, err := al.processMessage(context.Background(), msg); err != nil {
+		t.Fatalf("processMessage() error: %v", err)
+	}
+
+	if !strings.Contains(provider.messages[0].Content, "Answer formally.") {
+		t.Error("system prompt missing persona instructions")
+	}
+	if provider.opts["temperature"] != 0.2 {
+		t.Errorf("temperature = %v, want 0.2", provider.opts["temperature"])
+	}
+	if len(provider.tools) != 1 || provider.tools[0].Function.Name != "web_fetch" {
+		t.Errorf("tools = %v, want only web_fetch", provider.tools)
+	}
+}
+
+func TestPersona_CommandSwitchesPerSession(t *testing.T) {
+	provider := &captureProvider{}
+	al := newPersonaTestLoop(t, provider)
+	ctx := context.Background()
+
+	family := bus.InboundMessage{Channel: "telegram", ChatID: "family", SenderID: "u", SessionKey: "telegram:family"}
+
+	family.Content = "/persona playful"
+	if resp, _ := al.processMessage(ctx, family); !strings.Contains(resp, "playful") {
+		t.Fatalf("switch response = %q", resp)
+	}
+
+	family.Content = "hi"
+	al.processMessage(ctx, family)
+	if !strings.Contains(provider.messages[0].Content, "Be playful") {
+		t.Error("selected persona not applied")
+	}
+	if provider.opts["temperature"] != 0.7 {
+		t.Errorf("temperature = %v, want default 0.7", provider.opts["temperature"])
+	}
+
+	family.Content = "/persona nope"
+	if resp, _ := al.processMessage(ctx, family); !strings.Contains(resp, "Unknown persona") {
+		t.Errorf("unknown persona response = %q", resp)
+	}
+
+	family.Content = "/persona default"
+	al.processMessage(ctx, family)
+	family.Content = "hi again"
+	al.processMessage(ctx, family)
+	if strings.Contains(provider.messages[0].Content, "# Persona") {
+		t.Error("persona still applied after reset")
+	}
+}
+
+// modelProvider records the model of each request.
+type modelProvider struct {
+	name   string
+	models []string
+}
+
+func (p *modelProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	p.models = append(p.models, model)
+	return &providers.LLMResponse{Content: p.name}, nil
+}
+
+func (p *modelProvider) GetDefaultModel() string {
+	return p.name
+}
+
+func TestRoutes(t *testing.T) {
+	defaultProvider := &modelProvider{name: "default"}
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 5,
+			},
+			Personas: map[string]config.PersonaConfig{
+				"support": {SystemPrompt: "Help customers."},
+				"monitor": {SystemPrompt: "Report on servers.", Model: "small-model"},
+			},
+			ChatPersonas: map[string]string{"slack:pinned": "monitor"},
+			Routes: []config.RouteConfig{
+				{Persona: "monitor", Keywords: []string{"alert", "uptime"}},
+				{Persona: "support", Channels: []string{"slack"}},
+				{Persona: "missing", Channels: []string{"discord"}},
+			},
+		},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), defaultProvider)
+	monitorProvider := &modelProvider{name: "monitor"}
+	al.personaProviders["monitor"] = monitorProvider
+
+	tests := []struct {
+		name    string
+		channel string
+		chatID  string
+		content string
+		want    string
+	}{
+		{"keyword", "telegram", "1", "Any ALERT from the web server?", "monitor"},
+		{"keyword needs whole word", "telegram", "1", "alerts are noisy", ""},
+		{"channel", "slack", "C1", "my order is late", "support"},
+		{"keyword before channel", "slack", "C1", "uptime?", "monitor"},
+		{"chat mapping before routes", "slack", "pinned", "my order is late", "monitor"},
+		{"unknown persona skipped", "discord", "1", "hello", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := al.resolvePersona(tt.channel+":"+tt.chatID, tt.channel, tt.chatID, tt.content)
+			got := ""
+			if p != nil {
+				got = p.name
+			}
+			if got != tt.want {
+				t.Errorf("persona = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// The monitor persona runs on its own provider and model
+	msg := bus.InboundMessage{Channel: "telegram", ChatID: "1", SenderID: "u", Content: "uptime report", SessionKey: "telegram:1"}
+	resp, err := al.processMessage(context.Background(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp != "monitor" || len(monitorProvider.models) != 1 || monitorProvider.models[0] != "small-model" {
+		t.Errorf("response = %q, monitor models = %v", resp, monitorProvider.models)
+	}
+
+	msg.Content = "hello"
+	if resp, _ := al.processMessage(context.Background(), msg); resp != "default" || defaultProvider.models[0] != "test-model" {
+		t.Errorf("response = %q, default models = %v", resp, defaultProvider.models)
+	}
+}
@@ -0,0 +1,36 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package agent
+
+import (
+	"github.com/sipeed/picoclaw/pkg/state"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// SetStateStore keeps preference memory in the shared state store, so it
+// survives restarts. Call it before Run.
+func (al *AgentLoop) SetStateStore(store state.Store) {
+	if al.preferences == nil {
+		return
+	}
+	al.preferences = al.preferences.WithStore(store)
+	al.tools.Register(tools.NewPreferencesTool(al.preferences))
+}
+
+// preferencesSection renders the sender's saved preferences for the system
+// prompt, or "" when there are none.
+func (al *AgentLoop) preferencesSection(channel, senderID string) string {
+	if al.preferences == nil || senderID == "" {
+		return ""
+	}
+	prefs := al.preferences.Get(al.preferences.Identity(channel, senderID))
+	if len(prefs) == 0 {
+		return ""
+	}
+	return "\n\n---\n\n# User Preferences\n\nThe user you are talking to has told you the following. Respect them unless asked otherwise, and keep them current with the preferences tool.\n\n" +
+		tools.FormatPreferences(prefs)
+}
@@ -0,0 +1,50 @@
+package agent
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestPreferencesInSystemPrompt(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "gpt-4o",
+				MaxTokens:         1024,
+				MaxToolIterations: 5,
+			},
+		},
+		Preferences: config.PreferencesConfig{
+			Enabled:    true,
+			Identities: map[string][]string{"alice": {"telegram:1", "discord:2"}},
+		},
+	}
+	provider := &captureProvider{}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+
+	if err := al.preferences.Set("alice", "timezone", "Europe/Berlin"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The linked Discord account sees preferences saved for the identity
+	msg := bus.InboundMessage{Channel: "discord", ChatID: "c1", SenderID: "2", SessionKey: "discord:c1", Content: "what time is it?"}
+	if _, err := al.processMessage(t.Context(), msg); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(provider.messages[0].Content, "- timezone: Europe/Berlin") {
+		t.Errorf("preferences missing from system prompt:\n%s", provider.messages[0].Content)
+	}
+
+	// An unlinked sender gets no preferences section
+	msg.SenderID = "3"
+	if _, err := al.processMessage(t.Context(), msg); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(provider.messages[0].Content, "User Preferences") {
+		t.Error("unexpected preferences section for unlinked sender")
+	}
+}
@@ -0,0 +1,70 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package agent
+
+import (
+	"context"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/history"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// maxQuoteLength caps the quoted text put in front of a message.
+const maxQuoteLength = 4000
+
+// SetHistory lets the agent look up quoted messages in the chat history
+// log when the channel only passed on their ID.
+func (al *AgentLoop) SetHistory(store *history.Store) {
+	al.history = store
+}
+
+// quotedText returns the text of the message msg quotes, or "".
+func (al *AgentLoop) quotedText(ctx context.Context, msg bus.InboundMessage) string {
+	quote := msg.Quote
+	if quote == nil {
+		return ""
+	}
+	if quote.Content != "" || al.history == nil || quote.MessageID == "" {
+		return quote.Content
+	}
+
+	m, found, err := al.history.Find(ctx, msg.Channel, msg.ChatID, quote.MessageID)
+	if err != nil {
+		logger.WarnCF("agent", "Failed to look up quoted message",
+			map[string]interface{}{"channel": msg.Channel, "message_id": quote.MessageID, "error": err.Error()})
+		return ""
+	}
+	if !found {
+		return ""
+	}
+	return m.Content
+}
+
+// withQuote puts the text msg quotes in front of content, so that "translate
+// this" in reply to a message has something to work on.
+func (al *AgentLoop) withQuote(ctx context.Context, msg bus.InboundMessage, content string) string {
+	quoted := strings.TrimSpace(al.quotedText(ctx, msg))
+	if quoted == "" {
+		return content
+	}
+	quoted = utils.Truncate(quoted, maxQuoteLength)
+	return "In reply to:\n> " + strings.ReplaceAll(quoted, "\n", "\n> ") + "\n\n" + content
+}
+
+// replyTarget returns the platform ID of the message the answer to msg
+// should reply to, or "". Only group chats get quoted replies: there
+// several conversations run at once, while in a direct chat the answer
+// plainly follows the question.
+func replyTarget(msg bus.InboundMessage) string {
+	if msg.Metadata["is_group"] != "true" {
+		return ""
+	}
+	return msg.Metadata["message_id"]
+}
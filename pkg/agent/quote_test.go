@@ -0,0 +1,81 @@
+package agent
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/history"
+)
+
+func TestQuotedReplies(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         dir,
+				Model:             "test-model",
+				MaxTokens:         1024,
+				MaxToolIterations: 5,
+			},
+		},
+	}
+	provider := &captureProvider{}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+
+	store, err := history.Open(filepath.Join(dir, "history.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	store.RecordInbound(bus.InboundMessage{Channel: "discord", ChatID: "c1", Content: "Wo ist der Bahnhof?",
+		Metadata: map[string]string{"message_id": "41"}})
+	al.SetHistory(store)
+
+	tests := []struct {
+		name  string
+		quote *bus.Quote
+		want  string // Expected user turn sent to the model
+	}{
+		{"no quote", nil, "translate this"},
+		{"quoted text", &bus.Quote{MessageID: "40", Content: "Bonjour\nà tous"},
+			"In reply to:\n> Bonjour\n> à tous\n\ntranslate this"},
+		{"from history", &bus.Quote{MessageID: "41"}, "In reply to:\n> Wo ist der Bahnhof?\n\ntranslate this"},
+		{"unknown", &bus.Quote{MessageID: "42"}, "translate this"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := al.processMessage(t.Context(), bus.InboundMessage{
+				Channel: "discord", ChatID: "c1", SenderID: "u1", SessionKey: "discord:" + tt.name,
+				Content: "translate this", Quote: tt.quote,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			last := provider.messages[len(provider.messages)-1]
+			quoted := strings.HasPrefix(tt.want, "In reply to")
+			if !strings.HasSuffix(last.Content, tt.want) || !quoted && strings.Contains(last.Content, "In reply to") {
+				t.Errorf("user turn = %q, want %q", last.Content, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplyTarget(t *testing.T) {
+	tests := []struct {
+		metadata map[string]string
+		want     string
+	}{
+		{map[string]string{"message_id": "m1", "is_group": "true"}, "m1"},
+		{map[string]string{"message_id": "m1", "is_group": "false"}, ""},
+		{map[string]string{"message_id": "m1"}, ""},
+		{map[string]string{"is_group": "true"}, ""},
+	}
+	for _, tt := range tests {
+		if got := replyTarget(bus.InboundMessage{Metadata: tt.metadata}); got != tt.want {
+			t.Errorf("replyTarget(%v) = %q, want %q", tt.metadata, got, tt.want)
+		}
+	}
+}
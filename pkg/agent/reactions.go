@@ -0,0 +1,145 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package agent
+
+import (
+	"context"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// What a reaction trigger does, see config.AgentDefaults.ReactionTriggers.
+const (
+	reactionSave   = "save"   // Save the message to the knowledge base
+	reactionRerun  = "rerun"  // Run the agent on it again
+	reactionDelete = "delete" // Delete the bot's message
+)
+
+// newReactionTriggers returns the configured triggers by emoji, leaving
+// out ones with an unknown action.
+func newReactionTriggers(configured map[string]string) map[string]string {
+	triggers := make(map[string]string, len(configured))
+	for emoji, action := range configured {
+		action = strings.ToLower(strings.TrimSpace(action))
+		switch action {
+		case reactionSave, reactionRerun, reactionDelete:
+			triggers[triggerEmoji(emoji)] = action
+		default:
+			logger.WarnCF("agent", "Ignoring reaction trigger with unknown action",
+				map[string]interface{}{"emoji": emoji, "action": action})
+		}
+	}
+	return triggers
+}
+
+// triggerEmoji drops the variation selectors some platforms add, so "❤️"
+// and "❤" are the same trigger.
+func triggerEmoji(emoji string) string {
+	return strings.ReplaceAll(strings.TrimSpace(emoji), "\uFE0F", "")
+}
+
+// reactionTrigger carries out the trigger a reaction that stands for no
+// command is configured as. A rerun returns the message to run the agent
+// on; the other actions are done here, and return false.
+func (al *AgentLoop) reactionTrigger(ctx context.Context, msg bus.InboundMessage) (bus.InboundMessage, bool) {
+	r := msg.Reaction
+	fields := map[string]interface{}{"channel": msg.Channel, "chat_id": msg.ChatID, "emoji": r.Emoji}
+	action := al.reactionTriggers[triggerEmoji(r.Emoji)]
+	if r.Remove || action == "" {
+		logger.DebugCF("agent", "Ignoring reaction", fields)
+		return msg, false
+	}
+	fields["action"] = action
+	logger.InfoCF("agent", "Reaction trigger", fields)
+
+	switch action {
+	case reactionSave:
+		al.publishResponse(msg.Channel, msg.ChatID, "", al.saveReacted(ctx, msg))
+	case reactionRerun:
+		prompt := al.reactedText(ctx, msg)
+		if prompt == "" || r.On == bus.ReactionOnBot {
+			// Rerunning a reply runs the question behind it again
+			prompt, _, _ = al.sessions.LastExchange(msg.SessionKey)
+		}
+		if strings.TrimSpace(prompt) == "" {
+			al.publishResponse(msg.Channel, msg.ChatID, "", t(msg, "reaction.not_found"))
+			return msg, false
+		}
+		return rerunMessage(msg, prompt), true
+	case reactionDelete:
+		// Only the bot's own messages, where the channel can tell
+		if r.On != bus.ReactionOnBot || r.MessageID == "" {
+			logger.DebugCF("agent", "Not deleting a message that is not the bot's", fields)
+			return msg, false
+		}
+		al.bus.PublishOutbound(bus.OutboundMessage{Channel: msg.Channel, ChatID: msg.ChatID, Delete: r.MessageID})
+	}
+	return msg, false
+}
+
+// saveReacted saves the message reacted to in the knowledge base, under
+// its chat and message ID, and returns the reply confirming it.
+func (al *AgentLoop) saveReacted(ctx context.Context, msg bus.InboundMessage) string {
+	if al.knowledgeStore == nil {
+		return t(msg, "reaction.no_knowledge")
+	}
+	text := al.reactedText(ctx, msg)
+	if text == "" && msg.Reaction.On != bus.ReactionOnUser {
+		// The channel does not give the text of the bot's replies, so it
+		// is taken to be the latest one
+		_, text, _ = al.sessions.LastExchange(msg.SessionKey)
+	}
+	if strings.TrimSpace(text) == "" {
+		return t(msg, "reaction.not_found")
+	}
+
+	title := msg.Channel + "/" + msg.ChatID + "/" + msg.Reaction.MessageID
+	if _, err := al.knowledgeStore.AddDocument(ctx, "chat:"+title, text); err != nil {
+		logger.WarnCF("agent", "Failed to save reacted message",
+			map[string]interface{}{"channel": msg.Channel, "chat_id": msg.ChatID, "error": err.Error()})
+		return t(msg, "reaction.save_failed", err)
+	}
+	return t(msg, "reaction.saved")
+}
+
+// reactedText returns the text of the message reacted to: as the channel
+// passed it on, or as found in the chat history or the session, or "".
+func (al *AgentLoop) reactedText(ctx context.Context, msg bus.InboundMessage) string {
+	r := msg.Reaction
+	if r.Text != "" || r.MessageID == "" {
+		return r.Text
+	}
+	if al.history != nil {
+		m, found, err := al.history.Find(ctx, msg.Channel, msg.ChatID, r.MessageID)
+		if err != nil {
+			logger.WarnCF("agent", "Failed to look up reacted message",
+				map[string]interface{}{"channel": msg.Channel, "message_id": r.MessageID, "error": err.Error()})
+		} else if found {
+			return m.Content
+		}
+	}
+	content, _ := al.recent.find(msg.SessionKey, r.MessageID)
+	return content
+}
+
+// rerunMessage is msg, a reaction, turned into the user asking prompt.
+func rerunMessage(msg bus.InboundMessage, prompt string) bus.InboundMessage {
+	metadata := make(map[string]string, len(msg.Metadata))
+	for k, v := range msg.Metadata {
+		switch k {
+		case "reaction", "reaction_removed", "message_id":
+		default:
+			metadata[k] = v
+		}
+	}
+	msg.Content = prompt
+	msg.Metadata = metadata
+	msg.Reaction = nil
+	return msg
+}
@@ -0,0 +1,115 @@
+package agent
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/rag"
+)
+
+func TestReactionTriggers(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         dir,
+				Model:             "test-model",
+				MaxTokens:         1024,
+				MaxToolIterations: 5,
+				ReactionTriggers: map[string]string{
+					"📌":  "save",
+					"🔁":  "Rerun",
+					"❌️": "delete",
+					"👀":  "shout",
+				},
+			},
+		},
+	}
+	msgBus := bus.NewMessageBus()
+	provider := &captureProvider{}
+	al := NewAgentLoop(cfg, msgBus, provider)
+	if _, ok := al.reactionTriggers["👀"]; ok || len(al.reactionTriggers) != 3 {
+		t.Fatalf("triggers = %v, want the unknown action left out", al.reactionTriggers)
+	}
+
+	store, err := rag.Open(filepath.Join(dir, "rag.db"), wordEmbedder{}, rag.Options{ChunkSize: 200})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	ctx := context.Background()
+	base := bus.InboundMessage{Channel: "telegram", ChatID: "c1", SenderID: "u1", SessionKey: "telegram:c1"}
+	react := func(emoji, messageID, on string) {
+		t.Helper()
+		msg := base
+		msg.Metadata = map[string]string{"reaction": emoji, "message_id": messageID}
+		msg.Reaction = &bus.Reaction{MessageID: messageID, Emoji: emoji, On: on}
+		al.handleInbound(ctx, msg)
+	}
+	outbound := func() []bus.OutboundMessage {
+		var out []bus.OutboundMessage
+		for {
+			msg, ok := msgBus.TryConsumeOutbound()
+			if !ok {
+				return out
+			}
+			out = append(out, msg)
+		}
+	}
+
+	question := base
+	question.Content = "the gate code is 4321"
+	question.Metadata = map[string]string{"message_id": "5"}
+	al.handleInbound(ctx, question)
+	outbound()
+
+	react("📌", "5", bus.ReactionOnUser)
+	if out := outbound(); len(out) != 1 || !strings.Contains(out[0].Content, "not enabled") {
+		t.Errorf("save without a knowledge base sent %+v", out)
+	}
+	al.SetKnowledgeStore(store)
+	react("📌", "5", bus.ReactionOnUser)
+	if out := outbound(); len(out) != 1 || !strings.Contains(out[0].Content, "Saved") {
+		t.Errorf("save sent %+v", out)
+	}
+	if results, err := store.Search(ctx, "gate code", 1); err != nil || len(results) != 1 ||
+		results[0].Content != "the gate code is 4321" || results[0].Source != "chat:telegram/c1/5" {
+		t.Errorf("knowledge base = %+v, %v", results, err)
+	}
+
+	// Only the bot's own messages are deleted
+	react("❌", "5", bus.ReactionOnUser)
+	react("❌", "9", "")
+	if out := outbound(); len(out) != 0 {
+		t.Errorf("deleted a message not known to be the bot's: %+v", out)
+	}
+	react("❌", "9", bus.ReactionOnBot)
+	if out := outbound(); len(out) != 1 || out[0].Delete != "9" || out[0].ChatID != "c1" {
+		t.Errorf("delete sent %+v", out)
+	}
+
+	// Rerunning a reply asks its question again
+	provider.messages = nil
+	react("🔁", "9", bus.ReactionOnBot)
+	if n := len(provider.messages); n == 0 || provider.messages[n-1].Content != "the gate code is 4321" {
+		t.Fatalf("rerun asked %+v", provider.messages)
+	}
+	if out := outbound(); len(out) != 1 || out[0].Content != "ok" {
+		t.Errorf("rerun replied %+v", out)
+	}
+
+	// Removing a reaction, or one that is no trigger, does nothing
+	provider.messages = nil
+	msg := base
+	msg.Reaction = &bus.Reaction{MessageID: "9", Emoji: "🔁", Remove: true}
+	al.handleInbound(ctx, msg)
+	react("👀", "9", bus.ReactionOnBot)
+	if len(provider.messages) != 0 || len(outbound()) != 0 {
+		t.Error("a removed or unconfigured reaction triggered something")
+	}
+}
@@ -0,0 +1,80 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package agent
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// streamUpdateInterval throttles partial updates so channels that edit a
+// message in place stay well within their API rate limits.
+const streamUpdateInterval = time.Second
+
+// streamRelay accumulates streamed tokens and periodically publishes the
+// text so far as a partial outbound message.
+type streamRelay struct {
+	bus      *bus.MessageBus
+	channel  string
+	chatID   string
+	buf      strings.Builder
+	lastSent time.Time
+	sentLen  int
+}
+
+func newStreamRelay(msgBus *bus.MessageBus, channel, chatID string) *streamRelay {
+	return &streamRelay{
+		bus:      msgBus,
+		channel:  channel,
+		chatID:   chatID,
+		lastSent: time.Now(),
+	}
+}
+
+func (r *streamRelay) onDelta(delta string) {
+	r.buf.WriteString(delta)
+	if time.Since(r.lastSent) < streamUpdateInterval {
+		return
+	}
+
+	content := r.buf.String()
+	if len(content) == r.sentLen || strings.TrimSpace(content) == "" {
+		return
+	}
+
+	r.bus.PublishOutbound(bus.OutboundMessage{
+		Channel: r.channel,
+		ChatID:  r.chatID,
+		Content: content,
+		Partial: true,
+	})
+	r.lastSent = time.Now()
+	r.sentLen = len(content)
+}
+
+// callLLM sends one request to the provider, streaming partial output to the
+// originating chat when streaming is enabled and supported.
+func (al *AgentLoop) callLLM(ctx context.Context, messages []providers.Message, toolDefs []providers.ToolDefinition, opts processOptions) (*providers.LLMResponse, error) {
+	options := map[string]interface{}{
+		"max_tokens":  al.maxTokens,
+		"temperature": al.temperatureFor(opts.Persona),
+	}
+
+	provider, model := al.providerFor(opts.Persona), al.modelFor(opts.Persona)
+	sp, ok := provider.(providers.StreamingProvider)
+	if !opts.Stream || !ok || constants.IsInternalChannel(opts.Channel) {
+		return provider.Chat(ctx, messages, toolDefs, model, options)
+	}
+
+	relay := newStreamRelay(al.bus, opts.Channel, opts.ChatID)
+	return sp.ChatStream(ctx, messages, toolDefs, model, options, relay.onDelta)
+}
@@ -0,0 +1,59 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package agent
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/commands"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// threadCommand implements "/new", which archives the chat's conversation
+// and starts a fresh one, and "/reset", which discards it.
+func (al *AgentLoop) threadCommand(ctx context.Context, req commands.Request) string {
+	msg := req.Msg
+	al.awaitSummary(msg.SessionKey)
+
+	response := t(msg, "thread.reset")
+	if req.Name == "new" {
+		archived, err := al.archiveConversation(msg.SessionKey)
+		if err != nil {
+			logger.WarnCF("agent", "Failed to archive conversation",
+				map[string]interface{}{"session_key": msg.SessionKey, "error": err.Error()})
+			return t(msg, "thread.archive_failed")
+		}
+		response = t(msg, "thread.new")
+		if archived {
+			response += t(msg, "thread.archived")
+		}
+	}
+
+	al.sessions.Reset(msg.SessionKey)
+	al.sessions.Save(msg.SessionKey)
+	return response
+}
+
+// awaitSummary lets a running summarization of the session finish, so it
+// cannot rewrite a conversation that is being replaced.
+func (al *AgentLoop) awaitSummary(sessionKey string) {
+	for {
+		if _, busy := al.summarizing.Load(sessionKey); !busy {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// archiveConversation copies the session's conversation to a timestamped
+// key. It reports false when there was nothing to archive.
+func (al *AgentLoop) archiveConversation(sessionKey string) (bool, error) {
+	archiveKey := fmt.Sprintf("%s@%s", sessionKey, time.Now().Format("20060102-150405"))
+	return al.sessions.Archive(sessionKey, archiveKey)
+}
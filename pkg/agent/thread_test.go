@@ -0,0 +1,64 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestThreadCommands(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         1024,
+				MaxToolIterations: 5,
+			},
+		},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &simpleMockProvider{response: "ok"})
+	ctx := context.Background()
+	msg := bus.InboundMessage{Channel: "slack", ChatID: "C1/1700.1", SenderID: "u1", SessionKey: "slack:C1#1700.1"}
+
+	steps := []struct {
+		content     string
+		wantReply   string
+		wantHistory int
+	}{
+		{"hello", "ok", 2},
+		{"/new", "Started a new conversation. The previous one was archived.", 0},
+		{"/new", "Started a new conversation.", 0},
+		{"hi again", "ok", 2},
+		{"/reset", "Conversation reset. Starting fresh.", 0},
+	}
+
+	for _, step := range steps {
+		msg.Content = step.content
+		got, err := al.processMessage(ctx, msg)
+		if err != nil {
+			t.Fatalf("%s: %v", step.content, err)
+		}
+		if got != step.wantReply {
+			t.Errorf("%s: reply = %q, want %q", step.content, got, step.wantReply)
+		}
+		if n := len(al.sessions.GetHistory(msg.SessionKey)); n != step.wantHistory {
+			t.Errorf("%s: history has %d messages, want %d", step.content, n, step.wantHistory)
+		}
+	}
+
+	// Exactly one archive file holds the first conversation
+	archives, _ := filepath.Glob(filepath.Join(cfg.WorkspacePath(), "sessions", "slack_C1#1700.1@*.json"))
+	if len(archives) != 1 {
+		t.Fatalf("found %d archives, want 1", len(archives))
+	}
+	data, _ := os.ReadFile(archives[0])
+	if !strings.Contains(string(data), "hello") {
+		t.Errorf("archive does not contain the first conversation: %s", data)
+	}
+}
@@ -0,0 +1,189 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/commands"
+	"github.com/sipeed/picoclaw/pkg/i18n"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// translationEnabled reports whether a chat's messages are translated. The
+// chat's /translate setting wins over the configured per-chat setting, which
+// wins over the global default.
+func (al *AgentLoop) translationEnabled(sessionKey, channel, chatID string) bool {
+	switch al.sessions.GetTranslate(sessionKey) {
+	case "on":
+		return true
+	case "off":
+		return false
+	}
+	if on, ok := al.translation.Chats[channel+":"+chatID]; ok {
+		return on
+	}
+	return al.translation.Enabled
+}
+
+// translateInbound detects the language of msg and, when it differs from
+// the language the agent works in, translates it. It returns the text for
+// the agent and the language to reply in, which is "" when the reply needs
+// no translation. Failures fall back to the original text.
+func (al *AgentLoop) translateInbound(ctx context.Context, msg bus.InboundMessage) (string, string) {
+	if !al.translationEnabled(msg.SessionKey, msg.Channel, msg.ChatID) || !strings.ContainsFunc(msg.Content, unicode.IsLetter) {
+		return msg.Content, ""
+	}
+	opts := processOptions{Channel: msg.Channel, ChatID: msg.ChatID, SenderID: msg.SenderID}
+
+	lang, err := al.detectLanguage(ctx, msg.Content, opts)
+	if err != nil {
+		logger.WarnCF("agent", "Language detection failed",
+			map[string]interface{}{"session_key": msg.SessionKey, "error": err.Error()})
+		return msg.Content, ""
+	}
+	if lang == al.translation.Language {
+		return msg.Content, ""
+	}
+
+	// A /lang setting already tells the model which language to answer in
+	replyLang := lang
+	if al.sessions.GetLanguage(msg.SessionKey) != "" {
+		replyLang = ""
+	}
+
+	translated, err := al.translate(ctx, msg.Content, lang, al.translation.Language, opts)
+	if err != nil {
+		logger.WarnCF("agent", "Inbound translation failed",
+			map[string]interface{}{"session_key": msg.SessionKey, "language": lang, "error": err.Error()})
+		return msg.Content, replyLang
+	}
+	logger.DebugCF("agent", "Translated inbound message",
+		map[string]interface{}{"session_key": msg.SessionKey, "from": lang, "to": al.translation.Language})
+	return translated, replyLang
+}
+
+// translateReply translates the agent's reply into lang. On failure the
+// untranslated reply is sent rather than nothing.
+func (al *AgentLoop) translateReply(ctx context.Context, msg bus.InboundMessage, reply, lang string) string {
+	if strings.TrimSpace(reply) == "" {
+		return reply
+	}
+	opts := processOptions{Channel: msg.Channel, ChatID: msg.ChatID, SenderID: msg.SenderID}
+	translated, err := al.translate(ctx, reply, al.translation.Language, lang, opts)
+	if err != nil {
+		logger.WarnCF("agent", "Reply translation failed",
+			map[string]interface{}{"session_key": msg.SessionKey, "language": lang, "error": err.Error()})
+		return reply
+	}
+	return translated
+}
+
+// replyLanguage returns the language to answer msg in when the agent
+// follows the user's language: the one msg is written in, or the one the
+// user last wrote in when msg is too short to tell. It is "" when matching
+// is off, the chat set a language with /lang, or translation takes care
+// of the reply's language.
+func (al *AgentLoop) replyLanguage(msg bus.InboundMessage) string {
+	if !al.matchLanguage || al.sessions.GetLanguage(msg.SessionKey) != "" ||
+		al.translationEnabled(msg.SessionKey, msg.Channel, msg.ChatID) {
+		return ""
+	}
+	lang := i18n.Detect(msg.Content)
+	if lang == "" {
+		return al.sessions.GetDetectedLanguage(msg.SessionKey)
+	}
+	al.sessions.SetDetectedLanguage(msg.SessionKey, lang)
+	return lang
+}
+
+// detectLanguage returns the ISO 639-1 code of text's language.
+func (al *AgentLoop) detectLanguage(ctx context.Context, text string, opts processOptions) (string, error) {
+	var lang string
+	var err error
+	if al.translator != nil {
+		lang, err = al.translator.Detect(ctx, text)
+	} else {
+		lang, err = al.complete(ctx,
+			"Identify the language of the user's message. Answer with only its two-letter ISO 639-1 code, such as en, de, or es.",
+			text, opts)
+	}
+	if err != nil {
+		return "", err
+	}
+	code := normalizeLanguage(lang)
+	if code == "" {
+		return "", fmt.Errorf("unrecognized language %q", lang)
+	}
+	return code, nil
+}
+
+// translate translates text between ISO 639-1 languages.
+func (al *AgentLoop) translate(ctx context.Context, text, from, to string, opts processOptions) (string, error) {
+	if al.translator != nil {
+		return al.translator.Translate(ctx, text, from, to)
+	}
+	system := fmt.Sprintf("Translate the user's message from the language with ISO 639-1 code %q into the language with code %q. "+
+		"Keep the formatting, code, URLs, and names unchanged. Answer with only the translation.", from, to)
+	return al.complete(ctx, system, text, opts)
+}
+
+// normalizeLanguage reduces a language tag such as "EN-us", "pt_BR", or
+// "de." to its lowercase primary subtag. It returns "" for anything that is
+// not a single two- or three-letter code.
+func normalizeLanguage(tag string) string {
+	fields := strings.Fields(tag)
+	if len(fields) != 1 {
+		return ""
+	}
+	code := strings.ToLower(strings.TrimFunc(fields[0], func(r rune) bool { return !unicode.IsLetter(r) }))
+	if i := strings.IndexAny(code, "-_"); i >= 0 {
+		code = code[:i]
+	}
+	if len(code) < 2 || len(code) > 3 {
+		return ""
+	}
+	for _, r := range code {
+		if r < 'a' || r > 'z' {
+			return ""
+		}
+	}
+	return code
+}
+
+// translateCommand implements "/translate on|off|default".
+func (al *AgentLoop) translateCommand(ctx context.Context, req commands.Request) string {
+	msg := req.Msg
+	if len(req.Args) != 1 {
+		state := t(msg, "translate.state_off")
+		if al.translationEnabled(msg.SessionKey, msg.Channel, msg.ChatID) {
+			state = t(msg, "translate.state_on")
+		}
+		return t(msg, "translate.status", state, al.translation.Language)
+	}
+
+	switch strings.ToLower(req.Args[0]) {
+	case "on":
+		al.sessions.SetTranslate(msg.SessionKey, "on")
+	case "off":
+		al.sessions.SetTranslate(msg.SessionKey, "off")
+	case "default", "reset":
+		al.sessions.SetTranslate(msg.SessionKey, "")
+	default:
+		return t(msg, "translate.usage")
+	}
+	al.sessions.Save(msg.SessionKey)
+
+	if al.translationEnabled(msg.SessionKey, msg.Channel, msg.ChatID) {
+		return t(msg, "translate.on")
+	}
+	return t(msg, "translate.off")
+}
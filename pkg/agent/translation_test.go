@@ -0,0 +1,227 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// translatingProvider detects "Hallo" as German, marks translations with
+// their target language, and otherwise answers the user's message.
+type translatingProvider struct {
+	detections int
+}
+
+var targetLanguage = regexp.MustCompile(`into the language with code "(\w+)"`)
+
+func (p *translatingProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	system, user := messages[0].Content, messages[len(messages)-1].Content
+	switch {
+	case strings.HasPrefix(system, "Identify the language"):
+		p.detections++
+		if strings.Contains(user, "Hallo") {
+			return &providers.LLMResponse{Content: "de"}, nil
+		}
+		return &providers.LLMResponse{Content: "en."}, nil
+	case strings.HasPrefix(system, "Translate"):
+		to := targetLanguage.FindStringSubmatch(system)[1]
+		return &providers.LLMResponse{Content: fmt.Sprintf("[%s] %s", to, user)}, nil
+	default:
+		return &providers.LLMResponse{Content: "answer to: " + user}, nil
+	}
+}
+
+func (p *translatingProvider) GetDefaultModel() string {
+	return "translating"
+}
+
+func newTranslationTestLoop(t *testing.T, tc config.TranslationConfig) (*AgentLoop, *translatingProvider) {
+	t.Helper()
+	provider := &translatingProvider{}
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         1024,
+				MaxToolIterations: 5,
+			},
+		},
+		Translation: tc,
+	}
+	return NewAgentLoop(cfg, bus.NewMessageBus(), provider), provider
+}
+
+func TestTranslation(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     config.TranslationConfig
+		translate  string // /translate argument sent first, if any
+		content    string
+		want       string
+		detections int
+	}{
+		{
+			name:    "disabled",
+			content: "Hallo",
+			want:    "answer to: Hallo",
+		},
+		{
+			name:       "foreign message",
+			config:     config.TranslationConfig{Enabled: true},
+			content:    "Hallo",
+			want:       "[de] answer to: [en] Hallo",
+			detections: 1,
+		},
+		{
+			name:       "working language",
+			config:     config.TranslationConfig{Enabled: true},
+			content:    "Hello",
+			want:       "answer to: Hello",
+			detections: 1,
+		},
+		{
+			name:    "no letters",
+			config:  config.TranslationConfig{Enabled: true},
+			content: "42 :)",
+			want:    "answer to: 42 :)",
+		},
+		{
+			name:       "enabled for this chat",
+			config:     config.TranslationConfig{Chats: map[string]bool{"telegram:c1": true}},
+			content:    "Hallo",
+			want:       "[de] answer to: [en] Hallo",
+			detections: 1,
+		},
+		{
+			name:      "turned off by command",
+			config:    config.TranslationConfig{Enabled: true},
+			translate: "off",
+			content:   "Hallo",
+			want:      "answer to: Hallo",
+		},
+		{
+			name:       "turned on by command",
+			config:     config.TranslationConfig{Chats: map[string]bool{"telegram:c1": false}},
+			translate:  "on",
+			content:    "Hallo",
+			want:       "[de] answer to: [en] Hallo",
+			detections: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			al, provider := newTranslationTestLoop(t, tt.config)
+			msg := bus.InboundMessage{Channel: "telegram", ChatID: "c1", SenderID: "u1", SessionKey: "telegram:c1"}
+
+			if tt.translate != "" {
+				msg.Content = "/translate " + tt.translate
+				if _, err := al.processMessage(t.Context(), msg); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			msg.Content = tt.content
+			got, err := al.processMessage(t.Context(), msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("reply = %q, want %q", got, tt.want)
+			}
+			if provider.detections != tt.detections {
+				t.Errorf("detections = %d, want %d", provider.detections, tt.detections)
+			}
+		})
+	}
+}
+
+func TestTranslationKeepsLangSetting(t *testing.T) {
+	al, _ := newTranslationTestLoop(t, config.TranslationConfig{Enabled: true})
+	msg := bus.InboundMessage{Channel: "telegram", ChatID: "c1", SenderID: "u1", SessionKey: "telegram:c1"}
+	al.sessions.SetLanguage(msg.SessionKey, "French")
+
+	// The model is told to answer in French, so the reply is not translated
+	msg.Content = "Hallo"
+	got, err := al.processMessage(t.Context(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "answer to: [en] Hallo" {
+		t.Errorf("reply = %q", got)
+	}
+}
+
+func TestReplyLanguageMatching(t *testing.T) {
+	provider := &captureProvider{}
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         1024,
+				MaxToolIterations: 5,
+				MatchLanguage:     true,
+			},
+		},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+	system := func(content string) string {
+		t.Helper()
+		_, err := al.processMessage(t.Context(), bus.InboundMessage{
+			Channel: "telegram", ChatID: "c1", SenderID: "u1", SessionKey: "telegram:c1", Content: content,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return provider.messages[0].Content
+	}
+
+	if got := system("Wie spät ist es in Tokio?"); !strings.Contains(got, "Reply in German unless") {
+		t.Error("detected language missing from system prompt")
+	}
+	// Too short to tell, so the last language sticks
+	if got := system("ok"); !strings.Contains(got, "Reply in German unless") {
+		t.Error("short message dropped the user's language")
+	}
+	if got := system("What time is it in Tokyo?"); !strings.Contains(got, "Reply in English unless") {
+		t.Error("language not switched with the user's")
+	}
+
+	// /lang wins over the detected language
+	al.sessions.SetLanguage("telegram:c1", "French")
+	if got := system("Wie spät ist es in Tokio?"); !strings.Contains(got, "Always reply in French") || strings.Contains(got, "German") {
+		t.Error("/lang setting not kept")
+	}
+
+	al.sessions.SetLanguage("telegram:c1", "")
+	al.matchLanguage = false
+	if got := system("Wie spät ist es in Tokio?"); strings.Contains(got, "Reply Language") {
+		t.Error("language matched with matching off")
+	}
+}
+
+func TestNormalizeLanguage(t *testing.T) {
+	tests := map[string]string{
+		"de":             "de",
+		"EN-us":          "en",
+		"pt_BR":          "pt",
+		" es.\n":         "es",
+		"fil":            "fil",
+		"German":         "",
+		"":               "",
+		"The answer: de": "",
+	}
+	for in, want := range tests {
+		if got := normalizeLanguage(in); got != want {
+			t.Errorf("normalizeLanguage(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/commands"
+	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tools"
+	"github.com/sipeed/picoclaw/pkg/usage"
+)
+
+// SetUsageTracker enables usage accounting. userBudget and chatBudget are
+// monthly USD limits; 0 disables a limit. Model calls the summarize tool
+// makes are accounted and limited too.
+func (al *AgentLoop) SetUsageTracker(tracker *usage.Tracker, userBudget, chatBudget float64) {
+	al.usage = tracker
+	al.userBudget = userBudget
+	al.chatBudget = chatBudget
+	if tool, ok := al.tools.Get("summarize"); ok {
+		if st, ok := tool.(*tools.SummarizeTool); ok {
+			st.SetUsageMeter(toolUsage{al})
+		}
+	}
+}
+
+// toolUsage charges tools' model calls through the agent's usage path.
+type toolUsage struct {
+	al *AgentLoop
+}
+
+func (u toolUsage) CheckBudget(channel, chatID, senderID string) error {
+	if refusal, over := u.al.checkBudget(bus.InboundMessage{Channel: channel, ChatID: chatID, SenderID: senderID}); over {
+		return errors.New(refusal)
+	}
+	return nil
+}
+
+func (u toolUsage) RecordLLM(channel, chatID, senderID, model string, messages []providers.Message, resp *providers.LLMResponse) {
+	u.al.recordModelUsage(channel, chatID, senderID, model, messages, nil, resp)
+}
+
+// recordLLMUsage records one LLM call of the agent loop.
+func (al *AgentLoop) recordLLMUsage(opts processOptions, messages []providers.Message, toolDefs []providers.ToolDefinition, resp *providers.LLMResponse) {
+	al.recordModelUsage(opts.Channel, opts.ChatID, opts.SenderID, al.modelFor(opts.Persona), messages, toolDefs, resp)
+}
+
+// recordModelUsage records one call to model for a sender in a chat.
+// Providers that do not report usage are charged the local token estimate.
+func (al *AgentLoop) recordModelUsage(channel, chatID, senderID, model string, messages []providers.Message, toolDefs []providers.ToolDefinition, resp *providers.LLMResponse) {
+	if al.usage == nil || resp == nil {
+		return
+	}
+	var prompt, completion int
+	if resp.Usage != nil {
+		prompt, completion = resp.Usage.PromptTokens, resp.Usage.CompletionTokens
+	} else {
+		prompt = countTokens(model, messages) + countToolTokens(model, toolDefs)
+		completion = countMessageTokens(model, providers.Message{Role: "assistant", Content: resp.Content})
+	}
+
+	if err := al.usage.RecordLLM(channel, chatID, senderID, model, prompt, completion); err != nil {
+		logger.WarnCF("agent", "Failed to record usage", map[string]interface{}{"error": err.Error()})
+	}
+}
+
+// recordTranscriptionUsage records audio the channel transcribed for msg.
+func (al *AgentLoop) recordTranscriptionUsage(msg bus.InboundMessage) {
+	if al.usage == nil {
+		return
+	}
+	seconds, err := strconv.ParseFloat(msg.Metadata["transcription_seconds"], 64)
+	if err != nil || seconds <= 0 {
+		return
+	}
+	if err := al.usage.RecordTranscription(msg.Channel, msg.ChatID, msg.SenderID, seconds); err != nil {
+		logger.WarnCF("agent", "Failed to record usage", map[string]interface{}{"error": err.Error()})
+	}
+}
+
+// checkBudget returns a refusal when the sender or the chat has used up its
+// monthly budget. Internal channels are never limited.
+func (al *AgentLoop) checkBudget(msg bus.InboundMessage) (string, bool) {
+	if al.usage == nil || constants.IsInternalChannel(msg.Channel) {
+		return "", false
+	}
+
+	if al.userBudget > 0 {
+		tot, err := al.usage.SenderMonth(msg.Channel, msg.SenderID)
+		if err == nil && tot.Cost >= al.userBudget {
+			return t(msg, "budget.user", tot.Cost, al.userBudget), true
+		}
+	}
+	if al.chatBudget > 0 {
+		tot, err := al.usage.ChatMonth(msg.Channel, msg.ChatID)
+		if err == nil && tot.Cost >= al.chatBudget {
+			return t(msg, "budget.chat", tot.Cost, al.chatBudget), true
+		}
+	}
+	return "", false
+}
+
+// usageCommand implements "/usage".
+func (al *AgentLoop) usageCommand(ctx context.Context, req commands.Request) string {
+	msg := req.Msg
+	if al.usage == nil {
+		return t(msg, "usage.disabled")
+	}
+
+	user, err := al.usage.SenderMonth(msg.Channel, msg.SenderID)
+	if err != nil {
+		return t(msg, "usage.failed", err)
+	}
+	chat, err := al.usage.ChatMonth(msg.Channel, msg.ChatID)
+	if err != nil {
+		return t(msg, "usage.failed", err)
+	}
+
+	var sb strings.Builder
+	sb.WriteString(t(msg, "usage.header") + "\n")
+	sb.WriteString(formatTotals(msg, t(msg, "usage.you"), user, al.userBudget))
+	sb.WriteString(formatTotals(msg, t(msg, "usage.chat"), chat, al.chatBudget))
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+func formatTotals(msg bus.InboundMessage, label string, tot usage.Totals, budget float64) string {
+	line := t(msg, "usage.line", label, tot.Requests, tot.PromptTokens, tot.CompletionTokens)
+	if tot.AudioSeconds > 0 {
+		line += t(msg, "usage.audio", tot.AudioSeconds/60)
+	}
+	line += fmt.Sprintf(", $%.4f", tot.Cost)
+	if budget > 0 {
+		line += t(msg, "usage.budget", budget)
+	}
+	return line + "\n"
+}
@@ -0,0 +1,107 @@
+package agent
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/usage"
+)
+
+func TestUsageBudgetsAndCommand(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "gpt-4o",
+				MaxTokens:         1024,
+				MaxToolIterations: 5,
+			},
+		},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &simpleMockProvider{response: "hi"})
+
+	tracker, err := usage.Open(filepath.Join(t.TempDir(), "usage.db"), usage.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tracker.Close()
+	al.SetUsageTracker(tracker, 0.01, 0)
+
+	msg := bus.InboundMessage{Channel: "telegram", ChatID: "c1", SenderID: "alice", SessionKey: "telegram:c1", Content: "hello"}
+	if refusal, over := al.checkBudget(msg); over {
+		t.Fatalf("unexpected refusal before any usage: %s", refusal)
+	}
+
+	// The mock reports no usage, so the estimate is recorded
+	if _, err := al.processMessage(t.Context(), msg); err != nil {
+		t.Fatal(err)
+	}
+	tot, _ := tracker.SenderMonth("telegram", "alice")
+	if tot.Requests != 1 || tot.PromptTokens == 0 {
+		t.Fatalf("LLM call not recorded: %+v", tot)
+	}
+
+	// 10k output tokens of gpt-4o cost $0.10, over the $0.01 budget
+	tracker.RecordLLM("telegram", "c1", "alice", "gpt-4o", 0, 10000)
+	resp, err := al.processMessage(t.Context(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(resp, "usage budget") {
+		t.Errorf("expected budget refusal, got %q", resp)
+	}
+
+	// Other senders and /usage still work
+	bob := msg
+	bob.SenderID = "bob"
+	if _, over := al.checkBudget(bob); over {
+		t.Errorf("bob should not be over budget")
+	}
+	msg.Content = "/usage"
+	resp, _ = al.processMessage(t.Context(), msg)
+	if !strings.Contains(resp, "You: 2 requests") || !strings.Contains(resp, "of $0.01 budget") {
+		t.Errorf("unexpected /usage output: %q", resp)
+	}
+}
+
+func TestSummarizeToolUsage(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "gpt-4o",
+				MaxTokens:         1024,
+				MaxToolIterations: 5,
+			},
+		},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &simpleMockProvider{response: "summary"})
+	tracker, err := usage.Open(filepath.Join(t.TempDir(), "usage.db"), usage.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tracker.Close()
+	al.SetUsageTracker(tracker, 0.01, 0)
+	al.updateToolContexts("telegram", "c1", "alice", "")
+
+	args := map[string]interface{}{"text": "A short note."}
+	if result := al.tools.ExecuteWithContext(t.Context(), "summarize", args, "telegram", "c1", nil); result.IsError {
+		t.Fatalf("summarize: %s", result.ForLLM)
+	}
+	if tot, _ := tracker.SenderMonth("telegram", "alice"); tot.Requests != 1 || tot.PromptTokens == 0 {
+		t.Fatalf("summarize call not recorded: %+v", tot)
+	}
+
+	// Over budget, the tool makes no more calls
+	tracker.RecordLLM("telegram", "c1", "alice", "gpt-4o", 0, 10000)
+	result := al.tools.ExecuteWithContext(t.Context(), "summarize", args, "telegram", "c1", nil)
+	if !result.IsError || !strings.Contains(result.ForLLM, "usage budget") {
+		t.Errorf("summarize over budget = %q", result.ForLLM)
+	}
+	if tot, _ := tracker.SenderMonth("telegram", "alice"); tot.Requests != 2 {
+		t.Errorf("requests = %d, want the refused call not charged", tot.Requests)
+	}
+}
@@ -0,0 +1,48 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package agent
+
+import (
+	"path/filepath"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// maxImagesPerMessage bounds how many attachments are sent with one turn.
+const maxImagesPerMessage = 4
+
+// loadImages reads the image attachments among media for a vision-capable
+// model. Non-image files and unreadable images are skipped.
+func (al *AgentLoop) loadImages(media []string) []providers.Image {
+	if !al.vision || len(media) == 0 {
+		return nil
+	}
+
+	var images []providers.Image
+	for _, path := range media {
+		if len(images) >= maxImagesPerMessage {
+			break
+		}
+		if !filepath.IsAbs(path) || !utils.IsImageFile(path, "") {
+			continue
+		}
+
+		mimeType, data, err := utils.LoadImage(path, al.visionMaxDim)
+		if err != nil {
+			logger.WarnCF("agent", "Skipping image attachment",
+				map[string]interface{}{
+					"file":  filepath.Base(path),
+					"error": err.Error(),
+				})
+			continue
+		}
+		images = append(images, providers.Image{MIMEType: mimeType, Data: data})
+	}
+	return images
+}
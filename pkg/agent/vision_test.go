@@ -0,0 +1,101 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func writeTestPNG(t *testing.T, path string, w, h int) {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVision_AttachesDownscaledImage(t *testing.T) {
+	dir := t.TempDir()
+	photo := filepath.Join(dir, "photo.png")
+	writeTestPNG(t, photo, 400, 200)
+
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:          dir,
+				Model:              "test-model",
+				MaxTokens:          4096,
+				MaxToolIterations:  5,
+				Vision:             true,
+				VisionMaxDimension: 100,
+			},
+		},
+	}
+	provider := &captureProvider{}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+
+	msg := bus.InboundMessage{
+		Channel: "telegram", ChatID: "1", SenderID: "u", SessionKey: "telegram:1",
+		Content: "what's in this photo?\n[image: photo]", Media: []string{photo, filepath.Join(dir, "voice.ogg")},
+	}
+	if _, err := al.processMessage(context.Background(), msg); err != nil {
+		t.Fatalf("processMessage() error: %v", err)
+	}
+
+	last := provider.messages[len(provider.messages)-1]
+	if len(last.Images) != 1 {
+		t.Fatalf("len(Images) = %d, want 1", len(last.Images))
+	}
+	if last.Images[0].MIMEType != "image/jpeg" {
+		t.Errorf("MIMEType = %q, want image/jpeg after downscale", last.Images[0].MIMEType)
+	}
+	decoded, _, err := image.Decode(bytes.NewReader(last.Images[0].Data))
+	if err != nil {
+		t.Fatalf("decode attached image: %v", err)
+	}
+	if b := decoded.Bounds(); b.Dx() != 100 || b.Dy() != 50 {
+		t.Errorf("attached image is %dx%d, want 100x50", b.Dx(), b.Dy())
+	}
+
+	// History must not keep image payloads.
+	for _, m := range al.sessions.GetHistory("telegram:1") {
+		if len(m.Images) > 0 {
+			t.Error("session history stored image data")
+		}
+	}
+}
+
+func TestVision_DisabledSendsTextOnly(t *testing.T) {
+	dir := t.TempDir()
+	photo := filepath.Join(dir, "photo.png")
+	writeTestPNG(t, photo, 10, 10)
+
+	provider := &captureProvider{}
+	al := newPersonaTestLoop(t, provider)
+
+	msg := bus.InboundMessage{Channel: "telegram", ChatID: "1", SessionKey: "telegram:1", Content: "[image: photo]", Media: []string{photo}}
+	if _, err := al.processMessage(context.Background(), msg); err != nil {
+		t.Fatalf("processMessage() error: %v", err)
+	}
+	if n := len(provider.messages[len(provider.messages)-1].Images); n != 0 {
+		t.Errorf("len(Images) = %d, want 0 with vision disabled", n)
+	}
+}
@@ -0,0 +1,308 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package agent
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/commands"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// workflow is a compiled config.WorkflowConfig.
+type workflow struct {
+	name        string
+	description string
+	command     string
+	match       *regexp.Regexp
+	steps       []workflowStep
+	output      *template.Template
+}
+
+type workflowStep struct {
+	tool   string
+	args   map[string]interface{}
+	prompt *template.Template
+	system *template.Template
+	as     string
+}
+
+// compileWorkflows parses workflow templates and patterns. Invalid
+// workflows are logged and skipped. The result is sorted by name so rule
+// matching is deterministic.
+func compileWorkflows(defs map[string]config.WorkflowConfig) []*workflow {
+	names := make([]string, 0, len(defs))
+	for name := range defs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var out []*workflow
+	for _, name := range names {
+		wf, err := compileWorkflow(name, defs[name])
+		if err != nil {
+			logger.ErrorCF("agent", "Invalid workflow, skipping",
+				map[string]interface{}{"workflow": name, "error": err.Error()})
+			continue
+		}
+		out = append(out, wf)
+	}
+	return out
+}
+
+func compileWorkflow(name string, def config.WorkflowConfig) (*workflow, error) {
+	if def.Command == "" && def.Match == "" {
+		return nil, fmt.Errorf("needs a command or a match pattern")
+	}
+	if len(def.Steps) == 0 {
+		return nil, fmt.Errorf("has no steps")
+	}
+
+	wf := &workflow{name: name, description: def.Description, command: strings.ToLower(def.Command)}
+	if def.Match != "" {
+		re, err := regexp.Compile(def.Match)
+		if err != nil {
+			return nil, fmt.Errorf("invalid match pattern: %w", err)
+		}
+		wf.match = re
+	}
+
+	output := def.Output
+	if output == "" {
+		output = "{{.last}}"
+	}
+	var err error
+	if wf.output, err = parseWorkflowTemplate("output", output); err != nil {
+		return nil, err
+	}
+
+	for i, s := range def.Steps {
+		step := workflowStep{tool: s.Tool, args: s.Args, as: s.As}
+		switch {
+		case s.Tool != "" && s.Prompt != "":
+			return nil, fmt.Errorf("step %d has both a tool and a prompt", i+1)
+		case s.Prompt != "":
+			if step.prompt, err = parseWorkflowTemplate(fmt.Sprintf("step %d prompt", i+1), s.Prompt); err != nil {
+				return nil, err
+			}
+			if s.System != "" {
+				if step.system, err = parseWorkflowTemplate(fmt.Sprintf("step %d system", i+1), s.System); err != nil {
+					return nil, err
+				}
+			}
+		case s.Tool == "":
+			return nil, fmt.Errorf("step %d needs a tool or a prompt", i+1)
+		}
+		if err := checkArgTemplates(s.Args); err != nil {
+			return nil, fmt.Errorf("step %d: %w", i+1, err)
+		}
+		wf.steps = append(wf.steps, step)
+	}
+	return wf, nil
+}
+
+func parseWorkflowTemplate(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template in %s: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+func checkArgTemplates(v interface{}) error {
+	_, err := renderArgs(v, nil)
+	return err
+}
+
+// matchWorkflow returns the workflow msg invokes and its template data.
+// Commands take precedence over patterns.
+func (al *AgentLoop) matchWorkflow(msg bus.InboundMessage) (*workflow, map[string]string) {
+	content := strings.TrimSpace(msg.Content)
+	data := map[string]string{
+		"input":   content,
+		"sender":  msg.SenderID,
+		"channel": msg.Channel,
+		"chat_id": msg.ChatID,
+	}
+
+	if name, args, ok := commands.Parse(msg.Channel, content); ok {
+		for _, wf := range al.workflows {
+			if wf.command == "/"+name {
+				data["input"] = args
+				return wf, data
+			}
+		}
+	}
+
+	for _, wf := range al.workflows {
+		if wf.match == nil {
+			continue
+		}
+		m := wf.match.FindStringSubmatch(content)
+		if m == nil {
+			continue
+		}
+		for i, name := range wf.match.SubexpNames() {
+			if name != "" && i < len(m) {
+				data[name] = m[i]
+			}
+		}
+		return wf, data
+	}
+	return nil, nil
+}
+
+// handleWorkflow runs the workflow msg invokes, if any. It reports false
+// when no workflow applies.
+func (al *AgentLoop) handleWorkflow(ctx context.Context, msg bus.InboundMessage) (string, bool) {
+	wf, data := al.matchWorkflow(msg)
+	if wf == nil {
+		return "", false
+	}
+
+	logger.InfoCF("agent", "Running workflow",
+		map[string]interface{}{
+			"workflow":  wf.name,
+			"channel":   msg.Channel,
+			"sender_id": msg.SenderID,
+		})
+
+	al.updateToolContexts(msg.Channel, msg.ChatID, msg.SenderID, msg.Metadata["message_id"])
+	opts := processOptions{Channel: msg.Channel, ChatID: msg.ChatID, SenderID: msg.SenderID}
+
+	response, err := al.runWorkflow(ctx, wf, data, opts)
+	if err != nil {
+		logger.WarnCF("agent", "Workflow failed",
+			map[string]interface{}{"workflow": wf.name, "error": err.Error()})
+		response = t(msg, "workflow.failed", wf.name, err)
+	}
+
+	// Keep the exchange in history so follow-up questions have context
+	al.sessions.AddMessage(msg.SessionKey, "user", msg.Content)
+	al.sessions.AddMessage(msg.SessionKey, "assistant", response)
+	al.sessions.Save(msg.SessionKey)
+
+	return response, true
+}
+
+func (al *AgentLoop) runWorkflow(ctx context.Context, wf *workflow, data map[string]string, opts processOptions) (string, error) {
+	for i, step := range wf.steps {
+		var result string
+		if step.prompt != nil {
+			out, err := al.runPromptStep(ctx, step, data, opts)
+			if err != nil {
+				return "", fmt.Errorf("step %d: %w", i+1, err)
+			}
+			result = out
+		} else {
+			args, err := renderArgs(step.args, data)
+			if err != nil {
+				return "", fmt.Errorf("step %d: %w", i+1, err)
+			}
+			argMap, _ := args.(map[string]interface{})
+			res := al.tools.ExecuteWithContext(ctx, step.tool, argMap, opts.Channel, opts.ChatID, nil)
+			if res.IsError {
+				return "", fmt.Errorf("step %d (%s): %s", i+1, step.tool, res.ForLLM)
+			}
+			result = res.ForLLM
+		}
+
+		data["last"] = result
+		if step.as != "" {
+			data[step.as] = result
+		}
+	}
+
+	return executeTemplate(wf.output, data)
+}
+
+// runPromptStep sends one prompt to the model without tools.
+func (al *AgentLoop) runPromptStep(ctx context.Context, step workflowStep, data map[string]string, opts processOptions) (string, error) {
+	prompt, err := executeTemplate(step.prompt, data)
+	if err != nil {
+		return "", err
+	}
+
+	system := "You are picoclaw, a helpful assistant."
+	if step.system != nil {
+		if system, err = executeTemplate(step.system, data); err != nil {
+			return "", err
+		}
+	}
+	return al.complete(ctx, system, prompt, opts)
+}
+
+// complete sends one system and user prompt to the model without tools and
+// returns the trimmed answer.
+func (al *AgentLoop) complete(ctx context.Context, system, prompt string, opts processOptions) (string, error) {
+	// Long tool output fed into a prompt is truncated to fit the window
+	messages, _ := fitMessages(al.model, []providers.Message{
+		{Role: "system", Content: system},
+		{Role: "user", Content: prompt},
+	}, al.inputBudget(nil))
+
+	resp, err := al.provider.Chat(ctx, messages, nil, al.model, map[string]interface{}{
+		"max_tokens":  al.maxTokens,
+		"temperature": al.temperature,
+	})
+	if err != nil {
+		return "", err
+	}
+	al.recordLLMUsage(opts, messages, nil, resp)
+	return strings.TrimSpace(resp.Content), nil
+}
+
+func executeTemplate(tmpl *template.Template, data map[string]string) (string, error) {
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// renderArgs renders every string in a tool argument value as a template.
+// With nil data it only checks that the templates parse.
+func renderArgs(v interface{}, data map[string]string) (interface{}, error) {
+	switch val := v.(type) {
+	case string:
+		tmpl, err := parseWorkflowTemplate("argument", val)
+		if err != nil || data == nil {
+			return val, err
+		}
+		return executeTemplate(tmpl, data)
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			r, err := renderArgs(item, data)
+			if err != nil {
+				return nil, err
+			}
+			out[k] = r
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			r, err := renderArgs(item, data)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = r
+		}
+		return out, nil
+	default:
+		return val, nil
+	}
+}
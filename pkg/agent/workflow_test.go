@@ -0,0 +1,123 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// echoProvider answers with the last user message, upper-cased.
+type echoProvider struct {
+	calls int
+}
+
+func (p *echoProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	p.calls++
+	return &providers.LLMResponse{Content: strings.ToUpper(messages[len(messages)-1].Content)}, nil
+}
+
+func (p *echoProvider) GetDefaultModel() string {
+	return "echo"
+}
+
+func newWorkflowTestLoop(t *testing.T, provider providers.LLMProvider, workflows map[string]config.WorkflowConfig) *AgentLoop {
+	t.Helper()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				Model:             "test-model",
+				MaxTokens:         1024,
+				MaxToolIterations: 5,
+			},
+			Workflows: workflows,
+		},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+	al.tools.Register(tools.NewFuncTool("lookup", "Look up a city", map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"city": map[string]interface{}{"type": "string"},
+		},
+		"required": []string{"city"},
+	}, func(ctx context.Context, args map[string]interface{}) *tools.ToolResult {
+		if args["city"] == "" {
+			return tools.ErrorResult("city is required")
+		}
+		return tools.NewToolResult("sunny in " + args["city"].(string))
+	}))
+	return al
+}
+
+func TestWorkflowCommandAndRule(t *testing.T) {
+	provider := &echoProvider{}
+	al := newWorkflowTestLoop(t, provider, map[string]config.WorkflowConfig{
+		"weather": {
+			Command: "/weather",
+			Match:   `(?i)^weather in (?P<city>\w+)$`,
+			Steps: []config.WorkflowStep{
+				{Tool: "lookup", Args: map[string]interface{}{"city": "{{if .city}}{{.city}}{{else}}{{.input}}{{end}}"}, As: "report"},
+				{Prompt: "summarize: {{.report}}"},
+			},
+			Output: "{{.channel}}: {{.last}}",
+		},
+	})
+
+	msg := bus.InboundMessage{Channel: "telegram", ChatID: "c1", SenderID: "u1", SessionKey: "telegram:c1", Content: "/weather Paris"}
+	resp, err := al.processMessage(t.Context(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp != "telegram: SUMMARIZE: SUNNY IN PARIS" {
+		t.Errorf("command response = %q", resp)
+	}
+
+	// A matching message runs the same workflow with the named group
+	msg.Content = "Weather in Oslo"
+	resp, _ = al.processMessage(t.Context(), msg)
+	if !strings.Contains(resp, "SUMMARIZE: SUNNY IN OSLO") {
+		t.Errorf("rule response = %q", resp)
+	}
+
+	if history := al.sessions.GetHistory("telegram:c1"); len(history) != 4 {
+		t.Errorf("history has %d messages, want 4", len(history))
+	}
+	if provider.calls != 2 {
+		t.Errorf("provider called %d times, want one prompt step per run", provider.calls)
+	}
+}
+
+func TestWorkflowStepFailure(t *testing.T) {
+	al := newWorkflowTestLoop(t, &echoProvider{}, map[string]config.WorkflowConfig{
+		"broken": {
+			Command: "/broken",
+			Steps:   []config.WorkflowStep{{Tool: "missing_tool"}},
+		},
+	})
+
+	msg := bus.InboundMessage{Channel: "telegram", ChatID: "c1", SenderID: "u1", SessionKey: "telegram:c1", Content: "/broken"}
+	resp, _ := al.processMessage(t.Context(), msg)
+	if !strings.Contains(resp, "Workflow broken failed: step 1 (missing_tool)") {
+		t.Errorf("response = %q", resp)
+	}
+}
+
+func TestCompileWorkflowsSkipsInvalid(t *testing.T) {
+	wfs := compileWorkflows(map[string]config.WorkflowConfig{
+		"no_trigger":  {Steps: []config.WorkflowStep{{Prompt: "hi"}}},
+		"bad_regex":   {Match: "(", Steps: []config.WorkflowStep{{Prompt: "hi"}}},
+		"bad_tmpl":    {Command: "/x", Steps: []config.WorkflowStep{{Prompt: "{{.oops"}}},
+		"both":        {Command: "/y", Steps: []config.WorkflowStep{{Tool: "a", Prompt: "b"}}},
+		"no_steps":    {Command: "/z"},
+		"ok":          {Command: "/ok", Steps: []config.WorkflowStep{{Prompt: "hi"}}},
+		"bad_arg_tpl": {Command: "/w", Steps: []config.WorkflowStep{{Tool: "a", Args: map[string]interface{}{"q": []interface{}{"{{"}}}}},
+	})
+	if len(wfs) != 1 || wfs[0].name != "ok" {
+		t.Fatalf("compiled %d workflows, want only ok", len(wfs))
+	}
+}
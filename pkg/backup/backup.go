@@ -0,0 +1,246 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+// Package backup writes and restores encrypted snapshots of picoclaw's
+// runtime state: config, credentials, workspace (memory, sessions, history,
+// scheduler jobs, ...), and the WhatsApp session store. An archive is a
+// gzipped tar stream encrypted with a passphrase.
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"database/sql"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+// Source is a file or directory stored in the archive under Name.
+// Directories keep their layout below Name.
+type Source struct {
+	Name string
+	Path string
+}
+
+// sqliteHeader starts every SQLite database file.
+var sqliteHeader = []byte("SQLite format 3\x00")
+
+// Write archives sources to w, encrypted with passphrase, and returns the
+// number of files stored. Missing sources are skipped. SQLite databases are
+// copied with VACUUM INTO, so a running gateway's databases are captured
+// consistently; their -wal and -shm files are left out.
+func Write(w io.Writer, passphrase string, sources []Source) (int, error) {
+	if passphrase == "" {
+		return 0, fmt.Errorf("a passphrase is required")
+	}
+	enc, err := newEncryptWriter(w, passphrase)
+	if err != nil {
+		return 0, err
+	}
+	gz := gzip.NewWriter(enc)
+	tw := tar.NewWriter(gz)
+
+	count := 0
+	for _, src := range sources {
+		n, err := addSource(tw, src)
+		count += n
+		if err != nil {
+			return count, fmt.Errorf("%s: %w", src.Name, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return count, err
+	}
+	if err := gz.Close(); err != nil {
+		return count, err
+	}
+	return count, enc.Close()
+}
+
+func addSource(tw *tar.Writer, src Source) (int, error) {
+	info, err := os.Stat(src.Path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if !info.IsDir() {
+		return 1, addFile(tw, src.Name, src.Path, info)
+	}
+
+	count := 0
+	err = filepath.WalkDir(src.Path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || isSQLiteSidecar(p) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src.Path, p)
+		if err != nil {
+			return err
+		}
+		count++
+		return addFile(tw, path.Join(src.Name, filepath.ToSlash(rel)), p, info)
+	})
+	return count, err
+}
+
+func isSQLiteSidecar(p string) bool {
+	return strings.HasSuffix(p, "-wal") || strings.HasSuffix(p, "-shm") || strings.HasSuffix(p, "-journal")
+}
+
+func addFile(tw *tar.Writer, name, p string, info fs.FileInfo) error {
+	if isSQLite(p) {
+		snapshot, err := snapshotSQLite(p)
+		if err != nil {
+			return fmt.Errorf("failed to snapshot %s: %w", p, err)
+		}
+		defer os.Remove(snapshot)
+		if info, err = os.Stat(snapshot); err != nil {
+			return err
+		}
+		p = snapshot
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    int64(info.Mode().Perm()),
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+func isSQLite(p string) bool {
+	f, err := os.Open(p)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	header := make([]byte, len(sqliteHeader))
+	if _, err := io.ReadFull(f, header); err != nil {
+		return false
+	}
+	return bytes.Equal(header, sqliteHeader)
+}
+
+// snapshotSQLite writes a consistent copy of the database at p to a
+// temporary file and returns its path.
+func snapshotSQLite(p string) (string, error) {
+	tmp, err := os.CreateTemp("", "picoclaw-backup-*.db")
+	if err != nil {
+		return "", err
+	}
+	tmp.Close()
+	os.Remove(tmp.Name()) // VACUUM INTO needs a new file
+
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)", p))
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+	if _, err := db.Exec("VACUUM INTO ?", tmp.Name()); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+// Restore extracts the archive in r, encrypted with passphrase, and returns
+// the number of files written. resolve maps each archived name to the file
+// to write, or "" to skip it. Entries are restored in archive order, so
+// resolve may depend on files restored earlier, such as the config.
+// Existing files are overwritten, and stale SQLite -wal and -shm files next
+// to restored databases are removed.
+func Restore(r io.Reader, passphrase string, resolve func(name string) string) (int, error) {
+	dec, err := newDecryptReader(r, passphrase)
+	if err != nil {
+		return 0, err
+	}
+	gz, err := gzip.NewReader(dec)
+	if err != nil {
+		return 0, err
+	}
+	tr := tar.NewReader(gz)
+
+	count := 0
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+		if hdr.Typeflag != tar.TypeReg || !validName(hdr.Name) {
+			return count, fmt.Errorf("invalid archive entry %q", hdr.Name)
+		}
+		dest := resolve(hdr.Name)
+		if dest == "" {
+			continue
+		}
+		if err := extractFile(tr, dest, fs.FileMode(hdr.Mode).Perm()); err != nil {
+			return count, fmt.Errorf("%s: %w", hdr.Name, err)
+		}
+		count++
+	}
+}
+
+// validName rejects absolute paths and paths that leave the archive root.
+func validName(name string) bool {
+	if name == "" || path.IsAbs(name) || strings.Contains(name, "\\") {
+		return false
+	}
+	clean := path.Clean(name)
+	return clean == name && clean != ".." && !strings.HasPrefix(clean, "../")
+}
+
+func extractFile(r io.Reader, dest string, mode fs.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	tmp := dest + ".restore"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode|0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	os.Remove(dest + "-wal")
+	os.Remove(dest + "-shm")
+	return os.Rename(tmp, dest)
+}
@@ -0,0 +1,147 @@
+package backup
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEncryptRoundTrip(t *testing.T) {
+	sizes := []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 3*chunkSize + 17}
+	for _, size := range sizes {
+		data := bytes.Repeat([]byte("picoclaw"), size/8+1)[:size]
+
+		var buf bytes.Buffer
+		enc, err := newEncryptWriter(&buf, "secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		enc.Write(data)
+		if err := enc.Close(); err != nil {
+			t.Fatal(err)
+		}
+		archive := buf.Bytes()
+
+		dec, err := newDecryptReader(bytes.NewReader(archive), "secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(dec)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("size %d: round trip = %d bytes, %v", size, len(got), err)
+		}
+
+		dec, _ = newDecryptReader(bytes.NewReader(archive), "wrong")
+		if _, err := io.ReadAll(dec); !errors.Is(err, ErrBadPassphrase) {
+			t.Errorf("size %d: wrong passphrase error = %v", size, err)
+		}
+
+		if size > chunkSize {
+			// Drop the final chunk: the rest must not pass as complete.
+			header := len(magic) + saltSize + 4 + prefixSize
+			truncated := archive[:header+chunkSize+16]
+			dec, _ = newDecryptReader(bytes.NewReader(truncated), "secret")
+			if _, err := io.ReadAll(dec); err == nil {
+				t.Errorf("size %d: truncated archive decrypted without error", size)
+			}
+		}
+	}
+}
+
+func TestWriteAndRestore(t *testing.T) {
+	src := t.TempDir()
+	write := func(rel, content string) {
+		p := filepath.Join(src, rel)
+		os.MkdirAll(filepath.Dir(p), 0755)
+		if err := os.WriteFile(p, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("config.json", `{"a":1}`)
+	write("workspace/memory/MEMORY.md", "remember this")
+	write("workspace/sessions/telegram_1.json", "{}")
+	write("workspace/state/state.db-wal", "stale")
+
+	dbPath := filepath.Join(src, "workspace", "state", "state.db")
+	db, err := sql.Open("sqlite", "file:"+dbPath+"?_pragma=journal_mode(WAL)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("CREATE TABLE kv (k TEXT, v TEXT); INSERT INTO kv VALUES ('job', 'water plants')"); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close() // Left open, as with a running gateway
+
+	var archive bytes.Buffer
+	n, err := Write(&archive, "secret", []Source{
+		{Name: "config.json", Path: filepath.Join(src, "config.json")},
+		{Name: "auth.json", Path: filepath.Join(src, "missing.json")},
+		{Name: "workspace", Path: filepath.Join(src, "workspace")},
+	})
+	if err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if n != 4 {
+		t.Errorf("Write() stored %d files, want 4", n)
+	}
+
+	if _, err := Restore(bytes.NewReader(archive.Bytes()), "wrong", func(string) string { return "" }); !errors.Is(err, ErrBadPassphrase) {
+		t.Errorf("Restore(wrong passphrase) error = %v", err)
+	}
+
+	dest := t.TempDir()
+	var names []string
+	n, err = Restore(bytes.NewReader(archive.Bytes()), "secret", func(name string) string {
+		names = append(names, name)
+		if strings.HasPrefix(name, "workspace/sessions/") {
+			return ""
+		}
+		return filepath.Join(dest, filepath.FromSlash(name))
+	})
+	if err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if n != 3 || names[0] != "config.json" {
+		t.Errorf("Restore() wrote %d files from %v", n, names)
+	}
+
+	if data, _ := os.ReadFile(filepath.Join(dest, "workspace", "memory", "MEMORY.md")); string(data) != "remember this" {
+		t.Errorf("MEMORY.md = %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "workspace", "sessions")); !os.IsNotExist(err) {
+		t.Error("skipped entry was restored")
+	}
+
+	restored, err := sql.Open("sqlite", "file:"+filepath.Join(dest, "workspace", "state", "state.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+	var v string
+	if err := restored.QueryRow("SELECT v FROM kv WHERE k = 'job'").Scan(&v); err != nil || v != "water plants" {
+		t.Errorf("restored database row = %q, %v", v, err)
+	}
+}
+
+func TestValidName(t *testing.T) {
+	tests := map[string]bool{
+		"config.json":          true,
+		"workspace/memory/a":   true,
+		"../etc/passwd":        false,
+		"/etc/passwd":          false,
+		"workspace/../../x":    false,
+		"workspace/./a":        false,
+		"..":                   false,
+		`workspace\..\..\evil`: false,
+	}
+	for name, want := range tests {
+		if got := validName(name); got != want {
+			t.Errorf("validName(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package backup
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The archive is encrypted with AES-256-GCM in fixed-size chunks, so it can
+// be streamed without holding the whole backup in memory. The key is derived
+// from the passphrase with PBKDF2-SHA256. Each chunk's nonce is a random
+// prefix, the chunk counter, and a flag marking the final chunk, so chunks
+// cannot be reordered, dropped, or truncated without detection.
+//
+//	magic | salt (16) | iterations (4) | nonce prefix (7) | chunks...
+const (
+	magic         = "PCBAK1\n"
+	saltSize      = 16
+	prefixSize    = 7
+	kdfIterations = 600000
+	chunkSize     = 64 * 1024
+	maxIterations = 10000000
+)
+
+// ErrBadPassphrase is returned when an archive cannot be decrypted, either
+// because the passphrase is wrong or the file was altered.
+var ErrBadPassphrase = errors.New("wrong passphrase or corrupted backup")
+
+func deriveAEAD(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func chunkNonce(prefix []byte, counter uint32, last bool) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[prefixSize:], counter)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// encryptWriter encrypts everything written to it. Close writes the final
+// chunk and must be called.
+type encryptWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	prefix  []byte
+	counter uint32
+	buf     []byte
+}
+
+func newEncryptWriter(w io.Writer, passphrase string) (*encryptWriter, error) {
+	salt := make([]byte, saltSize)
+	prefix := make([]byte, prefixSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+	aead, err := deriveAEAD(passphrase, salt, kdfIterations)
+	if err != nil {
+		return nil, err
+	}
+
+	header := append([]byte(magic), salt...)
+	header = binary.BigEndian.AppendUint32(header, kdfIterations)
+	header = append(header, prefix...)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &encryptWriter{w: w, aead: aead, prefix: prefix, buf: make([]byte, 0, chunkSize)}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		// A full buffer is only sealed once more data arrives, so the final
+		// chunk is always the one sealed by Close.
+		if len(e.buf) == chunkSize {
+			if err := e.seal(false); err != nil {
+				return written, err
+			}
+		}
+		n := copy(e.buf[len(e.buf):chunkSize], p)
+		e.buf = e.buf[:len(e.buf)+n]
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (e *encryptWriter) Close() error {
+	return e.seal(true)
+}
+
+func (e *encryptWriter) seal(last bool) error {
+	if e.counter == ^uint32(0) {
+		return fmt.Errorf("backup too large")
+	}
+	out := e.aead.Seal(nil, chunkNonce(e.prefix, e.counter, last), e.buf, nil)
+	e.counter++
+	e.buf = e.buf[:0]
+	_, err := e.w.Write(out)
+	return err
+}
+
+// decryptReader reverses encryptWriter.
+type decryptReader struct {
+	r       *bufio.Reader
+	aead    cipher.AEAD
+	prefix  []byte
+	counter uint32
+	plain   []byte
+	done    bool
+}
+
+func newDecryptReader(r io.Reader, passphrase string) (*decryptReader, error) {
+	br := bufio.NewReaderSize(r, chunkSize+64)
+	header := make([]byte, len(magic)+saltSize+4+prefixSize)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, fmt.Errorf("not a picoclaw backup: %w", err)
+	}
+	if string(header[:len(magic)]) != magic {
+		return nil, fmt.Errorf("not a picoclaw backup")
+	}
+	salt := header[len(magic) : len(magic)+saltSize]
+	iterations := int(binary.BigEndian.Uint32(header[len(magic)+saltSize:]))
+	if iterations <= 0 || iterations > maxIterations {
+		return nil, fmt.Errorf("not a picoclaw backup: bad key derivation parameters")
+	}
+	aead, err := deriveAEAD(passphrase, salt, iterations)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptReader{r: br, aead: aead, prefix: header[len(header)-prefixSize:]}, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+func (d *decryptReader) next() error {
+	chunk := make([]byte, chunkSize+d.aead.Overhead())
+	n, err := io.ReadFull(d.r, chunk)
+	switch {
+	case err == io.EOF:
+		return fmt.Errorf("backup is truncated")
+	case err != nil && err != io.ErrUnexpectedEOF:
+		return err
+	}
+	chunk = chunk[:n]
+
+	// A short chunk is the last one; a full one is last only at EOF.
+	last := n < cap(chunk)
+	if !last {
+		if _, err := d.r.Peek(1); err == io.EOF {
+			last = true
+		}
+	}
+
+	plain, err := d.aead.Open(nil, chunkNonce(d.prefix, d.counter, last), chunk, nil)
+	if err != nil {
+		return ErrBadPassphrase
+	}
+	d.counter++
+	d.plain = plain
+	d.done = last
+	return nil
+}
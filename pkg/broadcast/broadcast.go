@@ -0,0 +1,296 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+// Package broadcast sends one announcement to many chats across channels,
+// pacing the sends on each channel and reporting what was delivered.
+package broadcast
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/templates"
+)
+
+// Result statuses.
+const (
+	StatusSent    = "sent"
+	StatusFailed  = "failed"
+	StatusSkipped = "skipped" // Cancelled before its turn
+)
+
+// Sender delivers a message to one chat and returns the ID its delivery
+// is tracked under. It is implemented by channels.Manager.
+type Sender interface {
+	Send(ctx context.Context, msg bus.OutboundMessage) (string, error)
+}
+
+// Target is one chat, written "channel:chat_id".
+type Target struct {
+	Channel string `json:"channel"`
+	ChatID  string `json:"chat_id"`
+}
+
+func (t Target) String() string {
+	return t.Channel + ":" + t.ChatID
+}
+
+// ParseTarget parses "channel:chat_id". Chat IDs may contain colons.
+func ParseTarget(s string) (Target, error) {
+	channel, chatID, ok := strings.Cut(strings.TrimSpace(s), ":")
+	if !ok || channel == "" || chatID == "" {
+		return Target{}, fmt.Errorf("invalid broadcast target %q, want channel:chat_id", s)
+	}
+	return Target{Channel: channel, ChatID: chatID}, nil
+}
+
+// Request is one broadcast. Recipients are the named List plus any extra
+// Targets, each chat once. Message is Markdown, which the channel manager
+// renders for each channel; Formats replaces it for the channels it names.
+// Template names a message template to render with Data in place
+// of Message, once per channel, with .channel set.
+type Request struct {
+	List     string                 `json:"list,omitempty"`
+	Targets  []string               `json:"targets,omitempty"`
+	Message  string                 `json:"message,omitempty"`
+	Template string                 `json:"template,omitempty"`
+	Data     map[string]interface{} `json:"data,omitempty"`
+	Formats  map[string]string      `json:"formats,omitempty"`
+}
+
+// Result is the outcome for one chat. ID looks the message up in the
+// delivery tracker, which follows it on to delivered and read, or through
+// retries after a failed first attempt.
+type Result struct {
+	Target string `json:"target"`
+	Status string `json:"status"`
+	ID     string `json:"id,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Report is the delivery report of a broadcast, with results in target
+// order.
+type Report struct {
+	List     string    `json:"list,omitempty"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	Sent     int       `json:"sent"`
+	Failed   int       `json:"failed"`
+	Skipped  int       `json:"skipped"`
+	Results  []Result  `json:"results"`
+}
+
+// Summary describes the report in one line, e.g. "Sent 3 of 4, 1 failed".
+func (r *Report) Summary() string {
+	s := fmt.Sprintf("Sent %d of %d", r.Sent, len(r.Results))
+	if r.Failed > 0 {
+		s += fmt.Sprintf(", %d failed", r.Failed)
+	}
+	if r.Skipped > 0 {
+		s += fmt.Sprintf(", %d skipped", r.Skipped)
+	}
+	return s
+}
+
+// Broadcaster sends broadcasts to the configured recipient lists.
+type Broadcaster struct {
+	sender    Sender
+	lists     map[string][]Target
+	interval  time.Duration
+	templates *templates.Engine // nil until SetTemplates
+	mu        sync.Mutex        // One broadcast at a time, so pacing holds
+}
+
+// New creates a broadcaster. lists maps list names to "channel:chat_id"
+// entries. Consecutive sends on one channel are interval apart; channels
+// are sent to in parallel.
+func New(sender Sender, lists map[string][]string, interval time.Duration) (*Broadcaster, error) {
+	b := &Broadcaster{sender: sender, lists: make(map[string][]Target), interval: interval}
+	for name, entries := range lists {
+		targets := make([]Target, 0, len(entries))
+		for _, entry := range entries {
+			t, err := ParseTarget(entry)
+			if err != nil {
+				return nil, fmt.Errorf("broadcast list %s: %w", name, err)
+			}
+			targets = append(targets, t)
+		}
+		b.lists[name] = targets
+	}
+	return b, nil
+}
+
+// SetTemplates lets requests name a message template.
+func (b *Broadcaster) SetTemplates(engine *templates.Engine) {
+	b.templates = engine
+}
+
+// Lists returns the recipient lists by name.
+func (b *Broadcaster) Lists() map[string][]Target {
+	return b.lists
+}
+
+// ListNames returns the list names, sorted.
+func (b *Broadcaster) ListNames() []string {
+	names := make([]string, 0, len(b.lists))
+	for name := range b.lists {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Recipients returns the request's recipients in order, without
+// duplicates.
+func (b *Broadcaster) Recipients(req Request) ([]Target, error) {
+	var targets []Target
+	if req.List != "" {
+		list, ok := b.lists[req.List]
+		if !ok {
+			return nil, fmt.Errorf("unknown broadcast list %q", req.List)
+		}
+		targets = append(targets, list...)
+	}
+	for _, entry := range req.Targets {
+		t, err := ParseTarget(entry)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, t)
+	}
+
+	seen := make(map[Target]bool, len(targets))
+	unique := targets[:0]
+	for _, t := range targets {
+		if !seen[t] {
+			seen[t] = true
+			unique = append(unique, t)
+		}
+	}
+	if len(unique) == 0 {
+		return nil, fmt.Errorf("broadcast has no recipients")
+	}
+	return unique, nil
+}
+
+// Send delivers req and reports the outcome for every recipient. It
+// returns an error only for a request that cannot be sent at all; failed
+// deliveries are in the report. Recipients not yet reached when ctx is
+// cancelled are reported as skipped.
+func (b *Broadcaster) Send(ctx context.Context, req Request) (*Report, error) {
+	targets, err := b.Recipients(req)
+	if err != nil {
+		return nil, err
+	}
+	byChannel := make(map[string][]int)
+	for i, t := range targets {
+		byChannel[t.Channel] = append(byChannel[t.Channel], i)
+	}
+	contents := make(map[string]string, len(byChannel))
+	for channel := range byChannel {
+		content, err := b.content(req, channel)
+		if err != nil {
+			return nil, err
+		}
+		contents[channel] = content
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	report := &Report{List: req.List, Started: time.Now(), Results: make([]Result, len(targets))}
+	var wg sync.WaitGroup
+	for channel, indexes := range byChannel {
+		content := contents[channel]
+		wg.Add(1)
+		go func(channel, content string, indexes []int) {
+			defer wg.Done()
+			for n, i := range indexes {
+				if n > 0 && b.interval > 0 {
+					select {
+					case <-ctx.Done():
+					case <-time.After(b.interval):
+					}
+				}
+				report.Results[i] = b.sendOne(ctx, targets[i], content)
+			}
+		}(channel, content, indexes)
+	}
+	wg.Wait()
+	report.Finished = time.Now()
+
+	for _, r := range report.Results {
+		switch r.Status {
+		case StatusSent:
+			report.Sent++
+		case StatusFailed:
+			report.Failed++
+		default:
+			report.Skipped++
+		}
+	}
+	logger.InfoCF("broadcast", "Broadcast finished", map[string]interface{}{
+		"list":    req.List,
+		"sent":    report.Sent,
+		"failed":  report.Failed,
+		"skipped": report.Skipped,
+	})
+	return report, nil
+}
+
+// content is the message for one channel: its entry in Formats, or the
+// message or rendered template.
+func (b *Broadcaster) content(req Request, channel string) (string, error) {
+	if content, ok := req.Formats[channel]; ok {
+		return content, nil
+	}
+	message := req.Message
+	if req.Template != "" {
+		if b.templates == nil {
+			return "", fmt.Errorf("message templates are not configured")
+		}
+		data := map[string]interface{}{"channel": channel, "list": req.List}
+		for k, v := range req.Data {
+			data[k] = v
+		}
+		rendered, err := b.templates.Render(req.Template, data)
+		if err != nil {
+			return "", err
+		}
+		message = rendered
+	}
+	if strings.TrimSpace(message) == "" {
+		return "", fmt.Errorf("broadcast message is empty")
+	}
+	return message, nil
+}
+
+func (b *Broadcaster) sendOne(ctx context.Context, t Target, content string) Result {
+	result := Result{Target: t.String()}
+	if ctx.Err() != nil {
+		result.Status = StatusSkipped
+		return result
+	}
+	id, err := b.sender.Send(ctx, bus.OutboundMessage{Channel: t.Channel, ChatID: t.ChatID, Content: content})
+	result.ID = id
+	if err != nil {
+		logger.WarnCF("broadcast", "Broadcast delivery failed", map[string]interface{}{
+			"target": result.Target,
+			"error":  err.Error(),
+		})
+		result.Status = StatusFailed
+		result.Error = err.Error()
+		return result
+	}
+	result.Status = StatusSent
+	return result
+}
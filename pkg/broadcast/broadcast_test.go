@@ -0,0 +1,180 @@
+package broadcast
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/templates"
+)
+
+type fakeSender struct {
+	mu   sync.Mutex
+	sent map[string][]time.Time // target -> send times
+	body map[string]string
+	fail map[string]bool
+}
+
+func newFakeSender() *fakeSender {
+	return &fakeSender{sent: make(map[string][]time.Time), body: make(map[string]string), fail: make(map[string]bool)}
+}
+
+func (f *fakeSender) Send(ctx context.Context, msg bus.OutboundMessage) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	target := msg.Channel + ":" + msg.ChatID
+	if f.fail[target] {
+		return "id-" + target, errors.New("chat not found")
+	}
+	f.sent[target] = append(f.sent[target], time.Now())
+	f.body[target] = msg.Content
+	return "id-" + target, nil
+}
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Target
+		wantErr bool
+	}{
+		{"telegram:123", Target{"telegram", "123"}, false},
+		{"slack:C01:1700000000.1", Target{"slack", "C01:1700000000.1"}, false},
+		{" whatsapp:49151@s.whatsapp.net ", Target{"whatsapp", "49151@s.whatsapp.net"}, false},
+		{"telegram", Target{}, true},
+		{":123", Target{}, true},
+		{"telegram:", Target{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseTarget(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseTarget(%q) = %v, %v; want %v, err %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestNewRejectsBadTargets(t *testing.T) {
+	if _, err := New(newFakeSender(), map[string][]string{"ops": {"telegram"}}, 0); err == nil {
+		t.Error("New() accepted a target without a chat ID")
+	}
+}
+
+func TestSend(t *testing.T) {
+	sender := newFakeSender()
+	sender.fail["telegram:2"] = true
+	b, err := New(sender, map[string][]string{
+		"ops": {"telegram:1", "telegram:2", "slack:C01", "telegram:3"},
+	}, 20*time.Millisecond)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	report, err := b.Send(context.Background(), Request{
+		List:    "ops",
+		Targets: []string{"telegram:1", "discord:9"},
+		Message: "**Maintenance** tonight",
+		Formats: map[string]string{"discord": "custom"},
+	})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	want := []Result{
+		{Target: "telegram:1", Status: StatusSent, ID: "id-telegram:1"},
+		{Target: "telegram:2", Status: StatusFailed, ID: "id-telegram:2", Error: "chat not found"},
+		{Target: "slack:C01", Status: StatusSent, ID: "id-slack:C01"},
+		{Target: "telegram:3", Status: StatusSent, ID: "id-telegram:3"},
+		{Target: "discord:9", Status: StatusSent, ID: "id-discord:9"},
+	}
+	if len(report.Results) != len(want) {
+		t.Fatalf("Results = %+v, want %+v", report.Results, want)
+	}
+	for i := range want {
+		if report.Results[i] != want[i] {
+			t.Errorf("Results[%d] = %+v, want %+v", i, report.Results[i], want[i])
+		}
+	}
+	if report.Sent != 4 || report.Failed != 1 || report.Summary() != "Sent 4 of 5, 1 failed" {
+		t.Errorf("report = %+v, summary %q", report, report.Summary())
+	}
+
+	// Markdown goes out as written; the channel manager renders it
+	if got := sender.body["slack:C01"]; got != "**Maintenance** tonight" {
+		t.Errorf("slack body = %q", got)
+	}
+	if got := sender.body["telegram:1"]; got != "**Maintenance** tonight" {
+		t.Errorf("telegram body = %q", got)
+	}
+	if got := sender.body["discord:9"]; got != "custom" {
+		t.Errorf("discord body = %q, want the per-channel override", got)
+	}
+	if n := len(sender.sent["telegram:1"]); n != 1 {
+		t.Errorf("telegram:1 sent %d times, want once", n)
+	}
+	if gap := sender.sent["telegram:3"][0].Sub(sender.sent["telegram:1"][0]); gap < 40*time.Millisecond {
+		t.Errorf("telegram sends %v apart, want paced by the interval", gap)
+	}
+}
+
+func TestSendCancelledSkipsRest(t *testing.T) {
+	sender := newFakeSender()
+	b, _ := New(sender, map[string][]string{"all": {"telegram:1", "telegram:2", "telegram:3"}}, time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	report, err := b.Send(ctx, Request{List: "all", Message: "hi"})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if report.Sent != 1 || report.Skipped != 2 {
+		t.Errorf("report = %+v, want 1 sent and 2 skipped", report)
+	}
+}
+
+func TestSendRejectsBadRequests(t *testing.T) {
+	b, _ := New(newFakeSender(), map[string][]string{"ops": {"telegram:1"}}, 0)
+	tests := []Request{
+		{List: "ops", Message: " "},
+		{List: "nope", Message: "hi"},
+		{Message: "hi"},
+		{Targets: []string{"bad"}, Message: "hi"},
+	}
+	for _, req := range tests {
+		if _, err := b.Send(context.Background(), req); err == nil {
+			t.Errorf("Send(%+v) succeeded, want an error", req)
+		}
+	}
+}
+
+func TestSendTemplate(t *testing.T) {
+	sender := newFakeSender()
+	b, _ := New(sender, map[string][]string{"ops": {"slack:C1", "telegram:1"}}, 0)
+
+	req := Request{List: "ops", Template: "deploy", Data: map[string]interface{}{"version": "1.4.2"}}
+	if _, err := b.Send(context.Background(), req); err == nil {
+		t.Error("Send() with a template but no engine succeeded")
+	}
+
+	engine, err := templates.Load(map[string]string{"deploy": "**Deployed** {{.version}} ({{.channel}}, {{.list}})"}, "")
+	if err != nil {
+		t.Fatalf("templates.Load() error = %v", err)
+	}
+	b.SetTemplates(engine)
+	report, err := b.Send(context.Background(), req)
+	if err != nil || report.Sent != 2 {
+		t.Fatalf("Send() = %+v, %v", report, err)
+	}
+	if got := sender.body["slack:C1"]; got != "**Deployed** 1.4.2 (slack, ops)" {
+		t.Errorf("slack body = %q", got)
+	}
+	if got := sender.body["telegram:1"]; got != "**Deployed** 1.4.2 (telegram, ops)" {
+		t.Errorf("telegram body = %q", got)
+	}
+
+	req.Data = nil
+	if _, err := b.Send(context.Background(), req); err == nil {
+		t.Error("Send() with missing template data succeeded")
+	}
+}
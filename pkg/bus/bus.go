@@ -2,50 +2,262 @@ package bus
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
 	"sync"
 )
 
+// Recorder is told about each message the bus hands over: inbound messages
+// as the agent takes them, outbound messages as the channel dispatcher
+// takes them. Partial streaming updates are not recorded.
+type Recorder interface {
+	RecordInbound(msg InboundMessage)
+	RecordOutbound(msg OutboundMessage)
+}
+
 type MessageBus struct {
-	inbound  chan InboundMessage
-	outbound chan OutboundMessage
-	handlers map[string]MessageHandler
-	mu       sync.RWMutex
+	inbound   chan InboundMessage
+	outbound  chan OutboundMessage
+	handlers  map[string]MessageHandler
+	mu        sync.RWMutex
+	recorders []Recorder
+
+	// inboundClosed is closed by CloseInbound during shutdown. Messages
+	// published afterwards are held in late instead of the inbound queue.
+	inboundClosed chan struct{}
+	closeOnce     sync.Once
+	late          []InboundMessage
+
+	processing processing
+	receipts   receipts
+	chatEvents chatEvents
+	presence   presenceEvents
+	statuses   statuses
+
+	interactions interactions
+
+	agent      consumer // Takes inbound messages
+	dispatcher consumer // Takes outbound messages
 }
 
 func NewMessageBus() *MessageBus {
-	return &MessageBus{
-		inbound:  make(chan InboundMessage, 100),
-		outbound: make(chan OutboundMessage, 100),
-		handlers: make(map[string]MessageHandler),
+	mb := &MessageBus{
+		inbound:       make(chan InboundMessage, 100),
+		outbound:      make(chan OutboundMessage, 100),
+		handlers:      make(map[string]MessageHandler),
+		inboundClosed: make(chan struct{}),
 	}
+	// Queued messages count as waiting from the start
+	mb.agent.took()
+	mb.dispatcher.took()
+	return mb
+}
+
+// AddRecorder installs a recorder alongside any already installed.
+func (mb *MessageBus) AddRecorder(r Recorder) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	mb.recorders = append(mb.recorders, r)
+}
+
+// RemoveRecorder uninstalls a recorder added with AddRecorder.
+func (mb *MessageBus) RemoveRecorder(r Recorder) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	for i, existing := range mb.recorders {
+		if existing == r {
+			mb.recorders = append(mb.recorders[:i:i], mb.recorders[i+1:]...)
+			return
+		}
+	}
+}
+
+func (mb *MessageBus) getRecorders() []Recorder {
+	mb.mu.RLock()
+	defer mb.mu.RUnlock()
+	return mb.recorders
 }
 
+// PublishInbound queues msg for the agent, assigning it a correlation ID
+// and a trace ID if it has none.
 func (mb *MessageBus) PublishInbound(msg InboundMessage) {
-	mb.inbound <- msg
+	if msg.CorrelationID == "" {
+		msg.CorrelationID = NewCorrelationID()
+	}
+	if msg.TraceID == "" {
+		msg.TraceID = NewTraceID()
+	}
+
+	select {
+	case <-mb.inboundClosed:
+		mb.holdLate(msg)
+		return
+	default:
+	}
+
+	select {
+	case mb.inbound <- msg:
+	case <-mb.inboundClosed:
+		mb.holdLate(msg)
+	}
+}
+
+func (mb *MessageBus) holdLate(msg InboundMessage) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	mb.late = append(mb.late, msg)
 }
 
+// ConsumeInbound blocks until an inbound message is available. It returns
+// false when ctx is done, or when the inbound side has been closed and the
+// queue is empty.
 func (mb *MessageBus) ConsumeInbound(ctx context.Context) (InboundMessage, bool) {
+	mb.agent.wait()
+	defer mb.agent.took()
 	select {
 	case msg := <-mb.inbound:
-		return msg, true
+		return mb.consumed(msg), true
 	case <-ctx.Done():
 		return InboundMessage{}, false
+	case <-mb.inboundClosed:
+		select {
+		case msg := <-mb.inbound:
+			return mb.consumed(msg), true
+		default:
+			return InboundMessage{}, false
+		}
 	}
 }
 
+// consumed records an inbound message once it is handed to the agent, so
+// messages saved at shutdown and replayed later are recorded only once.
+func (mb *MessageBus) consumed(msg InboundMessage) InboundMessage {
+	for _, r := range mb.getRecorders() {
+		r.RecordInbound(msg)
+	}
+	return msg
+}
+
+// CloseInbound stops accepting new inbound work. Messages already queued can
+// still be consumed; messages published afterwards are kept aside and
+// returned by DrainInbound so they can be persisted.
+func (mb *MessageBus) CloseInbound() {
+	mb.closeOnce.Do(func() {
+		close(mb.inboundClosed)
+	})
+}
+
+// InboundClosed reports whether CloseInbound has been called.
+func (mb *MessageBus) InboundClosed() bool {
+	select {
+	case <-mb.inboundClosed:
+		return true
+	default:
+		return false
+	}
+}
+
+// DrainInbound removes and returns every inbound message that has not been
+// consumed yet, including those published after CloseInbound.
+func (mb *MessageBus) DrainInbound() []InboundMessage {
+	var msgs []InboundMessage
+drain:
+	for {
+		select {
+		case msg := <-mb.inbound:
+			msgs = append(msgs, msg)
+		default:
+			break drain
+		}
+	}
+
+	mb.mu.Lock()
+	msgs = append(msgs, mb.late...)
+	mb.late = nil
+	mb.mu.Unlock()
+
+	return msgs
+}
+
+// PublishOutbound queues msg for the channels. Unless it names its causes
+// already, it is linked to the inbound messages being handled in its chat
+// and joins the first one's trace.
 func (mb *MessageBus) PublishOutbound(msg OutboundMessage) {
+	if len(msg.CorrelationIDs) == 0 {
+		msg.CorrelationIDs = mb.correlationIDs(msg.Channel, msg.ChatID)
+	}
+	if msg.TraceID == "" && len(msg.CorrelationIDs) > 0 {
+		msg.TraceID = mb.traceOf(msg.CorrelationIDs[0])
+		if msg.ParentID == "" {
+			msg.ParentID = msg.CorrelationIDs[0]
+		}
+	}
+	if msg.TraceID == "" {
+		msg.TraceID = NewTraceID()
+	}
+	if msg.ThreadID == "" {
+		msg.ThreadID = ThreadOf(msg.ChatID)
+	}
 	mb.outbound <- msg
 }
 
+// ThreadOf returns the thread part of a "chat/thread" chat ID, or "".
+func ThreadOf(chatID string) string {
+	_, thread, _ := strings.Cut(chatID, "/")
+	return thread
+}
+
+// NewCorrelationID returns a random ID for an inbound message.
+func NewCorrelationID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
 func (mb *MessageBus) SubscribeOutbound(ctx context.Context) (OutboundMessage, bool) {
+	mb.dispatcher.wait()
+	defer mb.dispatcher.took()
 	select {
 	case msg := <-mb.outbound:
+		if !msg.Partial {
+			for _, r := range mb.getRecorders() {
+				r.RecordOutbound(msg)
+			}
+		}
 		return msg, true
 	case <-ctx.Done():
 		return OutboundMessage{}, false
 	}
 }
 
+// TryConsumeOutbound returns a queued outbound message without blocking.
+func (mb *MessageBus) TryConsumeOutbound() (OutboundMessage, bool) {
+	select {
+	case msg := <-mb.outbound:
+		return msg, true
+	default:
+		return OutboundMessage{}, false
+	}
+}
+
+// QueueLengths reports how many inbound and outbound messages are waiting.
+func (mb *MessageBus) QueueLengths() (inbound, outbound int) {
+	return len(mb.inbound), len(mb.outbound)
+}
+
+// DiscardOutbound drops every queued outbound message and returns how many
+// were dropped.
+func (mb *MessageBus) DiscardOutbound() int {
+	n := 0
+	for {
+		if _, ok := mb.TryConsumeOutbound(); !ok {
+			return n
+		}
+		n++
+	}
+}
+
 func (mb *MessageBus) RegisterHandler(channel string, handler MessageHandler) {
 	mb.mu.Lock()
 	defer mb.mu.Unlock()
@@ -0,0 +1,314 @@
+package bus
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCloseInboundDrainsQueueThenStops(t *testing.T) {
+	mb := NewMessageBus()
+	mb.PublishInbound(InboundMessage{Channel: "test", Content: "queued"})
+	mb.CloseInbound()
+	mb.PublishInbound(InboundMessage{Channel: "test", Content: "late"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	msg, ok := mb.ConsumeInbound(ctx)
+	if !ok || msg.Content != "queued" {
+		t.Fatalf("ConsumeInbound() = %q, %v; want queued message", msg.Content, ok)
+	}
+
+	if _, ok := mb.ConsumeInbound(ctx); ok {
+		t.Fatal("ConsumeInbound() should return false once closed and empty")
+	}
+	if ctx.Err() != nil {
+		t.Fatal("ConsumeInbound() blocked until context deadline")
+	}
+
+	pending := mb.DrainInbound()
+	if len(pending) != 1 || pending[0].Content != "late" {
+		t.Fatalf("DrainInbound() = %+v, want the late message", pending)
+	}
+}
+
+func TestPendingRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "pending.json")
+	msgs := []InboundMessage{{Channel: "telegram", ChatID: "1", Content: "hello"}}
+
+	if err := SavePending(path, msgs); err != nil {
+		t.Fatalf("SavePending() error = %v", err)
+	}
+
+	loaded, err := LoadPending(path)
+	if err != nil {
+		t.Fatalf("LoadPending() error = %v", err)
+	}
+	if len(loaded) != 1 || loaded[0].Content != "hello" {
+		t.Fatalf("LoadPending() = %+v", loaded)
+	}
+
+	again, err := LoadPending(path)
+	if err != nil || len(again) != 0 {
+		t.Fatalf("second LoadPending() = %+v, %v; want empty", again, err)
+	}
+}
+
+type recordingRecorder struct {
+	inbound  []InboundMessage
+	outbound []OutboundMessage
+}
+
+func (r *recordingRecorder) RecordInbound(msg InboundMessage)   { r.inbound = append(r.inbound, msg) }
+func (r *recordingRecorder) RecordOutbound(msg OutboundMessage) { r.outbound = append(r.outbound, msg) }
+
+func TestRecorderSeesConsumedMessages(t *testing.T) {
+	mb := NewMessageBus()
+	rec := &recordingRecorder{}
+	mb.AddRecorder(rec)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	mb.PublishInbound(InboundMessage{Channel: "telegram", Content: "hello"})
+	if _, ok := mb.ConsumeInbound(ctx); !ok {
+		t.Fatal("ConsumeInbound() failed")
+	}
+
+	mb.PublishOutbound(OutboundMessage{Channel: "telegram", Content: "partial", Partial: true})
+	mb.PublishOutbound(OutboundMessage{Channel: "telegram", Content: "final"})
+	for i := 0; i < 2; i++ {
+		if _, ok := mb.SubscribeOutbound(ctx); !ok {
+			t.Fatal("SubscribeOutbound() failed")
+		}
+	}
+
+	if len(rec.inbound) != 1 || rec.inbound[0].Content != "hello" {
+		t.Errorf("recorded inbound = %+v", rec.inbound)
+	}
+	if len(rec.outbound) != 1 || rec.outbound[0].Content != "final" {
+		t.Errorf("recorded outbound = %+v, want only the final message", rec.outbound)
+	}
+}
+
+func TestRemoveRecorder(t *testing.T) {
+	mb := NewMessageBus()
+	kept, removed := &recordingRecorder{}, &recordingRecorder{}
+	mb.AddRecorder(kept)
+	mb.AddRecorder(removed)
+	mb.RemoveRecorder(removed)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	mb.PublishOutbound(OutboundMessage{Channel: "telegram", Content: "hi"})
+	if _, ok := mb.SubscribeOutbound(ctx); !ok {
+		t.Fatal("SubscribeOutbound() failed")
+	}
+
+	if len(kept.outbound) != 1 {
+		t.Errorf("kept recorder saw %d messages, want 1", len(kept.outbound))
+	}
+	if len(removed.outbound) != 0 {
+		t.Errorf("removed recorder saw %d messages, want 0", len(removed.outbound))
+	}
+}
+
+func TestStartProcessing(t *testing.T) {
+	mb := NewMessageBus()
+	var got []Processing
+	mb.OnProcessing(func(p Processing) { got = append(got, p) })
+
+	msg := InboundMessage{Channel: "slack", ChatID: "C1", Metadata: map[string]string{"message_id": "171.1"}}
+	first := mb.StartProcessing(msg)
+	second := mb.StartProcessing(msg)
+	first()
+	first() // Calling done twice counts once
+	if len(got) != 1 || !got[0].Active || got[0].MessageID != "171.1" {
+		t.Fatalf("after first done: %+v, want one start", got)
+	}
+	second()
+	if len(got) != 2 || got[1].Active || got[1].ChatID != "C1" {
+		t.Fatalf("after last done: %+v, want start then finish", got)
+	}
+}
+
+func TestCorrelation(t *testing.T) {
+	mb := NewMessageBus()
+	ctx := context.Background()
+
+	mb.PublishInbound(InboundMessage{Channel: "slack", ChatID: "C1", Content: "a"})
+	mb.PublishInbound(InboundMessage{Channel: "slack", ChatID: "C1", Content: "b", CorrelationID: "given"})
+	a, _ := mb.ConsumeInbound(ctx)
+	b, _ := mb.ConsumeInbound(ctx)
+	if a.CorrelationID == "" || b.CorrelationID != "given" {
+		t.Fatalf("correlation IDs = %q, %q", a.CorrelationID, b.CorrelationID)
+	}
+
+	doneA := mb.StartProcessing(a)
+	doneB := mb.StartProcessing(b)
+	tests := []struct {
+		msg  OutboundMessage
+		want []string
+	}{
+		{OutboundMessage{Channel: "slack", ChatID: "C1"}, []string{a.CorrelationID, "given"}},
+		{OutboundMessage{Channel: "slack", ChatID: "C2"}, nil},
+		{OutboundMessage{Channel: "slack", ChatID: "C1", CorrelationIDs: []string{"x"}}, []string{"x"}},
+	}
+	for _, tt := range tests {
+		mb.PublishOutbound(tt.msg)
+		got, _ := mb.SubscribeOutbound(ctx)
+		if strings.Join(got.CorrelationIDs, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s correlation IDs = %q, want %q", tt.msg.ChatID, got.CorrelationIDs, tt.want)
+		}
+	}
+
+	doneA()
+	mb.PublishOutbound(OutboundMessage{Channel: "slack", ChatID: "C1"})
+	if got, _ := mb.SubscribeOutbound(ctx); len(got.CorrelationIDs) != 1 || got.CorrelationIDs[0] != "given" {
+		t.Errorf("after one finished: %q", got.CorrelationIDs)
+	}
+	doneB()
+	mb.PublishOutbound(OutboundMessage{Channel: "slack", ChatID: "C1"})
+	if got, _ := mb.SubscribeOutbound(ctx); got.CorrelationIDs != nil {
+		t.Errorf("after both finished: %q", got.CorrelationIDs)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	mb := NewMessageBus()
+	ctx := context.Background()
+
+	given := NewTraceID()
+	mb.PublishInbound(InboundMessage{Channel: "slack", ChatID: "C1", Content: "a"})
+	mb.PublishInbound(InboundMessage{Channel: "system", ChatID: "slack:C1", Content: "b", TraceID: given, ParentID: "1a2b"})
+	a, _ := mb.ConsumeInbound(ctx)
+	b, _ := mb.ConsumeInbound(ctx)
+	if len(a.TraceID) != 32 || b.TraceID != given || b.ParentID != "1a2b" {
+		t.Fatalf("traces = %q, %q/%q", a.TraceID, b.TraceID, b.ParentID)
+	}
+
+	done := mb.StartProcessing(a)
+	mb.PublishOutbound(OutboundMessage{Channel: "slack", ChatID: "C1"})
+	if got, _ := mb.SubscribeOutbound(ctx); got.TraceID != a.TraceID || got.ParentID != a.CorrelationID {
+		t.Errorf("reply trace = %q/%q, want %q/%q", got.TraceID, got.ParentID, a.TraceID, a.CorrelationID)
+	}
+	mb.PublishOutbound(OutboundMessage{Channel: "slack", ChatID: "C2"})
+	if got, _ := mb.SubscribeOutbound(ctx); got.TraceID == "" || got.TraceID == a.TraceID || got.ParentID != "" {
+		t.Errorf("unrelated trace = %q/%q, want a new one", got.TraceID, got.ParentID)
+	}
+	done()
+	if id := mb.traceOf(a.CorrelationID); id != "" {
+		t.Errorf("trace kept after handling: %q", id)
+	}
+
+	tctx := WithTrace(ctx, a.TraceID, a.CorrelationID)
+	if fields := TraceFields(tctx, nil); fields["trace_id"] != a.TraceID || fields["span_id"] != a.CorrelationID {
+		t.Errorf("TraceFields() = %v", fields)
+	}
+	if fields := TraceFields(ctx, nil); fields != nil {
+		t.Errorf("TraceFields() without trace = %v, want nil", fields)
+	}
+
+	header := Traceparent(a.TraceID, a.CorrelationID)
+	if traceID, parentID, ok := ParseTraceparent(header); !ok || traceID != a.TraceID || parentID != a.CorrelationID {
+		t.Errorf("ParseTraceparent(%q) = %q, %q, %v", header, traceID, parentID, ok)
+	}
+	for _, bad := range []string{"", "00-" + a.TraceID, "00-00000000000000000000000000000000-" + a.CorrelationID + "-01", "ff-" + a.TraceID + "-" + a.CorrelationID + "-01"} {
+		if _, _, ok := ParseTraceparent(bad); ok {
+			t.Errorf("ParseTraceparent(%q) accepted", bad)
+		}
+	}
+	if got := Traceparent(a.TraceID, "given"); got != "" {
+		t.Errorf("Traceparent() with a bad span = %q", got)
+	}
+}
+
+func TestPublishOutboundThreadID(t *testing.T) {
+	mb := NewMessageBus()
+	ctx := context.Background()
+	tests := []struct {
+		msg  OutboundMessage
+		want string
+	}{
+		{OutboundMessage{Channel: "slack", ChatID: "C1"}, ""},
+		{OutboundMessage{Channel: "slack", ChatID: "C1/1700000000.0001"}, "1700000000.0001"},
+		{OutboundMessage{Channel: "discord", ChatID: "123", ThreadID: "456"}, "456"},
+	}
+	for _, tt := range tests {
+		mb.PublishOutbound(tt.msg)
+		got, _ := mb.SubscribeOutbound(ctx)
+		if got.ThreadID != tt.want {
+			t.Errorf("%s thread ID = %q, want %q", tt.msg.ChatID, got.ThreadID, tt.want)
+		}
+	}
+}
+
+func TestStalled(t *testing.T) {
+	mb := NewMessageBus()
+	ctx := context.Background()
+	if mb.Stalled(0) {
+		t.Error("Stalled() with empty queues")
+	}
+
+	mb.PublishInbound(InboundMessage{Content: "first"})
+	mb.PublishInbound(InboundMessage{Content: "second"})
+	mb.ConsumeInbound(ctx)
+	// The agent is busy with the first message
+	if !mb.Stalled(0) {
+		t.Error("Stalled(0) = false with a message waiting behind a busy agent")
+	}
+	if mb.Stalled(time.Minute) {
+		t.Error("Stalled(time.Minute) = true right after the agent took a message")
+	}
+	mb.ConsumeInbound(ctx)
+	if mb.Stalled(0) {
+		t.Error("Stalled() once the agent caught up")
+	}
+
+	// An agent waiting for work takes a new message at once
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		mb.ConsumeInbound(ctx)
+	}()
+	for !mb.agent.waiting.Load() {
+		time.Sleep(time.Millisecond)
+	}
+	mb.PublishInbound(InboundMessage{Content: "third"})
+	if mb.Stalled(0) {
+		t.Error("Stalled() with the agent waiting for work")
+	}
+	<-done
+
+	// Nobody takes replies
+	mb.PublishOutbound(OutboundMessage{Content: "reply"})
+	time.Sleep(10 * time.Millisecond)
+	if !mb.Stalled(5 * time.Millisecond) {
+		t.Error("Stalled() = false with a reply nobody takes")
+	}
+}
+
+func TestNormalizeUserID(t *testing.T) {
+	tests := map[string]string{
+		"4915@s.whatsapp.net":      "4915@s.whatsapp.net",
+		"4915:12@s.whatsapp.net":   "4915@s.whatsapp.net",
+		"4915.1:12@s.whatsapp.net": "4915@s.whatsapp.net",
+		"8877:3@lid":               "8877@lid",
+		"123|alice":                "123",
+		"120363@g.us":              "120363@g.us",
+		"a:b@example.org":          "a:b@example.org",
+	}
+	for in, want := range tests {
+		if got := NormalizeUserID(in); got != want {
+			t.Errorf("NormalizeUserID(%q) = %q, want %q", in, got, want)
+		}
+	}
+	msg := InboundMessage{SenderID: "8877:3@lid", Metadata: map[string]string{"sender_pn": "4915:3@s.whatsapp.net"}}
+	if got := SenderUserID(msg); got != "4915@s.whatsapp.net" {
+		t.Errorf("SenderUserID() = %q", got)
+	}
+}
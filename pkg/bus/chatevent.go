@@ -0,0 +1,65 @@
+package bus
+
+import "sync"
+
+// Chat event types.
+const (
+	ChatBotAdded     = "bot_added"     // The bot joined a group
+	ChatBotRemoved   = "bot_removed"   // The bot was removed from a group, or left it
+	ChatMemberJoined = "member_joined" // Members other than the bot joined
+	ChatMemberLeft   = "member_left"   // Members other than the bot left
+	ChatArchived     = "archived"      // The chat was archived or deleted
+	ChatInvited      = "invited"       // The bot was invited to a group it is not in yet
+	ChatCall         = "call"          // Someone called the bot; ActorID is the caller
+)
+
+// ChatEvent reports a change to a chat rather than a message in it.
+type ChatEvent struct {
+	Channel string
+	ChatID  string
+	Type    string
+	// Members are who joined or left, for member events.
+	Members []ChatMember
+	// ActorID is the sender ID of whoever made the change, when known,
+	// such as the user who added the bot.
+	ActorID string
+	// Direct is set for a one-to-one chat, such as a user unblocking the
+	// bot on Telegram, which is not a group being added to.
+	Direct bool
+	// Name is the group's name, when the channel tells it.
+	Name string
+	// Invite is what the channel needs to join the group, for
+	// invitations. It means nothing outside the channel.
+	Invite string
+}
+
+// ChatMember is a user in a chat event. ID is a sender ID, as in
+// InboundMessage.SenderID.
+type ChatMember struct {
+	ID   string
+	Name string
+}
+
+// chatEvents holds the listeners told about chat events.
+type chatEvents struct {
+	mu        sync.Mutex
+	listeners []func(ChatEvent)
+}
+
+// OnChatEvent adds a listener told about each chat event channels
+// publish. Listeners are called synchronously and must not block for long.
+func (mb *MessageBus) OnChatEvent(fn func(ChatEvent)) {
+	mb.chatEvents.mu.Lock()
+	defer mb.chatEvents.mu.Unlock()
+	mb.chatEvents.listeners = append(mb.chatEvents.listeners, fn)
+}
+
+// PublishChatEvent hands e to the chat event listeners.
+func (mb *MessageBus) PublishChatEvent(e ChatEvent) {
+	mb.chatEvents.mu.Lock()
+	listeners := mb.chatEvents.listeners
+	mb.chatEvents.mu.Unlock()
+	for _, fn := range listeners {
+		fn(e)
+	}
+}
@@ -0,0 +1,76 @@
+package bus
+
+import "sync"
+
+// Interaction kinds: what the user answered with.
+const (
+	InteractionButton     = "button"      // Pressed a button
+	InteractionQuickReply = "quick_reply" // Picked a quick reply
+	InteractionMenu       = "menu"        // Picked from a menu
+)
+
+// Interaction reports a user answering a message's buttons, quick replies,
+// or menu, natively or by number where the channel lists them as text.
+// The answer also reaches the agent as an inbound message holding Data.
+type Interaction struct {
+	Channel  string
+	ChatID   string
+	SenderID string
+	Kind     string
+	// Data is that of the button, quick reply, or menu option chosen.
+	Data string
+	// MessageID is the platform ID of the message the choice was offered
+	// with, when the channel tells it.
+	MessageID string
+}
+
+// interactions holds the listeners told about interactions.
+type interactions struct {
+	mu        sync.Mutex
+	listeners []func(Interaction)
+}
+
+// OnInteraction adds a listener told about each interaction channels
+// publish. Listeners are called synchronously and must not block for long.
+func (mb *MessageBus) OnInteraction(fn func(Interaction)) {
+	mb.interactions.mu.Lock()
+	defer mb.interactions.mu.Unlock()
+	mb.interactions.listeners = append(mb.interactions.listeners, fn)
+}
+
+// PublishInteraction hands i to the interaction listeners.
+func (mb *MessageBus) PublishInteraction(i Interaction) {
+	mb.interactions.mu.Lock()
+	listeners := mb.interactions.listeners
+	mb.interactions.mu.Unlock()
+	for _, fn := range listeners {
+		fn(i)
+	}
+}
+
+// Choice is an answer a message offers that sends something back.
+type Choice struct {
+	Kind string
+	Text string
+	Data string
+}
+
+// Choices returns the answers msg offers: its buttons with Data, its quick
+// replies, and its menu options, in that order. Link buttons are left out.
+func (msg OutboundMessage) Choices() []Choice {
+	var choices []Choice
+	for _, b := range msg.Buttons {
+		if b.Data != "" {
+			choices = append(choices, Choice{Kind: InteractionButton, Text: b.Text, Data: b.Data})
+		}
+	}
+	for _, b := range msg.QuickReplies {
+		choices = append(choices, Choice{Kind: InteractionQuickReply, Text: b.Text, Data: b.Data})
+	}
+	if msg.Menu != nil {
+		for _, b := range msg.Menu.Options {
+			choices = append(choices, Choice{Kind: InteractionMenu, Text: b.Text, Data: b.Data})
+		}
+	}
+	return choices
+}
@@ -0,0 +1,61 @@
+package bus
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// SavePending writes inbound messages that could not be processed before
+// shutdown to path, so they can be replayed on the next start. The file is
+// written atomically (temp file + rename). An empty slice removes the file.
+func SavePending(path string, msgs []InboundMessage) error {
+	if len(msgs) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create pending directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(msgs, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal pending messages: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write pending messages: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to rename pending messages file: %w", err)
+	}
+	return nil
+}
+
+// LoadPending reads and removes the messages saved by SavePending.
+// A missing file is not an error.
+func LoadPending(path string) ([]InboundMessage, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var msgs []InboundMessage
+	if err := json.Unmarshal(data, &msgs); err != nil {
+		return nil, fmt.Errorf("failed to parse pending messages: %w", err)
+	}
+
+	if err := os.Remove(path); err != nil {
+		return msgs, fmt.Errorf("failed to remove pending messages file: %w", err)
+	}
+	return msgs, nil
+}
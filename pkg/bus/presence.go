@@ -0,0 +1,81 @@
+package bus
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Presence reports a user coming online or going offline, for users a
+// channel was asked to watch.
+type Presence struct {
+	Channel string
+	// UserID is the user's sender ID, as in InboundMessage.SenderID.
+	UserID string
+	Online bool
+	// LastSeen is when the user was last online, when going offline and
+	// the platform says.
+	LastSeen time.Time
+}
+
+// NormalizeUserID returns the part of a sender ID that stays the same for
+// a person: without a "|username" part, and for a WhatsApp JID without the
+// agent and device ("4915:12@s.whatsapp.net" is "4915@s.whatsapp.net"),
+// which is how presence is reported.
+func NormalizeUserID(id string) string {
+	id, _, _ = strings.Cut(id, "|")
+	user, server, ok := strings.Cut(id, "@")
+	if !ok || (server != "s.whatsapp.net" && server != "lid") {
+		return id
+	}
+	user, _, _ = strings.Cut(user, ":")
+	user, _, _ = strings.Cut(user, ".")
+	return user + "@" + server
+}
+
+// SenderUserID is NormalizeUserID of msg's sender. Where a channel knows
+// the sender by another ID too, it passes the phone-number one as
+// "sender_pn" metadata, which is used instead: WhatsApp does for senders
+// known by their LID.
+func SenderUserID(msg InboundMessage) string {
+	if pn := msg.Metadata["sender_pn"]; pn != "" {
+		return NormalizeUserID(pn)
+	}
+	return NormalizeUserID(msg.SenderID)
+}
+
+// PresenceWatch asks to be told when a user comes online. With a notify
+// chat, a message there says so; without one, the presence events on the
+// bus are all there is.
+type PresenceWatch struct {
+	Channel string `json:"channel"`
+	UserID  string `json:"user_id"`
+	// Name is how the notification refers to the user; UserID when empty.
+	Name          string `json:"name,omitempty"`
+	NotifyChannel string `json:"notify_channel,omitempty"`
+	NotifyChatID  string `json:"notify_chat_id,omitempty"`
+}
+
+// presenceEvents holds the listeners told about presence changes.
+type presenceEvents struct {
+	mu        sync.Mutex
+	listeners []func(Presence)
+}
+
+// OnPresence adds a listener told about each presence change channels
+// publish. Listeners are called synchronously and must not block for long.
+func (mb *MessageBus) OnPresence(fn func(Presence)) {
+	mb.presence.mu.Lock()
+	defer mb.presence.mu.Unlock()
+	mb.presence.listeners = append(mb.presence.listeners, fn)
+}
+
+// PublishPresence hands p to the presence listeners.
+func (mb *MessageBus) PublishPresence(p Presence) {
+	mb.presence.mu.Lock()
+	listeners := mb.presence.listeners
+	mb.presence.mu.Unlock()
+	for _, fn := range listeners {
+		fn(p)
+	}
+}
@@ -0,0 +1,133 @@
+package bus
+
+import (
+	"slices"
+	"sync"
+)
+
+// Processing reports that the agent started or finished working on a chat,
+// so the chat's channel can show its "working on it" indicator: typing, a
+// placeholder message, or a reaction.
+type Processing struct {
+	Channel string
+	ChatID  string
+	// MessageID is the inbound message being handled, from its
+	// "message_id" metadata, for channels that mark the message itself.
+	MessageID string
+	Active    bool
+}
+
+// processing counts the handlers working on each chat, with the
+// correlation IDs of the messages they handle, and the listeners told when
+// the first starts and the last finishes.
+type processing struct {
+	mu        sync.Mutex
+	active    map[string]int      // "channel:chat_id" -> handlers running
+	causes    map[string][]string // "channel:chat_id" -> correlation IDs handled
+	traces    map[string]string   // correlation ID -> trace ID
+	listeners []func(Processing)
+}
+
+// OnProcessing adds a listener told when the agent starts and finishes
+// working on a chat. Listeners are called synchronously and must not block.
+func (mb *MessageBus) OnProcessing(fn func(Processing)) {
+	mb.processing.mu.Lock()
+	defer mb.processing.mu.Unlock()
+	mb.processing.listeners = append(mb.processing.listeners, fn)
+}
+
+// StartProcessing marks msg's chat as being worked on until the returned
+// func is called. While several handlers work on one chat listeners hear
+// only of the first start and the last finish. Messages published to the
+// chat meanwhile carry msg's correlation ID.
+func (mb *MessageBus) StartProcessing(msg InboundMessage) (done func()) {
+	key := msg.Channel + ":" + msg.ChatID
+	p := Processing{Channel: msg.Channel, ChatID: msg.ChatID, MessageID: msg.Metadata["message_id"], Active: true}
+
+	mb.processing.mu.Lock()
+	if mb.processing.active == nil {
+		mb.processing.active = make(map[string]int)
+	}
+	mb.processing.active[key]++
+	if msg.CorrelationID != "" {
+		if mb.processing.causes == nil {
+			mb.processing.causes = make(map[string][]string)
+		}
+		mb.processing.causes[key] = append(mb.processing.causes[key], msg.CorrelationID)
+		if msg.TraceID != "" {
+			if mb.processing.traces == nil {
+				mb.processing.traces = make(map[string]string)
+			}
+			mb.processing.traces[msg.CorrelationID] = msg.TraceID
+		}
+	}
+	first := mb.processing.active[key] == 1
+	listeners := mb.processing.listeners
+	mb.processing.mu.Unlock()
+
+	if first {
+		for _, fn := range listeners {
+			fn(p)
+		}
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			mb.processing.mu.Lock()
+			mb.processing.active[key]--
+			last := mb.processing.active[key] == 0
+			if last {
+				delete(mb.processing.active, key)
+			}
+			mb.processing.removeCause(key, msg.CorrelationID)
+			listeners := mb.processing.listeners
+			mb.processing.mu.Unlock()
+
+			if last {
+				p.Active = false
+				for _, fn := range listeners {
+					fn(p)
+				}
+			}
+		})
+	}
+}
+
+// removeCause forgets one handler's correlation ID. Callers hold p.mu.
+func (p *processing) removeCause(key, id string) {
+	causes := p.causes[key]
+	for i, c := range causes {
+		if c == id {
+			causes = append(causes[:i:i], causes[i+1:]...)
+			break
+		}
+	}
+	if !slices.Contains(causes, id) {
+		delete(p.traces, id)
+	}
+	if len(causes) == 0 {
+		delete(p.causes, key)
+	} else {
+		p.causes[key] = causes
+	}
+}
+
+// correlationIDs returns the correlation IDs of the messages being handled
+// in a chat.
+func (mb *MessageBus) correlationIDs(channel, chatID string) []string {
+	mb.processing.mu.Lock()
+	defer mb.processing.mu.Unlock()
+	causes := mb.processing.causes[channel+":"+chatID]
+	if len(causes) == 0 {
+		return nil
+	}
+	return append([]string(nil), causes...)
+}
+
+// traceOf returns the trace of a message being handled, by correlation ID.
+func (mb *MessageBus) traceOf(correlationID string) string {
+	mb.processing.mu.Lock()
+	defer mb.processing.mu.Unlock()
+	return mb.processing.traces[correlationID]
+}
@@ -0,0 +1,39 @@
+package bus
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// consumer tracks whether the side taking messages off a queue, the agent
+// or the channel dispatcher, keeps taking them.
+type consumer struct {
+	waiting atomic.Bool
+	taken   atomic.Int64 // Unix nanoseconds of the last message taken
+}
+
+func (c *consumer) wait() {
+	c.waiting.Store(true)
+}
+
+func (c *consumer) took() {
+	c.taken.Store(time.Now().UnixNano())
+	c.waiting.Store(false)
+}
+
+// stalled reports whether the consumer has left queued messages waiting
+// for longer than after. A consumer waiting for work is never stalled.
+func (c *consumer) stalled(queued int, after time.Duration) bool {
+	if queued == 0 || c.waiting.Load() {
+		return false
+	}
+	return time.Since(time.Unix(0, c.taken.Load())) > after
+}
+
+// Stalled reports whether the agent or the channel dispatcher has taken no
+// message for longer than after while messages wait for it, as when a
+// turn hangs. A long turn with nothing queued behind it does not count.
+func (mb *MessageBus) Stalled(after time.Duration) bool {
+	inbound, outbound := mb.QueueLengths()
+	return mb.agent.stalled(inbound, after) || mb.dispatcher.stalled(outbound, after)
+}
@@ -0,0 +1,42 @@
+package bus
+
+import "sync"
+
+// Receipt statuses, in the order a message reaches them.
+const (
+	ReceiptDelivered = "delivered"
+	ReceiptRead      = "read"
+)
+
+// Receipt reports that messages the bot sent reached a recipient's device
+// or were read there. MessageIDs are platform message IDs.
+type Receipt struct {
+	Channel    string
+	ChatID     string
+	MessageIDs []string
+	Status     string
+}
+
+// receipts holds the listeners told about receipts.
+type receipts struct {
+	mu        sync.Mutex
+	listeners []func(Receipt)
+}
+
+// OnReceipt adds a listener told about each receipt channels publish.
+// Listeners are called synchronously and must not block for long.
+func (mb *MessageBus) OnReceipt(fn func(Receipt)) {
+	mb.receipts.mu.Lock()
+	defer mb.receipts.mu.Unlock()
+	mb.receipts.listeners = append(mb.receipts.listeners, fn)
+}
+
+// PublishReceipt hands r to the receipt listeners.
+func (mb *MessageBus) PublishReceipt(r Receipt) {
+	mb.receipts.mu.Lock()
+	listeners := mb.receipts.listeners
+	mb.receipts.mu.Unlock()
+	for _, fn := range listeners {
+		fn(r)
+	}
+}
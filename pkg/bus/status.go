@@ -0,0 +1,50 @@
+package bus
+
+import (
+	"sync"
+	"time"
+)
+
+// Channel connection states, as in channels.Manager.ChannelStates.
+const (
+	ChannelConnected    = "connected"
+	ChannelReconnecting = "reconnecting"
+)
+
+// ChannelStatus reports that a channel's connection went up or down, as it
+// happens rather than when the channel manager next looks.
+type ChannelStatus struct {
+	Channel string
+	State   string
+	// Error is why the connection dropped or the last attempt to restore
+	// it failed.
+	Error string
+	// Attempt counts the attempts to reconnect so far, and RetryIn is the
+	// wait before the next.
+	Attempt int
+	RetryIn time.Duration
+}
+
+// statuses holds the listeners told about channel statuses.
+type statuses struct {
+	mu        sync.Mutex
+	listeners []func(ChannelStatus)
+}
+
+// OnChannelStatus adds a listener told about each status channels publish.
+// Listeners are called synchronously and must not block for long.
+func (mb *MessageBus) OnChannelStatus(fn func(ChannelStatus)) {
+	mb.statuses.mu.Lock()
+	defer mb.statuses.mu.Unlock()
+	mb.statuses.listeners = append(mb.statuses.listeners, fn)
+}
+
+// PublishChannelStatus hands s to the status listeners.
+func (mb *MessageBus) PublishChannelStatus(s ChannelStatus) {
+	mb.statuses.mu.Lock()
+	listeners := mb.statuses.listeners
+	mb.statuses.mu.Unlock()
+	for _, fn := range listeners {
+		fn(s)
+	}
+}
@@ -0,0 +1,106 @@
+package bus
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+)
+
+// Messages are traced the way W3C Trace Context and OpenTelemetry trace
+// requests: a trace ID is shared by a message and everything it leads to,
+// and each inbound message's correlation ID serves as its span ID, so the
+// IDs can be handed to a tracing system as they are.
+
+// NewTraceID returns a random trace ID: 32 hex digits.
+func NewTraceID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+type traceKey struct{}
+
+type trace struct {
+	traceID string
+	spanID  string
+}
+
+// WithTrace returns a context carrying a trace ID and the ID of the step
+// being worked on, usually the correlation ID of the message handled.
+// Messages published and lines logged from the context carry both.
+func WithTrace(ctx context.Context, traceID, spanID string) context.Context {
+	if traceID == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, traceKey{}, trace{traceID: traceID, spanID: spanID})
+}
+
+// TraceFrom returns the trace ID and span ID stored by WithTrace, or
+// empty strings.
+func TraceFrom(ctx context.Context) (traceID, spanID string) {
+	if ctx == nil {
+		return "", ""
+	}
+	t, _ := ctx.Value(traceKey{}).(trace)
+	return t.traceID, t.spanID
+}
+
+// TraceFields adds ctx's trace to log fields as "trace_id" and "span_id"
+// and returns them, making a map if fields is nil.
+func TraceFields(ctx context.Context, fields map[string]interface{}) map[string]interface{} {
+	traceID, spanID := TraceFrom(ctx)
+	if traceID == "" {
+		return fields
+	}
+	if fields == nil {
+		fields = make(map[string]interface{}, 2)
+	}
+	fields["trace_id"] = traceID
+	if spanID != "" {
+		fields["span_id"] = spanID
+	}
+	return fields
+}
+
+// Traceparent formats a W3C traceparent header value, or returns "" when
+// the IDs do not fit one.
+func Traceparent(traceID, spanID string) string {
+	if !isHexID(traceID, 32) || !isHexID(spanID, 16) {
+		return ""
+	}
+	return "00-" + traceID + "-" + spanID + "-01"
+}
+
+// ParseTraceparent reads a W3C traceparent header value, returning its
+// trace ID and parent span ID.
+func ParseTraceparent(value string) (traceID, parentID string, ok bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return "", "", false
+	}
+	traceID, parentID = strings.ToLower(parts[1]), strings.ToLower(parts[2])
+	if !isHexID(traceID, 32) || !isHexID(parentID, 16) {
+		return "", "", false
+	}
+	return traceID, parentID, true
+}
+
+// isHexID reports whether id is n lowercase hex digits, not all zero, as
+// trace context IDs must be.
+func isHexID(id string, n int) bool {
+	if len(id) != n {
+		return false
+	}
+	zero := true
+	for _, r := range id {
+		switch {
+		case r == '0':
+		case r >= '1' && r <= '9', r >= 'a' && r <= 'f':
+			zero = false
+		default:
+			return false
+		}
+	}
+	return !zero
+}
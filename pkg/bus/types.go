@@ -1,19 +1,182 @@
 package bus
 
+import "strings"
+
 type InboundMessage struct {
-	Channel    string            `json:"channel"`
-	SenderID   string            `json:"sender_id"`
-	ChatID     string            `json:"chat_id"`
+	Channel  string `json:"channel"`
+	SenderID string `json:"sender_id"`
+	ChatID   string `json:"chat_id"`
+	// ThreadID is the thread the message was posted in, if any: a Slack
+	// thread's parent ts, a Telegram forum topic, or a Discord thread's
+	// channel. Slack and Telegram threads are also in ChatID, as
+	// "chat/thread"; a Discord thread is a chat of its own.
+	ThreadID   string            `json:"thread_id,omitempty"`
 	Content    string            `json:"content"`
 	Media      []string          `json:"media,omitempty"`
 	SessionKey string            `json:"session_key"`
 	Metadata   map[string]string `json:"metadata,omitempty"`
+	// Reaction is set when the user reacted to a message rather than wrote
+	// one. Content then holds the command the reaction stands for, such as
+	// "/good" for a thumbs-up, or nothing.
+	Reaction *Reaction `json:"reaction,omitempty"`
+	// Change is set when the user edited or deleted one of their earlier
+	// messages rather than wrote a new one. Content then holds the edited
+	// text, or nothing for a deletion.
+	Change *Change `json:"change,omitempty"`
+	// Quote is the earlier message this one replies to or quotes, if any.
+	Quote *Quote `json:"quote,omitempty"`
+	// CorrelationID identifies the message in the replies it leads to. The
+	// bus assigns one on publishing when it is empty.
+	CorrelationID string `json:"correlation_id,omitempty"`
+	// TraceID is shared by the message and everything it leads to:
+	// replies, tool calls, and messages handled on its behalf, such as a
+	// subagent's result. The bus assigns one on publishing when it is
+	// empty; see NewTraceID.
+	TraceID string `json:"trace_id,omitempty"`
+	// ParentID is the correlation ID of the message whose handling led to
+	// this one, or "" for a message from a chat.
+	ParentID string `json:"parent_id,omitempty"`
+}
+
+// ClaimedSenderPrefix starts the sender ID of a message whose sender the
+// channel took from the message itself rather than verified, such as the
+// "from" field of an MQTT payload. Allow lists may name such senders, but
+// they are never operators.
+const ClaimedSenderPrefix = "claimed:"
+
+// IsClaimedSender reports whether senderID was claimed by the message
+// rather than verified by the channel.
+func IsClaimedSender(senderID string) bool {
+	return strings.HasPrefix(senderID, ClaimedSenderPrefix)
+}
+
+// Quote is an earlier chat message that an inbound message replies to.
+type Quote struct {
+	// MessageID is the platform ID of the quoted message.
+	MessageID string `json:"message_id,omitempty"`
+	SenderID  string `json:"sender_id,omitempty"`
+	// Content is the quoted text: the part the user picked out, or the
+	// whole message. It is empty when the platform only gave the ID.
+	Content string `json:"content,omitempty"`
 }
 
 type OutboundMessage struct {
+	// ID, when set, has the channel manager track the message's delivery
+	// under it; see channels.Manager.Send.
+	ID      string `json:"id,omitempty"`
 	Channel string `json:"channel"`
 	ChatID  string `json:"chat_id"`
-	Content string `json:"content"`
+	// ThreadID posts the message in a thread of ChatID, as in
+	// InboundMessage.ThreadID. The bus fills it in from a "chat/thread"
+	// ChatID; channels without threads ignore it.
+	ThreadID string `json:"thread_id,omitempty"`
+	Content  string `json:"content"`
+	// ReplyToID, when set, quotes the earlier message in the chat with
+	// this platform ID, as found in the "message_id" metadata of inbound
+	// messages, so the message shows as a reply to it. A reply split into
+	// several messages quotes from the first. Channels that cannot quote
+	// ignore it.
+	ReplyToID string `json:"reply_to_id,omitempty"`
+	// Partial marks a streaming progress update. Content holds the full
+	// text generated so far; the final message follows without Partial.
+	Partial bool `json:"partial,omitempty"`
+	// Media lists local files (images, documents) to deliver with the
+	// message. Channels without native attachment support receive a text
+	// note instead.
+	Media []string `json:"media,omitempty"`
+	// Buttons are offered under the message. Channels without native
+	// buttons list them in the text instead, numbered so the user can
+	// answer with a number.
+	Buttons []Button `json:"buttons,omitempty"`
+	// QuickReplies are suggested answers. Unlike buttons they stand for
+	// what the user would type, and go away once one is used where the
+	// channel can tell. They fall back to numbered text like buttons.
+	QuickReplies []Button `json:"quick_replies,omitempty"`
+	// Menu is a drop-down list of choices offered under the message.
+	Menu *Menu `json:"menu,omitempty"`
+	// Reaction, when set, makes this a reaction to an earlier message in
+	// the chat instead of a new message; the other fields are ignored.
+	// Channels that cannot react drop it.
+	Reaction *Reaction `json:"reaction,omitempty"`
+	// Delete, when set, makes this the deletion of one of the bot's
+	// earlier messages in the chat, by platform message ID, instead of a
+	// new message; the other fields are ignored. Channels that cannot
+	// delete messages drop it.
+	Delete string `json:"delete,omitempty"`
+	// Priority PriorityLow marks a minor notification, which the channel
+	// manager holds for the chat's digest when digests are enabled instead
+	// of sending it at once.
+	Priority string `json:"priority,omitempty"`
+	// CorrelationIDs are those of the inbound messages the agent was
+	// handling in the chat when this was published. The bus fills them in.
+	CorrelationIDs []string `json:"correlation_ids,omitempty"`
+	// TraceID and ParentID are the trace and correlation ID of the first
+	// of those messages, filled in by the bus like CorrelationIDs. A
+	// message published outside any has a trace of its own.
+	TraceID  string `json:"trace_id,omitempty"`
+	ParentID string `json:"parent_id,omitempty"`
+}
+
+// PriorityLow is the OutboundMessage.Priority of minor notifications.
+const PriorityLow = "low"
+
+// Change is an edit or deletion of an earlier chat message by its sender.
+type Change struct {
+	// MessageID is the platform ID of the message changed, as found in the
+	// "message_id" metadata of inbound messages.
+	MessageID string `json:"message_id"`
+	// Deleted is set when the message was deleted; it was edited otherwise.
+	Deleted bool `json:"deleted,omitempty"`
 }
 
+// Reaction is an emoji reaction to a chat message, added or removed.
+type Reaction struct {
+	// MessageID is the platform ID of the message reacted to, as found in
+	// the "message_id" metadata of inbound messages.
+	MessageID string `json:"message_id"`
+	// Emoji is the reaction itself, such as "✅". Channels translate to and
+	// from their own names, e.g. Slack's "white_check_mark".
+	Emoji  string `json:"emoji"`
+	Remove bool   `json:"remove,omitempty"`
+	// Author is the sender of the message reacted to, which WhatsApp needs
+	// to address a message in a group. Optional elsewhere.
+	Author string `json:"author,omitempty"`
+	// On says whose message an inbound reaction is on, ReactionOnBot or
+	// ReactionOnUser, or is empty where the channel cannot tell.
+	On string `json:"on,omitempty"`
+	// Text is the text of the message reacted to, on inbound reactions
+	// from channels that had to fetch the message anyway.
+	Text string `json:"text,omitempty"`
+}
+
+// Whose message a reaction is on, see Reaction.On.
+const (
+	ReactionOnBot  = "bot"
+	ReactionOnUser = "user"
+)
+
+// MaxButtonData is the longest Button.Data every channel can carry.
+const MaxButtonData = 64
+
+// Button is a choice offered with an outbound message. Pressing a button
+// with Data sends Data back from the user as an ordinary message, so it
+// can be a command such as "/approve 1a2b", and publishes an Interaction.
+// A button with URL opens it.
+type Button struct {
+	Text string `json:"text"`
+	Data string `json:"data,omitempty"`
+	URL  string `json:"url,omitempty"`
+}
+
+// Menu is a list of choices picked from a drop-down. Options carry Data;
+// a URL has no place in a menu.
+type Menu struct {
+	// Placeholder is shown before anything is picked, e.g. "Pick a size".
+	Placeholder string   `json:"placeholder,omitempty"`
+	Options     []Button `json:"options"`
+}
+
+// MaxMenuOptions is the most options every channel's menu can hold.
+const MaxMenuOptions = 25
+
 type MessageHandler func(InboundMessage) error
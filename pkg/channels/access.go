@@ -0,0 +1,191 @@
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+const (
+	// grantsBucket holds senders allowed at runtime, keyed
+	// "channel:sender_id".
+	grantsBucket = "allowlist"
+	// dedupBucket holds claims on platform message IDs and reactions
+	// already handled.
+	dedupBucket = "dedup"
+	// dedupTTL covers platform redeliveries, such as Slack event retries
+	// or Telegram updates fetched again after a restart.
+	dedupTTL = 24 * time.Hour
+)
+
+// Grant records who allowed a sender and when.
+type Grant struct {
+	Account string    `json:"-"` // "channel:sender_id"
+	By      string    `json:"by"`
+	Time    time.Time `json:"time"`
+}
+
+// isGranted reports whether senderID, or any part of a composite
+// "123|username" ID, was granted access at runtime.
+func (c *BaseChannel) isGranted(senderID string) bool {
+	if c.state == nil {
+		return false
+	}
+	ctx := context.Background()
+	for _, id := range append([]string{senderID}, strings.Split(senderID, "|")...) {
+		if id == "" {
+			continue
+		}
+		_, err := c.state.Get(ctx, grantsBucket, c.name+":"+id)
+		if err == nil {
+			return true
+		}
+		if !errors.Is(err, state.ErrNotFound) {
+			logger.WarnCF("channels", "Failed to check allowlist grant",
+				map[string]interface{}{"channel": c.name, "error": err.Error()})
+			return false
+		}
+	}
+	return false
+}
+
+// isDuplicate reports whether the platform message in metadata was already
+// handled. Messages without an ID are never duplicates, and reactions,
+// which carry the ID of the message reacted to, are checked by
+// isDuplicateReaction instead. A store error lets the message through.
+func (c *BaseChannel) isDuplicate(chatID string, metadata map[string]string) bool {
+	if c.state == nil || metadata["reaction"] != "" {
+		return false
+	}
+	id := metadata["message_id"]
+	if id == "" {
+		id = metadata["message_ts"]
+	}
+	if id == "" {
+		return false
+	}
+
+	claimed, err := c.state.Claim(context.Background(), dedupBucket, c.name+":"+chatID+":"+id, dedupTTL)
+	if err != nil {
+		logger.WarnCF("channels", "Failed to check for duplicate message",
+			map[string]interface{}{"channel": c.name, "error": err.Error()})
+		return false
+	}
+	if !claimed {
+		logger.DebugCF("channels", "Dropping duplicate message",
+			map[string]interface{}{"channel": c.name, "chat_id": chatID, "message_id": id})
+	}
+	return !claimed
+}
+
+// isDuplicateReaction reports whether a reaction was already handled: the
+// same sender putting the same emoji on the same message, or taking it
+// off, again. Reactions without a message ID are never duplicates. A store
+// error lets the reaction through.
+func (c *BaseChannel) isDuplicateReaction(senderID, chatID string, reaction bus.Reaction) bool {
+	if c.state == nil || reaction.MessageID == "" {
+		return false
+	}
+
+	key := c.name + ":" + chatID + ":" + reaction.MessageID + ":" + senderID + ":" + reaction.Emoji
+	if reaction.Remove {
+		key += ":removed"
+	}
+	claimed, err := c.state.Claim(context.Background(), dedupBucket, key, dedupTTL)
+	if err != nil {
+		logger.WarnCF("channels", "Failed to check for duplicate reaction",
+			map[string]interface{}{"channel": c.name, "error": err.Error()})
+		return false
+	}
+	if !claimed {
+		logger.DebugCF("channels", "Dropping duplicate reaction",
+			map[string]interface{}{"channel": c.name, "chat_id": chatID, "message_id": reaction.MessageID})
+	}
+	return !claimed
+}
+
+// SetStateStore hands the state store to every channel, for message dedup
+// and runtime allowlist grants.
+func (m *Manager) SetStateStore(store state.Store) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.state = store
+	for _, channel := range m.channels {
+		if sc, ok := channel.(StateChannel); ok {
+			sc.SetStateStore(store)
+		}
+	}
+}
+
+// Grant allows a sender on a channel in addition to its configured
+// allowlist. by names who granted it, for the record.
+func (m *Manager) Grant(ctx context.Context, channel, senderID, by string) error {
+	store, err := m.grantStore(channel)
+	if err != nil {
+		return err
+	}
+	return state.PutJSON(ctx, store, grantsBucket, channel+":"+senderID, Grant{By: by, Time: time.Now()})
+}
+
+// Revoke removes a runtime grant. It reports whether one existed; senders on
+// the configured allowlist keep their access.
+func (m *Manager) Revoke(ctx context.Context, channel, senderID string) (bool, error) {
+	store, err := m.grantStore(channel)
+	if err != nil {
+		return false, err
+	}
+	key := channel + ":" + senderID
+	if _, err := store.Get(ctx, grantsBucket, key); err != nil {
+		if errors.Is(err, state.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, store.Delete(ctx, grantsBucket, key)
+}
+
+// Grants lists the runtime grants sorted by account.
+func (m *Manager) Grants(ctx context.Context) ([]Grant, error) {
+	m.mu.RLock()
+	store := m.state
+	m.mu.RUnlock()
+	if store == nil {
+		return nil, nil
+	}
+
+	entries, err := store.List(ctx, grantsBucket)
+	if err != nil {
+		return nil, err
+	}
+	var out []Grant
+	for account, data := range entries {
+		var g Grant
+		if err := json.Unmarshal(data, &g); err != nil {
+			continue
+		}
+		g.Account = account
+		out = append(out, g)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Account < out[j].Account })
+	return out, nil
+}
+
+func (m *Manager) grantStore(channel string) (state.Store, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.state == nil {
+		return nil, fmt.Errorf("no state store configured")
+	}
+	if _, ok := m.channels[channel]; !ok {
+		return nil, fmt.Errorf("channel %s is not enabled", channel)
+	}
+	return m.state, nil
+}
@@ -0,0 +1,96 @@
+package channels
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+func TestRuntimeGrants(t *testing.T) {
+	ch := &restartableChannel{BaseChannel: NewBaseChannel("telegram", nil, nil, []string{"1"})}
+	m := &Manager{channels: map[string]Channel{"telegram": ch}}
+	ctx := context.Background()
+
+	if err := m.Grant(ctx, "telegram", "2", "telegram:1"); err == nil {
+		t.Error("Grant() without a state store should fail")
+	}
+	m.SetStateStore(state.NewMemoryStore())
+
+	if ch.IsAllowed("2|bob") {
+		t.Fatal("sender allowed before grant")
+	}
+	if err := m.Grant(ctx, "telegram", "2", "telegram:1"); err != nil {
+		t.Fatalf("Grant() error = %v", err)
+	}
+	if err := m.Grant(ctx, "discord", "2", "telegram:1"); err == nil {
+		t.Error("Grant() on a disabled channel should fail")
+	}
+	if !ch.IsAllowed("2|bob") {
+		t.Error("granted sender not allowed")
+	}
+
+	grants, err := m.Grants(ctx)
+	if err != nil || len(grants) != 1 || grants[0].Account != "telegram:2" || grants[0].By != "telegram:1" {
+		t.Errorf("Grants() = %+v, %v", grants, err)
+	}
+
+	if ok, err := m.Revoke(ctx, "telegram", "2"); !ok || err != nil {
+		t.Fatalf("Revoke() = %v, %v", ok, err)
+	}
+	if ok, _ := m.Revoke(ctx, "telegram", "2"); ok {
+		t.Error("second Revoke() = true")
+	}
+	if ch.IsAllowed("2") {
+		t.Error("revoked sender still allowed")
+	}
+	if !ch.IsAllowed("1") {
+		t.Error("configured sender lost access")
+	}
+}
+
+func TestBaseChannelDropsDuplicates(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	ch := NewBaseChannel("slack", nil, msgBus, nil)
+	ch.SetStateStore(state.NewMemoryStore())
+
+	ch.HandleMessage("U1", "C1", "hello", nil, map[string]string{"message_ts": "1.1"})
+	ch.HandleMessage("U1", "C1", "hello", nil, map[string]string{"message_ts": "1.1"})
+	ch.HandleMessage("U1", "C1", "again", nil, map[string]string{"message_ts": "1.2"})
+	ch.HandleReaction("U2", "C1", bus.Reaction{MessageID: "1.0", Emoji: "+1"}, nil)
+	ch.HandleReaction("U3", "C1", bus.Reaction{MessageID: "1.0", Emoji: "+1"}, nil)
+
+	if in, _ := msgBus.QueueLengths(); in != 4 {
+		t.Errorf("%d messages published, want 4 (one duplicate dropped)", in)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	first, _ := msgBus.ConsumeInbound(ctx)
+	second, _ := msgBus.ConsumeInbound(ctx)
+	if first.Content != "hello" || second.Content != "again" {
+		t.Errorf("published %q, %q", first.Content, second.Content)
+	}
+}
+
+func TestBaseChannelDropsDuplicateReactions(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	ch := NewBaseChannel("slack", nil, msgBus, nil)
+	ch.SetStateStore(state.NewMemoryStore())
+
+	thumbsUp := bus.Reaction{MessageID: "1.0", Emoji: "+1"}
+	ch.HandleReaction("U2", "C1", thumbsUp, nil)
+	ch.HandleReaction("U2", "C1", thumbsUp, nil) // redelivered
+	ch.HandleReaction("U2", "C1", bus.Reaction{MessageID: "1.0", Emoji: "heart"}, nil)
+	ch.HandleReaction("U2", "C1", bus.Reaction{MessageID: "1.1", Emoji: "+1"}, nil)
+	ch.HandleReaction("U2", "C2", thumbsUp, nil)
+	ch.HandleReaction("U3", "C1", thumbsUp, nil)
+	ch.HandleReaction("U2", "C1", bus.Reaction{MessageID: "1.0", Emoji: "+1", Remove: true}, nil)
+	ch.HandleReaction("U2", "C1", bus.Reaction{MessageID: "1.0", Emoji: "+1", Remove: true}, nil)
+
+	if in, _ := msgBus.QueueLengths(); in != 6 {
+		t.Errorf("%d reactions published, want 6 (two duplicates dropped)", in)
+	}
+}
@@ -0,0 +1,172 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package channels
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/i18n"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/render"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// zipRatio bounds the files worth zipping to fit a limit: ones at most
+// this many times the limit. Text and logs shrink that much; media and
+// archives do not.
+const zipRatio = 4
+
+// fitAttachments makes msg's attachments deliverable on a channel with
+// caps. One over the channel's size limit is compressed to fit where it
+// can, shared as a link from the media store otherwise, and replaced by a
+// note saying why it was not sent as a last resort. Attachments on a
+// channel without any get links too when the store is set. The returned
+// func removes the compressed copies once the message is sent.
+func (m *Manager) fitAttachments(msg bus.OutboundMessage, caps render.Capabilities) (bus.OutboundMessage, func()) {
+	if len(msg.Media) == 0 || msg.Partial {
+		return msg, func() {}
+	}
+	m.mu.RLock()
+	store := m.media
+	m.mu.RUnlock()
+
+	var kept, notes, tmpDirs []string
+	for _, path := range msg.Media {
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			// Remote URLs, and files the channel will report missing
+			kept = append(kept, path)
+			continue
+		}
+		size := info.Size()
+		if caps.Media && (caps.MaxAttachment <= 0 || size <= caps.MaxAttachment) {
+			kept = append(kept, path)
+			continue
+		}
+		if !caps.Media && store == nil {
+			kept = append(kept, path) // Rendered as a note naming the file
+			continue
+		}
+
+		if caps.Media {
+			if small, dir, err := compressAttachment(path, size, caps.MaxAttachment); err == nil {
+				logger.InfoCF("channels", "Compressed attachment to fit channel limit", map[string]interface{}{
+					"channel": msg.Channel, "file": filepath.Base(path), "size": size, "limit": caps.MaxAttachment,
+				})
+				kept = append(kept, small)
+				tmpDirs = append(tmpDirs, dir)
+				continue
+			}
+		}
+		name := filepath.Base(path)
+		if store != nil {
+			link, err := store.Share(path)
+			if err == nil {
+				notes = append(notes, i18n.T(msg.Channel, msg.ChatID, "media.link", name, utils.FormatBytes(size), link))
+				continue
+			}
+			logger.WarnCF("channels", "Failed to share attachment by link", map[string]interface{}{
+				"channel": msg.Channel, "file": name, "error": err.Error(),
+			})
+		}
+		if !caps.Media {
+			kept = append(kept, path)
+			continue
+		}
+		logger.WarnCF("channels", "Attachment too large for channel", map[string]interface{}{
+			"channel": msg.Channel, "file": name, "size": size, "limit": caps.MaxAttachment,
+		})
+		notes = append(notes, i18n.T(msg.Channel, msg.ChatID, "media.too_large",
+			name, utils.FormatBytes(size), utils.FormatBytes(caps.MaxAttachment)))
+	}
+
+	msg.Media = kept
+	if len(notes) > 0 {
+		if msg.Content != "" {
+			msg.Content += "\n"
+		}
+		msg.Content += strings.Join(notes, "\n")
+	}
+	return msg, func() {
+		for _, dir := range tmpDirs {
+			os.RemoveAll(dir)
+		}
+	}
+}
+
+// compressAttachment writes a copy of path of at most limit bytes into a
+// new temporary directory: images re-encoded smaller, other files zipped.
+// It returns the copy and the directory to remove once it is sent.
+func compressAttachment(path string, size, limit int64) (string, string, error) {
+	dir, err := os.MkdirTemp("", "picoclaw-attachment-")
+	if err != nil {
+		return "", "", err
+	}
+	out, err := compressInto(dir, path, size, limit)
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", "", err
+	}
+	return out, dir, nil
+}
+
+func compressInto(dir, path string, size, limit int64) (string, error) {
+	name := filepath.Base(path)
+	if utils.IsImageFile(name, "") {
+		data, err := utils.CompressImage(path, limit)
+		if err != nil {
+			return "", err
+		}
+		out := filepath.Join(dir, strings.TrimSuffix(name, filepath.Ext(name))+".jpg")
+		return out, os.WriteFile(out, data, 0o600)
+	}
+
+	if size > limit*zipRatio {
+		return "", os.ErrInvalid
+	}
+	out := filepath.Join(dir, name+".zip")
+	if err := zipFile(path, out); err != nil {
+		return "", err
+	}
+	info, err := os.Stat(out)
+	if err != nil {
+		return "", err
+	}
+	if info.Size() > limit {
+		return "", os.ErrInvalid
+	}
+	return out, nil
+}
+
+func zipFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	zw := zip.NewWriter(f)
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: filepath.Base(src), Method: zip.Deflate})
+	if err == nil {
+		_, err = io.Copy(w, in)
+	}
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,109 @@
+package channels
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/media"
+	"github.com/sipeed/picoclaw/pkg/render"
+)
+
+func writeNoise(t *testing.T, path string, size int) {
+	t.Helper()
+	data := make([]byte, size)
+	rand.New(rand.NewSource(1)).Read(data)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFitAttachments(t *testing.T) {
+	dir := t.TempDir()
+	small := filepath.Join(dir, "small.txt")
+	writeNoise(t, small, 100)
+	video := filepath.Join(dir, "clip.mp4")
+	writeNoise(t, video, 5000)
+	logFile := filepath.Join(dir, "app.log")
+	if err := os.WriteFile(logFile, []byte(strings.Repeat("GET /healthz 200\n", 200)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	photo := filepath.Join(dir, "photo.png")
+	img := image.NewRGBA(image.Rect(0, 0, 300, 300))
+	rng := rand.New(rand.NewSource(2))
+	for y := 0; y < 300; y++ {
+		for x := 0; x < 300; x++ {
+			img.Set(x, y, color.RGBA{uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256)), 255})
+		}
+	}
+	f, err := os.Create(photo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	store, err := media.NewStore(filepath.Join(dir, "store"), "https://bot.example.com", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	limited := render.Capabilities{Media: true, MaxAttachment: 1000}
+	tests := []struct {
+		name      string
+		caps      render.Capabilities
+		store     *media.Store
+		file      string
+		wantMedia string // Base name of the attachment sent, "" for none
+		wantNote  string
+	}{
+		{"fits", limited, nil, small, "small.txt", ""},
+		{"no limit", render.Capabilities{Media: true}, nil, video, "clip.mp4", ""},
+		{"zipped", limited, nil, logFile, "app.log.zip", ""},
+		{"image re-encoded", render.Capabilities{Media: true, MaxAttachment: 150 << 10}, nil, photo, "photo.jpg", ""},
+		{"refused", limited, nil, video, "", "[clip.mp4 is too large to send here: 4.9 KB, the limit is 1000 B]"},
+		{"linked", limited, store, video, "", "clip.mp4 (4.9 KB): https://bot.example.com/media/"},
+		{"linked without media", render.Capabilities{}, store, small, "", "small.txt (100 B): https://bot.example.com/media/"},
+		// Left for the renderer to name
+		{"no media, no store", render.Capabilities{}, nil, small, "small.txt", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Manager{media: tt.store}
+			got, cleanup := m.fitAttachments(bus.OutboundMessage{Channel: "test", ChatID: "1", Content: "Here", Media: []string{tt.file}}, tt.caps)
+			defer cleanup()
+
+			var names []string
+			for _, p := range got.Media {
+				names = append(names, filepath.Base(p))
+				if _, err := os.Stat(p); err != nil {
+					t.Errorf("attachment missing: %v", err)
+				}
+			}
+			if strings.Join(names, ",") != tt.wantMedia {
+				t.Errorf("Media = %q, want %q", names, tt.wantMedia)
+			}
+			if tt.wantNote == "" && got.Content != "Here" {
+				t.Errorf("Content = %q", got.Content)
+			}
+			if tt.wantNote != "" && !strings.HasPrefix(got.Content, "Here\n"+tt.wantNote) {
+				t.Errorf("Content = %q, want note %q", got.Content, tt.wantNote)
+			}
+			if tt.caps.MaxAttachment > 0 {
+				for _, p := range got.Media {
+					if info, _ := os.Stat(p); info.Size() > tt.caps.MaxAttachment {
+						t.Errorf("%s is %d bytes, over the limit", p, info.Size())
+					}
+				}
+			}
+		})
+	}
+}
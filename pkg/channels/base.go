@@ -3,9 +3,19 @@ package channels
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/commands"
+	"github.com/sipeed/picoclaw/pkg/contacts"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/media"
+	"github.com/sipeed/picoclaw/pkg/render"
+	"github.com/sipeed/picoclaw/pkg/state"
+	"github.com/sipeed/picoclaw/pkg/utils"
 )
 
 type Channel interface {
@@ -17,12 +27,159 @@ type Channel interface {
 	IsAllowed(senderID string) bool
 }
 
+// EditableChannel is implemented by channels that can update a sent message
+// in place. They receive partial (streaming) outbound messages as-is; other
+// channels receive completed paragraphs instead (see streamChunker).
+type EditableChannel interface {
+	SupportsEdits() bool
+}
+
+// ConnectionChannel is implemented by channels whose connection can drop
+// while they run, so status reports can tell a live channel from one that
+// is reconnecting.
+type ConnectionChannel interface {
+	Connected() bool
+}
+
+// QRChannel is implemented by channels that pair by scanning a QR code.
+// With a handler set they hand each code to it instead of drawing it in the
+// terminal, and pass "" once pairing ends.
+type QRChannel interface {
+	SetQRHandler(handler func(code string))
+}
+
+// MediaChannel is implemented by channels that can deliver the files in
+// OutboundMessage.Media as native attachments. Other channels get a text
+// note naming each file instead (see Manager.deliver).
+type MediaChannel interface {
+	SupportsMedia() bool
+}
+
+// CapabilityChannel is implemented by channels that describe what they can
+// deliver. Outbound messages are rendered to fit before Send sees them.
+type CapabilityChannel interface {
+	Capabilities() render.Capabilities
+}
+
+// CapabilitiesOf returns what channel can deliver. A channel that does not
+// describe itself gets Markdown as written, and attachments and edits when
+// it implements MediaChannel or EditableChannel.
+func CapabilitiesOf(channel Channel) render.Capabilities {
+	if cc, ok := channel.(CapabilityChannel); ok {
+		return cc.Capabilities()
+	}
+	caps := render.Capabilities{Markup: render.Markdown}
+	if media, ok := channel.(MediaChannel); ok {
+		caps.Media = media.SupportsMedia()
+	}
+	if editable, ok := channel.(EditableChannel); ok {
+		caps.Edits = editable.SupportsEdits()
+	}
+	return caps
+}
+
+// IndicatorChannel is implemented by channels that can show a chat that
+// the agent is working on a reply: typing, a placeholder message, or a
+// reaction on the message being handled (messageID, which may be empty).
+// The manager starts the indicator when the agent picks up a message and
+// calls stop once the agent is done with it.
+type IndicatorChannel interface {
+	StartIndicator(ctx context.Context, chatID, messageID string) (stop func())
+}
+
+// ReactionChannel is implemented by channels that can add and remove the
+// bot's own emoji reactions on chat messages, see bus.Reaction.
+type ReactionChannel interface {
+	React(ctx context.Context, chatID string, reaction bus.Reaction) error
+}
+
+// DeleteChannel is implemented by channels that can delete the bot's own
+// earlier messages, see bus.OutboundMessage.Delete.
+type DeleteChannel interface {
+	DeleteMessage(ctx context.Context, chatID, messageID string) error
+}
+
+// PresenceChannel is implemented by channels that can watch users come
+// online and go offline, publishing bus.Presence as they do. Subscribe
+// returns the user's ID as the channel normalizes it, which is the UserID
+// of the events published for them.
+type PresenceChannel interface {
+	SubscribePresence(ctx context.Context, userID string) (string, error)
+	UnsubscribePresence(ctx context.Context, userID string) error
+}
+
+// ContactChannel is implemented by channels that can list the people in
+// their address book, for the contact directory.
+type ContactChannel interface {
+	Contacts(ctx context.Context) ([]contacts.Contact, error)
+}
+
+// StateChannel is implemented by channels that keep runtime state, such as
+// dedup markers and allowlist grants, in the shared state store. Every
+// channel built on BaseChannel implements it.
+type StateChannel interface {
+	SetStateStore(store state.Store)
+}
+
+// FilterChannel is implemented by channels that pass inbound messages
+// through filters before publishing them, see InboundFilter. Every channel
+// built on BaseChannel implements it.
+type FilterChannel interface {
+	AddFilter(name string, filter InboundFilter)
+}
+
+// PairableChannel is implemented by channels whose login can be reset and
+// paired again at runtime, such as WhatsApp's linked-device session.
+// Repair returns a pairing code when the channel supports one for phone.
+type PairableChannel interface {
+	Repair(ctx context.Context, phone string) (string, error)
+}
+
+// GroupChannel is implemented by channels that can join a group they were
+// invited to and leave one, for group approval. invite is the
+// bus.ChatEvent.Invite of the invitation.
+type GroupChannel interface {
+	JoinGroup(ctx context.Context, chatID, invite string) error
+	LeaveGroup(ctx context.Context, chatID string) error
+}
+
+// WebhookChannel is implemented by channels whose platform delivers
+// messages by calling a webhook, such as Twilio's. The gateway serves
+// handler at path on its public health endpoints, so the handler checks
+// that requests come from the platform itself.
+type WebhookChannel interface {
+	Webhook() (path string, handler http.Handler)
+}
+
+// MediaStoreChannel is implemented by channels that send attachments as
+// links the platform fetches, such as Twilio's MMS. They get the media
+// store through Manager.SetMediaStore, and send no attachments without it.
+type MediaStoreChannel interface {
+	SetMediaStore(store *media.Store)
+}
+
+// CommandChannel is implemented by channels that offer the slash commands
+// in a native menu, such as Discord's. Choosing a command there sends it
+// as a message from the user, so it is handled as if typed.
+type CommandChannel interface {
+	SetCommands(cmds []commands.Command)
+}
+
 type BaseChannel struct {
 	config    interface{}
 	bus       *bus.MessageBus
-	running   bool
+	running   atomic.Bool // Cleared by a crashed loop, see Go
 	name      string
 	allowList []string
+	state     state.Store // nil until SetStateStore
+
+	choicesMu sync.Mutex
+	choices   map[string]offer // Offered choices by chat ID, see OfferChoices
+
+	filtersMu sync.RWMutex
+	filters   []namedFilter // Run after the allowlist, see AddFilter
+
+	stats channelStats
 }
 
 func NewBaseChannel(name string, config interface{}, bus *bus.MessageBus, allowList []string) *BaseChannel {
@@ -31,7 +188,6 @@ func NewBaseChannel(name string, config interface{}, bus *bus.MessageBus, allowL
 		bus:       bus,
 		name:      name,
 		allowList: allowList,
-		running:   false,
 	}
 }
 
@@ -40,13 +196,24 @@ func (c *BaseChannel) Name() string {
 }
 
 func (c *BaseChannel) IsRunning() bool {
-	return c.running
+	return c.running.Load()
 }
 
+// SetStateStore implements StateChannel.
+func (c *BaseChannel) SetStateStore(store state.Store) {
+	c.state = store
+}
+
+// IsAllowed reports whether senderID is on the configured allowlist or has
+// been granted access at runtime. An empty allowlist lets everyone in.
 func (c *BaseChannel) IsAllowed(senderID string) bool {
 	if len(c.allowList) == 0 {
 		return true
 	}
+	return c.onAllowList(senderID) || c.isGranted(senderID)
+}
+
+func (c *BaseChannel) onAllowList(senderID string) bool {
 
 	// Extract parts from compound senderID like "123456|username"
 	idPart := senderID
@@ -83,26 +250,256 @@ func (c *BaseChannel) IsAllowed(senderID string) bool {
 }
 
 func (c *BaseChannel) HandleMessage(senderID, chatID, content string, media []string, metadata map[string]string) {
-	if !c.IsAllowed(senderID) {
+	c.HandleReply(senderID, chatID, content, media, metadata, nil)
+}
+
+// HandleReply is HandleMessage for a message that may reply to or quote an
+// earlier one; quote is nil when it does not. The message passes through
+// the channel's filters first, see AddFilter. A message answering choices
+// offered in the chat, see OfferChoices, carries the chosen one's data
+// instead of its text. The MIME types of media are added to metadata as
+// "media_types".
+func (c *BaseChannel) HandleReply(senderID, chatID, content string, media []string, metadata map[string]string, quote *bus.Quote) {
+	msg := bus.InboundMessage{
+		Channel:  c.name,
+		SenderID: senderID,
+		ChatID:   chatID,
+		Content:  content,
+		Media:    media,
+		Metadata: metadata,
+		Quote:    quote,
+	}
+	if !c.filter(&msg) {
+		utils.RemoveMedia(msg.Media)
+		return
+	}
+	content, media, metadata = msg.Content, msg.Media, msg.Metadata
+	if c.awaitingApproval(chatID) {
+		c.drop(&msg, "awaiting_approval")
+		utils.RemoveMedia(media)
 		return
 	}
+	if c.isDuplicate(chatID, metadata) {
+		c.drop(&msg, "duplicate")
+		utils.RemoveMedia(media)
+		return
+	}
+	if metadata["button"] != "true" {
+		if choice, ok := c.takeChoice(chatID, content); ok {
+			c.bus.PublishInteraction(bus.Interaction{
+				Channel:  c.name,
+				ChatID:   chatID,
+				SenderID: senderID,
+				Kind:     choice.Kind,
+				Data:     choice.Data,
+			})
+			if metadata == nil {
+				metadata = make(map[string]string)
+			}
+			metadata["button"] = "true"
+			metadata["interaction"] = choice.Kind
+			content = choice.Data
+		}
+	}
+
+	if len(media) > 0 && metadata["media_types"] == "" {
+		if metadata == nil {
+			metadata = make(map[string]string)
+		}
+		metadata["media_types"] = mediaTypes(media)
+	}
+
+	// Build session key: channel:chatID. Reply threads and forum topics use
+	// "chat/thread" chat IDs and get their own session; '/' is not allowed
+	// in session file names, so it becomes '#'.
+	msg.SessionKey = fmt.Sprintf("%s:%s", c.name, strings.ReplaceAll(chatID, "/", "#"))
+	msg.ThreadID = threadID(chatID, metadata)
+	msg.Content = content
+	msg.Metadata = metadata
+
+	c.publish(msg)
+}
+
+// mediaTypes returns the MIME types of attachments, as found in their
+// content, comma-separated in order. Ones that cannot be read, such as
+// remote URLs, are "application/octet-stream".
+func mediaTypes(media []string) string {
+	types := make([]string, len(media))
+	for i, path := range media {
+		mimeType, err := utils.SniffMedia(path)
+		if err != nil {
+			mimeType = "application/octet-stream"
+		}
+		types[i] = mimeType
+	}
+	return strings.Join(types, ",")
+}
+
+// HandleReaction passes a user's reaction to a chat message on to the
+// agent as an inbound message carrying it. A thumbs-up or thumbs-down
+// added to one of the bot's replies becomes a /good or /bad command, which
+// the agent records as feedback on its latest reply in the chat; other
+// reactions carry no content, and are left to the agent's reaction
+// triggers. The metadata has the emoji as "reaction" and the message
+// reacted to as "target_message_id", and as "message_id" too. A reaction
+// the platform delivers again is dropped.
+func (c *BaseChannel) HandleReaction(senderID, chatID string, reaction bus.Reaction, metadata map[string]string) {
+	if metadata == nil {
+		metadata = make(map[string]string)
+	}
+	metadata["reaction"] = reaction.Emoji
+	if reaction.MessageID != "" {
+		metadata["message_id"] = reaction.MessageID
+		metadata["target_message_id"] = reaction.MessageID
+	}
+	var content string
+	if reaction.Remove {
+		metadata["reaction_removed"] = "true"
+	} else if reaction.On != bus.ReactionOnUser {
+		content = reactionCommand(reaction.Emoji)
+	}
+
+	msg := bus.InboundMessage{
+		Channel:    c.name,
+		SenderID:   senderID,
+		ChatID:     chatID,
+		ThreadID:   threadID(chatID, metadata),
+		Content:    content,
+		SessionKey: fmt.Sprintf("%s:%s", c.name, strings.ReplaceAll(chatID, "/", "#")),
+		Metadata:   metadata,
+		Reaction:   &reaction,
+	}
+	if !c.filter(&msg) {
+		return
+	}
+	if c.awaitingApproval(chatID) {
+		c.drop(&msg, "awaiting_approval")
+		return
+	}
+	if c.isDuplicateReaction(senderID, chatID, reaction) {
+		c.drop(&msg, "duplicate")
+		return
+	}
+	c.publish(msg)
+}
 
-	// Build session key: channel:chatID
-	sessionKey := fmt.Sprintf("%s:%s", c.name, chatID)
+// HandleChange passes on a user's edit or deletion of one of their
+// earlier messages as an inbound message carrying it, with content the
+// edited text. The agent and the history log then stop using what the
+// user took back. The "message_id" metadata is the changed message's, and
+// "edited" or "deleted" is "true".
+func (c *BaseChannel) HandleChange(senderID, chatID string, change bus.Change, content string, metadata map[string]string) {
+	if metadata == nil {
+		metadata = make(map[string]string)
+	}
+	metadata["message_id"] = change.MessageID
+	if change.Deleted {
+		metadata["deleted"] = "true"
+		content = ""
+	} else {
+		metadata["edited"] = "true"
+	}
 
 	msg := bus.InboundMessage{
 		Channel:    c.name,
 		SenderID:   senderID,
 		ChatID:     chatID,
+		ThreadID:   threadID(chatID, metadata),
 		Content:    content,
-		Media:      media,
-		SessionKey: sessionKey,
+		SessionKey: fmt.Sprintf("%s:%s", c.name, strings.ReplaceAll(chatID, "/", "#")),
 		Metadata:   metadata,
+		Change:     &change,
+	}
+	if !c.filter(&msg) {
+		return
 	}
+	if c.awaitingApproval(chatID) {
+		c.drop(&msg, "awaiting_approval")
+		return
+	}
+	c.publish(msg)
+}
 
-	c.bus.PublishInbound(msg)
+// threadID returns the thread of an inbound message: from a "chat/thread"
+// chat ID, or the "thread_id" metadata of channels whose threads are chats
+// of their own.
+func threadID(chatID string, metadata map[string]string) string {
+	if id := metadata["thread_id"]; id != "" {
+		return id
+	}
+	return bus.ThreadOf(chatID)
+}
+
+// threadedChatID returns msg's chat ID in "chat/thread" form, adding
+// msg.ThreadID when the chat ID has no thread, for channels that address
+// threads that way.
+func threadedChatID(msg bus.OutboundMessage) string {
+	if msg.ThreadID == "" || strings.Contains(msg.ChatID, "/") {
+		return msg.ChatID
+	}
+	return msg.ChatID + "/" + msg.ThreadID
+}
+
+// HandleChatEvent publishes a change to one of the channel's chats, such
+// as members joining it or the bot being removed from it.
+func (c *BaseChannel) HandleChatEvent(chatID, eventType string, members []bus.ChatMember, actorID string) {
+	c.PublishChatEvent(bus.ChatEvent{
+		ChatID:  chatID,
+		Type:    eventType,
+		Members: members,
+		ActorID: actorID,
+	})
+}
+
+// HandleInvite publishes an invitation to a group the bot is not in yet,
+// from a sender on the allowlist. invite is what JoinGroup needs to accept
+// it.
+func (c *BaseChannel) HandleInvite(senderID, chatID, name, invite string) {
+	if !c.admits(senderID, chatID, "group invite") {
+		return
+	}
+	c.PublishChatEvent(bus.ChatEvent{
+		ChatID:  chatID,
+		Type:    bus.ChatInvited,
+		ActorID: senderID,
+		Name:    name,
+		Invite:  invite,
+	})
+}
+
+// PublishChatEvent is HandleChatEvent for events with more to tell, such
+// as a group's name. e.Channel is filled in.
+func (c *BaseChannel) PublishChatEvent(e bus.ChatEvent) {
+	e.Channel = c.name
+	logger.InfoCF(c.name, "Chat event", map[string]interface{}{
+		"chat_id": e.ChatID,
+		"type":    e.Type,
+		"members": len(e.Members),
+	})
+	c.bus.PublishChatEvent(e)
+}
+
+// PublishStatus reports a change in the channel's connection as it
+// happens; see bus.ChannelStatus.
+func (c *BaseChannel) PublishStatus(s bus.ChannelStatus) {
+	s.Channel = c.name
+	c.bus.PublishChannelStatus(s)
+}
+
+// reactionCommand maps an emoji, or a Slack reaction name such as "+1" or
+// "thumbsdown::skin-tone-3", to its feedback command.
+func reactionCommand(reaction string) string {
+	name, _, _ := strings.Cut(strings.Trim(reaction, ":"), "::")
+	switch {
+	case name == "+1" || name == "thumbsup" || strings.HasPrefix(name, "👍"):
+		return "/good"
+	case name == "-1" || name == "thumbsdown" || strings.HasPrefix(name, "👎"):
+		return "/bad"
+	default:
+		return ""
+	}
 }
 
 func (c *BaseChannel) setRunning(running bool) {
-	c.running = running
+	c.running.Store(running)
 }
@@ -1,6 +1,13 @@
 package channels
 
-import "testing"
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
 
 func TestBaseChannelIsAllowed(t *testing.T) {
 	tests := []struct {
@@ -50,3 +57,124 @@ func TestBaseChannelIsAllowed(t *testing.T) {
 		})
 	}
 }
+
+func TestBaseChannelHandleMessage_ThreadSessionKey(t *testing.T) {
+	tests := []struct {
+		chatID string
+		want   string
+		thread string
+	}{
+		{"123", "test:123", ""},
+		{"C0123/1700000000.0001", "test:C0123#1700000000.0001", "1700000000.0001"},
+		{"-10042/7", "test:-10042#7", "7"},
+	}
+
+	for _, tt := range tests {
+		msgBus := bus.NewMessageBus()
+		ch := NewBaseChannel("test", nil, msgBus, nil)
+		ch.HandleMessage("user", tt.chatID, "hi", nil, nil)
+
+		msg, ok := msgBus.ConsumeInbound(context.Background())
+		if !ok {
+			t.Fatalf("no inbound message for %s", tt.chatID)
+		}
+		if msg.SessionKey != tt.want || msg.ChatID != tt.chatID {
+			t.Errorf("chat %s: session key = %q, chat ID = %q; want %q", tt.chatID, msg.SessionKey, msg.ChatID, tt.want)
+		}
+		if msg.ThreadID != tt.thread {
+			t.Errorf("chat %s: thread ID = %q, want %q", tt.chatID, msg.ThreadID, tt.thread)
+		}
+	}
+}
+
+func TestBaseChannelHandleMessage_MediaTypes(t *testing.T) {
+	photo := filepath.Join(t.TempDir(), "photo.jpg")
+	if err := os.WriteFile(photo, []byte("\x89PNG\r\n\x1a\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	msgBus := bus.NewMessageBus()
+	ch := NewBaseChannel("test", nil, msgBus, nil)
+	ch.HandleMessage("user", "1", "", []string{photo, "https://example.com/a.mp3"}, nil)
+
+	msg, _ := msgBus.ConsumeInbound(context.Background())
+	if got := msg.Metadata["media_types"]; got != "image/png,application/octet-stream" {
+		t.Errorf("media_types = %q, want the sniffed types", got)
+	}
+}
+
+func TestThreadedChatID(t *testing.T) {
+	tests := []struct {
+		msg  bus.OutboundMessage
+		want string
+	}{
+		{bus.OutboundMessage{ChatID: "C0123"}, "C0123"},
+		{bus.OutboundMessage{ChatID: "C0123", ThreadID: "1700000000.0001"}, "C0123/1700000000.0001"},
+		{bus.OutboundMessage{ChatID: "C0123/1700000000.0001", ThreadID: "1700000000.0001"}, "C0123/1700000000.0001"},
+	}
+	for _, tt := range tests {
+		if got := threadedChatID(tt.msg); got != tt.want {
+			t.Errorf("threadedChatID(%+v) = %q, want %q", tt.msg, got, tt.want)
+		}
+	}
+}
+
+func TestReactionCommand(t *testing.T) {
+	tests := []struct {
+		reaction string
+		want     string
+	}{
+		{"👍", "/good"},
+		{"👍🏽", "/good"},
+		{"+1", "/good"},
+		{"thumbsup::skin-tone-2", "/good"},
+		{"👎", "/bad"},
+		{"-1", "/bad"},
+		{":thumbsdown:", "/bad"},
+		{"❤", ""},
+		{"eyes", ""},
+	}
+	for _, tt := range tests {
+		if got := reactionCommand(tt.reaction); got != tt.want {
+			t.Errorf("reactionCommand(%q) = %q, want %q", tt.reaction, got, tt.want)
+		}
+	}
+}
+
+func TestBaseChannelHandleReaction(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	ch := NewBaseChannel("test", nil, msgBus, []string{"user"})
+
+	ch.HandleReaction("stranger", "123", bus.Reaction{MessageID: "9", Emoji: "👍"}, nil)
+	ch.HandleReaction("user", "123", bus.Reaction{MessageID: "9", Emoji: "👎"}, nil)
+	ch.HandleReaction("user", "123", bus.Reaction{MessageID: "9", Emoji: "🎉"}, nil)
+	ch.HandleReaction("user", "123", bus.Reaction{MessageID: "9", Emoji: "👍", Remove: true}, nil)
+	// Rating someone else's message is no feedback on the bot
+	ch.HandleReaction("user", "123", bus.Reaction{MessageID: "9", Emoji: "👍", On: bus.ReactionOnUser}, nil)
+
+	tests := []struct {
+		content string
+		emoji   string
+		removed string
+	}{
+		{"/bad", "👎", ""},
+		{"", "🎉", ""},
+		{"", "👍", "true"},
+		{"", "👍", ""},
+	}
+	for _, tt := range tests {
+		msg, ok := msgBus.ConsumeInbound(context.Background())
+		if !ok {
+			t.Fatal("no inbound message")
+		}
+		if msg.Content != tt.content || msg.SenderID != "user" || msg.Reaction == nil || msg.Reaction.Emoji != tt.emoji {
+			t.Errorf("inbound = %+v, want content %q for %s", msg, tt.content, tt.emoji)
+			continue
+		}
+		if msg.Metadata["reaction"] != tt.emoji || msg.Metadata["message_id"] != "9" || msg.Metadata["reaction_removed"] != tt.removed {
+			t.Errorf("metadata = %v", msg.Metadata)
+		}
+	}
+	if in, _ := msgBus.QueueLengths(); in != 0 {
+		t.Errorf("%d messages left, want the stranger's dropped", in)
+	}
+}
@@ -0,0 +1,334 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/crash"
+	"github.com/sipeed/picoclaw/pkg/events"
+	"github.com/sipeed/picoclaw/pkg/i18n"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+const (
+	// blocklistBucket holds blocked senders, keyed "channel:sender_id".
+	// Expired automatic blocks are kept, so the next one lasts longer.
+	blocklistBucket = "blocklist"
+	// blockForget is how long after an automatic block expires a sender
+	// starts over with the shortest block.
+	blockForget = 30 * 24 * time.Hour
+	// rateSweepSize is how many senders' rates are tracked before idle
+	// ones are forgotten.
+	rateSweepSize = 1000
+)
+
+// BlockedAuto is Block.By for senders blocked for flooding.
+const BlockedAuto = "auto"
+
+// Block records a blocked sender: by whom, why, and until when.
+type Block struct {
+	Account string    `json:"-"` // "channel:sender_id"
+	By      string    `json:"by"`
+	Reason  string    `json:"reason,omitempty"`
+	Time    time.Time `json:"time"`
+	Until   time.Time `json:"until,omitempty"` // Zero for a permanent block
+	Count   int       `json:"count,omitempty"` // Automatic blocks so far
+}
+
+// Permanent reports whether the block lasts until an operator lifts it.
+func (b Block) Permanent() bool {
+	return b.Until.IsZero()
+}
+
+// Active reports whether the block is in force at now.
+func (b Block) Active(now time.Time) bool {
+	return b.Permanent() || now.Before(b.Until)
+}
+
+// senderRate counts one sender's messages in the current minute, and the
+// minutes they went over the rate limit in the last hour.
+type senderRate struct {
+	start   time.Time
+	count   int
+	struck  bool // Went over the limit this minute
+	strikes []time.Time
+}
+
+// isBlocked reports whether senderID, or any part of a composite
+// "123|username" ID, is blocked. A store error lets the sender through.
+func (c *BaseChannel) isBlocked(senderID string) bool {
+	if c.state == nil {
+		return false
+	}
+	ctx := context.Background()
+	now := time.Now()
+	for _, id := range append([]string{senderID}, strings.Split(senderID, "|")...) {
+		if id == "" {
+			continue
+		}
+		var b Block
+		err := state.GetJSON(ctx, c.state, blocklistBucket, c.name+":"+id, &b)
+		if err == nil && b.Active(now) {
+			return true
+		}
+		if err != nil && !errors.Is(err, state.ErrNotFound) {
+			logger.WarnCF("channels", "Failed to check blocklist",
+				map[string]interface{}{"channel": c.name, "error": err.Error()})
+			return false
+		}
+	}
+	return false
+}
+
+// Block blocks a sender on a channel until unblocked, whether or not they
+// are on its allowlist. by names who blocked them, for the record.
+func (m *Manager) Block(ctx context.Context, channel, senderID, by, reason string) error {
+	store, err := m.grantStore(channel)
+	if err != nil {
+		return err
+	}
+	b := Block{By: by, Reason: reason, Time: time.Now()}
+	if err := state.PutJSON(ctx, store, blocklistBucket, channel+":"+senderID, b); err != nil {
+		return err
+	}
+	events.Security("channels", "Blocked sender",
+		map[string]interface{}{"channel": channel, "sender_id": senderID, "by": by})
+	return nil
+}
+
+// Unblock lifts a sender's block, and forgets their earlier automatic
+// blocks. It reports whether the sender was blocked.
+func (m *Manager) Unblock(ctx context.Context, channel, senderID string) (bool, error) {
+	store, err := m.grantStore(channel)
+	if err != nil {
+		return false, err
+	}
+	key := channel + ":" + senderID
+	var b Block
+	if err := state.GetJSON(ctx, store, blocklistBucket, key, &b); err != nil {
+		if errors.Is(err, state.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	if err := store.Delete(ctx, blocklistBucket, key); err != nil {
+		return false, err
+	}
+	m.rateMu.Lock()
+	delete(m.rates, key)
+	m.rateMu.Unlock()
+	return b.Active(time.Now()), nil
+}
+
+// Blocks lists the blocks in force sorted by account.
+func (m *Manager) Blocks(ctx context.Context) ([]Block, error) {
+	store := m.outboxStore()
+	if store == nil {
+		return nil, nil
+	}
+	entries, err := store.List(ctx, blocklistBucket)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	var out []Block
+	for account, data := range entries {
+		var b Block
+		if json.Unmarshal(data, &b) != nil || !b.Active(now) {
+			continue
+		}
+		b.Account = account
+		out = append(out, b)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Account < out[j].Account })
+	return out, nil
+}
+
+// rateLimit is the inbound filter that drops a sender's messages beyond
+// blocklist.rate_limit a minute, and blocks senders who keep going over it.
+func (m *Manager) rateLimit(msg *bus.InboundMessage) bool {
+	cfg := m.config.Blocklist
+	if cfg.RateLimit <= 0 || m.isOperator(msg.Channel, msg.SenderID) {
+		return true
+	}
+	strikes := cfg.Strikes
+	if strikes <= 0 {
+		strikes = 3
+	}
+	key := msg.Channel + ":" + msg.SenderID
+	now := time.Now()
+
+	m.rateMu.Lock()
+	if m.rates == nil {
+		m.rates = make(map[string]*senderRate)
+	}
+	r, ok := m.rates[key]
+	if !ok {
+		if len(m.rates) >= rateSweepSize {
+			m.sweepRates(now)
+		}
+		r = &senderRate{start: now}
+		m.rates[key] = r
+	}
+	if now.Sub(r.start) >= time.Minute {
+		r.start, r.count, r.struck = now, 0, false
+	}
+	r.count++
+	if r.count <= cfg.RateLimit {
+		m.rateMu.Unlock()
+		return true
+	}
+	block := false
+	if !r.struck {
+		r.struck = true
+		recent := r.strikes[:0]
+		for _, t := range r.strikes {
+			if now.Sub(t) < time.Hour {
+				recent = append(recent, t)
+			}
+		}
+		r.strikes = append(recent, now)
+		if len(r.strikes) >= strikes {
+			block, r.strikes = true, nil
+		}
+	}
+	m.rateMu.Unlock()
+
+	if block {
+		m.autoBlock(msg.Channel, msg.SenderID, now)
+	}
+	return false
+}
+
+// sweepRates forgets senders with no messages or strikes in the last hour.
+// Callers hold m.rateMu.
+func (m *Manager) sweepRates(now time.Time) {
+	for key, r := range m.rates {
+		idle := now.Sub(r.start) >= time.Hour
+		for _, t := range r.strikes {
+			if now.Sub(t) < time.Hour {
+				idle = false
+			}
+		}
+		if idle {
+			delete(m.rates, key)
+		}
+	}
+}
+
+// autoBlock blocks a flooding sender, each time twice as long as the last
+// unless the last was long ago, and for good after
+// blocklist.permanent_after blocks.
+func (m *Manager) autoBlock(channel, senderID string, now time.Time) {
+	store := m.outboxStore()
+	if store == nil {
+		logger.WarnCF("channels", "Blocking needs the state store, only rate limiting sender",
+			map[string]interface{}{"channel": channel, "sender_id": senderID})
+		return
+	}
+	cfg := m.config.Blocklist
+	ctx := context.Background()
+	key := channel + ":" + senderID
+
+	var b Block
+	if err := state.GetJSON(ctx, store, blocklistBucket, key, &b); err == nil && b.Active(now) {
+		return
+	}
+	if now.Sub(b.Until) > blockForget {
+		b.Count = 0
+	}
+	b.Count++
+	b.By, b.Reason, b.Time = BlockedAuto, "flooding", now
+	minutes := cfg.BlockMinutes
+	if minutes <= 0 {
+		minutes = 60
+	}
+	b.Until = now.Add(time.Duration(minutes) * time.Minute << min(b.Count-1, 16))
+	if cfg.PermanentAfter > 0 && b.Count >= cfg.PermanentAfter {
+		b.Until = time.Time{}
+	}
+	if err := state.PutJSON(ctx, store, blocklistBucket, key, b); err != nil {
+		logger.ErrorCF("channels", "Failed to block flooding sender", map[string]interface{}{
+			"channel":   channel,
+			"sender_id": senderID,
+			"error":     err.Error(),
+		})
+		return
+	}
+	fields := map[string]interface{}{"channel": channel, "sender_id": senderID, "blocks": b.Count}
+	if !b.Permanent() {
+		fields["until"] = b.Until.Format(time.RFC3339)
+	}
+	events.Security("channels", "Blocked flooding sender", fields)
+
+	b.Account = key
+	go func() {
+		defer crash.Recover("channels.blocklist", nil)
+		m.alertBlock(ctx, b)
+	}()
+}
+
+// alertBlock tells the blocklist's alert chat, if one is configured, of an
+// automatic block.
+func (m *Manager) alertBlock(ctx context.Context, b Block) {
+	alertChannel, alertChat, ok := strings.Cut(m.config.Blocklist.AlertChat, ":")
+	if !ok {
+		return
+	}
+	channel, exists := m.GetChannel(alertChannel)
+	if !exists {
+		logger.WarnCF("channels", "Blocklist alert chat's channel is not enabled",
+			map[string]interface{}{"channel": alertChannel})
+		return
+	}
+	t := func(key string, args ...interface{}) string { return i18n.T(alertChannel, alertChat, key, args...) }
+	text := t("blocklist.blocked_permanent", b.Account, b.Count)
+	if !b.Permanent() {
+		text = t("blocklist.blocked", b.Account, b.Until.Local().Format("2006-01-02 15:04"), b.Count)
+	}
+	sender := strings.Replace(b.Account, ":", " ", 1)
+	notice := bus.OutboundMessage{
+		Channel: alertChannel,
+		ChatID:  alertChat,
+		Content: text,
+		Buttons: []bus.Button{
+			{Text: t("blocklist.unblock"), Data: "/admin unblock " + sender},
+			{Text: t("blocklist.block"), Data: "/admin block " + sender},
+		},
+	}
+	if err := m.deliverDurably(ctx, channel, notice); err != nil {
+		logger.WarnCF("channels", "Failed to send blocklist alert", map[string]interface{}{
+			"account": b.Account,
+			"error":   err.Error(),
+		})
+	}
+}
+
+// isOperator reports whether the sender is one of admin.operators, who are
+// never rate limited. Composite sender IDs match on any part; a sender the
+// message only claimed never does.
+func (m *Manager) isOperator(channel, senderID string) bool {
+	if bus.IsClaimedSender(senderID) {
+		return false
+	}
+	for _, op := range m.config.Admin.Operators {
+		for _, id := range append([]string{senderID}, strings.Split(senderID, "|")...) {
+			if id != "" && strings.TrimSpace(op) == channel+":"+id {
+				return true
+			}
+		}
+	}
+	return false
+}
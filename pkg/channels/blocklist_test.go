@@ -0,0 +1,108 @@
+package channels
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+func TestBlocklist(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	ch := &restartableChannel{BaseChannel: NewBaseChannel("telegram", nil, msgBus, nil)}
+	cfg := config.DefaultConfig()
+	cfg.Blocklist = config.BlocklistConfig{RateLimit: 2, Strikes: 2, BlockMinutes: 10, PermanentAfter: 2}
+	cfg.Admin.Operators = []string{"telegram:9"}
+	m := &Manager{channels: map[string]Channel{"telegram": ch}, config: cfg}
+	m.AddInboundFilter("rate_limit", m.rateLimit)
+	store := state.NewMemoryStore()
+	m.SetStateStore(store)
+	ctx := context.Background()
+
+	published := 0
+	send := func(sender string, n int) int {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			ch.HandleMessage(sender, "c1", "spam", nil, nil)
+		}
+		in, _ := msgBus.QueueLengths()
+		got := in - published
+		published = in
+		return got
+	}
+	// flood goes over the limit in a new minute, for one strike
+	flood := func(sender string) int {
+		t.Helper()
+		m.rateMu.Lock()
+		if r := m.rates["telegram:"+sender]; r != nil {
+			r.start = r.start.Add(-time.Minute)
+		}
+		m.rateMu.Unlock()
+		return send(sender, 3)
+	}
+
+	if got := flood("5"); got != 2 {
+		t.Fatalf("%d of 3 messages published, want the rate limit of 2", got)
+	}
+	if blocks, _ := m.Blocks(ctx); len(blocks) != 0 {
+		t.Fatalf("blocked after one strike: %+v", blocks)
+	}
+	flood("5")
+	blocks, err := m.Blocks(ctx)
+	if err != nil || len(blocks) != 1 || blocks[0].Account != "telegram:5" || blocks[0].By != BlockedAuto ||
+		blocks[0].Count != 1 || blocks[0].Permanent() {
+		t.Fatalf("Blocks() = %+v, %v, want a temporary automatic block", blocks, err)
+	}
+	if d := time.Until(blocks[0].Until); d < 9*time.Minute || d > 10*time.Minute {
+		t.Errorf("blocked for %v, want 10 minutes", d)
+	}
+	if got := flood("5"); got != 0 {
+		t.Errorf("%d messages published from a blocked sender", got)
+	}
+
+	// Once the block expires the sender gets through, and the next block
+	// escalates to a permanent one
+	expired := blocks[0]
+	expired.Until = time.Now().Add(-time.Minute)
+	state.PutJSON(ctx, store, blocklistBucket, "telegram:5", expired)
+	if got := send("5", 1); got != 1 {
+		t.Fatal("sender still blocked after the block expired")
+	}
+	flood("5")
+	flood("5")
+	if blocks, _ := m.Blocks(ctx); len(blocks) != 1 || !blocks[0].Permanent() || blocks[0].Count != 2 {
+		t.Fatalf("Blocks() = %+v, want a permanent block", blocks)
+	}
+
+	// Operators are never limited
+	if got := send("9", 10); got != 10 {
+		t.Errorf("%d of an operator's 10 messages published", got)
+	}
+
+	if ok, err := m.Unblock(ctx, "telegram", "5"); !ok || err != nil {
+		t.Fatalf("Unblock() = %v, %v", ok, err)
+	}
+	if ok, _ := m.Unblock(ctx, "telegram", "5"); ok {
+		t.Error("second Unblock() = true")
+	}
+	if got := send("5", 1); got != 1 {
+		t.Error("unblocked sender still dropped")
+	}
+
+	// Operators block by any part of a composite ID
+	if err := m.Block(ctx, "discord", "alice", "telegram:9", ""); err == nil {
+		t.Error("Block() on a disabled channel should fail")
+	}
+	if err := m.Block(ctx, "telegram", "alice", "telegram:9", "abuse"); err != nil {
+		t.Fatal(err)
+	}
+	if got := send("7|alice", 1); got != 0 {
+		t.Error("message from a blocked username published")
+	}
+	if blocks, _ := m.Blocks(ctx); len(blocks) != 1 || blocks[0].Reason != "abuse" || !blocks[0].Permanent() {
+		t.Errorf("Blocks() = %+v", blocks)
+	}
+}
@@ -0,0 +1,154 @@
+package channels
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// errDegraded is returned for a send not tried because the channel's
+// circuit breaker is open.
+var errDegraded = errors.New("channel is degraded after repeated send failures")
+
+// breaker is a channel's circuit breaker, see config.CircuitBreakerConfig.
+// It opens after consecutive send failures, and while open lets one send
+// through at a time as a probe, once its probe interval has passed.
+type breaker struct {
+	cfg config.CircuitBreakerConfig
+
+	mu        sync.Mutex
+	failures  int           // Sends failed in a row
+	open      bool          // Sends wait for a probe to succeed
+	probing   bool          // A probe is in flight
+	wait      time.Duration // Between probes, doubling while they fail
+	nextProbe time.Time
+}
+
+// allow reports whether a send may go out now. While the breaker is open
+// the send allowed is a probe, and no other is until it is recorded.
+func (b *breaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.open {
+		return true
+	}
+	if b.probing || now.Before(b.nextProbe) {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// record counts the outcome of an allowed send, reporting whether it
+// opened or closed the breaker.
+func (b *breaker) record(err error, now time.Time) (opened, closed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if err == nil {
+		b.failures = 0
+		closed, b.open = b.open, false
+		return false, closed
+	}
+	b.failures++
+	switch {
+	case b.open:
+		b.wait = min(b.wait*2, time.Duration(b.cfg.MaxProbeInterval)*time.Second)
+	case b.failures >= b.cfg.Failures:
+		b.open = true
+		b.wait = time.Duration(b.cfg.ProbeInterval) * time.Second
+		opened = true
+	default:
+		return false, false
+	}
+	b.nextProbe = now.Add(b.wait)
+	return opened, false
+}
+
+// release gives up a send that was allowed but cut short, e.g. by shutdown,
+// without counting it either way.
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+func (b *breaker) isOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.open
+}
+
+// breakerFor returns the named channel's breaker, or nil when breakers are
+// disabled.
+func (m *Manager) breakerFor(name string) *breaker {
+	if m.config == nil || !m.config.Gateway.CircuitBreaker.Enabled {
+		return nil
+	}
+	cfg := m.config.Gateway.CircuitBreaker
+	if cfg.Failures <= 0 {
+		cfg.Failures = 5
+	}
+	if cfg.ProbeInterval <= 0 {
+		cfg.ProbeInterval = 30
+	}
+	cfg.MaxProbeInterval = max(cfg.MaxProbeInterval, cfg.ProbeInterval)
+
+	m.breakersMu.Lock()
+	defer m.breakersMu.Unlock()
+	b, ok := m.breakers[name]
+	if !ok {
+		if m.breakers == nil {
+			m.breakers = make(map[string]*breaker)
+		}
+		b = &breaker{cfg: cfg}
+		m.breakers[name] = b
+	}
+	return b
+}
+
+// degraded reports whether the named channel's breaker is open.
+func (m *Manager) degraded(name string) bool {
+	m.breakersMu.Lock()
+	b := m.breakers[name]
+	m.breakersMu.Unlock()
+	return b != nil && b.isOpen()
+}
+
+// deliverGuarded is deliver through the channel's breaker: it returns
+// errDegraded without sending while the breaker is open and no probe is
+// due.
+func (m *Manager) deliverGuarded(ctx context.Context, channel Channel, msg bus.OutboundMessage) error {
+	b := m.breakerFor(channel.Name())
+	if b == nil {
+		return m.deliver(ctx, channel, msg)
+	}
+	if !b.allow(time.Now()) {
+		return errDegraded
+	}
+
+	err := m.deliver(ctx, channel, msg)
+	if err != nil && ctx.Err() != nil {
+		b.release()
+		return err
+	}
+	opened, closed := b.record(err, time.Now())
+	switch {
+	case opened:
+		logger.WarnCF("channels", "Channel degraded, holding outbound messages in the outbox", map[string]interface{}{
+			"channel":  channel.Name(),
+			"failures": b.cfg.Failures,
+			"error":    err.Error(),
+		})
+	case closed:
+		logger.InfoCF("channels", "Channel recovered, sending held messages", map[string]interface{}{
+			"channel": channel.Name(),
+		})
+	}
+	return err
+}
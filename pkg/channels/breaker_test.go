@@ -0,0 +1,78 @@
+package channels
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+// countingChannel counts the sends it is asked for, failing while fail is
+// set.
+type countingChannel struct {
+	flakyChannel
+	tries int
+}
+
+func (c *countingChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	c.tries++
+	return c.flakyChannel.Send(ctx, msg)
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Gateway.CircuitBreaker = config.CircuitBreakerConfig{Enabled: true, Failures: 2, ProbeInterval: 30, MaxProbeInterval: 60}
+	ch := &countingChannel{flakyChannel: flakyChannel{BaseChannel: NewBaseChannel("telegram", nil, nil, nil), fail: true}}
+	ch.setRunning(true)
+	store := state.NewMemoryStore()
+	m := &Manager{channels: map[string]Channel{"telegram": ch}, chunker: newStreamChunker(), state: store, config: cfg}
+	ctx := context.Background()
+	send := func(content string) error {
+		return m.deliverDurably(ctx, ch, bus.OutboundMessage{Channel: "telegram", ChatID: "1", Content: content})
+	}
+
+	send("one")
+	send("two")
+	if got := m.ChannelStates()["telegram"]; got != "degraded" {
+		t.Fatalf("state = %q after 2 failed sends, want degraded", got)
+	}
+
+	// While degraded, messages wait in the outbox without being tried
+	if err := send("three"); err != nil {
+		t.Errorf("deliverDurably() error = %v for a held message", err)
+	}
+	m.retryOutbox(ctx, time.Now())
+	if ch.tries != 2 {
+		t.Errorf("tries = %d, want no sends while degraded", ch.tries)
+	}
+	for _, e := range outboxEntries(t, store) {
+		if e.Message.Content == "three" && (!e.Held || e.Attempts != 0) {
+			t.Errorf("held entry = %+v", e)
+		}
+	}
+
+	// A failed probe doubles the wait, capped at the maximum
+	b := m.breakerFor("telegram")
+	b.nextProbe = time.Time{}
+	m.retryOutbox(ctx, time.Now())
+	if ch.tries != 3 || b.wait != time.Minute || !b.isOpen() {
+		t.Fatalf("tries = %d, wait = %v, open = %v after a failed probe", ch.tries, b.wait, b.isOpen())
+	}
+
+	// A probe that succeeds closes the breaker, and the rest follow
+	ch.fail = false
+	b.nextProbe = time.Time{}
+	m.retryOutbox(ctx, time.Now())
+	if len(ch.sent) != 3 {
+		t.Errorf("sent = %q, want every held message", ch.sent)
+	}
+	if n := len(outboxEntries(t, store)); n != 0 {
+		t.Errorf("outbox holds %d entries after recovery", n)
+	}
+	if got := m.ChannelStates()["telegram"]; got != "running" {
+		t.Errorf("state = %q after recovery, want running", got)
+	}
+}
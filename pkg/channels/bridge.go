@@ -0,0 +1,222 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package channels
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Bridge protocol v2. Every frame is a JSON object with a "type":
+//
+//	hello    {"type":"hello","version":2,"session":"…","caps":[…],"ack":N}
+//	message  {"type":"message","seq":N, …}
+//	reaction {"type":"reaction","seq":N, …}, numbered along with messages
+//	ack      {"type":"ack","ack":N}
+//	resend   {"type":"resend","ack":N}
+//	ping     {"type":"ping"}, answered by {"type":"pong"}
+//
+// Each side numbers the messages it sends from 1 within its session and
+// keeps them until the other side acknowledges them. Acks are cumulative:
+// "ack":N covers every message up to N. A hello is the first frame after
+// connecting; its "ack" is the last message received in order, and the
+// other side resends what came after. A new session ID means the sender
+// restarted and numbers from 1 again. A message numbered past the next
+// expected one means some were lost, and is answered with a resend from
+// the last one received in order. Without a frame for two heartbeats the
+// connection is considered dead and is redialed.
+//
+// Bridges that do not answer the hello speak version 1: bare message
+// frames with nothing acknowledged.
+const (
+	bridgeVersion = 2
+	// maxBridgeUnacked bounds the messages sent and not yet acknowledged.
+	// Sending more fails, so the outbox retries once the bridge catches up.
+	maxBridgeUnacked = 256
+	// bridgeHeartbeat is how often a ping is sent.
+	bridgeHeartbeat = 30 * time.Second
+)
+
+// bridgeHandshakeTimeout is how long the bridge has to answer a hello
+// before it is taken to speak version 1. A variable for tests.
+var bridgeHandshakeTimeout = 5 * time.Second
+
+// bridgeCapabilities is what this side of the bridge supports.
+var bridgeCapabilities = []string{"ack", "seq", "ping", "resend"}
+
+// bridgeFrame is a frame of the bridge protocol. Incoming message frames
+// carry more fields, which are read separately.
+type bridgeFrame struct {
+	Type    string   `json:"type"`
+	Seq     uint64   `json:"seq,omitempty"`
+	Ack     uint64   `json:"ack,omitempty"`
+	Version int      `json:"version,omitempty"`
+	Session string   `json:"session,omitempty"`
+	Caps    []string `json:"caps,omitempty"`
+	// Outgoing messages
+	To      string `json:"to,omitempty"`
+	Content string `json:"content,omitempty"`
+	ReplyTo string `json:"reply_to,omitempty"` // ID of the message quoted
+	// Outgoing reactions, to the message with MessageID by Author
+	MessageID string `json:"message_id,omitempty"`
+	Emoji     string `json:"emoji,omitempty"`
+	Author    string `json:"author,omitempty"`
+}
+
+// bridgeSession keeps the protocol state of the bridge across reconnects:
+// what was sent and not acknowledged, and what was received.
+type bridgeSession struct {
+	id string
+
+	mu          sync.Mutex
+	version     int             // Negotiated on connecting; 1 for legacy bridges
+	caps        map[string]bool // What the bridge supports
+	peerSession string
+	sent        uint64        // Last seq sent
+	unacked     []bridgeFrame // Sent and not acknowledged, oldest first
+	received    uint64        // Last seq received in order
+}
+
+func newBridgeSession() *bridgeSession {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return &bridgeSession{id: hex.EncodeToString(b), version: 1}
+}
+
+// hello is the frame that opens a connection.
+func (s *bridgeSession) hello() bridgeFrame {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return bridgeFrame{
+		Type:    "hello",
+		Version: bridgeVersion,
+		Session: s.id,
+		Caps:    bridgeCapabilities,
+		Ack:     s.received,
+	}
+}
+
+// negotiate takes in the bridge's hello. What remains unacknowledged
+// afterwards is what the bridge missed.
+func (s *bridgeSession) negotiate(peer bridgeFrame) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.version = min(peer.Version, bridgeVersion)
+	s.caps = make(map[string]bool, len(peer.Caps))
+	for _, c := range peer.Caps {
+		s.caps[c] = true
+	}
+	if peer.Session != s.peerSession {
+		// The bridge restarted and numbers its messages from 1 again
+		s.peerSession = peer.Session
+		s.received = 0
+	}
+	s.ackLocked(peer.Ack)
+}
+
+// legacy falls back to version 1 for a bridge that did not answer hello.
+func (s *bridgeSession) legacy() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.version = 1
+	s.caps = nil
+}
+
+// protocol is the negotiated protocol version.
+func (s *bridgeSession) protocol() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.version
+}
+
+// v2 reports whether the bridge speaks version 2.
+func (s *bridgeSession) v2() bool {
+	return s.protocol() >= 2
+}
+
+// can reports whether the bridge announced capability.
+func (s *bridgeSession) can(capability string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.caps[capability]
+}
+
+// number gives f the next seq and keeps it until acknowledged. It fails
+// when too many messages are unacknowledged.
+func (s *bridgeSession) number(f bridgeFrame) (bridgeFrame, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.unacked) >= maxBridgeUnacked {
+		return f, fmt.Errorf("whatsapp bridge has %d unacknowledged messages", len(s.unacked))
+	}
+	s.sent++
+	f.Seq = s.sent
+	s.unacked = append(s.unacked, f)
+	return f, nil
+}
+
+// ack drops the messages the bridge acknowledged, up to seq.
+func (s *bridgeSession) ack(seq uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ackLocked(seq)
+}
+
+func (s *bridgeSession) ackLocked(seq uint64) {
+	n := 0
+	for n < len(s.unacked) && s.unacked[n].Seq <= seq {
+		n++
+	}
+	s.unacked = s.unacked[n:]
+}
+
+// after returns the unacknowledged messages past seq, for a resend.
+func (s *bridgeSession) after(seq uint64) []bridgeFrame {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var frames []bridgeFrame
+	for _, f := range s.unacked {
+		if f.Seq > seq {
+			frames = append(frames, f)
+		}
+	}
+	return frames
+}
+
+// receive checks an incoming message's seq. It returns whether the
+// message is the next one and should be handled, and how many came before
+// it that were lost. Repeats of messages already handled return false and
+// no loss.
+func (s *bridgeSession) receive(seq uint64) (next bool, lost uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case seq <= s.received:
+		return false, 0
+	case seq > s.received+1:
+		return false, seq - s.received - 1
+	}
+	s.received = seq
+	return true, 0
+}
+
+// lastReceived is the last seq received in order.
+func (s *bridgeSession) lastReceived() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.received
+}
+
+// pending is how many sent messages are unacknowledged.
+func (s *bridgeSession) pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.unacked)
+}
@@ -0,0 +1,260 @@
+package channels
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestBridgeSessionReceive(t *testing.T) {
+	s := newBridgeSession()
+	tests := []struct {
+		seq      uint64
+		wantNext bool
+		wantLost uint64
+	}{
+		{1, true, 0},
+		{2, true, 0},
+		{2, false, 0}, // repeat
+		{5, false, 2}, // 3 and 4 missing
+		{3, true, 0},
+		{1, false, 0},
+	}
+	for _, tt := range tests {
+		next, lost := s.receive(tt.seq)
+		if next != tt.wantNext || lost != tt.wantLost {
+			t.Errorf("receive(%d) = %v, %d, want %v, %d", tt.seq, next, lost, tt.wantNext, tt.wantLost)
+		}
+	}
+	if got := s.lastReceived(); got != 3 {
+		t.Errorf("lastReceived() = %d, want 3", got)
+	}
+}
+
+func TestBridgeSessionAcks(t *testing.T) {
+	s := newBridgeSession()
+	for i := 0; i < 3; i++ {
+		if _, err := s.number(bridgeFrame{Type: "message"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.ack(2)
+	if got := s.after(0); len(got) != 1 || got[0].Seq != 3 {
+		t.Errorf("after ack 2, unacked = %+v", got)
+	}
+
+	// A bridge that received nothing of ours after restarting
+	s.receive(1)
+	s.negotiate(bridgeFrame{Type: "hello", Version: 2, Session: "new", Caps: []string{"ping"}})
+	if !s.v2() || !s.can("ping") || s.can("reactions") {
+		t.Errorf("negotiated version %d, caps %v", s.protocol(), s.caps)
+	}
+	if s.lastReceived() != 0 {
+		t.Error("a new bridge session kept the old seq")
+	}
+	if s.pending() != 1 {
+		t.Errorf("pending() = %d, want 1 to resend", s.pending())
+	}
+
+	for s.pending() < maxBridgeUnacked {
+		s.number(bridgeFrame{Type: "message"})
+	}
+	if _, err := s.number(bridgeFrame{Type: "message"}); err == nil {
+		t.Error("number() accepted more than maxBridgeUnacked messages")
+	}
+}
+
+// bridgeServer is a websocket bridge; each connection the channel makes
+// arrives on conns.
+func bridgeServer(t *testing.T) (url string, conns chan *websocket.Conn) {
+	conns = make(chan *websocket.Conn, 4)
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		conns <- conn
+	}))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http"), conns
+}
+
+func readFrame(t *testing.T, conn *websocket.Conn) bridgeFrame {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var f bridgeFrame
+	if err := conn.ReadJSON(&f); err != nil {
+		t.Fatalf("bridge read: %v", err)
+	}
+	return f
+}
+
+func TestWhatsAppBridgeV2(t *testing.T) {
+	url, conns := bridgeServer(t)
+	msgBus := bus.NewMessageBus()
+	statuses := make(chan bus.ChannelStatus, 10)
+	msgBus.OnChannelStatus(func(s bus.ChannelStatus) { statuses <- s })
+	c, err := NewWhatsAppChannel(config.WhatsAppConfig{BridgeURL: url}, msgBus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	// The bridge answers the hello from its own goroutine, since Start
+	// waits for it
+	var hello bridgeFrame
+	greeted := make(chan *websocket.Conn, 1)
+	go func() {
+		conn := <-conns
+		conn.ReadJSON(&hello)
+		conn.WriteJSON(bridgeFrame{Type: "hello", Version: 2, Session: "b1", Caps: []string{"ack", "seq"}})
+		greeted <- conn
+	}()
+	if err := c.Start(ctx); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer c.Stop(ctx)
+	conn := <-greeted
+	if hello.Type != "hello" || hello.Version != bridgeVersion || hello.Session == "" {
+		t.Fatalf("hello = %+v", hello)
+	}
+
+	inbound := func(seq uint64) {
+		conn.WriteJSON(map[string]interface{}{"type": "message", "seq": seq, "from": "alice", "content": "hi"})
+	}
+	inbound(1)
+	if f := readFrame(t, conn); f.Type != "ack" || f.Ack != 1 {
+		t.Errorf("after message 1 got %+v, want ack 1", f)
+	}
+	if msg, ok := msgBus.ConsumeInbound(ctx); !ok || msg.SenderID != "alice" {
+		t.Fatalf("inbound = %+v", msg)
+	}
+	inbound(1)
+	if f := readFrame(t, conn); f.Type != "ack" || f.Ack != 1 {
+		t.Errorf("after a repeat got %+v, want ack 1", f)
+	}
+	inbound(3)
+	if f := readFrame(t, conn); f.Type != "resend" || f.Ack != 1 {
+		t.Errorf("after a gap got %+v, want resend from 1", f)
+	}
+	waitCtx, waitCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	if msg, ok := msgBus.ConsumeInbound(waitCtx); ok {
+		t.Errorf("a repeat or out of order message reached the bus: %+v", msg)
+	}
+	waitCancel()
+
+	if err := c.Send(ctx, bus.OutboundMessage{Channel: "whatsapp", ChatID: "bob", Content: "hello bob", ReplyToID: "m7"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if f := readFrame(t, conn); f.Type != "message" || f.Seq != 1 || f.To != "bob" || f.ReplyTo != "m7" {
+		t.Errorf("sent %+v", f)
+	}
+
+	// The connection drops before the bridge acknowledges; the message is
+	// sent again after reconnecting
+	conn.Close()
+	conn = <-conns
+	hello = readFrame(t, conn)
+	if hello.Type != "hello" || hello.Ack != 1 {
+		t.Errorf("reconnect hello = %+v, want ack 1", hello)
+	}
+	conn.WriteJSON(bridgeFrame{Type: "hello", Version: 2, Session: "b1"})
+	if f := readFrame(t, conn); f.Type != "message" || f.Seq != 1 || f.Content != "hello bob" {
+		t.Errorf("resent %+v", f)
+	}
+	if s := <-statuses; s.Channel != "whatsapp" || s.State != bus.ChannelReconnecting || s.Error == "" {
+		t.Errorf("status on dropping = %+v", s)
+	}
+	if s := <-statuses; s.State != bus.ChannelConnected || s.Attempt != 1 {
+		t.Errorf("status on reconnecting = %+v", s)
+	}
+	conn.WriteJSON(bridgeFrame{Type: "ack", Ack: 1})
+	conn.WriteJSON(bridgeFrame{Type: "ping"})
+	if f := readFrame(t, conn); f.Type != "pong" {
+		t.Errorf("ping answered with %+v", f)
+	}
+	if n := c.session.pending(); n != 0 {
+		t.Errorf("pending() = %d after the ack", n)
+	}
+}
+
+func TestWhatsAppBridgeV1(t *testing.T) {
+	defer func(timeout time.Duration) { bridgeHandshakeTimeout = timeout }(bridgeHandshakeTimeout)
+	bridgeHandshakeTimeout = 50 * time.Millisecond
+
+	url, conns := bridgeServer(t)
+	msgBus := bus.NewMessageBus()
+	c, err := NewWhatsAppChannel(config.WhatsAppConfig{BridgeURL: url}, msgBus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Start(ctx); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer c.Stop(ctx)
+	<-conns // Ignores the hello
+	conn := <-conns
+	if c.session.v2() {
+		t.Fatal("a bridge that did not answer hello was taken for v2")
+	}
+
+	conn.WriteJSON(map[string]interface{}{"type": "message", "from": "alice", "content": "hi"})
+	if msg, ok := msgBus.ConsumeInbound(ctx); !ok || msg.Content != "hi" {
+		t.Fatalf("inbound = %+v", msg)
+	}
+	if err := c.Send(ctx, bus.OutboundMessage{Channel: "whatsapp", ChatID: "bob", Content: "yo"}); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if f := readFrame(t, conn); f.Type != "message" || f.Seq != 0 || f.Content != "yo" {
+		t.Errorf("sent %+v, want a v1 message", f)
+	}
+
+	// Reactions both ways
+	conn.WriteJSON(map[string]interface{}{"type": "reaction", "from": "alice", "message_id": "m1", "emoji": "👍", "from_me": true})
+	msg, ok := msgBus.ConsumeInbound(ctx)
+	if !ok || msg.Reaction == nil || msg.Reaction.On != bus.ReactionOnBot || msg.Content != "/good" ||
+		msg.Metadata["reaction"] != "👍" || msg.Metadata["target_message_id"] != "m1" {
+		t.Fatalf("inbound reaction = %+v", msg)
+	}
+	if err := c.React(ctx, "bob", bus.Reaction{MessageID: "m2", Emoji: "✅", Author: "bob"}); err != nil {
+		t.Fatalf("React() error = %v", err)
+	}
+	if f := readFrame(t, conn); f.Type != "reaction" || f.To != "bob" || f.MessageID != "m2" || f.Emoji != "✅" || f.Author != "bob" {
+		t.Errorf("sent %+v, want a reaction", f)
+	}
+	c.React(ctx, "bob", bus.Reaction{MessageID: "m2", Emoji: "✅", Remove: true})
+	if f := readFrame(t, conn); f.Type != "reaction" || f.Emoji != "" {
+		t.Errorf("sent %+v, want a reaction without emoji", f)
+	}
+}
+
+func TestBridgeReconnectDelay(t *testing.T) {
+	tests := []struct {
+		attempt  int
+		min, max time.Duration
+	}{
+		{1, 500 * time.Millisecond, time.Second},
+		{3, 2 * time.Second, 4 * time.Second},
+		{7, 30 * time.Second, time.Minute},
+		{100, 30 * time.Second, time.Minute},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			if d := bridgeReconnectDelay(tt.attempt); d < tt.min || d > tt.max {
+				t.Fatalf("bridgeReconnectDelay(%d) = %v, want %v to %v", tt.attempt, d, tt.min, tt.max)
+			}
+		}
+	}
+}
@@ -0,0 +1,57 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package channels
+
+import "sync"
+
+// chatSenders runs the sends for each chat in order on a goroutine of its
+// own, so a reply paced out over several messages, or a slow send, holds up
+// only its own chat. A chat's goroutine exits once its queue is empty.
+type chatSenders struct {
+	mu     sync.Mutex
+	queues map[string][]func() // "channel:chat_id" -> sends waiting their turn
+	wg     sync.WaitGroup
+}
+
+// run queues send behind the earlier sends for key, starting the key's
+// goroutine if none is running.
+func (s *chatSenders) run(key string, send func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.queues == nil {
+		s.queues = make(map[string][]func())
+	}
+	queue, running := s.queues[key]
+	s.queues[key] = append(queue, send)
+	if running {
+		return
+	}
+	s.wg.Add(1)
+	go s.drain(key)
+}
+
+func (s *chatSenders) drain(key string) {
+	defer s.wg.Done()
+	for {
+		s.mu.Lock()
+		queue := s.queues[key]
+		if len(queue) == 0 {
+			delete(s.queues, key)
+			s.mu.Unlock()
+			return
+		}
+		send := queue[0]
+		s.queues[key] = queue[1:]
+		s.mu.Unlock()
+		send()
+	}
+}
+
+// wait blocks until every queued send has finished.
+func (s *chatSenders) wait() {
+	s.wg.Wait()
+}
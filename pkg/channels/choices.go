@@ -0,0 +1,87 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package channels
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+// ChoiceChannel is implemented by channels that take an answer to choices
+// they showed as text, such as a WhatsApp reply of "2" to a numbered list,
+// as choosing one. Every channel built on BaseChannel implements it.
+type ChoiceChannel interface {
+	OfferChoices(chatID string, choices []bus.Choice)
+}
+
+// choiceTTL is how long choices offered in a chat can be answered.
+const choiceTTL = 24 * time.Hour
+
+type offer struct {
+	choices []bus.Choice
+	expires time.Time
+}
+
+// OfferChoices implements ChoiceChannel. The choices replace any offered
+// in the chat before and stand until the next message in the chat, which
+// either answers them by number or text or moves on.
+func (c *BaseChannel) OfferChoices(chatID string, choices []bus.Choice) {
+	c.choicesMu.Lock()
+	defer c.choicesMu.Unlock()
+	if c.choices == nil {
+		c.choices = make(map[string]offer)
+	}
+	c.choices[chatID] = offer{choices: choices, expires: time.Now().Add(choiceTTL)}
+}
+
+// takeChoice ends the offer in chatID and returns the choice content
+// answers, if any: one's number, or its text in any case.
+func (c *BaseChannel) takeChoice(chatID, content string) (bus.Choice, bool) {
+	c.choicesMu.Lock()
+	o, ok := c.choices[chatID]
+	delete(c.choices, chatID)
+	c.choicesMu.Unlock()
+	if !ok || time.Now().After(o.expires) {
+		return bus.Choice{}, false
+	}
+
+	answer := strings.TrimSpace(content)
+	if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(o.choices) {
+		return o.choices[n-1], true
+	}
+	for _, choice := range o.choices {
+		if strings.EqualFold(answer, choice.Text) {
+			return choice, true
+		}
+	}
+	return bus.Choice{}, false
+}
+
+// HandleInteraction passes on a user's answer to a message's buttons,
+// quick replies, or menu: it publishes it as a bus.Interaction and hands
+// in.Data to the agent as a message from the user, with "interaction"
+// metadata the kind and "button" set to "true".
+func (c *BaseChannel) HandleInteraction(in bus.Interaction, metadata map[string]string) {
+	if !c.admits(in.SenderID, in.ChatID, "interaction") {
+		return
+	}
+	if c.awaitingApproval(in.ChatID) {
+		return
+	}
+	in.Channel = c.name
+	c.bus.PublishInteraction(in)
+
+	if metadata == nil {
+		metadata = make(map[string]string)
+	}
+	metadata["button"] = "true"
+	metadata["interaction"] = in.Kind
+	c.HandleMessage(in.SenderID, in.ChatID, in.Data, nil, metadata)
+}
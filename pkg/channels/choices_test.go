@@ -0,0 +1,71 @@
+package channels
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+func TestChoicesAnsweredAsText(t *testing.T) {
+	mb := bus.NewMessageBus()
+	var interactions []bus.Interaction
+	mb.OnInteraction(func(i bus.Interaction) { interactions = append(interactions, i) })
+	fake := NewFake("whatsapp", mb, nil)
+	m := &Manager{chunker: newStreamChunker()}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	offer := bus.OutboundMessage{
+		Channel:      "whatsapp",
+		ChatID:       "49",
+		Content:      "Which size?",
+		QuickReplies: []bus.Button{{Text: "Not now", Data: "/skip"}},
+		Menu:         &bus.Menu{Options: []bus.Button{{Text: "Small", Data: "size S"}, {Text: "Large", Data: "size L"}}},
+	}
+	receive := func(content string) bus.InboundMessage {
+		t.Helper()
+		fake.Receive("alice", "49", content)
+		msg, ok := mb.ConsumeInbound(ctx)
+		if !ok {
+			t.Fatal("no inbound message")
+		}
+		return msg
+	}
+
+	if err := m.deliver(ctx, fake, offer); err != nil {
+		t.Fatal(err)
+	}
+	if sent := fake.Sent(); len(sent) != 1 || !strings.Contains(sent[0].Content, "3. Large") {
+		t.Fatalf("sent %+v, want numbered choices", sent)
+	}
+	if msg := receive(" 3 "); msg.Content != "size L" || msg.Metadata["interaction"] != bus.InteractionMenu {
+		t.Errorf("answer = %q %v, want the option's data", msg.Content, msg.Metadata)
+	}
+	want := bus.Interaction{Channel: "whatsapp", ChatID: "49", SenderID: "alice", Kind: bus.InteractionMenu, Data: "size L"}
+	if len(interactions) != 1 || interactions[0] != want {
+		t.Errorf("interactions = %+v, want %+v", interactions, want)
+	}
+	// The answer ends the offer
+	if msg := receive("2"); msg.Content != "2" {
+		t.Errorf("second answer = %q, want it as written", msg.Content)
+	}
+
+	if err := m.deliver(ctx, fake, offer); err != nil {
+		t.Fatal(err)
+	}
+	if msg := receive("not now"); msg.Content != "/skip" {
+		t.Errorf("answer by text = %q, want %q", msg.Content, "/skip")
+	}
+
+	// Writing something else moves on
+	if err := m.deliver(ctx, fake, offer); err != nil {
+		t.Fatal(err)
+	}
+	receive("actually, never mind")
+	if msg := receive("1"); msg.Content != "1" {
+		t.Errorf("late answer = %q, want it as written", msg.Content)
+	}
+}
@@ -0,0 +1,230 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package channels
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/crash"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+// Delivery statuses. A message is queued until a channel accepts it, and
+// failed once the outbox gives up on it. Delivered and read come from
+// platform receipts, which only some channels have.
+const (
+	DeliveryQueued    = "queued"
+	DeliverySent      = "sent"
+	DeliveryDelivered = bus.ReceiptDelivered
+	DeliveryRead      = bus.ReceiptRead
+	DeliveryFailed    = "failed"
+)
+
+const (
+	// deliveryBucket holds tracked messages' Delivery records by ID.
+	deliveryBucket = "deliveries"
+	// deliveryIndexBucket maps "channel:chat_id:message_id" platform
+	// message IDs to delivery IDs, so receipts find their delivery.
+	deliveryIndexBucket = "delivery_ids"
+	// deliveryMaxAge is how long a delivery can be looked up.
+	deliveryMaxAge = 7 * 24 * time.Hour
+	// deliveryPruneInterval is how often older deliveries are removed.
+	deliveryPruneInterval = time.Hour
+)
+
+// deliveryRank orders the statuses; a delivery never moves back. Only a
+// queued message can fail, and one a channel did accept counts as sent even
+// if the outbox gave up on another attempt at it.
+var deliveryRank = map[string]int{
+	DeliveryQueued:    0,
+	DeliveryFailed:    1,
+	DeliverySent:      2,
+	DeliveryDelivered: 3,
+	DeliveryRead:      4,
+}
+
+// Delivery is the progress of a tracked outbound message.
+type Delivery struct {
+	ID      string `json:"id"`
+	Channel string `json:"channel"`
+	ChatID  string `json:"chat_id"`
+	Status  string `json:"status"`
+	// Times records when the message reached each status.
+	Times map[string]time.Time `json:"times"`
+	// Error is the last failed attempt to send. A queued message with an
+	// error is retried from the outbox.
+	Error string `json:"error,omitempty"`
+	// MessageIDs are the platform IDs of the messages sent, one for each
+	// part of a split reply, when the channel reports them.
+	MessageIDs []string `json:"message_ids,omitempty"`
+}
+
+// Send delivers msg like a reply from the agent and returns the ID under
+// which Delivery reports its progress. msg.ID is used when set. The error
+// is that of the first attempt; a message the channel did not accept stays
+// in the outbox for retry, as Delivery shows. A low-priority notification
+// may be held for the chat's digest instead, and stays queued until the
+// digest is sent. Without a state store, deliveries are not tracked.
+func (m *Manager) Send(ctx context.Context, msg bus.OutboundMessage) (string, error) {
+	m.mu.RLock()
+	channel, exists := m.channels[msg.Channel]
+	m.mu.RUnlock()
+	if !exists {
+		return "", fmt.Errorf("channel %s not found", msg.Channel)
+	}
+
+	if msg.ID == "" {
+		msg.ID = newDeliveryID()
+	}
+	if msg.TraceID == "" {
+		msg.TraceID = bus.NewTraceID()
+	}
+	msg.Partial = false
+	m.updateDelivery(msg.ID, msg.Channel, msg.ChatID, DeliveryQueued, "")
+	if m.holdDigest(ctx, msg) {
+		return msg.ID, nil
+	}
+	return msg.ID, m.deliverDurably(ctx, channel, msg)
+}
+
+// Delivery returns the tracked message with the given ID.
+func (m *Manager) Delivery(ctx context.Context, id string) (Delivery, bool, error) {
+	store := m.outboxStore()
+	if store == nil {
+		return Delivery{}, false, nil
+	}
+	var d Delivery
+	err := state.GetJSON(ctx, store, deliveryBucket, id, &d)
+	if errors.Is(err, state.ErrNotFound) {
+		return Delivery{}, false, nil
+	}
+	if err != nil {
+		return Delivery{}, false, err
+	}
+	return d, true, nil
+}
+
+func newDeliveryID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// updateDelivery moves a delivery on to status, recording the platform
+// IDs of messages sent for it. A status behind the current one only adds
+// its time and IDs; errText is kept as the last error.
+func (m *Manager) updateDelivery(id, channel, chatID, status, errText string, messageIDs ...string) {
+	store := m.outboxStore()
+	if store == nil {
+		return
+	}
+	ctx := context.Background()
+
+	m.deliveryMu.Lock()
+	defer m.deliveryMu.Unlock()
+
+	var d Delivery
+	if err := state.GetJSON(ctx, store, deliveryBucket, id, &d); err != nil {
+		d = Delivery{ID: id, Channel: channel, ChatID: chatID, Status: DeliveryQueued,
+			Times: map[string]time.Time{DeliveryQueued: time.Now()}}
+	}
+	if _, seen := d.Times[status]; !seen {
+		d.Times[status] = time.Now()
+	}
+	if deliveryRank[status] >= deliveryRank[d.Status] {
+		d.Status = status
+	}
+	if errText != "" {
+		d.Error = errText
+	}
+	d.MessageIDs = append(d.MessageIDs, messageIDs...)
+
+	if err := state.PutJSON(ctx, store, deliveryBucket, id, d); err != nil {
+		logger.WarnCF("channels", "Failed to record delivery status",
+			map[string]interface{}{"channel": channel, "status": status, "error": err.Error()})
+	}
+}
+
+// indexDelivery lets receipts for a platform message find its delivery.
+func (m *Manager) indexDelivery(msg bus.OutboundMessage, messageID string) {
+	store := m.outboxStore()
+	if store == nil {
+		return
+	}
+	key := msg.Channel + ":" + msg.ChatID + ":" + messageID
+	if err := store.Put(context.Background(), deliveryIndexBucket, key, []byte(msg.ID)); err != nil {
+		logger.WarnCF("channels", "Failed to index delivery",
+			map[string]interface{}{"channel": msg.Channel, "error": err.Error()})
+	}
+}
+
+// handleReceipt moves the deliveries a receipt refers to on. Receipts for
+// untracked messages are ignored.
+func (m *Manager) handleReceipt(r bus.Receipt) {
+	store := m.outboxStore()
+	if store == nil {
+		return
+	}
+	go func() {
+		defer crash.Recover("channels."+r.Channel, nil)
+		for _, messageID := range r.MessageIDs {
+			id, err := store.Get(context.Background(), deliveryIndexBucket, r.Channel+":"+r.ChatID+":"+messageID)
+			if err != nil {
+				continue
+			}
+			m.updateDelivery(string(id), r.Channel, r.ChatID, r.Status, "")
+		}
+	}()
+}
+
+// pruneDeliveries removes deliveries queued more than deliveryMaxAge ago,
+// with their index entries.
+func (m *Manager) pruneDeliveries(ctx context.Context) {
+	store := m.outboxStore()
+	if store == nil {
+		return
+	}
+	entries, err := store.List(ctx, deliveryBucket)
+	if err != nil {
+		logger.WarnCF("channels", "Failed to read deliveries", map[string]interface{}{"error": err.Error()})
+		return
+	}
+	for id, data := range entries {
+		var d Delivery
+		if json.Unmarshal(data, &d) == nil && time.Since(d.Times[DeliveryQueued]) < deliveryMaxAge {
+			continue
+		}
+		for _, messageID := range d.MessageIDs {
+			store.Delete(ctx, deliveryIndexBucket, d.Channel+":"+d.ChatID+":"+messageID)
+		}
+		store.Delete(ctx, deliveryBucket, id)
+	}
+}
+
+// sentHookKey carries the func told about each platform message a channel
+// sends while delivering a tracked message.
+type sentHookKey struct{}
+
+func withSentHook(ctx context.Context, fn func(messageID string)) context.Context {
+	return context.WithValue(ctx, sentHookKey{}, fn)
+}
+
+// reportSent tells the delivery being tracked, if any, the platform ID of
+// a message the channel just sent. Channels call it from Send.
+func reportSent(ctx context.Context, messageID string) {
+	if fn, ok := ctx.Value(sentHookKey{}).(func(string)); ok && messageID != "" {
+		fn(messageID)
+	}
+}
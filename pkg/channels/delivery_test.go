@@ -0,0 +1,146 @@
+package channels
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+// numberingChannel reports a platform ID for each message it sends.
+type numberingChannel struct {
+	flakyChannel
+}
+
+func (c *numberingChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if err := c.flakyChannel.Send(ctx, msg); err != nil {
+		return err
+	}
+	reportSent(ctx, fmt.Sprintf("m%d", len(c.sent)))
+	return nil
+}
+
+// waitForDelivery polls for a delivery until done accepts it, as receipts
+// are handled in the background.
+func waitForDelivery(t *testing.T, m *Manager, id string, done func(Delivery) bool) Delivery {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		d, ok, err := m.Delivery(context.Background(), id)
+		if err != nil || !ok {
+			t.Fatalf("Delivery(%q) = %v, %v", id, ok, err)
+		}
+		if done(d) || time.Now().After(deadline) {
+			return d
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSendTracksDelivery(t *testing.T) {
+	ch := &numberingChannel{flakyChannel{BaseChannel: NewBaseChannel("whatsapp", nil, nil, nil)}}
+	m := &Manager{channels: map[string]Channel{"whatsapp": ch}, chunker: newStreamChunker(), state: state.NewMemoryStore()}
+	ctx := context.Background()
+
+	id, err := m.Send(ctx, bus.OutboundMessage{Channel: "whatsapp", ChatID: "1", Content: "disk full"})
+	if err != nil || id == "" {
+		t.Fatalf("Send() = %q, %v", id, err)
+	}
+	d, _, _ := m.Delivery(ctx, id)
+	if d.Status != DeliverySent || len(d.MessageIDs) != 1 || d.MessageIDs[0] != "m1" {
+		t.Fatalf("delivery = %+v, want sent as m1", d)
+	}
+
+	// Receipts move it on; a late delivered receipt does not move it back
+	m.handleReceipt(bus.Receipt{Channel: "whatsapp", ChatID: "1", MessageIDs: []string{"m1"}, Status: bus.ReceiptRead})
+	waitForDelivery(t, m, id, func(d Delivery) bool { return d.Status == DeliveryRead })
+	m.handleReceipt(bus.Receipt{Channel: "whatsapp", ChatID: "1", MessageIDs: []string{"m1"}, Status: bus.ReceiptDelivered})
+	d = waitForDelivery(t, m, id, func(d Delivery) bool { return !d.Times[DeliveryDelivered].IsZero() })
+	if d.Status != DeliveryRead || d.Times[DeliveryDelivered].IsZero() {
+		t.Errorf("delivery = %+v, want read with a delivered time", d)
+	}
+
+	if _, ok, _ := m.Delivery(ctx, "nope"); ok {
+		t.Error("Delivery() found an unknown ID")
+	}
+}
+
+func TestSendFailedDelivery(t *testing.T) {
+	ch := &numberingChannel{flakyChannel{BaseChannel: NewBaseChannel("whatsapp", nil, nil, nil), fail: true}}
+	store := state.NewMemoryStore()
+	m := &Manager{channels: map[string]Channel{"whatsapp": ch}, chunker: newStreamChunker(), state: store}
+	ctx := context.Background()
+
+	id, err := m.Send(ctx, bus.OutboundMessage{Channel: "whatsapp", ChatID: "1", Content: "disk full"})
+	if err == nil {
+		t.Fatal("Send() should report the send error")
+	}
+	d, _, _ := m.Delivery(ctx, id)
+	if d.Status != DeliveryQueued || d.Error != "network down" {
+		t.Errorf("delivery = %+v, want queued for retry", d)
+	}
+
+	// The outbox gives up after its last attempt
+	for key, entry := range outboxEntries(t, store) {
+		entry.Attempts = outboxMaxAttempts - 1
+		m.settleOutbox(store, key, entry, fmt.Errorf("network down"))
+	}
+	d, _, _ = m.Delivery(ctx, id)
+	if d.Status != DeliveryFailed || d.Times[DeliveryFailed].IsZero() {
+		t.Errorf("delivery = %+v, want failed", d)
+	}
+
+	if _, err := m.Send(ctx, bus.OutboundMessage{Channel: "sms", ChatID: "1"}); err == nil {
+		t.Error("Send() to an unknown channel should fail")
+	}
+}
+
+func TestDeliveryStatusOrder(t *testing.T) {
+	m := &Manager{state: state.NewMemoryStore()}
+	ctx := context.Background()
+
+	// A late "sent" replaces "failed", and a late "failed" never replaces "sent"
+	m.updateDelivery("a", "whatsapp", "1", DeliveryFailed, "network down")
+	m.updateDelivery("a", "whatsapp", "1", DeliverySent, "")
+	m.updateDelivery("b", "whatsapp", "1", DeliverySent, "")
+	m.updateDelivery("b", "whatsapp", "1", DeliveryFailed, "network down")
+	for _, id := range []string{"a", "b"} {
+		if d, _, _ := m.Delivery(ctx, id); d.Status != DeliverySent || d.Times[DeliveryFailed].IsZero() {
+			t.Errorf("delivery %s = %+v, want sent with a failed time", id, d)
+		}
+	}
+
+	seen := map[int]string{}
+	for status, rank := range deliveryRank {
+		if other, ok := seen[rank]; ok {
+			t.Errorf("%s and %s share rank %d", status, other, rank)
+		}
+		seen[rank] = status
+	}
+}
+
+func TestPruneDeliveries(t *testing.T) {
+	store := state.NewMemoryStore()
+	m := &Manager{state: store}
+	ctx := context.Background()
+
+	old := Delivery{ID: "old", Channel: "whatsapp", ChatID: "1", Status: DeliveryRead, MessageIDs: []string{"m1"},
+		Times: map[string]time.Time{DeliveryQueued: time.Now().Add(-deliveryMaxAge - time.Hour)}}
+	state.PutJSON(ctx, store, deliveryBucket, "old", old)
+	store.Put(ctx, deliveryIndexBucket, "whatsapp:1:m1", []byte("old"))
+	m.updateDelivery("new", "whatsapp", "1", DeliveryQueued, "")
+
+	m.pruneDeliveries(ctx)
+	if _, ok, _ := m.Delivery(ctx, "old"); ok {
+		t.Error("old delivery was not pruned")
+	}
+	if _, err := store.Get(ctx, deliveryIndexBucket, "whatsapp:1:m1"); err == nil {
+		t.Error("old delivery's index entry was not pruned")
+	}
+	if _, ok, _ := m.Delivery(ctx, "new"); !ok {
+		t.Error("new delivery was pruned")
+	}
+}
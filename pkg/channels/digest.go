@@ -0,0 +1,332 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/adhocore/gronx"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/commands"
+	"github.com/sipeed/picoclaw/pkg/i18n"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/state"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+const (
+	// digestBucket holds low-priority notifications waiting for their
+	// chat's digest. Keys sort in queue order.
+	digestBucket = "digest"
+	// digestChatsBucket holds the chats users switched digests off or back
+	// on for, by "channel:chat_id".
+	digestChatsBucket = "digest_chats"
+	// digestMaxAge drops notifications no digest could be sent for, e.g.
+	// to a channel since removed.
+	digestMaxAge = 7 * 24 * time.Hour
+	// digestItemLength caps each notification's line in a digest.
+	digestItemLength = 200
+)
+
+var digestSeq atomic.Uint64
+
+// digestItem is a notification held for a digest.
+type digestItem struct {
+	Message bus.OutboundMessage `json:"message"`
+	Queued  time.Time           `json:"queued"`
+}
+
+// DigestMode reports whether low-priority notifications to the chat are
+// held for its digest: when digests are enabled, unless the chat switched
+// them off.
+func (m *Manager) DigestMode(ctx context.Context, channel, chatID string) bool {
+	if m.config == nil || !m.config.Digest.Enabled {
+		return false
+	}
+	if store := m.outboxStore(); store != nil {
+		if v, err := store.Get(ctx, digestChatsBucket, channel+":"+chatID); err == nil {
+			return string(v) != "off"
+		}
+	}
+	return true
+}
+
+// SetDigestMode switches digests off or back on for one chat. Switching
+// them off sends what the chat's digest holds at once.
+func (m *Manager) SetDigestMode(ctx context.Context, channel, chatID string, on bool) error {
+	store := m.outboxStore()
+	if store == nil {
+		return fmt.Errorf("digests need the state store")
+	}
+	v := "off"
+	if on {
+		v = "on"
+	}
+	if err := store.Put(ctx, digestChatsBucket, channel+":"+chatID, []byte(v)); err != nil {
+		return err
+	}
+	if !on {
+		m.sendDigests(ctx, channel+":"+chatID, time.Now())
+	}
+	return nil
+}
+
+// holdDigest keeps msg for its chat's digest if it is a plain low-priority
+// notification to a chat in digest mode.
+func (m *Manager) holdDigest(ctx context.Context, msg bus.OutboundMessage) bool {
+	store := m.outboxStore()
+	if store == nil || msg.Priority != bus.PriorityLow || msg.Partial || !collapsible(msg) ||
+		!m.DigestMode(ctx, msg.Channel, msg.ChatID) {
+		return false
+	}
+
+	item := digestItem{Message: msg, Queued: time.Now()}
+	key := fmt.Sprintf("%020d-%06d", item.Queued.UnixNano(), digestSeq.Add(1)%1000000)
+	if err := state.PutJSON(ctx, store, digestBucket, key, item); err != nil {
+		logger.WarnCF("channels", "Failed to hold notification for digest, sending it now",
+			map[string]interface{}{"channel": msg.Channel, "error": err.Error()})
+		return false
+	}
+	logger.DebugCF("channels", "Held notification for digest",
+		map[string]interface{}{"channel": msg.Channel, "chat_id": msg.ChatID})
+	return true
+}
+
+// runDigests sends the digests on the configured schedule until ctx is
+// cancelled.
+func (m *Manager) runDigests(ctx context.Context) {
+	schedule := m.config.Digest.Schedule
+	for {
+		next, err := gronx.NextTickAfter(schedule, time.Now(), false)
+		if err != nil {
+			logger.ErrorCF("channels", "Invalid digest schedule, digests are not sent",
+				map[string]interface{}{"schedule": schedule, "error": err.Error()})
+			return
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case now := <-timer.C:
+			m.sendDigests(ctx, "", now)
+		}
+	}
+}
+
+// sendDigests sends each chat's held notifications as one message, for
+// the chats on channels this instance holds: every chat, or the one chat
+// ("channel:chat_id"). It returns how many notifications went out.
+func (m *Manager) sendDigests(ctx context.Context, chat string, now time.Time) int {
+	store := m.outboxStore()
+	if store == nil {
+		return 0
+	}
+	entries, err := store.List(ctx, digestBucket)
+	if err != nil {
+		logger.WarnCF("channels", "Failed to read digests", map[string]interface{}{"error": err.Error()})
+		return 0
+	}
+	keys := make([]string, 0, len(entries))
+	for k := range entries {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	type batch struct {
+		keys  []string
+		items []digestItem
+	}
+	batches := make(map[string]*batch)
+	var order []string
+	for _, k := range keys {
+		var item digestItem
+		if json.Unmarshal(entries[k], &item) != nil {
+			store.Delete(ctx, digestBucket, k)
+			continue
+		}
+		msg := item.Message
+		target := msg.Channel + ":" + msg.ChatID
+		if chat != "" && target != chat {
+			continue
+		}
+		m.mu.RLock()
+		_, exists := m.channels[msg.Channel]
+		m.mu.RUnlock()
+		if !exists || !m.holds(msg.Channel) {
+			if now.Sub(item.Queued) > digestMaxAge {
+				store.Delete(ctx, digestBucket, k)
+			}
+			continue
+		}
+		b, ok := batches[target]
+		if !ok {
+			b = &batch{}
+			batches[target] = b
+			order = append(order, target)
+		}
+		b.keys = append(b.keys, k)
+		b.items = append(b.items, item)
+	}
+
+	sent := 0
+	for _, target := range order {
+		b := batches[target]
+		first := b.items[0].Message
+		m.mu.RLock()
+		channel := m.channels[first.Channel]
+		m.mu.RUnlock()
+		msg := bus.OutboundMessage{
+			Channel:  first.Channel,
+			ChatID:   first.ChatID,
+			ThreadID: first.ThreadID,
+			Content:  m.digestText(first.Channel, first.ChatID, b.items),
+			TraceID:  bus.NewTraceID(),
+		}
+		// Once in the outbox the digest is retried like any message
+		err := m.deliverDurably(ctx, channel, msg)
+		for i, k := range b.keys {
+			store.Delete(ctx, digestBucket, k)
+			if id := b.items[i].Message.ID; id != "" && err == nil {
+				m.updateDelivery(id, msg.Channel, msg.ChatID, DeliverySent, "")
+			}
+		}
+		if err != nil {
+			logger.WarnCF("channels", "Failed to send digest, left for retry", map[string]interface{}{
+				"channel": msg.Channel,
+				"chat_id": msg.ChatID,
+				"error":   err.Error(),
+			})
+		} else {
+			logger.InfoCF("channels", "Sent digest", map[string]interface{}{
+				"channel":       msg.Channel,
+				"chat_id":       msg.ChatID,
+				"notifications": len(b.items),
+			})
+		}
+		sent += len(b.items)
+	}
+	return sent
+}
+
+// digestText lists the notifications, oldest first, one line each with
+// the time it came in. Repeats of a notification are counted on its first
+// line, and only the latest MaxItems lines are listed.
+func (m *Manager) digestText(channel, chatID string, items []digestItem) string {
+	type line struct {
+		at    time.Time
+		text  string
+		count int
+	}
+	var lines []*line
+	seen := make(map[string]*line)
+	for _, item := range items {
+		text, _, _ := strings.Cut(strings.TrimSpace(item.Message.Content), "\n")
+		text = utils.Truncate(text, digestItemLength)
+		if l, ok := seen[text]; ok {
+			l.count++
+			continue
+		}
+		l := &line{at: item.Queued, text: text, count: 1}
+		seen[text] = l
+		lines = append(lines, l)
+	}
+
+	maxItems := m.config.Digest.MaxItems
+	if maxItems <= 0 {
+		maxItems = 20
+	}
+	var sb strings.Builder
+	sb.WriteString(i18n.T(channel, chatID, "digest.header", len(items)))
+	sb.WriteString("\n")
+	if omitted := len(lines) - maxItems; omitted > 0 {
+		lines = lines[omitted:]
+		fmt.Fprintf(&sb, "\n%s", i18n.T(channel, chatID, "digest.more", omitted))
+	}
+	for _, l := range lines {
+		fmt.Fprintf(&sb, "\n- %s %s", l.at.Local().Format("15:04"), l.text)
+		if l.count > 1 {
+			fmt.Fprintf(&sb, " (×%d)", l.count)
+		}
+	}
+	return sb.String()
+}
+
+// pendingDigest counts the notifications held for a chat's digest.
+func (m *Manager) pendingDigest(ctx context.Context, channel, chatID string) int {
+	store := m.outboxStore()
+	if store == nil {
+		return 0
+	}
+	entries, err := store.List(ctx, digestBucket)
+	if err != nil {
+		return 0
+	}
+	n := 0
+	for _, data := range entries {
+		var item digestItem
+		if json.Unmarshal(data, &item) == nil && item.Message.Channel == channel && item.Message.ChatID == chatID {
+			n++
+		}
+	}
+	return n
+}
+
+// digestCommand implements "/digest [now|on|off]": how many notifications
+// wait for the chat's digest and when it is due, sending it now, or
+// switching digests on or off for the chat.
+func (m *Manager) digestCommand(ctx context.Context, req commands.Request) string {
+	msg := req.Msg
+	t := func(key string, args ...interface{}) string { return i18n.T(msg.Channel, msg.ChatID, key, args...) }
+	if m.config == nil || !m.config.Digest.Enabled {
+		return t("digest.disabled")
+	}
+	if m.outboxStore() == nil {
+		return t("digest.failed")
+	}
+
+	if len(req.Args) == 0 {
+		if !m.DigestMode(ctx, msg.Channel, msg.ChatID) {
+			return t("digest.status_off")
+		}
+		next, err := gronx.NextTickAfter(m.config.Digest.Schedule, time.Now(), false)
+		if err != nil {
+			return t("digest.failed")
+		}
+		return t("digest.status", m.pendingDigest(ctx, msg.Channel, msg.ChatID), next.Format("Mon 15:04"))
+	}
+
+	switch strings.ToLower(req.Args[0]) {
+	case "now":
+		if m.sendDigests(ctx, msg.Channel+":"+msg.ChatID, time.Now()) == 0 {
+			return t("digest.empty")
+		}
+		return ""
+	case "on", "off":
+		on := strings.EqualFold(req.Args[0], "on")
+		if err := m.SetDigestMode(ctx, msg.Channel, msg.ChatID, on); err != nil {
+			logger.WarnCF("channels", "Failed to switch digests", map[string]interface{}{
+				"channel": msg.Channel,
+				"error":   err.Error(),
+			})
+			return t("digest.failed")
+		}
+		if on {
+			return t("digest.on")
+		}
+		return t("digest.off")
+	default:
+		return t("digest.usage")
+	}
+}
@@ -0,0 +1,124 @@
+package channels
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/commands"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+func TestDigest(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Digest = config.DigestConfig{Enabled: true, Schedule: "0 9 * * *", MaxItems: 2}
+	ch := &flakyChannel{BaseChannel: NewBaseChannel("telegram", nil, nil, nil)}
+	ch.setRunning(true)
+	store := state.NewMemoryStore()
+	m := &Manager{channels: map[string]Channel{"telegram": ch}, chunker: newStreamChunker(), state: store, config: cfg}
+	ctx := context.Background()
+	low := func(chatID, content string) bus.OutboundMessage {
+		return bus.OutboundMessage{Channel: "telegram", ChatID: chatID, Content: content, Priority: bus.PriorityLow}
+	}
+
+	// Only plain low-priority notifications are held
+	for _, msg := range []bus.OutboundMessage{
+		low("1", "device online\nlaptop"),
+		low("1", "backup done"),
+		low("1", "device online\nphone"),
+		low("1", "disk 81% full"),
+		low("2", "backup done"),
+	} {
+		if !m.holdDigest(ctx, msg) {
+			t.Fatalf("holdDigest(%q) = false", msg.Content)
+		}
+	}
+	urgent := low("1", "server down")
+	urgent.Priority = ""
+	withButtons := low("1", "approve?")
+	withButtons.Buttons = []bus.Button{{Text: "Yes", Data: "yes"}}
+	if m.holdDigest(ctx, urgent) || m.holdDigest(ctx, withButtons) {
+		t.Error("held a message that is not a plain low-priority notification")
+	}
+	if n := m.pendingDigest(ctx, "telegram", "1"); n != 4 {
+		t.Errorf("pendingDigest() = %d, want 4", n)
+	}
+
+	// One message per chat, repeats counted and only the latest MaxItems listed
+	if n := m.sendDigests(ctx, "", time.Now()); n != 5 {
+		t.Errorf("sendDigests() = %d, want 5", n)
+	}
+	if len(ch.sent) != 2 {
+		t.Fatalf("sent = %q, want one digest per chat", ch.sent)
+	}
+	got := ch.sent[0]
+	for _, want := range []string{"4 notifications", "and 1 earlier", "backup done", "disk 81% full"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("digest = %q, want it to contain %q", got, want)
+		}
+	}
+	if strings.Contains(got, "laptop") || strings.Contains(got, "device online") {
+		t.Errorf("digest = %q, want the oldest line left out", got)
+	}
+	if n := m.pendingDigest(ctx, "telegram", "1"); n != 0 {
+		t.Errorf("pendingDigest() = %d after sending, want 0", n)
+	}
+
+	// Switching digests off sends what is held and stops holding
+	m.holdDigest(ctx, low("1", "device online"))
+	m.holdDigest(ctx, low("1", "device online"))
+	if err := m.SetDigestMode(ctx, "telegram", "1", false); err != nil {
+		t.Fatal(err)
+	}
+	if len(ch.sent) != 3 || !strings.Contains(ch.sent[2], "device online (×2)") {
+		t.Errorf("sent = %q, want the held digest sent at once", ch.sent)
+	}
+	if m.DigestMode(ctx, "telegram", "1") || m.holdDigest(ctx, low("1", "backup done")) {
+		t.Error("held a notification for a chat with digests off")
+	}
+	if !m.DigestMode(ctx, "telegram", "2") {
+		t.Error("digests switched off for another chat")
+	}
+}
+
+func TestDigestCommand(t *testing.T) {
+	cfg := config.DefaultConfig()
+	ch := &flakyChannel{BaseChannel: NewBaseChannel("telegram", nil, nil, nil)}
+	ch.setRunning(true)
+	m := &Manager{channels: map[string]Channel{"telegram": ch}, chunker: newStreamChunker(), state: state.NewMemoryStore(), config: cfg}
+	ctx := context.Background()
+	run := func(args ...string) string {
+		return m.digestCommand(ctx, commands.Request{
+			Msg:  bus.InboundMessage{Channel: "telegram", ChatID: "1"},
+			Name: "digest",
+			Args: args,
+		})
+	}
+
+	if got := run(); !strings.Contains(got, "not enabled") {
+		t.Errorf("/digest with digests disabled = %q", got)
+	}
+	cfg.Digest.Enabled = true
+	m.holdDigest(ctx, bus.OutboundMessage{Channel: "telegram", ChatID: "1", Content: "backup done", Priority: bus.PriorityLow})
+	if got := run(); !strings.Contains(got, "1 notifications") {
+		t.Errorf("/digest = %q, want the pending count", got)
+	}
+	if got := run("now"); got != "" || len(ch.sent) != 1 {
+		t.Errorf("/digest now = %q, sent %q", got, ch.sent)
+	}
+	if got := run("now"); !strings.Contains(got, "No notifications") {
+		t.Errorf("/digest now with nothing held = %q", got)
+	}
+	if got := run("off"); !strings.Contains(got, "at once") || m.DigestMode(ctx, "telegram", "1") {
+		t.Errorf("/digest off = %q", got)
+	}
+	if got := run("on"); !strings.Contains(got, "wait for the digest") || !m.DigestMode(ctx, "telegram", "1") {
+		t.Errorf("/digest on = %q", got)
+	}
+	if got := run("weekly"); !strings.Contains(got, "Usage") {
+		t.Errorf("/digest weekly = %q", got)
+	}
+}
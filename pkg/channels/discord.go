@@ -4,12 +4,19 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/commands"
 	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/i18n"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/render"
 	"github.com/sipeed/picoclaw/pkg/utils"
 	"github.com/sipeed/picoclaw/pkg/voice"
 )
@@ -17,6 +24,9 @@ import (
 const (
 	transcriptionTimeout = 30 * time.Second
 	sendTimeout          = 10 * time.Second
+	// discordTypingInterval renews the typing indicator, which Discord
+	// shows for about ten seconds.
+	discordTypingInterval = 8 * time.Second
 )
 
 type DiscordChannel struct {
@@ -25,6 +35,13 @@ type DiscordChannel struct {
 	config      config.DiscordConfig
 	transcriber *voice.GroqTranscriber
 	ctx         context.Context
+	streams     sync.Map // channelID -> ID of the message being streamed into
+	guilds      sync.Map // ID -> struct{} for the servers the bot is in
+	connected   atomic.Bool
+
+	commandsMu     sync.RWMutex
+	commands       map[string]commands.Command // Slash commands by name, see SetCommands
+	commandsSynced atomic.Bool                 // Set once registered with Discord
 }
 
 func NewDiscordChannel(cfg config.DiscordConfig, bus *bus.MessageBus) (*DiscordChannel, error) {
@@ -60,6 +77,21 @@ func (c *DiscordChannel) Start(ctx context.Context) error {
 
 	c.ctx = ctx
 	c.session.AddHandler(c.handleMessage)
+	c.session.AddHandler(c.handleReaction)
+	c.session.AddHandler(c.handleReactionRemove)
+	c.session.AddHandler(c.handleInteraction)
+	c.session.AddHandler(c.handleReady)
+	c.session.AddHandler(c.handleGuildCreate)
+	c.session.AddHandler(c.handleGuildDelete)
+	c.session.AddHandler(c.handleMemberAdd)
+	c.session.AddHandler(c.handleMemberRemove)
+	c.session.AddHandler(c.handleThreadUpdate)
+	c.session.AddHandler(c.handleChannelDelete)
+	if c.config.MemberEvents {
+		c.session.Identify.Intents |= discordgo.IntentsGuildMembers
+	}
+	c.session.AddHandler(func(_ *discordgo.Session, _ *discordgo.Connect) { c.connected.Store(true) })
+	c.session.AddHandler(func(_ *discordgo.Session, _ *discordgo.Disconnect) { c.connected.Store(false) })
 
 	if err := c.session.Open(); err != nil {
 		return fmt.Errorf("failed to open discord session: %w", err)
@@ -79,6 +111,12 @@ func (c *DiscordChannel) Start(ctx context.Context) error {
 	return nil
 }
 
+// Connected reports whether the gateway websocket is up. discordgo
+// reconnects on its own after a drop.
+func (c *DiscordChannel) Connected() bool {
+	return c.connected.Load()
+}
+
 func (c *DiscordChannel) Stop(ctx context.Context) error {
 	logger.InfoC("discord", "Stopping Discord bot")
 	c.setRunning(false)
@@ -96,6 +134,10 @@ func (c *DiscordChannel) Send(ctx context.Context, msg bus.OutboundMessage) erro
 	}
 
 	channelID := msg.ChatID
+	// A thread is a channel of its own
+	if msg.ThreadID != "" {
+		channelID = msg.ThreadID
+	}
 	if channelID == "" {
 		return fmt.Errorf("channel ID is empty")
 	}
@@ -106,9 +148,49 @@ func (c *DiscordChannel) Send(ctx context.Context, msg bus.OutboundMessage) erro
 	sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
 	defer cancel()
 
+	// Streaming: the first partial creates a message, later partials and the
+	// final reply edit it.
+	streamID, streaming := c.streams.Load(channelID)
+	if !msg.Partial {
+		c.streams.Delete(channelID)
+	}
+
+	// sentID is set before done is sent on
+	var sentID string
 	done := make(chan error, 1)
 	go func() {
-		_, err := c.session.ChannelMessageSend(channelID, message)
+		if len(msg.Media) > 0 {
+			id, err := c.sendWithMedia(channelID, streamID, streaming, msg)
+			sentID = id
+			done <- err
+			return
+		}
+		components := discordComponents(msg)
+		if streaming {
+			edit := discordgo.NewMessageEdit(channelID, streamID.(string)).SetContent(message)
+			if len(components) > 0 {
+				edit.Components = &components
+			}
+			_, err := c.session.ChannelMessageEditComplex(edit)
+			if err != nil {
+				// The next update starts a new message rather than
+				// editing one that may be gone
+				c.streams.CompareAndDelete(channelID, streamID)
+			}
+			sentID = streamID.(string)
+			done <- err
+			return
+		}
+		sent, err := c.session.ChannelMessageSendComplex(channelID, &discordgo.MessageSend{
+			Content:    message,
+			Components: components,
+		})
+		if err == nil {
+			sentID = sent.ID
+			if msg.Partial {
+				c.streams.Store(channelID, sent.ID)
+			}
+		}
 		done <- err
 	}()
 
@@ -117,12 +199,199 @@ func (c *DiscordChannel) Send(ctx context.Context, msg bus.OutboundMessage) erro
 		if err != nil {
 			return fmt.Errorf("failed to send discord message: %w", err)
 		}
+		reportSent(ctx, sentID)
 		return nil
 	case <-sendCtx.Done():
+		c.streams.Delete(channelID)
 		return fmt.Errorf("send message timeout: %w", sendCtx.Err())
 	}
 }
 
+// sendWithMedia posts the attachments with the text, or after editing the
+// streamed message when the reply was streamed, and returns the ID of the
+// message with the attachments.
+func (c *DiscordChannel) sendWithMedia(channelID string, streamID interface{}, streaming bool, msg bus.OutboundMessage) (string, error) {
+	send := &discordgo.MessageSend{Components: discordComponents(msg)}
+	if streaming {
+		if _, err := c.session.ChannelMessageEdit(channelID, streamID.(string), msg.Content); err != nil {
+			c.streams.CompareAndDelete(channelID, streamID)
+			return "", err
+		}
+	} else {
+		send.Content = msg.Content
+	}
+
+	for _, path := range msg.Media {
+		f, err := os.Open(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to open attachment: %w", err)
+		}
+		defer f.Close()
+		send.Files = append(send.Files, &discordgo.File{
+			Name:   filepath.Base(path),
+			Reader: f,
+		})
+	}
+
+	sent, err := c.session.ChannelMessageSendComplex(channelID, send)
+	if err != nil {
+		return "", err
+	}
+	return sent.ID, nil
+}
+
+// Capabilities reports that Discord renders Markdown itself and takes
+// attachments, edits for streaming, and buttons, in messages of up to
+// 2000 characters and uploads of up to 10 MB, the limit for servers
+// without boosts.
+func (c *DiscordChannel) Capabilities() render.Capabilities {
+	return render.Capabilities{Markup: render.Markdown, Media: true, Edits: true, Buttons: true, MaxLength: 2000, MaxAttachment: 10 << 20}
+}
+
+// StartIndicator shows the bot as typing in the channel while the agent
+// works. Once the agent is done, a streamed message the final reply has not
+// claimed within placeholderGrace is let go, so the next reply starts a new
+// message instead of editing it.
+func (c *DiscordChannel) StartIndicator(ctx context.Context, chatID, _ string) func() {
+	workCtx, cancel := context.WithCancel(ctx)
+	stop := func() {
+		cancel()
+		if streamID, ok := c.streams.Load(chatID); ok {
+			time.AfterFunc(placeholderGrace, func() {
+				c.streams.CompareAndDelete(chatID, streamID)
+			})
+		}
+	}
+	go func() {
+		ticker := time.NewTicker(discordTypingInterval)
+		defer ticker.Stop()
+		for {
+			if err := c.session.ChannelTyping(chatID, discordgo.WithContext(workCtx)); err != nil && workCtx.Err() == nil {
+				logger.DebugCF("discord", "Failed to send typing indicator", map[string]interface{}{
+					"channel_id": chatID,
+					"error":      err.Error(),
+				})
+			}
+			select {
+			case <-workCtx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return stop
+}
+
+// discordMenuID is the custom ID of a message's menu.
+const discordMenuID = "menu"
+
+// discordComponents lays buttons and then quick replies out in rows of
+// five, Discord's limit, followed by the menu. Quick replies are grey to
+// tell them apart.
+func discordComponents(msg bus.OutboundMessage) []discordgo.MessageComponent {
+	var rows []discordgo.MessageComponent
+	addRows := func(buttons []bus.Button, style discordgo.ButtonStyle) {
+		for i := 0; i < len(buttons); i += 5 {
+			row := discordgo.ActionsRow{}
+			for _, b := range buttons[i:min(i+5, len(buttons))] {
+				button := discordgo.Button{Label: b.Text, Style: style, CustomID: b.Data}
+				if b.URL != "" {
+					button = discordgo.Button{Label: b.Text, Style: discordgo.LinkButton, URL: b.URL}
+				}
+				row.Components = append(row.Components, button)
+			}
+			rows = append(rows, row)
+		}
+	}
+	addRows(msg.Buttons, discordgo.PrimaryButton)
+	addRows(msg.QuickReplies, discordgo.SecondaryButton)
+	if msg.Menu != nil && len(msg.Menu.Options) > 0 {
+		menu := discordgo.SelectMenu{
+			MenuType:    discordgo.StringSelectMenu,
+			CustomID:    discordMenuID,
+			Placeholder: msg.Menu.Placeholder,
+		}
+		for _, o := range msg.Menu.Options {
+			menu.Options = append(menu.Options, discordgo.SelectMenuOption{Label: o.Text, Value: o.Data})
+		}
+		rows = append(rows, discordgo.ActionsRow{Components: []discordgo.MessageComponent{menu}})
+	}
+	return rows
+}
+
+// discordInteraction returns the kind and data of a component interaction
+// on m: a pick from its menu, or a press of one of its buttons, which is a
+// quick reply when grey.
+func discordInteraction(m *discordgo.Message, data discordgo.MessageComponentInteractionData) (kind, value string) {
+	if data.ComponentType == discordgo.SelectMenuComponent {
+		if len(data.Values) == 0 {
+			return "", ""
+		}
+		return bus.InteractionMenu, data.Values[0]
+	}
+	kind = bus.InteractionButton
+	if m != nil {
+		for _, c := range m.Components {
+			row, ok := c.(*discordgo.ActionsRow)
+			if !ok {
+				continue
+			}
+			for _, rc := range row.Components {
+				if b, ok := rc.(*discordgo.Button); ok && b.CustomID == data.CustomID && b.Style == discordgo.SecondaryButton {
+					kind = bus.InteractionQuickReply
+				}
+			}
+		}
+	}
+	return kind, data.CustomID
+}
+
+// handleInteraction passes a button press or menu pick on as an
+// interaction, see BaseChannel.HandleInteraction, and slash commands on
+// to handleSlashCommand.
+func (c *DiscordChannel) handleInteraction(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	defer c.Recover()
+
+	if i.Type == discordgo.InteractionApplicationCommand {
+		c.handleSlashCommand(s, i)
+		return
+	}
+	if i.Type != discordgo.InteractionMessageComponent {
+		return
+	}
+	// Acknowledge, or the client reports the interaction as failed
+	s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseDeferredMessageUpdate,
+	})
+
+	user := i.User
+	if i.Member != nil && i.Member.User != nil {
+		user = i.Member.User
+	}
+	kind, data := discordInteraction(i.Message, i.MessageComponentData())
+	if user == nil || data == "" {
+		return
+	}
+	var messageID string
+	if i.Message != nil {
+		messageID = i.Message.ID
+	}
+
+	c.HandleInteraction(bus.Interaction{
+		ChatID:    i.ChannelID,
+		SenderID:  user.ID,
+		Kind:      kind,
+		Data:      data,
+		MessageID: messageID,
+	}, map[string]string{
+		"user_id":    user.ID,
+		"username":   user.Username,
+		"guild_id":   i.GuildID,
+		"channel_id": i.ChannelID,
+		"is_dm":      fmt.Sprintf("%t", i.GuildID == ""),
+	})
+}
+
 // appendContent safely appends content to existing text
 func appendContent(content, suffix string) string {
 	if content == "" {
@@ -131,7 +400,152 @@ func appendContent(content, suffix string) string {
 	return content + "\n" + suffix
 }
 
+// handleReaction passes reactions added to the bot's own messages on to
+// the agent.
+func (c *DiscordChannel) handleReaction(s *discordgo.Session, r *discordgo.MessageReactionAdd) {
+	defer c.Recover()
+	if r != nil {
+		c.passReaction(s, r.MessageReaction, false)
+	}
+}
+
+// handleReactionRemove passes reactions removed from the bot's own
+// messages on to the agent.
+func (c *DiscordChannel) handleReactionRemove(s *discordgo.Session, r *discordgo.MessageReactionRemove) {
+	defer c.Recover()
+	if r != nil {
+		c.passReaction(s, r.MessageReaction, true)
+	}
+}
+
+func (c *DiscordChannel) passReaction(s *discordgo.Session, r *discordgo.MessageReaction, remove bool) {
+	if r == nil || r.UserID == s.State.User.ID {
+		return
+	}
+	m, err := s.State.Message(r.ChannelID, r.MessageID)
+	if err != nil {
+		m, err = s.ChannelMessage(r.ChannelID, r.MessageID)
+	}
+	if err != nil || m.Author == nil {
+		return
+	}
+	on := bus.ReactionOnUser
+	if m.Author.ID == s.State.User.ID {
+		on = bus.ReactionOnBot
+	}
+	c.HandleReaction(r.UserID, r.ChannelID, bus.Reaction{
+		MessageID: r.MessageID,
+		Emoji:     r.Emoji.Name,
+		Remove:    remove,
+		On:        on,
+		Text:      m.Content,
+	}, nil)
+}
+
+// handleReady notes the servers the bot is in on connecting, so that only
+// servers joined later count as the bot being added.
+func (c *DiscordChannel) handleReady(_ *discordgo.Session, r *discordgo.Ready) {
+	for _, g := range r.Guilds {
+		c.guilds.Store(g.ID, struct{}{})
+	}
+	c.syncCommands()
+}
+
+// handleGuildCreate reports the bot being added to a server, in the
+// server's system channel, where Discord announces new members.
+func (c *DiscordChannel) handleGuildCreate(_ *discordgo.Session, g *discordgo.GuildCreate) {
+	defer c.Recover()
+	if g.Guild == nil {
+		return
+	}
+	if _, known := c.guilds.LoadOrStore(g.ID, struct{}{}); known || g.SystemChannelID == "" {
+		return
+	}
+	c.HandleChatEvent(g.SystemChannelID, bus.ChatBotAdded, nil, "")
+}
+
+// handleGuildDelete reports the bot being removed from a server, once for
+// each of its channels. A server becoming unavailable in an outage is not
+// a removal.
+func (c *DiscordChannel) handleGuildDelete(_ *discordgo.Session, g *discordgo.GuildDelete) {
+	defer c.Recover()
+	if g.Guild == nil || g.Unavailable {
+		return
+	}
+	c.guilds.Delete(g.ID)
+	if g.BeforeDelete == nil {
+		return
+	}
+	for _, ch := range g.BeforeDelete.Channels {
+		c.HandleChatEvent(ch.ID, bus.ChatBotRemoved, nil, "")
+	}
+}
+
+// handleMemberAdd reports a member joining a server, in its system
+// channel. Discord only sends these with member_events on.
+func (c *DiscordChannel) handleMemberAdd(s *discordgo.Session, m *discordgo.GuildMemberAdd) {
+	defer c.Recover()
+	if m.Member != nil {
+		c.passMember(s, m.Member, bus.ChatMemberJoined)
+	}
+}
+
+// handleMemberRemove reports a member leaving a server, in its system
+// channel.
+func (c *DiscordChannel) handleMemberRemove(s *discordgo.Session, m *discordgo.GuildMemberRemove) {
+	defer c.Recover()
+	if m.Member != nil {
+		c.passMember(s, m.Member, bus.ChatMemberLeft)
+	}
+}
+
+func (c *DiscordChannel) passMember(s *discordgo.Session, m *discordgo.Member, eventType string) {
+	if m.User == nil || m.User.ID == s.State.User.ID {
+		return
+	}
+	g, err := s.State.Guild(m.GuildID)
+	if err != nil || g.SystemChannelID == "" {
+		return
+	}
+	c.HandleChatEvent(g.SystemChannelID, eventType, []bus.ChatMember{{ID: m.User.ID, Name: m.DisplayName()}}, "")
+}
+
+// handleThreadUpdate reports a thread being archived.
+func (c *DiscordChannel) handleThreadUpdate(_ *discordgo.Session, t *discordgo.ThreadUpdate) {
+	defer c.Recover()
+	if t.Channel == nil || t.ThreadMetadata == nil || !t.ThreadMetadata.Archived {
+		return
+	}
+	if t.BeforeUpdate != nil && t.BeforeUpdate.ThreadMetadata != nil && t.BeforeUpdate.ThreadMetadata.Archived {
+		return
+	}
+	c.HandleChatEvent(t.ID, bus.ChatArchived, nil, "")
+}
+
+// handleChannelDelete reports a channel being deleted, as archived.
+func (c *DiscordChannel) handleChannelDelete(_ *discordgo.Session, ch *discordgo.ChannelDelete) {
+	defer c.Recover()
+	if ch.Channel != nil {
+		c.HandleChatEvent(ch.ID, bus.ChatArchived, nil, "")
+	}
+}
+
+// React adds or removes the bot's reaction on a message.
+func (c *DiscordChannel) React(ctx context.Context, chatID string, reaction bus.Reaction) error {
+	if reaction.Remove {
+		return c.session.MessageReactionRemove(chatID, reaction.MessageID, reaction.Emoji, "@me", discordgo.WithContext(ctx))
+	}
+	return c.session.MessageReactionAdd(chatID, reaction.MessageID, reaction.Emoji, discordgo.WithContext(ctx))
+}
+
+// DeleteMessage implements DeleteChannel.
+func (c *DiscordChannel) DeleteMessage(ctx context.Context, chatID, messageID string) error {
+	return c.session.ChannelMessageDelete(chatID, messageID, discordgo.WithContext(ctx))
+}
+
 func (c *DiscordChannel) handleMessage(s *discordgo.Session, m *discordgo.MessageCreate) {
+	defer c.Recover()
+
 	if m == nil || m.Author == nil {
 		return
 	}
@@ -141,10 +555,7 @@ func (c *DiscordChannel) handleMessage(s *discordgo.Session, m *discordgo.Messag
 	}
 
 	// Check allowlist before downloading attachments and transcribing
-	if !c.IsAllowed(m.Author.ID) {
-		logger.DebugCF("discord", "Message rejected by allowlist", map[string]any{
-			"user_id": m.Author.ID,
-		})
+	if !c.Admits(m.Author.ID, m.ChannelID) {
 		return
 	}
 
@@ -170,16 +581,31 @@ func (c *DiscordChannel) handleMessage(s *discordgo.Session, m *discordgo.Messag
 		}
 	}()
 
-	for _, attachment := range m.Attachments {
+	// Audio and images are fetched together; each is left out if it fails
+	var dl downloads
+	paths := make([]string, len(m.Attachments))
+	for i, attachment := range m.Attachments {
+		if utils.IsAudioFile(attachment.Filename, attachment.ContentType) || utils.IsImageFile(attachment.Filename, attachment.ContentType) {
+			dl.add(&paths[i], func(ctx context.Context) string {
+				return c.downloadAttachment(ctx, attachment)
+			})
+		}
+	}
+	dl.run(c.getContext(), "discord")
+
+	var audioSeconds float64
+	for i, attachment := range m.Attachments {
 		isAudio := utils.IsAudioFile(attachment.Filename, attachment.ContentType)
 
 		if isAudio {
-			localPath := c.downloadAttachment(attachment.URL, attachment.Filename)
+			localPath := paths[i]
 			if localPath != "" {
 				localFiles = append(localFiles, localPath)
 
 				transcribedText := ""
-				if c.transcriber != nil && c.transcriber.IsAvailable() {
+				if c.transcriber != nil && c.transcriber.IsAvailable() && !c.mayTranscribe(senderID, m.ChannelID) {
+					transcribedText = i18n.T(c.Name(), m.ChannelID, "voice.private")
+				} else if c.transcriber != nil && c.transcriber.IsAvailable() {
 					ctx, cancel := context.WithTimeout(c.getContext(), transcriptionTimeout)
 					result, err := c.transcriber.Transcribe(ctx, localPath)
 					cancel() // release context immediately to avoid leaking in loop
@@ -188,9 +614,10 @@ func (c *DiscordChannel) handleMessage(s *discordgo.Session, m *discordgo.Messag
 						logger.ErrorCF("discord", "Voice transcription failed", map[string]any{
 							"error": err.Error(),
 						})
-						transcribedText = fmt.Sprintf("[audio: %s (transcription failed)]", attachment.Filename)
+						transcribedText = i18n.T(c.Name(), m.ChannelID, "audio.transcription_failed", attachment.Filename)
 					} else {
 						transcribedText = fmt.Sprintf("[audio transcription: %s]", result.Text)
+						audioSeconds += result.Duration
 						logger.DebugCF("discord", "Audio transcribed successfully", map[string]any{
 							"text": result.Text,
 						})
@@ -208,6 +635,15 @@ func (c *DiscordChannel) handleMessage(s *discordgo.Session, m *discordgo.Messag
 				mediaPaths = append(mediaPaths, attachment.URL)
 				content = appendContent(content, fmt.Sprintf("[attachment: %s]", attachment.URL))
 			}
+		} else if utils.IsImageFile(attachment.Filename, attachment.ContentType) {
+			// Images are handed to the agent (for vision), which removes them
+			if localPath := paths[i]; localPath != "" {
+				mediaPaths = append(mediaPaths, localPath)
+				content = appendContent(content, fmt.Sprintf("[image: %s]", attachment.Filename))
+			} else {
+				mediaPaths = append(mediaPaths, attachment.URL)
+				content = appendContent(content, fmt.Sprintf("[attachment: %s]", attachment.URL))
+			}
 		} else {
 			mediaPaths = append(mediaPaths, attachment.URL)
 			content = appendContent(content, fmt.Sprintf("[attachment: %s]", attachment.URL))
@@ -233,16 +669,42 @@ func (c *DiscordChannel) handleMessage(s *discordgo.Session, m *discordgo.Messag
 		"user_id":      senderID,
 		"username":     m.Author.Username,
 		"display_name": senderName,
+		"avatar":       m.Author.AvatarURL(""),
 		"guild_id":     m.GuildID,
 		"channel_id":   m.ChannelID,
 		"is_dm":        fmt.Sprintf("%t", m.GuildID == ""),
 	}
+	if ch, err := s.State.Channel(m.ChannelID); err == nil && ch.IsThread() {
+		metadata["thread_id"] = m.ChannelID
+		metadata["parent_id"] = ch.ParentID
+	}
+	if audioSeconds > 0 {
+		metadata["transcription_seconds"] = strconv.FormatFloat(audioSeconds, 'f', 1, 64)
+	}
+
+	c.HandleReply(senderID, m.ChannelID, content, mediaPaths, metadata, discordQuote(m.Message))
+}
 
-	c.HandleMessage(senderID, m.ChannelID, content, mediaPaths, metadata)
+// discordQuote returns the message m replies to, or nil. Discord leaves
+// the referenced message out when it has been deleted or could not be
+// loaded; only its ID is known then.
+func discordQuote(m *discordgo.Message) *bus.Quote {
+	if m.Type != discordgo.MessageTypeReply || m.MessageReference == nil {
+		return nil
+	}
+	quote := &bus.Quote{MessageID: m.MessageReference.MessageID}
+	if ref := m.ReferencedMessage; ref != nil {
+		quote.Content = ref.Content
+		if ref.Author != nil {
+			quote.SenderID = ref.Author.ID
+		}
+	}
+	return quote
 }
 
-func (c *DiscordChannel) downloadAttachment(url, filename string) string {
-	return utils.DownloadFile(url, filename, utils.DownloadOptions{
+func (c *DiscordChannel) downloadAttachment(ctx context.Context, attachment *discordgo.MessageAttachment) string {
+	return utils.DownloadFileContext(ctx, attachment.URL, attachment.Filename, utils.DownloadOptions{
 		LoggerPrefix: "discord",
+		Kind:         utils.MediaKind(attachment.Filename, attachment.ContentType),
 	})
 }
@@ -0,0 +1,209 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package channels
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/sipeed/picoclaw/pkg/commands"
+	"github.com/sipeed/picoclaw/pkg/i18n"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// Discord's limits on slash commands.
+const (
+	discordMaxCommands    = 100
+	discordMaxDescription = 100
+)
+
+// discordCommandName is what Discord accepts as a command or option name.
+var discordCommandName = regexp.MustCompile(`^[-_\p{Ll}\p{N}]{1,32}$`)
+
+// SetCommands implements CommandChannel. With slash_commands on, the
+// commands are registered with Discord once connected, replacing any the
+// application had. Commands whose names Discord does not accept are left
+// out.
+func (c *DiscordChannel) SetCommands(cmds []commands.Command) {
+	if !c.config.SlashCommands {
+		return
+	}
+	byName := make(map[string]commands.Command, len(cmds))
+	for _, cmd := range cmds {
+		if discordCommandName.MatchString(cmd.Name) && len(byName) < discordMaxCommands {
+			byName[cmd.Name] = cmd
+		}
+	}
+	c.commandsMu.Lock()
+	c.commands = byName
+	c.commandsMu.Unlock()
+	c.commandsSynced.Store(false)
+	c.syncCommands()
+}
+
+// syncCommands registers the commands in the background unless they are
+// already, or the bot has not connected yet; handleReady calls it again.
+func (c *DiscordChannel) syncCommands() {
+	appID := c.applicationID()
+	c.commandsMu.RLock()
+	cmds := discordCommands(c.commands)
+	c.commandsMu.RUnlock()
+	if appID == "" || len(cmds) == 0 || !c.commandsSynced.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		defer c.Recover()
+		if _, err := c.session.ApplicationCommandBulkOverwrite(appID, "", cmds); err != nil {
+			c.commandsSynced.Store(false)
+			logger.WarnCF("discord", "Failed to register slash commands", map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		logger.InfoCF("discord", "Registered slash commands", map[string]interface{}{
+			"count": len(cmds),
+		})
+	}()
+}
+
+// applicationID returns the bot's application ID once connected.
+func (c *DiscordChannel) applicationID() string {
+	st := c.session.State
+	if st == nil {
+		return ""
+	}
+	if st.Application != nil && st.Application.ID != "" {
+		return st.Application.ID
+	}
+	if st.User != nil {
+		return st.User.ID
+	}
+	return ""
+}
+
+// discordOptions returns the options a command takes on Discord: its own,
+// or one text field for all arguments when it has a Usage but no options.
+func discordOptions(cmd commands.Command) []commands.Option {
+	if len(cmd.Options) > 0 || cmd.Usage == "" {
+		return cmd.Options
+	}
+	return []commands.Option{{Name: "args", Description: cmd.Usage}}
+}
+
+// discordCommands describes commands to Discord, sorted by name. Discord
+// wants required options first; the text sent keeps the commands' order,
+// see slashCommandText.
+func discordCommands(byName map[string]commands.Command) []*discordgo.ApplicationCommand {
+	out := make([]*discordgo.ApplicationCommand, 0, len(byName))
+	for _, cmd := range byName {
+		ac := &discordgo.ApplicationCommand{
+			Name:        cmd.Name,
+			Description: discordDescription(cmd.Description, "/"+cmd.Name),
+		}
+		for _, o := range discordOptions(cmd) {
+			if !discordCommandName.MatchString(o.Name) {
+				continue
+			}
+			option := &discordgo.ApplicationCommandOption{
+				Type:        discordgo.ApplicationCommandOptionString,
+				Name:        o.Name,
+				Description: discordDescription(o.Description, o.Name),
+				Required:    o.Required,
+			}
+			for _, choice := range o.Choices {
+				option.Choices = append(option.Choices, &discordgo.ApplicationCommandOptionChoice{Name: choice, Value: choice})
+			}
+			ac.Options = append(ac.Options, option)
+		}
+		sort.SliceStable(ac.Options, func(i, j int) bool { return ac.Options[i].Required && !ac.Options[j].Required })
+		out = append(out, ac)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// discordDescription fits text in a Discord description, which must not
+// be empty.
+func discordDescription(text, fallback string) string {
+	if strings.TrimSpace(text) == "" {
+		text = fallback
+	}
+	return utils.Truncate(text, discordMaxDescription)
+}
+
+// slashCommandText writes a slash command as it would have been typed:
+// the values given joined in the order of the command's options.
+func slashCommandText(cmd commands.Command, data discordgo.ApplicationCommandInteractionData) string {
+	values := make(map[string]string, len(data.Options))
+	var order []string
+	for _, o := range data.Options {
+		values[o.Name] = strings.TrimSpace(fmt.Sprint(o.Value))
+		order = append(order, o.Name)
+	}
+	if known := discordOptions(cmd); len(known) > 0 {
+		order = order[:0]
+		for _, o := range known {
+			order = append(order, o.Name)
+		}
+	}
+	parts := []string{"/" + data.Name}
+	for _, name := range order {
+		if v := values[name]; v != "" {
+			parts = append(parts, v)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// handleSlashCommand answers a slash command with the command as typed,
+// which Discord shows as the user's, and passes it on as a message from
+// the user, so the reply follows like any other.
+func (c *DiscordChannel) handleSlashCommand(s *discordgo.Session, i *discordgo.InteractionCreate) {
+	user := i.User
+	if i.Member != nil && i.Member.User != nil {
+		user = i.Member.User
+	}
+	if user == nil {
+		return
+	}
+	data := i.ApplicationCommandData()
+	c.commandsMu.RLock()
+	cmd := c.commands[data.Name]
+	c.commandsMu.RUnlock()
+	content := slashCommandText(cmd, data)
+
+	response := &discordgo.InteractionResponseData{Content: content}
+	if !c.IsAllowed(user.ID) {
+		response = &discordgo.InteractionResponseData{
+			Content: i18n.T(c.Name(), i.ChannelID, "discord.not_allowed"),
+			Flags:   discordgo.MessageFlagsEphemeral,
+		}
+	}
+	// Discord reports the command as failed unless answered within seconds
+	if err := s.InteractionRespond(i.Interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionResponseChannelMessageWithSource,
+		Data: response,
+	}); err != nil {
+		logger.WarnCF("discord", "Failed to answer slash command", map[string]interface{}{
+			"command": data.Name,
+			"error":   err.Error(),
+		})
+	}
+
+	c.HandleMessage(user.ID, i.ChannelID, content, nil, map[string]string{
+		"user_id":    user.ID,
+		"username":   user.Username,
+		"guild_id":   i.GuildID,
+		"channel_id": i.ChannelID,
+		"is_dm":      fmt.Sprintf("%t", i.GuildID == ""),
+		"is_command": "true",
+	})
+}
@@ -0,0 +1,46 @@
+package channels
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/sipeed/picoclaw/pkg/commands"
+)
+
+func TestDiscordCommands(t *testing.T) {
+	privacy := commands.Command{Name: "privacy", Usage: "[chat] cloud|local|off", Description: "Choose whether your voice notes are transcribed"}
+	mute := commands.Command{Name: "mute", Description: "Stop replying", Options: []commands.Option{
+		{Name: "note", Description: "Why"},
+		{Name: "duration", Description: "How long", Required: true},
+	}}
+	help := commands.Command{Name: "help"}
+
+	got := discordCommands(map[string]commands.Command{"privacy": privacy, "mute": mute, "help": help})
+	if len(got) != 3 || got[0].Name != "help" || got[1].Name != "mute" || got[2].Name != "privacy" {
+		t.Fatalf("commands = %+v, want sorted by name", got)
+	}
+	if got[0].Description != "/help" || len(got[0].Options) != 0 {
+		t.Errorf("help = %+v, want the name as description and no options", got[0])
+	}
+	if opts := got[1].Options; len(opts) != 2 || opts[0].Name != "duration" || !opts[0].Required {
+		t.Errorf("mute options = %+v, want the required one first", opts)
+	}
+	if opts := got[2].Options; len(opts) != 1 || opts[0].Name != "args" || opts[0].Description != privacy.Usage {
+		t.Errorf("privacy options = %+v, want one text field", opts)
+	}
+
+	data := discordgo.ApplicationCommandInteractionData{Name: "mute", Options: []*discordgo.ApplicationCommandInteractionDataOption{
+		{Name: "duration", Type: discordgo.ApplicationCommandOptionString, Value: "1h"},
+		{Name: "note", Type: discordgo.ApplicationCommandOptionString, Value: "meeting"},
+	}}
+	// Values join in the command's order, not Discord's
+	if text := slashCommandText(mute, data); text != "/mute meeting 1h" {
+		t.Errorf("slashCommandText() = %q", text)
+	}
+	data = discordgo.ApplicationCommandInteractionData{Name: "privacy", Options: []*discordgo.ApplicationCommandInteractionDataOption{
+		{Name: "args", Type: discordgo.ApplicationCommandOptionString, Value: " chat off "},
+	}}
+	if text := slashCommandText(privacy, data); text != "/privacy chat off" {
+		t.Errorf("slashCommandText() = %q", text)
+	}
+}
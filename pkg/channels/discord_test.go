@@ -0,0 +1,93 @@
+package channels
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// fakeDiscord answers the message calls of Discord's REST API. Edits of
+// a message listed in gone fail as if it had been deleted.
+type fakeDiscord struct {
+	mu    sync.Mutex
+	calls []string
+	next  int
+	gone  map[string]bool
+}
+
+func (f *fakeDiscord) RoundTrip(r *http.Request) (*http.Response, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, r.Method+" "+strings.TrimPrefix(r.URL.Path, "/api/v9"))
+	respond := func(code int, body string) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: code,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(body)),
+			Request:    r,
+		}, nil
+	}
+	id := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	switch {
+	case r.Method == http.MethodPost:
+		f.next++
+		return respond(http.StatusOK, fmt.Sprintf(`{"id": "m%d", "channel_id": "c1"}`, f.next))
+	case r.Method == http.MethodPatch && f.gone[id]:
+		return respond(http.StatusNotFound, `{"code": 10008, "message": "Unknown Message"}`)
+	case r.Method == http.MethodPatch:
+		return respond(http.StatusOK, fmt.Sprintf(`{"id": %q, "channel_id": "c1"}`, id))
+	}
+	return respond(http.StatusNotFound, `{}`)
+}
+
+func TestDiscordStreamEndsOnEditFailure(t *testing.T) {
+	ch, err := NewDiscordChannel(config.DiscordConfig{Token: "token"}, bus.NewMessageBus())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := &fakeDiscord{gone: map[string]bool{"m1": true}}
+	ch.session.Client = &http.Client{Transport: fake}
+	ch.setRunning(true)
+
+	ctx := context.Background()
+	send := func(content string, partial bool) error {
+		return ch.Send(ctx, bus.OutboundMessage{Channel: "discord", ChatID: "c1", Content: content, Partial: partial})
+	}
+	if err := send("Hel", true); err != nil {
+		t.Fatal(err)
+	}
+	// m1 was deleted, so the update fails and the next one starts over
+	if err := send("Hello", true); err == nil {
+		t.Error("editing a deleted message succeeded")
+	}
+	if err := send("Hello wor", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := send("Hello world", false); err != nil {
+		t.Fatal(err)
+	}
+	// The stream ended with the final reply
+	if err := send("Next", false); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"POST /channels/c1/messages",
+		"PATCH /channels/c1/messages/m1",
+		"POST /channels/c1/messages",
+		"PATCH /channels/c1/messages/m2",
+		"POST /channels/c1/messages",
+	}
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if strings.Join(fake.calls, "\n") != strings.Join(want, "\n") {
+		t.Errorf("calls = %q, want %q", fake.calls, want)
+	}
+}
@@ -0,0 +1,102 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package channels
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/crash"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+const (
+	// maxParallelDownloads bounds the attachments of one message fetched
+	// at once.
+	maxParallelDownloads = 3
+	// downloadDeadline is how long a message's attachments may take
+	// altogether. Whatever has not arrived by then is left out, and the
+	// message goes on with the rest.
+	downloadDeadline = 2 * time.Minute
+)
+
+// downloads collects the attachments of an incoming message so they are
+// fetched together rather than one after another:
+//
+//	var dl downloads
+//	var photo, doc string
+//	dl.add(&photo, func(ctx context.Context) string { ... })
+//	dl.add(&doc, func(ctx context.Context) string { ... })
+//	dl.run(ctx, "telegram")
+//
+// A fetch returns the local path of what it downloaded, or "" on failure.
+type downloads struct {
+	paths   []*string
+	fetches []func(ctx context.Context) string
+}
+
+// add queues fetch, whose result run stores in *path.
+func (d *downloads) add(path *string, fetch func(ctx context.Context) string) {
+	d.paths = append(d.paths, path)
+	d.fetches = append(d.fetches, fetch)
+}
+
+// run fetches everything added, at most maxParallelDownloads at once, and
+// returns when all are done or downloadDeadline (or ctx) runs out. Fetches
+// still going then get their context cancelled and leave their path
+// empty; files they write anyway are removed.
+func (d *downloads) run(ctx context.Context, channel string) {
+	if len(d.fetches) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, downloadDeadline)
+	defer cancel()
+
+	type result struct {
+		i    int
+		path string
+	}
+	// Buffered so fetches finishing after the deadline do not block
+	results := make(chan result, len(d.fetches))
+	slots := make(chan struct{}, maxParallelDownloads)
+	for i, fetch := range d.fetches {
+		go func() {
+			var path string
+			defer func() { results <- result{i, path} }()
+			defer crash.Recover(channel+".download", nil)
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-slots }()
+			path = fetch(ctx)
+		}()
+	}
+
+	for pending := len(d.fetches); pending > 0; pending-- {
+		select {
+		case r := <-results:
+			*d.paths[r.i] = r.path
+		case <-ctx.Done():
+			logger.WarnCF(channel, "Attachment downloads ran out of time", map[string]interface{}{
+				"pending": pending,
+				"total":   len(d.fetches),
+			})
+			// Nothing will use what arrives late
+			go func() {
+				for ; pending > 0; pending-- {
+					if r := <-results; r.path != "" {
+						os.Remove(r.path)
+					}
+				}
+			}()
+			return
+		}
+	}
+}
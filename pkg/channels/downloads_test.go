@@ -0,0 +1,85 @@
+package channels
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDownloadsRunsInParallel(t *testing.T) {
+	var running, most atomic.Int32
+	fetch := func(path string) func(context.Context) string {
+		return func(ctx context.Context) string {
+			n := running.Add(1)
+			defer running.Add(-1)
+			for {
+				m := most.Load()
+				if n <= m || most.CompareAndSwap(m, n) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+			return path
+		}
+	}
+
+	var dl downloads
+	paths := make([]string, 6)
+	for i := range paths {
+		dl.add(&paths[i], fetch(string(rune('a'+i))))
+	}
+	dl.run(context.Background(), "test")
+
+	if got := most.Load(); got != maxParallelDownloads {
+		t.Errorf("%d downloads at once, want %d", got, maxParallelDownloads)
+	}
+	for i, path := range paths {
+		if want := string(rune('a' + i)); path != want {
+			t.Errorf("paths[%d] = %q, want %q", i, path, want)
+		}
+	}
+}
+
+func TestDownloadsKeepsWhatArrives(t *testing.T) {
+	late := filepath.Join(t.TempDir(), "late.ogg")
+	stuck, wrote := make(chan struct{}), make(chan struct{})
+	var dl downloads
+	var photo, failed, voice, crashed string
+	dl.add(&photo, func(ctx context.Context) string { return "photo.jpg" })
+	dl.add(&failed, func(ctx context.Context) string { return "" })
+	dl.add(&crashed, func(ctx context.Context) string { panic("bad attachment") })
+	dl.add(&voice, func(ctx context.Context) string {
+		// Ignores ctx and finishes long after the deadline
+		<-stuck
+		os.WriteFile(late, []byte("ogg"), 0o600)
+		close(wrote)
+		return late
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	dl.run(ctx, "test")
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("run() waited %s for a stuck download", elapsed)
+	}
+	if photo != "photo.jpg" || failed != "" || crashed != "" || voice != "" {
+		t.Errorf("got photo %q, failed %q, crashed %q, voice %q", photo, failed, crashed, voice)
+	}
+
+	close(stuck)
+	<-wrote
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, err := os.Stat(late); os.IsNotExist(err) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("a download finishing after the deadline left its file behind")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,234 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/i18n"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+const (
+	// draftBucket holds replies waiting for approval by draft ID.
+	draftBucket = "drafts"
+	// draftChatsBucket holds the chats operators switched draft mode on or
+	// off for, overriding the configured rules, by "channel:chat_id".
+	draftChatsBucket = "draft_chats"
+	// draftMaxAge drops drafts no one reviewed.
+	draftMaxAge = 7 * 24 * time.Hour
+)
+
+// Draft is a reply held for approval.
+type Draft struct {
+	ID      string              `json:"id"`
+	Message bus.OutboundMessage `json:"message"`
+	Created time.Time           `json:"created"`
+}
+
+// DraftMode reports whether replies to the chat are held for approval:
+// as an operator set it for the chat, or else as the drafts.chats rules
+// say. The approval chat is never held.
+func (m *Manager) DraftMode(ctx context.Context, channel, chatID string) bool {
+	key := channel + ":" + chatID
+	if key == m.config.Drafts.ApprovalChat {
+		return false
+	}
+	if store := m.outboxStore(); store != nil {
+		if v, err := store.Get(ctx, draftChatsBucket, key); err == nil {
+			return string(v) == "on"
+		}
+	}
+	for _, rule := range m.config.Drafts.Chats {
+		if rule == key || rule == channel+":*" {
+			return true
+		}
+	}
+	return false
+}
+
+// SetDraftMode switches draft mode on or off for one chat, whatever the
+// configured rules say.
+func (m *Manager) SetDraftMode(ctx context.Context, channel, chatID string, on bool) error {
+	store := m.outboxStore()
+	if store == nil {
+		return fmt.Errorf("drafts need the state store")
+	}
+	v := "off"
+	if on {
+		v = "on"
+	}
+	return store.Put(ctx, draftChatsBucket, channel+":"+chatID, []byte(v))
+}
+
+// Drafts returns the replies waiting for approval, oldest first.
+func (m *Manager) Drafts(ctx context.Context) ([]Draft, error) {
+	store := m.outboxStore()
+	if store == nil {
+		return nil, nil
+	}
+	entries, err := store.List(ctx, draftBucket)
+	if err != nil {
+		return nil, err
+	}
+	drafts := make([]Draft, 0, len(entries))
+	for _, data := range entries {
+		var d Draft
+		if json.Unmarshal(data, &d) == nil {
+			drafts = append(drafts, d)
+		}
+	}
+	sort.Slice(drafts, func(i, j int) bool { return drafts[i].Created.Before(drafts[j].Created) })
+	return drafts, nil
+}
+
+// ApproveDraft sends a held reply, with content in place of its text when
+// not empty.
+func (m *Manager) ApproveDraft(ctx context.Context, id, content string) (Draft, error) {
+	d, err := m.takeDraft(ctx, id)
+	if err != nil {
+		return d, err
+	}
+	if content != "" {
+		d.Message.Content = content
+	}
+	channel, ok := m.GetChannel(d.Message.Channel)
+	if !ok {
+		return d, fmt.Errorf("channel %s is not enabled", d.Message.Channel)
+	}
+	logger.InfoCF("channels", "Sending approved draft", map[string]interface{}{
+		"id":      id,
+		"channel": d.Message.Channel,
+		"chat_id": d.Message.ChatID,
+		"edited":  content != "",
+	})
+	return d, m.deliverDurably(ctx, channel, d.Message)
+}
+
+// RejectDraft drops a held reply.
+func (m *Manager) RejectDraft(ctx context.Context, id string) (Draft, error) {
+	d, err := m.takeDraft(ctx, id)
+	if err == nil {
+		logger.InfoCF("channels", "Rejected draft", map[string]interface{}{
+			"id":      id,
+			"channel": d.Message.Channel,
+			"chat_id": d.Message.ChatID,
+		})
+	}
+	return d, err
+}
+
+func (m *Manager) takeDraft(ctx context.Context, id string) (Draft, error) {
+	store := m.outboxStore()
+	if store == nil {
+		return Draft{}, fmt.Errorf("no draft %s", id)
+	}
+	var d Draft
+	err := state.GetJSON(ctx, store, draftBucket, id, &d)
+	if errors.Is(err, state.ErrNotFound) {
+		return d, fmt.Errorf("no draft %s (it may have been handled already)", id)
+	}
+	if err != nil {
+		return d, err
+	}
+	if err := store.Delete(ctx, draftBucket, id); err != nil {
+		return d, err
+	}
+	return d, nil
+}
+
+// holdDraft keeps msg for approval if its chat is in draft mode, and sends
+// it to the approval chat for review. Streaming updates are dropped, since
+// only the final reply is reviewed; reactions and deletions go through.
+func (m *Manager) holdDraft(ctx context.Context, msg bus.OutboundMessage) bool {
+	store := m.outboxStore()
+	if store == nil || msg.Reaction != nil || msg.Delete != "" || !m.DraftMode(ctx, msg.Channel, msg.ChatID) {
+		return false
+	}
+	if msg.Partial {
+		return true
+	}
+
+	d := Draft{ID: newDeliveryID(), Message: msg, Created: time.Now()}
+	if err := state.PutJSON(ctx, store, draftBucket, d.ID, d); err != nil {
+		// Holding back a reply that cannot be reviewed beats sending it
+		logger.ErrorCF("channels", "Failed to save draft, dropping reply", map[string]interface{}{
+			"channel": msg.Channel,
+			"chat_id": msg.ChatID,
+			"error":   err.Error(),
+		})
+		return true
+	}
+	logger.InfoCF("channels", "Holding reply for approval", map[string]interface{}{
+		"id":      d.ID,
+		"channel": msg.Channel,
+		"chat_id": msg.ChatID,
+	})
+	m.requestReview(ctx, d)
+	return true
+}
+
+// requestReview sends a draft to the approval chat, if one is configured,
+// with buttons to approve or reject it.
+func (m *Manager) requestReview(ctx context.Context, d Draft) {
+	approvalChannel, approvalChat, ok := strings.Cut(m.config.Drafts.ApprovalChat, ":")
+	if !ok {
+		return
+	}
+	channel, exists := m.GetChannel(approvalChannel)
+	if !exists {
+		logger.WarnCF("channels", "Approval chat's channel is not enabled", map[string]interface{}{
+			"channel": approvalChannel,
+		})
+		return
+	}
+	target := d.Message.Channel + ":" + d.Message.ChatID
+	notice := bus.OutboundMessage{
+		Channel: approvalChannel,
+		ChatID:  approvalChat,
+		Content: i18n.T(approvalChannel, approvalChat, "draft.review", target, d.Message.Content, d.ID),
+		Media:   d.Message.Media,
+		Buttons: []bus.Button{
+			{Text: i18n.T(approvalChannel, approvalChat, "draft.approve"), Data: "/admin approve " + d.ID},
+			{Text: i18n.T(approvalChannel, approvalChat, "draft.reject"), Data: "/admin reject " + d.ID},
+		},
+	}
+	if err := m.deliverDurably(ctx, channel, notice); err != nil {
+		logger.WarnCF("channels", "Failed to send draft for review", map[string]interface{}{
+			"id":    d.ID,
+			"error": err.Error(),
+		})
+	}
+}
+
+// pruneDrafts drops drafts older than draftMaxAge.
+func (m *Manager) pruneDrafts(ctx context.Context) {
+	drafts, err := m.Drafts(ctx)
+	if err != nil {
+		logger.WarnCF("channels", "Failed to read drafts", map[string]interface{}{"error": err.Error()})
+		return
+	}
+	store := m.outboxStore()
+	for _, d := range drafts {
+		if time.Since(d.Created) > draftMaxAge {
+			logger.WarnCF("channels", "Dropping unreviewed draft", map[string]interface{}{
+				"id":      d.ID,
+				"channel": d.Message.Channel,
+				"chat_id": d.Message.ChatID,
+			})
+			store.Delete(ctx, draftBucket, d.ID)
+		}
+	}
+}
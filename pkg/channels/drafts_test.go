@@ -0,0 +1,82 @@
+package channels
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+func TestDrafts(t *testing.T) {
+	business := &flakyChannel{BaseChannel: NewBaseChannel("whatsapp", nil, nil, nil)}
+	review := &flakyChannel{BaseChannel: NewBaseChannel("telegram", nil, nil, nil)}
+	cfg := &config.Config{Drafts: config.DraftsConfig{Chats: []string{"whatsapp:*"}, ApprovalChat: "telegram:1"}}
+	m := &Manager{
+		channels: map[string]Channel{"whatsapp": business, "telegram": review},
+		config:   cfg,
+		chunker:  newStreamChunker(),
+		state:    state.NewMemoryStore(),
+	}
+	ctx := context.Background()
+
+	tests := []struct {
+		msg  bus.OutboundMessage
+		held bool
+	}{
+		{bus.OutboundMessage{Channel: "whatsapp", ChatID: "49", Content: "Hel", Partial: true}, true},
+		{bus.OutboundMessage{Channel: "whatsapp", ChatID: "49", Reaction: &bus.Reaction{MessageID: "1", Emoji: "👀"}}, false},
+		{bus.OutboundMessage{Channel: "telegram", ChatID: "1", Content: "status"}, false},
+		{bus.OutboundMessage{Channel: "telegram", ChatID: "2", Content: "hi"}, false},
+		{bus.OutboundMessage{Channel: "whatsapp", ChatID: "49", Content: "Hello, your order shipped."}, true},
+	}
+	for _, tt := range tests {
+		if got := m.holdDraft(ctx, tt.msg); got != tt.held {
+			t.Errorf("holdDraft(%+v) = %v, want %v", tt.msg, got, tt.held)
+		}
+	}
+
+	drafts, err := m.Drafts(ctx)
+	if err != nil || len(drafts) != 1 {
+		t.Fatalf("Drafts() = %+v, %v; want the final reply only", drafts, err)
+	}
+	id := drafts[0].ID
+	if len(review.sent) != 1 || !strings.Contains(review.sent[0], "Hello, your order shipped.") || !strings.Contains(review.sent[0], id) {
+		t.Fatalf("review chat got %q", review.sent)
+	}
+
+	if _, err := m.ApproveDraft(ctx, id, "Hello! Your order has shipped."); err != nil {
+		t.Fatalf("ApproveDraft() error = %v", err)
+	}
+	if len(business.sent) != 1 || business.sent[0] != "Hello! Your order has shipped." {
+		t.Errorf("business chat got %q", business.sent)
+	}
+	if _, err := m.ApproveDraft(ctx, id, ""); err == nil {
+		t.Error("approving twice should fail")
+	}
+
+	// An operator's switch beats the rules
+	if err := m.SetDraftMode(ctx, "whatsapp", "49", false); err != nil {
+		t.Fatalf("SetDraftMode() error = %v", err)
+	}
+	if err := m.SetDraftMode(ctx, "telegram", "2", true); err != nil {
+		t.Fatalf("SetDraftMode() error = %v", err)
+	}
+	if m.DraftMode(ctx, "whatsapp", "49") || !m.DraftMode(ctx, "whatsapp", "50") || !m.DraftMode(ctx, "telegram", "2") {
+		t.Error("draft mode ignores the operator's switches")
+	}
+
+	m.holdDraft(ctx, bus.OutboundMessage{Channel: "telegram", ChatID: "2", Content: "spam"})
+	drafts, _ = m.Drafts(ctx)
+	if len(drafts) != 1 {
+		t.Fatalf("Drafts() = %+v", drafts)
+	}
+	if _, err := m.RejectDraft(ctx, drafts[0].ID); err != nil {
+		t.Fatalf("RejectDraft() error = %v", err)
+	}
+	if drafts, _ := m.Drafts(ctx); len(drafts) != 0 {
+		t.Errorf("Drafts() after reject = %+v", drafts)
+	}
+}
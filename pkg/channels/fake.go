@@ -0,0 +1,181 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package channels
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/render"
+)
+
+// Fake is an in-memory channel for integration tests. Receive injects
+// messages from users as a real channel would, allowlist and dedup
+// included, and everything the channel is asked to send is captured for
+// Sent and Next. Register it with Manager.RegisterChannel:
+//
+//	fake := channels.NewFake("test", msgBus, nil)
+//	manager.RegisterChannel("test", fake)
+//	manager.StartAll(ctx)
+//	fake.Receive("alice", "42", "hello")
+//	reply, err := fake.Next(ctx)
+//
+// Sent messages get platform IDs "fake-1", "fake-2", and so on, for
+// delivery tracking.
+type Fake struct {
+	*BaseChannel
+
+	mu        sync.Mutex
+	running   bool
+	connected bool
+	caps      render.Capabilities
+	sent      []bus.OutboundMessage
+	next      int           // Index in sent of the message Next returns
+	added     chan struct{} // Closed and replaced when a message is captured
+	failures  int
+	failErr   error
+}
+
+// NewFake returns a fake channel called name that publishes to msgBus and
+// lets in the senders on allowFrom, or everyone when it is empty. It takes
+// Markdown, with no attachments, edits, or buttons, until SetCapabilities.
+func NewFake(name string, msgBus *bus.MessageBus, allowFrom []string) *Fake {
+	return &Fake{
+		BaseChannel: NewBaseChannel(name, nil, msgBus, allowFrom),
+		connected:   true,
+		caps:        render.Capabilities{Markup: render.Markdown},
+		added:       make(chan struct{}),
+	}
+}
+
+func (c *Fake) Start(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.running = true
+	return nil
+}
+
+func (c *Fake) Stop(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.running = false
+	return nil
+}
+
+func (c *Fake) IsRunning() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.running
+}
+
+// Connected implements ConnectionChannel.
+func (c *Fake) Connected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connected
+}
+
+// SetConnected simulates the connection dropping or coming back.
+func (c *Fake) SetConnected(connected bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.connected = connected
+}
+
+// Capabilities implements CapabilityChannel.
+func (c *Fake) Capabilities() render.Capabilities {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.caps
+}
+
+// SetCapabilities sets what the channel can deliver, which decides how the
+// manager renders and splits messages for it.
+func (c *Fake) SetCapabilities(caps render.Capabilities) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.caps = caps
+}
+
+// Receive injects a text message from senderID in chatID.
+func (c *Fake) Receive(senderID, chatID, content string) {
+	c.HandleMessage(senderID, chatID, content, nil, nil)
+}
+
+// FailNext makes the next n sends and reactions return err.
+func (c *Fake) FailNext(n int, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failures, c.failErr = n, err
+}
+
+func (c *Fake) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	id, err := c.capture(msg)
+	if err != nil {
+		return err
+	}
+	reportSent(ctx, id)
+	return nil
+}
+
+// React implements ReactionChannel. Reactions are captured as outbound
+// messages carrying them.
+func (c *Fake) React(ctx context.Context, chatID string, reaction bus.Reaction) error {
+	_, err := c.capture(bus.OutboundMessage{Channel: c.Name(), ChatID: chatID, Reaction: &reaction})
+	return err
+}
+
+// DeleteMessage implements DeleteChannel. Deletions are captured as
+// outbound messages carrying them.
+func (c *Fake) DeleteMessage(ctx context.Context, chatID, messageID string) error {
+	_, err := c.capture(bus.OutboundMessage{Channel: c.Name(), ChatID: chatID, Delete: messageID})
+	return err
+}
+
+func (c *Fake) capture(msg bus.OutboundMessage) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.failures > 0 {
+		c.failures--
+		return "", c.failErr
+	}
+	c.sent = append(c.sent, msg)
+	close(c.added)
+	c.added = make(chan struct{})
+	return fmt.Sprintf("fake-%d", len(c.sent)), nil
+}
+
+// Sent returns every message the channel has sent, in order.
+func (c *Fake) Sent() []bus.OutboundMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]bus.OutboundMessage(nil), c.sent...)
+}
+
+// Next returns the first sent message that Next has not returned yet,
+// waiting for it until ctx is done.
+func (c *Fake) Next(ctx context.Context) (bus.OutboundMessage, error) {
+	for {
+		c.mu.Lock()
+		if c.next < len(c.sent) {
+			msg := c.sent[c.next]
+			c.next++
+			c.mu.Unlock()
+			return msg, nil
+		}
+		added := c.added
+		c.mu.Unlock()
+
+		select {
+		case <-added:
+		case <-ctx.Done():
+			return bus.OutboundMessage{}, ctx.Err()
+		}
+	}
+}
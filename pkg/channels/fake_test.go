@@ -0,0 +1,86 @@
+package channels
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/render"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+func TestFake(t *testing.T) {
+	mb := bus.NewMessageBus()
+	m, err := NewManager(&config.Config{}, mb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.SetStateStore(state.NewMemoryStore())
+	fake := NewFake("test", mb, []string{"alice"})
+	m.RegisterChannel("test", fake)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := m.StartAll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer m.StopAll(context.Background())
+	if !fake.IsRunning() || m.ChannelStates()["test"] != "connected" {
+		t.Errorf("state after start = %q", m.ChannelStates()["test"])
+	}
+
+	// Inbound: the allowlist applies
+	fake.Receive("mallory", "42", "let me in")
+	fake.Receive("alice", "42", "hello")
+	in, ok := mb.ConsumeInbound(ctx)
+	if !ok || in.SenderID != "alice" || in.Content != "hello" || in.SessionKey != "test:42" {
+		t.Errorf("inbound = %+v", in)
+	}
+
+	// Outbound through the dispatcher is rendered for the fake's capabilities
+	mb.PublishOutbound(bus.OutboundMessage{Channel: "test", ChatID: "42", Content: "**hi**"})
+	out, err := fake.Next(ctx)
+	if err != nil || out.Content != "**hi**" {
+		t.Errorf("Next() = %+v, %v", out, err)
+	}
+	fake.SetCapabilities(render.Capabilities{Markup: render.Plain})
+	mb.PublishOutbound(bus.OutboundMessage{Channel: "test", ChatID: "42", Content: "**hi**"})
+	if out, _ := fake.Next(ctx); out.Content != "hi" {
+		t.Errorf("plain text = %q", out.Content)
+	}
+
+	// Failed sends are reported and tracked with the fake's message IDs
+	fake.FailNext(1, errors.New("offline"))
+	id, err := m.Send(ctx, bus.OutboundMessage{Channel: "test", ChatID: "42", Content: "first try"})
+	if err == nil || err.Error() != "offline" {
+		t.Errorf("Send() error = %v, want offline", err)
+	}
+	m.RetryOutbox(ctx)
+	if out, _ := fake.Next(ctx); out.Content != "first try" {
+		t.Errorf("retried = %q", out.Content)
+	}
+	if d, ok, _ := m.Delivery(ctx, id); !ok || d.Status != DeliverySent || len(d.MessageIDs) != 1 || d.MessageIDs[0] != "fake-3" {
+		t.Errorf("delivery = %+v", d)
+	}
+
+	mb.PublishOutbound(bus.OutboundMessage{Channel: "test", ChatID: "42", Reaction: &bus.Reaction{MessageID: "m1", Emoji: "👍"}})
+	if out, _ := fake.Next(ctx); out.Reaction == nil || out.Reaction.Emoji != "👍" {
+		t.Errorf("reaction = %+v", out)
+	}
+	if sent := fake.Sent(); len(sent) != 4 {
+		t.Errorf("Sent() has %d messages, want 4", len(sent))
+	}
+
+	fake.SetConnected(false)
+	if m.ChannelStates()["test"] != "reconnecting" {
+		t.Errorf("state when disconnected = %q", m.ChannelStates()["test"])
+	}
+
+	short, cancelShort := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancelShort()
+	if _, err := fake.Next(short); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Next() with nothing sent = %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+package channels
+
+import (
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/events"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// InboundFilter looks at a message arriving on a channel before it is
+// published: a message, a reaction, or a change to an earlier message. It
+// may change msg, for instance to redact its content, and returns false to
+// drop it. A filter that drops a message reports why itself; one that
+// takes attachments out of msg.Media removes their files.
+type InboundFilter func(msg *bus.InboundMessage) bool
+
+type namedFilter struct {
+	name   string
+	filter InboundFilter
+}
+
+// AddFilter appends filter to the ones inbound messages pass through, in
+// the order they were added. The blocklist and allowlist always come
+// first, so filters only see messages from allowed senders. It implements FilterChannel.
+func (c *BaseChannel) AddFilter(name string, filter InboundFilter) {
+	c.filtersMu.Lock()
+	defer c.filtersMu.Unlock()
+	c.filters = append(c.filters, namedFilter{name: name, filter: filter})
+}
+
+// Admits reports whether messages from senderID in chatID get past the
+// blocklist and the allowlist, reporting a security event when a sender
+// off the allowlist is turned away. Channels call it
+// before work that is wasted on a rejected sender, such as downloading
+// attachments; the message is still filtered in full when handed on.
+func (c *BaseChannel) Admits(senderID, chatID string) bool {
+	return c.admits(senderID, chatID, "message")
+}
+
+// admits is Admits naming what is dropped in the security event, e.g.
+// "reaction".
+func (c *BaseChannel) admits(senderID, chatID, kind string) bool {
+	if c.isBlocked(senderID) {
+		c.stats.dropped.Add(1)
+		logger.DebugCF(c.name, "Dropped "+kind+" from blocked sender",
+			map[string]interface{}{"sender_id": senderID, "chat_id": chatID})
+		events.Publish(events.Event{
+			Type:     events.TypeDropped,
+			Channel:  c.name,
+			ChatID:   chatID,
+			SenderID: senderID,
+			Message:  "blocked",
+			Fields:   map[string]interface{}{"kind": kind},
+		})
+		return false
+	}
+	if c.IsAllowed(senderID) {
+		return true
+	}
+	c.stats.dropped.Add(1)
+	events.Security(c.name, "Dropped "+kind+" from unauthorized sender",
+		map[string]interface{}{"sender_id": senderID, "chat_id": chatID})
+	return false
+}
+
+// filter passes msg through the blocklist, the allowlist, and then the
+// added filters, reporting whether it is to be published.
+func (c *BaseChannel) filter(msg *bus.InboundMessage) bool {
+	if !c.admits(msg.SenderID, msg.ChatID, inboundKind(msg)) {
+		return false
+	}
+	c.filtersMu.RLock()
+	filters := c.filters
+	c.filtersMu.RUnlock()
+	for _, f := range filters {
+		if !f.filter(msg) {
+			logger.DebugCF(c.name, "Inbound message dropped by filter", map[string]interface{}{
+				"filter":    f.name,
+				"sender_id": msg.SenderID,
+				"chat_id":   msg.ChatID,
+			})
+			c.stats.filtered.Add(1)
+			c.reportDrop(msg, "filter", map[string]interface{}{"filter": f.name})
+			return false
+		}
+	}
+	return true
+}
+
+// inboundKind names what msg carries, for log messages.
+func inboundKind(msg *bus.InboundMessage) string {
+	switch {
+	case msg.Reaction != nil:
+		return "reaction"
+	case msg.Change != nil:
+		return "message change"
+	}
+	return "message"
+}
+
+// AddInboundFilter adds filter to every channel, including ones
+// registered later, see BaseChannel.AddFilter.
+func (m *Manager) AddInboundFilter(name string, filter InboundFilter) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.filters = append(m.filters, namedFilter{name: name, filter: filter})
+	for _, channel := range m.channels {
+		if fc, ok := channel.(FilterChannel); ok {
+			fc.AddFilter(name, filter)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package channels
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestBaseChannelFilters(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	ch := NewBaseChannel("test", nil, msgBus, []string{"alice", "bob"})
+
+	var order []string
+	ch.AddFilter("redact", func(msg *bus.InboundMessage) bool {
+		order = append(order, "redact")
+		msg.Content = strings.ReplaceAll(msg.Content, "hunter2", "[redacted]")
+		return true
+	})
+	ch.AddFilter("mute-bob", func(msg *bus.InboundMessage) bool {
+		order = append(order, "mute-bob")
+		return msg.SenderID != "bob"
+	})
+
+	ch.HandleMessage("mallory", "1", "let me in", nil, nil)
+	if len(order) != 0 {
+		t.Fatalf("filters ran for a sender off the allowlist: %v", order)
+	}
+	ch.HandleMessage("bob", "1", "spam", nil, nil)
+	ch.HandleReaction("bob", "1", bus.Reaction{MessageID: "9", Emoji: "👍"}, nil)
+	ch.HandleMessage("alice", "1", "my password is hunter2", nil, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, ok := msgBus.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("no inbound message")
+	}
+	if msg.SenderID != "alice" || msg.Content != "my password is [redacted]" {
+		t.Errorf("published %q from %s", msg.Content, msg.SenderID)
+	}
+	if strings.Join(order, ",") != "redact,mute-bob,redact,mute-bob,redact,mute-bob" {
+		t.Errorf("filters ran in order %v", order)
+	}
+}
+
+func TestManagerAddInboundFilter(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	m, err := NewManager(config.DefaultConfig(), msgBus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.AddInboundFilter("drop-all", func(*bus.InboundMessage) bool { return false })
+
+	// Channels registered after the filter get it too
+	ch := &flakyChannel{BaseChannel: NewBaseChannel("sms", nil, msgBus, nil)}
+	m.RegisterChannel("sms", ch)
+	ch.HandleMessage("user", "1", "hello", nil, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if msg, ok := msgBus.ConsumeInbound(ctx); ok {
+		t.Errorf("filtered message published: %+v", msg)
+	}
+}
@@ -0,0 +1,314 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/crash"
+	"github.com/sipeed/picoclaw/pkg/i18n"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+// groupsBucket holds the groups the bot was added or invited to while
+// group approval is on, by "channel:chat_id".
+const groupsBucket = "groups"
+
+// Group approval states.
+const (
+	GroupPending  = "pending"
+	GroupAccepted = "accepted"
+	GroupDeclined = "declined"
+)
+
+// GroupRequest is a group the bot was added or invited to, and what an
+// operator made of it.
+type GroupRequest struct {
+	Channel string    `json:"channel"`
+	ChatID  string    `json:"chat_id"`
+	Name    string    `json:"name,omitempty"`
+	By      string    `json:"by,omitempty"`     // Sender ID of who added or invited the bot
+	Invite  string    `json:"invite,omitempty"` // Set while an invitation is not accepted
+	Status  string    `json:"status"`
+	Created time.Time `json:"created"`
+}
+
+// Key is the request's "channel:chat_id".
+func (r GroupRequest) Key() string {
+	return r.Channel + ":" + r.ChatID
+}
+
+// awaitingApproval reports whether chatID is a group an operator has not
+// accepted, whose messages are dropped. Chats without a request, such as
+// direct chats and groups from before approval was switched on, are not.
+func (c *BaseChannel) awaitingApproval(chatID string) bool {
+	if c.state == nil {
+		return false
+	}
+	group, _, _ := strings.Cut(chatID, "/")
+	var r GroupRequest
+	err := state.GetJSON(context.Background(), c.state, groupsBucket, c.name+":"+group, &r)
+	if err != nil {
+		if !errors.Is(err, state.ErrNotFound) {
+			logger.WarnCF("channels", "Failed to check group approval",
+				map[string]interface{}{"channel": c.name, "error": err.Error()})
+		}
+		return false
+	}
+	if r.Status == GroupAccepted {
+		return false
+	}
+	logger.DebugCF("channels", "Dropping message from group awaiting approval",
+		map[string]interface{}{"channel": c.name, "chat_id": chatID, "status": r.Status})
+	return true
+}
+
+// handleGroupEvent holds groups the bot is added or invited to for
+// approval, and forgets groups it leaves. The request is saved before
+// returning, so the group's first messages are already held; the review
+// and joining run in the background.
+func (m *Manager) handleGroupEvent(e bus.ChatEvent) {
+	switch e.Type {
+	case bus.ChatBotAdded, bus.ChatInvited:
+		if e.Direct || !m.config.Groups.RequireApproval {
+			return
+		}
+	case bus.ChatBotRemoved:
+		if store := m.outboxStore(); store != nil {
+			store.Delete(context.Background(), groupsBucket, e.Channel+":"+e.ChatID)
+		}
+		return
+	default:
+		return
+	}
+
+	store := m.outboxStore()
+	if store == nil {
+		logger.WarnCF("channels", "Group approval needs the state store, letting group in",
+			map[string]interface{}{"channel": e.Channel, "chat_id": e.ChatID})
+		return
+	}
+	ctx := context.Background()
+	r := GroupRequest{
+		Channel: e.Channel,
+		ChatID:  e.ChatID,
+		Name:    e.Name,
+		By:      e.ActorID,
+		Invite:  e.Invite,
+		Status:  GroupPending,
+		Created: time.Now(),
+	}
+	var known GroupRequest
+	if err := state.GetJSON(ctx, store, groupsBucket, r.Key(), &known); err == nil {
+		// Joining an accepted invitation reports the bot added; asking
+		// again about a group already asked about would only nag
+		return
+	}
+	if m.autoAccepted(e) {
+		r.Status, r.Invite = GroupAccepted, ""
+	}
+	if err := state.PutJSON(ctx, store, groupsBucket, r.Key(), r); err != nil {
+		logger.ErrorCF("channels", "Failed to save group request", map[string]interface{}{
+			"channel": e.Channel,
+			"chat_id": e.ChatID,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	go func() {
+		defer crash.Recover("channels.groups", nil)
+		if r.Status == GroupPending {
+			logger.InfoCF("channels", "Holding group for approval", map[string]interface{}{
+				"channel": r.Channel,
+				"chat_id": r.ChatID,
+				"by":      r.By,
+			})
+			m.requestGroupReview(ctx, r)
+			return
+		}
+		logger.InfoCF("channels", "Accepted group automatically", map[string]interface{}{
+			"channel": r.Channel,
+			"chat_id": r.ChatID,
+			"by":      r.By,
+		})
+		if e.Invite != "" {
+			if err := m.joinGroup(ctx, r.Channel, r.ChatID, e.Invite); err != nil {
+				logger.WarnCF("channels", "Failed to join group", map[string]interface{}{
+					"channel": r.Channel,
+					"chat_id": r.ChatID,
+					"error":   err.Error(),
+				})
+			}
+		}
+	}()
+}
+
+// autoAccepted reports whether groups.auto_accept lets e's group in
+// without review, by the group or by who brought the bot in.
+func (m *Manager) autoAccepted(e bus.ChatEvent) bool {
+	for _, rule := range m.config.Groups.AutoAccept {
+		if rule == e.Channel+":*" || rule == e.Channel+":"+e.ChatID {
+			return true
+		}
+		if e.ActorID == "" {
+			continue
+		}
+		for _, id := range append([]string{e.ActorID}, strings.Split(e.ActorID, "|")...) {
+			if id != "" && rule == e.Channel+":"+id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// requestGroupReview sends a group request to the approval chat, if one is
+// configured, with buttons to accept or decline it.
+func (m *Manager) requestGroupReview(ctx context.Context, r GroupRequest) {
+	approvalChannel, approvalChat, ok := strings.Cut(m.config.Groups.ApprovalChat, ":")
+	if !ok {
+		return
+	}
+	channel, exists := m.GetChannel(approvalChannel)
+	if !exists {
+		logger.WarnCF("channels", "Approval chat's channel is not enabled", map[string]interface{}{
+			"channel": approvalChannel,
+		})
+		return
+	}
+	group := r.Key()
+	if r.Name != "" {
+		group = r.Name + " (" + group + ")"
+	}
+	by := r.By
+	if by == "" {
+		by = "-"
+	}
+	notice := bus.OutboundMessage{
+		Channel: approvalChannel,
+		ChatID:  approvalChat,
+		Content: i18n.T(approvalChannel, approvalChat, "group.review", group, by, r.Key()),
+		Buttons: []bus.Button{
+			{Text: i18n.T(approvalChannel, approvalChat, "group.accept"), Data: "/admin accept " + r.Key()},
+			{Text: i18n.T(approvalChannel, approvalChat, "group.decline"), Data: "/admin decline " + r.Key()},
+		},
+	}
+	if err := m.deliverDurably(ctx, channel, notice); err != nil {
+		logger.WarnCF("channels", "Failed to send group for review", map[string]interface{}{
+			"group": r.Key(),
+			"error": err.Error(),
+		})
+	}
+}
+
+// GroupRequests returns the groups that are not accepted, oldest first.
+func (m *Manager) GroupRequests(ctx context.Context) ([]GroupRequest, error) {
+	store := m.outboxStore()
+	if store == nil {
+		return nil, nil
+	}
+	entries, err := store.List(ctx, groupsBucket)
+	if err != nil {
+		return nil, err
+	}
+	var requests []GroupRequest
+	for _, data := range entries {
+		var r GroupRequest
+		if json.Unmarshal(data, &r) == nil && r.Status != GroupAccepted {
+			requests = append(requests, r)
+		}
+	}
+	sort.Slice(requests, func(i, j int) bool { return requests[i].Created.Before(requests[j].Created) })
+	return requests, nil
+}
+
+// AcceptGroup lets the bot take part in a group ("channel:chat_id"),
+// joining it first if the bot was invited.
+func (m *Manager) AcceptGroup(ctx context.Context, key string) (GroupRequest, error) {
+	r, store, err := m.groupRequest(ctx, key)
+	if err != nil {
+		return r, err
+	}
+	if r.Invite != "" {
+		if err := m.joinGroup(ctx, r.Channel, r.ChatID, r.Invite); err != nil {
+			return r, err
+		}
+		r.Invite = ""
+	}
+	r.Status = GroupAccepted
+	logger.InfoCF("channels", "Accepted group", map[string]interface{}{
+		"channel": r.Channel,
+		"chat_id": r.ChatID,
+	})
+	return r, state.PutJSON(ctx, store, groupsBucket, key, r)
+}
+
+// DeclineGroup keeps ignoring a group ("channel:chat_id") and has the bot
+// leave it, where the channel can. An invitation is simply not taken up.
+func (m *Manager) DeclineGroup(ctx context.Context, key string) (GroupRequest, error) {
+	r, store, err := m.groupRequest(ctx, key)
+	if err != nil {
+		return r, err
+	}
+	invited := r.Invite != ""
+	r.Status = GroupDeclined
+	r.Invite = ""
+	if err := state.PutJSON(ctx, store, groupsBucket, key, r); err != nil {
+		return r, err
+	}
+	logger.InfoCF("channels", "Declined group", map[string]interface{}{
+		"channel": r.Channel,
+		"chat_id": r.ChatID,
+	})
+	if invited {
+		return r, nil
+	}
+	channel, ok := m.GetChannel(r.Channel)
+	if !ok {
+		return r, nil
+	}
+	if gc, ok := channel.(GroupChannel); ok {
+		if err := gc.LeaveGroup(ctx, r.ChatID); err != nil {
+			return r, fmt.Errorf("declined, but leaving failed: %w", err)
+		}
+	}
+	return r, nil
+}
+
+func (m *Manager) groupRequest(ctx context.Context, key string) (GroupRequest, state.Store, error) {
+	var r GroupRequest
+	store := m.outboxStore()
+	if store == nil {
+		return r, nil, fmt.Errorf("no group %s", key)
+	}
+	err := state.GetJSON(ctx, store, groupsBucket, key, &r)
+	if errors.Is(err, state.ErrNotFound) {
+		return r, nil, fmt.Errorf("no group %s waiting for approval", key)
+	}
+	return r, store, err
+}
+
+func (m *Manager) joinGroup(ctx context.Context, channelName, chatID, invite string) error {
+	channel, ok := m.GetChannel(channelName)
+	if !ok {
+		return fmt.Errorf("channel %s is not enabled", channelName)
+	}
+	gc, ok := channel.(GroupChannel)
+	if !ok {
+		return fmt.Errorf("channel %s cannot join groups", channelName)
+	}
+	return gc.JoinGroup(ctx, chatID, invite)
+}
@@ -0,0 +1,144 @@
+package channels
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+// groupFake is a fake channel that can join and leave groups.
+type groupFake struct {
+	*Fake
+	mu     sync.Mutex
+	joined []string
+	left   []string
+}
+
+func (c *groupFake) JoinGroup(ctx context.Context, chatID, invite string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.joined = append(c.joined, chatID+" "+invite)
+	return nil
+}
+
+func (c *groupFake) LeaveGroup(ctx context.Context, chatID string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.left = append(c.left, chatID)
+	return nil
+}
+
+func (c *groupFake) joins() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.joined...)
+}
+
+func TestGroupApproval(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	cfg := &config.Config{Groups: config.GroupsConfig{
+		RequireApproval: true,
+		AutoAccept:      []string{"whatsapp:trusted@s.whatsapp.net"},
+		ApprovalChat:    "telegram:1",
+	}}
+	m, err := NewManager(cfg, msgBus)
+	if err != nil {
+		t.Fatalf("NewManager() error = %v", err)
+	}
+	m.SetStateStore(state.NewMemoryStore())
+	wa := &groupFake{Fake: NewFake("whatsapp", msgBus, nil)}
+	review := NewFake("telegram", msgBus, nil)
+	m.RegisterChannel("whatsapp", wa)
+	m.RegisterChannel("telegram", review)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// received reports whether a message in chatID reached the bus.
+	received := func(chatID string) bool {
+		wa.HandleMessage("member@s.whatsapp.net", chatID, "hello", nil, nil)
+		waitCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		msg, ok := msgBus.ConsumeInbound(waitCtx)
+		return ok && msg.ChatID == chatID
+	}
+
+	if !received("old@g.us") {
+		t.Error("a group from before approval was held")
+	}
+
+	wa.HandleInvite("friend@s.whatsapp.net", "club@g.us", "Book club", "friend@s.whatsapp.net|code|0")
+	notice, err := review.Next(ctx)
+	if err != nil {
+		t.Fatalf("no review sent: %v", err)
+	}
+	if !strings.Contains(notice.Content, "Book club (whatsapp:club@g.us)") ||
+		!strings.Contains(notice.Content, "/admin accept whatsapp:club@g.us") {
+		t.Errorf("review = %+v", notice)
+	}
+	if received("club@g.us") {
+		t.Error("a group awaiting approval got through")
+	}
+
+	requests, err := m.GroupRequests(ctx)
+	if err != nil || len(requests) != 1 || requests[0].By != "friend@s.whatsapp.net" {
+		t.Fatalf("GroupRequests() = %+v, %v", requests, err)
+	}
+	if _, err := m.AcceptGroup(ctx, "whatsapp:club@g.us"); err != nil {
+		t.Fatalf("AcceptGroup() error = %v", err)
+	}
+	if got := wa.joins(); len(got) != 1 || got[0] != "club@g.us friend@s.whatsapp.net|code|0" {
+		t.Errorf("joined = %q", got)
+	}
+	// Joining reports the bot added, which must not ask again
+	wa.HandleChatEvent("club@g.us", bus.ChatBotAdded, nil, "")
+	if !received("club@g.us/thread") {
+		t.Error("an accepted group was held")
+	}
+	if requests, _ := m.GroupRequests(ctx); len(requests) != 0 {
+		t.Errorf("GroupRequests() after accept = %+v", requests)
+	}
+
+	// Declining leaves the group and keeps ignoring it
+	wa.HandleChatEvent("spam@g.us", bus.ChatBotAdded, nil, "stranger@s.whatsapp.net")
+	if _, err := review.Next(ctx); err != nil {
+		t.Fatalf("no review sent: %v", err)
+	}
+	if _, err := m.DeclineGroup(ctx, "whatsapp:spam@g.us"); err != nil {
+		t.Fatalf("DeclineGroup() error = %v", err)
+	}
+	if len(wa.left) != 1 || wa.left[0] != "spam@g.us" {
+		t.Errorf("left = %q", wa.left)
+	}
+	if received("spam@g.us") {
+		t.Error("a declined group got through")
+	}
+	// Once the bot is out, being added back asks again
+	wa.HandleChatEvent("spam@g.us", bus.ChatBotRemoved, nil, "")
+	if requests, _ := m.GroupRequests(ctx); len(requests) != 0 {
+		t.Errorf("GroupRequests() after leaving = %+v", requests)
+	}
+
+	// Trusted users bring the bot in without review
+	wa.HandleInvite("trusted@s.whatsapp.net", "work@g.us", "", "trusted@s.whatsapp.net|c2|0")
+	if !received("work@g.us") {
+		t.Error("an auto-accepted group was held")
+	}
+	for deadline := time.Now().Add(time.Second); len(wa.joins()) < 2 && time.Now().Before(deadline); {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := wa.joins(); len(got) != 2 || !strings.HasPrefix(got[1], "work@g.us ") {
+		t.Errorf("joined = %q, want the auto-accepted invite", got)
+	}
+
+	// Users unblocking the bot on Telegram are not groups
+	review.PublishChatEvent(bus.ChatEvent{ChatID: "42", Type: bus.ChatBotAdded, Direct: true})
+	if _, err := m.AcceptGroup(ctx, "telegram:42"); err == nil {
+		t.Error("a direct chat was held for approval")
+	}
+}
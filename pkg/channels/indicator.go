@@ -0,0 +1,88 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package channels
+
+import (
+	"context"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/crash"
+)
+
+// indicator is one chat's running "working on it" indicator. Starting and
+// stopping it talk to the platform, so both run off the agent's goroutine;
+// finish may come before start has returned the stop func.
+type indicator struct {
+	mu   sync.Mutex
+	stop func()
+	done bool
+}
+
+func (i *indicator) started(stop func()) {
+	i.mu.Lock()
+	if !i.done {
+		i.stop = stop
+		i.mu.Unlock()
+		return
+	}
+	i.mu.Unlock()
+	stop()
+}
+
+func (i *indicator) finish() {
+	i.mu.Lock()
+	i.done = true
+	stop := i.stop
+	i.stop = nil
+	i.mu.Unlock()
+	if stop != nil {
+		stop()
+	}
+}
+
+// handleProcessing starts and stops channels' indicators as the agent
+// picks up and finishes messages, see bus.StartProcessing.
+func (m *Manager) handleProcessing(p bus.Processing) {
+	key := p.Channel + ":" + p.ChatID
+
+	m.mu.Lock()
+	if !p.Active {
+		ind := m.indicators[key]
+		delete(m.indicators, key)
+		m.mu.Unlock()
+		if ind != nil {
+			go func() {
+				defer crash.Recover("channels."+p.Channel, nil)
+				ind.finish()
+			}()
+		}
+		return
+	}
+
+	channel, ok := m.channels[p.Channel]
+	ic, canIndicate := channel.(IndicatorChannel)
+	if !ok || !canIndicate || !channel.IsRunning() {
+		m.mu.Unlock()
+		return
+	}
+	if m.indicators == nil {
+		m.indicators = make(map[string]*indicator)
+	}
+	ind := &indicator{}
+	m.indicators[key] = ind
+	ctx := m.runCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	m.mu.Unlock()
+
+	go func() {
+		defer crash.Recover("channels."+p.Channel, nil)
+		ind.started(ic.StartIndicator(ctx, p.ChatID, p.MessageID))
+	}()
+}
@@ -0,0 +1,65 @@
+package channels
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// indicatorChannel records its indicator being started and stopped.
+type indicatorChannel struct {
+	*BaseChannel
+	mu     sync.Mutex
+	events []string
+}
+
+func (c *indicatorChannel) Start(ctx context.Context) error                         { return nil }
+func (c *indicatorChannel) Stop(ctx context.Context) error                          { return nil }
+func (c *indicatorChannel) Send(ctx context.Context, msg bus.OutboundMessage) error { return nil }
+
+func (c *indicatorChannel) StartIndicator(ctx context.Context, chatID, messageID string) func() {
+	c.record("start " + chatID + " " + messageID)
+	return func() { c.record("stop " + chatID) }
+}
+
+func (c *indicatorChannel) record(event string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.events = append(c.events, event)
+}
+
+func (c *indicatorChannel) recorded() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.events...)
+}
+
+func TestIndicatorFollowsProcessing(t *testing.T) {
+	mb := bus.NewMessageBus()
+	m, err := NewManager(&config.Config{}, mb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := &indicatorChannel{BaseChannel: NewBaseChannel("chat", nil, mb, nil)}
+	ch.setRunning(true)
+	m.RegisterChannel("chat", ch)
+
+	done := mb.StartProcessing(bus.InboundMessage{Channel: "chat", ChatID: "7", Metadata: map[string]string{"message_id": "42"}})
+	done()
+	// Messages for channels without an indicator are ignored
+	mb.StartProcessing(bus.InboundMessage{Channel: "cli", ChatID: "direct"})()
+
+	want := []string{"start 7 42", "stop 7"}
+	deadline := time.Now().Add(time.Second)
+	for len(ch.recorded()) < len(want) && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	got := ch.recorded()
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("events = %q, want %q", got, want)
+	}
+}
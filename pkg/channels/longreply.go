@@ -0,0 +1,99 @@
+package channels
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/i18n"
+	"github.com/sipeed/picoclaw/pkg/render"
+)
+
+const (
+	// defaultMaxParts is how many messages a reply may take before it is
+	// sent as a file instead, unless the channel's chunking policy says
+	// otherwise.
+	defaultMaxParts = 5
+	// replySummaryLength bounds the summary sent with a reply too long for
+	// messages, in characters.
+	replySummaryLength = 280
+)
+
+// fileReply reports whether msg goes out as a file instead of as text, on
+// channels that take attachments: when it is longer than the policy's
+// FileThreshold, or would take more than MaxParts messages. It returns the
+// text to send with the file.
+func fileReply(msg bus.OutboundMessage, caps render.Capabilities, policy render.Policy) (string, bool) {
+	if msg.Partial || !caps.Media || msg.Content == "" {
+		return "", false
+	}
+	if policy.FileThreshold > 0 && utf8.RuneCountInString(msg.Content) > policy.FileThreshold {
+		return i18n.T(msg.Channel, msg.ChatID, "reply.file"), true
+	}
+	if policy.MaxParts <= 0 || len(render.Messages(msg, caps, policy)) <= policy.MaxParts {
+		return "", false
+	}
+	note := i18n.T(msg.Channel, msg.ChatID, "reply.file_long", strings.Count(strings.TrimSpace(msg.Content), "\n")+1)
+	if summary := replySummary(msg.Content); summary != "" {
+		note = summary + "\n\n" + note
+	}
+	return note, true
+}
+
+// replySummary is the reply's first paragraph of prose, shortened to
+// replySummaryLength at a word, or "" when it opens with code.
+func replySummary(content string) string {
+	first, _, _ := strings.Cut(strings.TrimSpace(content), "\n\n")
+	if first == "" || strings.HasPrefix(first, "```") || strings.HasPrefix(first, "~~~") {
+		return ""
+	}
+	if i := strings.Index(first, "\n```"); i >= 0 {
+		first = strings.TrimSpace(first[:i])
+	}
+	if utf8.RuneCountInString(first) <= replySummaryLength {
+		return first
+	}
+	cut := string([]rune(first)[:replySummaryLength])
+	if i := strings.LastIndexAny(cut, " \n"); i > replySummaryLength/2 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " \n.,;:") + "…"
+}
+
+// writeReplyFile saves a reply in a new temporary directory, which the
+// caller removes once the reply is sent: as reply.txt with the fences
+// taken off when it is one code block, such as a log, and as reply.md
+// otherwise.
+func writeReplyFile(content string) (string, error) {
+	dir, err := os.MkdirTemp("", "picoclaw-reply-")
+	if err != nil {
+		return "", err
+	}
+	name := "reply.md"
+	if code, ok := codeOnly(content); ok {
+		name, content = "reply.txt", code
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return path, nil
+}
+
+// codeOnly returns the text inside content when all of it is a single
+// fenced code block.
+func codeOnly(content string) (string, bool) {
+	content = strings.TrimSpace(content)
+	open, rest, ok := strings.Cut(content, "\n")
+	if !ok || !strings.HasPrefix(open, "```") {
+		return "", false
+	}
+	body, ok := strings.CutSuffix(rest, "\n```")
+	if !ok || strings.HasPrefix(body, "```") || strings.Contains(body, "\n```") {
+		return "", false
+	}
+	return body + "\n", true
+}
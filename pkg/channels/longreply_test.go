@@ -0,0 +1,44 @@
+package channels
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReplySummary(t *testing.T) {
+	long := strings.Repeat("word ", 100)
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"Here is the log.\n\n```\nerror\n```", "Here is the log."},
+		{"Here is the log:\n```\nerror\n```", "Here is the log:"},
+		{"```\nerror\n```\n\nThat was it.", ""},
+		{long, strings.TrimSpace(strings.Repeat("word ", 56)) + "…"},
+	}
+	for _, tt := range tests {
+		if got := replySummary(tt.content); got != tt.want {
+			t.Errorf("replySummary(%.20q) = %q, want %q", tt.content, got, tt.want)
+		}
+	}
+}
+
+func TestCodeOnly(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+		ok      bool
+	}{
+		{"```log\na\nb\n```", "a\nb\n", true},
+		{"\n```\na\n```\n", "a\n", true},
+		{"```\na\n```\n\ntext", "", false},
+		{"```\na\n```\n```\nb\n```", "", false},
+		{"text\n```\na\n```", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := codeOnly(tt.content)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("codeOnly(%q) = %q, %v, want %q, %v", tt.content, got, ok, tt.want, tt.ok)
+		}
+	}
+}
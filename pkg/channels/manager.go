@@ -4,17 +4,33 @@
 //
 // Copyright (c) 2026 PicoClaw contributors
 
+// Package channels connects the chat platforms to the message bus. Manager
+// creates the channels enabled in the config and runs them, and delivers
+// the bus's outbound messages through them. Programs embedding picoclaw
+// usually start with the root picoclaw package, which sets one up.
 package channels
 
 import (
 	"context"
 	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/commands"
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/contacts"
+	"github.com/sipeed/picoclaw/pkg/crash"
+	"github.com/sipeed/picoclaw/pkg/leader"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/media"
+	"github.com/sipeed/picoclaw/pkg/render"
+	"github.com/sipeed/picoclaw/pkg/state"
 )
 
 type Manager struct {
@@ -22,11 +38,34 @@ type Manager struct {
 	bus          *bus.MessageBus
 	config       *config.Config
 	dispatchTask *asyncTask
+	outboxTask   *asyncTask
+	electTask    *asyncTask
+	superTask    *asyncTask      // nil unless the supervisor is enabled
+	digestTask   *asyncTask      // nil unless digests are enabled
+	elector      *leader.Elector // nil unless SetElector
+	chunker      *streamChunker
+	senders      chatSenders           // Per-chat send goroutines, see dispatchOutbound
+	runCtx       context.Context       // Context channels were started with
+	state        state.Store           // nil until SetStateStore
+	media        *media.Store          // nil unless SetMediaStore
+	indicators   map[string]*indicator // "channel:chat_id" -> running indicator
+	presence     presenceWatches
+	filters      []namedFilter // Added to every channel, see AddInboundFilter
 	mu           sync.RWMutex
+	deliveryMu   sync.Mutex // Serializes delivery status updates
+	outboxMu     sync.Mutex // Serializes settling outbox entries, see collapseOutbox
+	retryMu      sync.Mutex // Serializes outbox retry passes, see retryOutbox
+	breakersMu   sync.Mutex
+	breakers     map[string]*breaker // Created on first send, see breakerFor
+	rateMu       sync.Mutex
+	rates        map[string]*senderRate // "channel:sender_id", see rateLimit
+	statesMu     sync.Mutex
+	lastStates   map[string]string // Last published channel states, see watchStates
 }
 
 type asyncTask struct {
 	cancel context.CancelFunc
+	done   chan struct{}
 }
 
 func NewManager(cfg *config.Config, messageBus *bus.MessageBus) (*Manager, error) {
@@ -34,11 +73,20 @@ func NewManager(cfg *config.Config, messageBus *bus.MessageBus) (*Manager, error
 		channels: make(map[string]Channel),
 		bus:      messageBus,
 		config:   cfg,
+		chunker:  newStreamChunker(),
 	}
+	messageBus.OnProcessing(m.handleProcessing)
+	messageBus.OnReceipt(m.handleReceipt)
+	messageBus.OnPresence(m.handlePresence)
+	messageBus.OnChatEvent(m.handleGroupEvent)
+	messageBus.OnChannelStatus(m.handleChannelStatus)
 
 	if err := m.initChannels(); err != nil {
 		return nil, err
 	}
+	if cfg.Blocklist.RateLimit > 0 {
+		m.AddInboundFilter("rate_limit", m.rateLimit)
+	}
 
 	return m, nil
 }
@@ -98,6 +146,57 @@ func (m *Manager) initChannels() error {
 		}
 	}
 
+	if m.config.Channels.Zulip.Enabled && m.config.Channels.Zulip.APIKey != "" {
+		logger.DebugC("channels", "Attempting to initialize Zulip channel")
+		zulip, err := NewZulipChannel(m.config.Channels.Zulip, m.bus)
+		if err != nil {
+			logger.ErrorCF("channels", "Failed to initialize Zulip channel", map[string]interface{}{
+				"error": err.Error(),
+			})
+		} else {
+			m.channels["zulip"] = zulip
+			logger.InfoC("channels", "Zulip channel enabled successfully")
+		}
+	}
+
+	if m.config.Channels.Signal.Enabled && m.config.Channels.Signal.URL != "" {
+		logger.DebugC("channels", "Attempting to initialize Signal channel")
+		signal, err := NewSignalChannel(m.config.Channels.Signal, m.bus)
+		if err != nil {
+			logger.ErrorCF("channels", "Failed to initialize Signal channel", map[string]interface{}{
+				"error": err.Error(),
+			})
+		} else {
+			m.channels["signal"] = signal
+			logger.InfoC("channels", "Signal channel enabled successfully")
+		}
+	}
+
+	if m.config.Channels.Twilio.Enabled && m.config.Channels.Twilio.AuthToken != "" {
+		logger.DebugC("channels", "Attempting to initialize Twilio channel")
+		twilio, err := NewTwilioChannel(m.config.Channels.Twilio, m.bus)
+		if err != nil {
+			logger.ErrorCF("channels", "Failed to initialize Twilio channel", map[string]interface{}{
+				"error": err.Error(),
+			})
+		} else {
+			m.channels["twilio"] = twilio
+			logger.InfoC("channels", "Twilio channel enabled successfully")
+		}
+	}
+
+	if m.config.Channels.MQTT.Enabled && m.config.Channels.MQTT.Broker != "" {
+		logger.DebugC("channels", "Attempting to initialize MQTT channel")
+		mqtt, err := NewMQTTChannel(m.config.Channels.MQTT, m.bus)
+		if err != nil {
+			logger.ErrorCF("channels", "Failed to initialize MQTT channel", map[string]interface{}{
+				"error": err.Error(),
+			})
+		} else {
+			m.channels["mqtt"] = mqtt
+			logger.InfoC("channels", "MQTT channel enabled successfully")
+		}
+	}
 
 	logger.InfoCF("channels", "Channel initialization completed", map[string]interface{}{
 		"enabled_channels": len(m.channels),
@@ -116,49 +215,202 @@ func (m *Manager) StartAll(ctx context.Context) error {
 	}
 
 	logger.InfoC("channels", "Starting all channels")
+	m.runCtx = ctx
+	started := time.Now()
 
 	dispatchCtx, cancel := context.WithCancel(ctx)
-	m.dispatchTask = &asyncTask{cancel: cancel}
+	task := &asyncTask{cancel: cancel, done: make(chan struct{})}
+	m.dispatchTask = task
+
+	go func() {
+		defer close(task.done)
+		crash.Supervise(dispatchCtx, "channels.dispatch", m.dispatchOutbound)
+		m.senders.wait()
+	}()
+
+	if m.elector != nil {
+		m.electTask = m.startElections(ctx)
+	} else {
+		for name, channel := range m.channels {
+			startChannel(ctx, name, channel)
+		}
+	}
 
-	go m.dispatchOutbound(dispatchCtx)
+	// Replay messages an earlier run did not get out, once channels are up
+	outboxCtx, cancelOutbox := context.WithCancel(ctx)
+	outbox := &asyncTask{cancel: cancelOutbox, done: make(chan struct{})}
+	m.outboxTask = outbox
+	go func() {
+		defer close(outbox.done)
+		crash.Supervise(outboxCtx, "channels.outbox", func(ctx context.Context) {
+			m.runOutbox(ctx, started)
+		})
+	}()
+	go func() {
+		defer crash.Recover("channels.states", nil)
+		m.watchStates(outboxCtx)
+	}()
+
+	if cfg := m.config.Gateway.Supervisor; cfg.Enabled {
+		superCtx, cancelSuper := context.WithCancel(ctx)
+		super := &asyncTask{cancel: cancelSuper, done: make(chan struct{})}
+		m.superTask = super
+		go func() {
+			defer close(super.done)
+			crash.Supervise(superCtx, "channels.supervisor", newSupervisor(m, cfg).run)
+		}()
+	}
 
-	for name, channel := range m.channels {
-		logger.InfoCF("channels", "Starting channel", map[string]interface{}{
+	if m.config.Digest.Enabled {
+		digestCtx, cancelDigest := context.WithCancel(ctx)
+		digest := &asyncTask{cancel: cancelDigest, done: make(chan struct{})}
+		m.digestTask = digest
+		go func() {
+			defer close(digest.done)
+			crash.Supervise(digestCtx, "channels.digest", m.runDigests)
+		}()
+	}
+
+	// Watches are kept by the channels across reconnects, so whether the
+	// channel is up yet does not matter
+	go func() {
+		defer crash.Recover("channels.presence", nil)
+		m.restorePresence(ctx)
+	}()
+
+	logger.InfoC("channels", "All channels started")
+	return nil
+}
+
+func startChannel(ctx context.Context, name string, channel Channel) {
+	logger.InfoCF("channels", "Starting channel", map[string]interface{}{
+		"channel": name,
+	})
+	if err := channel.Start(ctx); err != nil {
+		logger.ErrorCF("channels", "Failed to start channel", map[string]interface{}{
 			"channel": name,
+			"error":   err.Error(),
 		})
-		if err := channel.Start(ctx); err != nil {
-			logger.ErrorCF("channels", "Failed to start channel", map[string]interface{}{
-				"channel": name,
-				"error":   err.Error(),
-			})
+	}
+}
+
+func stopChannel(ctx context.Context, name string, channel Channel) {
+	logger.InfoCF("channels", "Stopping channel", map[string]interface{}{
+		"channel": name,
+	})
+	if err := channel.Stop(ctx); err != nil {
+		logger.ErrorCF("channels", "Error stopping channel", map[string]interface{}{
+			"channel": name,
+			"error":   err.Error(),
+		})
+	}
+}
+
+// SetMediaStore shares attachments a channel cannot take as links from
+// store, see fitAttachments, and hands it to channels that send all their
+// attachments as links.
+func (m *Manager) SetMediaStore(store *media.Store) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.media = store
+	for _, channel := range m.channels {
+		if mc, ok := channel.(MediaStoreChannel); ok {
+			mc.SetMediaStore(store)
 		}
 	}
+}
 
-	logger.InfoC("channels", "All channels started")
-	return nil
+// SetElector makes channels run only on the instance elected to hold them;
+// other instances keep them on standby. Call before StartAll.
+func (m *Manager) SetElector(elector *leader.Elector) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.elector = elector
+}
+
+// startElections campaigns for every channel, starting each one while this
+// instance holds it. Callers hold m.mu.
+func (m *Manager) startElections(ctx context.Context) *asyncTask {
+	electCtx, cancel := context.WithCancel(ctx)
+	task := &asyncTask{cancel: cancel, done: make(chan struct{})}
+
+	var wg sync.WaitGroup
+	for name, channel := range m.channels {
+		name, channel := name, channel
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.elector.Run(electCtx, channelRole(name),
+				func() { startChannel(ctx, name, channel) },
+				func() {
+					stopCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+					defer cancel()
+					stopChannel(stopCtx, name, channel)
+				})
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(task.done)
+	}()
+	return task
+}
+
+func channelRole(name string) string {
+	return "channel:" + name
+}
+
+// holds reports whether this instance runs the named channel: always,
+// unless leader election handed it to another instance.
+func (m *Manager) holds(name string) bool {
+	m.mu.RLock()
+	elector := m.elector
+	m.mu.RUnlock()
+	return elector == nil || elector.Holds(channelRole(name))
 }
 
+// StopAll stops the outbound dispatcher and outbox retries, flushes any
+// outbound messages still queued on the bus (until ctx expires), and then
+// disconnects every channel, giving up any channel leases.
 func (m *Manager) StopAll(ctx context.Context) error {
 	m.mu.Lock()
-	defer m.mu.Unlock()
+	// The supervisor goes first, so it does not restart channels as they stop
+	tasks := []*asyncTask{m.superTask, m.digestTask, m.outboxTask, m.dispatchTask}
+	elections := m.electTask
+	m.superTask, m.digestTask, m.dispatchTask, m.outboxTask, m.electTask = nil, nil, nil, nil, nil
+	m.mu.Unlock()
 
 	logger.InfoC("channels", "Stopping all channels")
 
-	if m.dispatchTask != nil {
-		m.dispatchTask.cancel()
-		m.dispatchTask = nil
+	for _, task := range tasks {
+		if task == nil {
+			continue
+		}
+		task.cancel()
+		select {
+		case <-task.done:
+		case <-ctx.Done():
+		}
 	}
 
-	for name, channel := range m.channels {
-		logger.InfoCF("channels", "Stopping channel", map[string]interface{}{
-			"channel": name,
-		})
-		if err := channel.Stop(ctx); err != nil {
-			logger.ErrorCF("channels", "Error stopping channel", map[string]interface{}{
-				"channel": name,
-				"error":   err.Error(),
-			})
+	m.flushOutbound(ctx)
+
+	if elections != nil {
+		// Each election stops its channel if held, then releases the lease
+		elections.cancel()
+		select {
+		case <-elections.done:
+		case <-ctx.Done():
 		}
+		logger.InfoC("channels", "All channels stopped")
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for name, channel := range m.channels {
+		stopChannel(ctx, name, channel)
 	}
 
 	logger.InfoC("channels", "All channels stopped")
@@ -195,16 +447,241 @@ func (m *Manager) dispatchOutbound(ctx context.Context) {
 				continue
 			}
 
-			if err := channel.Send(ctx, msg); err != nil {
-				logger.ErrorCF("channels", "Error sending message to channel", map[string]interface{}{
-					"channel": msg.Channel,
-					"error":   err.Error(),
-				})
+			if m.holdDraft(ctx, msg) || m.holdDigest(ctx, msg) {
+				continue
 			}
+
+			// Each chat gets its replies in order without waiting on others.
+			// Sends already queued finish when the dispatcher stops.
+			sendCtx := context.WithoutCancel(ctx)
+			m.senders.run(msg.Channel+":"+msg.ChatID, func() {
+				if err := m.deliverDurably(sendCtx, channel, msg); err != nil {
+					logger.ErrorCF("channels", "Error sending message to channel", map[string]interface{}{
+						"channel":  msg.Channel,
+						"error":    err.Error(),
+						"trace_id": msg.TraceID,
+					})
+				}
+			})
+		}
+	}
+}
+
+// flushOutbound delivers outbound messages left on the bus after the
+// dispatcher has stopped. Messages still queued when ctx expires are dropped
+// and counted in the log.
+func (m *Manager) flushOutbound(ctx context.Context) {
+	sent, dropped := 0, 0
+	for {
+		msg, ok := m.bus.TryConsumeOutbound()
+		if !ok {
+			break
+		}
+		if ctx.Err() != nil {
+			dropped++
+			continue
+		}
+		if constants.IsInternalChannel(msg.Channel) {
+			continue
+		}
+
+		m.mu.RLock()
+		channel, exists := m.channels[msg.Channel]
+		m.mu.RUnlock()
+		if !exists || m.holdDraft(ctx, msg) || m.holdDigest(ctx, msg) {
+			continue
 		}
+
+		if err := m.deliverDurably(ctx, channel, msg); err != nil {
+			logger.ErrorCF("channels", "Error flushing message to channel", map[string]interface{}{
+				"channel":  msg.Channel,
+				"error":    err.Error(),
+				"trace_id": msg.TraceID,
+			})
+			continue
+		}
+		sent++
+	}
+
+	if sent > 0 || dropped > 0 {
+		logger.InfoCF("channels", "Flushed outbound queue", map[string]interface{}{
+			"sent":    sent,
+			"dropped": dropped,
+		})
 	}
 }
 
+// deliver sends msg to channel. Channels that cannot edit messages get
+// streaming updates re-cut into completed paragraphs, and the message is
+// rendered for the channel's markup, with a note in place of each file or
+// choice it cannot show. A message with an ID is marked sent once the
+// channel has taken every part.
+func (m *Manager) deliver(ctx context.Context, channel Channel, msg bus.OutboundMessage) (err error) {
+	if msg.Reaction != nil {
+		return react(ctx, channel, msg)
+	}
+	if msg.Delete != "" {
+		return deleteMessage(ctx, channel, msg)
+	}
+	if msg.ID != "" && !msg.Partial {
+		var sent []string
+		ctx = withSentHook(ctx, func(messageID string) {
+			sent = append(sent, messageID)
+			m.indexDelivery(msg, messageID)
+		})
+		defer func() {
+			if err == nil {
+				m.updateDelivery(msg.ID, msg.Channel, msg.ChatID, DeliverySent, "", sent...)
+			}
+		}()
+	}
+	caps := CapabilitiesOf(channel)
+	if !caps.Edits {
+		var send bool
+		if msg, send = m.chunker.prepare(msg); !send {
+			return nil
+		}
+	}
+	policy := m.chunkingPolicy(channel.Name())
+	if note, ok := fileReply(msg, caps, policy); ok {
+		path, err := writeReplyFile(msg.Content)
+		if err != nil {
+			logger.WarnCF("channels", "Failed to write long reply to a file, splitting it instead",
+				map[string]interface{}{"channel": channel.Name(), "error": err.Error()})
+		} else {
+			defer os.RemoveAll(filepath.Dir(path))
+			msg.Media = append([]string{path}, msg.Media...)
+			msg.Content = note
+		}
+	}
+	msg, cleanup := m.fitAttachments(msg, caps)
+	defer cleanup()
+	for i, part := range render.Messages(msg, caps, policy) {
+		if i > 0 && policy.Delay > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(policy.Delay):
+			}
+		}
+		if err := sendProtected(ctx, channel, part); err != nil {
+			return err
+		}
+	}
+	if !caps.Buttons {
+		offerChoices(channel, msg)
+	}
+	return nil
+}
+
+// offerChoices has a channel that lists msg's choices as numbered text take
+// answers to them; see ChoiceChannel.
+func offerChoices(channel Channel, msg bus.OutboundMessage) {
+	cc, ok := channel.(ChoiceChannel)
+	if !ok || msg.Partial {
+		return
+	}
+	if choices := msg.Choices(); len(choices) > 0 {
+		cc.OfferChoices(msg.ChatID, choices)
+	}
+}
+
+// chunkingPolicy returns the configured handling of long replies for the
+// named channel.
+func (m *Manager) chunkingPolicy(name string) render.Policy {
+	if m.config == nil {
+		return render.Policy{}
+	}
+	var c config.ChunkingConfig
+	switch name {
+	case "telegram":
+		c = m.config.Channels.Telegram.Chunking
+	case "discord":
+		c = m.config.Channels.Discord.Chunking
+	case "slack":
+		c = m.config.Channels.Slack.Chunking
+	case "zulip":
+		c = m.config.Channels.Zulip.Chunking
+	case "signal":
+		c = m.config.Channels.Signal.Chunking
+	case "twilio":
+		c = m.config.Channels.Twilio.Chunking
+	case "mqtt":
+		c = m.config.Channels.MQTT.Chunking
+	case "whatsapp":
+		c = m.config.Channels.WhatsApp.Chunking
+	}
+	maxParts := c.MaxParts
+	if maxParts == 0 {
+		maxParts = defaultMaxParts
+	}
+	delay := time.Duration(c.DelayMS) * time.Millisecond
+	return render.Policy{
+		MaxLength:     c.MaxLength,
+		Continuation:  c.Continuation,
+		FileThreshold: c.FileThreshold,
+		MaxParts:      max(maxParts, 0),
+		Delay:         max(delay, 0),
+	}
+}
+
+// sendProtected calls channel.Send, converting a panic inside the channel
+// implementation into an error so one bad send cannot stop the dispatcher.
+// Channels that keep stats count the send.
+func sendProtected(ctx context.Context, channel Channel, msg bus.OutboundMessage) (err error) {
+	defer func() {
+		r := recover()
+		if r != nil {
+			crash.Capture("channels."+channel.Name(), r, crash.MessageContext(msg.Channel, msg.ChatID, "", msg.Content))
+			err = fmt.Errorf("channel %s panicked during send: %v", channel.Name(), r)
+		}
+		if sr, ok := channel.(statsRecorder); ok {
+			sr.recordSend(err, r != nil)
+		}
+	}()
+	return channel.Send(ctx, msg)
+}
+
+// react adds or removes a reaction for msg.Reaction. Reactions only
+// decorate a chat, so channels that cannot react drop them.
+func react(ctx context.Context, channel Channel, msg bus.OutboundMessage) (err error) {
+	rc, ok := channel.(ReactionChannel)
+	if !ok {
+		logger.DebugCF("channels", "Channel cannot react, dropping reaction", map[string]interface{}{
+			"channel": channel.Name(),
+			"emoji":   msg.Reaction.Emoji,
+		})
+		return nil
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			crash.Capture("channels."+channel.Name(), r, crash.MessageContext(msg.Channel, msg.ChatID, "", msg.Reaction.Emoji))
+			err = fmt.Errorf("channel %s panicked during react: %v", channel.Name(), r)
+		}
+	}()
+	return rc.React(ctx, msg.ChatID, *msg.Reaction)
+}
+
+// deleteMessage deletes one of the bot's messages for msg.Delete. Channels
+// that cannot delete messages drop the deletion.
+func deleteMessage(ctx context.Context, channel Channel, msg bus.OutboundMessage) (err error) {
+	dc, ok := channel.(DeleteChannel)
+	if !ok {
+		logger.DebugCF("channels", "Channel cannot delete messages, dropping deletion", map[string]interface{}{
+			"channel":    channel.Name(),
+			"message_id": msg.Delete,
+		})
+		return nil
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			crash.Capture("channels."+channel.Name(), r, crash.MessageContext(msg.Channel, msg.ChatID, "", msg.Delete))
+			err = fmt.Errorf("channel %s panicked during delete: %v", channel.Name(), r)
+		}
+	}()
+	return dc.DeleteMessage(ctx, msg.ChatID, msg.Delete)
+}
+
 func (m *Manager) GetChannel(name string) (Channel, bool) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -219,13 +696,171 @@ func (m *Manager) GetStatus() map[string]interface{} {
 	status := make(map[string]interface{})
 	for name, channel := range m.channels {
 		status[name] = map[string]interface{}{
-			"enabled": true,
-			"running": channel.IsRunning(),
+			"enabled":      true,
+			"running":      channel.IsRunning(),
+			"state":        m.channelState(name, channel),
+			"capabilities": CapabilitiesOf(channel),
 		}
 	}
 	return status
 }
 
+// Capabilities returns what the named channel can deliver.
+func (m *Manager) Capabilities(name string) (render.Capabilities, bool) {
+	m.mu.RLock()
+	channel, ok := m.channels[name]
+	m.mu.RUnlock()
+	if !ok {
+		return render.Capabilities{}, false
+	}
+	return CapabilitiesOf(channel), true
+}
+
+// SetCommands offers the slash commands in the native menus of the
+// channels that have one; see CommandChannel.
+func (m *Manager) SetCommands(cmds []commands.Command) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, channel := range m.channels {
+		if cc, ok := channel.(CommandChannel); ok {
+			cc.SetCommands(cmds)
+		}
+	}
+}
+
+// StatusLine summarizes every channel's state in one line sorted by name,
+// e.g. "telegram: running, whatsapp: reconnecting".
+func (m *Manager) StatusLine() string {
+	states := m.ChannelStates()
+	if len(states) == 0 {
+		return "no channels"
+	}
+	parts := make([]string, 0, len(states))
+	for name, state := range states {
+		parts = append(parts, name+": "+state)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ", ")
+}
+
+// ChannelStates maps each channel to its state, see channelState.
+func (m *Manager) ChannelStates() map[string]string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	states := make(map[string]string, len(m.channels))
+	for name, channel := range m.channels {
+		states[name] = m.channelState(name, channel)
+	}
+	return states
+}
+
+// channelState is "stopped", "connected", or "reconnecting", or "running"
+// for channels that cannot report their connection. A channel held by
+// another instance is "standby", and one whose circuit breaker is open is
+// "degraded". Callers hold m.mu.
+func (m *Manager) channelState(name string, channel Channel) string {
+	if m.elector != nil && !m.elector.Holds(channelRole(name)) {
+		return "standby"
+	}
+	if !channel.IsRunning() {
+		return "stopped"
+	}
+	if m.degraded(name) {
+		return "degraded"
+	}
+	cc, ok := channel.(ConnectionChannel)
+	switch {
+	case !ok:
+		return "running"
+	case cc.Connected():
+		return "connected"
+	default:
+		return "reconnecting"
+	}
+}
+
+// RestartChannel stops a channel and starts it again, e.g. to recover a
+// connection that stopped delivering messages.
+func (m *Manager) RestartChannel(ctx context.Context, name string) error {
+	m.mu.RLock()
+	channel, ok := m.channels[name]
+	runCtx := m.runCtx
+	m.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("channel %s is not enabled", name)
+	}
+	if runCtx == nil {
+		return fmt.Errorf("channels have not been started")
+	}
+	if !m.holds(name) {
+		return fmt.Errorf("channel %s is held by another instance", name)
+	}
+
+	logger.InfoCF("channels", "Restarting channel", map[string]interface{}{
+		"channel": name,
+	})
+	if err := channel.Stop(ctx); err != nil {
+		logger.WarnCF("channels", "Error stopping channel", map[string]interface{}{
+			"channel": name,
+			"error":   err.Error(),
+		})
+	}
+	// Start with the long-lived context: ctx only covers the request
+	if err := channel.Start(runCtx); err != nil {
+		return fmt.Errorf("failed to start %s: %w", name, err)
+	}
+	return nil
+}
+
+// RepairChannel resets a channel's login and starts pairing it again. See
+// PairableChannel.
+func (m *Manager) RepairChannel(ctx context.Context, name, phone string) (string, error) {
+	channel, ok := m.GetChannel(name)
+	if !ok {
+		return "", fmt.Errorf("channel %s is not enabled", name)
+	}
+	pairable, ok := channel.(PairableChannel)
+	if !ok {
+		return "", fmt.Errorf("channel %s does not support re-pairing", name)
+	}
+	logger.InfoCF("channels", "Re-pairing channel", map[string]interface{}{
+		"channel": name,
+	})
+	return pairable.Repair(ctx, phone)
+}
+
+// Contacts lists the address books of the channels that have one, see
+// ContactChannel, skipping channels another instance holds. A channel that
+// fails is logged and left out.
+func (m *Manager) Contacts(ctx context.Context) []contacts.Contact {
+	m.mu.RLock()
+	sources := make(map[string]ContactChannel)
+	for name, channel := range m.channels {
+		if cc, ok := channel.(ContactChannel); ok {
+			sources[name] = cc
+		}
+	}
+	m.mu.RUnlock()
+
+	var list []contacts.Contact
+	for name, cc := range sources {
+		if !m.holds(name) {
+			continue
+		}
+		found, err := cc.Contacts(ctx)
+		if err != nil {
+			logger.WarnCF("channels", "Failed to list contacts", map[string]interface{}{
+				"channel": name,
+				"error":   err.Error(),
+			})
+			continue
+		}
+		list = append(list, found...)
+	}
+	return list
+}
+
 func (m *Manager) GetEnabledChannels() []string {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -240,6 +875,14 @@ func (m *Manager) GetEnabledChannels() []string {
 func (m *Manager) RegisterChannel(name string, channel Channel) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	if sc, ok := channel.(StateChannel); ok && m.state != nil {
+		sc.SetStateStore(m.state)
+	}
+	if fc, ok := channel.(FilterChannel); ok {
+		for _, f := range m.filters {
+			fc.AddFilter(f.name, f.filter)
+		}
+	}
 	m.channels[name] = channel
 }
 
@@ -264,5 +907,5 @@ func (m *Manager) SendToChannel(ctx context.Context, channelName, chatID, conten
 		Content: content,
 	}
 
-	return channel.Send(ctx, msg)
+	return sendProtected(ctx, channel, render.Render(msg, CapabilitiesOf(channel)))
 }
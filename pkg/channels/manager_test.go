@@ -0,0 +1,303 @@
+package channels
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/render"
+)
+
+// richChannel records what it is sent and declares its capabilities.
+type richChannel struct {
+	flakyChannel
+	caps render.Capabilities
+}
+
+func (c *richChannel) Capabilities() render.Capabilities { return c.caps }
+
+func TestDeliverRendersForChannel(t *testing.T) {
+	msg := bus.OutboundMessage{
+		Channel: "sms", ChatID: "1", Content: "**Disk** is full",
+		Media:   []string{"/ws/images/df.png"},
+		Buttons: []bus.Button{{Text: "Clean up", Data: "/cleanup"}},
+	}
+	tests := []struct {
+		name    string
+		channel Channel
+		want    string
+	}{
+		{"plain", &richChannel{flakyChannel: flakyChannel{BaseChannel: NewBaseChannel("sms", nil, nil, nil)}, caps: render.Capabilities{Markup: render.Plain}},
+			"Disk is full\n[attachment: df.png]\n1. Clean up\nReply with a number to choose."},
+		{"native", &richChannel{flakyChannel: flakyChannel{BaseChannel: NewBaseChannel("sms", nil, nil, nil)}, caps: render.Capabilities{Markup: render.Mrkdwn, Media: true, Buttons: true}},
+			"*Disk* is full"},
+		// Channels that do not describe themselves get Markdown as written
+		{"undeclared", &flakyChannel{BaseChannel: NewBaseChannel("sms", nil, nil, nil)},
+			"**Disk** is full\n[attachment: df.png]\n1. Clean up\nReply with a number to choose."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Manager{channels: map[string]Channel{"sms": tt.channel}, chunker: newStreamChunker()}
+			if err := m.deliver(context.Background(), tt.channel, msg); err != nil {
+				t.Fatal(err)
+			}
+			var sent []string
+			switch ch := tt.channel.(type) {
+			case *richChannel:
+				sent = ch.sent
+			case *flakyChannel:
+				sent = ch.sent
+			}
+			if len(sent) != 1 || sent[0] != tt.want {
+				t.Errorf("sent %q, want %q", sent, tt.want)
+			}
+		})
+	}
+}
+
+// fileChannel records the attachments it is sent with their contents,
+// since delivery removes reply files once sent.
+type fileChannel struct {
+	richChannel
+	files map[string]string
+}
+
+func (c *fileChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	for _, path := range msg.Media {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		c.files[filepath.Base(path)] = string(data)
+	}
+	return c.richChannel.Send(ctx, msg)
+}
+
+func TestDeliverLongReplies(t *testing.T) {
+	reply := "First paragraph.\n\n```\ncode\n\nmore code\n```\n\nLast."
+	cfg := &config.Config{}
+	cfg.Channels.Telegram.Chunking = config.ChunkingConfig{MaxLength: 34, Continuation: "(more)", DelayMS: 30}
+	cfg.Channels.Discord.Chunking = config.ChunkingConfig{FileThreshold: 20}
+	cfg.Channels.Slack.Chunking = config.ChunkingConfig{MaxLength: 60, MaxParts: 2}
+
+	newChannel := func(name string) *fileChannel {
+		return &fileChannel{
+			richChannel: richChannel{flakyChannel: flakyChannel{BaseChannel: NewBaseChannel(name, nil, nil, nil)},
+				caps: render.Capabilities{Markup: render.Markdown, Media: true, Edits: true, MaxLength: 4096}},
+			files: make(map[string]string),
+		}
+	}
+
+	t.Run("split", func(t *testing.T) {
+		ch := newChannel("telegram")
+		m := &Manager{config: cfg, chunker: newStreamChunker()}
+		start := time.Now()
+		if err := m.deliver(context.Background(), ch, bus.OutboundMessage{Channel: "telegram", ChatID: "1", Content: reply}); err != nil {
+			t.Fatal(err)
+		}
+		want := []string{"First paragraph.\n\n(more)", "```\ncode\n\nmore code\n```\n\n(more)", "Last."}
+		if strings.Join(ch.sent, "|") != strings.Join(want, "|") {
+			t.Errorf("sent %q, want %q", ch.sent, want)
+		}
+		if d := time.Since(start); d < 60*time.Millisecond {
+			t.Errorf("three parts sent in %v, want 30ms between them", d)
+		}
+	})
+
+	t.Run("file", func(t *testing.T) {
+		ch := newChannel("discord")
+		m := &Manager{config: cfg, chunker: newStreamChunker()}
+		if err := m.deliver(context.Background(), ch, bus.OutboundMessage{Channel: "discord", ChatID: "1", Content: reply}); err != nil {
+			t.Fatal(err)
+		}
+		if len(ch.sent) != 1 || ch.sent[0] != "The full reply is attached." {
+			t.Errorf("sent %q", ch.sent)
+		}
+		if ch.files["reply.md"] != reply {
+			t.Errorf("files = %q", ch.files)
+		}
+	})
+
+	t.Run("too many parts", func(t *testing.T) {
+		ch := newChannel("slack")
+		m := &Manager{config: cfg, chunker: newStreamChunker()}
+		long := "Summary line.\n\n" + strings.Repeat("Paragraph of text.\n\n", 10)
+		if err := m.deliver(context.Background(), ch, bus.OutboundMessage{Channel: "slack", ChatID: "1", Content: long}); err != nil {
+			t.Fatal(err)
+		}
+		if len(ch.sent) != 1 || ch.sent[0] != "Summary line.\n\nThe full reply (21 lines) is attached." {
+			t.Errorf("sent %q", ch.sent)
+		}
+		if ch.files["reply.md"] != long {
+			t.Errorf("files = %q", ch.files)
+		}
+	})
+
+	t.Run("log", func(t *testing.T) {
+		ch := newChannel("slack")
+		m := &Manager{config: cfg, chunker: newStreamChunker()}
+		log := "```\n" + strings.Repeat("GET /healthz 200\n", 10) + "```"
+		if err := m.deliver(context.Background(), ch, bus.OutboundMessage{Channel: "slack", ChatID: "1", Content: log}); err != nil {
+			t.Fatal(err)
+		}
+		if len(ch.sent) != 1 || ch.sent[0] != "The full reply (12 lines) is attached." {
+			t.Errorf("sent %q", ch.sent)
+		}
+		if ch.files["reply.txt"] != strings.Repeat("GET /healthz 200\n", 10) {
+			t.Errorf("files = %q", ch.files)
+		}
+	})
+}
+
+func TestPacedReplyHoldsOnlyItsChat(t *testing.T) {
+	if d := (&Manager{config: config.DefaultConfig()}).chunkingPolicy("telegram").Delay; d != 0 {
+		t.Errorf("telegram delay = %v, want none by default", d)
+	}
+	if d := (&Manager{config: config.DefaultConfig()}).chunkingPolicy("whatsapp").Delay; d != 500*time.Millisecond {
+		t.Errorf("whatsapp delay = %v, want 500ms by default", d)
+	}
+
+	cfg := &config.Config{}
+	cfg.Channels.Telegram.Chunking = config.ChunkingConfig{MaxLength: 20, DelayMS: 300}
+	mb := bus.NewMessageBus()
+	m, err := NewManager(cfg, mb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := NewFake("telegram", mb, nil)
+	m.RegisterChannel("telegram", fake)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := m.StartAll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer m.StopAll(context.Background())
+
+	start := time.Now()
+	mb.PublishOutbound(bus.OutboundMessage{Channel: "telegram", ChatID: "1", Content: "First part.\n\nSecond part.\n\nThird part."})
+	mb.PublishOutbound(bus.OutboundMessage{Channel: "telegram", ChatID: "2", Content: "Hello."})
+
+	var order []string
+	for i := 0; i < 4; i++ {
+		out, err := fake.Next(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		order = append(order, out.ChatID+":"+out.Content)
+		if out.ChatID == "2" && time.Since(start) >= 300*time.Millisecond {
+			t.Errorf("chat 2 waited %v on chat 1's pacing", time.Since(start))
+		}
+	}
+	var chat1 []string
+	for _, o := range order {
+		if strings.HasPrefix(o, "1:") {
+			chat1 = append(chat1, o)
+		}
+	}
+	if want := []string{"1:First part.", "1:Second part.", "1:Third part."}; strings.Join(chat1, "|") != strings.Join(want, "|") {
+		t.Errorf("chat 1 got %q, want %q", chat1, want)
+	}
+}
+
+// reactingChannel records the reactions it is asked for.
+type reactingChannel struct {
+	flakyChannel
+	reactions []bus.Reaction
+}
+
+func (c *reactingChannel) React(ctx context.Context, chatID string, reaction bus.Reaction) error {
+	c.reactions = append(c.reactions, reaction)
+	return nil
+}
+
+func TestDeliverReaction(t *testing.T) {
+	msg := bus.OutboundMessage{Channel: "chat", ChatID: "1", Reaction: &bus.Reaction{MessageID: "9", Emoji: "✅"}}
+
+	reacting := &reactingChannel{flakyChannel: flakyChannel{BaseChannel: NewBaseChannel("chat", nil, nil, nil)}}
+	m := &Manager{chunker: newStreamChunker()}
+	if err := m.deliver(context.Background(), reacting, msg); err != nil {
+		t.Fatal(err)
+	}
+	if len(reacting.reactions) != 1 || reacting.reactions[0] != *msg.Reaction || len(reacting.sent) != 0 {
+		t.Errorf("reactions = %+v, sent = %q", reacting.reactions, reacting.sent)
+	}
+
+	// Channels that cannot react drop the reaction rather than send text
+	plain := &flakyChannel{BaseChannel: NewBaseChannel("chat", nil, nil, nil)}
+	if err := m.deliver(context.Background(), plain, msg); err != nil {
+		t.Fatal(err)
+	}
+	if len(plain.sent) != 0 {
+		t.Errorf("sent %q", plain.sent)
+	}
+}
+
+func TestDeliverDelete(t *testing.T) {
+	msg := bus.OutboundMessage{Channel: "fake", ChatID: "1", Delete: "9"}
+	fake := NewFake("fake", nil, nil)
+	m := &Manager{chunker: newStreamChunker()}
+	if err := m.deliver(context.Background(), fake, msg); err != nil {
+		t.Fatal(err)
+	}
+	if sent := fake.Sent(); len(sent) != 1 || sent[0].Delete != "9" || sent[0].Content != "" {
+		t.Errorf("sent = %+v, want the deletion", sent)
+	}
+
+	// Channels that cannot delete messages drop the deletion
+	plain := &flakyChannel{BaseChannel: NewBaseChannel("chat", nil, nil, nil)}
+	if err := m.deliver(context.Background(), plain, msg); err != nil {
+		t.Fatal(err)
+	}
+	if len(plain.sent) != 0 {
+		t.Errorf("sent %q", plain.sent)
+	}
+}
+
+type restartableChannel struct {
+	*BaseChannel
+	starts, stops int
+}
+
+func (c *restartableChannel) Start(ctx context.Context) error {
+	c.starts++
+	c.setRunning(true)
+	return nil
+}
+
+func (c *restartableChannel) Stop(ctx context.Context) error {
+	c.stops++
+	c.setRunning(false)
+	return nil
+}
+
+func (c *restartableChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	return nil
+}
+
+func TestRestartAndRepairChannel(t *testing.T) {
+	ch := &restartableChannel{BaseChannel: NewBaseChannel("test", nil, nil, nil)}
+	m := &Manager{channels: map[string]Channel{"test": ch}}
+
+	if err := m.RestartChannel(context.Background(), "test"); err == nil {
+		t.Error("restart before StartAll should fail")
+	}
+	m.runCtx = context.Background()
+
+	if err := m.RestartChannel(context.Background(), "test"); err != nil {
+		t.Fatalf("RestartChannel: %v", err)
+	}
+	if ch.stops != 1 || ch.starts != 1 || !ch.IsRunning() {
+		t.Errorf("stops=%d starts=%d running=%v", ch.stops, ch.starts, ch.IsRunning())
+	}
+	if err := m.RestartChannel(context.Background(), "missing"); err == nil {
+		t.Error("restarting an unknown channel should fail")
+	}
+	if _, err := m.RepairChannel(context.Background(), "test", ""); err == nil || !strings.Contains(err.Error(), "does not support") {
+		t.Errorf("RepairChannel on a non-pairable channel: err = %v", err)
+	}
+}
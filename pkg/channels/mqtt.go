@@ -0,0 +1,380 @@
+package channels
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/render"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// MQTT chats are the topics messages arrive on, named by the topic levels
+// the inbound topic's wildcards matched, joined with ":" since "/" would
+// read as a thread: "kitchen" for "picoclaw/in/kitchen" under
+// "picoclaw/in/+".
+const (
+	// mqttChatPlaceholder stands for the chat in the outbound topic.
+	mqttChatPlaceholder = "{chat}"
+	// maxMQTTPayload is the largest message taken from the broker; larger
+	// ones are dropped.
+	maxMQTTPayload = 64 << 10
+	// mqttTimeout bounds connecting, subscribing, and publishing.
+	mqttTimeout = 30 * time.Second
+)
+
+type MQTTChannel struct {
+	*BaseChannel
+	config config.MQTTConfig
+	opts   *mqtt.ClientOptions
+	// topics are the topic filters with allow lists of their own
+	topics []config.MQTTTopic
+
+	mu     sync.Mutex
+	client mqtt.Client
+}
+
+func NewMQTTChannel(cfg config.MQTTConfig, messageBus *bus.MessageBus) (*MQTTChannel, error) {
+	if cfg.InboundTopic == "" || cfg.OutboundTopic == "" {
+		return nil, fmt.Errorf("mqtt inbound_topic and outbound_topic are required")
+	}
+	if cfg.QoS < 0 || cfg.QoS > 2 {
+		return nil, fmt.Errorf("mqtt qos must be 0, 1, or 2, not %d", cfg.QoS)
+	}
+	if strings.ContainsAny(cfg.OutboundTopic, "+#") {
+		return nil, fmt.Errorf("mqtt outbound_topic %q must not hold wildcards", cfg.OutboundTopic)
+	}
+	// The bot would otherwise answer its own replies
+	if mqttTopicMatches(cfg.InboundTopic, strings.ReplaceAll(cfg.OutboundTopic, mqttChatPlaceholder, "chat")) {
+		return nil, fmt.Errorf("mqtt outbound_topic %q must not match inbound_topic %q", cfg.OutboundTopic, cfg.InboundTopic)
+	}
+	broker, err := url.Parse(cfg.Broker)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mqtt broker URL: %w", err)
+	}
+	tlsConfig, err := mqttTLSConfig(broker.Scheme, cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig == nil && cfg.Password != "" && !isLoopbackHost(broker.Hostname()) {
+		logger.WarnCF("mqtt", "MQTT password is sent unencrypted; use an ssl:// or mqtts:// broker", map[string]interface{}{
+			"broker": broker.Host,
+		})
+	}
+
+	clientID := cfg.ClientID
+	if clientID == "" {
+		host, _ := os.Hostname()
+		clientID = "picoclaw-" + host
+	}
+
+	base := NewBaseChannel("mqtt", cfg, messageBus, cfg.AllowFrom)
+	c := &MQTTChannel{
+		BaseChannel: base,
+		config:      cfg,
+		topics:      cfg.Topics,
+	}
+	c.opts = mqtt.NewClientOptions().
+		AddBroker(cfg.Broker).
+		SetClientID(clientID).
+		SetUsername(cfg.Username).
+		SetPassword(cfg.Password).
+		SetTLSConfig(tlsConfig).
+		SetCleanSession(true).
+		SetConnectTimeout(mqttTimeout).
+		SetKeepAlive(30 * time.Second).
+		SetAutoReconnect(true).
+		SetMaxReconnectInterval(time.Minute).
+		SetOnConnectHandler(c.subscribe).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			logger.WarnCF("mqtt", "MQTT connection lost, reconnecting", map[string]interface{}{
+				"error": err.Error(),
+			})
+		})
+	return c, nil
+}
+
+// mqttTLSConfig returns the TLS settings for a broker reached with scheme,
+// or nil for one reached in the clear.
+func mqttTLSConfig(scheme string, cfg config.MQTTTLSConfig) (*tls.Config, error) {
+	switch scheme {
+	case "ssl", "tls", "mqtts", "wss":
+	default:
+		if cfg != (config.MQTTTLSConfig{}) {
+			return nil, fmt.Errorf("mqtt tls settings need an ssl://, tls://, mqtts://, or wss:// broker")
+		}
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read mqtt ca_file: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("mqtt ca_file %s holds no PEM certificates", cfg.CAFile)
+		}
+	}
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load mqtt client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func (c *MQTTChannel) Start(ctx context.Context) error {
+	logger.InfoC("mqtt", "Starting MQTT channel")
+
+	client := mqtt.NewClient(c.opts)
+	token := client.Connect()
+	if !token.WaitTimeout(mqttTimeout) {
+		client.Disconnect(0)
+		return fmt.Errorf("mqtt broker %s did not answer", c.config.Broker)
+	}
+	if err := token.Error(); err != nil {
+		return fmt.Errorf("failed to connect to mqtt broker: %w", err)
+	}
+	c.mu.Lock()
+	c.client = client
+	c.mu.Unlock()
+
+	c.setRunning(true)
+	logger.InfoCF("mqtt", "MQTT channel started", map[string]interface{}{
+		"broker": c.config.Broker,
+		"topic":  c.config.InboundTopic,
+	})
+	return nil
+}
+
+func (c *MQTTChannel) Stop(ctx context.Context) error {
+	logger.InfoC("mqtt", "Stopping MQTT channel")
+
+	c.mu.Lock()
+	client := c.client
+	c.client = nil
+	c.mu.Unlock()
+	if client != nil {
+		client.Disconnect(250)
+	}
+
+	c.setRunning(false)
+	logger.InfoC("mqtt", "MQTT channel stopped")
+	return nil
+}
+
+// Connected reports whether the broker connection is up.
+func (c *MQTTChannel) Connected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.client != nil && c.client.IsConnectionOpen()
+}
+
+// subscribe subscribes to the inbound topic, on every connect, since the
+// broker forgets a clean session's subscriptions when it drops.
+func (c *MQTTChannel) subscribe(client mqtt.Client) {
+	token := client.Subscribe(c.config.InboundTopic, byte(c.config.QoS), c.handleMessage)
+	if !token.WaitTimeout(mqttTimeout) || token.Error() != nil {
+		logger.ErrorCF("mqtt", "Failed to subscribe to inbound topic", map[string]interface{}{
+			"topic": c.config.InboundTopic,
+			"error": fmt.Sprint(token.Error()),
+		})
+		return
+	}
+	logger.InfoCF("mqtt", "Subscribed to inbound topic", map[string]interface{}{
+		"topic": c.config.InboundTopic,
+	})
+}
+
+// mqttPayload is a message sent as JSON rather than plain text. From names
+// the sender with trust_from set, and is only as trustworthy as the
+// broker's access control.
+type mqttPayload struct {
+	Text string `json:"text"`
+	From string `json:"from"`
+	ID   string `json:"id"`
+}
+
+func (c *MQTTChannel) handleMessage(_ mqtt.Client, msg mqtt.Message) {
+	defer c.Recover()
+
+	topic := msg.Topic()
+	// Retained messages were answered when they were first published
+	if msg.Retained() {
+		return
+	}
+	if len(msg.Payload()) > maxMQTTPayload {
+		logger.WarnCF("mqtt", "Message too large, ignoring", map[string]interface{}{
+			"topic": topic,
+			"bytes": len(msg.Payload()),
+		})
+		return
+	}
+	chatID := mqttChatID(c.config.InboundTopic, topic)
+	content, senderID, messageID := strings.TrimSpace(string(msg.Payload())), chatID, ""
+	var payload mqttPayload
+	if strings.HasPrefix(content, "{") && json.Unmarshal(msg.Payload(), &payload) == nil && payload.Text != "" {
+		content, messageID = strings.TrimSpace(payload.Text), payload.ID
+		// "from" is whatever the publisher wrote, so it names the sender
+		// only when configured to, and marked as claimed. A "|" would let
+		// a part of it match an operator on its own.
+		if from := strings.ReplaceAll(strings.TrimSpace(payload.From), "|", ""); c.config.TrustFrom && from != "" {
+			senderID = bus.ClaimedSenderPrefix + from
+		}
+	}
+	if content == "" || chatID == "" {
+		return
+	}
+	if !c.topicAllows(topic, senderID) {
+		logger.DebugCF("mqtt", "Sender not allowed on this topic", map[string]interface{}{
+			"topic":     topic,
+			"sender_id": senderID,
+		})
+		return
+	}
+
+	metadata := map[string]string{
+		"topic": topic,
+	}
+	if messageID != "" {
+		metadata["message_id"] = messageID
+	}
+
+	logger.DebugCF("mqtt", "Message received", map[string]interface{}{
+		"topic":   topic,
+		"from":    senderID,
+		"content": utils.Truncate(content, 50),
+	})
+
+	c.HandleMessage(senderID, chatID, content, nil, metadata)
+}
+
+// topicAllows reports whether senderID is on the allow list of every
+// topics entry whose filter topic matches.
+func (c *MQTTChannel) topicAllows(topic, senderID string) bool {
+	for _, t := range c.topics {
+		if !mqttTopicMatches(t.Topic, topic) || len(t.AllowFrom) == 0 {
+			continue
+		}
+		allowed := c.isGranted(senderID)
+		for _, id := range t.AllowFrom {
+			allowed = allowed || id == senderID
+		}
+		if !allowed {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *MQTTChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("mqtt channel not running")
+	}
+	if msg.Content == "" {
+		return nil
+	}
+	topic, err := c.outboundTopic(msg.ChatID)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	client := c.client
+	c.mu.Unlock()
+	if client == nil {
+		return fmt.Errorf("mqtt channel not connected")
+	}
+	token := client.Publish(topic, byte(c.config.QoS), false, msg.Content)
+	select {
+	case <-token.Done():
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(mqttTimeout):
+		return fmt.Errorf("mqtt publish to %s timed out", topic)
+	}
+	if err := token.Error(); err != nil {
+		return fmt.Errorf("failed to publish mqtt message: %w", err)
+	}
+
+	logger.DebugCF("mqtt", "Message published", map[string]interface{}{
+		"topic": topic,
+	})
+	return nil
+}
+
+// outboundTopic returns the topic replies to chatID are published to.
+func (c *MQTTChannel) outboundTopic(chatID string) (string, error) {
+	if chatID == "" || strings.ContainsAny(chatID, "+#/") {
+		return "", fmt.Errorf("invalid mqtt chat ID %q", chatID)
+	}
+	return strings.ReplaceAll(c.config.OutboundTopic, mqttChatPlaceholder, strings.ReplaceAll(chatID, ":", "/")), nil
+}
+
+// Capabilities reports that MQTT messages are plain text, without
+// attachments or a length limit of their own.
+func (c *MQTTChannel) Capabilities() render.Capabilities {
+	return render.Capabilities{Markup: render.Plain}
+}
+
+// mqttTopicMatches reports whether topic matches filter, where "+" matches
+// one topic level and a trailing "#" any number of them, including none.
+func mqttTopicMatches(filter, topic string) bool {
+	f, t := strings.Split(filter, "/"), strings.Split(topic, "/")
+	for i, level := range f {
+		if level == "#" {
+			return true
+		}
+		if i >= len(t) || (level != "+" && level != t[i]) {
+			return false
+		}
+	}
+	return len(f) == len(t)
+}
+
+// mqttChatID returns the chat a message on topic belongs to: the levels
+// filter's wildcards matched, joined with ":", or topic's last level when
+// filter has none. It returns "" when topic does not match.
+func mqttChatID(filter, topic string) string {
+	if !mqttTopicMatches(filter, topic) {
+		return ""
+	}
+	f, t := strings.Split(filter, "/"), strings.Split(topic, "/")
+	var levels []string
+	for i, level := range f {
+		switch level {
+		case "+":
+			levels = append(levels, t[i])
+		case "#":
+			levels = append(levels, t[i:]...)
+		}
+	}
+	if !strings.ContainsAny(filter, "+#") {
+		levels = t[len(t)-1:]
+	}
+	return strings.Join(levels, ":")
+}
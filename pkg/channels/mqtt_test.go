@@ -0,0 +1,262 @@
+package channels
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestMQTTTopics(t *testing.T) {
+	tests := []struct {
+		filter, topic string
+		match         bool
+		chatID        string
+	}{
+		{"picoclaw/in/+", "picoclaw/in/kitchen", true, "kitchen"},
+		{"picoclaw/in/+", "picoclaw/in/kitchen/lamp", false, ""},
+		{"home/+/ask/+", "home/kitchen/ask/lamp", true, "kitchen:lamp"},
+		{"home/#", "home/kitchen/lamp", true, "kitchen:lamp"},
+		{"home/#", "home", true, ""},
+		{"devices/ask", "devices/ask", true, "ask"},
+		{"devices/ask", "devices/other", false, ""},
+	}
+	for _, tt := range tests {
+		if got := mqttTopicMatches(tt.filter, tt.topic); got != tt.match {
+			t.Errorf("mqttTopicMatches(%q, %q) = %v, want %v", tt.filter, tt.topic, got, tt.match)
+		}
+		if got := mqttChatID(tt.filter, tt.topic); got != tt.chatID {
+			t.Errorf("mqttChatID(%q, %q) = %q, want %q", tt.filter, tt.topic, got, tt.chatID)
+		}
+	}
+}
+
+func TestNewMQTTChannelChecksConfig(t *testing.T) {
+	valid := config.MQTTConfig{
+		Broker: "tcp://localhost:1883", QoS: 1, InboundTopic: "picoclaw/in/+", OutboundTopic: "picoclaw/out/{chat}",
+	}
+	tests := map[string]func(*config.MQTTConfig){
+		"qos":              func(c *config.MQTTConfig) { c.QoS = 3 },
+		"echo":             func(c *config.MQTTConfig) { c.OutboundTopic = "picoclaw/in/{chat}" },
+		"wildcard":         func(c *config.MQTTConfig) { c.OutboundTopic = "picoclaw/out/#" },
+		"tls in the clear": func(c *config.MQTTConfig) { c.TLS.CAFile = "ca.pem" },
+	}
+	for name, change := range tests {
+		cfg := valid
+		change(&cfg)
+		if _, err := NewMQTTChannel(cfg, bus.NewMessageBus()); err == nil {
+			t.Errorf("%s: NewMQTTChannel() succeeded", name)
+		}
+	}
+	if _, err := NewMQTTChannel(valid, bus.NewMessageBus()); err != nil {
+		t.Errorf("NewMQTTChannel() = %v", err)
+	}
+}
+
+// fakeBroker is an MQTT broker for one client, which publishes what the
+// test sends it and records what the client publishes.
+type fakeBroker struct {
+	listener   net.Listener
+	subscribed chan string
+
+	mu        sync.Mutex
+	conn      net.Conn
+	published []*packets.PublishPacket
+}
+
+func newFakeBroker(t *testing.T) *fakeBroker {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &fakeBroker{listener: ln, subscribed: make(chan string, 1)}
+	go b.serve()
+	return b
+}
+
+func (b *fakeBroker) serve() {
+	conn, err := b.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	b.mu.Lock()
+	b.conn = conn
+	b.mu.Unlock()
+	for {
+		packet, err := packets.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+		switch p := packet.(type) {
+		case *packets.ConnectPacket:
+			ack := packets.NewControlPacket(packets.Connack).(*packets.ConnackPacket)
+			if p.Username != "bot" || string(p.Password) != "secret" {
+				ack.ReturnCode = packets.ErrRefusedBadUsernameOrPassword
+			}
+			b.write(ack)
+		case *packets.SubscribePacket:
+			ack := packets.NewControlPacket(packets.Suback).(*packets.SubackPacket)
+			ack.MessageID, ack.ReturnCodes = p.MessageID, p.Qoss
+			b.write(ack)
+			b.subscribed <- p.Topics[0]
+		case *packets.PublishPacket:
+			b.mu.Lock()
+			b.published = append(b.published, p)
+			b.mu.Unlock()
+			if p.Qos == 1 {
+				ack := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+				ack.MessageID = p.MessageID
+				b.write(ack)
+			}
+		case *packets.PingreqPacket:
+			b.write(packets.NewControlPacket(packets.Pingresp))
+		case *packets.DisconnectPacket:
+			return
+		}
+	}
+}
+
+func (b *fakeBroker) write(p packets.ControlPacket) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	p.Write(b.conn)
+}
+
+// publish delivers a message to the client at QoS 0.
+func (b *fakeBroker) publish(topic, payload string, retain bool) {
+	p := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+	p.TopicName, p.Payload, p.Retain = topic, []byte(payload), retain
+	b.write(p)
+}
+
+func TestMQTTChannel(t *testing.T) {
+	broker := newFakeBroker(t)
+	defer broker.listener.Close()
+
+	msgBus := bus.NewMessageBus()
+	ch, err := NewMQTTChannel(config.MQTTConfig{
+		Broker:        "tcp://" + broker.listener.Addr().String(),
+		Username:      "bot",
+		Password:      "secret",
+		QoS:           1,
+		InboundTopic:  "picoclaw/in/+",
+		OutboundTopic: "picoclaw/out/{chat}",
+		Topics:        []config.MQTTTopic{{Topic: "picoclaw/in/door", AllowFrom: config.FlexibleStringSlice{"claimed:alice"}}},
+		TrustFrom:     true,
+	}, msgBus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := ch.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer ch.Stop(ctx)
+
+	select {
+	case topic := <-broker.subscribed:
+		if topic != "picoclaw/in/+" {
+			t.Errorf("subscribed to %q", topic)
+		}
+	case <-ctx.Done():
+		t.Fatal("no subscription")
+	}
+	if !ch.Connected() {
+		t.Error("Connected() = false")
+	}
+
+	broker.publish("picoclaw/in/kitchen", "stale question", true)
+	broker.publish("picoclaw/in/door", "open", false)
+	broker.publish("picoclaw/in/door", `{"text": "open", "from": "alice", "id": "7"}`, false)
+	broker.publish("picoclaw/in/kitchen", "what's the temperature?", false)
+
+	door, ok := msgBus.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("no inbound message")
+	}
+	if door.ChatID != "door" || door.SenderID != "claimed:alice" || door.Content != "open" || door.Metadata["message_id"] != "7" ||
+		door.Metadata["topic"] != "picoclaw/in/door" {
+		t.Errorf("door message = %q from %q in %q, metadata %v", door.Content, door.SenderID, door.ChatID, door.Metadata)
+	}
+	kitchen, ok := msgBus.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("no kitchen message")
+	}
+	if kitchen.ChatID != "kitchen" || kitchen.SenderID != "kitchen" || kitchen.Content != "what's the temperature?" {
+		t.Errorf("kitchen message = %q from %q in %q", kitchen.Content, kitchen.SenderID, kitchen.ChatID)
+	}
+
+	if err := ch.Send(ctx, bus.OutboundMessage{ChatID: "kitchen", Content: "21°C"}); err != nil {
+		t.Fatal(err)
+	}
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+	if len(broker.published) != 1 {
+		t.Fatalf("published %d messages, want 1", len(broker.published))
+	}
+	if p := broker.published[0]; p.TopicName != "picoclaw/out/kitchen" || string(p.Payload) != "21°C" || p.Qos != 1 {
+		t.Errorf("published %q to %q at QoS %d", p.Payload, p.TopicName, p.Qos)
+	}
+}
+
+// mqttMessage is a message as the client hands it to the channel.
+type mqttMessage struct {
+	topic   string
+	payload string
+}
+
+func (m mqttMessage) Duplicate() bool   { return false }
+func (m mqttMessage) Qos() byte         { return 0 }
+func (m mqttMessage) Retained() bool    { return false }
+func (m mqttMessage) Topic() string     { return m.topic }
+func (m mqttMessage) MessageID() uint16 { return 0 }
+func (m mqttMessage) Payload() []byte   { return []byte(m.payload) }
+func (m mqttMessage) Ack()              {}
+
+func TestMQTTSenderIdentity(t *testing.T) {
+	tests := []struct {
+		name      string
+		trustFrom bool
+		payload   string
+		sender    string
+	}{
+		{"plain text", false, "open", "door"},
+		{"from ignored", false, `{"text": "open", "from": "alice"}`, "door"},
+		{"from trusted", true, `{"text": "open", "from": "alice"}`, "claimed:alice"},
+		{"composite from", true, `{"text": "open", "from": "alice|42"}`, "claimed:alice42"},
+		{"no from", true, `{"text": "open"}`, "door"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msgBus := bus.NewMessageBus()
+			ch, err := NewMQTTChannel(config.MQTTConfig{
+				Broker:        "tcp://localhost:1883",
+				InboundTopic:  "picoclaw/in/+",
+				OutboundTopic: "picoclaw/out/{chat}",
+				TrustFrom:     tt.trustFrom,
+			}, msgBus)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ch.handleMessage(nil, mqttMessage{topic: "picoclaw/in/door", payload: tt.payload})
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			msg, ok := msgBus.ConsumeInbound(ctx)
+			if !ok {
+				t.Fatal("no inbound message")
+			}
+			if msg.SenderID != tt.sender || msg.Content != "open" {
+				t.Errorf("message = %q from %q, want from %q", msg.Content, msg.SenderID, tt.sender)
+			}
+		})
+	}
+}
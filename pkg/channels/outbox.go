@@ -0,0 +1,281 @@
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+const (
+	// outboxBucket holds outbound messages from just before Send until the
+	// channel accepts them, so a crash or power cut mid-send does not lose
+	// a reply.
+	outboxBucket = "outbox"
+	// outboxRetryInterval is how often messages that failed to send are
+	// tried again.
+	outboxRetryInterval = time.Minute
+	// outboxMaxAttempts bounds retries of a message a channel keeps
+	// rejecting, unless the channel's retry policy sets another limit.
+	outboxMaxAttempts = 10
+	// outboxMaxAge drops messages too stale to be worth delivering, unless
+	// the channel's retry policy sets another age.
+	outboxMaxAge = 24 * time.Hour
+)
+
+// outboxEntry is one undelivered message. Attempts counts failed sends; an
+// entry with none is being sent right now, or was when the process died,
+// unless it is held until its channel's circuit breaker closes.
+type outboxEntry struct {
+	Message   bus.OutboundMessage `json:"message"`
+	Queued    time.Time           `json:"queued"`
+	Attempts  int                 `json:"attempts,omitempty"`
+	LastError string              `json:"last_error,omitempty"`
+	Held      bool                `json:"held,omitempty"`
+	// Collapsed counts the duplicates folded into the entry, and
+	// Duplicates holds their delivery IDs; see collapseOutbox.
+	Collapsed  int      `json:"collapsed,omitempty"`
+	Duplicates []string `json:"duplicates,omitempty"`
+}
+
+var outboxSeq atomic.Uint64
+
+// errStandby records an outbox entry left for the instance holding its
+// channel.
+var errStandby = errors.New("channel is held by another instance")
+
+func (m *Manager) outboxStore() state.Store {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state
+}
+
+// deliverDurably records msg in the outbox, sends it, and removes it once
+// the channel accepts it. A failed send stays in the outbox for retry, as
+// does a message for a degraded channel, and one for a channel another
+// instance holds, which that instance picks up from the shared store.
+// Streaming updates skip the outbox; the final message they lead up to is
+// recorded, and updates for a degraded channel are dropped.
+func (m *Manager) deliverDurably(ctx context.Context, channel Channel, msg bus.OutboundMessage) error {
+	store := m.outboxStore()
+	if msg.Partial {
+		if err := m.deliverGuarded(ctx, channel, msg); err != errDegraded {
+			return err
+		}
+		return nil
+	}
+	if store == nil {
+		return m.deliverGuarded(ctx, channel, msg)
+	}
+
+	entry := outboxEntry{Message: msg, Queued: time.Now()}
+	// Keys sort in queue order
+	key := fmt.Sprintf("%020d-%06d", entry.Queued.UnixNano(), outboxSeq.Add(1)%1000000)
+	if err := state.PutJSON(ctx, store, outboxBucket, key, entry); err != nil {
+		logger.WarnCF("channels", "Failed to record outbound message in outbox",
+			map[string]interface{}{"channel": msg.Channel, "error": err.Error()})
+		return m.deliverGuarded(ctx, channel, msg)
+	}
+
+	if !m.holds(msg.Channel) {
+		logger.DebugCF("channels", "Left outbound message for channel holder",
+			map[string]interface{}{"channel": msg.Channel, "chat_id": msg.ChatID})
+		m.settleOutbox(store, key, entry, errStandby)
+		return nil
+	}
+
+	err := m.deliverGuarded(ctx, channel, msg)
+	m.settleOutbox(store, key, entry, err)
+	if err == errDegraded {
+		logger.DebugCF("channels", "Held outbound message for degraded channel",
+			map[string]interface{}{"channel": msg.Channel, "chat_id": msg.ChatID})
+		return nil
+	}
+	return err
+}
+
+// settleOutbox removes a delivered entry, or records a failed attempt and
+// drops the entry once it has run out of the attempts its channel's retry
+// policy allows. A send held back by the channel's circuit breaker is not
+// an attempt. With the policy's Collapse, a failed entry may be folded
+// into an older duplicate instead.
+func (m *Manager) settleOutbox(store state.Store, key string, entry outboxEntry, sendErr error) {
+	// Settle even when the send was cut short by shutdown
+	ctx := context.Background()
+	m.outboxMu.Lock()
+	defer m.outboxMu.Unlock()
+	refreshCollapsed(ctx, store, key, &entry)
+	if sendErr == nil {
+		if err := store.Delete(ctx, outboxBucket, key); err != nil {
+			logger.WarnCF("channels", "Failed to clear delivered message from outbox",
+				map[string]interface{}{"channel": entry.Message.Channel, "error": err.Error()})
+		}
+		for _, id := range entry.Duplicates {
+			m.updateDelivery(id, entry.Message.Channel, entry.Message.ChatID, DeliverySent, "")
+		}
+		return
+	}
+
+	entry.Held = sendErr == errDegraded
+	if !entry.Held {
+		entry.Attempts++
+	}
+	entry.LastError = sendErr.Error()
+	msg := entry.Message
+	policy := m.retryPolicy(msg.Channel)
+	if entry.Attempts >= policy.maxAttempts {
+		m.failDelivery(entry, entry.LastError)
+		logger.ErrorCF("channels", "Dropping undeliverable message",
+			map[string]interface{}{
+				"channel":  entry.Message.Channel,
+				"chat_id":  entry.Message.ChatID,
+				"attempts": entry.Attempts,
+				"error":    entry.LastError,
+			})
+		store.Delete(ctx, outboxBucket, key)
+		return
+	}
+	if policy.collapse && sendErr != errStandby && m.collapseOutbox(ctx, store, key, entry) {
+		return
+	}
+	if msg.ID != "" && sendErr != errStandby {
+		m.updateDelivery(msg.ID, msg.Channel, msg.ChatID, DeliveryQueued, entry.LastError)
+	}
+	if err := state.PutJSON(ctx, store, outboxBucket, key, entry); err != nil {
+		logger.WarnCF("channels", "Failed to update outbox entry",
+			map[string]interface{}{"channel": entry.Message.Channel, "error": err.Error()})
+	}
+}
+
+// RetryOutbox tries every message that has failed to send again now,
+// instead of waiting for the next scheduled retry.
+func (m *Manager) RetryOutbox(ctx context.Context) {
+	m.retryOutbox(ctx, time.Time{})
+}
+
+// OutboxLength returns how many messages wait in the outbox to be sent or
+// retried. It is 0 without a state store.
+func (m *Manager) OutboxLength(ctx context.Context) (int, error) {
+	store := m.outboxStore()
+	if store == nil {
+		return 0, nil
+	}
+	entries, err := store.List(ctx, outboxBucket)
+	return len(entries), err
+}
+
+// failDelivery publishes the failure of a message dropped from the outbox
+// and marks it failed, along with the duplicates folded into it.
+func (m *Manager) failDelivery(entry outboxEntry, reason string) {
+	msg := entry.Message
+	publishDeliveryFailed(msg, reason)
+	for _, id := range entry.deliveryIDs() {
+		m.updateDelivery(id, msg.Channel, msg.ChatID, DeliveryFailed, reason)
+	}
+}
+
+// runOutbox replays messages left in the outbox by a run before started,
+// then keeps retrying messages that fail to send, and pruning old delivery
+// records and drafts, until ctx is cancelled.
+func (m *Manager) runOutbox(ctx context.Context, started time.Time) {
+	m.retryOutbox(ctx, started)
+
+	ticker := time.NewTicker(outboxRetryInterval)
+	defer ticker.Stop()
+	prune := time.NewTicker(deliveryPruneInterval)
+	defer prune.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.retryOutbox(ctx, started)
+		case <-prune.C:
+			m.pruneDeliveries(ctx)
+			m.pruneDrafts(ctx)
+		}
+	}
+}
+
+// retryOutbox sends, in queue order, every entry that has failed before or
+// was queued before since (and so was in flight when an earlier run
+// stopped). Entries for disabled channels or older than their channel's
+// retry policy allows are dropped; entries for channels another instance holds are left to it.
+func (m *Manager) retryOutbox(ctx context.Context, since time.Time) {
+	store := m.outboxStore()
+	if store == nil {
+		return
+	}
+	// One pass at a time, so a RetryOutbox during a scheduled pass does not
+	// send the same entries again
+	m.retryMu.Lock()
+	defer m.retryMu.Unlock()
+	entries, err := store.List(ctx, outboxBucket)
+	if err != nil {
+		logger.WarnCF("channels", "Failed to read outbox", map[string]interface{}{"error": err.Error()})
+		return
+	}
+
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	replayed := 0
+	for _, key := range keys {
+		if ctx.Err() != nil {
+			return
+		}
+		var entry outboxEntry
+		if err := json.Unmarshal(entries[key], &entry); err != nil {
+			store.Delete(ctx, outboxBucket, key)
+			continue
+		}
+		if entry.Attempts == 0 && !entry.Held && !entry.Queued.Before(since) {
+			continue // Still being sent by the dispatcher
+		}
+
+		msg := entry.Message
+		if maxAge := m.retryPolicy(msg.Channel).maxAge; time.Since(entry.Queued) > maxAge {
+			m.failDelivery(entry, "not sent within "+maxAgeText(maxAge))
+			logger.WarnCF("channels", "Dropping stale outbox message",
+				map[string]interface{}{"channel": msg.Channel, "chat_id": msg.ChatID, "queued": entry.Queued})
+			store.Delete(ctx, outboxBucket, key)
+			continue
+		}
+		m.mu.RLock()
+		channel, exists := m.channels[msg.Channel]
+		m.mu.RUnlock()
+		if !exists {
+			m.failDelivery(entry, "channel is disabled")
+			logger.WarnCF("channels", "Dropping outbox message for disabled channel",
+				map[string]interface{}{"channel": msg.Channel, "chat_id": msg.ChatID})
+			store.Delete(ctx, outboxBucket, key)
+			continue
+		}
+		if !m.holds(msg.Channel) {
+			continue
+		}
+
+		err := m.deliverGuarded(ctx, channel, msg)
+		if err == errDegraded && entry.Held {
+			continue // Still waiting for a probe to succeed
+		}
+		m.settleOutbox(store, key, entry, err)
+		if err == nil {
+			replayed++
+		}
+	}
+
+	if replayed > 0 {
+		logger.InfoCF("channels", "Delivered messages from outbox", map[string]interface{}{"count": replayed})
+	}
+}
@@ -0,0 +1,216 @@
+package channels
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/leader"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+type flakyChannel struct {
+	*BaseChannel
+	fail bool
+	sent []string
+}
+
+func (c *flakyChannel) Start(ctx context.Context) error { return nil }
+func (c *flakyChannel) Stop(ctx context.Context) error  { return nil }
+
+func (c *flakyChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if c.fail {
+		return errors.New("network down")
+	}
+	c.sent = append(c.sent, msg.Content)
+	return nil
+}
+
+func outboxEntries(t *testing.T, store state.Store) map[string]outboxEntry {
+	t.Helper()
+	raw, err := store.List(context.Background(), outboxBucket)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	out := make(map[string]outboxEntry)
+	for key := range raw {
+		var e outboxEntry
+		if err := state.GetJSON(context.Background(), store, outboxBucket, key, &e); err != nil {
+			t.Fatalf("GetJSON() error = %v", err)
+		}
+		out[key] = e
+	}
+	return out
+}
+
+func TestDeliverDurably(t *testing.T) {
+	ch := &flakyChannel{BaseChannel: NewBaseChannel("telegram", nil, nil, nil)}
+	store := state.NewMemoryStore()
+	m := &Manager{channels: map[string]Channel{"telegram": ch}, chunker: newStreamChunker(), state: store}
+	ctx := context.Background()
+
+	if err := m.deliverDurably(ctx, ch, bus.OutboundMessage{Channel: "telegram", ChatID: "1", Content: "ok"}); err != nil {
+		t.Fatalf("deliverDurably() error = %v", err)
+	}
+	if n := len(outboxEntries(t, store)); n != 0 {
+		t.Errorf("outbox holds %d entries after a successful send", n)
+	}
+
+	ch.fail = true
+	if err := m.deliverDurably(ctx, ch, bus.OutboundMessage{Channel: "telegram", ChatID: "1", Content: "later"}); err == nil {
+		t.Fatal("deliverDurably() should report the send error")
+	}
+	entries := outboxEntries(t, store)
+	if len(entries) != 1 {
+		t.Fatalf("outbox holds %d entries, want the failed one", len(entries))
+	}
+	for _, e := range entries {
+		if e.Attempts != 1 || e.LastError != "network down" || e.Message.Content != "later" {
+			t.Errorf("entry = %+v", e)
+		}
+	}
+
+	// The next retry pass delivers it once the channel recovers
+	ch.fail = false
+	m.retryOutbox(ctx, time.Now())
+	if len(ch.sent) != 2 || ch.sent[1] != "later" {
+		t.Errorf("sent = %q, want the failed message retried", ch.sent)
+	}
+	if n := len(outboxEntries(t, store)); n != 0 {
+		t.Errorf("outbox holds %d entries after retry", n)
+	}
+}
+
+func TestRetryOutboxReplaysEarlierRun(t *testing.T) {
+	ch := &flakyChannel{BaseChannel: NewBaseChannel("telegram", nil, nil, nil)}
+	store := state.NewMemoryStore()
+	m := &Manager{channels: map[string]Channel{"telegram": ch}, chunker: newStreamChunker(), state: store}
+	ctx := context.Background()
+	started := time.Now()
+
+	put := func(key string, e outboxEntry) {
+		if err := state.PutJSON(ctx, store, outboxBucket, key, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	msg := func(channel, content string) bus.OutboundMessage {
+		return bus.OutboundMessage{Channel: channel, ChatID: "1", Content: content}
+	}
+	put("1", outboxEntry{Message: msg("telegram", "first"), Queued: started.Add(-2 * time.Minute)})
+	put("2", outboxEntry{Message: msg("telegram", "second"), Queued: started.Add(-time.Minute)})
+	put("3", outboxEntry{Message: msg("telegram", "in flight"), Queued: started.Add(time.Second)})
+	put("4", outboxEntry{Message: msg("discord", "disabled"), Queued: started.Add(-time.Minute)})
+	put("5", outboxEntry{Message: msg("telegram", "stale"), Queued: started.Add(-outboxMaxAge - time.Hour)})
+
+	m.retryOutbox(ctx, started)
+
+	if len(ch.sent) != 2 || ch.sent[0] != "first" || ch.sent[1] != "second" {
+		t.Errorf("sent = %q, want the earlier run's messages in order", ch.sent)
+	}
+	entries := outboxEntries(t, store)
+	if _, ok := entries["3"]; len(entries) != 1 || !ok {
+		t.Errorf("outbox = %+v, want only the in-flight message left", entries)
+	}
+}
+
+func TestRetryOutboxGivesUp(t *testing.T) {
+	ch := &flakyChannel{BaseChannel: NewBaseChannel("telegram", nil, nil, nil), fail: true}
+	store := state.NewMemoryStore()
+	m := &Manager{channels: map[string]Channel{"telegram": ch}, chunker: newStreamChunker(), state: store}
+	ctx := context.Background()
+
+	state.PutJSON(ctx, store, outboxBucket, "1", outboxEntry{
+		Message:  bus.OutboundMessage{Channel: "telegram", ChatID: "1", Content: "doomed"},
+		Queued:   time.Now(),
+		Attempts: outboxMaxAttempts - 1,
+	})
+	m.retryOutbox(ctx, time.Now())
+
+	if n := len(outboxEntries(t, store)); n != 0 {
+		t.Errorf("outbox holds %d entries, want the message dropped after %d attempts", n, outboxMaxAttempts)
+	}
+}
+
+// slowChannel counts sends, each taking a while, from any goroutine.
+type slowChannel struct {
+	*BaseChannel
+	mu   sync.Mutex
+	sent int
+}
+
+func (c *slowChannel) Start(ctx context.Context) error { return nil }
+func (c *slowChannel) Stop(ctx context.Context) error  { return nil }
+
+func (c *slowChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	time.Sleep(20 * time.Millisecond)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sent++
+	return nil
+}
+
+func TestConcurrentRetriesSendOnce(t *testing.T) {
+	ch := &slowChannel{BaseChannel: NewBaseChannel("telegram", nil, nil, nil)}
+	store := state.NewMemoryStore()
+	m := &Manager{channels: map[string]Channel{"telegram": ch}, chunker: newStreamChunker(), state: store}
+	ctx := context.Background()
+
+	for _, key := range []string{"1", "2"} {
+		state.PutJSON(ctx, store, outboxBucket, key, outboxEntry{
+			Message:  bus.OutboundMessage{Channel: "telegram", ChatID: "1", Content: "retry " + key},
+			Queued:   time.Now(),
+			Attempts: 1,
+		})
+	}
+
+	// A scheduled pass and a RetryOutbox call at the same time
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() { defer wg.Done(); m.retryOutbox(ctx, time.Now()) }()
+	go func() { defer wg.Done(); m.RetryOutbox(ctx) }()
+	wg.Wait()
+
+	if ch.sent != 2 {
+		t.Errorf("sent %d messages, want each pending message once", ch.sent)
+	}
+	if n := len(outboxEntries(t, store)); n != 0 {
+		t.Errorf("outbox holds %d entries after retry", n)
+	}
+}
+
+func TestOutboxHandsOffToChannelHolder(t *testing.T) {
+	store := state.NewMemoryStore()
+	ctx := context.Background()
+	// Another instance holds telegram
+	if held, err := store.Lease(ctx, "leader", channelRole("telegram"), "other", time.Minute); err != nil || !held {
+		t.Fatalf("Lease() = %v, %v", held, err)
+	}
+
+	ch := &flakyChannel{BaseChannel: NewBaseChannel("telegram", nil, nil, nil)}
+	elector := leader.NewElector(store, "self", time.Minute)
+	m := &Manager{channels: map[string]Channel{"telegram": ch}, chunker: newStreamChunker(), state: store, elector: elector}
+
+	if err := m.deliverDurably(ctx, ch, bus.OutboundMessage{Channel: "telegram", ChatID: "1", Content: "reminder"}); err != nil {
+		t.Fatalf("deliverDurably() error = %v", err)
+	}
+	m.retryOutbox(ctx, time.Now())
+	if len(ch.sent) != 0 {
+		t.Errorf("standby instance sent %q", ch.sent)
+	}
+	if got := m.ChannelStates()["telegram"]; got != "standby" {
+		t.Errorf("state = %q, want standby", got)
+	}
+
+	// The holder sends it on its next retry pass
+	holder := &Manager{channels: map[string]Channel{"telegram": ch}, chunker: newStreamChunker(), state: store}
+	holder.retryOutbox(ctx, time.Now())
+	if len(ch.sent) != 1 || ch.sent[0] != "reminder" {
+		t.Errorf("sent = %q, want the handed-off message", ch.sent)
+	}
+	if n := len(outboxEntries(t, store)); n != 0 {
+		t.Errorf("outbox holds %d entries after hand-off", n)
+	}
+}
@@ -0,0 +1,127 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package channels
+
+import (
+	"context"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/crash"
+)
+
+const (
+	// defaultInboundWorkers is how many chats' messages a channel prepares
+	// at once when the config does not say.
+	defaultInboundWorkers = 4
+	// inboundQueueSize bounds the messages waiting for a worker; a channel
+	// submitting more blocks until one is done.
+	inboundQueueSize = 256
+)
+
+// workerPool runs jobs on up to a fixed number of goroutines. Jobs with
+// the same key, such as a chat ID, run one at a time in the order they
+// were submitted; jobs for different keys run in parallel. Channels use it
+// to keep slow work, like downloading and transcribing a voice note, from
+// holding up other chats. Workers start on demand and exit when idle.
+type workerPool struct {
+	name    string        // Component for crash reports
+	workers int           // Most goroutines at once
+	slots   chan struct{} // One per job queued or running
+
+	mu      sync.Mutex
+	queues  map[string][]func() // Per key; the head is running or next
+	ready   []string            // Keys with a job no worker has taken
+	running int                 // Live workers
+	idle    chan struct{}       // Closed when no jobs are left
+}
+
+func newWorkerPool(name string, workers, size int) *workerPool {
+	if workers <= 0 {
+		workers = defaultInboundWorkers
+	}
+	idle := make(chan struct{})
+	close(idle)
+	return &workerPool{
+		name:    name,
+		workers: workers,
+		slots:   make(chan struct{}, size),
+		queues:  make(map[string][]func()),
+		idle:    idle,
+	}
+}
+
+// Submit queues job behind the earlier jobs for key. It blocks while the
+// pool is full.
+func (p *workerPool) Submit(key string, job func()) {
+	p.slots <- struct{}{}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.queues) == 0 {
+		p.idle = make(chan struct{})
+	}
+	queue, busy := p.queues[key]
+	p.queues[key] = append(queue, job)
+	if busy {
+		// The worker on key takes it when done with the one before
+		return
+	}
+	p.ready = append(p.ready, key)
+	if p.running < p.workers {
+		p.running++
+		go p.work()
+	}
+}
+
+func (p *workerPool) work() {
+	for {
+		p.mu.Lock()
+		if len(p.ready) == 0 {
+			p.running--
+			p.mu.Unlock()
+			return
+		}
+		key := p.ready[0]
+		p.ready = p.ready[1:]
+		job := p.queues[key][0]
+		p.mu.Unlock()
+
+		p.run(job)
+		<-p.slots
+
+		p.mu.Lock()
+		if queue := p.queues[key][1:]; len(queue) > 0 {
+			// Back of the line, so one busy chat cannot hog a worker
+			p.queues[key] = queue
+			p.ready = append(p.ready, key)
+		} else {
+			delete(p.queues, key)
+			if len(p.queues) == 0 {
+				close(p.idle)
+			}
+		}
+		p.mu.Unlock()
+	}
+}
+
+func (p *workerPool) run(job func()) {
+	defer crash.Recover(p.name, nil)
+	job()
+}
+
+// Wait blocks until every submitted job has run, or ctx is done.
+func (p *workerPool) Wait(ctx context.Context) error {
+	p.mu.Lock()
+	idle := p.idle
+	p.mu.Unlock()
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,106 @@
+package channels
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWorkerPoolOrdersEachKey(t *testing.T) {
+	p := newWorkerPool("test", 3, 64)
+	var mu sync.Mutex
+	got := map[string][]int{}
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprint("chat", i%3)
+		i := i
+		p.Submit(key, func() {
+			// Later jobs are quicker, so only ordering keeps them in line
+			time.Sleep(time.Duration(20-i) * 100 * time.Microsecond)
+			mu.Lock()
+			got[key] = append(got[key], i)
+			mu.Unlock()
+		})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := p.Wait(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for key, seq := range got {
+		for j := 1; j < len(seq); j++ {
+			if seq[j] < seq[j-1] {
+				t.Errorf("%s ran out of order: %v", key, seq)
+				break
+			}
+		}
+	}
+	if len(got["chat0"])+len(got["chat1"])+len(got["chat2"]) != 20 {
+		t.Errorf("ran %v", got)
+	}
+}
+
+func TestWorkerPoolSlowKeyDoesNotBlockOthers(t *testing.T) {
+	p := newWorkerPool("test", 2, 64)
+	release := make(chan struct{})
+	p.Submit("voice", func() { <-release })
+	p.Submit("voice", func() {})
+
+	done := make(chan struct{})
+	p.Submit("text", func() { close(done) })
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("a slow chat held up another chat")
+	}
+
+	short, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.Wait(short); err == nil {
+		t.Error("Wait() returned while a job was still running")
+	}
+	close(release)
+	if err := p.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWorkerPoolBoundsQueue(t *testing.T) {
+	p := newWorkerPool("test", 1, 2)
+	release := make(chan struct{})
+	p.Submit("a", func() { <-release })
+	p.Submit("b", func() {})
+
+	submitted := make(chan struct{})
+	go func() {
+		p.Submit("c", func() {})
+		close(submitted)
+	}()
+	select {
+	case <-submitted:
+		t.Fatal("Submit() did not block on a full pool")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	select {
+	case <-submitted:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Submit() stayed blocked after room was made")
+	}
+	if err := p.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWorkerPoolSurvivesPanics(t *testing.T) {
+	p := newWorkerPool("test", 1, 8)
+	ran := make(chan struct{})
+	p.Submit("chat", func() { panic("bad message") })
+	p.Submit("chat", func() { close(ran) })
+	select {
+	case <-ran:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the job after a panic never ran")
+	}
+}
@@ -0,0 +1,179 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/crash"
+	"github.com/sipeed/picoclaw/pkg/i18n"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+// presenceBucket holds presence watches by "channel:user_id", so they
+// survive restarts.
+const presenceBucket = "presence"
+
+// presenceWatches holds the users being watched and whether each was last
+// seen online.
+type presenceWatches struct {
+	mu      sync.Mutex
+	watches map[string]bus.PresenceWatch
+	online  map[string]bool
+}
+
+func presenceKey(channel, userID string) string {
+	return channel + ":" + userID
+}
+
+// SubscribePresence starts watching a user on a channel that supports it,
+// see PresenceChannel, and returns the watch with the user's ID as the
+// channel normalizes it. Watching a user again replaces the watch.
+func (m *Manager) SubscribePresence(ctx context.Context, w bus.PresenceWatch) (bus.PresenceWatch, error) {
+	channel, ok := m.GetChannel(w.Channel)
+	if !ok {
+		return w, fmt.Errorf("channel %s is not enabled", w.Channel)
+	}
+	pc, ok := channel.(PresenceChannel)
+	if !ok {
+		return w, fmt.Errorf("channel %s does not report presence", w.Channel)
+	}
+	userID, err := pc.SubscribePresence(ctx, w.UserID)
+	if err != nil {
+		return w, err
+	}
+	w.UserID = userID
+
+	key := presenceKey(w.Channel, w.UserID)
+	m.presence.mu.Lock()
+	if m.presence.watches == nil {
+		m.presence.watches = make(map[string]bus.PresenceWatch)
+		m.presence.online = make(map[string]bool)
+	}
+	m.presence.watches[key] = w
+	m.presence.mu.Unlock()
+
+	if store := m.outboxStore(); store != nil {
+		if err := state.PutJSON(ctx, store, presenceBucket, key, w); err != nil {
+			return w, fmt.Errorf("failed to save presence watch: %w", err)
+		}
+	}
+	logger.InfoCF("channels", "Watching presence", map[string]interface{}{
+		"channel": w.Channel,
+		"user_id": w.UserID,
+	})
+	return w, nil
+}
+
+// UnsubscribePresence stops watching a user. userID is as SubscribePresence
+// returned it.
+func (m *Manager) UnsubscribePresence(ctx context.Context, channelName, userID string) error {
+	key := presenceKey(channelName, userID)
+	m.presence.mu.Lock()
+	_, watched := m.presence.watches[key]
+	delete(m.presence.watches, key)
+	delete(m.presence.online, key)
+	m.presence.mu.Unlock()
+	if !watched {
+		return fmt.Errorf("%s is not watched on %s", userID, channelName)
+	}
+
+	if channel, ok := m.GetChannel(channelName); ok {
+		if pc, ok := channel.(PresenceChannel); ok {
+			if err := pc.UnsubscribePresence(ctx, userID); err != nil {
+				return err
+			}
+		}
+	}
+	if store := m.outboxStore(); store != nil {
+		if err := store.Delete(ctx, presenceBucket, key); err != nil {
+			return fmt.Errorf("failed to remove presence watch: %w", err)
+		}
+	}
+	return nil
+}
+
+// PresenceWatches returns the users being watched, by channel and user.
+func (m *Manager) PresenceWatches() []bus.PresenceWatch {
+	m.presence.mu.Lock()
+	watches := make([]bus.PresenceWatch, 0, len(m.presence.watches))
+	for _, w := range m.presence.watches {
+		watches = append(watches, w)
+	}
+	m.presence.mu.Unlock()
+	sort.Slice(watches, func(i, j int) bool {
+		return presenceKey(watches[i].Channel, watches[i].UserID) < presenceKey(watches[j].Channel, watches[j].UserID)
+	})
+	return watches
+}
+
+// restorePresence subscribes again to the watches saved by earlier runs.
+// Watches for channels no longer enabled are kept for when they are.
+func (m *Manager) restorePresence(ctx context.Context) {
+	store := m.outboxStore()
+	if store == nil {
+		return
+	}
+	entries, err := store.List(ctx, presenceBucket)
+	if err != nil {
+		logger.WarnCF("channels", "Failed to read presence watches", map[string]interface{}{"error": err.Error()})
+		return
+	}
+	for key, data := range entries {
+		var w bus.PresenceWatch
+		if err := json.Unmarshal(data, &w); err != nil {
+			store.Delete(ctx, presenceBucket, key)
+			continue
+		}
+		if _, ok := m.GetChannel(w.Channel); !ok {
+			continue
+		}
+		if _, err := m.SubscribePresence(ctx, w); err != nil {
+			logger.WarnCF("channels", "Failed to restore presence watch", map[string]interface{}{
+				"channel": w.Channel,
+				"user_id": w.UserID,
+				"error":   err.Error(),
+			})
+		}
+	}
+}
+
+// handlePresence tells a watch's notify chat when its user comes online.
+// The first update for a user after starting counts as coming online.
+func (m *Manager) handlePresence(p bus.Presence) {
+	key := presenceKey(p.Channel, p.UserID)
+	m.presence.mu.Lock()
+	w, watched := m.presence.watches[key]
+	wasOnline := m.presence.online[key]
+	if watched {
+		m.presence.online[key] = p.Online
+	}
+	m.presence.mu.Unlock()
+	if !watched || !p.Online || wasOnline || w.NotifyChannel == "" || w.NotifyChatID == "" {
+		return
+	}
+
+	name := w.Name
+	if name == "" {
+		name = w.UserID
+	}
+	go func() {
+		defer crash.Recover("channels.presence", nil)
+		m.bus.PublishOutbound(bus.OutboundMessage{
+			Channel:  w.NotifyChannel,
+			ChatID:   w.NotifyChatID,
+			Content:  i18n.T(w.NotifyChannel, w.NotifyChatID, "presence.online", name),
+			Priority: bus.PriorityLow,
+		})
+	}()
+}
@@ -0,0 +1,83 @@
+package channels
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+// watchingChannel reports presence for the users subscribed to.
+type watchingChannel struct {
+	flakyChannel
+	watched map[string]bool
+}
+
+func (c *watchingChannel) SubscribePresence(_ context.Context, userID string) (string, error) {
+	if !strings.Contains(userID, "@") {
+		userID = strings.TrimPrefix(userID, "+") + "@s.whatsapp.net"
+	}
+	c.watched[userID] = true
+	return userID, nil
+}
+
+func (c *watchingChannel) UnsubscribePresence(_ context.Context, userID string) error {
+	delete(c.watched, userID)
+	return nil
+}
+
+func TestPresenceWatch(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	ch := &watchingChannel{flakyChannel{BaseChannel: NewBaseChannel("whatsapp", nil, msgBus, nil)}, map[string]bool{}}
+	store := state.NewMemoryStore()
+	m := &Manager{channels: map[string]Channel{"whatsapp": ch}, bus: msgBus, state: store}
+	msgBus.OnPresence(m.handlePresence)
+	ctx := context.Background()
+
+	w, err := m.SubscribePresence(ctx, bus.PresenceWatch{Channel: "whatsapp", UserID: "+4915", Name: "Dad",
+		NotifyChannel: "telegram", NotifyChatID: "42"})
+	if err != nil || w.UserID != "4915@s.whatsapp.net" || !ch.watched[w.UserID] {
+		t.Fatalf("SubscribePresence() = %+v, %v", w, err)
+	}
+	if _, err := m.SubscribePresence(ctx, bus.PresenceWatch{Channel: "discord", UserID: "1"}); err == nil {
+		t.Error("SubscribePresence() on a disabled channel should fail")
+	}
+
+	// Only coming online is announced, once
+	for _, online := range []bool{true, true, false, true} {
+		msgBus.PublishPresence(bus.Presence{Channel: "whatsapp", UserID: w.UserID, Online: online})
+	}
+	msgBus.PublishPresence(bus.Presence{Channel: "whatsapp", UserID: "99@s.whatsapp.net", Online: true})
+	for i := 0; i < 2; i++ {
+		sctx, cancel := context.WithTimeout(ctx, time.Second)
+		msg, ok := msgBus.SubscribeOutbound(sctx)
+		cancel()
+		if !ok || msg.Channel != "telegram" || msg.ChatID != "42" || !strings.Contains(msg.Content, "Dad") {
+			t.Fatalf("notification %d = %+v, %v", i, msg, ok)
+		}
+	}
+	if msg, ok := msgBus.TryConsumeOutbound(); ok {
+		t.Errorf("unexpected notification %+v", msg)
+	}
+
+	// A restarted manager picks the watch up from the store
+	ch2 := &watchingChannel{flakyChannel{BaseChannel: NewBaseChannel("whatsapp", nil, msgBus, nil)}, map[string]bool{}}
+	m2 := &Manager{channels: map[string]Channel{"whatsapp": ch2}, bus: msgBus, state: store}
+	m2.restorePresence(ctx)
+	if got := m2.PresenceWatches(); len(got) != 1 || got[0] != w || !ch2.watched[w.UserID] {
+		t.Errorf("restored watches = %+v, subscribed %v", got, ch2.watched)
+	}
+
+	if err := m.UnsubscribePresence(ctx, "whatsapp", w.UserID); err != nil || ch.watched[w.UserID] {
+		t.Fatalf("UnsubscribePresence() = %v, watched %v", err, ch.watched)
+	}
+	if err := m.UnsubscribePresence(ctx, "whatsapp", w.UserID); err == nil {
+		t.Error("UnsubscribePresence() of an unwatched user should fail")
+	}
+	if entries, _ := store.List(ctx, presenceBucket); len(entries) != 0 {
+		t.Errorf("store still holds %d watches", len(entries))
+	}
+}
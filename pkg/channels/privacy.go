@@ -0,0 +1,166 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package channels
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/commands"
+	"github.com/sipeed/picoclaw/pkg/i18n"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+// privacyBucket holds how voice notes may be transcribed, by
+// "channel:sender:id" for a sender and "channel:chat:id" for a chat.
+const privacyBucket = "voice_privacy"
+
+// Voice transcription modes, from least to most private.
+const (
+	// VoiceCloud sends voice notes to the transcription provider. It is
+	// the default.
+	VoiceCloud = "cloud"
+	// VoiceLocal allows transcription on this machine only. No local
+	// transcriber exists yet, so such voice notes stay untranscribed.
+	VoiceLocal = "local"
+	// VoiceOff leaves voice notes untranscribed.
+	VoiceOff = "off"
+)
+
+var voiceStrictness = map[string]int{VoiceCloud: 0, VoiceLocal: 1, VoiceOff: 2}
+
+// privacyKey keys a sender's setting by bus.NormalizeUserID, so it holds
+// for all of a WhatsApp account's devices, and a chat's by the chat
+// without its thread.
+func privacyKey(channel, scope, id string) string {
+	if scope == "sender" {
+		id = bus.NormalizeUserID(id)
+	} else {
+		id, _, _ = strings.Cut(id, "/")
+	}
+	return channel + ":" + scope + ":" + id
+}
+
+// voicePrivacy returns the mode set for a sender or chat (scope "sender"
+// or "chat"), or VoiceCloud when none is.
+func voicePrivacy(ctx context.Context, store state.Store, channel, scope, id string) (string, error) {
+	data, err := store.Get(ctx, privacyBucket, privacyKey(channel, scope, id))
+	if errors.Is(err, state.ErrNotFound) {
+		return VoiceCloud, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// mayTranscribe reports whether a voice note from senderID in chatID may
+// go to the transcription provider. The stricter of the sender's and the
+// chat's /privacy settings applies. Without a state store nothing is
+// restricted; when the settings cannot be read, nothing is sent.
+func (c *BaseChannel) mayTranscribe(senderID, chatID string) bool {
+	if c.state == nil {
+		return true
+	}
+	ctx := context.Background()
+	mode := VoiceCloud
+	for scope, id := range map[string]string{"sender": senderID, "chat": chatID} {
+		m, err := voicePrivacy(ctx, c.state, c.name, scope, id)
+		if err != nil {
+			logger.WarnCF("channels", "Failed to read voice privacy, not transcribing", map[string]interface{}{
+				"channel": c.name,
+				"error":   err.Error(),
+			})
+			return false
+		}
+		if voiceStrictness[m] > voiceStrictness[mode] {
+			mode = m
+		}
+	}
+	if mode == VoiceCloud {
+		return true
+	}
+	logger.DebugCF("channels", "Not transcribing voice note", map[string]interface{}{
+		"channel": c.name,
+		"chat_id": chatID,
+		"mode":    mode,
+	})
+	return false
+}
+
+// SetVoicePrivacy sets how voice notes from a sender, or in a chat (scope
+// "sender" or "chat"), may be transcribed.
+func (m *Manager) SetVoicePrivacy(ctx context.Context, channel, scope, id, mode string) error {
+	store := m.outboxStore()
+	if store == nil {
+		return errors.New("no state store")
+	}
+	if mode == VoiceCloud {
+		return store.Delete(ctx, privacyBucket, privacyKey(channel, scope, id))
+	}
+	return store.Put(ctx, privacyBucket, privacyKey(channel, scope, id), []byte(mode))
+}
+
+// Commands implements commands.Provider, letting users keep their voice
+// notes, or a chat's, away from the transcription provider, and manage the
+// chat's notification digest.
+func (m *Manager) Commands() []commands.Command {
+	return []commands.Command{{
+		Name:        "privacy",
+		Usage:       "[chat] cloud|local|off",
+		Description: "Choose whether your voice notes are transcribed",
+		Handler:     m.privacyCommand,
+	}, {
+		Name:        "digest",
+		Usage:       "[now|on|off]",
+		Description: "Get minor notifications in a digest, or at once",
+		Handler:     m.digestCommand,
+	}}
+}
+
+func (m *Manager) privacyCommand(ctx context.Context, req commands.Request) string {
+	msg := req.Msg
+	t := func(key string, args ...interface{}) string { return i18n.T(msg.Channel, msg.ChatID, key, args...) }
+	store := m.outboxStore()
+	if store == nil {
+		return t("privacy.failed")
+	}
+
+	args := req.Args
+	scope, id := "sender", bus.SenderUserID(msg)
+	if len(args) > 0 && strings.EqualFold(args[0], "chat") {
+		scope, id = "chat", msg.ChatID
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		own, err1 := voicePrivacy(ctx, store, msg.Channel, "sender", bus.SenderUserID(msg))
+		chat, err2 := voicePrivacy(ctx, store, msg.Channel, "chat", msg.ChatID)
+		if err1 != nil || err2 != nil {
+			return t("privacy.failed")
+		}
+		return t("privacy.status", t("privacy.mode_"+own), t("privacy.mode_"+chat))
+	}
+
+	mode := strings.ToLower(args[0])
+	if _, ok := voiceStrictness[mode]; !ok || len(args) > 1 {
+		return t("privacy.usage")
+	}
+	if err := m.SetVoicePrivacy(ctx, msg.Channel, scope, id, mode); err != nil {
+		logger.WarnCF("channels", "Failed to change voice privacy", map[string]interface{}{
+			"channel": msg.Channel,
+			"error":   err.Error(),
+		})
+		return t("privacy.failed")
+	}
+	if scope == "chat" {
+		return t("privacy.set_chat", t("privacy.mode_"+mode))
+	}
+	return t("privacy.set", t("privacy.mode_"+mode))
+}
@@ -0,0 +1,74 @@
+package channels
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/commands"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+func TestMayTranscribe(t *testing.T) {
+	store := state.NewMemoryStore()
+	m := &Manager{state: store}
+	c := NewBaseChannel("whatsapp", nil, nil, nil)
+	c.SetStateStore(store)
+	ctx := context.Background()
+
+	if !c.mayTranscribe("49|alice", "g1") {
+		t.Fatal("voice notes should be transcribed by default")
+	}
+
+	if err := m.SetVoicePrivacy(ctx, "whatsapp", "sender", "49", VoiceOff); err != nil {
+		t.Fatalf("SetVoicePrivacy() error = %v", err)
+	}
+	if c.mayTranscribe("49|alice", "g1") {
+		t.Error("sender opted out, but voice note would be transcribed")
+	}
+	if !c.mayTranscribe("50", "g1") {
+		t.Error("another sender's voice note should still be transcribed")
+	}
+
+	if err := m.SetVoicePrivacy(ctx, "whatsapp", "chat", "g1", VoiceLocal); err != nil {
+		t.Fatalf("SetVoicePrivacy() error = %v", err)
+	}
+	if c.mayTranscribe("50", "g1") {
+		t.Error("chat is local-only, but voice note would be transcribed")
+	}
+
+	// Going back to cloud clears the sender's setting; the chat's still holds.
+	if err := m.SetVoicePrivacy(ctx, "whatsapp", "sender", "49", VoiceCloud); err != nil {
+		t.Fatalf("SetVoicePrivacy() error = %v", err)
+	}
+	if mode, _ := voicePrivacy(ctx, store, "whatsapp", "sender", "49"); mode != VoiceCloud {
+		t.Errorf("sender mode = %q, want %q", mode, VoiceCloud)
+	}
+	if c.mayTranscribe("49", "g1") {
+		t.Error("chat setting should still apply")
+	}
+}
+
+func TestVoicePrivacyAcrossWhatsAppDevices(t *testing.T) {
+	store := state.NewMemoryStore()
+	m := &Manager{state: store}
+	c := NewBaseChannel("whatsapp", nil, nil, nil)
+	c.SetStateStore(store)
+	ctx := context.Background()
+
+	// Set from a linked device, by a sender known by their LID
+	reply := m.privacyCommand(ctx, commands.Request{
+		Msg: bus.InboundMessage{Channel: "whatsapp", SenderID: "8877:3@lid", ChatID: "8877:3@lid",
+			Metadata: map[string]string{"sender_pn": "4915:3@s.whatsapp.net"}},
+		Name: "privacy",
+		Args: []string{"off"},
+	})
+	if reply == "" {
+		t.Fatal("no reply to /privacy off")
+	}
+	for _, sender := range []string{"4915@s.whatsapp.net", "4915:12@s.whatsapp.net"} {
+		if c.mayTranscribe(sender, "g1") {
+			t.Errorf("voice note from %s would be transcribed", sender)
+		}
+	}
+}
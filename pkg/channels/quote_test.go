@@ -0,0 +1,58 @@
+package channels
+
+import (
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/mymmrac/telego"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+func TestQuotes(t *testing.T) {
+	reply := &telego.Message{MessageID: 5, Text: "Guten Morgen", From: &telego.User{ID: 7}}
+	tests := []struct {
+		name string
+		got  *bus.Quote
+		want *bus.Quote
+	}{
+		{"telegram reply", telegramQuote(&telego.Message{ReplyToMessage: reply}),
+			&bus.Quote{MessageID: "5", SenderID: "7", Content: "Guten Morgen"}},
+		{"telegram partial quote", telegramQuote(&telego.Message{ReplyToMessage: reply, Quote: &telego.TextQuote{Text: "Morgen"}}),
+			&bus.Quote{MessageID: "5", SenderID: "7", Content: "Morgen"}},
+		{"telegram photo caption", telegramQuote(&telego.Message{ReplyToMessage: &telego.Message{MessageID: 6, Caption: "receipt"}}),
+			&bus.Quote{MessageID: "6", Content: "receipt"}},
+		{"telegram topic message", telegramQuote(&telego.Message{ReplyToMessage: &telego.Message{MessageID: 1, ForumTopicCreated: &telego.ForumTopicCreated{}}}),
+			nil},
+		{"telegram plain", telegramQuote(&telego.Message{Text: "hi"}), nil},
+		{"discord reply", discordQuote(&discordgo.Message{
+			Type:              discordgo.MessageTypeReply,
+			MessageReference:  &discordgo.MessageReference{MessageID: "m1"},
+			ReferencedMessage: &discordgo.Message{Content: "ciao", Author: &discordgo.User{ID: "u2"}},
+		}), &bus.Quote{MessageID: "m1", SenderID: "u2", Content: "ciao"}},
+		{"discord deleted original", discordQuote(&discordgo.Message{
+			Type:             discordgo.MessageTypeReply,
+			MessageReference: &discordgo.MessageReference{MessageID: "m1"},
+		}), &bus.Quote{MessageID: "m1"}},
+		{"discord plain", discordQuote(&discordgo.Message{Type: discordgo.MessageTypeDefault}), nil},
+		{"whatsapp reply", whatsappQuote(&waE2E.Message{ExtendedTextMessage: &waE2E.ExtendedTextMessage{
+			Text: strPtr("translate this"),
+			ContextInfo: &waE2E.ContextInfo{
+				StanzaID:      strPtr("ABC"),
+				Participant:   strPtr("123@s.whatsapp.net"),
+				QuotedMessage: &waE2E.Message{Conversation: strPtr("hola")},
+			},
+		}}), &bus.Quote{MessageID: "ABC", SenderID: "123@s.whatsapp.net", Content: "hola"}},
+		{"whatsapp plain", whatsappQuote(&waE2E.Message{Conversation: strPtr("hi")}), nil},
+		{"whatsapp bridge reply", bridgeQuote(map[string]interface{}{
+			"reply_to": map[string]interface{}{"id": "ABC", "from": "123@s.whatsapp.net", "content": "hola"},
+		}), &bus.Quote{MessageID: "ABC", SenderID: "123@s.whatsapp.net", Content: "hola"}},
+		{"whatsapp bridge plain", bridgeQuote(map[string]interface{}{"content": "hi"}), nil},
+	}
+	for _, tt := range tests {
+		if (tt.got == nil) != (tt.want == nil) || tt.got != nil && *tt.got != *tt.want {
+			t.Errorf("%s: quote = %+v, want %+v", tt.name, tt.got, tt.want)
+		}
+	}
+}
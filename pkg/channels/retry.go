@@ -0,0 +1,194 @@
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+// retryPolicy is how a channel's failed sends are retried, see
+// config.RetryConfig.
+type retryPolicy struct {
+	maxAttempts int
+	maxAge      time.Duration
+	collapse    bool
+}
+
+func (m *Manager) retryPolicy(name string) retryPolicy {
+	p := retryPolicy{maxAttempts: outboxMaxAttempts, maxAge: outboxMaxAge}
+	if m.config == nil {
+		return p
+	}
+	var c config.RetryConfig
+	switch name {
+	case "telegram":
+		c = m.config.Channels.Telegram.Retry
+	case "discord":
+		c = m.config.Channels.Discord.Retry
+	case "slack":
+		c = m.config.Channels.Slack.Retry
+	case "zulip":
+		c = m.config.Channels.Zulip.Retry
+	case "signal":
+		c = m.config.Channels.Signal.Retry
+	case "twilio":
+		c = m.config.Channels.Twilio.Retry
+	case "mqtt":
+		c = m.config.Channels.MQTT.Retry
+	case "whatsapp":
+		c = m.config.Channels.WhatsApp.Retry
+	}
+	if c.MaxAttempts > 0 {
+		p.maxAttempts = c.MaxAttempts
+	}
+	if c.MaxAge > 0 {
+		p.maxAge = time.Duration(c.MaxAge) * time.Minute
+	}
+	p.collapse = c.Collapse
+	return p
+}
+
+// PendingMessage is a message waiting in the outbox, see Manager.Pending.
+type PendingMessage struct {
+	Key       string    `json:"key"`
+	ID        string    `json:"id,omitempty"` // Delivery ID of a tracked message
+	ChatID    string    `json:"chat_id"`
+	Content   string    `json:"content,omitempty"`
+	Queued    time.Time `json:"queued"`
+	Expires   time.Time `json:"expires"` // When it is given up on unless sent
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error,omitempty"`
+	Held      bool      `json:"held,omitempty"`      // Waiting for the channel's circuit breaker
+	Collapsed int       `json:"collapsed,omitempty"` // Duplicates folded into it
+}
+
+// Pending lists the messages waiting in the outbox by channel, oldest
+// first. It is empty without a state store.
+func (m *Manager) Pending(ctx context.Context) (map[string][]PendingMessage, error) {
+	pending := make(map[string][]PendingMessage)
+	store := m.outboxStore()
+	if store == nil {
+		return pending, nil
+	}
+	entries, err := store.List(ctx, outboxBucket)
+	if err != nil {
+		return nil, err
+	}
+	for key, raw := range entries {
+		var entry outboxEntry
+		if json.Unmarshal(raw, &entry) != nil {
+			continue
+		}
+		msg := entry.Message
+		pending[msg.Channel] = append(pending[msg.Channel], PendingMessage{
+			Key:       key,
+			ID:        msg.ID,
+			ChatID:    msg.ChatID,
+			Content:   msg.Content,
+			Queued:    entry.Queued,
+			Expires:   entry.Queued.Add(m.retryPolicy(msg.Channel).maxAge),
+			Attempts:  entry.Attempts,
+			LastError: entry.LastError,
+			Held:      entry.Held,
+			Collapsed: entry.Collapsed,
+		})
+	}
+	for _, list := range pending {
+		// Keys sort in queue order
+		sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	}
+	return pending, nil
+}
+
+// collapsible reports whether msg is a plain notification that a copy
+// waiting in the outbox can stand in for.
+func collapsible(msg bus.OutboundMessage) bool {
+	return msg.Reaction == nil && len(msg.Media) == 0 && len(msg.Buttons) == 0 &&
+		len(msg.QuickReplies) == 0 && msg.Menu == nil && msg.Content != ""
+}
+
+// collapseOutbox folds entry, which just failed, into an older entry
+// waiting to be retried with the same text for the same chat, reporting
+// whether it did. The older entry takes on entry's delivery ID, so both
+// are marked when it is sent or given up on. Callers hold m.outboxMu.
+func (m *Manager) collapseOutbox(ctx context.Context, store state.Store, key string, entry outboxEntry) bool {
+	msg := entry.Message
+	if !collapsible(msg) {
+		return false
+	}
+	entries, err := store.List(ctx, outboxBucket)
+	if err != nil {
+		return false
+	}
+	keys := make([]string, 0, len(entries))
+	for k := range entries {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if k >= key {
+			break
+		}
+		var older outboxEntry
+		if json.Unmarshal(entries[k], &older) != nil || (older.Attempts == 0 && !older.Held) {
+			continue
+		}
+		o := older.Message
+		if o.Channel != msg.Channel || o.ChatID != msg.ChatID || o.ThreadID != msg.ThreadID ||
+			o.Content != msg.Content || !collapsible(o) {
+			continue
+		}
+		older.Collapsed += 1 + entry.Collapsed
+		older.Duplicates = append(older.Duplicates, entry.deliveryIDs()...)
+		if err := state.PutJSON(ctx, store, outboxBucket, k, older); err != nil {
+			return false
+		}
+		store.Delete(ctx, outboxBucket, key)
+		for _, id := range entry.deliveryIDs() {
+			m.updateDelivery(id, msg.Channel, msg.ChatID, DeliveryQueued, entry.LastError)
+		}
+		logger.DebugCF("channels", "Collapsed duplicate outbound message", map[string]interface{}{
+			"channel":   msg.Channel,
+			"chat_id":   msg.ChatID,
+			"collapsed": older.Collapsed,
+		})
+		return true
+	}
+	return false
+}
+
+// deliveryIDs are the tracked messages the entry stands for: its own and
+// those of duplicates folded into it.
+func (e outboxEntry) deliveryIDs() []string {
+	ids := slices.Clone(e.Duplicates)
+	if e.Message.ID != "" {
+		ids = append([]string{e.Message.ID}, ids...)
+	}
+	return ids
+}
+
+// refreshCollapsed picks up the duplicates folded into the entry stored
+// under key since entry was read, e.g. while it was being sent.
+func refreshCollapsed(ctx context.Context, store state.Store, key string, entry *outboxEntry) {
+	var stored outboxEntry
+	if err := state.GetJSON(ctx, store, outboxBucket, key, &stored); err == nil {
+		entry.Collapsed, entry.Duplicates = stored.Collapsed, stored.Duplicates
+	}
+}
+
+// maxAgeText is a retry policy's maximum age for a failure reason, e.g.
+// "24 hours".
+func maxAgeText(d time.Duration) string {
+	if d%time.Hour == 0 {
+		return fmt.Sprintf("%d hours", d/time.Hour)
+	}
+	return fmt.Sprintf("%d minutes", d/time.Minute)
+}
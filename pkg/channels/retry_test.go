@@ -0,0 +1,70 @@
+package channels
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Gateway.CircuitBreaker.Enabled = false
+	cfg.Channels.Telegram.Retry = config.RetryConfig{MaxAttempts: 2, MaxAge: 60, Collapse: true}
+	ch := &flakyChannel{BaseChannel: NewBaseChannel("telegram", nil, nil, nil), fail: true}
+	store := state.NewMemoryStore()
+	m := &Manager{channels: map[string]Channel{"telegram": ch}, chunker: newStreamChunker(), state: store, config: cfg}
+	ctx := context.Background()
+	send := func(id, content string) {
+		m.deliverDurably(ctx, ch, bus.OutboundMessage{ID: id, Channel: "telegram", ChatID: "1", Content: content})
+	}
+	status := func(id string) string {
+		d, _, err := m.Delivery(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d.Status
+	}
+
+	// The same notification failing twice waits in the outbox once
+	send("a", "disk full")
+	send("b", "disk full")
+	send("", "other")
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := pending["telegram"]
+	if len(list) != 2 || list[0].ID != "a" || list[0].Collapsed != 1 || list[1].Content != "other" {
+		t.Fatalf("pending = %+v", list)
+	}
+	if got := list[0].Expires.Sub(list[0].Queued); got != time.Hour {
+		t.Errorf("expires after %v, want the channel's max age", got)
+	}
+	if got := status("b"); got != DeliveryQueued {
+		t.Errorf("collapsed message is %q, want queued", got)
+	}
+
+	ch.fail = false
+	m.retryOutbox(ctx, time.Now())
+	if len(ch.sent) != 2 || ch.sent[0] != "disk full" {
+		t.Errorf("sent = %q, want the notification once", ch.sent)
+	}
+	if got := status("b"); got != DeliverySent {
+		t.Errorf("collapsed message is %q after its copy was sent, want sent", got)
+	}
+
+	// The channel's attempt limit applies
+	ch.fail = true
+	send("c", "backup failed")
+	m.retryOutbox(ctx, time.Now())
+	if n := len(outboxEntries(t, store)); n != 0 {
+		t.Errorf("outbox holds %d entries after 2 attempts", n)
+	}
+	if got := status("c"); got != DeliveryFailed {
+		t.Errorf("message is %q after 2 attempts, want failed", got)
+	}
+}
@@ -0,0 +1,781 @@
+package channels
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf16"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/i18n"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/render"
+	"github.com/sipeed/picoclaw/pkg/utils"
+	"github.com/sipeed/picoclaw/pkg/voice"
+)
+
+// Signal chats are direct conversations and groups. A direct chat's ID is
+// the other party's phone number, or their account UUID when they hide
+// it; a group's is "group:" followed by the group ID in URL-safe base64,
+// so it holds no "/".
+const signalGroupPrefix = "group:"
+
+const (
+	// signalMessageLimit is the longest text Signal shows without a
+	// "Read more", and signalAttachmentLimit its largest attachment.
+	signalMessageLimit    = 2000
+	signalAttachmentLimit = 100 << 20
+	// signalResponseLimit caps a JSON-RPC response, which holds a whole
+	// attachment in base64 for getAttachment.
+	signalResponseLimit = signalAttachmentLimit*4/3 + 1<<20
+	// maxSignalAuthors is how many messages' senders are remembered, for
+	// reacting to messages in groups.
+	maxSignalAuthors = 1000
+)
+
+// signalMentionMark is the character Signal puts in a message's text where
+// someone is mentioned; the message's mentions say who.
+const signalMentionMark = "\uFFFC"
+
+type SignalChannel struct {
+	*BaseChannel
+	config      config.SignalConfig
+	url         string
+	client      *http.Client
+	transcriber *voice.GroqTranscriber
+	ctx         context.Context
+	cancel      context.CancelFunc
+	connected   atomic.Bool
+	rpcID       atomic.Int64
+
+	mu sync.Mutex
+	// account is the bot's phone number, from the config or else from the
+	// first message received
+	account string
+	// authors maps recent message IDs (timestamps) to their senders
+	authors map[string]string
+}
+
+// signalNotification is a JSON-RPC notification on the event stream.
+type signalNotification struct {
+	Method string `json:"method"`
+	Params struct {
+		Account  string         `json:"account"`
+		Envelope signalEnvelope `json:"envelope"`
+	} `json:"params"`
+}
+
+type signalEnvelope struct {
+	SourceNumber string             `json:"sourceNumber"`
+	SourceUUID   string             `json:"sourceUuid"`
+	SourceName   string             `json:"sourceName"`
+	DataMessage  *signalDataMessage `json:"dataMessage"`
+}
+
+type signalDataMessage struct {
+	Timestamp int64  `json:"timestamp"`
+	Message   string `json:"message"`
+	GroupInfo *struct {
+		GroupID string `json:"groupId"`
+	} `json:"groupInfo"`
+	Attachments []signalAttachment `json:"attachments"`
+	Mentions    []signalMention    `json:"mentions"`
+	Quote       *struct {
+		ID           int64  `json:"id"`
+		AuthorNumber string `json:"authorNumber"`
+		AuthorUUID   string `json:"authorUuid"`
+		Text         string `json:"text"`
+	} `json:"quote"`
+	Reaction *struct {
+		Emoji               string `json:"emoji"`
+		TargetAuthorNumber  string `json:"targetAuthorNumber"`
+		TargetAuthorUUID    string `json:"targetAuthorUuid"`
+		TargetSentTimestamp int64  `json:"targetSentTimestamp"`
+		IsRemove            bool   `json:"isRemove"`
+	} `json:"reaction"`
+}
+
+type signalAttachment struct {
+	ID          string `json:"id"`
+	ContentType string `json:"contentType"`
+	Filename    string `json:"filename"`
+}
+
+// signalMention is someone mentioned in a message, at Start (in UTF-16
+// code units) for Length units of its text.
+type signalMention struct {
+	Name   string `json:"name"`
+	Number string `json:"number"`
+	UUID   string `json:"uuid"`
+	Start  int    `json:"start"`
+	Length int    `json:"length"`
+}
+
+func NewSignalChannel(cfg config.SignalConfig, messageBus *bus.MessageBus) (*SignalChannel, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("signal url is required")
+	}
+
+	base := NewBaseChannel("signal", cfg, messageBus, cfg.AllowFrom)
+
+	return &SignalChannel{
+		BaseChannel: base,
+		config:      cfg,
+		url:         strings.TrimRight(cfg.URL, "/"),
+		client:      &http.Client{Timeout: 2 * time.Minute},
+		account:     cfg.Account,
+		authors:     make(map[string]string),
+	}, nil
+}
+
+func (c *SignalChannel) SetTranscriber(transcriber *voice.GroqTranscriber) {
+	c.transcriber = transcriber
+}
+
+func (c *SignalChannel) Start(ctx context.Context) error {
+	logger.InfoC("signal", "Starting Signal channel")
+
+	c.ctx, c.cancel = context.WithCancel(ctx)
+
+	req, err := http.NewRequestWithContext(c.ctx, http.MethodGet, c.url+"/api/v1/check", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("signal-cli daemon not reachable: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("signal-cli daemon check returned HTTP %d", resp.StatusCode)
+	}
+
+	logger.InfoCF("signal", "Signal daemon connected", map[string]interface{}{
+		"url":     c.url,
+		"account": c.config.Account,
+	})
+
+	c.Go(c.ctx, c.eventLoop)
+
+	c.setRunning(true)
+	logger.InfoC("signal", "Signal channel started")
+	return nil
+}
+
+func (c *SignalChannel) Stop(ctx context.Context) error {
+	logger.InfoC("signal", "Stopping Signal channel")
+
+	if c.cancel != nil {
+		c.cancel()
+	}
+
+	c.setRunning(false)
+	c.connected.Store(false)
+	logger.InfoC("signal", "Signal channel stopped")
+	return nil
+}
+
+// Connected reports whether the event stream is open.
+func (c *SignalChannel) Connected() bool {
+	return c.connected.Load()
+}
+
+// eventLoop reads the daemon's event stream, reopening it when it ends and
+// backing off while the daemon is unreachable.
+func (c *SignalChannel) eventLoop() {
+	backoff := 2 * time.Second
+	for c.ctx.Err() == nil {
+		err := c.receive(c.ctx)
+		if c.ctx.Err() != nil {
+			return
+		}
+		if c.connected.Swap(false) {
+			backoff = 2 * time.Second
+		}
+		logger.WarnCF("signal", "Signal event stream failed", map[string]interface{}{
+			"error":   err.Error(),
+			"backoff": backoff.String(),
+		})
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, time.Minute)
+	}
+}
+
+// receive reads the Server-Sent Events stream of incoming messages until
+// it ends. Each event's data is a JSON-RPC "receive" notification.
+func (c *SignalChannel) receive(ctx context.Context) error {
+	target := c.url + "/api/v1/events"
+	if c.config.Account != "" {
+		target += "?" + url.Values{"account": {c.config.Account}}.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	// The stream stays open for good, so no timeout applies
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("signal-cli event stream returned HTTP %d", resp.StatusCode)
+	}
+	c.connected.Store(true)
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64<<10), 4<<20)
+	var data bytes.Buffer
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if data.Len() > 0 {
+				c.handleEvent(data.Bytes())
+				data.Reset()
+			}
+			continue
+		}
+		if rest, ok := strings.CutPrefix(line, "data:"); ok {
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(rest, " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return errors.New("signal-cli event stream closed")
+}
+
+func (c *SignalChannel) handleEvent(data []byte) {
+	defer c.Recover()
+
+	var n signalNotification
+	if err := json.Unmarshal(data, &n); err != nil {
+		logger.DebugCF("signal", "Ignoring malformed event", map[string]interface{}{"error": err.Error()})
+		return
+	}
+	if n.Method != "receive" || n.Params.Envelope.DataMessage == nil {
+		return
+	}
+	account := c.selfNumber()
+	if account == "" && n.Params.Account != "" {
+		c.mu.Lock()
+		c.account = n.Params.Account
+		c.mu.Unlock()
+		account = n.Params.Account
+	}
+	if n.Params.Account != "" && n.Params.Account != account {
+		return
+	}
+	c.handleMessage(&n.Params.Envelope)
+}
+
+func (c *SignalChannel) handleMessage(env *signalEnvelope) {
+	dm := env.DataMessage
+	account := c.selfNumber()
+	if env.SourceNumber != "" && env.SourceNumber == account {
+		return
+	}
+
+	senderID := signalSenderID(env.SourceNumber, env.SourceUUID)
+	chatID := env.SourceNumber
+	if chatID == "" {
+		chatID = env.SourceUUID
+	}
+	isGroup := dm.GroupInfo != nil && dm.GroupInfo.GroupID != ""
+	if isGroup {
+		chatID = signalGroupChatID(dm.GroupInfo.GroupID)
+	}
+	messageID := strconv.FormatInt(dm.Timestamp, 10)
+
+	if r := dm.Reaction; r != nil {
+		on, author := bus.ReactionOnUser, r.TargetAuthorNumber
+		if author == "" {
+			author = r.TargetAuthorUUID
+		}
+		if author != "" && author == account {
+			on = bus.ReactionOnBot
+		}
+		c.HandleReaction(senderID, chatID, bus.Reaction{
+			MessageID: strconv.FormatInt(r.TargetSentTimestamp, 10),
+			Emoji:     r.Emoji,
+			Remove:    r.IsRemove,
+			Author:    author,
+			On:        on,
+		}, nil)
+		return
+	}
+
+	// Check allowlist before downloading attachments for rejected users
+	if !c.Admits(senderID, chatID) {
+		return
+	}
+	c.rememberAuthor(messageID, senderAddress(env))
+
+	content, mentioned := signalMentions(dm.Message, dm.Mentions, account)
+	mediaPaths, localFiles, note, audioSeconds := c.fetchAttachments(senderID, chatID, dm.Attachments)
+	defer func() {
+		for _, f := range localFiles {
+			os.Remove(f)
+		}
+	}()
+	if note != "" {
+		content = strings.TrimSpace(content + "\n" + note)
+	}
+	if content == "" && len(mediaPaths) == 0 {
+		return
+	}
+
+	metadata := map[string]string{
+		"message_id": messageID,
+	}
+	if env.SourceName != "" {
+		metadata["user_name"] = env.SourceName
+	}
+	metadata["is_group"] = strconv.FormatBool(isGroup)
+	if isGroup {
+		metadata["mentioned"] = strconv.FormatBool(mentioned)
+	}
+	if audioSeconds > 0 {
+		metadata["transcription_seconds"] = strconv.FormatFloat(audioSeconds, 'f', 1, 64)
+	}
+	var quote *bus.Quote
+	if q := dm.Quote; q != nil && q.ID != 0 {
+		author := q.AuthorNumber
+		if author == "" {
+			author = q.AuthorUUID
+		}
+		quote = &bus.Quote{MessageID: strconv.FormatInt(q.ID, 10), SenderID: author, Content: q.Text}
+		if author != "" && author == account {
+			metadata["reply_to_bot"] = "true"
+		}
+	}
+
+	logger.DebugCF("signal", "Message received", map[string]interface{}{
+		"from":    senderID,
+		"chat_id": chatID,
+		"content": utils.Truncate(content, 50),
+	})
+
+	c.HandleReply(senderID, chatID, content, mediaPaths, metadata, quote)
+}
+
+// fetchAttachments downloads a message's attachments from the daemon,
+// together, leaving out any that fail. Voice recordings are transcribed
+// into note. Images are handed to the agent (for vision), which removes
+// them; the caller removes localFiles.
+func (c *SignalChannel) fetchAttachments(senderID, chatID string, attachments []signalAttachment) (mediaPaths, localFiles []string, note string, audioSeconds float64) {
+	if len(attachments) == 0 {
+		return nil, nil, "", 0
+	}
+	var dl downloads
+	paths := make([]string, len(attachments))
+	for i, a := range attachments {
+		dl.add(&paths[i], func(ctx context.Context) string { return c.downloadAttachment(ctx, chatID, a) })
+	}
+	dl.run(c.ctx, "signal")
+
+	for i, a := range attachments {
+		path := paths[i]
+		if path == "" {
+			continue
+		}
+		mediaPaths = append(mediaPaths, path)
+		if utils.IsImageFile(path, a.ContentType) {
+			continue
+		}
+		localFiles = append(localFiles, path)
+		if utils.IsAudioFile(path, a.ContentType) {
+			text, seconds := c.handleVoiceMessage(senderID, chatID, path)
+			note = strings.TrimSpace(note + "\n" + text)
+			audioSeconds += seconds
+		}
+	}
+	return mediaPaths, localFiles, note, audioSeconds
+}
+
+// downloadAttachment fetches an attachment the daemon has received, which
+// it hands out in base64, into the media directory.
+func (c *SignalChannel) downloadAttachment(ctx context.Context, chatID string, a signalAttachment) string {
+	params := signalDestination(chatID)
+	if recipients, ok := params["recipient"].([]string); ok {
+		params["recipient"] = recipients[0]
+	}
+	params["id"] = a.ID
+	var result json.RawMessage
+	if err := c.call(ctx, "getAttachment", params, &result); err != nil {
+		logger.ErrorCF("signal", "Failed to download attachment", map[string]interface{}{
+			"id":    a.ID,
+			"error": err.Error(),
+		})
+		return ""
+	}
+	// Older daemons answer with the bare string
+	var encoded string
+	if json.Unmarshal(result, &encoded) != nil {
+		var wrapped struct {
+			Data string `json:"data"`
+		}
+		json.Unmarshal(result, &wrapped)
+		encoded = wrapped.Data
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(data) == 0 {
+		logger.ErrorCF("signal", "Daemon returned no attachment data", map[string]interface{}{"id": a.ID})
+		return ""
+	}
+
+	mediaDir := utils.MediaDir()
+	os.MkdirAll(mediaDir, 0700)
+	ext := filepath.Ext(a.Filename)
+	if ext == "" {
+		ext = ".bin"
+	}
+	tmpFile, err := os.CreateTemp(mediaDir, "signal_*"+ext)
+	if err != nil {
+		logger.ErrorCF("signal", "Failed to create temp file", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return ""
+	}
+	_, err = tmpFile.Write(data)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpFile.Name())
+		return ""
+	}
+
+	path, err := utils.CheckDownload("signal", tmpFile.Name(), utils.MediaKind(a.Filename, a.ContentType))
+	if err != nil {
+		return ""
+	}
+	return path
+}
+
+func (c *SignalChannel) handleVoiceMessage(senderID, chatID, audioPath string) (string, float64) {
+	if c.transcriber == nil || !c.transcriber.IsAvailable() {
+		return "[voice]", 0
+	}
+	if !c.mayTranscribe(senderID, chatID) {
+		return i18n.T(c.Name(), chatID, "voice.private"), 0
+	}
+
+	ctx, cancel := context.WithTimeout(c.ctx, 30*time.Second)
+	defer cancel()
+
+	result, err := c.transcriber.Transcribe(ctx, audioPath)
+	if err != nil {
+		logger.ErrorCF("signal", "Voice transcription failed", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return i18n.T(c.Name(), chatID, "voice.transcription_failed"), 0
+	}
+
+	return fmt.Sprintf("[voice transcription: %s]", result.Text), result.Duration
+}
+
+func (c *SignalChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("signal channel not running")
+	}
+
+	params := signalDestination(msg.ChatID)
+	if msg.Content != "" {
+		params["message"] = msg.Content
+	}
+	var attachments []string
+	for _, path := range msg.Media {
+		uri, err := signalAttachmentURI(path)
+		if err != nil {
+			return err
+		}
+		attachments = append(attachments, uri)
+	}
+	if msg.Content == "" && len(attachments) == 0 {
+		return nil
+	}
+	if len(attachments) > 0 {
+		params["attachments"] = attachments
+	}
+
+	var resp struct {
+		Timestamp int64 `json:"timestamp"`
+	}
+	if err := c.call(ctx, "send", params, &resp); err != nil {
+		return fmt.Errorf("failed to send signal message: %w", err)
+	}
+	messageID := strconv.FormatInt(resp.Timestamp, 10)
+	c.rememberAuthor(messageID, c.selfNumber())
+	reportSent(ctx, messageID)
+
+	logger.DebugCF("signal", "Message sent", map[string]interface{}{
+		"chat_id":    msg.ChatID,
+		"message_id": messageID,
+	})
+	return nil
+}
+
+// signalAttachmentURI returns a file as the data URI signal-cli takes for
+// an attachment, so the daemon need not share the file system.
+func signalAttachmentURI(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read attachment: %w", err)
+	}
+	mimeType, err := utils.SniffMedia(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read attachment: %w", err)
+	}
+	return fmt.Sprintf("data:%s;filename=%s;base64,%s",
+		mimeType, filepath.Base(path), base64.StdEncoding.EncodeToString(data)), nil
+}
+
+// Capabilities reports that Signal shows plain text and takes attachments
+// of up to 100 MB. Sent messages cannot be edited in place.
+func (c *SignalChannel) Capabilities() render.Capabilities {
+	return render.Capabilities{Markup: render.Plain, Media: true, MaxLength: signalMessageLimit, MaxAttachment: signalAttachmentLimit}
+}
+
+// StartIndicator shows the bot typing in the chat while the agent works.
+// Signal forgets a typing notice after 15 seconds, so it is renewed.
+func (c *SignalChannel) StartIndicator(ctx context.Context, chatID, messageID string) func() {
+	typing := func(ctx context.Context, stop bool) {
+		params := signalDestination(chatID)
+		if stop {
+			params["stop"] = true
+		}
+		if err := c.call(ctx, "sendTyping", params, nil); err != nil {
+			logger.DebugCF("signal", "Failed to send typing notice", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}
+	typing(ctx, false)
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(10 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				typing(context.Background(), true)
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				typing(ctx, false)
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// React adds or removes the bot's reaction on a message. Signal addresses
+// a message by its sender and timestamp; the sender is reaction.Author,
+// or else remembered from when the message came in or went out.
+func (c *SignalChannel) React(ctx context.Context, chatID string, reaction bus.Reaction) error {
+	timestamp, err := strconv.ParseInt(reaction.MessageID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid signal message ID: %s", reaction.MessageID)
+	}
+	author := reaction.Author
+	if author == "" {
+		author = c.authorOf(reaction.MessageID)
+	}
+	if author == "" {
+		if strings.HasPrefix(chatID, signalGroupPrefix) {
+			return fmt.Errorf("unknown sender of signal message %s", reaction.MessageID)
+		}
+		author = chatID
+	}
+	params := signalDestination(chatID)
+	params["emoji"] = reaction.Emoji
+	params["targetAuthor"] = author
+	params["targetTimestamp"] = timestamp
+	if reaction.Remove {
+		params["remove"] = true
+	}
+	return c.call(ctx, "sendReaction", params, nil)
+}
+
+// DeleteMessage implements DeleteChannel.
+func (c *SignalChannel) DeleteMessage(ctx context.Context, chatID, messageID string) error {
+	timestamp, err := strconv.ParseInt(messageID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid signal message ID: %s", messageID)
+	}
+	params := signalDestination(chatID)
+	params["targetTimestamp"] = timestamp
+	return c.call(ctx, "remoteDelete", params, nil)
+}
+
+// selfNumber returns the bot's phone number, or "" before it is known.
+func (c *SignalChannel) selfNumber() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.account
+}
+
+// rememberAuthor records who sent a message, forgetting all once
+// maxSignalAuthors are held.
+func (c *SignalChannel) rememberAuthor(messageID, author string) {
+	if author == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.authors) >= maxSignalAuthors {
+		clear(c.authors)
+	}
+	c.authors[messageID] = author
+}
+
+func (c *SignalChannel) authorOf(messageID string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.authors[messageID]
+}
+
+// senderAddress returns the address Signal knows a sender by: their
+// number, or their UUID when they hide it.
+func senderAddress(env *signalEnvelope) string {
+	if env.SourceNumber != "" {
+		return env.SourceNumber
+	}
+	return env.SourceUUID
+}
+
+// signalSenderID returns the sender ID of a message, "number|uuid" with
+// either left out when unknown, so allow_from can name either.
+func signalSenderID(number, uuid string) string {
+	switch {
+	case number == "":
+		return uuid
+	case uuid == "":
+		return number
+	}
+	return number + "|" + uuid
+}
+
+// signalGroupChatID returns the chat ID of a group, see signalGroupPrefix.
+func signalGroupChatID(groupID string) string {
+	return signalGroupPrefix + strings.NewReplacer("+", "-", "/", "_").Replace(groupID)
+}
+
+// signalDestination returns the JSON-RPC parameters addressing chatID.
+func signalDestination(chatID string) map[string]interface{} {
+	if group, ok := strings.CutPrefix(chatID, signalGroupPrefix); ok {
+		return map[string]interface{}{"groupId": strings.NewReplacer("-", "+", "_", "/").Replace(group)}
+	}
+	return map[string]interface{}{"recipient": []string{chatID}}
+}
+
+// signalMentions puts "@name" in place of the marks of the people text
+// mentions, leaving out mentions of the bot's account, and reports
+// whether it was mentioned.
+func signalMentions(text string, mentions []signalMention, account string) (string, bool) {
+	if len(mentions) == 0 {
+		return text, false
+	}
+	sorted := append([]signalMention(nil), mentions...)
+	// From the end, so earlier offsets stay put
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start > sorted[j].Start })
+	units := utf16.Encode([]rune(text))
+	mentioned := false
+	for _, m := range sorted {
+		if m.Start < 0 || m.Length < 0 || m.Start+m.Length > len(units) {
+			continue
+		}
+		var name string
+		switch {
+		case account != "" && m.Number == account:
+			mentioned = true
+		case m.Name != "":
+			name = "@" + m.Name
+		case m.Number != "":
+			name = "@" + m.Number
+		default:
+			name = "@" + m.UUID
+		}
+		replaced := make([]uint16, 0, len(units)+len(name))
+		replaced = append(replaced, units[:m.Start]...)
+		replaced = append(replaced, utf16.Encode([]rune(name))...)
+		units = append(replaced, units[m.Start+m.Length:]...)
+	}
+	text = string(utf16.Decode(units))
+	return strings.TrimSpace(strings.ReplaceAll(text, signalMentionMark, "")), mentioned
+}
+
+// call sends a JSON-RPC request to the daemon, and decodes the result into
+// out, which may be nil.
+func (c *SignalChannel) call(ctx context.Context, method string, params map[string]interface{}, out interface{}) error {
+	if c.config.Account != "" {
+		params["account"] = c.config.Account
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"method":  method,
+		"params":  params,
+		"id":      c.rpcID.Add(1),
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url+"/api/v1/rpc", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, signalResponseLimit))
+	if err != nil {
+		return err
+	}
+	var reply struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(data, &reply); err != nil {
+		return fmt.Errorf("signal-cli returned HTTP %d", resp.StatusCode)
+	}
+	if reply.Error != nil {
+		return fmt.Errorf("signal-cli error %d: %s", reply.Error.Code, reply.Error.Message)
+	}
+	if out == nil || len(reply.Result) == 0 {
+		return nil
+	}
+	return json.Unmarshal(reply.Result, out)
+}
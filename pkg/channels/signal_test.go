@@ -0,0 +1,226 @@
+package channels
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestSignalMentions(t *testing.T) {
+	bot := signalMention{Number: "+15550000000", Length: 1}
+	ada := signalMention{Name: "Ada", Number: "+15551111111", Length: 1}
+	at := func(m signalMention, start int) signalMention {
+		m.Start = start
+		return m
+	}
+	tests := []struct {
+		text          string
+		mentions      []signalMention
+		want          string
+		wantMentioned bool
+	}{
+		{"lunch?", nil, "lunch?", false},
+		{"\uFFFC what's the weather?", []signalMention{at(bot, 0)}, "what's the weather?", true},
+		{"ask \uFFFC and \uFFFC", []signalMention{at(ada, 4), at(bot, 10)}, "ask @Ada and", true},
+		{"🙂 \uFFFC hi", []signalMention{at(ada, 3)}, "🙂 @Ada hi", false},
+	}
+	for _, tt := range tests {
+		got, mentioned := signalMentions(tt.text, tt.mentions, "+15550000000")
+		if got != tt.want || mentioned != tt.wantMentioned {
+			t.Errorf("signalMentions(%q) = %q, %v, want %q, %v", tt.text, got, mentioned, tt.want, tt.wantMentioned)
+		}
+	}
+}
+
+func TestSignalDestination(t *testing.T) {
+	groupID := "aGVsbG8/d29ybGQ+IQ=="
+	chatID := signalGroupChatID(groupID)
+	if strings.Contains(chatID, "/") {
+		t.Errorf("signalGroupChatID() = %q, want no slash", chatID)
+	}
+	if got := signalDestination(chatID)["groupId"]; got != groupID {
+		t.Errorf("group destination = %v, want %q", got, groupID)
+	}
+	if got, ok := signalDestination("+15551111111")["recipient"].([]string); !ok || got[0] != "+15551111111" {
+		t.Errorf("direct destination = %v", got)
+	}
+	if got := signalSenderID("+15551111111", "uuid-1"); got != "+15551111111|uuid-1" {
+		t.Errorf("signalSenderID() = %q", got)
+	}
+}
+
+// fakeSignal serves the parts of signal-cli's HTTP daemon the channel
+// uses: the event stream, sent once, and JSON-RPC calls, recorded.
+type fakeSignal struct {
+	mu     sync.Mutex
+	events []string
+	calls  []map[string]interface{}
+}
+
+func (f *fakeSignal) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/api/v1/check":
+	case "/api/v1/events":
+		w.Header().Set("Content-Type", "text/event-stream")
+		f.mu.Lock()
+		events := f.events
+		f.events = nil
+		f.mu.Unlock()
+		for _, ev := range events {
+			fmt.Fprintf(w, "event:receive\ndata:%s\n\n", ev)
+		}
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	case "/api/v1/rpc":
+		var req struct {
+			ID     int                    `json:"id"`
+			Method string                 `json:"method"`
+			Params map[string]interface{} `json:"params"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		req.Params["method"] = req.Method
+		f.mu.Lock()
+		f.calls = append(f.calls, req.Params)
+		f.mu.Unlock()
+		var result interface{}
+		switch req.Method {
+		case "getAttachment":
+			result = map[string]string{"data": base64.StdEncoding.EncodeToString([]byte("minutes of the meeting"))}
+		case "send":
+			result = map[string]int64{"timestamp": 1700000000999}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.ID, "result": result})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (f *fakeSignal) called(method string) []map[string]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []map[string]interface{}
+	for _, c := range f.calls {
+		if c["method"] == method {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func TestSignalChannel(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	event := func(source, uuid string, data map[string]interface{}) string {
+		ev, _ := json.Marshal(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"method":  "receive",
+			"params": map[string]interface{}{
+				"account": "+15550000000",
+				"envelope": map[string]interface{}{
+					"sourceNumber": source, "sourceUuid": uuid, "sourceName": "Ada", "dataMessage": data,
+				},
+			},
+		})
+		return string(ev)
+	}
+	fake := &fakeSignal{events: []string{
+		event("+15559999999", "uuid-9", map[string]interface{}{"timestamp": 1, "message": "not allowed"}),
+		event("+15551111111", "uuid-1", map[string]interface{}{
+			"timestamp": 2, "message": "notes attached",
+			"attachments": []map[string]string{{"id": "att1", "contentType": "text/plain", "filename": "notes.txt"}},
+		}),
+		event("", "uuid-1", map[string]interface{}{
+			"timestamp": 3, "message": "\uFFFC status?",
+			"groupInfo": map[string]string{"groupId": "Z3JvdXA/aWQ="},
+			"mentions":  []map[string]interface{}{{"number": "+15550000000", "start": 0, "length": 1}},
+			"quote":     map[string]interface{}{"id": 1700000000999, "authorNumber": "+15550000000", "text": "all green"},
+		}),
+		event("+15551111111", "uuid-1", map[string]interface{}{
+			"timestamp": 4,
+			"reaction":  map[string]interface{}{"emoji": "👍", "targetAuthorNumber": "+15550000000", "targetSentTimestamp": 1700000000999},
+		}),
+	}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	msgBus := bus.NewMessageBus()
+	ch, err := NewSignalChannel(config.SignalConfig{
+		URL: server.URL + "/", Account: "+15550000000", AllowFrom: config.FlexibleStringSlice{"uuid-1"},
+	}, msgBus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := ch.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer ch.Stop(ctx)
+
+	direct, ok := msgBus.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("no inbound message")
+	}
+	if direct.ChatID != "+15551111111" || direct.SenderID != "+15551111111|uuid-1" || direct.Content != "notes attached" {
+		t.Errorf("direct message = %q from %q in %q", direct.Content, direct.SenderID, direct.ChatID)
+	}
+	if len(direct.Media) != 1 || filepath.Ext(direct.Media[0]) != ".txt" {
+		t.Errorf("media = %v, want the downloaded attachment", direct.Media)
+	}
+	if calls := fake.called("getAttachment"); len(calls) != 1 || calls[0]["id"] != "att1" || calls[0]["account"] != "+15550000000" {
+		t.Errorf("getAttachment calls = %v", calls)
+	}
+
+	group, ok := msgBus.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("no group message")
+	}
+	if group.ChatID != "group:Z3JvdXA_aWQ=" || group.Content != "status?" || group.SenderID != "uuid-1" {
+		t.Errorf("group message = %q from %q in %q", group.Content, group.SenderID, group.ChatID)
+	}
+	if group.Metadata["mentioned"] != "true" || group.Metadata["reply_to_bot"] != "true" || group.Quote == nil ||
+		group.Quote.Content != "all green" {
+		t.Errorf("group metadata = %v, quote %+v", group.Metadata, group.Quote)
+	}
+
+	reaction, ok := msgBus.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("no reaction")
+	}
+	if reaction.Reaction == nil || reaction.Reaction.On != bus.ReactionOnBot || reaction.Reaction.MessageID != "1700000000999" {
+		t.Errorf("reaction = %+v", reaction.Reaction)
+	}
+
+	file := filepath.Join(t.TempDir(), "report.txt")
+	os.WriteFile(file, []byte("all green"), 0600)
+	if err := ch.Send(ctx, bus.OutboundMessage{ChatID: group.ChatID, Content: "done", Media: []string{file}}); err != nil {
+		t.Fatal(err)
+	}
+	sent := fake.called("send")
+	if len(sent) != 1 || sent[0]["groupId"] != "Z3JvdXA/aWQ=" || sent[0]["message"] != "done" {
+		t.Fatalf("send calls = %v", sent)
+	}
+	if atts, _ := sent[0]["attachments"].([]interface{}); len(atts) != 1 ||
+		!strings.HasPrefix(atts[0].(string), "data:text/plain") || !strings.Contains(atts[0].(string), ";filename=report.txt;base64,") {
+		t.Errorf("attachments = %v", sent[0]["attachments"])
+	}
+
+	// The sender of a group message is remembered for reacting to it
+	if err := ch.React(ctx, group.ChatID, bus.Reaction{MessageID: "3", Emoji: "✅"}); err != nil {
+		t.Fatal(err)
+	}
+	if calls := fake.called("sendReaction"); len(calls) != 1 || calls[0]["targetAuthor"] != "uuid-1" {
+		t.Errorf("sendReaction calls = %v", calls)
+	}
+}
@@ -4,8 +4,11 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/slack-go/slack"
@@ -14,7 +17,10 @@ import (
 
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/contacts"
+	"github.com/sipeed/picoclaw/pkg/i18n"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/render"
 	"github.com/sipeed/picoclaw/pkg/utils"
 	"github.com/sipeed/picoclaw/pkg/voice"
 )
@@ -29,6 +35,7 @@ type SlackChannel struct {
 	ctx          context.Context
 	cancel       context.CancelFunc
 	pendingAcks  sync.Map
+	connected    atomic.Bool
 }
 
 type slackMessageRef struct {
@@ -78,9 +85,9 @@ func (c *SlackChannel) Start(ctx context.Context) error {
 		"team":        authResp.Team,
 	})
 
-	go c.eventLoop()
+	c.Go(c.ctx, c.eventLoop)
 
-	go func() {
+	c.Go(c.ctx, func() {
 		if err := c.socketClient.RunContext(c.ctx); err != nil {
 			if c.ctx.Err() == nil {
 				logger.ErrorCF("slack", "Socket Mode connection error", map[string]interface{}{
@@ -88,7 +95,7 @@ func (c *SlackChannel) Start(ctx context.Context) error {
 				})
 			}
 		}
-	}()
+	})
 
 	c.setRunning(true)
 	logger.InfoC("slack", "Slack channel started (Socket Mode)")
@@ -112,22 +119,40 @@ func (c *SlackChannel) Send(ctx context.Context, msg bus.OutboundMessage) error
 		return fmt.Errorf("slack channel not running")
 	}
 
+	msg.ChatID = threadedChatID(msg)
 	channelID, threadTS := parseSlackChatID(msg.ChatID)
 	if channelID == "" {
 		return fmt.Errorf("invalid slack chat ID: %s", msg.ChatID)
 	}
 
-	opts := []slack.MsgOption{
-		slack.MsgOptionText(msg.Content, false),
+	if len(msg.Media) > 0 {
+		if err := c.sendMedia(ctx, channelID, threadTS, msg); err != nil {
+			return err
+		}
 	}
+	interactive := len(msg.Buttons) > 0 || len(msg.QuickReplies) > 0 || msg.Menu != nil
+	if len(msg.Media) == 0 || interactive {
+		text := msg.Content
+		if len(msg.Media) > 0 {
+			// The text went out with the first file; only the buttons remain
+			text = ""
+		}
+		opts := []slack.MsgOption{
+			slack.MsgOptionText(text, false),
+		}
+		if interactive {
+			opts = append(opts, slack.MsgOptionBlocks(slackBlocks(text, msg)...))
+		}
 
-	if threadTS != "" {
-		opts = append(opts, slack.MsgOptionTS(threadTS))
-	}
+		if threadTS != "" {
+			opts = append(opts, slack.MsgOptionTS(threadTS))
+		}
 
-	_, _, err := c.api.PostMessageContext(ctx, channelID, opts...)
-	if err != nil {
-		return fmt.Errorf("failed to send slack message: %w", err)
+		_, ts, err := c.api.PostMessageContext(ctx, channelID, opts...)
+		if err != nil {
+			return fmt.Errorf("failed to send slack message: %w", err)
+		}
+		reportSent(ctx, ts)
 	}
 
 	if ref, ok := c.pendingAcks.LoadAndDelete(msg.ChatID); ok {
@@ -146,6 +171,162 @@ func (c *SlackChannel) Send(ctx context.Context, msg bus.OutboundMessage) error
 	return nil
 }
 
+// sendMedia uploads each attachment; the first carries the text as its
+// comment.
+func (c *SlackChannel) sendMedia(ctx context.Context, channelID, threadTS string, msg bus.OutboundMessage) error {
+	comment := msg.Content
+	for _, path := range msg.Media {
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("failed to read attachment: %w", err)
+		}
+		_, err = c.api.UploadFileV2Context(ctx, slack.UploadFileV2Parameters{
+			File:            path,
+			FileSize:        int(info.Size()),
+			Filename:        filepath.Base(path),
+			Channel:         channelID,
+			ThreadTimestamp: threadTS,
+			InitialComment:  comment,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to upload slack file: %w", err)
+		}
+		comment = ""
+	}
+	return nil
+}
+
+// Capabilities reports that Slack takes mrkdwn, attachments of up to 1 GB,
+// and buttons.
+// Streamed replies are not edited in place.
+func (c *SlackChannel) Capabilities() render.Capabilities {
+	return render.Capabilities{Markup: render.Mrkdwn, Media: true, Buttons: true, MaxLength: slackMessageLimit, MaxAttachment: 1 << 30}
+}
+
+// StartIndicator marks the message being handled with 👀 while the agent
+// works on it. Slash commands have no message to mark.
+func (c *SlackChannel) StartIndicator(ctx context.Context, chatID, messageID string) func() {
+	channelID, _ := parseSlackChatID(chatID)
+	if messageID == "" || channelID == "" {
+		return func() {}
+	}
+	item := slack.ItemRef{Channel: channelID, Timestamp: messageID}
+	if err := c.api.AddReactionContext(ctx, "eyes", item); err != nil {
+		logger.DebugCF("slack", "Failed to add working reaction", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return func() {}
+	}
+	return func() {
+		c.api.RemoveReactionContext(context.Background(), "eyes", item)
+	}
+}
+
+// slackMessageLimit is the most text Slack keeps in one message, and
+// slackSectionLimit the most one section block holds.
+const (
+	slackMessageLimit = 40000
+	slackSectionLimit = 3000
+)
+
+// slackBlocks lays text out in section blocks followed by an actions block
+// holding the buttons, the quick replies, and the menu. Once a message has
+// blocks Slack shows them instead of its text.
+func slackBlocks(text string, msg bus.OutboundMessage) []slack.Block {
+	var blocks []slack.Block
+	for runes := []rune(text); len(runes) > 0; {
+		n := min(len(runes), slackSectionLimit)
+		section := slack.NewTextBlockObject(slack.MarkdownType, string(runes[:n]), false, false)
+		blocks = append(blocks, slack.NewSectionBlock(section, nil, nil))
+		runes = runes[n:]
+	}
+	var elements []slack.BlockElement
+	addButtons := func(prefix string, buttons []bus.Button) {
+		for i, b := range buttons {
+			label := slack.NewTextBlockObject(slack.PlainTextType, b.Text, false, false)
+			button := slack.NewButtonBlockElement(fmt.Sprintf("%s_%d", prefix, i), b.Data, label)
+			button.URL = b.URL
+			elements = append(elements, button)
+		}
+	}
+	addButtons(bus.InteractionButton, msg.Buttons)
+	addButtons(bus.InteractionQuickReply, msg.QuickReplies)
+	if msg.Menu != nil && len(msg.Menu.Options) > 0 {
+		var placeholder *slack.TextBlockObject
+		if msg.Menu.Placeholder != "" {
+			placeholder = slack.NewTextBlockObject(slack.PlainTextType, msg.Menu.Placeholder, false, false)
+		}
+		options := make([]*slack.OptionBlockObject, 0, len(msg.Menu.Options))
+		for _, o := range msg.Menu.Options {
+			label := slack.NewTextBlockObject(slack.PlainTextType, o.Text, false, false)
+			options = append(options, slack.NewOptionBlockObject(o.Data, label, nil))
+		}
+		elements = append(elements, slack.NewOptionsSelectBlockElement(slack.OptTypeStatic, placeholder, bus.InteractionMenu, options...))
+	}
+	return append(blocks, slack.NewActionBlock("buttons", elements...))
+}
+
+// slackInteraction returns the kind and data of a block action: a pick
+// from the menu, or a press of a button or quick reply, told apart by
+// their action IDs.
+func slackInteraction(action *slack.BlockAction) (kind, data string) {
+	switch {
+	case action.ActionID == bus.InteractionMenu:
+		return bus.InteractionMenu, action.SelectedOption.Value
+	case strings.HasPrefix(action.ActionID, bus.InteractionQuickReply+"_"):
+		return bus.InteractionQuickReply, action.Value
+	default:
+		return bus.InteractionButton, action.Value
+	}
+}
+
+// handleInteractive passes button presses and menu picks on as
+// interactions, see BaseChannel.HandleInteraction.
+func (c *SlackChannel) handleInteractive(event socketmode.Event) {
+	defer c.Recover()
+
+	if event.Request != nil {
+		c.socketClient.Ack(*event.Request)
+	}
+	callback, ok := event.Data.(slack.InteractionCallback)
+	if !ok || callback.Type != slack.InteractionTypeBlockActions {
+		return
+	}
+
+	channelID := callback.Channel.ID
+	if channelID == "" {
+		channelID = callback.Container.ChannelID
+	}
+	chatID := channelID
+	if threadTS := callback.Container.ThreadTs; threadTS != "" {
+		chatID = channelID + "/" + threadTS
+	}
+	for _, action := range callback.ActionCallback.BlockActions {
+		kind, data := slackInteraction(action)
+		// URL buttons have no value and need nothing from the bot
+		if data == "" {
+			continue
+		}
+		c.HandleInteraction(bus.Interaction{
+			ChatID:    chatID,
+			SenderID:  callback.User.ID,
+			Kind:      kind,
+			Data:      data,
+			MessageID: callback.Container.MessageTs,
+		}, map[string]string{
+			"channel_id": channelID,
+			"thread_ts":  callback.Container.ThreadTs,
+			"platform":   "slack",
+		})
+	}
+}
+
+// Connected reports whether the Socket Mode connection is up; the client
+// reconnects on its own after a drop.
+func (c *SlackChannel) Connected() bool {
+	return c.connected.Load()
+}
+
 func (c *SlackChannel) eventLoop() {
 	for {
 		select {
@@ -156,20 +337,24 @@ func (c *SlackChannel) eventLoop() {
 				return
 			}
 			switch event.Type {
+			case socketmode.EventTypeConnected:
+				c.connected.Store(true)
+			case socketmode.EventTypeConnecting, socketmode.EventTypeConnectionError, socketmode.EventTypeDisconnect:
+				c.connected.Store(false)
 			case socketmode.EventTypeEventsAPI:
 				c.handleEventsAPI(event)
 			case socketmode.EventTypeSlashCommand:
 				c.handleSlashCommand(event)
 			case socketmode.EventTypeInteractive:
-				if event.Request != nil {
-					c.socketClient.Ack(*event.Request)
-				}
+				c.handleInteractive(event)
 			}
 		}
 	}
 }
 
 func (c *SlackChannel) handleEventsAPI(event socketmode.Event) {
+	defer c.Recover()
+
 	if event.Request != nil {
 		c.socketClient.Ack(*event.Request)
 	}
@@ -184,7 +369,138 @@ func (c *SlackChannel) handleEventsAPI(event socketmode.Event) {
 		c.handleMessageEvent(ev)
 	case *slackevents.AppMentionEvent:
 		c.handleAppMention(ev)
+	case *slackevents.ReactionAddedEvent:
+		c.handleReaction(slackevents.ReactionAddedEvent(*ev), false)
+	case *slackevents.ReactionRemovedEvent:
+		c.handleReaction(slackevents.ReactionAddedEvent(*ev), true)
+	case *slackevents.MemberJoinedChannelEvent:
+		c.handleMembership(ev.Channel, ev.User, ev.Inviter, true)
+	case *slackevents.MemberLeftChannelEvent:
+		c.handleMembership(ev.Channel, ev.User, "", false)
+	case *slackevents.ChannelArchiveEvent:
+		c.HandleChatEvent(ev.Channel, bus.ChatArchived, nil, ev.User)
+	case *slackevents.GroupArchiveEvent:
+		c.HandleChatEvent(ev.Channel, bus.ChatArchived, nil, "")
+	case *slackevents.ChannelDeletedEvent:
+		c.HandleChatEvent(ev.Channel, bus.ChatArchived, nil, "")
+	case *slackevents.GroupDeletedEvent:
+		c.HandleChatEvent(ev.Channel, bus.ChatArchived, nil, "")
+	}
+}
+
+// handleMembership reports a user joining or leaving a channel, or the bot
+// being added to or removed from it.
+func (c *SlackChannel) handleMembership(channelID, userID, inviter string, joined bool) {
+	if userID == c.botUserID {
+		eventType := bus.ChatBotRemoved
+		if joined {
+			eventType = bus.ChatBotAdded
+		}
+		c.HandleChatEvent(channelID, eventType, nil, inviter)
+		return
+	}
+	member := bus.ChatMember{ID: userID}
+	if user, err := c.api.GetUserInfoContext(c.ctx, userID); err == nil {
+		member.Name = user.RealName
+	}
+	eventType := bus.ChatMemberLeft
+	if joined {
+		eventType = bus.ChatMemberJoined
+	}
+	c.HandleChatEvent(channelID, eventType, []bus.ChatMember{member}, inviter)
+}
+
+// handleReaction passes reactions added to or removed from messages on to
+// the agent.
+func (c *SlackChannel) handleReaction(ev slackevents.ReactionAddedEvent, remove bool) {
+	if ev.User == c.botUserID || ev.Item.Type != "message" {
+		return
+	}
+	on := bus.ReactionOnUser
+	if ev.ItemUser == c.botUserID {
+		on = bus.ReactionOnBot
+	}
+	c.HandleReaction(ev.User, ev.Item.Channel, bus.Reaction{
+		MessageID: ev.Item.Timestamp,
+		Emoji:     slackEmoji(ev.Reaction),
+		Remove:    remove,
+		On:        on,
+	}, nil)
+}
+
+// slackReactionNames pairs Slack's names for common reactions with their
+// emoji. The first name listed for an emoji is the one used to send it.
+var slackReactionNames = [][2]string{
+	{"+1", "👍"},
+	{"thumbsup", "👍"},
+	{"-1", "👎"},
+	{"thumbsdown", "👎"},
+	{"white_check_mark", "✅"},
+	{"heavy_check_mark", "✔"},
+	{"x", "❌"},
+	{"pushpin", "📌"},
+	{"repeat", "🔁"},
+	{"eyes", "👀"},
+	{"heart", "❤"},
+	{"tada", "🎉"},
+	{"fire", "🔥"},
+	{"rocket", "🚀"},
+	{"ok_hand", "👌"},
+	{"pray", "🙏"},
+	{"thinking_face", "🤔"},
+	{"warning", "⚠"},
+	{"hourglass_flowing_sand", "⏳"},
+	{"hourglass", "⌛"},
+	{"zap", "⚡"},
+	{"100", "💯"},
+}
+
+// slackEmoji returns the emoji for a Slack reaction name such as
+// "thumbsup::skin-tone-2", or the name in colons when it is not a common
+// one.
+func slackEmoji(name string) string {
+	base, _, _ := strings.Cut(name, "::")
+	for _, pair := range slackReactionNames {
+		if pair[0] == base {
+			return pair[1]
+		}
+	}
+	return ":" + name + ":"
+}
+
+// slackReactionName returns Slack's name for emoji, which may also be
+// given as a name, with or without colons.
+func slackReactionName(emoji string) string {
+	plain := strings.ReplaceAll(emoji, "\uFE0F", "")
+	for _, pair := range slackReactionNames {
+		if pair[1] == plain {
+			return pair[0]
+		}
+	}
+	return strings.Trim(emoji, ":")
+}
+
+// React adds or removes the bot's reaction on a message.
+func (c *SlackChannel) React(ctx context.Context, chatID string, reaction bus.Reaction) error {
+	channelID, _ := parseSlackChatID(chatID)
+	if channelID == "" {
+		return fmt.Errorf("invalid slack chat ID: %s", chatID)
+	}
+	item := slack.ItemRef{Channel: channelID, Timestamp: reaction.MessageID}
+	if reaction.Remove {
+		return c.api.RemoveReactionContext(ctx, slackReactionName(reaction.Emoji), item)
+	}
+	return c.api.AddReactionContext(ctx, slackReactionName(reaction.Emoji), item)
+}
+
+// DeleteMessage implements DeleteChannel.
+func (c *SlackChannel) DeleteMessage(ctx context.Context, chatID, messageID string) error {
+	channelID, _ := parseSlackChatID(chatID)
+	if channelID == "" {
+		return fmt.Errorf("invalid slack chat ID: %s", chatID)
 	}
+	_, _, err := c.api.DeleteMessageContext(ctx, channelID, messageID)
+	return err
 }
 
 func (c *SlackChannel) handleMessageEvent(ev *slackevents.MessageEvent) {
@@ -199,10 +515,7 @@ func (c *SlackChannel) handleMessageEvent(ev *slackevents.MessageEvent) {
 	}
 
 	// Check allowlist before downloading attachments for rejected users
-	if !c.IsAllowed(ev.User) {
-		logger.DebugCF("slack", "Message rejected by allowlist", map[string]interface{}{
-			"user_id": ev.User,
-		})
+	if !c.Admits(ev.User, ev.Channel) {
 		return
 	}
 
@@ -216,11 +529,6 @@ func (c *SlackChannel) handleMessageEvent(ev *slackevents.MessageEvent) {
 		chatID = channelID + "/" + threadTS
 	}
 
-	c.api.AddReaction("eyes", slack.ItemRef{
-		Channel:   channelID,
-		Timestamp: messageTS,
-	})
-
 	c.pendingAcks.Store(chatID, slackMessageRef{
 		ChannelID: channelID,
 		Timestamp: messageTS,
@@ -230,6 +538,7 @@ func (c *SlackChannel) handleMessageEvent(ev *slackevents.MessageEvent) {
 	content = c.stripBotMention(content)
 
 	var mediaPaths []string
+	var audioSeconds float64
 	localFiles := []string{} // track temp files for cleanup
 
 	// Ensure temp files are cleaned up when function returns
@@ -245,24 +554,38 @@ func (c *SlackChannel) handleMessageEvent(ev *slackevents.MessageEvent) {
 	}()
 
 	if ev.Message != nil && len(ev.Message.Files) > 0 {
-		for _, file := range ev.Message.Files {
-			localPath := c.downloadSlackFile(file)
+		// Fetched together; each file is left out if it fails
+		var dl downloads
+		paths := make([]string, len(ev.Message.Files))
+		for i, file := range ev.Message.Files {
+			dl.add(&paths[i], func(ctx context.Context) string { return c.downloadSlackFile(ctx, file) })
+		}
+		dl.run(c.ctx, "slack")
+
+		for i, file := range ev.Message.Files {
+			localPath := paths[i]
 			if localPath == "" {
 				continue
 			}
-			localFiles = append(localFiles, localPath)
+			// Images are handed to the agent (for vision), which removes them
+			if !utils.IsImageFile(file.Name, file.Mimetype) {
+				localFiles = append(localFiles, localPath)
+			}
 			mediaPaths = append(mediaPaths, localPath)
 
-			if utils.IsAudioFile(file.Name, file.Mimetype) && c.transcriber != nil && c.transcriber.IsAvailable() {
+			if utils.IsAudioFile(file.Name, file.Mimetype) && c.transcriber != nil && c.transcriber.IsAvailable() && !c.mayTranscribe(senderID, chatID) {
+				content += "\n" + i18n.T(c.Name(), chatID, "voice.private")
+			} else if utils.IsAudioFile(file.Name, file.Mimetype) && c.transcriber != nil && c.transcriber.IsAvailable() {
 				ctx, cancel := context.WithTimeout(c.ctx, 30*time.Second)
 				defer cancel()
 				result, err := c.transcriber.Transcribe(ctx, localPath)
 
 				if err != nil {
 					logger.ErrorCF("slack", "Voice transcription failed", map[string]interface{}{"error": err.Error()})
-					content += fmt.Sprintf("\n[audio: %s (transcription failed)]", file.Name)
+					content += "\n" + i18n.T(c.Name(), chatID, "audio.transcription_failed", file.Name)
 				} else {
 					content += fmt.Sprintf("\n[voice transcription: %s]", result.Text)
+					audioSeconds += result.Duration
 				}
 			} else {
 				content += fmt.Sprintf("\n[file: %s]", file.Name)
@@ -275,10 +598,15 @@ func (c *SlackChannel) handleMessageEvent(ev *slackevents.MessageEvent) {
 	}
 
 	metadata := map[string]string{
+		"message_id": messageTS,
 		"message_ts": messageTS,
 		"channel_id": channelID,
 		"thread_ts":  threadTS,
 		"platform":   "slack",
+		"is_dm":      fmt.Sprintf("%t", strings.HasPrefix(channelID, "D")),
+	}
+	if audioSeconds > 0 {
+		metadata["transcription_seconds"] = strconv.FormatFloat(audioSeconds, 'f', 1, 64)
 	}
 
 	logger.DebugCF("slack", "Received message", map[string]interface{}{
@@ -308,11 +636,6 @@ func (c *SlackChannel) handleAppMention(ev *slackevents.AppMentionEvent) {
 		chatID = channelID + "/" + messageTS
 	}
 
-	c.api.AddReaction("eyes", slack.ItemRef{
-		Channel:   channelID,
-		Timestamp: messageTS,
-	})
-
 	c.pendingAcks.Store(chatID, slackMessageRef{
 		ChannelID: channelID,
 		Timestamp: messageTS,
@@ -325,17 +648,21 @@ func (c *SlackChannel) handleAppMention(ev *slackevents.AppMentionEvent) {
 	}
 
 	metadata := map[string]string{
+		"message_id": messageTS,
 		"message_ts": messageTS,
 		"channel_id": channelID,
 		"thread_ts":  threadTS,
 		"platform":   "slack",
 		"is_mention": "true",
+		"is_dm":      fmt.Sprintf("%t", strings.HasPrefix(channelID, "D")),
 	}
 
 	c.HandleMessage(senderID, chatID, content, nil, metadata)
 }
 
 func (c *SlackChannel) handleSlashCommand(event socketmode.Event) {
+	defer c.Recover()
+
 	cmd, ok := event.Data.(slack.SlashCommand)
 	if !ok {
 		return
@@ -359,6 +686,7 @@ func (c *SlackChannel) handleSlashCommand(event socketmode.Event) {
 		"platform":   "slack",
 		"is_command": "true",
 		"trigger_id": cmd.TriggerID,
+		"is_dm":      fmt.Sprintf("%t", strings.HasPrefix(channelID, "D")),
 	}
 
 	logger.DebugCF("slack", "Slash command received", map[string]interface{}{
@@ -370,7 +698,35 @@ func (c *SlackChannel) handleSlashCommand(event socketmode.Event) {
 	c.HandleMessage(senderID, chatID, content, nil, metadata)
 }
 
-func (c *SlackChannel) downloadSlackFile(file slack.File) string {
+// Contacts lists the workspace's people, for the contact directory.
+// Messages sent to a user ID reach them in the app's direct messages.
+func (c *SlackChannel) Contacts(ctx context.Context) ([]contacts.Contact, error) {
+	users, err := c.api.GetUsersContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Slack users: %w", err)
+	}
+	list := make([]contacts.Contact, 0, len(users))
+	for _, u := range users {
+		if u.IsBot || u.Deleted || u.ID == "USLACKBOT" {
+			continue
+		}
+		name := u.RealName
+		if name == "" {
+			name = u.Profile.DisplayName
+		}
+		list = append(list, contacts.Contact{
+			Channel:  c.Name(),
+			ID:       u.ID,
+			Name:     name,
+			Username: u.Name,
+			ChatID:   u.ID,
+			Avatar:   u.Profile.Image72,
+		})
+	}
+	return list, nil
+}
+
+func (c *SlackChannel) downloadSlackFile(ctx context.Context, file slack.File) string {
 	downloadURL := file.URLPrivateDownload
 	if downloadURL == "" {
 		downloadURL = file.URLPrivate
@@ -380,8 +736,9 @@ func (c *SlackChannel) downloadSlackFile(file slack.File) string {
 		return ""
 	}
 
-	return utils.DownloadFile(downloadURL, file.Name, utils.DownloadOptions{
+	return utils.DownloadFileContext(ctx, downloadURL, file.Name, utils.DownloadOptions{
 		LoggerPrefix: "slack",
+		Kind:         utils.MediaKind(file.Name, file.Mimetype),
 		ExtraHeaders: map[string]string{
 			"Authorization": "Bearer " + c.config.BotToken,
 		},
@@ -172,3 +172,29 @@ func TestSlackChannelIsAllowed(t *testing.T) {
 		}
 	})
 }
+
+func TestSlackReactionNames(t *testing.T) {
+	tests := []struct {
+		name  string
+		emoji string
+	}{
+		{"white_check_mark", "✅"},
+		{"+1", "👍"},
+		{"warning", "⚠"},
+		{"partyparrot", ":partyparrot:"},
+	}
+	for _, tt := range tests {
+		if got := slackEmoji(tt.name); got != tt.emoji {
+			t.Errorf("slackEmoji(%q) = %q, want %q", tt.name, got, tt.emoji)
+		}
+		if got := slackReactionName(tt.emoji); got != tt.name {
+			t.Errorf("slackReactionName(%q) = %q, want %q", tt.emoji, got, tt.name)
+		}
+	}
+	if got := slackEmoji("thumbsup::skin-tone-2"); got != "👍" {
+		t.Errorf("slackEmoji(skin tone) = %q", got)
+	}
+	if got := slackReactionName("⚠\uFE0F"); got != "warning" {
+		t.Errorf("slackReactionName(with variation selector) = %q", got)
+	}
+}
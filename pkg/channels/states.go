@@ -0,0 +1,103 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package channels
+
+import (
+	"context"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/events"
+)
+
+// channelStateInterval is how often channel states are checked for
+// changes. Most channels do not report them, see channelState.
+const channelStateInterval = 10 * time.Second
+
+// watchStates publishes an event whenever a channel changes state, e.g.
+// from "connected" to "reconnecting", until ctx is cancelled.
+func (m *Manager) watchStates(ctx context.Context) {
+	states := m.ChannelStates()
+	m.statesMu.Lock()
+	m.lastStates = states
+	m.statesMu.Unlock()
+	ticker := time.NewTicker(channelStateInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			states := m.ChannelStates()
+			m.statesMu.Lock()
+			m.lastStates = publishStateChanges(m.lastStates, states)
+			m.statesMu.Unlock()
+		}
+	}
+}
+
+// handleChannelStatus publishes a state a channel reported itself at once,
+// with why its connection dropped and when it will try again, and keeps
+// watchStates from publishing the change a second time.
+func (m *Manager) handleChannelStatus(s bus.ChannelStatus) {
+	m.statesMu.Lock()
+	if m.lastStates == nil {
+		m.lastStates = make(map[string]string)
+	}
+	previous := m.lastStates[s.Channel]
+	m.lastStates[s.Channel] = s.State
+	m.statesMu.Unlock()
+
+	fields := map[string]interface{}{"state": s.State, "previous": previous}
+	if s.Error != "" {
+		fields["error"] = s.Error
+	}
+	if s.Attempt > 0 {
+		fields["attempt"] = s.Attempt
+	}
+	if s.RetryIn > 0 {
+		fields["retry_in"] = s.RetryIn.String()
+	}
+	events.Publish(events.Event{
+		Type:    events.TypeChannel,
+		Channel: s.Channel,
+		Message: s.State,
+		Fields:  fields,
+	})
+}
+
+// publishStateChanges publishes the channels whose state differs between
+// before and now, and returns now.
+func publishStateChanges(before, now map[string]string) map[string]string {
+	for name, state := range now {
+		if previous := before[name]; previous != state {
+			events.Publish(events.Event{
+				Type:    events.TypeChannel,
+				Channel: name,
+				Message: state,
+				Fields:  map[string]interface{}{"state": state, "previous": previous},
+			})
+		}
+	}
+	return now
+}
+
+// publishDeliveryFailed reports a message dropped from the outbox after
+// it ran out of attempts.
+func publishDeliveryFailed(msg bus.OutboundMessage, reason string) {
+	e := events.Event{
+		Type:    events.TypeDeliveryFailed,
+		Channel: msg.Channel,
+		ChatID:  msg.ChatID,
+		Message: reason,
+		Content: msg.Content,
+	}
+	if msg.ID != "" {
+		e.Fields = map[string]interface{}{"delivery_id": msg.ID}
+	}
+	events.Publish(e)
+}
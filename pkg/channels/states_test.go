@@ -0,0 +1,62 @@
+package channels
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/events"
+)
+
+func TestPublishStateChanges(t *testing.T) {
+	ch, cancel := events.Default.Subscribe(10)
+	defer cancel()
+
+	before := map[string]string{"slack": "connected", "whatsapp": "connected"}
+	now := map[string]string{"slack": "connected", "whatsapp": "reconnecting", "discord": "running"}
+	if got := publishStateChanges(before, now); len(got) != 3 {
+		t.Errorf("returned %v, want the new states", got)
+	}
+	publishDeliveryFailed(bus.OutboundMessage{ID: "d1", Channel: "slack", ChatID: "C1", Content: "hi"}, "channel is disabled")
+
+	got := map[string]events.Event{}
+	for i := 0; i < 3; i++ {
+		e := <-ch
+		got[e.Type+":"+e.Channel] = e
+	}
+	if e := got["channel:whatsapp"]; e.Message != "reconnecting" || e.Fields["previous"] != "connected" {
+		t.Errorf("whatsapp event = %+v", e)
+	}
+	if e := got["channel:discord"]; e.Message != "running" || e.Fields["previous"] != "" {
+		t.Errorf("discord event = %+v", e)
+	}
+	if e := got["delivery_failed:slack"]; e.Message != "channel is disabled" || e.Fields["delivery_id"] != "d1" {
+		t.Errorf("delivery event = %+v", e)
+	}
+	select {
+	case e := <-ch:
+		t.Errorf("unexpected event %+v", e)
+	default:
+	}
+}
+
+func TestChannelStatus(t *testing.T) {
+	ch, cancel := events.Default.Subscribe(10)
+	defer cancel()
+	m := &Manager{lastStates: map[string]string{"whatsapp": "connected"}}
+
+	m.handleChannelStatus(bus.ChannelStatus{Channel: "whatsapp", State: bus.ChannelReconnecting,
+		Error: "connection refused", Attempt: 2, RetryIn: 4 * time.Second})
+	e := <-ch
+	if e.Type != events.TypeChannel || e.Message != "reconnecting" || e.Fields["previous"] != "connected" ||
+		e.Fields["error"] != "connection refused" || e.Fields["attempt"] != 2 || e.Fields["retry_in"] != "4s" {
+		t.Errorf("event = %+v", e)
+	}
+	// The next poll finds the state already published
+	publishStateChanges(m.lastStates, map[string]string{"whatsapp": "reconnecting"})
+	select {
+	case e := <-ch:
+		t.Errorf("state published twice: %+v", e)
+	default:
+	}
+}
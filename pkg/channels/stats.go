@@ -0,0 +1,114 @@
+package channels
+
+import (
+	"sync/atomic"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/crash"
+	"github.com/sipeed/picoclaw/pkg/events"
+)
+
+// Stats counts what a channel has handled since it was created.
+type Stats struct {
+	Received   int64 `json:"received"`    // Messages, reactions, and changes published to the bus
+	Sent       int64 `json:"sent"`        // Messages sent to chats
+	SendFailed int64 `json:"send_failed"` // Sends that returned an error
+	Dropped    int64 `json:"dropped"`     // Inbound messages from senders not allowed or blocked, groups awaiting approval, and redeliveries
+	Filtered   int64 `json:"filtered"`    // Inbound messages dropped by an added filter, see AddFilter
+	Panics     int64 `json:"panics"`      // Panics recovered in the channel's handlers and sends
+}
+
+// StatsChannel is implemented by channels that count their traffic. Every
+// channel built on BaseChannel implements it.
+type StatsChannel interface {
+	Stats() Stats
+}
+
+type channelStats struct {
+	received, sent, sendFailed, dropped, filtered, panics atomic.Int64
+}
+
+// Stats implements StatsChannel.
+func (c *BaseChannel) Stats() Stats {
+	return Stats{
+		Received:   c.stats.received.Load(),
+		Sent:       c.stats.sent.Load(),
+		SendFailed: c.stats.sendFailed.Load(),
+		Dropped:    c.stats.dropped.Load(),
+		Filtered:   c.stats.filtered.Load(),
+		Panics:     c.stats.panics.Load(),
+	}
+}
+
+// Recover is crash.Recover for the channel's event handlers, counting the
+// panic in its stats. It must be deferred directly:
+//
+//	defer c.Recover()
+func (c *BaseChannel) Recover() {
+	if r := recover(); r != nil {
+		c.stats.panics.Add(1)
+		crash.Capture(c.name, r, nil)
+	}
+}
+
+// publish hands an inbound message that passed every check to the bus.
+func (c *BaseChannel) publish(msg bus.InboundMessage) {
+	c.stats.received.Add(1)
+	c.bus.PublishInbound(msg)
+}
+
+// drop counts an inbound message that is not passed on, such as a
+// redelivery, and reports why; see reportDrop.
+func (c *BaseChannel) drop(msg *bus.InboundMessage, reason string) {
+	c.stats.dropped.Add(1)
+	c.reportDrop(msg, reason, nil)
+}
+
+// reportDrop publishes a dropped event for msg. Senders off the allowlist
+// are reported as security events instead, see admits.
+func (c *BaseChannel) reportDrop(msg *bus.InboundMessage, reason string, fields map[string]interface{}) {
+	if fields == nil {
+		fields = make(map[string]interface{}, 1)
+	}
+	fields["kind"] = inboundKind(msg)
+	events.Publish(events.Event{
+		Type:     events.TypeDropped,
+		Channel:  c.name,
+		ChatID:   msg.ChatID,
+		SenderID: msg.SenderID,
+		Message:  reason,
+		Fields:   fields,
+	})
+}
+
+// statsRecorder is implemented by channels built on BaseChannel, for the
+// manager to count their sends.
+type statsRecorder interface {
+	recordSend(err error, panicked bool)
+}
+
+func (c *BaseChannel) recordSend(err error, panicked bool) {
+	switch {
+	case panicked:
+		c.stats.panics.Add(1)
+		c.stats.sendFailed.Add(1)
+	case err != nil:
+		c.stats.sendFailed.Add(1)
+	default:
+		c.stats.sent.Add(1)
+	}
+}
+
+// ChannelStats returns each channel's counters, for channels that keep
+// them.
+func (m *Manager) ChannelStats() map[string]Stats {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	stats := make(map[string]Stats, len(m.channels))
+	for name, channel := range m.channels {
+		if sc, ok := channel.(StatsChannel); ok {
+			stats[name] = sc.Stats()
+		}
+	}
+	return stats
+}
@@ -0,0 +1,52 @@
+package channels
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/events"
+)
+
+func TestBaseChannelStats(t *testing.T) {
+	feed, unsubscribe := events.Default.Subscribe(16)
+	defer unsubscribe()
+
+	msgBus := bus.NewMessageBus()
+	ch := &flakyChannel{BaseChannel: NewBaseChannel("sms", nil, msgBus, []string{"alice"})}
+	ch.AddFilter("no-links", func(msg *bus.InboundMessage) bool { return msg.Content != "http://spam" })
+
+	ch.HandleMessage("alice", "1", "hi", nil, nil)
+	ch.HandleReaction("alice", "1", bus.Reaction{MessageID: "7", Emoji: "🎉"}, nil)
+	ch.HandleMessage("mallory", "1", "hi", nil, nil)
+	ch.HandleMessage("alice", "1", "http://spam", nil, nil)
+	func() {
+		defer ch.Recover()
+		panic("handler bug")
+	}()
+
+	ctx := context.Background()
+	sendProtected(ctx, ch, bus.OutboundMessage{Channel: "sms", ChatID: "1", Content: "ok"})
+	ch.fail = true
+	sendProtected(ctx, ch, bus.OutboundMessage{Channel: "sms", ChatID: "1", Content: "lost"})
+
+	want := Stats{Received: 2, Sent: 1, SendFailed: 1, Dropped: 1, Filtered: 1, Panics: 1}
+	if got := ch.Stats(); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+
+	var dropped *events.Event
+	for dropped == nil {
+		select {
+		case e := <-feed:
+			if e.Type == events.TypeDropped {
+				dropped = &e
+			}
+		default:
+			t.Fatal("no dropped event published")
+		}
+	}
+	if dropped.Channel != "sms" || dropped.Message != "filter" || dropped.Fields["filter"] != "no-links" {
+		t.Errorf("dropped event = %+v", dropped)
+	}
+}
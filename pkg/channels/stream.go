@@ -0,0 +1,63 @@
+package channels
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/render"
+)
+
+// streamChunker turns streaming updates into incremental messages for
+// channels that cannot edit what they have already sent. Each completed
+// paragraph is sent once; the final message only carries the remainder.
+// Code blocks and lists are held back until they are complete, so they are
+// never sent in pieces.
+type streamChunker struct {
+	mu   sync.Mutex
+	sent map[string]string // channel:chatID -> text already delivered
+}
+
+func newStreamChunker() *streamChunker {
+	return &streamChunker{sent: make(map[string]string)}
+}
+
+// prepare returns the message to deliver for msg and whether anything
+// should be sent at all.
+func (s *streamChunker) prepare(msg bus.OutboundMessage) (bus.OutboundMessage, bool) {
+	key := msg.Channel + ":" + msg.ChatID
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sent := s.sent[key]
+	if sent != "" && !strings.HasPrefix(msg.Content, sent) {
+		// A new response started (e.g. after a tool call); forget the old one.
+		sent = ""
+		delete(s.sent, key)
+	}
+
+	if msg.Partial {
+		end := render.LastBreak(msg.Content)
+		if end < 0 || end <= len(sent) {
+			return msg, false
+		}
+		chunk := strings.TrimSpace(msg.Content[len(sent):end])
+		s.sent[key] = msg.Content[:end]
+		if chunk == "" {
+			return msg, false
+		}
+		return bus.OutboundMessage{Channel: msg.Channel, ChatID: msg.ChatID, Content: chunk}, true
+	}
+
+	delete(s.sent, key)
+	if sent == "" {
+		return msg, true
+	}
+	rest := strings.TrimSpace(msg.Content[len(sent):])
+	if rest == "" && len(msg.Media) == 0 {
+		return msg, false
+	}
+	msg.Content = rest
+	return msg, true
+}
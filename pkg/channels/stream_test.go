@@ -0,0 +1,69 @@
+package channels
+
+import (
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+func TestStreamChunker(t *testing.T) {
+	c := newStreamChunker()
+	partial := func(content string) bus.OutboundMessage {
+		return bus.OutboundMessage{Channel: "whatsapp", ChatID: "1", Content: content, Partial: true}
+	}
+
+	steps := []struct {
+		name     string
+		msg      bus.OutboundMessage
+		wantSend bool
+		want     string
+	}{
+		{"no paragraph yet", partial("First para"), false, ""},
+		{"first paragraph complete", partial("First para.\n\nSecond"), true, "First para."},
+		{"no new paragraph", partial("First para.\n\nSecond para"), false, ""},
+		{"final sends remainder", bus.OutboundMessage{Channel: "whatsapp", ChatID: "1", Content: "First para.\n\nSecond para."}, true, "Second para."},
+		{"unrelated final sent whole", bus.OutboundMessage{Channel: "whatsapp", ChatID: "1", Content: "Hello"}, true, "Hello"},
+	}
+
+	for _, tt := range steps {
+		got, send := c.prepare(tt.msg)
+		if send != tt.wantSend {
+			t.Fatalf("%s: send = %v, want %v", tt.name, send, tt.wantSend)
+		}
+		if send && got.Content != tt.want {
+			t.Errorf("%s: content = %q, want %q", tt.name, got.Content, tt.want)
+		}
+		if send && got.Partial {
+			t.Errorf("%s: chunk must not be marked partial", tt.name)
+		}
+	}
+}
+
+func TestStreamChunkerHoldsBlocks(t *testing.T) {
+	c := newStreamChunker()
+	partial := func(content string) bus.OutboundMessage {
+		return bus.OutboundMessage{Channel: "whatsapp", ChatID: "1", Content: content, Partial: true}
+	}
+
+	steps := []struct {
+		name     string
+		msg      bus.OutboundMessage
+		wantSend bool
+		want     string
+	}{
+		{"blank line inside code", partial("```go\nfunc a() {}\n\nfunc b"), false, ""},
+		{"code block complete", partial("```go\nfunc a() {}\n\nfunc b() {}\n```\n\nThen"), true, "```go\nfunc a() {}\n\nfunc b() {}\n```"},
+		{"blank line between items", partial("```go\nfunc a() {}\n\nfunc b() {}\n```\n\nThen\n\n- one\n\n- two"), true, "Then"},
+		{"list still open", partial("```go\nfunc a() {}\n\nfunc b() {}\n```\n\nThen\n\n- one\n\n- two\n\n"), false, ""},
+	}
+
+	for _, tt := range steps {
+		got, send := c.prepare(tt.msg)
+		if send != tt.wantSend {
+			t.Fatalf("%s: send = %v, want %v", tt.name, send, tt.wantSend)
+		}
+		if send && got.Content != tt.want {
+			t.Errorf("%s: content = %q, want %q", tt.name, got.Content, tt.want)
+		}
+	}
+}
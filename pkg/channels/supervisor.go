@@ -0,0 +1,229 @@
+package channels
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/crash"
+	"github.com/sipeed/picoclaw/pkg/events"
+	"github.com/sipeed/picoclaw/pkg/i18n"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+const (
+	// supervisorBackoff is how long the supervisor waits after the first
+	// restart of a channel before trying again; each further restart
+	// doubles it, up to the configured maximum.
+	supervisorBackoff = 10 * time.Second
+	// supervisorSteady is how long a restarted channel has to stay up to
+	// count as recovered, so that one which crashes again soon after each
+	// restart keeps backing off.
+	supervisorSteady = 2 * time.Minute
+)
+
+// Go runs loop, one of the channel's long-lived goroutines such as its
+// event loop, until ctx is cancelled. A loop that panics or returns while
+// ctx is still live has crashed: the channel is marked stopped, for the
+// manager's supervisor to restart.
+func (c *BaseChannel) Go(ctx context.Context, loop func()) {
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				c.stats.panics.Add(1)
+				crash.Capture(c.name, r, nil)
+			}
+			if ctx.Err() == nil {
+				logger.ErrorC(c.name, "Channel loop exited, marking channel stopped")
+				c.setRunning(false)
+			}
+		}()
+		loop()
+	}()
+}
+
+// supervisor restarts channels that have stopped, or that have been
+// reconnecting for too long, see config.SupervisorConfig.
+type supervisor struct {
+	m          *Manager
+	downAfter  time.Duration
+	maxBackoff time.Duration
+	alertAfter int
+	alertTo    []string
+	channels   map[string]*supervised
+}
+
+// supervised is what the supervisor knows of one channel.
+type supervised struct {
+	upSince   time.Time // When it was first seen up, zero while down
+	downSince time.Time // When it was first seen down or last restarted, zero while up
+	nextTry   time.Time // No restart before this
+	restarts  int       // Restarts since it last stayed up
+	alerted   bool      // Reported as failing
+}
+
+func newSupervisor(m *Manager, cfg config.SupervisorConfig) *supervisor {
+	s := &supervisor{
+		m:          m,
+		downAfter:  time.Duration(cfg.DownAfter) * time.Second,
+		maxBackoff: time.Duration(cfg.MaxBackoff) * time.Second,
+		alertAfter: cfg.AlertAfter,
+		alertTo:    cfg.AlertTo,
+		channels:   make(map[string]*supervised),
+	}
+	if s.downAfter <= 0 {
+		s.downAfter = 5 * time.Minute
+	}
+	if s.maxBackoff <= 0 {
+		s.maxBackoff = 10 * time.Minute
+	}
+	if s.alertAfter <= 0 {
+		s.alertAfter = 3
+	}
+	return s
+}
+
+// run checks the channels as often as their states are watched, until ctx
+// is cancelled.
+func (s *supervisor) run(ctx context.Context) {
+	ticker := time.NewTicker(channelStateInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.check(ctx, now)
+		}
+	}
+}
+
+// check restarts the channels this instance holds that are due for it.
+func (s *supervisor) check(ctx context.Context, now time.Time) {
+	for name, state := range s.m.ChannelStates() {
+		w, ok := s.channels[name]
+		if !ok {
+			w = &supervised{}
+			s.channels[name] = w
+		}
+		switch state {
+		case "connected", "running":
+			w.downSince = time.Time{}
+			if w.upSince.IsZero() {
+				w.upSince = now
+			}
+			if w.restarts > 0 && now.Sub(w.upSince) >= supervisorSteady {
+				s.recovered(ctx, name, w)
+			}
+			continue
+		case "reconnecting":
+			w.upSince = time.Time{}
+			if w.downSince.IsZero() {
+				w.downSince = now
+			}
+			if now.Sub(w.downSince) < s.downAfter {
+				continue
+			}
+		case "stopped":
+			w.upSince = time.Time{}
+		case "degraded":
+			// Up, but its sends fail: a restart will not help, the circuit
+			// breaker's probes find when it can send again
+			continue
+		default:
+			// Held by another instance, which supervises it
+			delete(s.channels, name)
+			continue
+		}
+		if now.Before(w.nextTry) || ctx.Err() != nil {
+			continue
+		}
+		s.restart(ctx, name, state, w, now)
+	}
+}
+
+// restart restarts a channel that is down, backing off before the next
+// attempt, and reports it as failing once restarts have not helped.
+func (s *supervisor) restart(ctx context.Context, name, state string, w *supervised, now time.Time) {
+	w.restarts++
+	w.downSince = now
+	w.nextTry = now.Add(s.backoff(w.restarts))
+	logger.WarnCF("channels", "Supervisor restarting channel", map[string]interface{}{
+		"channel":  name,
+		"state":    state,
+		"restarts": w.restarts,
+	})
+	if err := s.m.RestartChannel(ctx, name); err != nil {
+		logger.WarnCF("channels", "Supervisor could not restart channel", map[string]interface{}{
+			"channel": name,
+			"error":   err.Error(),
+		})
+	}
+	if w.restarts < s.alertAfter || w.alerted {
+		return
+	}
+	w.alerted = true
+	logger.ErrorCF("channels", "Channel keeps failing", map[string]interface{}{
+		"channel":  name,
+		"state":    state,
+		"restarts": w.restarts,
+	})
+	events.Publish(events.Event{
+		Type:    events.TypeChannelFailing,
+		Channel: name,
+		Message: state,
+		Fields:  map[string]interface{}{"restarts": w.restarts, "recovered": false},
+	})
+	s.notify(ctx, name, func(channel, chatID string) string {
+		return i18n.T(channel, chatID, "channel.failing", name, w.restarts)
+	})
+}
+
+// recovered forgets the restarts of a channel that has stayed up, telling
+// whoever heard it was failing.
+func (s *supervisor) recovered(ctx context.Context, name string, w *supervised) {
+	logger.InfoCF("channels", "Channel recovered", map[string]interface{}{
+		"channel":  name,
+		"restarts": w.restarts,
+	})
+	if w.alerted {
+		events.Publish(events.Event{
+			Type:    events.TypeChannelFailing,
+			Channel: name,
+			Message: "recovered",
+			Fields:  map[string]interface{}{"restarts": w.restarts, "recovered": true},
+		})
+		s.notify(ctx, name, func(channel, chatID string) string {
+			return i18n.T(channel, chatID, "channel.recovered", name)
+		})
+	}
+	*w = supervised{upSince: w.upSince}
+}
+
+// backoff is how long to wait after the given number of restarts in a row.
+func (s *supervisor) backoff(restarts int) time.Duration {
+	wait := supervisorBackoff
+	for i := 1; i < restarts && wait < s.maxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, s.maxBackoff)
+}
+
+// notify sends text to the alert chats, skipping ones on the failing
+// channel itself.
+func (s *supervisor) notify(ctx context.Context, failing string, text func(channel, chatID string) string) {
+	for _, target := range s.alertTo {
+		channel, chatID, ok := strings.Cut(target, ":")
+		if !ok || channel == failing {
+			continue
+		}
+		if err := s.m.SendToChannel(ctx, channel, chatID, text(channel, chatID)); err != nil {
+			logger.WarnCF("channels", "Failed to send channel alert", map[string]interface{}{
+				"channel": channel,
+				"chat_id": chatID,
+				"error":   err.Error(),
+			})
+		}
+	}
+}
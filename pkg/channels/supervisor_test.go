@@ -0,0 +1,159 @@
+package channels
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/events"
+)
+
+// crashyChannel fails to start while failStart is set, and reports
+// connected as it is told.
+type crashyChannel struct {
+	*BaseChannel
+	failStart bool
+	connected bool
+	starts    int
+}
+
+func (c *crashyChannel) Start(ctx context.Context) error {
+	c.starts++
+	if c.failStart {
+		return errors.New("login rejected")
+	}
+	c.setRunning(true)
+	return nil
+}
+
+func (c *crashyChannel) Stop(ctx context.Context) error {
+	c.setRunning(false)
+	return nil
+}
+
+func (c *crashyChannel) Send(ctx context.Context, msg bus.OutboundMessage) error { return nil }
+func (c *crashyChannel) Connected() bool                                         { return c.connected }
+
+func TestBaseChannelGo(t *testing.T) {
+	ch := NewBaseChannel("sms", nil, bus.NewMessageBus(), nil)
+	ch.setRunning(true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	ch.Go(ctx, func() {
+		<-ctx.Done()
+		close(done)
+	})
+	cancel()
+	<-done
+	time.Sleep(10 * time.Millisecond)
+	if !ch.IsRunning() {
+		t.Error("a loop ending with its context marked the channel stopped")
+	}
+
+	ch.Go(context.Background(), func() { panic("nil map") })
+	deadline := time.Now().Add(time.Second)
+	for ch.IsRunning() && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if ch.IsRunning() {
+		t.Error("a crashed loop left the channel running")
+	}
+	if got := ch.Stats().Panics; got != 1 {
+		t.Errorf("Panics = %d, want 1", got)
+	}
+}
+
+func TestSupervisorRestartsAndAlerts(t *testing.T) {
+	feed, unsubscribe := events.Default.Subscribe(64)
+	defer unsubscribe()
+
+	msgBus := bus.NewMessageBus()
+	sms := &crashyChannel{BaseChannel: NewBaseChannel("sms", nil, msgBus, nil), failStart: true}
+	ops := &flakyChannel{BaseChannel: NewBaseChannel("ops", nil, msgBus, nil)}
+	ctx := context.Background()
+	m := &Manager{
+		channels: map[string]Channel{"sms": sms, "ops": ops},
+		chunker:  newStreamChunker(),
+		runCtx:   ctx,
+	}
+	ops.setRunning(true)
+	s := newSupervisor(m, config.SupervisorConfig{
+		DownAfter:  60,
+		MaxBackoff: 30,
+		AlertAfter: 2,
+		AlertTo:    []string{"ops:42", "sms:1"},
+	})
+
+	t0 := time.Now()
+	s.check(ctx, t0)
+	s.check(ctx, t0.Add(5*time.Second))
+	if sms.starts != 1 {
+		t.Fatalf("starts = %d after first checks, want 1", sms.starts)
+	}
+	if len(ops.sent) != 0 {
+		t.Fatalf("alerted after one restart: %v", ops.sent)
+	}
+
+	s.check(ctx, t0.Add(10*time.Second))
+	if sms.starts != 2 || len(ops.sent) != 1 || !strings.Contains(ops.sent[0], "sms") {
+		t.Fatalf("starts = %d, alerts = %v", sms.starts, ops.sent)
+	}
+
+	// Backoff doubles, then is capped
+	if got := s.backoff(2); got != 20*time.Second {
+		t.Errorf("backoff(2) = %v, want 20s", got)
+	}
+	if got := s.backoff(5); got != 30*time.Second {
+		t.Errorf("backoff(5) = %v, want 30s", got)
+	}
+
+	sms.failStart = false
+	sms.connected = true
+	s.check(ctx, t0.Add(29*time.Second))
+	s.check(ctx, t0.Add(30*time.Second))
+	if sms.starts != 3 || !sms.IsRunning() {
+		t.Fatalf("starts = %d, running = %v", sms.starts, sms.IsRunning())
+	}
+	s.check(ctx, t0.Add(40*time.Second))
+	s.check(ctx, t0.Add(40*time.Second+supervisorSteady))
+	if len(ops.sent) != 2 || !strings.Contains(ops.sent[1], "back up") {
+		t.Fatalf("alerts = %v, want a recovery notice", ops.sent)
+	}
+	if s.channels["sms"].restarts != 0 {
+		t.Errorf("restarts not reset after recovery")
+	}
+
+	// A channel that keeps reconnecting is left alone until DownAfter
+	sms.connected = false
+	t1 := t0.Add(time.Hour)
+	s.check(ctx, t1)
+	s.check(ctx, t1.Add(59*time.Second))
+	if sms.starts != 3 {
+		t.Fatalf("restarted a channel reconnecting for under a minute")
+	}
+	s.check(ctx, t1.Add(time.Minute))
+	if sms.starts != 4 {
+		t.Fatalf("starts = %d, want a restart after DownAfter", sms.starts)
+	}
+
+	var failing, recovered bool
+	for len(feed) > 0 {
+		e := <-feed
+		if e.Type != events.TypeChannelFailing || e.Channel != "sms" {
+			continue
+		}
+		if e.Fields["recovered"] == true {
+			recovered = true
+		} else {
+			failing = true
+		}
+	}
+	if !failing || !recovered {
+		t.Errorf("channel_failing events: failing = %v, recovered = %v", failing, recovered)
+	}
+}
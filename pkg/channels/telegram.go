@@ -6,7 +6,8 @@ import (
 	"net/http"
 	"net/url"
 	"os"
-	"regexp"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -16,7 +17,9 @@ import (
 
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/i18n"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/render"
 	"github.com/sipeed/picoclaw/pkg/utils"
 	"github.com/sipeed/picoclaw/pkg/voice"
 )
@@ -28,18 +31,25 @@ type TelegramChannel struct {
 	chatIDs      map[string]int64
 	transcriber  *voice.GroqTranscriber
 	placeholders sync.Map // chatID -> messageID
-	stopThinking sync.Map // chatID -> thinkingCancel
+	own          *ownMessages
+	ctx          context.Context
+	cancel       context.CancelFunc
 }
 
-type thinkingCancel struct {
-	fn context.CancelFunc
-}
-
-func (c *thinkingCancel) Cancel() {
-	if c != nil && c.fn != nil {
-		c.fn()
-	}
-}
+const (
+	// placeholderDelay is how long the agent works before the chat gets
+	// a "thinking" placeholder; quick replies go out without one.
+	placeholderDelay = time.Second
+	// placeholderGrace is how long after the agent is done an unused
+	// placeholder waits for the reply to replace it before it is deleted.
+	placeholderGrace = 10 * time.Second
+	// telegramTypingInterval renews the typing action, which Telegram
+	// shows for about five seconds.
+	telegramTypingInterval = 4 * time.Second
+	// telegramOwnMessages is how many of the bot's latest messages are
+	// remembered, so reactions to them can be told apart.
+	telegramOwnMessages = 1000
+)
 
 func NewTelegramChannel(cfg config.TelegramConfig, bus *bus.MessageBus) (*TelegramChannel, error) {
 	var opts []telego.BotOption
@@ -70,7 +80,7 @@ func NewTelegramChannel(cfg config.TelegramConfig, bus *bus.MessageBus) (*Telegr
 		chatIDs:      make(map[string]int64),
 		transcriber:  nil,
 		placeholders: sync.Map{},
-		stopThinking: sync.Map{},
+		own:          newOwnMessages(telegramOwnMessages),
 	}, nil
 }
 
@@ -81,10 +91,17 @@ func (c *TelegramChannel) SetTranscriber(transcriber *voice.GroqTranscriber) {
 func (c *TelegramChannel) Start(ctx context.Context) error {
 	logger.InfoC("telegram", "Starting Telegram bot (polling mode)...")
 
+	c.ctx, c.cancel = context.WithCancel(ctx)
+	ctx = c.ctx
+
 	updates, err := c.bot.UpdatesViaLongPolling(ctx, &telego.GetUpdatesParams{
 		Timeout: 30,
+		// Reactions, button presses, and the bot's own membership changes
+		// are only delivered when asked for
+		AllowedUpdates: []string{"message", "message_reaction", "callback_query", "my_chat_member"},
 	})
 	if err != nil {
+		c.cancel()
 		return fmt.Errorf("failed to start long polling: %w", err)
 	}
 
@@ -93,28 +110,40 @@ func (c *TelegramChannel) Start(ctx context.Context) error {
 		"username": c.bot.Username(),
 	})
 
-	go func() {
+	c.Go(ctx, func() {
 		for {
 			select {
 			case <-ctx.Done():
 				return
 			case update, ok := <-updates:
 				if !ok {
-					logger.InfoC("telegram", "Updates channel closed, reconnecting...")
+					logger.WarnC("telegram", "Updates channel closed")
 					return
 				}
-				if update.Message != nil {
+				if update.Message != nil && !c.handleMembership(update.Message) {
 					c.handleMessage(ctx, update)
 				}
+				if update.MyChatMember != nil {
+					c.handleMyChatMember(update.MyChatMember)
+				}
+				if update.MessageReaction != nil {
+					c.handleReaction(update.MessageReaction)
+				}
+				if update.CallbackQuery != nil {
+					c.handleCallback(ctx, update.CallbackQuery)
+				}
 			}
 		}
-	}()
+	})
 
 	return nil
 }
 
 func (c *TelegramChannel) Stop(ctx context.Context) error {
 	logger.InfoC("telegram", "Stopping Telegram bot...")
+	if c.cancel != nil {
+		c.cancel()
+	}
 	c.setRunning(false)
 	return nil
 }
@@ -124,28 +153,145 @@ func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) err
 		return fmt.Errorf("telegram bot not running")
 	}
 
+	msg.ChatID = threadedChatID(msg)
 	chatID, err := parseChatID(msg.ChatID)
 	if err != nil {
 		return fmt.Errorf("invalid chat ID: %w", err)
 	}
 
-	// Stop thinking animation
-	if stop, ok := c.stopThinking.Load(msg.ChatID); ok {
-		if cf, ok := stop.(*thinkingCancel); ok && cf != nil {
-			cf.Cancel()
+	if msg.Partial {
+		return c.sendPartial(ctx, chatID, msg)
+	}
+
+	if len(msg.Media) > 0 {
+		return c.sendWithMedia(ctx, chatID, msg)
+	}
+
+	return c.sendText(ctx, chatID, msg)
+}
+
+// Capabilities reports that Telegram takes HTML, attachments, edits for
+// streaming, and inline keyboard buttons, in messages of up to 4096
+// characters. Bots may upload files of up to 50 MB.
+func (c *TelegramChannel) Capabilities() render.Capabilities {
+	return render.Capabilities{Markup: render.HTML, Media: true, Edits: true, Buttons: true, MaxLength: 4096, MaxAttachment: 50 << 20}
+}
+
+// StartIndicator shows the chat as typing while the agent works, and
+// after placeholderDelay a "thinking" placeholder that the reply replaces.
+// A placeholder the reply did not use is deleted after placeholderGrace.
+func (c *TelegramChannel) StartIndicator(ctx context.Context, chatIDStr, _ string) func() {
+	chatID, err := parseChatID(chatIDStr)
+	if err != nil {
+		return func() {}
+	}
+	topicID := parseTopicID(chatIDStr)
+
+	workCtx, cancel := context.WithCancel(ctx)
+	placeholderID := 0
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(telegramTypingInterval)
+		defer ticker.Stop()
+		delay := time.NewTimer(placeholderDelay)
+		defer delay.Stop()
+		typing := func() {
+			action := tu.ChatAction(tu.ID(chatID), telego.ChatActionTyping)
+			action.MessageThreadID = topicID
+			if err := c.bot.SendChatAction(workCtx, action); err != nil && workCtx.Err() == nil {
+				logger.ErrorCF("telegram", "Failed to send chat action", map[string]interface{}{
+					"error": err.Error(),
+				})
+			}
+		}
+		typing()
+		for {
+			select {
+			case <-workCtx.Done():
+				return
+			case <-ticker.C:
+				typing()
+			case <-delay.C:
+				if _, ok := c.placeholders.Load(chatIDStr); ok {
+					continue // A streamed reply is already showing
+				}
+				placeholder := tu.Message(tu.ID(chatID), i18n.T(c.Name(), chatIDStr, "thinking"))
+				placeholder.MessageThreadID = topicID
+				if sent, err := c.bot.SendMessage(workCtx, placeholder); err == nil {
+					placeholderID = sent.MessageID
+					c.placeholders.Store(chatIDStr, placeholderID)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+		if placeholderID == 0 {
+			return
+		}
+		time.AfterFunc(placeholderGrace, func() {
+			if c.placeholders.CompareAndDelete(chatIDStr, placeholderID) {
+				c.bot.DeleteMessage(context.Background(), tu.Delete(tu.ID(chatID), placeholderID))
+			}
+		})
+	}
+}
+
+// sendWithMedia sends the text (if any) followed by each attachment, as a
+// photo for images and as a document otherwise.
+func (c *TelegramChannel) sendWithMedia(ctx context.Context, chatID int64, msg bus.OutboundMessage) error {
+	if strings.TrimSpace(msg.Content) != "" {
+		if err := c.sendText(ctx, chatID, msg); err != nil {
+			return err
+		}
+	} else if pID, ok := c.placeholders.LoadAndDelete(msg.ChatID); ok {
+		c.bot.DeleteMessage(ctx, tu.Delete(tu.ID(chatID), pID.(int)))
+	}
+
+	for _, path := range msg.Media {
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to open attachment: %w", err)
+		}
+		var sent *telego.Message
+		if utils.IsImageFile(path, "") {
+			photo := tu.Photo(tu.ID(chatID), tu.File(f))
+			photo.MessageThreadID = parseTopicID(msg.ChatID)
+			sent, err = c.bot.SendPhoto(ctx, photo)
+		} else {
+			doc := tu.Document(tu.ID(chatID), tu.File(f))
+			doc.MessageThreadID = parseTopicID(msg.ChatID)
+			sent, err = c.bot.SendDocument(ctx, doc)
+		}
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("failed to send attachment %s: %w", filepath.Base(path), err)
 		}
-		c.stopThinking.Delete(msg.ChatID)
+		c.sent(ctx, chatID, sent.MessageID)
 	}
+	return nil
+}
 
-	htmlContent := markdownToTelegramHTML(msg.Content)
+// sendText delivers a reply already rendered as HTML, replacing the
+// thinking placeholder when there is one.
+func (c *TelegramChannel) sendText(ctx context.Context, chatID int64, msg bus.OutboundMessage) error {
+	htmlContent := msg.Content
+	keyboard := inlineKeyboard(msg)
+	quickReplies := replyKeyboard(msg)
 
-	// Try to edit placeholder
-	if pID, ok := c.placeholders.Load(msg.ChatID); ok {
+	// Try to edit placeholder. An edit cannot add a reply keyboard, so the
+	// placeholder is left for the indicator to delete then.
+	if pID, ok := c.placeholders.Load(msg.ChatID); ok && quickReplies == nil {
 		c.placeholders.Delete(msg.ChatID)
 		editMsg := tu.EditMessageText(tu.ID(chatID), pID.(int), htmlContent)
 		editMsg.ParseMode = telego.ModeHTML
+		editMsg.ReplyMarkup = keyboard
 
-		if _, err = c.bot.EditMessageText(ctx, editMsg); err == nil {
+		if edited, err := c.bot.EditMessageText(ctx, editMsg); err == nil {
+			c.sent(ctx, chatID, edited.MessageID)
 			return nil
 		}
 		// Fallback to new message if edit fails
@@ -153,20 +299,308 @@ func (c *TelegramChannel) Send(ctx context.Context, msg bus.OutboundMessage) err
 
 	tgMsg := tu.Message(tu.ID(chatID), htmlContent)
 	tgMsg.ParseMode = telego.ModeHTML
+	tgMsg.MessageThreadID = parseTopicID(msg.ChatID)
+	if keyboard != nil {
+		tgMsg.ReplyMarkup = keyboard
+	} else if quickReplies != nil {
+		tgMsg.ReplyMarkup = quickReplies
+		// Pressing a quick reply sends its text, which is mapped back to
+		// its data
+		var choices []bus.Choice
+		for _, choice := range msg.Choices() {
+			if choice.Kind == bus.InteractionQuickReply {
+				choices = append(choices, choice)
+			}
+		}
+		c.OfferChoices(msg.ChatID, choices)
+	}
 
-	if _, err = c.bot.SendMessage(ctx, tgMsg); err != nil {
+	sent, err := c.bot.SendMessage(ctx, tgMsg)
+	if err != nil {
 		logger.ErrorCF("telegram", "HTML parse failed, falling back to plain text", map[string]interface{}{
 			"error": err.Error(),
 		})
 		tgMsg.ParseMode = ""
-		_, err = c.bot.SendMessage(ctx, tgMsg)
+		if sent, err = c.bot.SendMessage(ctx, tgMsg); err != nil {
+			return err
+		}
+	}
+	c.sent(ctx, chatID, sent.MessageID)
+	return nil
+}
+
+// sent remembers a message the bot sent, and reports it to the delivery
+// being tracked.
+func (c *TelegramChannel) sent(ctx context.Context, chatID int64, messageID int) {
+	id := strconv.Itoa(messageID)
+	c.own.add(fmt.Sprintf("%d", chatID), id)
+	reportSent(ctx, id)
+}
+
+// inlineKeyboard lays buttons out one per row, followed by the menu's
+// options, since Telegram has no drop-down. Quick replies join them when
+// there are any, as a message has only one keyboard. It returns nil when
+// there is nothing to lay out.
+func inlineKeyboard(msg bus.OutboundMessage) *telego.InlineKeyboardMarkup {
+	buttons := append([]bus.Button(nil), msg.Buttons...)
+	if msg.Menu != nil {
+		buttons = append(buttons, msg.Menu.Options...)
+	}
+	if len(buttons) == 0 {
+		return nil
+	}
+	buttons = append(buttons, msg.QuickReplies...)
+	rows := make([][]telego.InlineKeyboardButton, 0, len(buttons))
+	for _, b := range buttons {
+		button := tu.InlineKeyboardButton(b.Text)
+		if b.URL != "" {
+			button = button.WithURL(b.URL)
+		} else {
+			button = button.WithCallbackData(b.Data)
+		}
+		rows = append(rows, tu.InlineKeyboardRow(button))
+	}
+	return tu.InlineKeyboard(rows...)
+}
+
+// replyKeyboard offers quick replies in place of the user's keyboard until
+// one is used, or returns nil when inlineKeyboard has them or there are
+// none.
+func replyKeyboard(msg bus.OutboundMessage) *telego.ReplyKeyboardMarkup {
+	if len(msg.QuickReplies) == 0 || len(msg.Buttons) > 0 || msg.Menu != nil {
+		return nil
+	}
+	rows := make([][]telego.KeyboardButton, 0, len(msg.QuickReplies))
+	for _, b := range msg.QuickReplies {
+		rows = append(rows, tu.KeyboardRow(tu.KeyboardButton(b.Text)))
+	}
+	return tu.Keyboard(rows...).WithResizeKeyboard().WithOneTimeKeyboard()
+}
+
+// sendPartial shows streaming progress by editing the chat's placeholder
+// message, creating one if needed. The placeholder is kept so the final
+// Send replaces it with the formatted answer.
+func (c *TelegramChannel) sendPartial(ctx context.Context, chatID int64, msg bus.OutboundMessage) error {
+	if pID, ok := c.placeholders.Load(msg.ChatID); ok {
+		_, err := c.bot.EditMessageText(ctx, tu.EditMessageText(tu.ID(chatID), pID.(int), msg.Content))
 		return err
 	}
 
+	tgMsg := tu.Message(tu.ID(chatID), msg.Content)
+	tgMsg.MessageThreadID = parseTopicID(msg.ChatID)
+	sent, err := c.bot.SendMessage(ctx, tgMsg)
+	if err != nil {
+		return err
+	}
+	c.placeholders.Store(msg.ChatID, sent.MessageID)
 	return nil
 }
 
+// handleMyChatMember reports the bot being added to or removed from a
+// chat. A user blocking the bot counts as removing it from their private
+// chat.
+func (c *TelegramChannel) handleMyChatMember(u *telego.ChatMemberUpdated) {
+	defer c.Recover()
+
+	was, is := u.OldChatMember.MemberIsMember(), u.NewChatMember.MemberIsMember()
+	if was == is {
+		return
+	}
+	eventType := bus.ChatBotAdded
+	if was {
+		eventType = bus.ChatBotRemoved
+	}
+	c.PublishChatEvent(bus.ChatEvent{
+		ChatID:  fmt.Sprintf("%d", u.Chat.ID),
+		Type:    eventType,
+		ActorID: telegramMember(u.From).ID,
+		Direct:  u.Chat.Type == telego.ChatTypePrivate,
+		Name:    u.Chat.Title,
+	})
+}
+
+// handleMembership reports members other than the bot joining and leaving
+// a group, and a group that is archived on moving to a new chat ID as a
+// supergroup. It returns whether m was such a service message.
+func (c *TelegramChannel) handleMembership(m *telego.Message) bool {
+	defer c.Recover()
+
+	chatID := fmt.Sprintf("%d", m.Chat.ID)
+	var actorID string
+	if m.From != nil {
+		actorID = telegramMember(*m.From).ID
+	}
+	switch {
+	case len(m.NewChatMembers) > 0:
+		var members []bus.ChatMember
+		for _, u := range m.NewChatMembers {
+			if u.ID != c.bot.ID() {
+				members = append(members, telegramMember(u))
+			}
+		}
+		if len(members) > 0 {
+			c.HandleChatEvent(chatID, bus.ChatMemberJoined, members, actorID)
+		}
+	case m.LeftChatMember != nil:
+		if m.LeftChatMember.ID != c.bot.ID() {
+			c.HandleChatEvent(chatID, bus.ChatMemberLeft, []bus.ChatMember{telegramMember(*m.LeftChatMember)}, actorID)
+		}
+	case m.MigrateToChatID != 0:
+		c.HandleChatEvent(chatID, bus.ChatArchived, nil, actorID)
+	default:
+		return false
+	}
+	return true
+}
+
+// telegramMember describes a user, with the sender ID their messages
+// carry.
+func telegramMember(u telego.User) bus.ChatMember {
+	id := fmt.Sprintf("%d", u.ID)
+	if u.Username != "" {
+		id += "|" + u.Username
+	}
+	return bus.ChatMember{ID: id, Name: strings.TrimSpace(u.FirstName + " " + u.LastName)}
+}
+
+// handleReaction passes reactions added and removed on to the agent. Telegram
+// does not say whose message was reacted to, so a thumbs-up or thumbs-down
+// anywhere in a chat rates the bot's latest reply there. Reactions to the
+// bot's recent messages are marked as such.
+func (c *TelegramChannel) handleReaction(r *telego.MessageReactionUpdated) {
+	defer c.Recover()
+
+	if r.User == nil || r.User.IsBot {
+		return
+	}
+	senderID := fmt.Sprintf("%d", r.User.ID)
+	if r.User.Username != "" {
+		senderID = fmt.Sprintf("%d|%s", r.User.ID, r.User.Username)
+	}
+
+	// OldReaction and NewReaction list every reaction the user had and now
+	// has on the message
+	chatID := fmt.Sprintf("%d", r.Chat.ID)
+	messageID := fmt.Sprintf("%d", r.MessageID)
+	var on string
+	if c.own.has(chatID, messageID) {
+		on = bus.ReactionOnBot
+	}
+	old := telegramEmoji(r.OldReaction)
+	current := telegramEmoji(r.NewReaction)
+	for emoji := range old {
+		if !current[emoji] {
+			c.HandleReaction(senderID, chatID, bus.Reaction{MessageID: messageID, Emoji: emoji, Remove: true, On: on}, nil)
+		}
+	}
+	for emoji := range current {
+		if !old[emoji] {
+			c.HandleReaction(senderID, chatID, bus.Reaction{MessageID: messageID, Emoji: emoji, On: on}, nil)
+		}
+	}
+}
+
+// telegramEmoji returns the emoji among reactions; custom emoji and paid
+// reactions are left out.
+func telegramEmoji(reactions []telego.ReactionType) map[string]bool {
+	emoji := make(map[string]bool)
+	for _, reaction := range reactions {
+		if e, ok := reaction.(*telego.ReactionTypeEmoji); ok {
+			emoji[e.Emoji] = true
+		}
+	}
+	return emoji
+}
+
+// telegramReactionSubstitutes stand in for common emoji that are not among
+// the reactions Telegram allows.
+var telegramReactionSubstitutes = map[string]string{
+	"✅": "👌",
+	"✔": "👌",
+	"☑": "👌",
+	"❌": "👎",
+	"⏳": "👀",
+	"⌛": "👀",
+	"🚀": "⚡",
+}
+
+// React sets the bot's reaction on a message, or clears it. Bots hold one
+// reaction per message, from Telegram's fixed set, so adding one replaces
+// the last and removing clears whichever is there.
+func (c *TelegramChannel) React(ctx context.Context, chatIDStr string, reaction bus.Reaction) error {
+	chatID, err := parseChatID(chatIDStr)
+	if err != nil {
+		return fmt.Errorf("invalid chat ID: %w", err)
+	}
+	messageID, err := strconv.Atoi(reaction.MessageID)
+	if err != nil {
+		return fmt.Errorf("invalid message ID %q: %w", reaction.MessageID, err)
+	}
+
+	params := &telego.SetMessageReactionParams{ChatID: tu.ID(chatID), MessageID: messageID}
+	if !reaction.Remove {
+		// Telegram's set is written without variation selectors
+		emoji := strings.ReplaceAll(reaction.Emoji, "\uFE0F", "")
+		if sub, ok := telegramReactionSubstitutes[emoji]; ok {
+			emoji = sub
+		}
+		params.Reaction = []telego.ReactionType{&telego.ReactionTypeEmoji{Type: telego.ReactionEmoji, Emoji: emoji}}
+	}
+	return c.bot.SetMessageReaction(ctx, params)
+}
+
+// DeleteMessage implements DeleteChannel.
+func (c *TelegramChannel) DeleteMessage(ctx context.Context, chatIDStr, messageID string) error {
+	chatID, err := parseChatID(chatIDStr)
+	if err != nil {
+		return fmt.Errorf("invalid chat ID: %w", err)
+	}
+	id, err := strconv.Atoi(messageID)
+	if err != nil {
+		return fmt.Errorf("invalid message ID %q: %w", messageID, err)
+	}
+	return c.bot.DeleteMessage(ctx, tu.Delete(tu.ID(chatID), id))
+}
+
+// handleCallback passes a button press on as an interaction, see
+// BaseChannel.HandleInteraction. Menu options are buttons on Telegram.
+func (c *TelegramChannel) handleCallback(ctx context.Context, q *telego.CallbackQuery) {
+	defer c.Recover()
+
+	// Answering stops the button's loading indicator
+	c.bot.AnswerCallbackQuery(ctx, tu.CallbackQuery(q.ID))
+	if q.Data == "" || q.Message == nil {
+		return
+	}
+
+	userID := fmt.Sprintf("%d", q.From.ID)
+	senderID := userID
+	if q.From.Username != "" {
+		senderID = fmt.Sprintf("%s|%s", userID, q.From.Username)
+	}
+	chat := q.Message.GetChat()
+	chatIDStr := fmt.Sprintf("%d", chat.ID)
+	if m := q.Message.Message(); m != nil && m.IsTopicMessage && m.MessageThreadID != 0 {
+		chatIDStr = fmt.Sprintf("%d/%d", chat.ID, m.MessageThreadID)
+	}
+
+	c.HandleInteraction(bus.Interaction{
+		ChatID:    chatIDStr,
+		SenderID:  senderID,
+		Kind:      bus.InteractionButton,
+		Data:      q.Data,
+		MessageID: strconv.Itoa(q.Message.GetMessageID()),
+	}, map[string]string{
+		"user_id":    userID,
+		"username":   q.From.Username,
+		"first_name": q.From.FirstName,
+		"is_group":   fmt.Sprintf("%t", chat.Type != "private"),
+	})
+}
+
 func (c *TelegramChannel) handleMessage(ctx context.Context, update telego.Update) {
+	defer c.Recover()
+
 	message := update.Message
 	if message == nil {
 		return
@@ -184,17 +618,21 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, update telego.Updat
 	}
 
 	// Check allowlist before downloading attachments for rejected users
-	if !c.IsAllowed(userID) && !c.IsAllowed(senderID) {
-		logger.DebugCF("telegram", "Message rejected by allowlist", map[string]interface{}{
-			"user_id":  userID,
-			"username": user.Username,
-		})
+	if !c.Admits(senderID, fmt.Sprintf("%d", message.Chat.ID)) {
 		return
 	}
 
 	chatID := message.Chat.ID
 	c.chatIDs[senderID] = chatID
 
+	// Forum topics are separate conversations, addressed as "chat/topic"
+	chatIDStr := fmt.Sprintf("%d", chatID)
+	topicID := 0
+	if message.IsTopicMessage && message.MessageThreadID != 0 {
+		topicID = message.MessageThreadID
+		chatIDStr = fmt.Sprintf("%d/%d", chatID, topicID)
+	}
+
 	content := ""
 	mediaPaths := []string{}
 	localFiles := []string{} // track temp files for cleanup
@@ -222,76 +660,91 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, update telego.Updat
 		content += message.Caption
 	}
 
-	if message.Photo != nil && len(message.Photo) > 0 {
+	// Attachments are fetched together; each is left out if it fails
+	var dl downloads
+	var photoPath, voicePath, audioPath, docPath string
+	if len(message.Photo) > 0 {
 		photo := message.Photo[len(message.Photo)-1]
-		photoPath := c.downloadPhoto(ctx, photo.FileID)
-		if photoPath != "" {
-			localFiles = append(localFiles, photoPath)
-			mediaPaths = append(mediaPaths, photoPath)
-			if content != "" {
-				content += "\n"
-			}
-			content += fmt.Sprintf("[image: photo]")
+		dl.add(&photoPath, func(ctx context.Context) string { return c.downloadPhoto(ctx, photo.FileID) })
+	}
+	if message.Voice != nil {
+		dl.add(&voicePath, func(ctx context.Context) string {
+			return c.downloadFile(ctx, message.Voice.FileID, ".ogg", utils.MediaAudio)
+		})
+	}
+	if message.Audio != nil {
+		dl.add(&audioPath, func(ctx context.Context) string {
+			return c.downloadFile(ctx, message.Audio.FileID, ".mp3", utils.MediaAudio)
+		})
+	}
+	if message.Document != nil {
+		dl.add(&docPath, func(ctx context.Context) string {
+			return c.downloadFile(ctx, message.Document.FileID, "", utils.MediaAny)
+		})
+	}
+	dl.run(ctx, "telegram")
+
+	if photoPath != "" {
+		// Images are handed to the agent (for vision), which removes them
+		mediaPaths = append(mediaPaths, photoPath)
+		if content != "" {
+			content += "\n"
 		}
+		content += fmt.Sprintf("[image: photo]")
 	}
 
-	if message.Voice != nil {
-		voicePath := c.downloadFile(ctx, message.Voice.FileID, ".ogg")
-		if voicePath != "" {
-			localFiles = append(localFiles, voicePath)
-			mediaPaths = append(mediaPaths, voicePath)
-
-			transcribedText := ""
-			if c.transcriber != nil && c.transcriber.IsAvailable() {
-				ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
-				defer cancel()
-
-				result, err := c.transcriber.Transcribe(ctx, voicePath)
-				if err != nil {
-					logger.ErrorCF("telegram", "Voice transcription failed", map[string]interface{}{
-						"error": err.Error(),
-						"path":  voicePath,
-					})
-					transcribedText = fmt.Sprintf("[voice (transcription failed)]")
-				} else {
-					transcribedText = fmt.Sprintf("[voice transcription: %s]", result.Text)
-					logger.InfoCF("telegram", "Voice transcribed successfully", map[string]interface{}{
-						"text": result.Text,
-					})
-				}
+	var audioSeconds float64
+	if voicePath != "" {
+		localFiles = append(localFiles, voicePath)
+		mediaPaths = append(mediaPaths, voicePath)
+
+		transcribedText := ""
+		if c.transcriber != nil && c.transcriber.IsAvailable() && !c.mayTranscribe(senderID, chatIDStr) {
+			transcribedText = i18n.T(c.Name(), chatIDStr, "voice.private")
+		} else if c.transcriber != nil && c.transcriber.IsAvailable() {
+			ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+			defer cancel()
+
+			result, err := c.transcriber.Transcribe(ctx, voicePath)
+			if err != nil {
+				logger.ErrorCF("telegram", "Voice transcription failed", map[string]interface{}{
+					"error": err.Error(),
+					"path":  voicePath,
+				})
+				transcribedText = i18n.T(c.Name(), chatIDStr, "voice.transcription_failed")
 			} else {
-				transcribedText = fmt.Sprintf("[voice]")
+				transcribedText = fmt.Sprintf("[voice transcription: %s]", result.Text)
+				audioSeconds = result.Duration
+				logger.InfoCF("telegram", "Voice transcribed successfully", map[string]interface{}{
+					"text": result.Text,
+				})
 			}
+		} else {
+			transcribedText = fmt.Sprintf("[voice]")
+		}
 
-			if content != "" {
-				content += "\n"
-			}
-			content += transcribedText
+		if content != "" {
+			content += "\n"
 		}
+		content += transcribedText
 	}
 
-	if message.Audio != nil {
-		audioPath := c.downloadFile(ctx, message.Audio.FileID, ".mp3")
-		if audioPath != "" {
-			localFiles = append(localFiles, audioPath)
-			mediaPaths = append(mediaPaths, audioPath)
-			if content != "" {
-				content += "\n"
-			}
-			content += fmt.Sprintf("[audio]")
+	if audioPath != "" {
+		localFiles = append(localFiles, audioPath)
+		mediaPaths = append(mediaPaths, audioPath)
+		if content != "" {
+			content += "\n"
 		}
+		content += fmt.Sprintf("[audio]")
 	}
 
-	if message.Document != nil {
-		docPath := c.downloadFile(ctx, message.Document.FileID, "")
-		if docPath != "" {
-			localFiles = append(localFiles, docPath)
-			mediaPaths = append(mediaPaths, docPath)
-			if content != "" {
-				content += "\n"
-			}
-			content += fmt.Sprintf("[file]")
+	if docPath != "" {
+		localFiles = append(localFiles, docPath)
+		mediaPaths = append(mediaPaths, docPath)
+		if content != "" {
+			content += "\n"
 		}
+		content += fmt.Sprintf("[file]")
 	}
 
 	if content == "" {
@@ -304,32 +757,6 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, update telego.Updat
 		"preview":   utils.Truncate(content, 50),
 	})
 
-	// Thinking indicator
-	err := c.bot.SendChatAction(ctx, tu.ChatAction(tu.ID(chatID), telego.ChatActionTyping))
-	if err != nil {
-		logger.ErrorCF("telegram", "Failed to send chat action", map[string]interface{}{
-			"error": err.Error(),
-		})
-	}
-
-	// Stop any previous thinking animation
-	chatIDStr := fmt.Sprintf("%d", chatID)
-	if prevStop, ok := c.stopThinking.Load(chatIDStr); ok {
-		if cf, ok := prevStop.(*thinkingCancel); ok && cf != nil {
-			cf.Cancel()
-		}
-	}
-
-	// Create cancel function for thinking state
-	_, thinkCancel := context.WithTimeout(ctx, 5*time.Minute)
-	c.stopThinking.Store(chatIDStr, &thinkingCancel{fn: thinkCancel})
-
-	pMsg, err := c.bot.SendMessage(ctx, tu.Message(tu.ID(chatID), "Thinking... 💭"))
-	if err == nil {
-		pID := pMsg.MessageID
-		c.placeholders.Store(chatIDStr, pID)
-	}
-
 	metadata := map[string]string{
 		"message_id": fmt.Sprintf("%d", message.MessageID),
 		"user_id":    fmt.Sprintf("%d", user.ID),
@@ -337,8 +764,32 @@ func (c *TelegramChannel) handleMessage(ctx context.Context, update telego.Updat
 		"first_name": user.FirstName,
 		"is_group":   fmt.Sprintf("%t", message.Chat.Type != "private"),
 	}
+	if audioSeconds > 0 {
+		metadata["transcription_seconds"] = strconv.FormatFloat(audioSeconds, 'f', 1, 64)
+	}
 
-	c.HandleMessage(senderID, fmt.Sprintf("%d", chatID), content, mediaPaths, metadata)
+	c.HandleReply(senderID, chatIDStr, content, mediaPaths, metadata, telegramQuote(message))
+}
+
+// telegramQuote returns the message replied to, or nil. Messages in a
+// forum topic reply to the topic's first message unless they reply to
+// another, which is no quote.
+func telegramQuote(message *telego.Message) *bus.Quote {
+	reply := message.ReplyToMessage
+	if reply == nil || reply.ForumTopicCreated != nil {
+		return nil
+	}
+	quote := &bus.Quote{MessageID: fmt.Sprintf("%d", reply.MessageID), Content: reply.Text}
+	if quote.Content == "" {
+		quote.Content = reply.Caption
+	}
+	if message.Quote != nil && message.Quote.Text != "" {
+		quote.Content = message.Quote.Text
+	}
+	if reply.From != nil {
+		quote.SenderID = fmt.Sprintf("%d", reply.From.ID)
+	}
+	return quote
 }
 
 func (c *TelegramChannel) downloadPhoto(ctx context.Context, fileID string) string {
@@ -350,10 +801,12 @@ func (c *TelegramChannel) downloadPhoto(ctx context.Context, fileID string) stri
 		return ""
 	}
 
-	return c.downloadFileWithInfo(file, ".jpg")
+	return c.downloadFileWithInfo(ctx, file, ".jpg", utils.MediaImage)
 }
 
-func (c *TelegramChannel) downloadFileWithInfo(file *telego.File, ext string) string {
+// downloadFileWithInfo downloads file, which was sent as kind, one of the
+// utils.Media constants.
+func (c *TelegramChannel) downloadFileWithInfo(ctx context.Context, file *telego.File, ext, kind string) string {
 	if file.FilePath == "" {
 		return ""
 	}
@@ -363,12 +816,13 @@ func (c *TelegramChannel) downloadFileWithInfo(file *telego.File, ext string) st
 
 	// Use FilePath as filename for better identification
 	filename := file.FilePath + ext
-	return utils.DownloadFile(url, filename, utils.DownloadOptions{
+	return utils.DownloadFileContext(ctx, url, filename, utils.DownloadOptions{
 		LoggerPrefix: "telegram",
+		Kind:         kind,
 	})
 }
 
-func (c *TelegramChannel) downloadFile(ctx context.Context, fileID, ext string) string {
+func (c *TelegramChannel) downloadFile(ctx context.Context, fileID, ext, kind string) string {
 	file, err := c.bot.GetFile(ctx, &telego.GetFileParams{FileID: fileID})
 	if err != nil {
 		logger.ErrorCF("telegram", "Failed to get file", map[string]interface{}{
@@ -377,7 +831,7 @@ func (c *TelegramChannel) downloadFile(ctx context.Context, fileID, ext string)
 		return ""
 	}
 
-	return c.downloadFileWithInfo(file, ext)
+	return c.downloadFileWithInfo(ctx, file, ext, kind)
 }
 
 func parseChatID(chatIDStr string) (int64, error) {
@@ -386,106 +840,45 @@ func parseChatID(chatIDStr string) (int64, error) {
 	return id, err
 }
 
-func markdownToTelegramHTML(text string) string {
-	if text == "" {
-		return ""
-	}
-
-	codeBlocks := extractCodeBlocks(text)
-	text = codeBlocks.text
-
-	inlineCodes := extractInlineCodes(text)
-	text = inlineCodes.text
-
-	text = regexp.MustCompile(`^#{1,6}\s+(.+)$`).ReplaceAllString(text, "$1")
-
-	text = regexp.MustCompile(`^>\s*(.*)$`).ReplaceAllString(text, "$1")
-
-	text = escapeHTML(text)
-
-	text = regexp.MustCompile(`\[([^\]]+)\]\(([^)]+)\)`).ReplaceAllString(text, `<a href="$2">$1</a>`)
-
-	text = regexp.MustCompile(`\*\*(.+?)\*\*`).ReplaceAllString(text, "<b>$1</b>")
-
-	text = regexp.MustCompile(`__(.+?)__`).ReplaceAllString(text, "<b>$1</b>")
-
-	reItalic := regexp.MustCompile(`_([^_]+)_`)
-	text = reItalic.ReplaceAllStringFunc(text, func(s string) string {
-		match := reItalic.FindStringSubmatch(s)
-		if len(match) < 2 {
-			return s
-		}
-		return "<i>" + match[1] + "</i>"
-	})
-
-	text = regexp.MustCompile(`~~(.+?)~~`).ReplaceAllString(text, "<s>$1</s>")
-
-	text = regexp.MustCompile(`^[-*]\s+`).ReplaceAllString(text, "• ")
-
-	for i, code := range inlineCodes.codes {
-		escaped := escapeHTML(code)
-		text = strings.ReplaceAll(text, fmt.Sprintf("\x00IC%d\x00", i), fmt.Sprintf("<code>%s</code>", escaped))
-	}
-
-	for i, code := range codeBlocks.codes {
-		escaped := escapeHTML(code)
-		text = strings.ReplaceAll(text, fmt.Sprintf("\x00CB%d\x00", i), fmt.Sprintf("<pre><code>%s</code></pre>", escaped))
+// parseTopicID returns the forum topic of a "chat/topic" chat ID, or 0.
+func parseTopicID(chatIDStr string) int {
+	_, topic, ok := strings.Cut(chatIDStr, "/")
+	if !ok {
+		return 0
 	}
-
-	return text
-}
-
-type codeBlockMatch struct {
-	text  string
-	codes []string
+	id, _ := strconv.Atoi(topic)
+	return id
 }
 
-func extractCodeBlocks(text string) codeBlockMatch {
-	re := regexp.MustCompile("```[\\w]*\\n?([\\s\\S]*?)```")
-	matches := re.FindAllStringSubmatch(text, -1)
-
-	codes := make([]string, 0, len(matches))
-	for _, match := range matches {
-		codes = append(codes, match[1])
-	}
-
-	i := 0
-	text = re.ReplaceAllStringFunc(text, func(m string) string {
-		placeholder := fmt.Sprintf("\x00CB%d\x00", i)
-		i++
-		return placeholder
-	})
-
-	return codeBlockMatch{text: text, codes: codes}
+// ownMessages remembers the IDs of the bot's latest messages, by chat.
+type ownMessages struct {
+	mu    sync.Mutex
+	ids   map[string]bool // "chat_id:message_id"
+	order []string
+	max   int
 }
 
-type inlineCodeMatch struct {
-	text  string
-	codes []string
+func newOwnMessages(max int) *ownMessages {
+	return &ownMessages{ids: make(map[string]bool), max: max}
 }
 
-func extractInlineCodes(text string) inlineCodeMatch {
-	re := regexp.MustCompile("`([^`]+)`")
-	matches := re.FindAllStringSubmatch(text, -1)
-
-	codes := make([]string, 0, len(matches))
-	for _, match := range matches {
-		codes = append(codes, match[1])
+func (o *ownMessages) add(chatID, messageID string) {
+	key := chatID + ":" + messageID
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.ids[key] {
+		return
+	}
+	o.ids[key] = true
+	o.order = append(o.order, key)
+	if len(o.order) > o.max {
+		delete(o.ids, o.order[0])
+		o.order = o.order[1:]
 	}
-
-	i := 0
-	text = re.ReplaceAllStringFunc(text, func(m string) string {
-		placeholder := fmt.Sprintf("\x00IC%d\x00", i)
-		i++
-		return placeholder
-	})
-
-	return inlineCodeMatch{text: text, codes: codes}
 }
 
-func escapeHTML(text string) string {
-	text = strings.ReplaceAll(text, "&", "&amp;")
-	text = strings.ReplaceAll(text, "<", "&lt;")
-	text = strings.ReplaceAll(text, ">", "&gt;")
-	return text
+func (o *ownMessages) has(chatID, messageID string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.ids[chatID+":"+messageID]
 }
@@ -0,0 +1,492 @@
+package channels
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/events"
+	"github.com/sipeed/picoclaw/pkg/i18n"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/media"
+	"github.com/sipeed/picoclaw/pkg/render"
+	"github.com/sipeed/picoclaw/pkg/utils"
+	"github.com/sipeed/picoclaw/pkg/voice"
+)
+
+// Twilio chats are conversations with a phone number, whose chat ID is the
+// number in E.164 form, e.g. "+15551234567".
+const (
+	// twilioWebhookPath is where Twilio posts incoming messages.
+	twilioWebhookPath = "/twilio/sms"
+	// twilioAPI is the REST API's address.
+	twilioAPI = "https://api.twilio.com"
+	// twilioMessageLimit is the longest message body Twilio takes, sent
+	// as several SMS segments that phones put back together.
+	twilioMessageLimit = 1600
+	// twilioMediaLimit is the most media an MMS may carry altogether.
+	twilioMediaLimit = 5 << 20
+	// maxTwilioMedia is the most attachments an MMS may carry.
+	maxTwilioMedia = 10
+	// maxTwilioSenders is how many users' last texted numbers are
+	// remembered, for replying from the same number.
+	maxTwilioSenders = 1000
+)
+
+// twilioEmptyResponse is the TwiML answering a webhook without replying;
+// replies go out through the REST API once the agent has one.
+const twilioEmptyResponse = `<?xml version="1.0" encoding="UTF-8"?><Response></Response>`
+
+type TwilioChannel struct {
+	*BaseChannel
+	config      config.TwilioConfig
+	api         string
+	client      *http.Client
+	transcriber *voice.GroqTranscriber
+	ctx         context.Context
+	cancel      context.CancelFunc
+	// numbers maps the bot's numbers to their own allow lists
+	numbers map[string][]string
+
+	mu    sync.Mutex
+	store *media.Store
+	// replyFrom maps each user to the bot number they texted last
+	replyFrom map[string]string
+}
+
+func NewTwilioChannel(cfg config.TwilioConfig, messageBus *bus.MessageBus) (*TwilioChannel, error) {
+	if cfg.AccountSID == "" || cfg.AuthToken == "" {
+		return nil, fmt.Errorf("twilio account_sid and auth_token are required")
+	}
+	if len(cfg.Numbers) == 0 {
+		return nil, fmt.Errorf("twilio needs at least one number")
+	}
+
+	numbers := make(map[string][]string, len(cfg.Numbers))
+	for _, n := range cfg.Numbers {
+		numbers[normalizePhone(n.Number)] = normalizePhones(n.AllowFrom)
+	}
+	base := NewBaseChannel("twilio", cfg, messageBus, normalizePhones(cfg.AllowFrom))
+
+	return &TwilioChannel{
+		BaseChannel: base,
+		config:      cfg,
+		api:         twilioAPI,
+		client:      &http.Client{Timeout: 30 * time.Second},
+		numbers:     numbers,
+		replyFrom:   make(map[string]string),
+	}, nil
+}
+
+func (c *TwilioChannel) SetTranscriber(transcriber *voice.GroqTranscriber) {
+	c.transcriber = transcriber
+}
+
+// SetMediaStore implements MediaStoreChannel. Twilio fetches an MMS's
+// attachments from the links the store hands out.
+func (c *TwilioChannel) SetMediaStore(store *media.Store) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.store = store
+}
+
+// Webhook implements WebhookChannel.
+func (c *TwilioChannel) Webhook() (string, http.Handler) {
+	return twilioWebhookPath, c
+}
+
+func (c *TwilioChannel) Start(ctx context.Context) error {
+	logger.InfoC("twilio", "Starting Twilio channel")
+
+	c.ctx, c.cancel = context.WithCancel(ctx)
+
+	var account struct {
+		FriendlyName string `json:"friendly_name"`
+		Status       string `json:"status"`
+	}
+	if err := c.call(c.ctx, http.MethodGet, ".json", nil, &account); err != nil {
+		return fmt.Errorf("twilio auth check failed: %w", err)
+	}
+
+	logger.InfoCF("twilio", "Twilio account connected", map[string]interface{}{
+		"account": account.FriendlyName,
+		"status":  account.Status,
+		"webhook": twilioWebhookPath,
+	})
+
+	c.setRunning(true)
+	logger.InfoC("twilio", "Twilio channel started")
+	return nil
+}
+
+func (c *TwilioChannel) Stop(ctx context.Context) error {
+	logger.InfoC("twilio", "Stopping Twilio channel")
+
+	if c.cancel != nil {
+		c.cancel()
+	}
+
+	c.setRunning(false)
+	logger.InfoC("twilio", "Twilio channel stopped")
+	return nil
+}
+
+// ServeHTTP takes the webhook requests Twilio makes for incoming messages.
+// Requests not signed with the account's auth token are refused. The
+// message is handled after answering, since Twilio waits at most 15
+// seconds and downloads and transcription can take longer.
+func (c *TwilioChannel) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	want := twilioSignature(c.config.AuthToken, c.webhookURL(r), r.PostForm)
+	if !hmac.Equal([]byte(r.Header.Get("X-Twilio-Signature")), []byte(want)) ||
+		r.PostForm.Get("AccountSid") != c.config.AccountSID {
+		events.Security("twilio", "Rejected webhook request with a bad signature",
+			map[string]interface{}{"remote_addr": r.RemoteAddr})
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	if !c.IsRunning() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	form := r.PostForm
+	go func() {
+		defer c.Recover()
+		c.handleMessage(form)
+	}()
+	w.Header().Set("Content-Type", "text/xml")
+	io.WriteString(w, twilioEmptyResponse)
+}
+
+// webhookURL returns the URL Twilio signed a request for: webhook_url when
+// set, or else the request's own URL as the proxy in front passes it on.
+func (c *TwilioChannel) webhookURL(r *http.Request) string {
+	if c.config.WebhookURL != "" {
+		return c.config.WebhookURL
+	}
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	host := r.Host
+	if fwd := r.Header.Get("X-Forwarded-Host"); fwd != "" {
+		host = fwd
+	}
+	return scheme + "://" + host + r.URL.RequestURI()
+}
+
+// twilioSignature returns the signature Twilio gives a webhook request to
+// target with form: the HMAC-SHA1, keyed with the auth token, of the URL
+// followed by each parameter's name and value in order of name.
+func twilioSignature(authToken, target string, form url.Values) string {
+	keys := make([]string, 0, len(form))
+	for k := range form {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	mac := hmac.New(sha1.New, []byte(authToken))
+	io.WriteString(mac, target)
+	for _, k := range keys {
+		for _, v := range form[k] {
+			io.WriteString(mac, k+v)
+		}
+	}
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (c *TwilioChannel) handleMessage(form url.Values) {
+	from, to := normalizePhone(form.Get("From")), normalizePhone(form.Get("To"))
+	allowed, ok := c.numbers[to]
+	if from == "" || !ok {
+		logger.WarnCF("twilio", "Message to a number not configured, ignoring", map[string]interface{}{
+			"to": to,
+		})
+		return
+	}
+	// Each number's own allow list applies on top of the channel's
+	if len(allowed) > 0 && !slices.Contains(allowed, from) && !c.isGranted(from) {
+		logger.DebugCF("twilio", "Sender not allowed on this number", map[string]interface{}{
+			"from": from,
+			"to":   to,
+		})
+		return
+	}
+	// Check allowlist before downloading media for rejected users
+	if !c.Admits(from, from) {
+		return
+	}
+	c.rememberNumber(from, to)
+
+	content := strings.TrimSpace(form.Get("Body"))
+	mediaPaths, localFiles, note, audioSeconds := c.fetchMedia(from, form)
+	defer func() {
+		for _, f := range localFiles {
+			os.Remove(f)
+		}
+	}()
+	if note != "" {
+		content = strings.TrimSpace(content + "\n" + note)
+	}
+	if content == "" && len(mediaPaths) == 0 {
+		return
+	}
+
+	metadata := map[string]string{
+		"message_id":    form.Get("MessageSid"),
+		"twilio_number": to,
+	}
+	if audioSeconds > 0 {
+		metadata["transcription_seconds"] = strconv.FormatFloat(audioSeconds, 'f', 1, 64)
+	}
+
+	logger.DebugCF("twilio", "Message received", map[string]interface{}{
+		"from":    from,
+		"to":      to,
+		"content": utils.Truncate(content, 50),
+	})
+
+	c.HandleMessage(from, from, content, mediaPaths, metadata)
+}
+
+// fetchMedia downloads an MMS's attachments, together, from their URLs on
+// the REST API, which need the account's credentials when the account
+// enforces HTTP authentication on media; links elsewhere are skipped so the
+// credentials go nowhere else. Voice recordings are transcribed into note.
+// Images are handed to the agent (for vision), which removes them; the
+// caller removes localFiles.
+func (c *TwilioChannel) fetchMedia(from string, form url.Values) (mediaPaths, localFiles []string, note string, audioSeconds float64) {
+	n, _ := strconv.Atoi(form.Get("NumMedia"))
+	n = min(n, maxTwilioMedia)
+	if n <= 0 {
+		return nil, nil, "", 0
+	}
+	auth := "Basic " + base64.StdEncoding.EncodeToString([]byte(c.config.AccountSID+":"+c.config.AuthToken))
+	var dl downloads
+	paths := make([]string, n)
+	types := make([]string, n)
+	for i := 0; i < n; i++ {
+		link, contentType := form.Get(fmt.Sprintf("MediaUrl%d", i)), form.Get(fmt.Sprintf("MediaContentType%d", i))
+		types[i] = contentType
+		if !strings.HasPrefix(link, c.api+"/") {
+			continue
+		}
+		dl.add(&paths[i], func(ctx context.Context) string {
+			return utils.DownloadFileContext(ctx, link, "mms", utils.DownloadOptions{
+				LoggerPrefix: "twilio",
+				Kind:         utils.MediaKind("", contentType),
+				ExtraHeaders: map[string]string{"Authorization": auth},
+			})
+		})
+	}
+	dl.run(c.ctx, "twilio")
+
+	for i, path := range paths {
+		if path == "" {
+			continue
+		}
+		mediaPaths = append(mediaPaths, path)
+		if utils.IsImageFile(path, types[i]) {
+			continue
+		}
+		localFiles = append(localFiles, path)
+		if utils.IsAudioFile(path, types[i]) {
+			text, seconds := c.transcribeVoice(from, path)
+			note = strings.TrimSpace(note + "\n" + text)
+			audioSeconds += seconds
+		}
+	}
+	return mediaPaths, localFiles, note, audioSeconds
+}
+
+func (c *TwilioChannel) transcribeVoice(from, audioPath string) (string, float64) {
+	if c.transcriber == nil || !c.transcriber.IsAvailable() {
+		return "[voice]", 0
+	}
+	if !c.mayTranscribe(from, from) {
+		return i18n.T(c.Name(), from, "voice.private"), 0
+	}
+
+	ctx, cancel := context.WithTimeout(c.ctx, 30*time.Second)
+	defer cancel()
+
+	result, err := c.transcriber.Transcribe(ctx, audioPath)
+	if err != nil {
+		logger.ErrorCF("twilio", "Voice transcription failed", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return i18n.T(c.Name(), from, "voice.transcription_failed"), 0
+	}
+
+	return fmt.Sprintf("[voice transcription: %s]", result.Text), result.Duration
+}
+
+func (c *TwilioChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("twilio channel not running")
+	}
+
+	to := normalizePhone(msg.ChatID)
+	form := url.Values{"To": {to}, "From": {c.replyNumber(to)}}
+	if msg.Content != "" {
+		form.Set("Body", msg.Content)
+	}
+	for _, path := range msg.Media {
+		link, err := c.mediaLink(path)
+		if err != nil {
+			return err
+		}
+		form.Add("MediaUrl", link)
+	}
+	if !form.Has("Body") && !form.Has("MediaUrl") {
+		return nil
+	}
+
+	var resp struct {
+		SID string `json:"sid"`
+	}
+	if err := c.call(ctx, http.MethodPost, "/Messages.json", form, &resp); err != nil {
+		return fmt.Errorf("failed to send twilio message: %w", err)
+	}
+	reportSent(ctx, resp.SID)
+
+	logger.DebugCF("twilio", "Message sent", map[string]interface{}{
+		"chat_id":    to,
+		"message_id": resp.SID,
+	})
+	return nil
+}
+
+// rememberNumber records which bot number a user texted, forgetting all
+// once maxTwilioSenders are held.
+func (c *TwilioChannel) rememberNumber(from, to string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.replyFrom[from]; !ok && len(c.replyFrom) >= maxTwilioSenders {
+		clear(c.replyFrom)
+	}
+	c.replyFrom[from] = to
+}
+
+// replyNumber returns the bot number to text to from: the one they texted
+// last, or the first configured.
+func (c *TwilioChannel) replyNumber(to string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if from, ok := c.replyFrom[to]; ok {
+		return from
+	}
+	return normalizePhone(c.config.Numbers[0].Number)
+}
+
+// mediaLink returns the URL Twilio fetches an attachment from: remote
+// URLs as they are, and local files shared from the media store.
+func (c *TwilioChannel) mediaLink(path string) (string, error) {
+	if strings.HasPrefix(path, "https://") || strings.HasPrefix(path, "http://") {
+		return path, nil
+	}
+	c.mu.Lock()
+	store := c.store
+	c.mu.Unlock()
+	if store == nil {
+		return "", fmt.Errorf("twilio needs the media store to send attachments")
+	}
+	return store.Share(path)
+}
+
+// Capabilities reports that SMS is plain text of up to 1600 characters.
+// MMS attachments of up to 5 MB go out as media store links, so there are
+// none without the store.
+func (c *TwilioChannel) Capabilities() render.Capabilities {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return render.Capabilities{
+		Markup:        render.Plain,
+		Media:         c.store != nil,
+		MaxLength:     twilioMessageLimit,
+		MaxAttachment: twilioMediaLimit,
+	}
+}
+
+// call sends a request to the account's part of the REST API, with form
+// as the body, and decodes the response into out.
+func (c *TwilioChannel) call(ctx context.Context, method, endpoint string, form url.Values, out interface{}) error {
+	target := c.api + "/2010-04-01/Accounts/" + url.PathEscape(c.config.AccountSID) + endpoint
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	req.SetBasicAuth(c.config.AccountSID, c.config.AuthToken)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 400 {
+		var apiErr struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Message != "" {
+			return fmt.Errorf("twilio API error %d (HTTP %d): %s", apiErr.Code, resp.StatusCode, apiErr.Message)
+		}
+		return fmt.Errorf("twilio API returned HTTP %d", resp.StatusCode)
+	}
+	return json.Unmarshal(data, out)
+}
+
+// normalizePhone returns a phone number with only its digits and leading
+// "+", so "+1 (555) 123-4567" matches "+15551234567".
+func normalizePhone(number string) string {
+	var b strings.Builder
+	for i, r := range strings.TrimSpace(number) {
+		if (r >= '0' && r <= '9') || (r == '+' && i == 0) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func normalizePhones(numbers []string) []string {
+	out := make([]string, 0, len(numbers))
+	for _, n := range numbers {
+		if n = normalizePhone(n); n != "" {
+			out = append(out, n)
+		}
+	}
+	return out
+}
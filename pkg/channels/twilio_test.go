@@ -0,0 +1,179 @@
+package channels
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/media"
+)
+
+func TestTwilioSignature(t *testing.T) {
+	// The example from Twilio's webhook security documentation
+	form := url.Values{
+		"CallSid": {"CA1234567890ABCDE"},
+		"Caller":  {"+12349013030"},
+		"Digits":  {"1234"},
+		"From":    {"+12349013030"},
+		"To":      {"+18005551212"},
+	}
+	got := twilioSignature("12345", "https://mycompany.com/myapp.php?foo=1&bar=2", form)
+	if got != "0/KCTR6DLpKmkAf8muzZqo1nDgQ=" {
+		t.Errorf("twilioSignature() = %q", got)
+	}
+}
+
+func TestNormalizePhone(t *testing.T) {
+	tests := map[string]string{
+		"+1 (555) 123-4567": "+15551234567",
+		" 15551234567 ":     "15551234567",
+		"1+555":             "1555",
+		"":                  "",
+	}
+	for in, want := range tests {
+		if got := normalizePhone(in); got != want {
+			t.Errorf("normalizePhone(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// fakeTwilio serves the parts of Twilio's REST API the channel uses.
+type fakeTwilio struct {
+	mu   sync.Mutex
+	sent []url.Values
+}
+
+func (f *fakeTwilio) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if user, pass, ok := r.BasicAuth(); !ok || user != "AC123" || pass != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"code": 20003, "message": "Authenticate"}`))
+		return
+	}
+	switch r.URL.Path {
+	case "/2010-04-01/Accounts/AC123.json":
+		w.Write([]byte(`{"friendly_name": "Test", "status": "active"}`))
+	case "/2010-04-01/Accounts/AC123/Messages/MM1/Media/ME1":
+		w.Write([]byte("meeting notes"))
+	case "/2010-04-01/Accounts/AC123/Messages.json":
+		r.ParseForm()
+		f.mu.Lock()
+		f.sent = append(f.sent, r.PostForm)
+		f.mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"sid": "SM1"}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestTwilioChannel(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	fake := &fakeTwilio{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	msgBus := bus.NewMessageBus()
+	ch, err := NewTwilioChannel(config.TwilioConfig{
+		AccountSID: "AC123",
+		AuthToken:  "secret",
+		Numbers: []config.TwilioNumber{
+			{Number: "+15550000000"},
+			{Number: "+1 555 000 0001", AllowFrom: config.FlexibleStringSlice{"+15552222222"}},
+		},
+		AllowFrom: config.FlexibleStringSlice{"+1 (555) 111-1111", "+15552222222"},
+	}, msgBus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch.api = server.URL
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := ch.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer ch.Stop(ctx)
+
+	post := func(form url.Values, signature string) int {
+		form.Set("AccountSid", "AC123")
+		if signature == "" {
+			signature = twilioSignature("secret", "https://bot.example.com/twilio/sms", form)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/twilio/sms", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("X-Forwarded-Proto", "https")
+		req.Host = "bot.example.com"
+		req.Header.Set("X-Twilio-Signature", signature)
+		w := httptest.NewRecorder()
+		ch.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := post(url.Values{"From": {"+15551111111"}, "To": {"+15550000000"}, "Body": {"forged"}}, "bm9wZQ=="); code != http.StatusForbidden {
+		t.Errorf("forged request answered %d, want 403", code)
+	}
+	// +15551111111 is allowed on the channel, but not on the second number
+	if code := post(url.Values{"From": {"+15551111111"}, "To": {"+15550000001"}, "Body": {"wrong number"}}, ""); code != http.StatusOK {
+		t.Errorf("webhook answered %d", code)
+	}
+	post(url.Values{
+		"From": {"+15552222222"}, "To": {"+15550000001"}, "Body": {"notes attached"}, "MessageSid": {"MM1"},
+		"NumMedia": {"2"}, "MediaUrl0": {server.URL + "/2010-04-01/Accounts/AC123/Messages/MM1/Media/ME1"},
+		"MediaContentType0": {"text/plain"}, "MediaUrl1": {"https://elsewhere.example.com/x"}, "MediaContentType1": {"text/plain"},
+	}, "")
+
+	msg, ok := msgBus.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("no inbound message")
+	}
+	if msg.ChatID != "+15552222222" || msg.Content != "notes attached" || msg.Metadata["twilio_number"] != "+15550000001" ||
+		msg.Metadata["message_id"] != "MM1" {
+		t.Errorf("message = %q in %q, metadata %v", msg.Content, msg.ChatID, msg.Metadata)
+	}
+	if len(msg.Media) != 1 {
+		t.Errorf("media = %v, want only the attachment on the API", msg.Media)
+	}
+
+	// Replies go out from the number the user texted
+	if err := ch.Send(ctx, bus.OutboundMessage{ChatID: msg.ChatID, Content: "got it"}); err != nil {
+		t.Fatal(err)
+	}
+	// Attachments need the media store
+	file := filepath.Join(t.TempDir(), "report.txt")
+	os.WriteFile(file, []byte("all green"), 0600)
+	if err := ch.Send(ctx, bus.OutboundMessage{ChatID: "+15551111111", Media: []string{file}}); err == nil {
+		t.Error("Send() with media and no store succeeded")
+	}
+	store, err := media.NewStore(filepath.Join(t.TempDir(), "store"), "https://bot.example.com", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch.SetMediaStore(store)
+	if !ch.Capabilities().Media {
+		t.Error("Capabilities().Media = false with a store")
+	}
+	if err := ch.Send(ctx, bus.OutboundMessage{ChatID: "+15551111111", Media: []string{file}}); err != nil {
+		t.Fatal(err)
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if len(fake.sent) != 2 {
+		t.Fatalf("sent %d messages, want 2", len(fake.sent))
+	}
+	if got := fake.sent[0]; got.Get("From") != "+15550000001" || got.Get("To") != "+15552222222" || got.Get("Body") != "got it" {
+		t.Errorf("reply = %v", got)
+	}
+	if got := fake.sent[1]; got.Get("From") != "+15550000000" || got.Has("Body") ||
+		!strings.HasPrefix(got.Get("MediaUrl"), "https://bot.example.com/") {
+		t.Errorf("media message = %v", got)
+	}
+}
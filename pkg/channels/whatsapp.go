@@ -3,9 +3,15 @@ package channels
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math/rand/v2"
+	"mime"
+	"net"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -23,7 +29,11 @@ import (
 
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/contacts"
+	"github.com/sipeed/picoclaw/pkg/crash"
+	"github.com/sipeed/picoclaw/pkg/i18n"
 	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/render"
 	"github.com/sipeed/picoclaw/pkg/utils"
 	"github.com/sipeed/picoclaw/pkg/voice"
 )
@@ -37,13 +47,28 @@ type WhatsAppChannel struct {
 	transcriber *voice.GroqTranscriber
 
 	// Native mode fields
-	client    *whatsmeow.Client
+	client    *whatsmeow.Client // guarded by mu, as Repair replaces it
 	container *sqlstore.Container
 
 	// Bridge mode fields
 	conn      *websocket.Conn
 	url       string
 	connected bool
+	session   *bridgeSession // Protocol state, kept across reconnects
+
+	qrHandler func(code string) // nil draws QR codes in the terminal
+
+	presenceWatch map[types.JID]bool // users whose presence is passed on
+
+	// quotables are the latest messages received in each chat, which
+	// replies can quote and read receipts can name the sender of in
+	// native mode
+	quotables map[string][]quotable
+	quoteMu   sync.Mutex
+
+	// inbound prepares incoming messages, downloads and transcription
+	// included, off whatsmeow's event loop, in order within each chat
+	inbound *workerPool
 
 	mu sync.Mutex
 }
@@ -56,9 +81,17 @@ func NewWhatsAppChannel(cfg config.WhatsAppConfig, bus *bus.MessageBus) (*WhatsA
 		config:      cfg,
 		url:         cfg.BridgeURL,
 		connected:   false,
+		session:     newBridgeSession(),
+		inbound:     newWorkerPool("whatsapp", cfg.Workers, inboundQueueSize),
 	}, nil
 }
 
+// SetQRHandler routes pairing QR codes to handler, e.g. to serve them over
+// HTTP in a container without a terminal. It must be called before Start.
+func (c *WhatsAppChannel) SetQRHandler(handler func(code string)) {
+	c.qrHandler = handler
+}
+
 // SetTranscriber attaches a voice transcriber for voice message support.
 func (c *WhatsAppChannel) SetTranscriber(transcriber *voice.GroqTranscriber) {
 	c.transcriber = transcriber
@@ -89,14 +122,376 @@ func (c *WhatsAppChannel) Send(ctx context.Context, msg bus.OutboundMessage) err
 	return c.sendNative(ctx, msg)
 }
 
+// Capabilities reports that WhatsApp takes its own markup, and in native
+// mode attachments; the bridge cannot send those, so there they arrive as
+// text, as buttons always do.
+func (c *WhatsAppChannel) Capabilities() render.Capabilities {
+	caps := render.Capabilities{Markup: render.WhatsApp, MaxLength: 65536}
+	if c.config.BridgeURL == "" {
+		caps.Media, caps.MaxAttachment = true, whatsappMaxAttachment
+	}
+	return caps
+}
+
+const (
+	// whatsappMaxAttachment is the largest attachment sent in native mode.
+	whatsappMaxAttachment = 100 << 20
+	// whatsappCaptionLength is the longest text sent as an attachment's
+	// caption rather than as a message of its own.
+	whatsappCaptionLength = 1024
+)
+
+// whatsappTypingInterval renews the "typing…" presence, which WhatsApp
+// clears by itself after about 25 seconds.
+const whatsappTypingInterval = 10 * time.Second
+
+// StartIndicator marks the message the agent picked up read, with
+// send_read_receipts, and shows "typing…" in the chat while the agent
+// works, with send_typing. The bridge has no way to do either, so in
+// bridge mode it does nothing.
+func (c *WhatsAppChannel) StartIndicator(ctx context.Context, chatID, messageID string) func() {
+	client := c.nativeClient()
+	if c.config.BridgeURL != "" || client == nil {
+		return func() {}
+	}
+	jid, err := types.ParseJID(chatID)
+	if err != nil {
+		return func() {}
+	}
+	if c.config.SendReadReceipts && messageID != "" {
+		c.markRead(ctx, jid, messageID)
+	}
+	if !c.config.SendTyping {
+		return func() {}
+	}
+
+	workCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(whatsappTypingInterval)
+		defer ticker.Stop()
+		for {
+			if err := client.SendChatPresence(workCtx, jid, types.ChatPresenceComposing, types.ChatPresenceMediaText); err != nil && workCtx.Err() == nil {
+				logger.DebugCF("whatsapp", "Failed to send typing presence", map[string]interface{}{
+					"error": err.Error(),
+				})
+			}
+			select {
+			case <-workCtx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+		client.SendChatPresence(context.Background(), jid, types.ChatPresencePaused, types.ChatPresenceMediaText)
+	}
+}
+
+// markRead sends a read receipt for a message in chat. In a group the
+// receipt names the message's sender, so only messages the channel saw
+// arrive can be marked there; see rememberQuotable.
+func (c *WhatsAppChannel) markRead(ctx context.Context, chat types.JID, messageID string) {
+	client := c.nativeClient()
+	var sender types.JID
+	if q, ok := c.findQuotable(chat, messageID); ok {
+		sender, _ = types.ParseJID(q.sender)
+	} else if chat.Server == types.GroupServer {
+		return
+	}
+	if err := client.MarkRead(ctx, []types.MessageID{messageID}, time.Now(), chat, sender); err != nil {
+		logger.DebugCF("whatsapp", "Failed to send read receipt", map[string]interface{}{
+			"chat":       chat.String(),
+			"message_id": messageID,
+			"error":      err.Error(),
+		})
+	}
+}
+
+// React adds or removes the bot's reaction on a message. WhatsApp keeps one
+// reaction per sender, so removing clears whichever is there. In bridge
+// mode the bridge gets a reaction frame, with no emoji for a removal.
+func (c *WhatsAppChannel) React(ctx context.Context, chatID string, reaction bus.Reaction) error {
+	client := c.nativeClient()
+	if c.config.BridgeURL != "" {
+		f := bridgeFrame{Type: "reaction", To: chatID, MessageID: reaction.MessageID, Emoji: reaction.Emoji, Author: reaction.Author}
+		if reaction.Remove {
+			f.Emoji = ""
+		}
+		return c.sendBridgeFrame(f)
+	}
+	if client == nil || !client.IsConnected() {
+		return fmt.Errorf("WhatsApp native client not connected")
+	}
+	chat, err := types.ParseJID(chatID)
+	if err != nil {
+		return fmt.Errorf("invalid WhatsApp JID %q: %w", chatID, err)
+	}
+	// In a direct chat the other party wrote every message not from us
+	author := chat
+	if reaction.Author != "" {
+		if author, err = types.ParseJID(reaction.Author); err != nil {
+			return fmt.Errorf("invalid WhatsApp JID %q: %w", reaction.Author, err)
+		}
+	} else if chat.Server == types.GroupServer {
+		return fmt.Errorf("reacting in a WhatsApp group needs the message's author")
+	}
+
+	emoji := reaction.Emoji
+	if reaction.Remove {
+		emoji = ""
+	}
+	if _, err := client.SendMessage(ctx, chat, client.BuildReaction(chat, author, reaction.MessageID, emoji)); err != nil {
+		return fmt.Errorf("failed to send WhatsApp reaction: %w", err)
+	}
+	return nil
+}
+
+// JoinGroup accepts an invitation to a group, as passed on by HandleInvite:
+// "inviter|code|expiration". The bridge cannot join groups.
+func (c *WhatsAppChannel) JoinGroup(ctx context.Context, chatID, invite string) error {
+	client := c.nativeClient()
+	if client == nil || !client.IsConnected() {
+		return fmt.Errorf("WhatsApp native client not connected")
+	}
+	group, err := types.ParseJID(chatID)
+	if err != nil {
+		return fmt.Errorf("invalid WhatsApp JID %q: %w", chatID, err)
+	}
+	parts := strings.SplitN(invite, "|", 3)
+	if len(parts) != 3 {
+		return fmt.Errorf("invalid WhatsApp group invite %q", invite)
+	}
+	inviter, err := types.ParseJID(parts[0])
+	if err != nil {
+		return fmt.Errorf("invalid WhatsApp JID %q: %w", parts[0], err)
+	}
+	expiration, _ := strconv.ParseInt(parts[2], 10, 64)
+	if err := client.JoinGroupWithInvite(ctx, group, inviter, parts[1], expiration); err != nil {
+		return fmt.Errorf("failed to join WhatsApp group: %w", err)
+	}
+	return nil
+}
+
+// LeaveGroup leaves a group. The bridge cannot leave groups.
+func (c *WhatsAppChannel) LeaveGroup(ctx context.Context, chatID string) error {
+	client := c.nativeClient()
+	if client == nil || !client.IsConnected() {
+		return fmt.Errorf("WhatsApp native client not connected")
+	}
+	group, err := types.ParseJID(chatID)
+	if err != nil {
+		return fmt.Errorf("invalid WhatsApp JID %q: %w", chatID, err)
+	}
+	if err := client.LeaveGroup(ctx, group); err != nil {
+		return fmt.Errorf("failed to leave WhatsApp group: %w", err)
+	}
+	return nil
+}
+
+// SubscribePresence passes on userID's presence from now on. userID is a
+// JID or a phone number; WhatsApp only shares presence with contacts who
+// allow it. Subscriptions last for the connection, and are renewed on
+// reconnect. The bridge does not report presence.
+func (c *WhatsAppChannel) SubscribePresence(ctx context.Context, userID string) (string, error) {
+	client := c.nativeClient()
+	if c.config.BridgeURL != "" {
+		return "", fmt.Errorf("WhatsApp bridge does not report presence")
+	}
+	jid, err := presenceJID(userID)
+	if err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	if c.presenceWatch == nil {
+		c.presenceWatch = make(map[types.JID]bool)
+	}
+	c.presenceWatch[jid] = true
+	c.mu.Unlock()
+
+	if client != nil && client.IsConnected() {
+		if err := client.SubscribePresence(ctx, jid); err != nil {
+			return "", fmt.Errorf("failed to subscribe to WhatsApp presence: %w", err)
+		}
+	}
+	return jid.String(), nil
+}
+
+// UnsubscribePresence stops passing on userID's presence. WhatsApp has no
+// way to unsubscribe, so updates still arrive until the next reconnect.
+func (c *WhatsAppChannel) UnsubscribePresence(_ context.Context, userID string) error {
+	jid, err := presenceJID(userID)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	delete(c.presenceWatch, jid)
+	c.mu.Unlock()
+	return nil
+}
+
+// chatJID parses a JID, or a phone number such as "+49 151 12345678" as
+// the JID of that user.
+func chatJID(chatID string) (types.JID, error) {
+	chatID = strings.TrimSpace(chatID)
+	if !strings.Contains(chatID, "@") {
+		phone := strings.Map(func(r rune) rune {
+			if r >= '0' && r <= '9' {
+				return r
+			}
+			return -1
+		}, chatID)
+		if phone == "" {
+			return types.JID{}, fmt.Errorf("invalid WhatsApp user %q", chatID)
+		}
+		return types.NewJID(phone, types.DefaultUserServer), nil
+	}
+	jid, err := types.ParseJID(chatID)
+	if err != nil {
+		return types.JID{}, fmt.Errorf("invalid WhatsApp JID %q: %w", chatID, err)
+	}
+	return jid, nil
+}
+
+// presenceJID turns a JID or phone number into the user JID presence
+// events come from.
+func presenceJID(userID string) (types.JID, error) {
+	jid, err := chatJID(userID)
+	if err != nil {
+		return types.JID{}, err
+	}
+	if jid.Server == types.GroupServer {
+		return types.JID{}, fmt.Errorf("WhatsApp groups have no presence")
+	}
+	return jid.ToNonAD(), nil
+}
+
+// resubscribePresence renews the presence subscriptions after connecting.
+func (c *WhatsAppChannel) resubscribePresence() {
+	client := c.nativeClient()
+	c.mu.Lock()
+	jids := make([]types.JID, 0, len(c.presenceWatch))
+	for jid := range c.presenceWatch {
+		jids = append(jids, jid)
+	}
+	c.mu.Unlock()
+	for _, jid := range jids {
+		if err := client.SubscribePresence(context.Background(), jid); err != nil {
+			logger.WarnCF("whatsapp", "Failed to subscribe to presence", map[string]interface{}{
+				"user":  jid.String(),
+				"error": err.Error(),
+			})
+		}
+	}
+}
+
+// handlePresence passes on presence updates for watched users.
+func (c *WhatsAppChannel) handlePresence(evt *events.Presence) {
+	jid := evt.From.ToNonAD()
+	c.mu.Lock()
+	watched := c.presenceWatch[jid]
+	c.mu.Unlock()
+	if !watched {
+		return
+	}
+	c.bus.PublishPresence(bus.Presence{
+		Channel:  c.Name(),
+		UserID:   jid.String(),
+		Online:   !evt.Unavailable,
+		LastSeen: evt.LastSeen,
+	})
+}
+
+// Contacts lists the address book of the paired phone, for the contact
+// directory. The bridge has none.
+func (c *WhatsAppChannel) Contacts(ctx context.Context) ([]contacts.Contact, error) {
+	client := c.nativeClient()
+	if c.config.BridgeURL != "" {
+		return nil, nil
+	}
+	if client == nil || client.Store.ID == nil {
+		return nil, fmt.Errorf("WhatsApp native client not paired")
+	}
+	all, err := client.Store.Contacts.GetAllContacts(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read WhatsApp contacts: %w", err)
+	}
+	list := make([]contacts.Contact, 0, len(all))
+	for jid, info := range all {
+		if jid.Server != types.DefaultUserServer || c.isSelf(jid) {
+			continue
+		}
+		name := info.FullName
+		for _, alt := range []string{info.FirstName, info.BusinessName, info.PushName} {
+			if name == "" {
+				name = alt
+			}
+		}
+		list = append(list, contacts.Contact{Channel: c.Name(), ID: jid.String(), Name: name, ChatID: jid.String()})
+	}
+	return list, nil
+}
+
+// Connected reports whether the WhatsApp connection, or the bridge
+// websocket in bridge mode, is up.
+func (c *WhatsAppChannel) Connected() bool {
+	client := c.nativeClient()
+	if c.config.BridgeURL != "" {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.connected
+	}
+	return client != nil && client.IsConnected()
+}
+
 // ===========================================================================
 // Native mode — whatsmeow
 // ===========================================================================
 
+// nativeClient returns the whatsmeow client, which Repair replaces while
+// sends and event handlers may be using it.
+func (c *WhatsAppChannel) nativeClient() *whatsmeow.Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.client
+}
+
+func (c *WhatsAppChannel) setNativeClient(client *whatsmeow.Client) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.client = client
+}
+
 func (c *WhatsAppChannel) startNative(ctx context.Context) error {
-	storePath := expandHomePath(c.config.StorePath)
-	if storePath == "" {
-		storePath = filepath.Join(os.TempDir(), "picoclaw_whatsapp.db")
+	storePath := c.config.SessionPath()
+	if c.config.LegacyStore() {
+		logger.WarnCF("whatsapp", "WhatsApp store_path names a single session file; run 'picoclaw whatsapp migrate-store' to keep sessions per account", map[string]interface{}{
+			"store_path": storePath,
+		})
+	} else if _, err := os.Stat(storePath); err != nil {
+		legacy := LegacyWhatsAppStores(c.config)
+		// The old default is this gateway's own session, so it moves over
+		// without asking
+		if len(legacy) > 0 && legacy[0] == config.ExpandPath(legacyDefaultStore) {
+			if to, err := MigrateWhatsAppStore(legacy[0], c.config); err != nil {
+				logger.WarnCF("whatsapp", "Failed to move the WhatsApp session to its account directory; run 'picoclaw whatsapp migrate-store' to use it instead of pairing again", map[string]interface{}{
+					"found": legacy[0],
+					"error": err.Error(),
+				})
+			} else {
+				logger.InfoCF("whatsapp", "Moved the WhatsApp session to its account directory", map[string]interface{}{
+					"from": legacy[0],
+					"to":   to,
+				})
+			}
+		} else if len(legacy) > 0 {
+			logger.WarnCF("whatsapp", "Found a WhatsApp session from before per-account stores; stop and run 'picoclaw whatsapp migrate-store' to use it instead of pairing again", map[string]interface{}{
+				"found": legacy[0],
+			})
+		}
 	}
 
 	if err := os.MkdirAll(filepath.Dir(storePath), 0700); err != nil {
@@ -117,29 +512,30 @@ func (c *WhatsAppChannel) startNative(ctx context.Context) error {
 
 	clientLog := waLog.Noop
 	client := whatsmeow.NewClient(deviceStore, clientLog)
-	c.client = client
+	c.setNativeClient(client)
 
 	client.AddEventHandler(c.handleEvent)
 
 	if client.Store.ID == nil {
-		// No session — need QR code login
+		// No session — need QR code login, or a pairing code where there
+		// is no terminal to scan it from
 		qrChan, _ := client.GetQRChannel(ctx)
 		if err := client.Connect(); err != nil {
 			return fmt.Errorf("WhatsApp connect failed: %w", err)
 		}
 
+		var ready chan struct{}
+		if phone := c.config.PairingPhone; phone != "" {
+			ready = make(chan struct{})
+			go func() {
+				defer c.Recover()
+				<-ready
+				c.showPairingCode(ctx, client, phone)
+			}()
+		}
 		logger.InfoC("whatsapp", "Scan the QR code below to log in to WhatsApp:")
-		for evt := range qrChan {
-			switch evt.Event {
-			case "code":
-				qrterminal.GenerateHalfBlock(evt.Code, qrterminal.L, os.Stdout)
-				logger.InfoC("whatsapp", "QR code displayed — scan with WhatsApp on your phone")
-			case "login":
-				logger.InfoC("whatsapp", "WhatsApp login successful!")
-			case "timeout":
-				logger.ErrorC("whatsapp", "QR code timed out. Restart to try again.")
-				return fmt.Errorf("WhatsApp QR code timed out")
-			}
+		if err := c.awaitPairing(qrChan, ready); err != nil {
+			return err
 		}
 	} else {
 		// Existing session — just connect
@@ -153,11 +549,145 @@ func (c *WhatsAppChannel) startNative(ctx context.Context) error {
 	return nil
 }
 
-func (c *WhatsAppChannel) stopNative(_ context.Context) error {
+// awaitPairing prints QR codes until the device is paired or pairing times
+// out. ready, if non-nil, is closed once the first code arrives, which is
+// when a phone pairing code can be requested.
+func (c *WhatsAppChannel) awaitPairing(qrChan <-chan whatsmeow.QRChannelItem, ready chan<- struct{}) error {
+	signal := func() {
+		if ready != nil {
+			close(ready)
+			ready = nil
+		}
+	}
+	defer signal()
+	if c.qrHandler != nil {
+		defer c.qrHandler("")
+	}
+
+	for evt := range qrChan {
+		switch evt.Event {
+		case "code":
+			if c.qrHandler != nil {
+				c.qrHandler(evt.Code)
+			} else {
+				qrterminal.GenerateHalfBlock(evt.Code, qrterminal.L, os.Stdout)
+				logger.InfoC("whatsapp", "QR code displayed — scan with WhatsApp on your phone")
+			}
+			signal()
+		case "login":
+			logger.InfoC("whatsapp", "WhatsApp login successful!")
+		case "timeout":
+			logger.ErrorC("whatsapp", "QR code timed out. Restart to try again.")
+			return fmt.Errorf("WhatsApp QR code timed out")
+		}
+	}
+	return nil
+}
+
+// Repair unlinks the current WhatsApp session and starts pairing a new one.
+// With a phone number (international format, digits only) it returns the
+// code to enter under Linked devices > Link with phone number instead; the
+// QR code is shown as on first start either way.
+func (c *WhatsAppChannel) Repair(ctx context.Context, phone string) (string, error) {
+	if c.config.BridgeURL != "" {
+		return "", fmt.Errorf("re-pairing is not supported in bridge mode, re-pair the bridge instead")
+	}
+	if c.container == nil {
+		return "", fmt.Errorf("WhatsApp channel has not been started")
+	}
+
+	if old := c.nativeClient(); old != nil {
+		if old.Store.ID != nil {
+			if err := old.Logout(ctx); err != nil {
+				// Unlinking failed (e.g. already logged out remotely); drop
+				// the local session anyway so a new one can be paired.
+				logger.WarnCF("whatsapp", "Logout failed, clearing local session", map[string]interface{}{
+					"error": err.Error(),
+				})
+				old.Disconnect()
+				if err := old.Store.Delete(ctx); err != nil {
+					return "", fmt.Errorf("failed to clear WhatsApp session: %w", err)
+				}
+			}
+		} else {
+			old.Disconnect()
+		}
+	}
+	c.setRunning(false)
+
+	client := whatsmeow.NewClient(c.container.NewDevice(), waLog.Noop)
+	client.AddEventHandler(c.handleEvent)
+	c.setNativeClient(client)
+
+	// Pairing outlives the command that started it
+	qrChan, _ := client.GetQRChannel(context.Background())
+	if err := client.Connect(); err != nil {
+		return "", fmt.Errorf("WhatsApp connect failed: %w", err)
+	}
+
+	ready := make(chan struct{})
+	go func() {
+		defer c.Recover()
+		if err := c.awaitPairing(qrChan, ready); err == nil && client.Store.ID != nil {
+			c.setRunning(true)
+		}
+	}()
+	logger.InfoC("whatsapp", "Re-pairing WhatsApp")
+
+	if phone == "" {
+		return "", nil
+	}
+	select {
+	case <-ready:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	return pairPhone(ctx, client, phone)
+}
+
+// pairPhone asks WhatsApp for the code that links the phone with number
+// phone, in international format, to client. The client must have shown
+// its first QR code.
+func pairPhone(ctx context.Context, client *whatsmeow.Client, phone string) (string, error) {
+	phone = strings.TrimLeft(strings.Join(strings.Fields(phone), ""), "+")
+	code, err := client.PairPhone(ctx, phone, true, whatsmeow.PairClientChrome, "Chrome (Linux)")
+	if err != nil {
+		return "", fmt.Errorf("failed to request pairing code: %w", err)
+	}
+	return code, nil
+}
+
+// showPairingCode requests the pairing code for pairing_phone and prints
+// it to the console, like the QR code, for the operator to enter on the
+// phone. The code is kept out of the log, which /admin logs shows in chat.
+// It is called once the first QR code arrives, or when pairing ended
+// before one did.
+func (c *WhatsAppChannel) showPairingCode(ctx context.Context, client *whatsmeow.Client, phone string) {
+	if client.Store.ID != nil {
+		return
+	}
+	code, err := pairPhone(ctx, client, phone)
+	if err != nil {
+		logger.ErrorCF("whatsapp", "Failed to get a WhatsApp pairing code, scan the QR code instead",
+			map[string]interface{}{"phone": phone, "error": err.Error()})
+		return
+	}
+	fmt.Fprintf(os.Stdout, "WhatsApp pairing code for %s: %s\n", phone, code)
+	logger.InfoCF("whatsapp", "Pairing code displayed — enter it in WhatsApp under Linked devices > Link with phone number",
+		map[string]interface{}{"phone": phone})
+}
+
+func (c *WhatsAppChannel) stopNative(ctx context.Context) error {
+	client := c.nativeClient()
 	logger.InfoC("whatsapp", "Stopping WhatsApp native channel...")
 
-	if c.client != nil {
-		c.client.Disconnect()
+	if client != nil {
+		client.Disconnect()
+	}
+	// Messages already received still reach the bus
+	if err := c.inbound.Wait(ctx); err != nil {
+		logger.WarnCF("whatsapp", "Stopped before all received messages were handled",
+			map[string]interface{}{"error": err.Error()})
 	}
 	if c.container != nil {
 		// sqlstore.Container doesn't expose Close, handled by GC
@@ -167,35 +697,227 @@ func (c *WhatsAppChannel) stopNative(_ context.Context) error {
 	return nil
 }
 
-func (c *WhatsAppChannel) sendNative(_ context.Context, msg bus.OutboundMessage) error {
-	if c.client == nil || !c.client.IsConnected() {
+func (c *WhatsAppChannel) sendNative(ctx context.Context, msg bus.OutboundMessage) error {
+	client := c.nativeClient()
+	if client == nil || !client.IsConnected() {
 		return fmt.Errorf("WhatsApp native client not connected")
 	}
 
-	jid, err := types.ParseJID(msg.ChatID)
+	jid, err := chatJID(msg.ChatID)
 	if err != nil {
-		return fmt.Errorf("invalid WhatsApp JID %q: %w", msg.ChatID, err)
+		return err
 	}
+	reply := c.replyContext(jid, msg.ReplyToID)
+	if len(msg.Media) > 0 {
+		return c.sendNativeMedia(ctx, jid, msg, reply)
+	}
+	return c.sendNativeText(ctx, jid, msg.Content, reply)
+}
 
-	_, err = c.client.SendMessage(context.Background(), jid, &waE2E.Message{
-		Conversation: strPtr(msg.Content),
-	})
+// sendNativeText sends text, quoting the message reply describes unless
+// it is nil.
+func (c *WhatsAppChannel) sendNativeText(ctx context.Context, jid types.JID, text string, reply *waE2E.ContextInfo) error {
+	client := c.nativeClient()
+	waMsg := &waE2E.Message{Conversation: strPtr(text)}
+	if reply != nil {
+		waMsg = &waE2E.Message{ExtendedTextMessage: &waE2E.ExtendedTextMessage{
+			Text:        strPtr(text),
+			ContextInfo: reply,
+		}}
+	}
+	resp, err := client.SendMessage(context.Background(), jid, waMsg)
 	if err != nil {
 		return fmt.Errorf("failed to send WhatsApp message: %w", err)
 	}
+	reportSent(ctx, resp.ID)
+	return nil
+}
 
+// sendNativeMedia uploads and sends each attachment. The text goes along
+// as the first one's caption, or before the attachments when it is too
+// long for one or the first is audio, which WhatsApp shows no caption for.
+// Whichever goes first quotes the message reply describes, if any.
+func (c *WhatsAppChannel) sendNativeMedia(ctx context.Context, jid types.JID, msg bus.OutboundMessage, reply *waE2E.ContextInfo) error {
+	client := c.nativeClient()
+	caption := strings.TrimSpace(msg.Content)
+	firstKind, _, _ := sniffAttachment(msg.Media[0])
+	if caption != "" && (len([]rune(caption)) > whatsappCaptionLength || firstKind == utils.MediaAudio) {
+		if err := c.sendNativeText(ctx, jid, msg.Content, reply); err != nil {
+			return err
+		}
+		caption, reply = "", nil
+	}
+	for _, path := range msg.Media {
+		waMsg, err := c.uploadMedia(ctx, path, caption)
+		if err != nil {
+			return fmt.Errorf("failed to upload attachment %s: %w", filepath.Base(path), err)
+		}
+		if reply != nil {
+			setWhatsAppContextInfo(waMsg, reply)
+			reply = nil
+		}
+		resp, err := client.SendMessage(context.Background(), jid, waMsg)
+		if err != nil {
+			return fmt.Errorf("failed to send attachment %s: %w", filepath.Base(path), err)
+		}
+		reportSent(ctx, resp.ID)
+		caption = ""
+	}
 	return nil
 }
 
+// uploadMedia uploads the file at path to WhatsApp's media servers and
+// returns the message that shares it, by the kind its content shows.
+func (c *WhatsAppChannel) uploadMedia(ctx context.Context, path, caption string) (*waE2E.Message, error) {
+	client := c.nativeClient()
+	kind, mimeType, err := sniffAttachment(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	uploaded, err := client.UploadReader(ctx, f, nil, whatsappMediaType(kind))
+	if err != nil {
+		return nil, err
+	}
+	return whatsappMediaMessage(kind, mimeType, filepath.Base(path), caption, uploaded), nil
+}
+
+// sniffAttachment returns the kind of attachment the file at path is, see
+// utils.MediaKind, and its MIME type, both going by its content rather
+// than its name.
+func sniffAttachment(path string) (kind, mimeType string, err error) {
+	mimeType, err = utils.SniffMedia(path)
+	if err != nil {
+		return "", "", err
+	}
+	if base, _, err := mime.ParseMediaType(mimeType); err == nil {
+		mimeType = base
+	}
+	return utils.MediaKind("", mimeType), mimeType, nil
+}
+
+// whatsappMediaType is the media type a kind of attachment is uploaded as,
+// see utils.MediaKind.
+func whatsappMediaType(kind string) whatsmeow.MediaType {
+	switch kind {
+	case utils.MediaImage:
+		return whatsmeow.MediaImage
+	case utils.MediaVideo:
+		return whatsmeow.MediaVideo
+	case utils.MediaAudio:
+		return whatsmeow.MediaAudio
+	}
+	return whatsmeow.MediaDocument
+}
+
+// whatsappMediaMessage builds the message sharing an uploaded attachment:
+// an image, a video, audio, played as a voice note when it is Ogg, or a
+// document under its file name.
+func whatsappMediaMessage(kind, mimeType, name, caption string, up whatsmeow.UploadResponse) *waE2E.Message {
+	var captionPtr *string
+	if caption != "" {
+		captionPtr = strPtr(caption)
+	}
+	switch kind {
+	case utils.MediaImage:
+		return &waE2E.Message{ImageMessage: &waE2E.ImageMessage{
+			Caption:       captionPtr,
+			Mimetype:      strPtr(mimeType),
+			URL:           strPtr(up.URL),
+			DirectPath:    strPtr(up.DirectPath),
+			MediaKey:      up.MediaKey,
+			FileEncSHA256: up.FileEncSHA256,
+			FileSHA256:    up.FileSHA256,
+			FileLength:    &up.FileLength,
+		}}
+	case utils.MediaVideo:
+		return &waE2E.Message{VideoMessage: &waE2E.VideoMessage{
+			Caption:       captionPtr,
+			Mimetype:      strPtr(mimeType),
+			URL:           strPtr(up.URL),
+			DirectPath:    strPtr(up.DirectPath),
+			MediaKey:      up.MediaKey,
+			FileEncSHA256: up.FileEncSHA256,
+			FileSHA256:    up.FileSHA256,
+			FileLength:    &up.FileLength,
+		}}
+	case utils.MediaAudio:
+		voiceNote := mimeType == "audio/ogg" || mimeType == "application/ogg"
+		return &waE2E.Message{AudioMessage: &waE2E.AudioMessage{
+			PTT:           &voiceNote,
+			Mimetype:      strPtr(mimeType),
+			URL:           strPtr(up.URL),
+			DirectPath:    strPtr(up.DirectPath),
+			MediaKey:      up.MediaKey,
+			FileEncSHA256: up.FileEncSHA256,
+			FileSHA256:    up.FileSHA256,
+			FileLength:    &up.FileLength,
+		}}
+	}
+	return &waE2E.Message{DocumentMessage: &waE2E.DocumentMessage{
+		Caption:       captionPtr,
+		Title:         strPtr(name),
+		FileName:      strPtr(name),
+		Mimetype:      strPtr(mimeType),
+		URL:           strPtr(up.URL),
+		DirectPath:    strPtr(up.DirectPath),
+		MediaKey:      up.MediaKey,
+		FileEncSHA256: up.FileEncSHA256,
+		FileSHA256:    up.FileSHA256,
+		FileLength:    &up.FileLength,
+	}}
+}
+
 // handleEvent is the whatsmeow event dispatcher.
 func (c *WhatsAppChannel) handleEvent(rawEvt interface{}) {
+	defer c.Recover()
+
 	switch evt := rawEvt.(type) {
 	case *events.Message:
-		c.handleMessageEvent(evt)
+		// Blocks only once inboundQueueSize messages are waiting
+		c.inbound.Submit(evt.Info.Chat.String(), func() { c.handleMessageEvent(evt) })
+	case *events.Receipt:
+		c.handleReceipt(evt)
+	case *events.JoinedGroup:
+		var actorID string
+		if evt.Sender != nil {
+			actorID = evt.Sender.String()
+		}
+		c.PublishChatEvent(bus.ChatEvent{
+			ChatID:  evt.JID.String(),
+			Type:    bus.ChatBotAdded,
+			ActorID: actorID,
+			Name:    evt.Name,
+		})
+	case *events.GroupInfo:
+		c.handleGroupInfo(evt)
+	case *events.CallOffer:
+		c.handleCallOffer(evt)
+	case *events.Presence:
+		c.handlePresence(evt)
+	case *events.Archive:
+		if !evt.FromFullSync && evt.Action.GetArchived() {
+			c.HandleChatEvent(evt.JID.String(), bus.ChatArchived, nil, "")
+		}
 	case *events.Connected:
 		logger.InfoC("whatsapp", "WhatsApp connected")
+		// WhatsApp only shows "typing…" from accounts that are online
+		if client := c.nativeClient(); client != nil {
+			if err := client.SendPresence(context.Background(), types.PresenceAvailable); err != nil {
+				logger.DebugCF("whatsapp", "Failed to send online presence", map[string]interface{}{
+					"error": err.Error(),
+				})
+			}
+			c.resubscribePresence()
+		}
+		c.PublishStatus(bus.ChannelStatus{State: bus.ChannelConnected})
 	case *events.Disconnected:
 		logger.WarnC("whatsapp", "WhatsApp disconnected (will auto-reconnect)")
+		c.PublishStatus(bus.ChannelStatus{State: bus.ChannelReconnecting, Error: "disconnected"})
 	case *events.LoggedOut:
 		logger.ErrorC("whatsapp", "WhatsApp logged out! Delete store and re-scan QR code.")
 		c.setRunning(false)
@@ -204,6 +926,172 @@ func (c *WhatsAppChannel) handleEvent(rawEvt interface{}) {
 	}
 }
 
+// handleReceipt passes on the delivered and read receipts for messages the
+// bot sent. A played voice note counts as read.
+func (c *WhatsAppChannel) handleReceipt(evt *events.Receipt) {
+	if evt.IsFromMe {
+		return
+	}
+	var status string
+	switch evt.Type {
+	case types.ReceiptTypeDelivered:
+		status = bus.ReceiptDelivered
+	case types.ReceiptTypeRead, types.ReceiptTypePlayed:
+		status = bus.ReceiptRead
+	default:
+		return
+	}
+	c.bus.PublishReceipt(bus.Receipt{
+		Channel:    c.Name(),
+		ChatID:     evt.Chat.String(),
+		MessageIDs: evt.MessageIDs,
+		Status:     status,
+	})
+}
+
+// handleGroupInfo reports participants joining and leaving a group, or the
+// bot being removed from it.
+func (c *WhatsAppChannel) handleGroupInfo(evt *events.GroupInfo) {
+	chatID := evt.JID.String()
+	var actorID string
+	if evt.Sender != nil {
+		actorID = evt.Sender.String()
+	}
+	var joined, left []bus.ChatMember
+	for _, jid := range evt.Join {
+		if !c.isSelf(jid) {
+			joined = append(joined, bus.ChatMember{ID: jid.String()})
+		}
+	}
+	removed := false
+	for _, jid := range evt.Leave {
+		if c.isSelf(jid) {
+			removed = true
+		} else {
+			left = append(left, bus.ChatMember{ID: jid.String()})
+		}
+	}
+	if len(joined) > 0 {
+		c.HandleChatEvent(chatID, bus.ChatMemberJoined, joined, actorID)
+	}
+	if len(left) > 0 {
+		c.HandleChatEvent(chatID, bus.ChatMemberLeft, left, actorID)
+	}
+	if removed {
+		c.HandleChatEvent(chatID, bus.ChatBotRemoved, nil, actorID)
+	}
+}
+
+// handleCallOffer turns down a call to the bot's number when reject_calls
+// is on, and tells callers on the allowlist to write instead. Every call
+// is published as a chat event, so operators see who tried.
+func (c *WhatsAppChannel) handleCallOffer(evt *events.CallOffer) {
+	client := c.nativeClient()
+	caller := evt.CallCreator
+	if caller.IsEmpty() {
+		caller = evt.From
+	}
+	callerID := caller.ToNonAD().String()
+	chatID := callerID
+	if !evt.GroupJID.IsEmpty() {
+		chatID = evt.GroupJID.String()
+	}
+	c.PublishChatEvent(bus.ChatEvent{
+		ChatID:  chatID,
+		Type:    bus.ChatCall,
+		ActorID: callerID,
+		Direct:  evt.GroupJID.IsEmpty(),
+	})
+	if !c.config.RejectCalls {
+		return
+	}
+
+	if client == nil {
+		logger.WarnC("whatsapp", "Cannot reject call without the native client")
+	} else if err := client.RejectCall(context.Background(), evt.From, evt.CallID); err != nil {
+		logger.WarnCF("whatsapp", "Failed to reject call", map[string]interface{}{
+			"caller": callerID,
+			"error":  err.Error(),
+		})
+	}
+	if !c.IsAllowed(callerID) {
+		return
+	}
+	reply := c.config.CallReply
+	if reply == "" {
+		reply = i18n.T(c.Name(), callerID, "call.rejected")
+	}
+	c.bus.PublishOutbound(bus.OutboundMessage{
+		Channel: c.Name(),
+		ChatID:  callerID,
+		Content: reply,
+	})
+}
+
+// isSelf reports whether jid is the bot's own account, by phone number or
+// by LID.
+func (c *WhatsAppChannel) isSelf(jid types.JID) bool {
+	client := c.nativeClient()
+	if client == nil || client.Store.ID == nil {
+		return false
+	}
+	return jid.User == client.Store.ID.User || (!client.Store.LID.IsEmpty() && jid.User == client.Store.LID.User)
+}
+
+// selfMentions returns the JIDs in a message's context that @mention the
+// bot, by phone number or by LID.
+func (c *WhatsAppChannel) selfMentions(info *waE2E.ContextInfo) []types.JID {
+	var mentions []types.JID
+	for _, s := range info.GetMentionedJID() {
+		if jid, err := types.ParseJID(s); err == nil && c.isSelf(jid) {
+			mentions = append(mentions, jid)
+		}
+	}
+	return mentions
+}
+
+// quotesSelf reports whether a message replies to one of the bot's.
+func (c *WhatsAppChannel) quotesSelf(info *waE2E.ContextInfo) bool {
+	if info.GetStanzaID() == "" || info.GetParticipant() == "" {
+		return false
+	}
+	jid, err := types.ParseJID(info.GetParticipant())
+	return err == nil && c.isSelf(jid)
+}
+
+// stripWhatsAppMentions removes the "@number" tags of the bot's mentions
+// from text, which the agent need not see.
+func stripWhatsAppMentions(text string, mentions []types.JID) string {
+	if len(mentions) == 0 {
+		return text
+	}
+	for _, jid := range mentions {
+		text = strings.ReplaceAll(text, "@"+jid.User, "")
+	}
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// DeleteMessage implements DeleteChannel, deleting the bot's message for
+// everyone in the chat.
+func (c *WhatsAppChannel) DeleteMessage(ctx context.Context, chatID, messageID string) error {
+	client := c.nativeClient()
+	if c.config.BridgeURL != "" {
+		logger.DebugC("whatsapp", "Bridge cannot delete messages, dropping deletion")
+		return nil
+	}
+	if client == nil || !client.IsConnected() {
+		return fmt.Errorf("WhatsApp native client not connected")
+	}
+	chat, err := types.ParseJID(chatID)
+	if err != nil {
+		return fmt.Errorf("invalid WhatsApp JID %q: %w", chatID, err)
+	}
+	if _, err := client.SendMessage(ctx, chat, client.BuildRevoke(chat, types.EmptyJID, messageID)); err != nil {
+		return fmt.Errorf("failed to delete WhatsApp message: %w", err)
+	}
+	return nil
+}
+
 // handleMessageEvent processes an incoming WhatsApp message.
 func (c *WhatsAppChannel) handleMessageEvent(evt *events.Message) {
 	// Skip self-sent messages
@@ -220,6 +1108,59 @@ func (c *WhatsAppChannel) handleMessageEvent(evt *events.Message) {
 	chatID := evt.Info.Chat.String()
 	msg := evt.Message
 
+	// A reaction without text takes the sender's reaction back
+	if r := msg.GetReactionMessage(); r != nil {
+		// The key is as the reacting user sees it: from them, or from
+		// the participant named
+		on, author := bus.ReactionOnUser, senderID
+		if key := r.GetKey(); !key.GetFromMe() {
+			author = key.GetParticipant()
+			jid, err := types.ParseJID(author)
+			if author == "" || (err == nil && c.isSelf(jid)) {
+				on = bus.ReactionOnBot
+			}
+		}
+		c.HandleReaction(senderID, chatID, bus.Reaction{
+			MessageID: r.GetKey().GetID(),
+			Emoji:     r.GetText(),
+			Remove:    r.GetText() == "",
+			Author:    author,
+			On:        on,
+		}, map[string]string{"sender_jid": senderID})
+		return
+	}
+
+	// Edits and deletions ("delete for everyone") of an earlier message
+	if p := msg.GetProtocolMessage(); p != nil {
+		metadata := map[string]string{"sender_jid": senderID}
+		switch p.GetType() {
+		case waE2E.ProtocolMessage_REVOKE:
+			c.HandleChange(senderID, chatID, bus.Change{MessageID: p.GetKey().GetID(), Deleted: true}, "", metadata)
+		case waE2E.ProtocolMessage_MESSAGE_EDIT:
+			c.HandleChange(senderID, chatID, bus.Change{MessageID: p.GetKey().GetID()}, whatsappText(p.GetEditedMessage()), metadata)
+		}
+		return
+	}
+
+	// Invitations to join a group, which the bot takes up once approved
+	if inv := msg.GetGroupInviteMessage(); inv != nil {
+		invite := fmt.Sprintf("%s|%s|%d", senderID, inv.GetInviteCode(), inv.GetInviteExpiration())
+		c.HandleInvite(senderID, inv.GetGroupJID(), inv.GetGroupName(), invite)
+		return
+	}
+
+	// Groups set to respond only when mentioned skip other messages before
+	// anything is downloaded; a reply to the bot counts as a mention
+	quoteInfo := whatsappContextInfo(msg)
+	mentions := c.selfMentions(quoteInfo)
+	if evt.Info.IsGroup && c.config.RespondOnlyWhenMentioned && len(mentions) == 0 && !c.quotesSelf(quoteInfo) {
+		logger.DebugCF("whatsapp", "Group message does not mention the bot, ignoring", map[string]interface{}{
+			"chat": chatID,
+			"from": senderID,
+		})
+		return
+	}
+
 	var content string
 	var mediaPaths []string
 	var localFiles []string
@@ -236,25 +1177,58 @@ func (c *WhatsAppChannel) handleMessageEvent(evt *events.Message) {
 	} else if ext := msg.GetExtendedTextMessage(); ext != nil && ext.GetText() != "" {
 		content = ext.GetText()
 	}
+	content = stripWhatsAppMentions(content, mentions)
+
+	// Attachments are fetched together; each is left out if it fails
+	var dl downloads
+	var imgPath, vidPath, docPath, audioPath string
+	imgMsg, vidMsg, docMsg, audioMsg := msg.GetImageMessage(), msg.GetVideoMessage(), msg.GetDocumentMessage(), msg.GetAudioMessage()
+	if imgMsg != nil {
+		dl.add(&imgPath, func(ctx context.Context) string { return c.downloadMedia(ctx, imgMsg, utils.MediaImage, ".jpg") })
+	}
+	if vidMsg != nil {
+		dl.add(&vidPath, func(ctx context.Context) string { return c.downloadMedia(ctx, vidMsg, utils.MediaVideo, ".mp4") })
+	}
+	if docMsg != nil {
+		ext := ".bin"
+		if fn := docMsg.GetFileName(); fn != "" {
+			ext = filepath.Ext(fn)
+			if ext == "" {
+				ext = ".bin"
+			}
+		}
+		dl.add(&docPath, func(ctx context.Context) string { return c.downloadMedia(ctx, docMsg, utils.MediaAny, ext) })
+	}
+	if audioMsg != nil {
+		dl.add(&audioPath, func(ctx context.Context) string { return c.downloadMedia(ctx, audioMsg, utils.MediaAudio, ".ogg") })
+	}
+	// A photo the user replies to, so "what is this?" has it to look at
+	var quotedImgPath string
+	if quotedImg := quoteInfo.GetQuotedMessage().GetImageMessage(); quotedImg != nil && imgMsg == nil {
+		dl.add(&quotedImgPath, func(ctx context.Context) string { return c.downloadMedia(ctx, quotedImg, utils.MediaImage, ".jpg") })
+	}
+	dl.run(context.Background(), "whatsapp")
 
 	// Image message
-	if imgMsg := msg.GetImageMessage(); imgMsg != nil {
-		path := c.downloadMedia(imgMsg, ".jpg")
-		if path != "" {
-			localFiles = append(localFiles, path)
-			mediaPaths = append(mediaPaths, path)
+	if imgMsg != nil {
+		if imgPath != "" {
+			// Images are handed to the agent (for vision), which removes them
+			mediaPaths = append(mediaPaths, imgPath)
 		}
 		if caption := imgMsg.GetCaption(); caption != "" {
 			content = appendWhatsAppContent(content, caption)
 		}
 	}
 
+	if quotedImgPath != "" {
+		mediaPaths = append(mediaPaths, quotedImgPath)
+	}
+
 	// Video message
-	if vidMsg := msg.GetVideoMessage(); vidMsg != nil {
-		path := c.downloadMedia(vidMsg, ".mp4")
-		if path != "" {
-			localFiles = append(localFiles, path)
-			mediaPaths = append(mediaPaths, path)
+	if vidMsg != nil {
+		if vidPath != "" {
+			localFiles = append(localFiles, vidPath)
+			mediaPaths = append(mediaPaths, vidPath)
 		}
 		if caption := vidMsg.GetCaption(); caption != "" {
 			content = appendWhatsAppContent(content, caption)
@@ -262,18 +1236,10 @@ func (c *WhatsAppChannel) handleMessageEvent(evt *events.Message) {
 	}
 
 	// Document message
-	if docMsg := msg.GetDocumentMessage(); docMsg != nil {
-		ext := ".bin"
-		if fn := docMsg.GetFileName(); fn != "" {
-			ext = filepath.Ext(fn)
-			if ext == "" {
-				ext = ".bin"
-			}
-		}
-		path := c.downloadMedia(docMsg, ext)
-		if path != "" {
-			localFiles = append(localFiles, path)
-			mediaPaths = append(mediaPaths, path)
+	if docMsg != nil {
+		if docPath != "" {
+			localFiles = append(localFiles, docPath)
+			mediaPaths = append(mediaPaths, docPath)
 		}
 		if caption := docMsg.GetCaption(); caption != "" {
 			content = appendWhatsAppContent(content, caption)
@@ -281,13 +1247,18 @@ func (c *WhatsAppChannel) handleMessageEvent(evt *events.Message) {
 	}
 
 	// Audio/voice message
-	if audioMsg := msg.GetAudioMessage(); audioMsg != nil {
-		path := c.downloadMedia(audioMsg, ".ogg")
-		if path != "" {
-			localFiles = append(localFiles, path)
-			mediaPaths = append(mediaPaths, path)
-			content = appendWhatsAppContent(content, c.handleVoiceMessage(path))
+	var audioSeconds float64
+	if audioPath != "" {
+		localFiles = append(localFiles, audioPath)
+		mediaPaths = append(mediaPaths, audioPath)
+		// /privacy is kept by phone number for senders known by their LID
+		voiceSender := senderID
+		if pn := whatsappSenderPN(evt.Info.MessageSource); pn != "" {
+			voiceSender = pn
 		}
+		text, seconds := c.handleVoiceMessage(voiceSender, chatID, audioPath)
+		content = appendWhatsAppContent(content, text)
+		audioSeconds += seconds
 	}
 
 	// Sticker
@@ -303,36 +1274,42 @@ func (c *WhatsAppChannel) handleMessageEvent(evt *events.Message) {
 		"message_id": evt.Info.ID,
 		"sender_jid": senderID,
 	}
+	if pn := whatsappSenderPN(evt.Info.MessageSource); pn != "" {
+		metadata["sender_pn"] = pn
+	}
 	if evt.Info.PushName != "" {
 		metadata["user_name"] = evt.Info.PushName
 	}
+	metadata["is_group"] = strconv.FormatBool(evt.Info.IsGroup)
 	if evt.Info.IsGroup {
-		metadata["is_group"] = "true"
+		metadata["mentioned"] = strconv.FormatBool(len(mentions) > 0)
 	}
+	if audioSeconds > 0 {
+		metadata["transcription_seconds"] = strconv.FormatFloat(audioSeconds, 'f', 1, 64)
+	}
+	c.addQuoteMetadata(metadata, quoteInfo)
+	c.rememberQuotable(chatID, quotable{id: evt.Info.ID, sender: senderID, text: whatsappText(msg)})
 
 	logger.DebugCF("whatsapp", "Message received", map[string]interface{}{
 		"from":    senderID,
 		"content": utils.Truncate(content, 50),
 	})
 
-	c.HandleMessage(senderID, chatID, content, mediaPaths, metadata)
+	c.HandleReply(senderID, chatID, content, mediaPaths, metadata, whatsappQuote(msg))
 }
 
 // downloadMedia downloads a whatsmeow-downloadable message to a temp file.
-func (c *WhatsAppChannel) downloadMedia(msg whatsmeow.DownloadableMessage, ext string) string {
-	if c.client == nil {
-		return ""
-	}
-
-	data, err := c.client.Download(context.Background(), msg)
-	if err != nil {
-		logger.ErrorCF("whatsapp", "Failed to download media", map[string]interface{}{
-			"error": err.Error(),
-		})
+// The media is decrypted and checked on its way to disk, so a long video
+// never sits in memory whole. The file then gets the extension of what it
+// holds, ext being only a guess, and is dropped unless it is kind; see
+// utils.NormalizeMedia.
+func (c *WhatsAppChannel) downloadMedia(ctx context.Context, msg whatsmeow.DownloadableMessage, kind, ext string) string {
+	client := c.nativeClient()
+	if client == nil {
 		return ""
 	}
 
-	mediaDir := filepath.Join(os.TempDir(), "picoclaw_media")
+	mediaDir := utils.MediaDir()
 	os.MkdirAll(mediaDir, 0700)
 
 	tmpFile, err := os.CreateTemp(mediaDir, "wa_*"+ext)
@@ -343,20 +1320,45 @@ func (c *WhatsAppChannel) downloadMedia(msg whatsmeow.DownloadableMessage, ext s
 		return ""
 	}
 
-	if _, err := tmpFile.Write(data); err != nil {
+	if err := client.DownloadToFile(ctx, msg, tmpFile); err != nil {
 		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+		logger.ErrorCF("whatsapp", "Failed to download media", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return ""
+	}
+	if err := tmpFile.Close(); err != nil {
 		os.Remove(tmpFile.Name())
 		return ""
 	}
-	tmpFile.Close()
 
-	return tmpFile.Name()
+	path, err := utils.CheckDownload("whatsapp", tmpFile.Name(), kind)
+	if err != nil {
+		return ""
+	}
+	return path
 }
 
-// handleVoiceMessage transcribes a voice message if a transcriber is available.
-func (c *WhatsAppChannel) handleVoiceMessage(audioPath string) string {
+// whatsappSenderPN returns the phone-number JID of a sender known by their
+// LID, which presence and per-person settings go by, or "" when the sender
+// is known by phone number already or the number is not shared.
+func whatsappSenderPN(src types.MessageSource) string {
+	if src.Sender.Server == types.HiddenUserServer && src.SenderAlt.Server == types.DefaultUserServer {
+		return src.SenderAlt.ToNonAD().String()
+	}
+	return ""
+}
+
+// handleVoiceMessage transcribes a voice message if a transcriber is
+// available and the sender's privacy allows, returning the text and the
+// audio length in seconds.
+func (c *WhatsAppChannel) handleVoiceMessage(senderID, chatID, audioPath string) (string, float64) {
 	if c.transcriber == nil || !c.transcriber.IsAvailable() {
-		return "[voice]"
+		return "[voice]", 0
+	}
+	if !c.mayTranscribe(senderID, chatID) {
+		return i18n.T(c.Name(), chatID, "voice.private"), 0
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -367,10 +1369,10 @@ func (c *WhatsAppChannel) handleVoiceMessage(audioPath string) string {
 		logger.ErrorCF("whatsapp", "Voice transcription failed", map[string]interface{}{
 			"error": err.Error(),
 		})
-		return "[voice (transcription failed)]"
+		return i18n.T(c.Name(), chatID, "voice.transcription_failed"), 0
 	}
 
-	return fmt.Sprintf("[voice transcription: %s]", result.Text)
+	return fmt.Sprintf("[voice transcription: %s]", result.Text), result.Duration
 }
 
 // ===========================================================================
@@ -382,30 +1384,150 @@ func (c *WhatsAppChannel) startBridge(ctx context.Context) error {
 		"url": c.url,
 	})
 
-	dialer := websocket.DefaultDialer
-	dialer.HandshakeTimeout = 10 * time.Second
+	if err := c.connectBridge(); err != nil {
+		return err
+	}
+	c.setRunning(true)
 
-	conn, _, err := dialer.Dial(c.url, nil)
+	go crash.Supervise(ctx, "whatsapp.bridge", c.listenBridge)
+	go crash.Supervise(ctx, "whatsapp.bridge.heartbeat", c.pingBridge)
+
+	return nil
+}
+
+// connectBridge dials the bridge, negotiates the protocol, and sends again
+// what the bridge did not receive before a reconnect.
+func (c *WhatsAppChannel) connectBridge() error {
+	conn, first, err := c.dialBridge(true)
 	if err != nil {
-		return fmt.Errorf("failed to connect to WhatsApp bridge: %w", err)
+		return err
 	}
 
 	c.mu.Lock()
 	c.conn = conn
 	c.connected = true
+	var resent int
+	if c.session.v2() {
+		for _, f := range c.session.after(0) {
+			if err := c.writeBridgeLocked(f); err != nil {
+				break
+			}
+			resent++
+		}
+	}
 	c.mu.Unlock()
 
-	c.setRunning(true)
-	logger.InfoC("whatsapp", "WhatsApp bridge connected")
+	logger.InfoCF("whatsapp", "WhatsApp bridge connected", map[string]interface{}{
+		"protocol": c.session.protocol(),
+		"resent":   resent,
+	})
+	if first != nil {
+		c.handleBridgeFrame(first)
+	}
+	return nil
+}
 
-	go c.listenBridge(ctx)
+// dialBridge connects to the bridge and, if hello is set, opens with a
+// hello. A bridge that does not answer in time speaks version 1, and is
+// dialed again without one. Anything else the bridge sends first is
+// returned for handling.
+func (c *WhatsAppChannel) dialBridge(hello bool) (*websocket.Conn, []byte, error) {
+	dialer := websocket.DefaultDialer
+	dialer.HandshakeTimeout = 10 * time.Second
 
-	return nil
+	conn, _, err := dialer.Dial(c.url, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to WhatsApp bridge: %w", err)
+	}
+	if !hello {
+		c.session.legacy()
+		return conn, nil, nil
+	}
+
+	if err := conn.WriteJSON(c.session.hello()); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to greet WhatsApp bridge: %w", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(bridgeHandshakeTimeout))
+	_, data, err := conn.ReadMessage()
+	conn.SetReadDeadline(time.Time{})
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		// A timed out websocket cannot be read again
+		conn.Close()
+		logger.WarnC("whatsapp", "WhatsApp bridge did not answer hello, using protocol v1 without acknowledgements")
+		return c.dialBridge(false)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to greet WhatsApp bridge: %w", err)
+	}
+
+	var f bridgeFrame
+	if json.Unmarshal(data, &f) == nil && f.Type == "hello" && f.Version >= 2 {
+		c.session.negotiate(f)
+		return conn, nil, nil
+	}
+	c.session.legacy()
+	logger.WarnC("whatsapp", "WhatsApp bridge speaks protocol v1, messages are not acknowledged")
+	return conn, data, nil
+}
+
+const (
+	// bridgeReconnectMin and bridgeReconnectMax bound the wait between
+	// attempts to reach the bridge again, which doubles after each one.
+	bridgeReconnectMin = time.Second
+	bridgeReconnectMax = time.Minute
+)
+
+// bridgeReconnectDelay is the wait before reconnect attempt n, counting
+// from 1. Up to half of it is random, so gateways sharing a bridge that
+// restarted do not all redial at the same moment.
+func bridgeReconnectDelay(attempt int) time.Duration {
+	d := min(bridgeReconnectMin<<min(attempt-1, 16), bridgeReconnectMax)
+	return d/2 + rand.N(d/2+1)
+}
+
+// reconnectBridge dials the bridge until it answers, backing off between
+// attempts, and reports whether it did before the channel stopped. Each
+// failed attempt is published as a status, and so is getting through.
+func (c *WhatsAppChannel) reconnectBridge(ctx context.Context) bool {
+	delay := bridgeReconnectDelay(1)
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(delay):
+		}
+		if !c.IsRunning() {
+			return false
+		}
+		err := c.connectBridge()
+		if err == nil {
+			c.PublishStatus(bus.ChannelStatus{State: bus.ChannelConnected, Attempt: attempt})
+			return true
+		}
+		delay = bridgeReconnectDelay(attempt + 1)
+		logger.WarnCF("whatsapp", "WhatsApp bridge reconnect failed", map[string]interface{}{
+			"error":    err.Error(),
+			"attempt":  attempt,
+			"retry_in": delay.String(),
+			"pending":  c.session.pending(),
+		})
+		c.PublishStatus(bus.ChannelStatus{
+			State:   bus.ChannelReconnecting,
+			Error:   err.Error(),
+			Attempt: attempt,
+			RetryIn: delay,
+		})
+	}
 }
 
 func (c *WhatsAppChannel) stopBridge(_ context.Context) error {
 	logger.InfoC("whatsapp", "Stopping WhatsApp bridge channel...")
 
+	c.setRunning(false)
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -419,79 +1541,219 @@ func (c *WhatsAppChannel) stopBridge(_ context.Context) error {
 	}
 
 	c.connected = false
-	c.setRunning(false)
 
 	return nil
 }
 
+// sendBridge sends a message to the bridge. With protocol v2 a message the
+// connection drops on is kept and sent again after reconnecting.
 func (c *WhatsAppChannel) sendBridge(_ context.Context, msg bus.OutboundMessage) error {
+	return c.sendBridgeFrame(bridgeFrame{
+		Type:    "message",
+		To:      msg.ChatID,
+		Content: msg.Content,
+		ReplyTo: msg.ReplyToID,
+	})
+}
+
+// sendBridgeFrame sends a message or reaction frame, numbered with protocol
+// v2 so it is sent again if the connection drops before it is acked.
+func (c *WhatsAppChannel) sendBridgeFrame(f bridgeFrame) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	if c.conn == nil {
 		return fmt.Errorf("whatsapp bridge connection not established")
 	}
-
-	payload := map[string]interface{}{
-		"type":    "message",
-		"to":      msg.ChatID,
-		"content": msg.Content,
+	if !c.session.v2() {
+		if err := c.writeBridgeLocked(f); err != nil {
+			return fmt.Errorf("failed to send message: %w", err)
+		}
+		return nil
 	}
 
-	data, err := json.Marshal(payload)
+	f, err := c.session.number(f)
 	if err != nil {
-		return fmt.Errorf("failed to marshal message: %w", err)
+		return err
+	}
+	if err := c.writeBridgeLocked(f); err != nil {
+		logger.WarnCF("whatsapp", "Bridge send failed, resending after reconnect", map[string]interface{}{
+			"seq":   f.Seq,
+			"error": err.Error(),
+		})
 	}
+	return nil
+}
 
-	if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
-		return fmt.Errorf("failed to send message: %w", err)
+// writeBridge sends a frame over the current connection, if any.
+func (c *WhatsAppChannel) writeBridge(f bridgeFrame) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return fmt.Errorf("whatsapp bridge connection not established")
 	}
+	return c.writeBridgeLocked(f)
+}
 
-	return nil
+// writeBridgeLocked sends a frame; c.mu must be held and c.conn set.
+func (c *WhatsAppChannel) writeBridgeLocked(f bridgeFrame) error {
+	data, err := json.Marshal(f)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+	return c.conn.WriteMessage(websocket.TextMessage, data)
 }
 
-func (c *WhatsAppChannel) listenBridge(ctx context.Context) {
+// pingBridge sends heartbeats to bridges that answer them.
+func (c *WhatsAppChannel) pingBridge(ctx context.Context) {
+	ticker := time.NewTicker(bridgeHeartbeat)
+	defer ticker.Stop()
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		default:
-			c.mu.Lock()
-			conn := c.conn
-			c.mu.Unlock()
+		case <-ticker.C:
+		}
+		if !c.IsRunning() {
+			return
+		}
+		if c.session.v2() && c.session.can("ping") {
+			// A failed ping shows up as a read error in listenBridge
+			c.writeBridge(bridgeFrame{Type: "ping"})
+		}
+	}
+}
 
-			if conn == nil {
-				time.Sleep(1 * time.Second)
-				continue
+func (c *WhatsAppChannel) listenBridge(ctx context.Context) {
+	for {
+		if ctx.Err() != nil || !c.IsRunning() {
+			return
+		}
+		c.mu.Lock()
+		conn := c.conn
+		c.mu.Unlock()
+		if conn == nil {
+			if !c.reconnectBridge(ctx) {
+				return
 			}
+			continue
+		}
 
-			_, message, err := conn.ReadMessage()
-			if err != nil {
-				logger.ErrorCF("whatsapp", "Bridge read error", map[string]interface{}{
-					"error": err.Error(),
-				})
-				time.Sleep(2 * time.Second)
-				continue
+		if c.session.v2() && c.session.can("ping") {
+			// Two missed heartbeats mean the connection is gone
+			conn.SetReadDeadline(time.Now().Add(2 * bridgeHeartbeat))
+		}
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if ctx.Err() != nil || !c.IsRunning() {
+				return
 			}
-
-			var msg map[string]interface{}
-			if err := json.Unmarshal(message, &msg); err != nil {
-				logger.ErrorCF("whatsapp", "Failed to unmarshal bridge message", map[string]interface{}{
-					"error": err.Error(),
-				})
-				continue
+			logger.ErrorCF("whatsapp", "Bridge read error, reconnecting", map[string]interface{}{
+				"error":   err.Error(),
+				"pending": c.session.pending(),
+			})
+			c.mu.Lock()
+			dropped := c.conn == conn
+			if dropped {
+				c.conn.Close()
+				c.conn = nil
+				c.connected = false
 			}
-
-			msgType, ok := msg["type"].(string)
-			if !ok {
-				continue
+			c.mu.Unlock()
+			if dropped {
+				c.PublishStatus(bus.ChannelStatus{State: bus.ChannelReconnecting, Error: err.Error()})
 			}
+			continue
+		}
+		c.handleBridgeFrame(data)
+	}
+}
+
+// handleBridgeFrame handles a frame from the bridge: messages, and with
+// protocol v2 acknowledgements, resend requests, and heartbeats.
+func (c *WhatsAppChannel) handleBridgeFrame(data []byte) {
+	var f bridgeFrame
+	if err := json.Unmarshal(data, &f); err != nil {
+		logger.ErrorCF("whatsapp", "Failed to unmarshal bridge message", map[string]interface{}{
+			"error": err.Error(),
+		})
+		return
+	}
+	if !c.session.v2() {
+		if f.Type == "message" || f.Type == "reaction" {
+			c.handleBridgeMessageData(data)
+		}
+		return
+	}
 
-			if msgType == "message" {
-				c.handleBridgeMessage(msg)
+	switch f.Type {
+	case "message", "reaction":
+		next, lost := c.session.receive(f.Seq)
+		if lost > 0 {
+			logger.WarnCF("whatsapp", "Bridge messages missing, asking for them again", map[string]interface{}{
+				"seq":  f.Seq,
+				"lost": lost,
+			})
+			c.writeBridge(bridgeFrame{Type: "resend", Ack: c.session.lastReceived()})
+			return
+		}
+		if next {
+			c.handleBridgeMessageData(data)
+		}
+		// Repeats are acknowledged again, in case the first ack was lost
+		c.writeBridge(bridgeFrame{Type: "ack", Ack: c.session.lastReceived()})
+	case "ack":
+		c.session.ack(f.Ack)
+	case "resend":
+		for _, m := range c.session.after(f.Ack) {
+			if err := c.writeBridge(m); err != nil {
+				break
 			}
 		}
+	case "ping":
+		c.writeBridge(bridgeFrame{Type: "pong"})
+	}
+}
+
+func (c *WhatsAppChannel) handleBridgeMessageData(data []byte) {
+	var msg map[string]interface{}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return
+	}
+	if msg["type"] == "reaction" {
+		c.handleBridgeReaction(msg)
+		return
+	}
+	c.handleBridgeMessage(msg)
+}
+
+// handleBridgeReaction passes on a reaction frame from the bridge:
+// {"type":"reaction","from":…,"chat":…,"message_id":…,"emoji":…}, with
+// no emoji when the reaction was taken back. "from_me" says the message
+// reacted to is the bot's.
+func (c *WhatsAppChannel) handleBridgeReaction(msg map[string]interface{}) {
+	senderID, _ := msg["from"].(string)
+	messageID, _ := msg["message_id"].(string)
+	if senderID == "" || messageID == "" {
+		return
+	}
+	chatID, ok := msg["chat"].(string)
+	if !ok {
+		chatID = senderID
+	}
+	emoji, _ := msg["emoji"].(string)
+	author, _ := msg["author"].(string)
+	on := bus.ReactionOnUser
+	if fromMe, _ := msg["from_me"].(bool); fromMe {
+		on = bus.ReactionOnBot
 	}
+	c.HandleReaction(senderID, chatID, bus.Reaction{
+		MessageID: messageID,
+		Emoji:     emoji,
+		Remove:    emoji == "",
+		Author:    author,
+		On:        on,
+	}, nil)
 }
 
 func (c *WhatsAppChannel) handleBridgeMessage(msg map[string]interface{}) {
@@ -520,26 +1782,235 @@ func (c *WhatsAppChannel) handleBridgeMessage(msg map[string]interface{}) {
 		}
 	}
 
-	metadata := make(map[string]string)
+	metadata := map[string]string{
+		"is_group": strconv.FormatBool(strings.HasSuffix(chatID, "@g.us")),
+	}
 	if messageID, ok := msg["id"].(string); ok {
 		metadata["message_id"] = messageID
 	}
 	if userName, ok := msg["from_name"].(string); ok {
 		metadata["user_name"] = userName
 	}
+	quote := bridgeQuote(msg)
+	if quote != nil {
+		metadata["quoted_message_id"] = quote.MessageID
+		if quote.SenderID != "" {
+			metadata["quoted_sender"] = quote.SenderID
+		}
+		if quote.Content != "" {
+			metadata["quoted_text"] = utils.Truncate(quote.Content, maxQuotedMetadata)
+		}
+	}
 
 	logger.DebugCF("whatsapp", "Bridge message received", map[string]interface{}{
 		"from":    senderID,
 		"content": utils.Truncate(content, 50),
 	})
 
-	c.HandleMessage(senderID, chatID, content, mediaPaths, metadata)
+	c.HandleReply(senderID, chatID, content, mediaPaths, metadata, quote)
+}
+
+// bridgeQuote returns the message a bridge message replies to, or nil. The
+// bridge describes it as {"reply_to":{"id":…,"from":…,"content":…}}.
+func bridgeQuote(msg map[string]interface{}) *bus.Quote {
+	replyTo, ok := msg["reply_to"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	id, _ := replyTo["id"].(string)
+	if id == "" {
+		return nil
+	}
+	from, _ := replyTo["from"].(string)
+	content, _ := replyTo["content"].(string)
+	return &bus.Quote{MessageID: id, SenderID: from, Content: content}
 }
 
 // ===========================================================================
 // Helpers
 // ===========================================================================
 
+// maxQuotables is how many of each chat's latest messages replies can
+// quote in native mode.
+const maxQuotables = 50
+
+// quotable is a received message a reply can quote. WhatsApp needs its
+// sender to find it in a group, and shows its text above the reply.
+type quotable struct {
+	id, sender, text string
+}
+
+// rememberQuotable records a message received in a chat so replies can
+// quote it.
+func (c *WhatsAppChannel) rememberQuotable(chatID string, q quotable) {
+	c.quoteMu.Lock()
+	defer c.quoteMu.Unlock()
+	if c.quotables == nil {
+		c.quotables = make(map[string][]quotable)
+	}
+	msgs := append(c.quotables[chatID], q)
+	if len(msgs) > maxQuotables {
+		msgs = msgs[len(msgs)-maxQuotables:]
+	}
+	c.quotables[chatID] = msgs
+}
+
+// findQuotable returns the message with ID id among the latest received
+// in chat.
+func (c *WhatsAppChannel) findQuotable(chat types.JID, id string) (quotable, bool) {
+	c.quoteMu.Lock()
+	defer c.quoteMu.Unlock()
+	msgs := c.quotables[chat.String()]
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i].id == id {
+			return msgs[i], true
+		}
+	}
+	return quotable{}, false
+}
+
+// replyContext returns the context that makes a message sent to chat quote
+// the message with ID id, or nil when id is "" or the message is unknown.
+// In a direct chat any message not from the bot is from the other party,
+// so there the quote only lacks the text of a message it did not see.
+func (c *WhatsAppChannel) replyContext(chat types.JID, id string) *waE2E.ContextInfo {
+	if id == "" {
+		return nil
+	}
+	q, found := c.findQuotable(chat, id)
+	if !found {
+		if chat.Server == types.GroupServer {
+			logger.DebugCF("whatsapp", "Quoted message not seen, replying without quote",
+				map[string]interface{}{"chat": chat.String(), "message_id": id})
+			return nil
+		}
+		q = quotable{id: id, sender: chat.ToNonAD().String()}
+	}
+
+	info := &waE2E.ContextInfo{StanzaID: strPtr(q.id), Participant: strPtr(q.sender)}
+	if q.text != "" {
+		info.QuotedMessage = &waE2E.Message{Conversation: strPtr(q.text)}
+	}
+	return info
+}
+
+// maxQuotedMetadata caps the quoted text copied into metadata; the quote
+// itself carries all of it.
+const maxQuotedMetadata = 500
+
+// addQuoteMetadata describes the message a reply quotes in metadata:
+// "quoted_message_id", "quoted_sender", "quoted_text", "quoted_media" (the
+// kind of attachment it had: image, video, audio, voice, document, or
+// sticker), and "reply_to_bot" when the bot sent it.
+func (c *WhatsAppChannel) addQuoteMetadata(metadata map[string]string, info *waE2E.ContextInfo) {
+	if info.GetStanzaID() == "" {
+		return
+	}
+	metadata["quoted_message_id"] = info.GetStanzaID()
+	if sender := info.GetParticipant(); sender != "" {
+		metadata["quoted_sender"] = sender
+		if c.quotesSelf(info) {
+			metadata["reply_to_bot"] = "true"
+		}
+	}
+	quoted := info.GetQuotedMessage()
+	if text := whatsappText(quoted); text != "" {
+		metadata["quoted_text"] = utils.Truncate(text, maxQuotedMetadata)
+	}
+	if kind := whatsappMediaKind(quoted); kind != "" {
+		metadata["quoted_media"] = kind
+	}
+}
+
+// whatsappContextInfo returns the context of msg, which says what it
+// replies to, or nil.
+func whatsappContextInfo(msg *waE2E.Message) *waE2E.ContextInfo {
+	switch {
+	case msg.GetExtendedTextMessage() != nil:
+		return msg.GetExtendedTextMessage().GetContextInfo()
+	case msg.GetImageMessage() != nil:
+		return msg.GetImageMessage().GetContextInfo()
+	case msg.GetVideoMessage() != nil:
+		return msg.GetVideoMessage().GetContextInfo()
+	case msg.GetDocumentMessage() != nil:
+		return msg.GetDocumentMessage().GetContextInfo()
+	case msg.GetAudioMessage() != nil:
+		return msg.GetAudioMessage().GetContextInfo()
+	case msg.GetStickerMessage() != nil:
+		return msg.GetStickerMessage().GetContextInfo()
+	}
+	return nil
+}
+
+// setWhatsAppContextInfo sets the context of msg, which says what it
+// replies to, on whichever kind of message it is.
+func setWhatsAppContextInfo(msg *waE2E.Message, info *waE2E.ContextInfo) {
+	switch {
+	case msg.GetExtendedTextMessage() != nil:
+		msg.ExtendedTextMessage.ContextInfo = info
+	case msg.GetImageMessage() != nil:
+		msg.ImageMessage.ContextInfo = info
+	case msg.GetVideoMessage() != nil:
+		msg.VideoMessage.ContextInfo = info
+	case msg.GetDocumentMessage() != nil:
+		msg.DocumentMessage.ContextInfo = info
+	case msg.GetAudioMessage() != nil:
+		msg.AudioMessage.ContextInfo = info
+	case msg.GetStickerMessage() != nil:
+		msg.StickerMessage.ContextInfo = info
+	}
+}
+
+// whatsappMediaKind names the kind of attachment msg has, or "".
+func whatsappMediaKind(msg *waE2E.Message) string {
+	switch {
+	case msg.GetImageMessage() != nil:
+		return "image"
+	case msg.GetVideoMessage() != nil:
+		return "video"
+	case msg.GetAudioMessage().GetPTT():
+		return "voice"
+	case msg.GetAudioMessage() != nil:
+		return "audio"
+	case msg.GetDocumentMessage() != nil:
+		return "document"
+	case msg.GetStickerMessage() != nil:
+		return "sticker"
+	}
+	return ""
+}
+
+// whatsappQuote returns the message msg replies to, or nil. The reply
+// carries a copy of the quoted message.
+func whatsappQuote(msg *waE2E.Message) *bus.Quote {
+	info := whatsappContextInfo(msg)
+	if info.GetStanzaID() == "" {
+		return nil
+	}
+
+	return &bus.Quote{
+		MessageID: info.GetStanzaID(),
+		SenderID:  info.GetParticipant(),
+		Content:   whatsappText(info.GetQuotedMessage()),
+	}
+}
+
+// whatsappText returns the text of msg, or the caption of its media.
+func whatsappText(msg *waE2E.Message) string {
+	for _, text := range []string{
+		msg.GetConversation(),
+		msg.GetExtendedTextMessage().GetText(),
+		msg.GetImageMessage().GetCaption(),
+		msg.GetVideoMessage().GetCaption(),
+		msg.GetDocumentMessage().GetCaption(),
+	} {
+		if text != "" {
+			return text
+		}
+	}
+	return ""
+}
+
 func appendWhatsAppContent(content, suffix string) string {
 	if content == "" {
 		return suffix
@@ -550,17 +2021,3 @@ func appendWhatsAppContent(content, suffix string) string {
 func strPtr(s string) *string {
 	return &s
 }
-
-func expandHomePath(path string) string {
-	if path == "" {
-		return path
-	}
-	if path[0] == '~' {
-		home, _ := os.UserHomeDir()
-		if len(path) > 1 && path[1] == '/' {
-			return home + path[1:]
-		}
-		return home
-	}
-	return path
-}
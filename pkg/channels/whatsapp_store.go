@@ -0,0 +1,121 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package channels
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// legacyTempStore is the session file used when store_path was empty,
+// before sessions were kept per account.
+const legacyTempStore = "picoclaw_whatsapp.db"
+
+// legacyDefaultStore is the session file used when store_path was not
+// set, before sessions were kept per account. The gateway moves it to the
+// default account by itself.
+const legacyDefaultStore = "~/.picoclaw/whatsapp.db"
+
+// sqliteSidecars are the files SQLite keeps next to a database.
+var sqliteSidecars = []string{"-wal", "-shm", "-journal"}
+
+// LegacyWhatsAppStores returns the session files from before sessions
+// were kept per account that still exist: a store_path naming a file, the
+// old default, and the temp directory default.
+func LegacyWhatsAppStores(cfg config.WhatsAppConfig) []string {
+	candidates := []string{
+		config.ExpandPath(legacyDefaultStore),
+		filepath.Join(os.TempDir(), legacyTempStore),
+		// Where the temp directory is when the system one is not writable
+		filepath.Join(config.HomeDir(), "tmp", legacyTempStore),
+	}
+	if cfg.LegacyStore() {
+		candidates = append([]string{cfg.SessionPath()}, candidates...)
+	}
+	var found []string
+	seen := make(map[string]bool)
+	for _, path := range candidates {
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			found = append(found, path)
+		}
+	}
+	return found
+}
+
+// MigrateWhatsAppStore moves the session database at from, with SQLite's
+// files next to it, to cfg's account directory and returns the new path.
+// The paired session carries over, so no new QR scan is needed. The
+// gateway must not be running, and the account must not have a session
+// already.
+func MigrateWhatsAppStore(from string, cfg config.WhatsAppConfig) (string, error) {
+	if cfg.LegacyStore() {
+		return "", fmt.Errorf("store_path %s names a file, not a directory", cfg.StorePath)
+	}
+	to := cfg.SessionPath()
+	if _, err := os.Stat(from); err != nil {
+		return "", fmt.Errorf("no session at %s: %w", from, err)
+	}
+	if _, err := os.Stat(to); err == nil {
+		return "", fmt.Errorf("account already has a session at %s", to)
+	}
+	if err := os.MkdirAll(filepath.Dir(to), 0700); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", filepath.Dir(to), err)
+	}
+
+	// The sidecars go first, so the database never sits at the new path
+	// without its write-ahead log
+	for _, suffix := range sqliteSidecars {
+		err := moveFile(from+suffix, to+suffix)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+	}
+	if err := moveFile(from, to); err != nil {
+		return "", err
+	}
+	return to, nil
+}
+
+// moveFile renames src to dst, copying it across filesystems, such as out
+// of a tmpfs temp directory.
+func moveFile(src, dst string) error {
+	if _, err := os.Stat(src); err != nil {
+		return err
+	}
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return fmt.Errorf("failed to copy %s: %w", src, err)
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return os.Remove(src)
+}
@@ -0,0 +1,86 @@
+package channels
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestMigrateWhatsAppStore(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TMPDIR", filepath.Join(dir, "tmp"))
+	t.Setenv("PICOCLAW_HOME", filepath.Join(dir, "home"))
+	old := filepath.Join(dir, "home", "whatsapp.db")
+	os.MkdirAll(filepath.Dir(old), 0700)
+	os.MkdirAll(filepath.Join(dir, "tmp"), 0700)
+	for _, name := range []string{old, old + "-wal", filepath.Join(dir, "tmp", legacyTempStore)} {
+		if err := os.WriteFile(name, []byte(filepath.Base(name)), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	legacy := config.WhatsAppConfig{StorePath: "~/.picoclaw/whatsapp.db"}
+	found := LegacyWhatsAppStores(legacy)
+	if len(found) != 2 || found[0] != old {
+		t.Fatalf("LegacyWhatsAppStores() = %q, want the store_path file first", found)
+	}
+	if _, err := MigrateWhatsAppStore(old, legacy); err == nil {
+		t.Error("migrated into a store_path that names a file")
+	}
+
+	layout := config.WhatsAppConfig{StorePath: "~/.picoclaw/whatsapp", Account: "default"}
+	to, err := MigrateWhatsAppStore(old, layout)
+	if err != nil {
+		t.Fatalf("MigrateWhatsAppStore() error = %v", err)
+	}
+	if want := filepath.Join(dir, "home", "whatsapp", "default", "session.db"); to != want {
+		t.Errorf("moved to %s, want %s", to, want)
+	}
+	for path, want := range map[string]string{to: "whatsapp.db", to + "-wal": "whatsapp.db-wal"} {
+		if data, err := os.ReadFile(path); err != nil || string(data) != want {
+			t.Errorf("%s = %q, %v", path, data, err)
+		}
+	}
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Error("the old session file is still there")
+	}
+
+	// The temp directory session cannot replace the one just moved
+	tmp := filepath.Join(dir, "tmp", legacyTempStore)
+	if _, err := MigrateWhatsAppStore(tmp, layout); err == nil {
+		t.Error("overwrote the account's session")
+	}
+	layout.Account = "second"
+	if _, err := MigrateWhatsAppStore(tmp, layout); err != nil {
+		t.Errorf("MigrateWhatsAppStore() to a second account error = %v", err)
+	}
+	if found := LegacyWhatsAppStores(layout); len(found) != 0 {
+		t.Errorf("LegacyWhatsAppStores() after migrating = %q", found)
+	}
+}
+
+func TestLegacyWhatsAppStoresFindsOldDefault(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TMPDIR", filepath.Join(dir, "tmp"))
+	t.Setenv("PICOCLAW_HOME", filepath.Join(dir, "home"))
+	old := filepath.Join(dir, "home", "whatsapp.db")
+	os.MkdirAll(filepath.Dir(old), 0700)
+	if err := os.WriteFile(old, []byte("session"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// A config that never set store_path
+	var cfg config.WhatsAppConfig
+	if found := LegacyWhatsAppStores(cfg); len(found) != 1 || found[0] != old {
+		t.Fatalf("LegacyWhatsAppStores() = %q, want %s", found, old)
+	}
+	to, err := MigrateWhatsAppStore(old, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "home", "whatsapp", "default", "session.db"); to != want {
+		t.Errorf("moved to %s, want %s", to, want)
+	}
+}
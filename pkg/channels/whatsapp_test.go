@@ -0,0 +1,348 @@
+package channels
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waCommon"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/store"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestChatJID(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"4915112345678@s.whatsapp.net", "4915112345678@s.whatsapp.net", false},
+		{"+49 151 12345678", "4915112345678@s.whatsapp.net", false},
+		{"120363025246125486@g.us", "120363025246125486@g.us", false},
+		{"nobody", "", true},
+	}
+	for _, tt := range tests {
+		jid, err := chatJID(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("chatJID(%q) error = %v", tt.in, err)
+			continue
+		}
+		if err == nil && jid.String() != tt.want {
+			t.Errorf("chatJID(%q) = %s, want %s", tt.in, jid, tt.want)
+		}
+	}
+}
+
+func TestWhatsAppMessageChanges(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	c, err := NewWhatsAppChannel(config.WhatsAppConfig{}, msgBus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := types.NewJID("4915112345678", types.DefaultUserServer)
+	event := func(msg *waE2E.Message) *events.Message {
+		return &events.Message{
+			Info:    types.MessageInfo{MessageSource: types.MessageSource{Chat: alice, Sender: alice}, ID: "EDIT1"},
+			Message: msg,
+		}
+	}
+
+	tests := []struct {
+		name    string
+		msg     *waE2E.Message
+		content string
+		change  bus.Change
+	}{
+		{"edit", &waE2E.Message{ProtocolMessage: &waE2E.ProtocolMessage{
+			Type:          waE2E.ProtocolMessage_MESSAGE_EDIT.Enum(),
+			Key:           &waCommon.MessageKey{ID: proto.String("ORIG1")},
+			EditedMessage: &waE2E.Message{Conversation: proto.String("meet at 6")},
+		}}, "meet at 6", bus.Change{MessageID: "ORIG1"}},
+		{"revoke", &waE2E.Message{ProtocolMessage: &waE2E.ProtocolMessage{
+			Type: waE2E.ProtocolMessage_REVOKE.Enum(),
+			Key:  &waCommon.MessageKey{ID: proto.String("ORIG2")},
+		}}, "", bus.Change{MessageID: "ORIG2", Deleted: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c.handleMessageEvent(event(tt.msg))
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			msg, ok := msgBus.ConsumeInbound(ctx)
+			if !ok {
+				t.Fatal("nothing published")
+			}
+			if msg.Change == nil || *msg.Change != tt.change || msg.Content != tt.content {
+				t.Errorf("published change %+v with %q, want %+v with %q", msg.Change, msg.Content, tt.change, tt.content)
+			}
+			if msg.Metadata["message_id"] != tt.change.MessageID {
+				t.Errorf("message_id = %q", msg.Metadata["message_id"])
+			}
+		})
+	}
+}
+
+func TestWhatsAppCallOffer(t *testing.T) {
+	alice := types.NewJID("4915112345678", types.DefaultUserServer)
+	bob := types.NewJID("4915187654321", types.DefaultUserServer)
+	offer := func(caller types.JID) *events.CallOffer {
+		return &events.CallOffer{BasicCallMeta: types.BasicCallMeta{From: caller, CallCreator: caller, CallID: "CALL1"}}
+	}
+
+	tests := []struct {
+		name   string
+		config config.WhatsAppConfig
+		caller types.JID
+		reply  string
+	}{
+		{"built-in reply", config.WhatsAppConfig{RejectCalls: true, AllowFrom: []string{alice.String()}}, alice, "Sorry, I can't take calls."},
+		{"configured reply", config.WhatsAppConfig{RejectCalls: true, CallReply: "Text me."}, alice, "Text me."},
+		{"caller not allowed", config.WhatsAppConfig{RejectCalls: true, AllowFrom: []string{alice.String()}}, bob, ""},
+		{"calls not rejected", config.WhatsAppConfig{}, alice, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msgBus := bus.NewMessageBus()
+			var calls []bus.ChatEvent
+			msgBus.OnChatEvent(func(e bus.ChatEvent) { calls = append(calls, e) })
+			c, err := NewWhatsAppChannel(tt.config, msgBus)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c.handleCallOffer(offer(tt.caller))
+
+			if len(calls) != 1 || calls[0].Type != bus.ChatCall || calls[0].ActorID != tt.caller.String() {
+				t.Errorf("chat events = %+v, want the call", calls)
+			}
+			msg, ok := msgBus.TryConsumeOutbound()
+			if tt.reply == "" {
+				if ok {
+					t.Errorf("replied %q", msg.Content)
+				}
+				return
+			}
+			if !ok || msg.ChatID != tt.caller.String() || !strings.HasPrefix(msg.Content, tt.reply) {
+				t.Errorf("reply = %+v, want %q", msg, tt.reply)
+			}
+		})
+	}
+}
+
+func TestWhatsAppQuoteMetadata(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	c, err := NewWhatsAppChannel(config.WhatsAppConfig{}, msgBus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := types.NewJID("4915112345678", types.DefaultUserServer)
+	reply := func(quoted *waE2E.Message) *events.Message {
+		return &events.Message{
+			Info: types.MessageInfo{MessageSource: types.MessageSource{Chat: alice, Sender: alice}, ID: "R1"},
+			Message: &waE2E.Message{ExtendedTextMessage: &waE2E.ExtendedTextMessage{
+				Text: proto.String("what is this?"),
+				ContextInfo: &waE2E.ContextInfo{
+					StanzaID:      proto.String("Q1"),
+					Participant:   proto.String("4915187654321@s.whatsapp.net"),
+					QuotedMessage: quoted,
+				},
+			}},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		quoted *waE2E.Message
+		want   map[string]string
+	}{
+		{"text", &waE2E.Message{Conversation: proto.String("dinner at 8")},
+			map[string]string{"quoted_text": "dinner at 8", "quoted_media": ""}},
+		{"photo with caption", &waE2E.Message{ImageMessage: &waE2E.ImageMessage{Caption: proto.String("the menu")}},
+			map[string]string{"quoted_text": "the menu", "quoted_media": "image"}},
+		{"voice note", &waE2E.Message{AudioMessage: &waE2E.AudioMessage{PTT: proto.Bool(true)}},
+			map[string]string{"quoted_text": "", "quoted_media": "voice"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c.handleMessageEvent(reply(tt.quoted))
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			msg, ok := msgBus.ConsumeInbound(ctx)
+			if !ok {
+				t.Fatal("nothing published")
+			}
+			if msg.Metadata["quoted_message_id"] != "Q1" || msg.Metadata["quoted_sender"] != "4915187654321@s.whatsapp.net" {
+				t.Errorf("metadata = %v", msg.Metadata)
+			}
+			for key, want := range tt.want {
+				if got := msg.Metadata[key]; got != want {
+					t.Errorf("%s = %q, want %q", key, got, want)
+				}
+			}
+			if msg.Metadata["reply_to_bot"] != "" {
+				t.Errorf("reply_to_bot = %q for someone else's message", msg.Metadata["reply_to_bot"])
+			}
+		})
+	}
+}
+
+func TestWhatsAppMediaMessage(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"photo.bin":  []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"),
+		"clip.mp4":   []byte("\x00\x00\x00\x18ftypmp42\x00\x00\x00\x00mp42isom"),
+		"voice.ogg":  []byte("OggS\x00\x02\x00\x00\x00\x00\x00\x00\x00\x00"),
+		"report.png": []byte("%PDF-1.7\n"),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	up := whatsmeow.UploadResponse{URL: "https://mmg.whatsapp.net/x", DirectPath: "/x", FileLength: 42}
+
+	tests := []struct {
+		file, kind string
+		check      func(m *waE2E.Message) bool
+	}{
+		{"photo.bin", "image", func(m *waE2E.Message) bool {
+			return m.GetImageMessage().GetCaption() == "look" && m.GetImageMessage().GetMimetype() == "image/png"
+		}},
+		{"clip.mp4", "video", func(m *waE2E.Message) bool {
+			return m.GetVideoMessage().GetCaption() == "look" && m.GetVideoMessage().GetFileLength() == 42
+		}},
+		{"voice.ogg", "audio", func(m *waE2E.Message) bool {
+			return m.GetAudioMessage().GetPTT() && m.GetAudioMessage().GetURL() == up.URL
+		}},
+		// Named as an image, but sent as what its content is
+		{"report.png", "", func(m *waE2E.Message) bool {
+			d := m.GetDocumentMessage()
+			return d.GetFileName() == "report.png" && d.GetMimetype() == "application/pdf" && d.GetCaption() == "look"
+		}},
+	}
+	for _, tt := range tests {
+		kind, mimeType, err := sniffAttachment(filepath.Join(dir, tt.file))
+		if err != nil || kind != tt.kind {
+			t.Errorf("sniffAttachment(%s) = %q, %q, %v, want kind %q", tt.file, kind, mimeType, err, tt.kind)
+			continue
+		}
+		if m := whatsappMediaMessage(kind, mimeType, tt.file, "look", up); !tt.check(m) {
+			t.Errorf("message for %s = %v", tt.file, m)
+		}
+	}
+	if m := whatsappMediaMessage("image", "image/png", "a.png", "", up); m.GetImageMessage().Caption != nil {
+		t.Error("empty caption set")
+	}
+
+	native := &WhatsAppChannel{config: config.WhatsAppConfig{}}
+	bridge := &WhatsAppChannel{config: config.WhatsAppConfig{BridgeURL: "ws://localhost:3001"}}
+	if !native.Capabilities().Media || bridge.Capabilities().Media {
+		t.Error("attachments should be native in native mode only")
+	}
+}
+
+func TestWhatsAppReplyContext(t *testing.T) {
+	c := &WhatsAppChannel{}
+	group := types.NewJID("120363000000000001", types.GroupServer)
+	direct := types.NewJID("4915112345678", types.DefaultUserServer)
+	c.rememberQuotable(group.String(), quotable{id: "G1", sender: "111@s.whatsapp.net", text: "what's the wifi password?"})
+	for i := 0; i < maxQuotables; i++ {
+		c.rememberQuotable(direct.String(), quotable{id: "D" + strconv.Itoa(i), sender: direct.String()})
+	}
+
+	info := c.replyContext(group, "G1")
+	if info.GetStanzaID() != "G1" || info.GetParticipant() != "111@s.whatsapp.net" ||
+		info.GetQuotedMessage().GetConversation() != "what's the wifi password?" {
+		t.Errorf("replyContext(group, G1) = %v", info)
+	}
+	if info := c.replyContext(group, "G2"); info != nil {
+		t.Errorf("replyContext() for an unseen group message = %v, want nil", info)
+	}
+	// A direct chat's messages are all from the other party
+	c.rememberQuotable(direct.String(), quotable{id: "D-last", sender: direct.String()})
+	if info := c.replyContext(direct, "D0"); info.GetStanzaID() != "D0" || info.GetParticipant() != direct.String() {
+		t.Errorf("replyContext(direct, D0) = %v", info)
+	}
+	if len(c.quotables[direct.String()]) != maxQuotables {
+		t.Errorf("%d messages remembered, want %d", len(c.quotables[direct.String()]), maxQuotables)
+	}
+	if info := c.replyContext(direct, ""); info != nil {
+		t.Errorf("replyContext() without an ID = %v", info)
+	}
+
+	msg := whatsappMediaMessage("document", "application/pdf", "a.pdf", "", whatsmeow.UploadResponse{})
+	setWhatsAppContextInfo(msg, info)
+	if whatsappContextInfo(msg) != info {
+		t.Error("context not set on a document")
+	}
+}
+
+func TestWhatsAppMentionGate(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	c, err := NewWhatsAppChannel(config.WhatsAppConfig{RespondOnlyWhenMentioned: true}, msgBus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	self := types.NewJID("4915100000000", types.DefaultUserServer)
+	c.client = &whatsmeow.Client{Store: &store.Device{ID: &self, LID: types.NewJID("98765", types.HiddenUserServer)}}
+	group := types.NewJID("120363000000000001", types.GroupServer)
+	alice := types.NewJID("4915112345678", types.DefaultUserServer)
+	message := func(chat types.JID, text string, info *waE2E.ContextInfo) *events.Message {
+		return &events.Message{
+			Info: types.MessageInfo{
+				MessageSource: types.MessageSource{Chat: chat, Sender: alice, IsGroup: chat.Server == types.GroupServer},
+				ID:            "M1",
+			},
+			Message: &waE2E.Message{ExtendedTextMessage: &waE2E.ExtendedTextMessage{Text: proto.String(text), ContextInfo: info}},
+		}
+	}
+
+	tests := []struct {
+		name          string
+		msg           *events.Message
+		wantText      string
+		wantMentioned string
+	}{
+		{"not mentioned", message(group, "lunch?", nil), "", ""},
+		{"someone else mentioned", message(group, "@4915187654321 lunch?",
+			&waE2E.ContextInfo{MentionedJID: []string{"4915187654321@s.whatsapp.net"}}), "", ""},
+		{"mentioned by number", message(group, "@4915100000000 what's the weather?",
+			&waE2E.ContextInfo{MentionedJID: []string{self.String()}}), "what's the weather?", "true"},
+		{"mentioned by LID", message(group, "hey @98765 what's the weather?",
+			&waE2E.ContextInfo{MentionedJID: []string{"98765@lid"}}), "hey what's the weather?", "true"},
+		{"reply to the bot", message(group, "and tomorrow?",
+			&waE2E.ContextInfo{StanzaID: proto.String("B1"), Participant: proto.String(self.String())}), "and tomorrow?", "false"},
+		{"direct chat", message(alice, "lunch?", nil), "lunch?", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c.handleMessageEvent(tt.msg)
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			msg, ok := msgBus.ConsumeInbound(ctx)
+			if tt.wantText == "" {
+				if ok {
+					t.Errorf("published %q, want it ignored", msg.Content)
+				}
+				return
+			}
+			if !ok {
+				t.Fatal("nothing published")
+			}
+			if msg.Content != tt.wantText || msg.Metadata["mentioned"] != tt.wantMentioned {
+				t.Errorf("published %q with mentioned = %q, want %q and %q",
+					msg.Content, msg.Metadata["mentioned"], tt.wantText, tt.wantMentioned)
+			}
+		})
+	}
+}
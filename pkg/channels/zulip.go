@@ -0,0 +1,775 @@
+package channels
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/contacts"
+	"github.com/sipeed/picoclaw/pkg/i18n"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/render"
+	"github.com/sipeed/picoclaw/pkg/utils"
+	"github.com/sipeed/picoclaw/pkg/voice"
+)
+
+// Zulip chats are streams and direct messages. A stream message's chat ID
+// is "<stream ID>/<topic>", so each topic is a thread of the stream; a
+// direct message's is "dm:" followed by the other participants' user IDs,
+// comma-separated.
+const zulipDMPrefix = "dm:"
+
+// zulipMessageLimit is the most characters Zulip keeps in one message, and
+// zulipUploadLimit its default largest upload.
+const (
+	zulipMessageLimit = 10000
+	zulipUploadLimit  = 25 << 20
+)
+
+// errZulipQueue is returned when the server has dropped the event queue,
+// which it does after about ten minutes without a poll.
+var errZulipQueue = errors.New("zulip event queue expired")
+
+type ZulipChannel struct {
+	*BaseChannel
+	config      config.ZulipConfig
+	site        string
+	auth        string
+	client      *http.Client
+	botUserID   int
+	botName     string
+	transcriber *voice.GroqTranscriber
+	ctx         context.Context
+	cancel      context.CancelFunc
+	connected   atomic.Bool
+}
+
+// zulipMessage is a message as the events and messages APIs return it.
+type zulipMessage struct {
+	ID          int             `json:"id"`
+	SenderID    int             `json:"sender_id"`
+	SenderEmail string          `json:"sender_email"`
+	SenderName  string          `json:"sender_full_name"`
+	Type        string          `json:"type"` // "stream" or "private"
+	StreamID    int             `json:"stream_id"`
+	Topic       string          `json:"subject"`
+	Recipient   json.RawMessage `json:"display_recipient"`
+	Content     string          `json:"content"`
+}
+
+type zulipEvent struct {
+	ID           int           `json:"id"`
+	Type         string        `json:"type"`
+	Message      *zulipMessage `json:"message"`
+	Flags        []string      `json:"flags"`
+	Op           string        `json:"op"`
+	UserID       int           `json:"user_id"`
+	MessageID    int           `json:"message_id"`
+	EmojiName    string        `json:"emoji_name"`
+	EmojiCode    string        `json:"emoji_code"`
+	ReactionType string        `json:"reaction_type"`
+}
+
+// zulipResponse holds the fields common to every API response.
+type zulipResponse struct {
+	Result string `json:"result"`
+	Msg    string `json:"msg"`
+	Code   string `json:"code"`
+}
+
+func NewZulipChannel(cfg config.ZulipConfig, messageBus *bus.MessageBus) (*ZulipChannel, error) {
+	if cfg.Site == "" || cfg.Email == "" || cfg.APIKey == "" {
+		return nil, fmt.Errorf("zulip site, email and api_key are required")
+	}
+
+	base := NewBaseChannel("zulip", cfg, messageBus, cfg.AllowFrom)
+
+	return &ZulipChannel{
+		BaseChannel: base,
+		config:      cfg,
+		site:        strings.TrimRight(cfg.Site, "/"),
+		auth:        "Basic " + base64.StdEncoding.EncodeToString([]byte(cfg.Email+":"+cfg.APIKey)),
+		client:      &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+func (c *ZulipChannel) SetTranscriber(transcriber *voice.GroqTranscriber) {
+	c.transcriber = transcriber
+}
+
+func (c *ZulipChannel) Start(ctx context.Context) error {
+	logger.InfoC("zulip", "Starting Zulip channel")
+
+	c.ctx, c.cancel = context.WithCancel(ctx)
+
+	var me struct {
+		UserID   int    `json:"user_id"`
+		FullName string `json:"full_name"`
+	}
+	if err := c.call(c.ctx, http.MethodGet, "users/me", nil, &me); err != nil {
+		return fmt.Errorf("zulip auth check failed: %w", err)
+	}
+	c.botUserID = me.UserID
+	c.botName = me.FullName
+
+	logger.InfoCF("zulip", "Zulip bot connected", map[string]interface{}{
+		"bot_user_id": c.botUserID,
+		"site":        c.site,
+	})
+
+	c.Go(c.ctx, c.eventLoop)
+
+	c.setRunning(true)
+	logger.InfoC("zulip", "Zulip channel started")
+	return nil
+}
+
+func (c *ZulipChannel) Stop(ctx context.Context) error {
+	logger.InfoC("zulip", "Stopping Zulip channel")
+
+	if c.cancel != nil {
+		c.cancel()
+	}
+
+	c.setRunning(false)
+	c.connected.Store(false)
+	logger.InfoC("zulip", "Zulip channel stopped")
+	return nil
+}
+
+// Connected reports whether the last poll of the event queue succeeded.
+func (c *ZulipChannel) Connected() bool {
+	return c.connected.Load()
+}
+
+// eventLoop long-polls the event queue, registering a new one when the
+// server has dropped it, and backing off while the server is unreachable.
+func (c *ZulipChannel) eventLoop() {
+	queueID, lastEventID := "", -1
+	backoff := 2 * time.Second
+	for c.ctx.Err() == nil {
+		var err error
+		if queueID == "" {
+			queueID, lastEventID, err = c.register(c.ctx)
+		}
+		var events []zulipEvent
+		if err == nil {
+			events, err = c.events(c.ctx, queueID, lastEventID)
+		}
+		if errors.Is(err, errZulipQueue) {
+			queueID = ""
+			continue
+		}
+		if err != nil {
+			if c.ctx.Err() != nil {
+				return
+			}
+			c.connected.Store(false)
+			logger.WarnCF("zulip", "Zulip event poll failed", map[string]interface{}{
+				"error":   err.Error(),
+				"backoff": backoff.String(),
+			})
+			select {
+			case <-c.ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, time.Minute)
+			continue
+		}
+		c.connected.Store(true)
+		backoff = 2 * time.Second
+		for _, ev := range events {
+			lastEventID = max(lastEventID, ev.ID)
+			c.handleEvent(ev)
+		}
+	}
+}
+
+// register creates an event queue for messages and reactions, with
+// message content as the sender wrote it.
+func (c *ZulipChannel) register(ctx context.Context) (string, int, error) {
+	form := url.Values{
+		"event_types":    {`["message","reaction"]`},
+		"apply_markdown": {"false"},
+	}
+	var resp struct {
+		QueueID     string `json:"queue_id"`
+		LastEventID int    `json:"last_event_id"`
+	}
+	if err := c.call(ctx, http.MethodPost, "register", form, &resp); err != nil {
+		return "", 0, fmt.Errorf("failed to register zulip event queue: %w", err)
+	}
+	return resp.QueueID, resp.LastEventID, nil
+}
+
+// events waits for the events after lastEventID. The server answers with
+// a heartbeat when nothing happens for a while, so no timeout applies.
+func (c *ZulipChannel) events(ctx context.Context, queueID string, lastEventID int) ([]zulipEvent, error) {
+	query := url.Values{
+		"queue_id":      {queueID},
+		"last_event_id": {strconv.Itoa(lastEventID)},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.site+"/api/v1/events?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", c.auth)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var body struct {
+		zulipResponse
+		Events []zulipEvent `json:"events"`
+	}
+	if err := decodeZulip(resp, &body); err != nil {
+		return nil, err
+	}
+	return body.Events, nil
+}
+
+func (c *ZulipChannel) handleEvent(ev zulipEvent) {
+	defer c.Recover()
+
+	switch ev.Type {
+	case "message":
+		if ev.Message != nil {
+			c.handleMessage(ev.Message, ev.Flags)
+		}
+	case "reaction":
+		c.handleReaction(ev)
+	}
+}
+
+func (c *ZulipChannel) handleMessage(m *zulipMessage, flags []string) {
+	if m.SenderID == c.botUserID {
+		return
+	}
+	chatID := c.zulipChatID(m)
+	isDM := m.Type != "stream"
+	mentioned := slices.Contains(flags, "mentioned") || slices.Contains(flags, "wildcard_mentioned")
+	// In streams the bot answers only when mentioned, as Zulip bots do
+	if !isDM && !mentioned {
+		return
+	}
+
+	senderID := fmt.Sprintf("%d|%s", m.SenderID, m.SenderEmail)
+	// Check allowlist before downloading attachments for rejected users
+	if !c.Admits(senderID, chatID) {
+		return
+	}
+
+	content, mediaPaths, audioSeconds := c.fetchUploads(senderID, chatID, stripZulipMention(m.Content, c.botName))
+	// Images are handed to the agent (for vision), which removes them
+	defer func() {
+		for _, path := range mediaPaths {
+			if !utils.IsImageFile(path, "") {
+				os.Remove(path)
+			}
+		}
+	}()
+	if strings.TrimSpace(content) == "" {
+		return
+	}
+
+	metadata := map[string]string{
+		"message_id": strconv.Itoa(m.ID),
+		"sender":     m.SenderName,
+		"platform":   "zulip",
+		"is_dm":      fmt.Sprintf("%t", isDM),
+		"is_mention": fmt.Sprintf("%t", mentioned),
+	}
+	if !isDM {
+		metadata["stream_id"] = strconv.Itoa(m.StreamID)
+		metadata["stream"] = zulipStreamName(m.Recipient)
+		metadata["topic"] = m.Topic
+	}
+	if audioSeconds > 0 {
+		metadata["transcription_seconds"] = strconv.FormatFloat(audioSeconds, 'f', 1, 64)
+	}
+
+	logger.DebugCF("zulip", "Received message", map[string]interface{}{
+		"sender_id": m.SenderID,
+		"chat_id":   chatID,
+		"preview":   utils.Truncate(content, 50),
+	})
+
+	c.HandleMessage(senderID, chatID, content, mediaPaths, metadata)
+}
+
+// zulipUploadLink matches Markdown links to files uploaded to the server.
+var zulipUploadLink = regexp.MustCompile(`\[([^\]]*)\]\((/user_uploads/[^)\s]+)\)`)
+
+// fetchUploads downloads the files content links to, replacing each link
+// with a note naming the file or with the transcription of a voice
+// recording.
+func (c *ZulipChannel) fetchUploads(senderID, chatID, content string) (string, []string, float64) {
+	links := zulipUploadLink.FindAllStringSubmatch(content, -1)
+	if len(links) == 0 {
+		return content, nil, 0
+	}
+
+	// Fetched together; each file is left out if it fails
+	var dl downloads
+	paths := make([]string, len(links))
+	for i, link := range links {
+		name, path := link[1], link[2]
+		dl.add(&paths[i], func(ctx context.Context) string {
+			return utils.DownloadFileContext(ctx, c.site+path, filepath.Base(path), utils.DownloadOptions{
+				LoggerPrefix: "zulip",
+				Kind:         utils.MediaKind(name, ""),
+				ExtraHeaders: map[string]string{"Authorization": c.auth},
+			})
+		})
+	}
+	dl.run(c.ctx, "zulip")
+
+	var mediaPaths []string
+	var audioSeconds float64
+	for i, link := range links {
+		name, localPath := link[1], paths[i]
+		note := fmt.Sprintf("[file: %s]", name)
+		if localPath != "" && utils.IsAudioFile(localPath, "") && c.transcriber != nil && c.transcriber.IsAvailable() {
+			if !c.mayTranscribe(senderID, chatID) {
+				note = i18n.T(c.Name(), chatID, "voice.private")
+			} else if text, seconds, err := c.transcribe(localPath); err != nil {
+				logger.ErrorCF("zulip", "Voice transcription failed", map[string]interface{}{"error": err.Error()})
+				note = i18n.T(c.Name(), chatID, "audio.transcription_failed", name)
+			} else {
+				note = fmt.Sprintf("[voice transcription: %s]", text)
+				audioSeconds += seconds
+			}
+		}
+		content = strings.Replace(content, link[0], note, 1)
+		if localPath != "" {
+			mediaPaths = append(mediaPaths, localPath)
+		}
+	}
+	return content, mediaPaths, audioSeconds
+}
+
+func (c *ZulipChannel) transcribe(path string) (string, float64, error) {
+	ctx, cancel := context.WithTimeout(c.ctx, 30*time.Second)
+	defer cancel()
+	result, err := c.transcriber.Transcribe(ctx, path)
+	if err != nil {
+		return "", 0, err
+	}
+	return result.Text, result.Duration, nil
+}
+
+// handleReaction passes reactions added to or removed from messages on to
+// the agent. The event does not say where the message is, so it is looked
+// up, which also gives its author and text.
+func (c *ZulipChannel) handleReaction(ev zulipEvent) {
+	if ev.UserID == c.botUserID {
+		return
+	}
+	var resp struct {
+		Message zulipMessage `json:"message"`
+	}
+	form := url.Values{"apply_markdown": {"false"}}
+	if err := c.call(c.ctx, http.MethodGet, fmt.Sprintf("messages/%d", ev.MessageID), form, &resp); err != nil {
+		logger.DebugCF("zulip", "Failed to look up reacted message", map[string]interface{}{
+			"message_id": ev.MessageID,
+			"error":      err.Error(),
+		})
+		return
+	}
+	on := bus.ReactionOnUser
+	if resp.Message.SenderID == c.botUserID {
+		on = bus.ReactionOnBot
+	}
+	c.HandleReaction(strconv.Itoa(ev.UserID), c.zulipChatID(&resp.Message), bus.Reaction{
+		MessageID: strconv.Itoa(ev.MessageID),
+		Emoji:     zulipEmoji(ev.EmojiName, ev.EmojiCode, ev.ReactionType),
+		Remove:    ev.Op == "remove",
+		On:        on,
+		Text:      resp.Message.Content,
+	}, nil)
+}
+
+func (c *ZulipChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	if !c.IsRunning() {
+		return fmt.Errorf("zulip channel not running")
+	}
+
+	msg.ChatID = threadedChatID(msg)
+	form, err := zulipDestination(msg.ChatID)
+	if err != nil {
+		return err
+	}
+
+	content := msg.Content
+	for _, path := range msg.Media {
+		link, err := c.upload(ctx, path)
+		if err != nil {
+			return err
+		}
+		content = strings.TrimSpace(content + "\n" + link)
+	}
+	if content == "" {
+		return nil
+	}
+	form.Set("content", content)
+
+	var resp struct {
+		ID int `json:"id"`
+	}
+	if err := c.call(ctx, http.MethodPost, "messages", form, &resp); err != nil {
+		return fmt.Errorf("failed to send zulip message: %w", err)
+	}
+	reportSent(ctx, strconv.Itoa(resp.ID))
+
+	logger.DebugCF("zulip", "Message sent", map[string]interface{}{
+		"chat_id":    msg.ChatID,
+		"message_id": resp.ID,
+	})
+	return nil
+}
+
+// upload stores a file on the server and returns a Markdown link to it,
+// which Zulip shows inline for images.
+func (c *ZulipChannel) upload(ctx context.Context, path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read attachment: %w", err)
+	}
+	defer f.Close()
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, err := w.CreateFormFile("filename", filepath.Base(path))
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(part, f); err != nil {
+		return "", fmt.Errorf("failed to read attachment: %w", err)
+	}
+	w.Close()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.site+"/api/v1/user_uploads", &body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	var resp struct {
+		zulipResponse
+		URI string `json:"uri"`
+	}
+	if err := c.do(req, &resp); err != nil {
+		return "", fmt.Errorf("failed to upload zulip file: %w", err)
+	}
+	return fmt.Sprintf("[%s](%s)", filepath.Base(path), resp.URI), nil
+}
+
+// Capabilities reports that Zulip takes Markdown and attachments of up to
+// the default upload limit of 25 MB. Streamed replies are not edited in
+// place.
+func (c *ZulipChannel) Capabilities() render.Capabilities {
+	return render.Capabilities{Markup: render.Markdown, Media: true, MaxLength: zulipMessageLimit, MaxAttachment: zulipUploadLimit}
+}
+
+// StartIndicator shows the bot typing in the chat while the agent works.
+// Zulip forgets a typing notice after 15 seconds, so it is renewed.
+func (c *ZulipChannel) StartIndicator(ctx context.Context, chatID, messageID string) func() {
+	form, err := zulipTypingForm(chatID)
+	if err != nil {
+		return func() {}
+	}
+	typing := func(ctx context.Context, op string) {
+		form.Set("op", op)
+		if err := c.call(ctx, http.MethodPost, "typing", form, nil); err != nil {
+			logger.DebugCF("zulip", "Failed to send typing notice", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}
+	typing(ctx, "start")
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(10 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				typing(context.Background(), "stop")
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				typing(ctx, "start")
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// zulipReactionNames pairs Zulip's names for common reactions with their
+// emoji, for sending them.
+var zulipReactionNames = [][2]string{
+	{"thumbs_up", "👍"},
+	{"thumbs_down", "👎"},
+	{"check", "✅"},
+	{"cross_mark", "❌"},
+	{"eyes", "👀"},
+	{"heart", "❤"},
+	{"tada", "🎉"},
+	{"fire", "🔥"},
+	{"rocket", "🚀"},
+	{"thinking", "🤔"},
+	{"warning", "⚠"},
+	{"100", "💯"},
+}
+
+// zulipEmoji returns the emoji of a reaction. Unicode emoji are named by
+// their code points, such as "1f44d"; the realm's custom emoji arrive as
+// ":name:".
+func zulipEmoji(name, code, reactionType string) string {
+	if reactionType == "unicode_emoji" {
+		var b strings.Builder
+		for _, part := range strings.Split(code, "-") {
+			r, err := strconv.ParseInt(part, 16, 32)
+			if err != nil {
+				return ":" + name + ":"
+			}
+			b.WriteRune(rune(r))
+		}
+		return b.String()
+	}
+	return ":" + name + ":"
+}
+
+// zulipReactionName returns Zulip's name for emoji, which may also be
+// given as a name, with or without colons.
+func zulipReactionName(emoji string) string {
+	plain := strings.ReplaceAll(emoji, "\uFE0F", "")
+	for _, pair := range zulipReactionNames {
+		if pair[1] == plain {
+			return pair[0]
+		}
+	}
+	return strings.Trim(emoji, ":")
+}
+
+// React adds or removes the bot's reaction on a message.
+func (c *ZulipChannel) React(ctx context.Context, chatID string, reaction bus.Reaction) error {
+	if _, err := strconv.Atoi(reaction.MessageID); err != nil {
+		return fmt.Errorf("invalid zulip message ID: %s", reaction.MessageID)
+	}
+	method := http.MethodPost
+	if reaction.Remove {
+		method = http.MethodDelete
+	}
+	form := url.Values{"emoji_name": {zulipReactionName(reaction.Emoji)}}
+	return c.call(ctx, method, "messages/"+reaction.MessageID+"/reactions", form, nil)
+}
+
+// DeleteMessage implements DeleteChannel.
+func (c *ZulipChannel) DeleteMessage(ctx context.Context, chatID, messageID string) error {
+	if _, err := strconv.Atoi(messageID); err != nil {
+		return fmt.Errorf("invalid zulip message ID: %s", messageID)
+	}
+	return c.call(ctx, http.MethodDelete, "messages/"+messageID, nil, nil)
+}
+
+// Contacts lists the organization's active people, for the contact
+// directory. Messages sent to a contact's chat ID reach them directly.
+func (c *ZulipChannel) Contacts(ctx context.Context) ([]contacts.Contact, error) {
+	var resp struct {
+		Members []struct {
+			UserID    int    `json:"user_id"`
+			Email     string `json:"email"`
+			FullName  string `json:"full_name"`
+			IsBot     bool   `json:"is_bot"`
+			IsActive  bool   `json:"is_active"`
+			AvatarURL string `json:"avatar_url"`
+		} `json:"members"`
+	}
+	if err := c.call(ctx, http.MethodGet, "users", nil, &resp); err != nil {
+		return nil, fmt.Errorf("failed to list Zulip users: %w", err)
+	}
+	list := make([]contacts.Contact, 0, len(resp.Members))
+	for _, u := range resp.Members {
+		if u.IsBot || !u.IsActive {
+			continue
+		}
+		id := strconv.Itoa(u.UserID)
+		list = append(list, contacts.Contact{
+			Channel:  c.Name(),
+			ID:       id,
+			Name:     u.FullName,
+			Username: u.Email,
+			ChatID:   zulipDMPrefix + id,
+			Avatar:   u.AvatarURL,
+		})
+	}
+	return list, nil
+}
+
+// zulipChatID returns the chat ID of a message, see zulipDMPrefix.
+func (c *ZulipChannel) zulipChatID(m *zulipMessage) string {
+	if m.Type == "stream" {
+		return strconv.Itoa(m.StreamID) + "/" + m.Topic
+	}
+	var users []struct {
+		ID int `json:"id"`
+	}
+	json.Unmarshal(m.Recipient, &users)
+	var ids []int
+	for _, u := range users {
+		if u.ID != c.botUserID {
+			ids = append(ids, u.ID)
+		}
+	}
+	if len(ids) == 0 {
+		// A message to oneself, seen by the bot only when it is the sender
+		ids = append(ids, m.SenderID)
+	}
+	slices.Sort(ids)
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.Itoa(id)
+	}
+	return zulipDMPrefix + strings.Join(parts, ",")
+}
+
+// parseZulipChatID splits a chat ID into a stream ID and topic, or the
+// user IDs of a direct message.
+func parseZulipChatID(chatID string) (streamID int, topic string, users []int, err error) {
+	if list, ok := strings.CutPrefix(chatID, zulipDMPrefix); ok {
+		for _, part := range strings.Split(list, ",") {
+			id, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil {
+				return 0, "", nil, fmt.Errorf("invalid zulip chat ID: %s", chatID)
+			}
+			users = append(users, id)
+		}
+		return 0, "", users, nil
+	}
+	stream, topic, _ := strings.Cut(chatID, "/")
+	streamID, err = strconv.Atoi(stream)
+	if err != nil {
+		return 0, "", nil, fmt.Errorf("invalid zulip chat ID: %s", chatID)
+	}
+	return streamID, topic, nil, nil
+}
+
+// zulipDestination returns the form fields addressing a message to chatID.
+func zulipDestination(chatID string) (url.Values, error) {
+	streamID, topic, users, err := parseZulipChatID(chatID)
+	if err != nil {
+		return nil, err
+	}
+	if users != nil {
+		to, _ := json.Marshal(users)
+		return url.Values{"type": {"direct"}, "to": {string(to)}}, nil
+	}
+	return url.Values{"type": {"stream"}, "to": {strconv.Itoa(streamID)}, "topic": {topic}}, nil
+}
+
+// zulipTypingForm returns the form fields of a typing notice in chatID.
+func zulipTypingForm(chatID string) (url.Values, error) {
+	streamID, topic, users, err := parseZulipChatID(chatID)
+	if err != nil {
+		return nil, err
+	}
+	if users != nil {
+		to, _ := json.Marshal(users)
+		return url.Values{"type": {"direct"}, "to": {string(to)}}, nil
+	}
+	return url.Values{"type": {"stream"}, "stream_id": {strconv.Itoa(streamID)}, "topic": {topic}}, nil
+}
+
+// zulipStreamName returns the stream name a stream message's
+// display_recipient holds.
+func zulipStreamName(recipient json.RawMessage) string {
+	var name string
+	json.Unmarshal(recipient, &name)
+	return name
+}
+
+// stripZulipMention removes mentions of the bot, "@**Name**" or, when
+// names are shared, "@**Name|id**", and silent "@_**Name**" ones.
+func stripZulipMention(text, botName string) string {
+	if botName == "" {
+		return strings.TrimSpace(text)
+	}
+	mention := regexp.MustCompile(`@_?\*\*` + regexp.QuoteMeta(botName) + `(\|\d+)?\*\*`)
+	return strings.TrimSpace(mention.ReplaceAllString(text, ""))
+}
+
+// call sends an API request with form as the query or body, and decodes
+// the response into out, which may be nil.
+func (c *ZulipChannel) call(ctx context.Context, method, endpoint string, form url.Values, out interface{}) error {
+	target := c.site + "/api/v1/" + endpoint
+	var body io.Reader
+	if method == http.MethodGet || method == http.MethodDelete {
+		if len(form) > 0 {
+			target += "?" + form.Encode()
+		}
+	} else {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	return c.do(req, out)
+}
+
+func (c *ZulipChannel) do(req *http.Request, out interface{}) error {
+	req.Header.Set("Authorization", c.auth)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		out = &zulipResponse{}
+	}
+	return decodeZulip(resp, out)
+}
+
+// decodeZulip decodes a response into out, returning the server's error
+// message for failed requests.
+func decodeZulip(resp *http.Response, out interface{}) error {
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return err
+	}
+	var status zulipResponse
+	if err := json.Unmarshal(data, &status); err != nil {
+		return fmt.Errorf("zulip API returned HTTP %d", resp.StatusCode)
+	}
+	if status.Result != "success" {
+		if status.Code == "BAD_EVENT_QUEUE_ID" {
+			return errZulipQueue
+		}
+		return fmt.Errorf("zulip API error (HTTP %d): %s", resp.StatusCode, status.Msg)
+	}
+	return json.Unmarshal(data, out)
+}
@@ -0,0 +1,201 @@
+package channels
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestParseZulipChatID(t *testing.T) {
+	tests := []struct {
+		chatID     string
+		wantStream int
+		wantTopic  string
+		wantUsers  []int
+		wantErr    bool
+	}{
+		{chatID: "42/release notes", wantStream: 42, wantTopic: "release notes"},
+		{chatID: "42/ci/failures", wantStream: 42, wantTopic: "ci/failures"},
+		{chatID: "42", wantStream: 42},
+		{chatID: "dm:7", wantUsers: []int{7}},
+		{chatID: "dm:7,9", wantUsers: []int{7, 9}},
+		{chatID: "general/topic", wantErr: true},
+		{chatID: "dm:alice", wantErr: true},
+	}
+	for _, tt := range tests {
+		streamID, topic, users, err := parseZulipChatID(tt.chatID)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseZulipChatID(%q) error = %v, want error %v", tt.chatID, err, tt.wantErr)
+			continue
+		}
+		if streamID != tt.wantStream || topic != tt.wantTopic || len(users) != len(tt.wantUsers) {
+			t.Errorf("parseZulipChatID(%q) = %d, %q, %v", tt.chatID, streamID, topic, users)
+			continue
+		}
+		for i := range users {
+			if users[i] != tt.wantUsers[i] {
+				t.Errorf("parseZulipChatID(%q) users = %v, want %v", tt.chatID, users, tt.wantUsers)
+			}
+		}
+	}
+}
+
+func TestStripZulipMention(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"@**Pico Bot** what broke?", "what broke?"},
+		{"@**Pico Bot|12** hi", "hi"},
+		{"silent @_**Pico Bot** ping", "silent  ping"},
+		{"@**Someone Else** hi", "@**Someone Else** hi"},
+	}
+	for _, tt := range tests {
+		if got := stripZulipMention(tt.input, "Pico Bot"); got != tt.want {
+			t.Errorf("stripZulipMention(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestZulipEmoji(t *testing.T) {
+	if got := zulipEmoji("thumbs_up", "1f44d", "unicode_emoji"); got != "👍" {
+		t.Errorf("zulipEmoji(thumbs_up) = %q", got)
+	}
+	if got := zulipEmoji("flag", "1f1e9-1f1ea", "unicode_emoji"); got != "🇩🇪" {
+		t.Errorf("zulipEmoji(flag) = %q", got)
+	}
+	if got := zulipEmoji("shipit", "42", "realm_emoji"); got != ":shipit:" {
+		t.Errorf("zulipEmoji(shipit) = %q", got)
+	}
+	if got := zulipReactionName("✅"); got != "check" {
+		t.Errorf("zulipReactionName(✅) = %q", got)
+	}
+	if got := zulipReactionName(":shipit:"); got != "shipit" {
+		t.Errorf("zulipReactionName(:shipit:) = %q", got)
+	}
+}
+
+// fakeZulip serves the parts of the Zulip API the channel uses, handing
+// out events once and recording sent messages.
+type fakeZulip struct {
+	mu     sync.Mutex
+	events []zulipEvent
+	sent   []url.Values
+}
+
+func (f *fakeZulip) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if user, pass, ok := r.BasicAuth(); !ok || user != "bot@example.com" || pass != "key" {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"result": "error", "msg": "Invalid API key"})
+		return
+	}
+	reply := map[string]interface{}{"result": "success"}
+	switch r.URL.Path {
+	case "/api/v1/users/me":
+		reply["user_id"] = 1
+		reply["full_name"] = "Pico Bot"
+	case "/api/v1/register":
+		reply["queue_id"] = "q1"
+		reply["last_event_id"] = -1
+	case "/api/v1/events":
+		f.mu.Lock()
+		events := f.events
+		f.events = nil
+		f.mu.Unlock()
+		if len(events) == 0 {
+			time.Sleep(20 * time.Millisecond)
+		}
+		reply["events"] = events
+	case "/api/v1/messages":
+		r.ParseForm()
+		f.mu.Lock()
+		f.sent = append(f.sent, r.PostForm)
+		f.mu.Unlock()
+		reply["id"] = 100
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		reply = map[string]interface{}{"result": "error", "msg": "not found"}
+	}
+	json.NewEncoder(w).Encode(reply)
+}
+
+func TestZulipChannel(t *testing.T) {
+	recipient := func(v interface{}) json.RawMessage {
+		data, _ := json.Marshal(v)
+		return data
+	}
+	fake := &fakeZulip{events: []zulipEvent{
+		{ID: 0, Type: "message", Message: &zulipMessage{
+			ID: 10, SenderID: 7, SenderEmail: "ada@example.com", Type: "stream",
+			StreamID: 42, Topic: "ci/failures", Recipient: recipient("dev"), Content: "no mention here",
+		}},
+		{ID: 1, Type: "message", Flags: []string{"mentioned"}, Message: &zulipMessage{
+			ID: 11, SenderID: 7, SenderEmail: "ada@example.com", Type: "stream",
+			StreamID: 42, Topic: "ci/failures", Recipient: recipient("dev"), Content: "@**Pico Bot** why is CI red?",
+		}},
+		{ID: 2, Type: "message", Message: &zulipMessage{
+			ID: 12, SenderID: 7, SenderEmail: "ada@example.com", Type: "private",
+			Recipient: recipient([]map[string]int{{"id": 1}, {"id": 7}}), Content: "hello",
+		}},
+	}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	msgBus := bus.NewMessageBus()
+	ch, err := NewZulipChannel(config.ZulipConfig{
+		Site: server.URL + "/", Email: "bot@example.com", APIKey: "key", AllowFrom: config.FlexibleStringSlice{"ada@example.com"},
+	}, msgBus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := ch.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer ch.Stop(ctx)
+
+	stream, ok := msgBus.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("no inbound message")
+	}
+	if stream.ChatID != "42/ci/failures" || stream.ThreadID != "ci/failures" || stream.Content != "why is CI red?" {
+		t.Errorf("stream message = %q in %q (thread %q)", stream.Content, stream.ChatID, stream.ThreadID)
+	}
+	if stream.Metadata["stream"] != "dev" || stream.Metadata["message_id"] != "11" {
+		t.Errorf("metadata = %v", stream.Metadata)
+	}
+	dm, ok := msgBus.ConsumeInbound(ctx)
+	if !ok {
+		t.Fatal("no direct message")
+	}
+	if dm.ChatID != "dm:7" || dm.Metadata["is_dm"] != "true" {
+		t.Errorf("direct message in %q, metadata %v", dm.ChatID, dm.Metadata)
+	}
+
+	if err := ch.Send(ctx, bus.OutboundMessage{ChatID: "42", ThreadID: "ci/failures", Content: "flaky test"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ch.Send(ctx, bus.OutboundMessage{ChatID: "dm:7", Content: "hi"}); err != nil {
+		t.Fatal(err)
+	}
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if len(fake.sent) != 2 {
+		t.Fatalf("sent %d messages, want 2", len(fake.sent))
+	}
+	if got := fake.sent[0]; got.Get("type") != "stream" || got.Get("to") != "42" || got.Get("topic") != "ci/failures" {
+		t.Errorf("stream reply = %v", got)
+	}
+	if got := fake.sent[1]; got.Get("type") != "direct" || got.Get("to") != "[7]" {
+		t.Errorf("direct reply = %v", got)
+	}
+}
@@ -0,0 +1,178 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+// Package commands routes slash commands such as "/help" or "/mute 1h" to
+// their handlers before a message reaches the agent.
+package commands
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+// Request is one invocation of a command.
+type Request struct {
+	Msg  bus.InboundMessage
+	Name string   // Command name without prefix, lowercased
+	Args []string // Arguments split on whitespace
+	Raw  string   // Arguments as typed
+}
+
+// Handler runs a command and returns the reply.
+type Handler func(ctx context.Context, req Request) string
+
+// Command is a slash command.
+type Command struct {
+	Name        string // Without the leading "/"
+	Aliases     []string
+	Usage       string // Argument synopsis shown by /help, e.g. "<duration>"
+	Description string
+	Hidden      bool // Left out of /help
+	// Options describe the arguments for channels that offer commands in
+	// a native menu, such as Discord's slash commands. Without them the
+	// menu takes the arguments as one text field described by Usage.
+	Options []Option
+	Handler Handler
+}
+
+// Option is one argument of a command. Handlers still get the arguments as
+// typed text: a menu joins the values given, in the order of the options.
+type Option struct {
+	Name        string // Lowercase, e.g. "duration"
+	Description string
+	Required    bool
+	Choices     []string // Allowed values; none allows any text
+}
+
+// Provider is implemented by tools that add their own commands.
+type Provider interface {
+	Commands() []Command
+}
+
+// Router dispatches commands by name.
+type Router struct {
+	mu       sync.RWMutex
+	commands map[string]*Command // name and aliases -> command
+}
+
+func NewRouter() *Router {
+	return &Router{commands: make(map[string]*Command)}
+}
+
+// Register adds a command. Names and aliases must be unique.
+func (r *Router) Register(cmd Command) error {
+	if cmd.Handler == nil {
+		return fmt.Errorf("command %q has no handler", cmd.Name)
+	}
+	names := append([]string{cmd.Name}, cmd.Aliases...)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, name := range names {
+		name = strings.ToLower(strings.TrimPrefix(name, "/"))
+		if name == "" || strings.ContainsAny(name, " \t\n") {
+			return fmt.Errorf("invalid command name %q", names[i])
+		}
+		if _, exists := r.commands[name]; exists {
+			return fmt.Errorf("command /%s is already registered", name)
+		}
+		names[i] = name
+	}
+
+	c := cmd
+	c.Name = names[0]
+	c.Aliases = names[1:]
+	for _, name := range names {
+		r.commands[name] = &c
+	}
+	return nil
+}
+
+// Handle runs the command in msg, if it names a registered one. It reports
+// false for ordinary messages and unknown commands, which go to the agent.
+func (r *Router) Handle(ctx context.Context, msg bus.InboundMessage) (string, bool) {
+	name, raw, ok := Parse(msg.Channel, msg.Content)
+	if !ok {
+		return "", false
+	}
+
+	r.mu.RLock()
+	cmd, found := r.commands[name]
+	r.mu.RUnlock()
+	if !found {
+		return "", false
+	}
+
+	return cmd.Handler(ctx, Request{
+		Msg:  msg,
+		Name: name,
+		Args: strings.Fields(raw),
+		Raw:  raw,
+	}), true
+}
+
+// List returns the visible commands sorted by name.
+func (r *Router) List() []Command {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	seen := make(map[*Command]bool)
+	var out []Command
+	for _, c := range r.commands {
+		if seen[c] || c.Hidden {
+			continue
+		}
+		seen[c] = true
+		out = append(out, *c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+var discordMention = regexp.MustCompile(`^<@!?\d+>\s*`)
+
+// Parse extracts a command name and its arguments from a message, hiding
+// per-channel syntax:
+//   - Telegram addresses commands in groups as "/help@my_bot"
+//   - Discord messages may start with a bot mention, "<@123> /help"
+//   - Slack's client intercepts "/", so "!help" is accepted there
+//
+// Names are lowercased.
+func Parse(channel, content string) (name, args string, ok bool) {
+	content = strings.TrimSpace(content)
+	if channel == "discord" {
+		content = discordMention.ReplaceAllString(content, "")
+	}
+
+	switch {
+	case strings.HasPrefix(content, "/"):
+		content = content[1:]
+	case channel == "slack" && strings.HasPrefix(content, "!"):
+		content = content[1:]
+	default:
+		return "", "", false
+	}
+
+	name, args, _ = strings.Cut(content, " ")
+	if i := strings.IndexAny(name, "\n\t"); i >= 0 {
+		args = name[i:] + " " + args
+		name = name[:i]
+	}
+	if at := strings.Index(name, "@"); at >= 0 {
+		name = name[:at]
+	}
+	if name == "" {
+		return "", "", false
+	}
+	return strings.ToLower(name), strings.TrimSpace(args), true
+}
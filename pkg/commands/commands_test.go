@@ -0,0 +1,68 @@
+package commands
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		channel, content string
+		name, args       string
+		ok               bool
+	}{
+		{"telegram", "/help", "help", "", true},
+		{"telegram", "  /Mute 1h ", "mute", "1h", true},
+		{"telegram", "/help@picoclaw_bot", "help", "", true},
+		{"telegram", "/lang@picoclaw_bot de", "lang", "de", true},
+		{"telegram", "/note\nbuy milk", "note", "buy milk", true},
+		{"discord", "<@123456> /status", "status", "", true},
+		{"discord", "<@!123456>/reset", "reset", "", true},
+		{"slack", "!help", "help", "", true},
+		{"telegram", "!help", "", "", false},
+		{"telegram", "hello /help", "", "", false},
+		{"telegram", "/", "", "", false},
+		{"whatsapp", "/ sure", "", "", false},
+	}
+	for _, tt := range tests {
+		name, args, ok := Parse(tt.channel, tt.content)
+		if name != tt.name || args != tt.args || ok != tt.ok {
+			t.Errorf("Parse(%q, %q) = %q, %q, %v; want %q, %q, %v",
+				tt.channel, tt.content, name, args, ok, tt.name, tt.args, tt.ok)
+		}
+	}
+}
+
+func TestRouter(t *testing.T) {
+	r := NewRouter()
+	echo := func(ctx context.Context, req Request) string {
+		return req.Name + ":" + strings.Join(req.Args, ",")
+	}
+
+	if err := r.Register(Command{Name: "echo", Aliases: []string{"/say"}, Description: "Repeat", Handler: echo}); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register(Command{Name: "SAY", Handler: echo}); err == nil {
+		t.Error("expected duplicate alias to be rejected")
+	}
+	if err := r.Register(Command{Name: "nohandler"}); err == nil {
+		t.Error("expected command without handler to be rejected")
+	}
+	r.Register(Command{Name: "secret", Hidden: true, Handler: echo})
+
+	msg := bus.InboundMessage{Channel: "telegram", Content: "/say a b"}
+	if resp, ok := r.Handle(context.Background(), msg); !ok || resp != "say:a,b" {
+		t.Errorf("Handle = %q, %v", resp, ok)
+	}
+	msg.Content = "/unknown"
+	if _, ok := r.Handle(context.Background(), msg); ok {
+		t.Error("unknown commands should pass through")
+	}
+
+	if list := r.List(); len(list) != 1 || list[0].Name != "echo" {
+		t.Errorf("List() = %+v, want the visible commands", list)
+	}
+}
@@ -44,28 +44,164 @@ func (f *FlexibleStringSlice) UnmarshalJSON(data []byte) error {
 }
 
 type Config struct {
-	Agents    AgentsConfig    `json:"agents"`
-	Channels  ChannelsConfig  `json:"channels"`
-	Providers ProvidersConfig `json:"providers"`
-	Gateway   GatewayConfig   `json:"gateway"`
-	Tools     ToolsConfig     `json:"tools"`
-	Heartbeat HeartbeatConfig `json:"heartbeat"`
-	Devices   DevicesConfig   `json:"devices"`
+	Agents      AgentsConfig      `json:"agents"`
+	Channels    ChannelsConfig    `json:"channels"`
+	Providers   ProvidersConfig   `json:"providers"`
+	Gateway     GatewayConfig     `json:"gateway"`
+	Tools       ToolsConfig       `json:"tools"`
+	Heartbeat   HeartbeatConfig   `json:"heartbeat"`
+	Devices     DevicesConfig     `json:"devices"`
+	Admin       AdminConfig       `json:"admin"`
+	RAG         RAGConfig         `json:"rag"`
+	Cron        CronConfig        `json:"cron"`
+	Usage       UsageConfig       `json:"usage"`
+	Preferences PreferencesConfig `json:"preferences"`
+	Contacts    ContactsConfig    `json:"contacts"`
+	Drafts      DraftsConfig      `json:"drafts"`
+	Digest      DigestConfig      `json:"digest"`
+	Groups      GroupsConfig      `json:"groups"`
+	Blocklist   BlocklistConfig   `json:"blocklist"`
+	Translation TranslationConfig `json:"translation"`
+	History     HistoryConfig     `json:"history"`
+	State       StateConfig       `json:"state"`
+	HA          HAConfig          `json:"ha"`
+	Broadcast   BroadcastConfig   `json:"broadcast"`
+	Media       MediaConfig       `json:"media"`
+	Webhooks    WebhooksConfig    `json:"webhooks"`
+	GRPC        GRPCConfig        `json:"grpc"`
+	// Templates are named outbound message templates (Go text/template
+	// producing Markdown), in addition to workspace/templates/*.tmpl.
+	Templates map[string]string `json:"templates,omitempty"`
 	mu        sync.RWMutex
 }
 
 type AgentsConfig struct {
 	Defaults AgentDefaults `json:"defaults"`
+	// Personas are named system prompt, temperature, and tool presets.
+	Personas map[string]PersonaConfig `json:"personas,omitempty"`
+	// ChatPersonas assigns a persona to a chat, keyed by "channel:chat_id".
+	ChatPersonas map[string]string `json:"chat_personas,omitempty"`
+	// Routes send messages to personas by channel, chat, or keyword, so one
+	// process can host several agents.
+	Routes []RouteConfig `json:"routes,omitempty"`
+	// Workflows are fixed sequences of tool calls and prompts, run by
+	// command or when a message matches a pattern.
+	Workflows map[string]WorkflowConfig `json:"workflows,omitempty"`
+}
+
+// WorkflowConfig defines an automation. It runs when a message starts with
+// Command (e.g. "/weather") or matches the Match regular expression. Steps
+// run in order; Output formats the reply and defaults to the last step's
+// result. Prompts, tool arguments, and Output are Go templates that can
+// refer to {{.input}}, {{.sender}}, {{.channel}}, {{.chat_id}}, named
+// groups from Match, {{.last}}, and earlier steps by their "as" name.
+type WorkflowConfig struct {
+	Description string         `json:"description,omitempty"`
+	Command     string         `json:"command,omitempty"`
+	Match       string         `json:"match,omitempty"`
+	Steps       []WorkflowStep `json:"steps"`
+	Output      string         `json:"output,omitempty"`
+}
+
+// WorkflowStep is either a tool call (Tool and Args) or a single LLM
+// prompt (Prompt, with an optional System prompt). As names the result for
+// later steps.
+type WorkflowStep struct {
+	Tool   string                 `json:"tool,omitempty"`
+	Args   map[string]interface{} `json:"args,omitempty"`
+	Prompt string                 `json:"prompt,omitempty"`
+	System string                 `json:"system,omitempty"`
+	As     string                 `json:"as,omitempty"`
+}
+
+// PersonaConfig customizes the agent for a chat. SystemPrompt is added to
+// the base prompt, Temperature (when set) overrides the default, and Tools
+// (when non-empty) limits which tools the model may call. Provider and
+// Model (when set) run the persona on a different LLM than the default.
+type PersonaConfig struct {
+	SystemPrompt string   `json:"system_prompt"`
+	Temperature  *float64 `json:"temperature,omitempty"`
+	Tools        []string `json:"tools,omitempty"`
+	Provider     string   `json:"provider,omitempty"`
+	Model        string   `json:"model,omitempty"`
+}
+
+// RouteConfig sends messages to a persona. A route matches when every
+// condition it sets holds: the channel is one of Channels, the chat
+// ("channel:chat_id") is one of Chats, and the message contains one of
+// Keywords as a whole word. A route without conditions matches everything.
+type RouteConfig struct {
+	Persona  string   `json:"persona"`
+	Channels []string `json:"channels,omitempty"`
+	Chats    []string `json:"chats,omitempty"`
+	Keywords []string `json:"keywords,omitempty"`
 }
 
 type AgentDefaults struct {
-	Workspace           string  `json:"workspace" env:"PICOCLAW_AGENTS_DEFAULTS_WORKSPACE"`
-	RestrictToWorkspace bool    `json:"restrict_to_workspace" env:"PICOCLAW_AGENTS_DEFAULTS_RESTRICT_TO_WORKSPACE"`
-	Provider            string  `json:"provider" env:"PICOCLAW_AGENTS_DEFAULTS_PROVIDER"`
-	Model               string  `json:"model" env:"PICOCLAW_AGENTS_DEFAULTS_MODEL"`
-	MaxTokens           int     `json:"max_tokens" env:"PICOCLAW_AGENTS_DEFAULTS_MAX_TOKENS"`
-	Temperature         float64 `json:"temperature" env:"PICOCLAW_AGENTS_DEFAULTS_TEMPERATURE"`
-	MaxToolIterations   int     `json:"max_tool_iterations" env:"PICOCLAW_AGENTS_DEFAULTS_MAX_TOOL_ITERATIONS"`
+	Workspace           string `json:"workspace" env:"PICOCLAW_AGENTS_DEFAULTS_WORKSPACE"`
+	RestrictToWorkspace bool   `json:"restrict_to_workspace" env:"PICOCLAW_AGENTS_DEFAULTS_RESTRICT_TO_WORKSPACE"`
+	Provider            string `json:"provider" env:"PICOCLAW_AGENTS_DEFAULTS_PROVIDER"`
+	Model               string `json:"model" env:"PICOCLAW_AGENTS_DEFAULTS_MODEL"`
+	MaxTokens           int    `json:"max_tokens" env:"PICOCLAW_AGENTS_DEFAULTS_MAX_TOKENS"`
+	// ContextWindow is the model's context size in tokens; 0 looks it up
+	// from the model name.
+	ContextWindow int `json:"context_window" env:"PICOCLAW_AGENTS_DEFAULTS_CONTEXT_WINDOW"`
+	// ToolOutputReserve is the room, in tokens, kept free for tool results
+	// during a turn. Longer tool results are truncated to this size.
+	ToolOutputReserve int     `json:"tool_output_reserve" env:"PICOCLAW_AGENTS_DEFAULTS_TOOL_OUTPUT_RESERVE"`
+	Temperature       float64 `json:"temperature" env:"PICOCLAW_AGENTS_DEFAULTS_TEMPERATURE"`
+	MaxToolIterations int     `json:"max_tool_iterations" env:"PICOCLAW_AGENTS_DEFAULTS_MAX_TOOL_ITERATIONS"`
+	Streaming         bool    `json:"streaming" env:"PICOCLAW_AGENTS_DEFAULTS_STREAMING"`
+	// SummarizeThreshold is the number of history messages that triggers
+	// folding older turns into the session's rolling summary.
+	SummarizeThreshold int `json:"summarize_threshold" env:"PICOCLAW_AGENTS_DEFAULTS_SUMMARIZE_THRESHOLD"`
+	// KeepRecentMessages is how many of the latest messages stay verbatim
+	// after summarization.
+	KeepRecentMessages int `json:"keep_recent_messages" env:"PICOCLAW_AGENTS_DEFAULTS_KEEP_RECENT_MESSAGES"`
+	// Vision attaches incoming images to the LLM call. Enable it only for
+	// models that accept image input.
+	Vision bool `json:"vision" env:"PICOCLAW_AGENTS_DEFAULTS_VISION"`
+	// VisionMaxDimension is the longest side, in pixels, images are
+	// downscaled to before upload.
+	VisionMaxDimension int `json:"vision_max_dimension" env:"PICOCLAW_AGENTS_DEFAULTS_VISION_MAX_DIMENSION"`
+	// ResponseCacheTTL is how long, in seconds, answers to repeated prompts
+	// in a chat are reused. 0 disables the cache.
+	ResponseCacheTTL int `json:"response_cache_ttl" env:"PICOCLAW_AGENTS_DEFAULTS_RESPONSE_CACHE_TTL"`
+	// ResponseCacheSize caps the number of cached answers.
+	ResponseCacheSize int `json:"response_cache_size" env:"PICOCLAW_AGENTS_DEFAULTS_RESPONSE_CACHE_SIZE"`
+	// Fallbacks are tried in order when the primary provider fails.
+	Fallbacks []FallbackConfig `json:"fallbacks,omitempty"`
+	// FallbackCooldown is how many seconds a provider that keeps failing is
+	// skipped before it is tried again.
+	FallbackCooldown int `json:"fallback_cooldown" env:"PICOCLAW_AGENTS_DEFAULTS_FALLBACK_COOLDOWN"`
+	// FallbackTimeout bounds each provider attempt in seconds when fallbacks
+	// are configured. 0 leaves it to the provider.
+	FallbackTimeout int `json:"fallback_timeout" env:"PICOCLAW_AGENTS_DEFAULTS_FALLBACK_TIMEOUT"`
+	// LocalMode targets a small model on a local Ollama or llama.cpp
+	// server: settings left at their defaults are replaced with ones sized
+	// for a small context, and a compact system prompt is used.
+	LocalMode bool `json:"local_mode" env:"PICOCLAW_AGENTS_DEFAULTS_LOCAL_MODE"`
+	// Locale is the language of the bot's built-in replies in chats that
+	// have not picked one with /lang, e.g. "en" or "de".
+	Locale string `json:"locale" env:"PICOCLAW_AGENTS_DEFAULTS_LOCALE"`
+	// MatchLanguage has the agent reply in the language each message is
+	// written in, unless the chat picked one with /lang.
+	MatchLanguage bool `json:"match_language" env:"PICOCLAW_AGENTS_DEFAULTS_MATCH_LANGUAGE"`
+	// ReactionTriggers map emoji to what reacting with them to a message
+	// does: "save" it to the knowledge base, "rerun" the agent on it, or
+	// "delete" the bot's reply, e.g. {"📌": "save"}.
+	ReactionTriggers map[string]string `json:"reaction_triggers,omitempty"`
+}
+
+// FallbackConfig is a backup provider. Provider names a configured entry
+// under "providers"; alternatively APIBase (and APIKey) point at any
+// OpenAI-compatible endpoint such as a local Ollama server. Model overrides
+// the default model for this provider.
+type FallbackConfig struct {
+	Provider string `json:"provider,omitempty"`
+	Model    string `json:"model,omitempty"`
+	APIBase  string `json:"api_base,omitempty"`
+	APIKey   string `json:"api_key,omitempty"`
 }
 
 type ChannelsConfig struct {
@@ -73,13 +209,45 @@ type ChannelsConfig struct {
 	Telegram TelegramConfig `json:"telegram"`
 	Discord  DiscordConfig  `json:"discord"`
 	Slack    SlackConfig    `json:"slack"`
+	Zulip    ZulipConfig    `json:"zulip"`
+	Signal   SignalConfig   `json:"signal"`
+	Twilio   TwilioConfig   `json:"twilio"`
+	MQTT     MQTTConfig     `json:"mqtt"`
 }
 
 type WhatsAppConfig struct {
-	Enabled   bool                `json:"enabled" env:"PICOCLAW_CHANNELS_WHATSAPP_ENABLED"`
-	BridgeURL string              `json:"bridge_url,omitempty" env:"PICOCLAW_CHANNELS_WHATSAPP_BRIDGE_URL"`
-	StorePath string              `json:"store_path,omitempty" env:"PICOCLAW_CHANNELS_WHATSAPP_STORE_PATH"`
+	Enabled   bool   `json:"enabled" env:"PICOCLAW_CHANNELS_WHATSAPP_ENABLED"`
+	BridgeURL string `json:"bridge_url,omitempty" env:"PICOCLAW_CHANNELS_WHATSAPP_BRIDGE_URL"`
+	// StorePath is the directory with one subdirectory per account holding
+	// its paired session. A path ending in ".db" is a session file from
+	// before accounts, used as is until moved with
+	// "picoclaw whatsapp migrate-store".
+	StorePath string `json:"store_path,omitempty" env:"PICOCLAW_CHANNELS_WHATSAPP_STORE_PATH"`
+	// Account names the session's directory under StorePath.
+	Account   string              `json:"account,omitempty" env:"PICOCLAW_CHANNELS_WHATSAPP_ACCOUNT"`
 	AllowFrom FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_WHATSAPP_ALLOW_FROM"`
+	Chunking  ChunkingConfig      `json:"chunking" envPrefix:"PICOCLAW_CHANNELS_WHATSAPP_CHUNKING_"`
+	Retry     RetryConfig         `json:"retry" envPrefix:"PICOCLAW_CHANNELS_WHATSAPP_RETRY_"`
+	// Workers is how many chats' incoming messages are prepared at once
+	// (media downloads, transcription); each chat's stay in order.
+	Workers int `json:"workers" env:"PICOCLAW_CHANNELS_WHATSAPP_WORKERS"`
+	// RejectCalls turns down voice and video calls to the bot's number,
+	// answering the caller with CallReply, or a built-in message in the
+	// chat's language when it is empty.
+	RejectCalls bool   `json:"reject_calls" env:"PICOCLAW_CHANNELS_WHATSAPP_REJECT_CALLS"`
+	CallReply   string `json:"call_reply,omitempty" env:"PICOCLAW_CHANNELS_WHATSAPP_CALL_REPLY"`
+	// PairingPhone, in international format, has a new session paired by
+	// entering a code on that phone instead of scanning the QR code, for
+	// deployments without a terminal to show one.
+	PairingPhone string `json:"pairing_phone,omitempty" env:"PICOCLAW_CHANNELS_WHATSAPP_PAIRING_PHONE"`
+	// SendTyping shows "typing…" while the agent works on a reply, and
+	// SendReadReceipts marks each message read once the agent picks it
+	// up. Native mode only.
+	SendTyping       bool `json:"send_typing" env:"PICOCLAW_CHANNELS_WHATSAPP_SEND_TYPING"`
+	SendReadReceipts bool `json:"send_read_receipts" env:"PICOCLAW_CHANNELS_WHATSAPP_SEND_READ_RECEIPTS"`
+	// RespondOnlyWhenMentioned ignores group messages that neither
+	// @mention the bot nor reply to one of its messages.
+	RespondOnlyWhenMentioned bool `json:"respond_only_when_mentioned" env:"PICOCLAW_CHANNELS_WHATSAPP_RESPOND_ONLY_WHEN_MENTIONED"`
 }
 
 type TelegramConfig struct {
@@ -87,12 +255,22 @@ type TelegramConfig struct {
 	Token     string              `json:"token" env:"PICOCLAW_CHANNELS_TELEGRAM_TOKEN"`
 	Proxy     string              `json:"proxy" env:"PICOCLAW_CHANNELS_TELEGRAM_PROXY"`
 	AllowFrom FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_TELEGRAM_ALLOW_FROM"`
+	Chunking  ChunkingConfig      `json:"chunking" envPrefix:"PICOCLAW_CHANNELS_TELEGRAM_CHUNKING_"`
+	Retry     RetryConfig         `json:"retry" envPrefix:"PICOCLAW_CHANNELS_TELEGRAM_RETRY_"`
 }
 
 type DiscordConfig struct {
 	Enabled   bool                `json:"enabled" env:"PICOCLAW_CHANNELS_DISCORD_ENABLED"`
 	Token     string              `json:"token" env:"PICOCLAW_CHANNELS_DISCORD_TOKEN"`
 	AllowFrom FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_DISCORD_ALLOW_FROM"`
+	Chunking  ChunkingConfig      `json:"chunking" envPrefix:"PICOCLAW_CHANNELS_DISCORD_CHUNKING_"`
+	Retry     RetryConfig         `json:"retry" envPrefix:"PICOCLAW_CHANNELS_DISCORD_RETRY_"`
+	// MemberEvents asks Discord for members joining and leaving servers,
+	// which needs the Server Members privileged intent.
+	MemberEvents bool `json:"member_events" env:"PICOCLAW_CHANNELS_DISCORD_MEMBER_EVENTS"`
+	// SlashCommands registers the bot's commands as Discord slash
+	// commands, replacing any the application had.
+	SlashCommands bool `json:"slash_commands" env:"PICOCLAW_CHANNELS_DISCORD_SLASH_COMMANDS"`
 }
 
 type SlackConfig struct {
@@ -100,6 +278,122 @@ type SlackConfig struct {
 	BotToken  string              `json:"bot_token" env:"PICOCLAW_CHANNELS_SLACK_BOT_TOKEN"`
 	AppToken  string              `json:"app_token" env:"PICOCLAW_CHANNELS_SLACK_APP_TOKEN"`
 	AllowFrom FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_SLACK_ALLOW_FROM"`
+	Chunking  ChunkingConfig      `json:"chunking" envPrefix:"PICOCLAW_CHANNELS_SLACK_CHUNKING_"`
+	Retry     RetryConfig         `json:"retry" envPrefix:"PICOCLAW_CHANNELS_SLACK_RETRY_"`
+}
+
+// ZulipConfig connects a bot user to a Zulip organization. Site is the
+// server's URL; Email and APIKey are the bot's, from its settings.
+type ZulipConfig struct {
+	Enabled   bool                `json:"enabled" env:"PICOCLAW_CHANNELS_ZULIP_ENABLED"`
+	Site      string              `json:"site" env:"PICOCLAW_CHANNELS_ZULIP_SITE"`
+	Email     string              `json:"email" env:"PICOCLAW_CHANNELS_ZULIP_EMAIL"`
+	APIKey    string              `json:"api_key" env:"PICOCLAW_CHANNELS_ZULIP_API_KEY"`
+	AllowFrom FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_ZULIP_ALLOW_FROM"`
+	Chunking  ChunkingConfig      `json:"chunking" envPrefix:"PICOCLAW_CHANNELS_ZULIP_CHUNKING_"`
+	Retry     RetryConfig         `json:"retry" envPrefix:"PICOCLAW_CHANNELS_ZULIP_RETRY_"`
+}
+
+// SignalConfig connects to a signal-cli daemon serving JSON-RPC over HTTP
+// ("signal-cli daemon --http"). URL is the daemon's address; Account is
+// the bot's registered phone number, needed when the daemon serves more
+// than one.
+type SignalConfig struct {
+	Enabled   bool                `json:"enabled" env:"PICOCLAW_CHANNELS_SIGNAL_ENABLED"`
+	URL       string              `json:"url" env:"PICOCLAW_CHANNELS_SIGNAL_URL"`
+	Account   string              `json:"account" env:"PICOCLAW_CHANNELS_SIGNAL_ACCOUNT"`
+	AllowFrom FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_SIGNAL_ALLOW_FROM"`
+	Chunking  ChunkingConfig      `json:"chunking" envPrefix:"PICOCLAW_CHANNELS_SIGNAL_CHUNKING_"`
+	Retry     RetryConfig         `json:"retry" envPrefix:"PICOCLAW_CHANNELS_SIGNAL_RETRY_"`
+}
+
+// TwilioConfig connects Twilio phone numbers for SMS and MMS. Twilio posts
+// incoming messages to the gateway's /twilio/sms webhook, signed with
+// AuthToken. WebhookURL is that endpoint's public URL as set on the
+// numbers, needed when a proxy in front changes how it is reached.
+type TwilioConfig struct {
+	Enabled    bool   `json:"enabled" env:"PICOCLAW_CHANNELS_TWILIO_ENABLED"`
+	AccountSID string `json:"account_sid" env:"PICOCLAW_CHANNELS_TWILIO_ACCOUNT_SID"`
+	AuthToken  string `json:"auth_token" env:"PICOCLAW_CHANNELS_TWILIO_AUTH_TOKEN"`
+	// Numbers are the bot's Twilio numbers. Replies go out from the number
+	// the user texted, other messages from the first.
+	Numbers    []TwilioNumber      `json:"numbers"`
+	AllowFrom  FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_TWILIO_ALLOW_FROM"`
+	WebhookURL string              `json:"webhook_url,omitempty" env:"PICOCLAW_CHANNELS_TWILIO_WEBHOOK_URL"`
+	Chunking   ChunkingConfig      `json:"chunking" envPrefix:"PICOCLAW_CHANNELS_TWILIO_CHUNKING_"`
+	Retry      RetryConfig         `json:"retry" envPrefix:"PICOCLAW_CHANNELS_TWILIO_RETRY_"`
+}
+
+// TwilioNumber is one of the bot's Twilio numbers. A non-empty AllowFrom
+// limits who may text it, on top of the channel's allow_from.
+type TwilioNumber struct {
+	Number    string              `json:"number"`
+	AllowFrom FlexibleStringSlice `json:"allow_from"`
+}
+
+// MQTTConfig connects to an MQTT broker. Messages published to topics
+// matching InboundTopic, which may hold wildcards, go to the agent, and
+// replies are published to OutboundTopic, where "{chat}" stands for the
+// levels the wildcards matched. Brokers with an ssl://, tls://, mqtts://,
+// or wss:// URL are reached over TLS.
+type MQTTConfig struct {
+	Enabled       bool          `json:"enabled" env:"PICOCLAW_CHANNELS_MQTT_ENABLED"`
+	Broker        string        `json:"broker" env:"PICOCLAW_CHANNELS_MQTT_BROKER"`
+	ClientID      string        `json:"client_id" env:"PICOCLAW_CHANNELS_MQTT_CLIENT_ID"`
+	Username      string        `json:"username" env:"PICOCLAW_CHANNELS_MQTT_USERNAME"`
+	Password      string        `json:"password" env:"PICOCLAW_CHANNELS_MQTT_PASSWORD"`
+	TLS           MQTTTLSConfig `json:"tls" envPrefix:"PICOCLAW_CHANNELS_MQTT_TLS_"`
+	QoS           int           `json:"qos" env:"PICOCLAW_CHANNELS_MQTT_QOS"` // 0, 1, or 2, for both directions
+	InboundTopic  string        `json:"inbound_topic" env:"PICOCLAW_CHANNELS_MQTT_INBOUND_TOPIC"`
+	OutboundTopic string        `json:"outbound_topic" env:"PICOCLAW_CHANNELS_MQTT_OUTBOUND_TOPIC"`
+	// Topics give the topics matching their filters allow lists of their
+	// own, on top of the channel's allow_from.
+	Topics []MQTTTopic `json:"topics"`
+	// TrustFrom takes the sender from a JSON payload's "from" field, as
+	// "claimed:<from>", instead of the chat. Anyone who may publish to the
+	// topic can write any name there, so such senders are never operators.
+	TrustFrom bool                `json:"trust_from" env:"PICOCLAW_CHANNELS_MQTT_TRUST_FROM"`
+	AllowFrom FlexibleStringSlice `json:"allow_from" env:"PICOCLAW_CHANNELS_MQTT_ALLOW_FROM"`
+	Chunking  ChunkingConfig      `json:"chunking" envPrefix:"PICOCLAW_CHANNELS_MQTT_CHUNKING_"`
+	Retry     RetryConfig         `json:"retry" envPrefix:"PICOCLAW_CHANNELS_MQTT_RETRY_"`
+}
+
+// MQTTTLSConfig sets up TLS to the broker. CAFile verifies a broker whose
+// certificate the system does not trust; CertFile and KeyFile are a client
+// certificate for brokers that require one.
+type MQTTTLSConfig struct {
+	CAFile   string `json:"ca_file" env:"CA_FILE"`
+	CertFile string `json:"cert_file" env:"CERT_FILE"`
+	KeyFile  string `json:"key_file" env:"KEY_FILE"`
+}
+
+// MQTTTopic limits who may publish to the topics matching Topic, a topic
+// filter that may hold wildcards, to AllowFrom.
+type MQTTTopic struct {
+	Topic     string              `json:"topic"`
+	AllowFrom FlexibleStringSlice `json:"allow_from"`
+}
+
+// ChunkingConfig sets how a channel sends replies too long for one
+// message. They are split between paragraphs, never inside a code block or
+// a list, into messages of at most MaxLength characters, or sent as a
+// file once longer than FileThreshold or when they would take more than
+// MaxParts messages.
+type ChunkingConfig struct {
+	MaxLength     int    `json:"max_length" env:"MAX_LENGTH"`         // 0 uses the platform limit
+	Continuation  string `json:"continuation" env:"CONTINUATION"`     // Appended to every part but the last
+	FileThreshold int    `json:"file_threshold" env:"FILE_THRESHOLD"` // 0 never sends a file
+	MaxParts      int    `json:"max_parts" env:"MAX_PARTS"`           // 0 uses 5, -1 never sends a file
+	DelayMS       int    `json:"delay_ms" env:"DELAY_MS"`             // Between parts; 0 none
+}
+
+// RetryConfig sets how a channel's failed sends are retried from the
+// outbox. With Collapse, a failed plain-text message to a chat that
+// already has the same text waiting is folded into it and sent once.
+type RetryConfig struct {
+	MaxAttempts int  `json:"max_attempts" env:"MAX_ATTEMPTS"` // 0 uses 10
+	MaxAge      int  `json:"max_age" env:"MAX_AGE"`           // Minutes; 0 uses 24 hours
+	Collapse    bool `json:"collapse" env:"COLLAPSE"`
 }
 
 type HeartbeatConfig struct {
@@ -107,6 +401,24 @@ type HeartbeatConfig struct {
 	Interval int  `json:"interval" env:"PICOCLAW_HEARTBEAT_INTERVAL"` // minutes, min 5
 }
 
+// CronConfig holds scheduled prompts defined in the config file. The gateway
+// syncs them into the job store on start.
+type CronConfig struct {
+	Jobs []CronJobConfig `json:"jobs"`
+}
+
+// CronJobConfig runs Prompt through the agent on Schedule (a cron
+// expression, evaluated in TZ or local time) and sends the answer to
+// Channel/ChatID.
+type CronJobConfig struct {
+	Name     string `json:"name"`
+	Schedule string `json:"schedule"`
+	TZ       string `json:"tz"`
+	Prompt   string `json:"prompt"`
+	Channel  string `json:"channel"`
+	ChatID   string `json:"chat_id"`
+}
+
 type DevicesConfig struct {
 	Enabled    bool `json:"enabled" env:"PICOCLAW_DEVICES_ENABLED"`
 	MonitorUSB bool `json:"monitor_usb" env:"PICOCLAW_DEVICES_MONITOR_USB"`
@@ -121,6 +433,8 @@ type ProvidersConfig struct {
 	Gemini        ProviderConfig `json:"gemini"`
 	Nvidia        ProviderConfig `json:"nvidia"`
 	GitHubCopilot ProviderConfig `json:"github_copilot"`
+	Ollama        ProviderConfig `json:"ollama"`
+	LlamaCpp      ProviderConfig `json:"llamacpp"`
 }
 
 type ProviderConfig struct {
@@ -134,6 +448,260 @@ type ProviderConfig struct {
 type GatewayConfig struct {
 	Host string `json:"host" env:"PICOCLAW_GATEWAY_HOST"`
 	Port int    `json:"port" env:"PICOCLAW_GATEWAY_PORT"`
+	// ShutdownTimeout is how many seconds the gateway waits for in-flight
+	// messages and queued sends to finish before exiting.
+	ShutdownTimeout int `json:"shutdown_timeout" env:"PICOCLAW_GATEWAY_SHUTDOWN_TIMEOUT"`
+	// Health serves /healthz, /readyz, and the WhatsApp pairing page on
+	// host:port without authentication. On by default in container mode.
+	Health bool `json:"health" env:"PICOCLAW_GATEWAY_HEALTH"`
+	// Supervisor restarts channels that crashed or will not reconnect.
+	Supervisor SupervisorConfig `json:"supervisor"`
+	// CircuitBreaker stops sending to channels whose sends keep failing.
+	CircuitBreaker CircuitBreakerConfig `json:"circuit_breaker"`
+}
+
+// SupervisorConfig controls the channel supervisor. It restarts a channel
+// whose goroutines died, or that has been reconnecting for DownAfter
+// seconds, waiting twice as long before each further attempt, up to
+// MaxBackoff seconds. After AlertAfter restarts in a row that did not
+// keep the channel up it reports the channel as failing, telling the
+// chats in AlertTo ("channel:chat_id").
+type SupervisorConfig struct {
+	Enabled    bool     `json:"enabled" env:"PICOCLAW_GATEWAY_SUPERVISOR_ENABLED"`
+	DownAfter  int      `json:"down_after" env:"PICOCLAW_GATEWAY_SUPERVISOR_DOWN_AFTER"`
+	MaxBackoff int      `json:"max_backoff" env:"PICOCLAW_GATEWAY_SUPERVISOR_MAX_BACKOFF"`
+	AlertAfter int      `json:"alert_after" env:"PICOCLAW_GATEWAY_SUPERVISOR_ALERT_AFTER"`
+	AlertTo    []string `json:"alert_to" env:"PICOCLAW_GATEWAY_SUPERVISOR_ALERT_TO"`
+}
+
+// CircuitBreakerConfig controls the per-channel circuit breakers. After
+// Failures sends in a row fail, a channel is degraded: outbound messages
+// wait in the outbox instead of being sent, and one is let through every
+// ProbeInterval seconds to test the channel, doubling up to
+// MaxProbeInterval while the probes fail. A probe that succeeds closes the
+// breaker.
+type CircuitBreakerConfig struct {
+	Enabled          bool `json:"enabled" env:"PICOCLAW_GATEWAY_CIRCUIT_BREAKER_ENABLED"`
+	Failures         int  `json:"failures" env:"PICOCLAW_GATEWAY_CIRCUIT_BREAKER_FAILURES"`
+	ProbeInterval    int  `json:"probe_interval" env:"PICOCLAW_GATEWAY_CIRCUIT_BREAKER_PROBE_INTERVAL"`
+	MaxProbeInterval int  `json:"max_probe_interval" env:"PICOCLAW_GATEWAY_CIRCUIT_BREAKER_MAX_PROBE_INTERVAL"`
+}
+
+// AdminConfig controls the authenticated admin/diagnostics HTTP server.
+// It is disabled by default and refuses to start without a token.
+// Operators ("channel:sender_id") may also use the /admin chat command,
+// independently of the HTTP server.
+type AdminConfig struct {
+	Enabled   bool     `json:"enabled" env:"PICOCLAW_ADMIN_ENABLED"`
+	Host      string   `json:"host" env:"PICOCLAW_ADMIN_HOST"`
+	Port      int      `json:"port" env:"PICOCLAW_ADMIN_PORT"`
+	Token     string   `json:"token" env:"PICOCLAW_ADMIN_TOKEN"`
+	Operators []string `json:"operators" env:"PICOCLAW_ADMIN_OPERATORS"`
+}
+
+// GRPCConfig controls the gRPC API, which lets other services send and
+// receive messages through the gateway's channels. It is disabled by
+// default and refuses to start without a token. It does not use TLS: keep
+// it on localhost or put a TLS proxy in front.
+type GRPCConfig struct {
+	Enabled bool   `json:"enabled" env:"PICOCLAW_GRPC_ENABLED"`
+	Host    string `json:"host" env:"PICOCLAW_GRPC_HOST"`
+	Port    int    `json:"port" env:"PICOCLAW_GRPC_PORT"`
+	Token   string `json:"token" env:"PICOCLAW_GRPC_TOKEN"`
+}
+
+// UsageConfig controls per-sender and per-chat usage accounting. Budgets
+// are monthly USD limits; 0 disables a limit. Prices add to or override
+// the built-in table and are keyed by model name prefix.
+type UsageConfig struct {
+	Enabled                bool                  `json:"enabled" env:"PICOCLAW_USAGE_ENABLED"`
+	MonthlyBudgetPerUser   float64               `json:"monthly_budget_per_user" env:"PICOCLAW_USAGE_MONTHLY_BUDGET_PER_USER"`
+	MonthlyBudgetPerChat   float64               `json:"monthly_budget_per_chat" env:"PICOCLAW_USAGE_MONTHLY_BUDGET_PER_CHAT"`
+	TranscriptionPerMinute float64               `json:"transcription_per_minute" env:"PICOCLAW_USAGE_TRANSCRIPTION_PER_MINUTE"`
+	Prices                 map[string]ModelPrice `json:"prices,omitempty"`
+}
+
+// PreferencesConfig controls long-term user preference memory. Identities
+// links accounts on different channels to one person, e.g.
+// {"alice": ["telegram:123456", "discord:987654"]}, so they share
+// preferences.
+type PreferencesConfig struct {
+	Enabled    bool                `json:"enabled" env:"PICOCLAW_PREFERENCES_ENABLED"`
+	Identities map[string][]string `json:"identities,omitempty"`
+}
+
+// ContactsConfig controls the contact directory, which resolves names as
+// in "message Alice" to chats. People who message the bot directly are
+// recorded; the rest is opt-in. GroupMembers records people only seen in
+// groups, AddressBook syncs the WhatsApp and Slack address books every
+// SyncHours, and Avatars keeps profile picture URLs. Exclude lists
+// "channel:id" users never stored.
+type ContactsConfig struct {
+	Enabled      bool     `json:"enabled" env:"PICOCLAW_CONTACTS_ENABLED"`
+	GroupMembers bool     `json:"group_members" env:"PICOCLAW_CONTACTS_GROUP_MEMBERS"`
+	AddressBook  bool     `json:"address_book" env:"PICOCLAW_CONTACTS_ADDRESS_BOOK"`
+	SyncHours    int      `json:"sync_hours" env:"PICOCLAW_CONTACTS_SYNC_HOURS"`
+	Avatars      bool     `json:"avatars" env:"PICOCLAW_CONTACTS_AVATARS"`
+	Exclude      []string `json:"exclude,omitempty"`
+	// Presence records when watched contacts were last online, for the
+	// presence tool. Users opt out with /lastseen off.
+	Presence bool `json:"presence" env:"PICOCLAW_CONTACTS_PRESENCE"`
+}
+
+// DraftsConfig holds the agent's replies to some chats as drafts until an
+// operator approves them, e.g. on a business-facing number. Chats are
+// "channel:chat_id", or "channel:*" for every chat on a channel; operators
+// switch single chats with /admin drafts. Each draft is sent for review to
+// ApprovalChat ("channel:chat_id"), which is never held itself.
+type DraftsConfig struct {
+	Chats        []string `json:"chats" env:"PICOCLAW_DRAFTS_CHATS"`
+	ApprovalChat string   `json:"approval_chat" env:"PICOCLAW_DRAFTS_APPROVAL_CHAT"`
+}
+
+// DigestConfig batches low-priority notifications, such as a contact
+// coming online, per chat and sends each chat's batch as one message on
+// Schedule (a cron expression, in local time). A digest lists at most
+// MaxItems notifications, the latest, and counts the rest. Users switch
+// their chat out of or back into digests with /digest.
+type DigestConfig struct {
+	Enabled  bool   `json:"enabled" env:"PICOCLAW_DIGEST_ENABLED"`
+	Schedule string `json:"schedule" env:"PICOCLAW_DIGEST_SCHEDULE"`
+	MaxItems int    `json:"max_items" env:"PICOCLAW_DIGEST_MAX_ITEMS"`
+}
+
+// GroupsConfig holds groups the bot is added or invited to until an
+// operator accepts them; their messages are ignored meanwhile. Each is
+// sent for review to ApprovalChat ("channel:chat_id"). AutoAccept entries
+// are "channel:chat_id", "channel:*" for every group on a channel, or
+// "channel:sender_id" for groups a trusted user brings the bot into.
+type GroupsConfig struct {
+	RequireApproval bool     `json:"require_approval" env:"PICOCLAW_GROUPS_REQUIRE_APPROVAL"`
+	AutoAccept      []string `json:"auto_accept" env:"PICOCLAW_GROUPS_AUTO_ACCEPT"`
+	ApprovalChat    string   `json:"approval_chat" env:"PICOCLAW_GROUPS_APPROVAL_CHAT"`
+}
+
+// BlocklistConfig limits how many messages a sender gets through a minute
+// and blocks senders who keep flooding. Over RateLimit messages a minute
+// (0 for no limit), the rest are dropped; going over it Strikes times
+// within an hour blocks the sender for BlockMinutes, twice as long for each
+// further block, and for good after PermanentAfter blocks (0 for never).
+// AlertChat ("channel:chat_id") is told of each automatic block. Operators
+// are never limited, and block and unblock senders with /admin block and
+// /admin unblock.
+type BlocklistConfig struct {
+	RateLimit      int    `json:"rate_limit" env:"PICOCLAW_BLOCKLIST_RATE_LIMIT"`
+	Strikes        int    `json:"strikes" env:"PICOCLAW_BLOCKLIST_STRIKES"`
+	BlockMinutes   int    `json:"block_minutes" env:"PICOCLAW_BLOCKLIST_BLOCK_MINUTES"`
+	PermanentAfter int    `json:"permanent_after" env:"PICOCLAW_BLOCKLIST_PERMANENT_AFTER"`
+	AlertChat      string `json:"alert_chat" env:"PICOCLAW_BLOCKLIST_ALERT_CHAT"`
+}
+
+// HistoryConfig controls the chat history log (workspace/history/
+// history.db). RetentionDays is the data-retention policy: older messages
+// are deleted, and 0 keeps them forever.
+type HistoryConfig struct {
+	Enabled       bool `json:"enabled" env:"PICOCLAW_HISTORY_ENABLED"`
+	RetentionDays int  `json:"retention_days" env:"PICOCLAW_HISTORY_RETENTION_DAYS"`
+}
+
+// StateConfig selects where runtime state (scheduled jobs, preference
+// memory, message dedup, allowlist grants) is kept. Backend is sqlite, bolt,
+// or redis. Path defaults to workspace/state/state.db, or state.bolt for
+// bolt.
+type StateConfig struct {
+	Backend     string `json:"backend" env:"PICOCLAW_STATE_BACKEND"`
+	Path        string `json:"path" env:"PICOCLAW_STATE_PATH"`
+	RedisURL    string `json:"redis_url" env:"PICOCLAW_STATE_REDIS_URL"`
+	RedisPrefix string `json:"redis_prefix" env:"PICOCLAW_STATE_REDIS_PREFIX"`
+}
+
+// HAConfig runs several gateways against one shared state store. Each
+// channel, and the scheduler for cron jobs and heartbeats, runs on the one
+// instance holding its lease; the others stand by and take over within
+// LeaseTTL seconds of the holder failing. InstanceID must be unique per
+// instance and defaults to "hostname:pid".
+type HAConfig struct {
+	Enabled    bool   `json:"enabled" env:"PICOCLAW_HA_ENABLED"`
+	InstanceID string `json:"instance_id" env:"PICOCLAW_HA_INSTANCE_ID"`
+	LeaseTTL   int    `json:"lease_ttl" env:"PICOCLAW_HA_LEASE_TTL"`
+}
+
+// BroadcastConfig names lists of chats to send announcements to. Entries
+// are "channel:chat_id". Sends on one channel are IntervalMS apart, to stay
+// under platform rate limits.
+type BroadcastConfig struct {
+	Lists      map[string][]string `json:"lists,omitempty"`
+	IntervalMS int                 `json:"interval_ms" env:"PICOCLAW_BROADCAST_INTERVAL_MS"`
+}
+
+// MediaConfig controls the media store. Attachments too large for a
+// channel, or sent to one that takes none, are copied into Dir (default
+// workspace/media) and sent as links under PublicURL, which must reach the
+// gateway's health endpoints. Links expire after LinkTTL hours.
+type MediaConfig struct {
+	Enabled   bool   `json:"enabled" env:"PICOCLAW_MEDIA_ENABLED"`
+	PublicURL string `json:"public_url" env:"PICOCLAW_MEDIA_PUBLIC_URL"`
+	Dir       string `json:"dir" env:"PICOCLAW_MEDIA_DIR"`
+	LinkTTL   int    `json:"link_ttl" env:"PICOCLAW_MEDIA_LINK_TTL"`
+}
+
+// WebhooksConfig posts gateway events as JSON to external URLs: messages
+// in and out, messages given up on after failed sends, channel state
+// changes, and the rest of the admin event stream. A failed post is tried
+// up to MaxRetries more times with growing delays.
+type WebhooksConfig struct {
+	Enabled    bool            `json:"enabled" env:"PICOCLAW_WEBHOOKS_ENABLED"`
+	Targets    []WebhookTarget `json:"targets,omitempty"`
+	MaxRetries int             `json:"max_retries" env:"PICOCLAW_WEBHOOKS_MAX_RETRIES"`
+}
+
+// WebhookTarget is one URL events are posted to. With Secret set each
+// post is signed with HMAC-SHA256 in the X-PicoClaw-Signature header.
+// Events limits the event types sent, e.g. ["inbound", "delivery_failed"];
+// empty sends all.
+type WebhookTarget struct {
+	URL    string   `json:"url"`
+	Secret string   `json:"secret,omitempty"`
+	Events []string `json:"events,omitempty"`
+}
+
+// TranslationConfig controls automatic translation. Messages in another
+// language are translated into Language (an ISO 639-1 code) before the
+// agent sees them, and replies are translated back. With APIBase set a
+// LibreTranslate-compatible API does the work; otherwise the model does.
+// Chats turns translation on or off per "channel:chat_id", overriding
+// Enabled; /translate overrides both for a chat.
+type TranslationConfig struct {
+	Enabled  bool            `json:"enabled" env:"PICOCLAW_TRANSLATION_ENABLED"`
+	Language string          `json:"language" env:"PICOCLAW_TRANSLATION_LANGUAGE"`
+	APIBase  string          `json:"api_base" env:"PICOCLAW_TRANSLATION_API_BASE"`
+	APIKey   string          `json:"api_key" env:"PICOCLAW_TRANSLATION_API_KEY"`
+	Chats    map[string]bool `json:"chats,omitempty"`
+}
+
+// ModelPrice is a model's cost in USD per million tokens.
+type ModelPrice struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+}
+
+// RAGConfig controls local document retrieval. Embeddings come from an
+// OpenAI-compatible endpoint; the default targets a local Ollama server so
+// documents never leave the device.
+type RAGConfig struct {
+	Enabled          bool   `json:"enabled" env:"PICOCLAW_RAG_ENABLED"`
+	DocumentsDir     string `json:"documents_dir" env:"PICOCLAW_RAG_DOCUMENTS_DIR"`
+	EmbeddingAPIBase string `json:"embedding_api_base" env:"PICOCLAW_RAG_EMBEDDING_API_BASE"`
+	EmbeddingAPIKey  string `json:"embedding_api_key" env:"PICOCLAW_RAG_EMBEDDING_API_KEY"`
+	EmbeddingModel   string `json:"embedding_model" env:"PICOCLAW_RAG_EMBEDDING_MODEL"`
+	ChunkSize        int    `json:"chunk_size" env:"PICOCLAW_RAG_CHUNK_SIZE"`
+	ChunkOverlap     int    `json:"chunk_overlap" env:"PICOCLAW_RAG_CHUNK_OVERLAP"`
+	TopK             int    `json:"top_k" env:"PICOCLAW_RAG_TOP_K"`
+	ScanInterval     int    `json:"scan_interval" env:"PICOCLAW_RAG_SCAN_INTERVAL"` // seconds
+	// AutoRetrieve searches the knowledge base before every answer and
+	// hands passages scoring at least MinScore to the model.
+	AutoRetrieve bool    `json:"auto_retrieve" env:"PICOCLAW_RAG_AUTO_RETRIEVE"`
+	MinScore     float64 `json:"min_score" env:"PICOCLAW_RAG_MIN_SCORE"`
 }
 
 type BraveConfig struct {
@@ -147,13 +715,87 @@ type DuckDuckGoConfig struct {
 	MaxResults int  `json:"max_results" env:"PICOCLAW_TOOLS_WEB_DUCKDUCKGO_MAX_RESULTS"`
 }
 
+type SearxNGConfig struct {
+	Enabled    bool   `json:"enabled" env:"PICOCLAW_TOOLS_WEB_SEARXNG_ENABLED"`
+	URL        string `json:"url" env:"PICOCLAW_TOOLS_WEB_SEARXNG_URL"`
+	MaxResults int    `json:"max_results" env:"PICOCLAW_TOOLS_WEB_SEARXNG_MAX_RESULTS"`
+}
+
 type WebToolsConfig struct {
+	SearxNG    SearxNGConfig    `json:"searxng"`
 	Brave      BraveConfig      `json:"brave"`
 	DuckDuckGo DuckDuckGoConfig `json:"duckduckgo"`
 }
 
+// ExecToolConfig controls the shell command tool. AllowPatterns, when set,
+// restricts commands to those matching at least one regular expression.
+// RequireApproval holds every command from a chat channel until the user
+// replies "/approve <id>".
+type ExecToolConfig struct {
+	AllowPatterns   FlexibleStringSlice `json:"allow_patterns" env:"PICOCLAW_TOOLS_EXEC_ALLOW_PATTERNS"`
+	RequireApproval bool                `json:"require_approval" env:"PICOCLAW_TOOLS_EXEC_REQUIRE_APPROVAL"`
+	Timeout         int                 `json:"timeout" env:"PICOCLAW_TOOLS_EXEC_TIMEOUT"` // seconds
+}
+
+// ImageGenConfig controls the generate_image tool. Provider is "openai",
+// "stability", or "sd" for a local AUTOMATIC1111 Stable Diffusion API.
+type ImageGenConfig struct {
+	Enabled  bool   `json:"enabled" env:"PICOCLAW_TOOLS_IMAGE_GEN_ENABLED"`
+	Provider string `json:"provider" env:"PICOCLAW_TOOLS_IMAGE_GEN_PROVIDER"`
+	APIKey   string `json:"api_key" env:"PICOCLAW_TOOLS_IMAGE_GEN_API_KEY"`
+	APIBase  string `json:"api_base" env:"PICOCLAW_TOOLS_IMAGE_GEN_API_BASE"`
+	Model    string `json:"model" env:"PICOCLAW_TOOLS_IMAGE_GEN_MODEL"`
+	Size     string `json:"size" env:"PICOCLAW_TOOLS_IMAGE_GEN_SIZE"`
+}
+
+// EmailConfig controls the email tool. Mail is sent through the SMTP
+// server (STARTTLS on 587, implicit TLS on 465). Contacts maps names the
+// user may say, such as "landlord", to addresses.
+type EmailConfig struct {
+	Enabled  bool              `json:"enabled" env:"PICOCLAW_TOOLS_EMAIL_ENABLED"`
+	SMTPHost string            `json:"smtp_host" env:"PICOCLAW_TOOLS_EMAIL_SMTP_HOST"`
+	SMTPPort int               `json:"smtp_port" env:"PICOCLAW_TOOLS_EMAIL_SMTP_PORT"`
+	Username string            `json:"username" env:"PICOCLAW_TOOLS_EMAIL_USERNAME"`
+	Password string            `json:"password" env:"PICOCLAW_TOOLS_EMAIL_PASSWORD"`
+	From     string            `json:"from" env:"PICOCLAW_TOOLS_EMAIL_FROM"`
+	Contacts map[string]string `json:"contacts,omitempty"`
+}
+
+// PresenceToolConfig controls the presence tool, offered only when a
+// channel that reports presence is enabled too. Only admin operators may
+// start or stop watching a contact.
+type PresenceToolConfig struct {
+	Enabled bool `json:"enabled" env:"PICOCLAW_TOOLS_PRESENCE_ENABLED"`
+}
+
+// HomeAssistantRule grants access to the entities matching Entities (globs
+// such as "light.*" or "lock.front_door"). Access is "read", "control", or
+// "none"; Senders limits the rule to "channel:sender_id" accounts.
+type HomeAssistantRule struct {
+	Entities []string `json:"entities"`
+	Access   string   `json:"access"`
+	Senders  []string `json:"senders,omitempty"`
+}
+
+// HomeAssistantConfig controls the home_assistant tool. Rules are checked in
+// order and the first match wins; entities no rule matches are off limits.
+// MQTTTopics are the topic filters the agent may publish to through Home
+// Assistant's MQTT integration.
+type HomeAssistantConfig struct {
+	Enabled    bool                `json:"enabled" env:"PICOCLAW_TOOLS_HOME_ASSISTANT_ENABLED"`
+	URL        string              `json:"url" env:"PICOCLAW_TOOLS_HOME_ASSISTANT_URL"`
+	Token      string              `json:"token" env:"PICOCLAW_TOOLS_HOME_ASSISTANT_TOKEN"`
+	Rules      []HomeAssistantRule `json:"rules,omitempty"`
+	MQTTTopics []string            `json:"mqtt_topics,omitempty"`
+}
+
 type ToolsConfig struct {
-	Web WebToolsConfig `json:"web"`
+	Web           WebToolsConfig      `json:"web"`
+	Exec          ExecToolConfig      `json:"exec"`
+	ImageGen      ImageGenConfig      `json:"image_gen"`
+	Email         EmailConfig         `json:"email"`
+	HomeAssistant HomeAssistantConfig `json:"home_assistant"`
+	Presence      PresenceToolConfig  `json:"presence"`
 }
 
 func DefaultConfig() *Config {
@@ -165,16 +807,33 @@ func DefaultConfig() *Config {
 				Provider:            "",
 				Model:               "gpt-5.3",
 				MaxTokens:           8192,
+				ContextWindow:       0,
+				ToolOutputReserve:   4096,
 				Temperature:         0.7,
 				MaxToolIterations:   20,
+				SummarizeThreshold:  20,
+				KeepRecentMessages:  4,
+				Vision:              false,
+				VisionMaxDimension:  1024,
+				ResponseCacheTTL:    0,
+				ResponseCacheSize:   500,
+				FallbackCooldown:    60,
+				FallbackTimeout:     0,
+				Locale:              "en",
+				MatchLanguage:       true,
 			},
 		},
 		Channels: ChannelsConfig{
 			WhatsApp: WhatsAppConfig{
-				Enabled:   false,
-				BridgeURL: "",
-				StorePath: "~/.picoclaw/whatsapp.db",
-				AllowFrom: FlexibleStringSlice{},
+				Enabled:     false,
+				BridgeURL:   "",
+				StorePath:   defaultWhatsAppStore,
+				Account:     "default",
+				AllowFrom:   FlexibleStringSlice{},
+				Workers:     4,
+				RejectCalls: true,
+				SendTyping:  true,
+				Chunking:    ChunkingConfig{DelayMS: 500},
 			},
 			Telegram: TelegramConfig{
 				Enabled:   false,
@@ -192,6 +851,31 @@ func DefaultConfig() *Config {
 				AppToken:  "",
 				AllowFrom: FlexibleStringSlice{},
 			},
+			Zulip: ZulipConfig{
+				Enabled:   false,
+				Site:      "",
+				Email:     "",
+				APIKey:    "",
+				AllowFrom: FlexibleStringSlice{},
+			},
+			Signal: SignalConfig{
+				Enabled:   false,
+				URL:       "",
+				Account:   "",
+				AllowFrom: FlexibleStringSlice{},
+			},
+			Twilio: TwilioConfig{
+				Enabled:   false,
+				AllowFrom: FlexibleStringSlice{},
+			},
+			MQTT: MQTTConfig{
+				Enabled:       false,
+				Broker:        "tcp://localhost:1883",
+				QoS:           1,
+				InboundTopic:  "picoclaw/in/+",
+				OutboundTopic: "picoclaw/out/{chat}",
+				AllowFrom:     FlexibleStringSlice{},
+			},
 		},
 		Providers: ProvidersConfig{
 			Anthropic:  ProviderConfig{},
@@ -201,13 +885,55 @@ func DefaultConfig() *Config {
 			VLLM:       ProviderConfig{},
 			Gemini:     ProviderConfig{},
 			Nvidia:     ProviderConfig{},
+			Ollama:     ProviderConfig{},
+			LlamaCpp:   ProviderConfig{},
 		},
 		Gateway: GatewayConfig{
-			Host: "0.0.0.0",
-			Port: 18790,
+			Host:            "0.0.0.0",
+			Port:            18790,
+			ShutdownTimeout: 30,
+			Health:          ContainerMode(),
+			Supervisor: SupervisorConfig{
+				Enabled:    true,
+				DownAfter:  300,
+				MaxBackoff: 600,
+				AlertAfter: 3,
+				AlertTo:    []string{},
+			},
+			CircuitBreaker: CircuitBreakerConfig{
+				Enabled:          true,
+				Failures:         5,
+				ProbeInterval:    30,
+				MaxProbeInterval: 600,
+			},
 		},
 		Tools: ToolsConfig{
+			Exec: ExecToolConfig{
+				AllowPatterns:   FlexibleStringSlice{},
+				RequireApproval: false,
+				Timeout:         60,
+			},
+			ImageGen: ImageGenConfig{
+				Enabled:  false,
+				Provider: "openai",
+				Model:    "gpt-image-1",
+				Size:     "1024x1024",
+			},
+			Email: EmailConfig{
+				Enabled:  false,
+				SMTPHost: "",
+				SMTPPort: 587,
+			},
+			HomeAssistant: HomeAssistantConfig{
+				Enabled: false,
+				URL:     "http://homeassistant.local:8123",
+			},
 			Web: WebToolsConfig{
+				SearxNG: SearxNGConfig{
+					Enabled:    false,
+					URL:        "",
+					MaxResults: 5,
+				},
 				Brave: BraveConfig{
 					Enabled:    false,
 					APIKey:     "",
@@ -219,6 +945,9 @@ func DefaultConfig() *Config {
 				},
 			},
 		},
+		Cron: CronConfig{
+			Jobs: []CronJobConfig{},
+		},
 		Heartbeat: HeartbeatConfig{
 			Enabled:  true,
 			Interval: 30, // default 30 minutes
@@ -227,31 +956,155 @@ func DefaultConfig() *Config {
 			Enabled:    false,
 			MonitorUSB: true,
 		},
+		Admin: AdminConfig{
+			Enabled:   false,
+			Host:      "127.0.0.1",
+			Port:      18791,
+			Token:     "",
+			Operators: []string{},
+		},
+		GRPC: GRPCConfig{
+			Enabled: false,
+			Host:    "127.0.0.1",
+			Port:    18792,
+		},
+		RAG: RAGConfig{
+			Enabled:          false,
+			DocumentsDir:     "",
+			EmbeddingAPIBase: "http://localhost:11434/v1",
+			EmbeddingModel:   "nomic-embed-text",
+			ChunkSize:        800,
+			ChunkOverlap:     100,
+			TopK:             4,
+			ScanInterval:     60,
+			AutoRetrieve:     true,
+			MinScore:         0.35,
+		},
+		Usage: UsageConfig{
+			Enabled:                true,
+			MonthlyBudgetPerUser:   0,
+			MonthlyBudgetPerChat:   0,
+			TranscriptionPerMinute: 0.00185,
+		},
+		Preferences: PreferencesConfig{
+			Enabled: true,
+		},
+		Contacts: ContactsConfig{
+			Enabled:   true,
+			SyncHours: 6,
+		},
+		History: HistoryConfig{
+			Enabled:       true,
+			RetentionDays: 90,
+		},
+		State: StateConfig{
+			Backend:     "sqlite",
+			RedisPrefix: "picoclaw:",
+		},
+		HA: HAConfig{
+			Enabled:  false,
+			LeaseTTL: 15,
+		},
+		Digest: DigestConfig{
+			Enabled:  false,
+			Schedule: "0 9,18 * * *",
+			MaxItems: 20,
+		},
+		Blocklist: BlocklistConfig{
+			RateLimit:      0,
+			Strikes:        3,
+			BlockMinutes:   60,
+			PermanentAfter: 3,
+		},
+		Broadcast: BroadcastConfig{
+			IntervalMS: 1000,
+		},
+		Media: MediaConfig{
+			Enabled: false,
+			LinkTTL: 72,
+		},
+		Webhooks: WebhooksConfig{
+			Enabled:    false,
+			MaxRetries: 5,
+		},
+		Translation: TranslationConfig{
+			Enabled:  false,
+			Language: "en",
+			APIBase:  "",
+			APIKey:   "",
+		},
 	}
 }
 
 func LoadConfig(path string) (*Config, error) {
 	cfg := DefaultConfig()
 
+	// Without a file, settings come from the environment alone
 	data, err := os.ReadFile(path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return cfg, nil
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, cfg); err != nil {
+			return nil, err
 		}
+	case !os.IsNotExist(err):
 		return nil, err
 	}
 
-	if err := json.Unmarshal(data, cfg); err != nil {
+	if err := env.Parse(cfg); err != nil {
 		return nil, err
 	}
 
-	if err := env.Parse(cfg); err != nil {
-		return nil, err
+	if cfg.Agents.Defaults.LocalMode {
+		cfg.applyLocalMode()
 	}
 
 	return cfg, nil
 }
 
+// Local mode defaults, sized for a 1-4B model served with a 4k context on
+// an embedded board.
+const (
+	LocalModel              = "qwen2.5:3b"
+	localContextWindow      = 4096
+	localMaxTokens          = 768
+	localToolOutputReserve  = 768
+	localMaxToolIterations  = 8
+	localSummarizeThreshold = 10
+	localKeepRecentMessages = 2
+)
+
+// applyLocalMode replaces agent settings still at their cloud defaults with
+// local mode defaults. Values the user changed are kept.
+func (c *Config) applyLocalMode() {
+	stock := DefaultConfig().Agents.Defaults
+	d := &c.Agents.Defaults
+
+	if d.Provider == "" {
+		d.Provider = "ollama"
+	}
+	if d.Model == stock.Model {
+		d.Model = LocalModel
+	}
+	if d.ContextWindow == stock.ContextWindow {
+		d.ContextWindow = localContextWindow
+	}
+	if d.MaxTokens == stock.MaxTokens {
+		d.MaxTokens = localMaxTokens
+	}
+	if d.ToolOutputReserve == stock.ToolOutputReserve {
+		d.ToolOutputReserve = localToolOutputReserve
+	}
+	if d.MaxToolIterations == stock.MaxToolIterations {
+		d.MaxToolIterations = localMaxToolIterations
+	}
+	if d.SummarizeThreshold == stock.SummarizeThreshold {
+		d.SummarizeThreshold = localSummarizeThreshold
+	}
+	if d.KeepRecentMessages == stock.KeepRecentMessages {
+		d.KeepRecentMessages = localKeepRecentMessages
+	}
+}
+
 func SaveConfig(path string, cfg *Config) error {
 	cfg.mu.RLock()
 	defer cfg.mu.RUnlock()
@@ -272,7 +1125,7 @@ func SaveConfig(path string, cfg *Config) error {
 func (c *Config) WorkspacePath() string {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	return expandHome(c.Agents.Defaults.Workspace)
+	return ExpandPath(c.Agents.Defaults.Workspace)
 }
 
 func (c *Config) GetAPIKey() string {
@@ -313,17 +1166,3 @@ func (c *Config) GetAPIBase() string {
 	}
 	return ""
 }
-
-func expandHome(path string) string {
-	if path == "" {
-		return path
-	}
-	if path[0] == '~' {
-		home, _ := os.UserHomeDir()
-		if len(path) > 1 && path[1] == '/' {
-			return home + path[1:]
-		}
-		return home
-	}
-	return path
-}
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -114,6 +116,11 @@ func TestDefaultConfig_Channels(t *testing.T) {
 	if cfg.Channels.Slack.Enabled {
 		t.Error("Slack should be disabled by default")
 	}
+
+	// WhatsApp shows typing but leaves messages unread unless asked to
+	if !cfg.Channels.WhatsApp.SendTyping || cfg.Channels.WhatsApp.SendReadReceipts {
+		t.Error("WhatsApp should send typing and no read receipts by default")
+	}
 }
 
 // TestDefaultConfig_WebTools verifies web tools config
@@ -162,3 +169,101 @@ func TestConfig_Complete(t *testing.T) {
 		t.Error("Heartbeat should be enabled by default")
 	}
 }
+
+// TestLoadConfig_LocalMode verifies local mode replaces stock defaults but
+// keeps values the user set
+func TestLoadConfig_LocalMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	data := `{"agents": {"defaults": {"local_mode": true, "max_tool_iterations": 5}}}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := cfg.Agents.Defaults
+	if d.Provider != "ollama" || d.Model != LocalModel {
+		t.Errorf("provider/model = %q/%q, want ollama/%s", d.Provider, d.Model, LocalModel)
+	}
+	if d.ContextWindow != localContextWindow || d.MaxTokens != localMaxTokens {
+		t.Errorf("context_window/max_tokens = %d/%d", d.ContextWindow, d.MaxTokens)
+	}
+	if d.MaxToolIterations != 5 {
+		t.Errorf("MaxToolIterations = %d, user value should be kept", d.MaxToolIterations)
+	}
+}
+
+// TestHomeDir verifies PICOCLAW_HOME moves the default paths
+func TestHomeDir(t *testing.T) {
+	t.Setenv("PICOCLAW_HOME", "/data")
+	userHome, _ := os.UserHomeDir()
+
+	tests := []struct {
+		path, want string
+	}{
+		{"~/.picoclaw/workspace", "/data/workspace"},
+		{"~/.picoclaw", "/data"},
+		{"~/.picoclawx/db", userHome + "/.picoclawx/db"},
+		{"~/other", userHome + "/other"},
+		{"/abs/path", "/abs/path"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := ExpandPath(tt.path); got != tt.want {
+			t.Errorf("ExpandPath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+	if got := DefaultConfig().WorkspacePath(); got != "/data/workspace" {
+		t.Errorf("WorkspacePath() = %q, want /data/workspace", got)
+	}
+}
+
+func TestWhatsAppSessionPath(t *testing.T) {
+	t.Setenv("PICOCLAW_HOME", "/data")
+	tests := []struct {
+		storePath, account string
+		want, wantDir      string
+	}{
+		{"", "", "/data/whatsapp/default/session.db", "/data/whatsapp"},
+		{"~/.picoclaw/whatsapp", "work", "/data/whatsapp/work/session.db", "/data/whatsapp"},
+		{"/srv/wa", "../../etc", "/srv/wa/etc/session.db", "/srv/wa"},
+		// Single session files from before accounts stay where they are
+		{"~/.picoclaw/whatsapp.db", "work", "/data/whatsapp.db", "/data"},
+	}
+	for _, tt := range tests {
+		cfg := WhatsAppConfig{StorePath: tt.storePath, Account: tt.account}
+		if got := cfg.SessionPath(); got != tt.want {
+			t.Errorf("SessionPath(%q, %q) = %q, want %q", tt.storePath, tt.account, got, tt.want)
+		}
+		if got := cfg.StoreDir(); got != tt.wantDir {
+			t.Errorf("StoreDir(%q) = %q, want %q", tt.storePath, got, tt.wantDir)
+		}
+	}
+	if got := DefaultConfig().Channels.WhatsApp.SessionPath(); got != "/data/whatsapp/default/session.db" {
+		t.Errorf("default SessionPath() = %q", got)
+	}
+}
+
+// TestContainerMode verifies container mode turns on the health endpoints
+// and that environment settings apply without a config file
+func TestContainerMode(t *testing.T) {
+	t.Setenv("PICOCLAW_CONTAINER", "")
+	if ContainerMode() || DefaultConfig().Gateway.Health {
+		t.Error("container mode should be off by default")
+	}
+
+	t.Setenv("PICOCLAW_CONTAINER", "1")
+	t.Setenv("PICOCLAW_GATEWAY_PORT", "9000")
+	cfg, err := LoadConfig(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.Gateway.Health {
+		t.Error("health endpoints should be on in container mode")
+	}
+	if cfg.Gateway.Port != 9000 {
+		t.Errorf("Gateway.Port = %d, environment should apply without a config file", cfg.Gateway.Port)
+	}
+}
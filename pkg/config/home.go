@@ -0,0 +1,91 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// defaultHomePrefix is how default paths refer to the home directory.
+const defaultHomePrefix = "~/.picoclaw"
+
+// HomeDir returns the directory holding config.json, auth.json, and by
+// default the workspace: $PICOCLAW_HOME, or ~/.picoclaw.
+func HomeDir() string {
+	if dir := os.Getenv("PICOCLAW_HOME"); dir != "" {
+		return expandUserHome(dir)
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".picoclaw")
+}
+
+// ContainerMode reports whether PICOCLAW_CONTAINER is set, as in the
+// Docker image. The gateway then serves health endpoints by default and
+// offers WhatsApp pairing QR codes over HTTP instead of drawing them in the
+// terminal.
+func ContainerMode() bool {
+	switch strings.ToLower(os.Getenv("PICOCLAW_CONTAINER")) {
+	case "", "0", "false", "no":
+		return false
+	default:
+		return true
+	}
+}
+
+// ExpandPath expands a leading "~". Paths under ~/.picoclaw follow
+// PICOCLAW_HOME, so the default locations move with the home directory,
+// e.g. onto a container volume.
+func ExpandPath(path string) string {
+	if rest, ok := strings.CutPrefix(path, defaultHomePrefix); ok && (rest == "" || rest[0] == '/') {
+		return HomeDir() + rest
+	}
+	return expandUserHome(path)
+}
+
+func expandUserHome(path string) string {
+	if path == "" {
+		return path
+	}
+	if path[0] == '~' {
+		home, _ := os.UserHomeDir()
+		if len(path) > 1 && path[1] == '/' {
+			return home + path[1:]
+		}
+		return home
+	}
+	return path
+}
+
+// defaultWhatsAppStore is where WhatsApp sessions are kept when store_path
+// is empty.
+const defaultWhatsAppStore = "~/.picoclaw/whatsapp"
+
+// LegacyStore reports whether StorePath names a single session file, as
+// before sessions were kept per account.
+func (c WhatsAppConfig) LegacyStore() bool {
+	return strings.HasSuffix(c.StorePath, ".db")
+}
+
+// StoreDir is the directory holding the accounts' sessions.
+func (c WhatsAppConfig) StoreDir() string {
+	switch {
+	case c.StorePath == "":
+		return ExpandPath(defaultWhatsAppStore)
+	case c.LegacyStore():
+		return filepath.Dir(ExpandPath(c.StorePath))
+	}
+	return ExpandPath(c.StorePath)
+}
+
+// SessionPath is the database holding the account's paired session:
+// <store_path>/<account>/session.db, or a legacy store_path as is.
+func (c WhatsAppConfig) SessionPath() string {
+	if c.LegacyStore() {
+		return ExpandPath(c.StorePath)
+	}
+	account := filepath.Base(filepath.Clean("/" + c.Account))
+	if account == "/" || account == "." {
+		account = "default"
+	}
+	return filepath.Join(c.StoreDir(), account, "session.db")
+}
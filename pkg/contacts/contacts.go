@@ -0,0 +1,260 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+// Package contacts keeps a directory of the people the bot knows on each
+// channel, from the messages they send and the channels' address books, so
+// "message Alice" can be resolved to a chat.
+package contacts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+// bucket holds contacts by "channel:id".
+const bucket = "contacts"
+
+// refreshInterval is how often an unchanged contact seen again is saved, to
+// keep Updated roughly current without a write per message.
+const refreshInterval = 24 * time.Hour
+
+// Contact is a person on one channel.
+type Contact struct {
+	Channel string `json:"channel"`
+	// ID is the user's ID on the channel, as in InboundMessage.SenderID
+	// without a Telegram username.
+	ID       string `json:"id"`
+	Name     string `json:"name,omitempty"`
+	Username string `json:"username,omitempty"`
+	// ChatID is the direct chat with the user, when known; messages sent
+	// there reach them.
+	ChatID string `json:"chat_id,omitempty"`
+	// Avatar is a URL of the user's picture, kept only when the policy
+	// allows.
+	Avatar  string    `json:"avatar,omitempty"`
+	Updated time.Time `json:"updated"`
+}
+
+func (c Contact) key() string {
+	return c.Channel + ":" + c.ID
+}
+
+// Policy is what the directory may store.
+type Policy struct {
+	// Avatars keeps profile picture URLs.
+	Avatars bool
+	// GroupMembers records people only seen in group chats, not just those
+	// who message the bot directly.
+	GroupMembers bool
+	// Exclude lists "channel:id" users never stored.
+	Exclude []string
+}
+
+// Directory is the contact directory, kept in the state store.
+type Directory struct {
+	store   state.Store
+	policy  Policy
+	exclude map[string]bool
+	now     func() time.Time
+}
+
+func New(store state.Store, policy Policy) *Directory {
+	exclude := make(map[string]bool, len(policy.Exclude))
+	for _, e := range policy.Exclude {
+		exclude[e] = true
+	}
+	return &Directory{store: store, policy: policy, exclude: exclude, now: time.Now}
+}
+
+// Update adds c, or merges it into the stored contact: fields c leaves
+// empty keep their value. Excluded users are not stored, and ones stored
+// before they were excluded are not returned.
+func (d *Directory) Update(ctx context.Context, c Contact) error {
+	if c.Channel == "" || c.ID == "" || d.exclude[c.key()] {
+		return nil
+	}
+	if !d.policy.Avatars {
+		c.Avatar = ""
+	}
+
+	var old Contact
+	err := state.GetJSON(ctx, d.store, bucket, c.key(), &old)
+	if err != nil && !errors.Is(err, state.ErrNotFound) {
+		return err
+	}
+	merged := old
+	merged.Channel, merged.ID = c.Channel, c.ID
+	setIf(&merged.Name, c.Name)
+	setIf(&merged.Username, c.Username)
+	setIf(&merged.ChatID, c.ChatID)
+	setIf(&merged.Avatar, c.Avatar)
+	if !d.policy.Avatars {
+		merged.Avatar = ""
+	}
+
+	now := d.now()
+	if err == nil && merged == old && now.Sub(old.Updated) < refreshInterval {
+		return nil
+	}
+	merged.Updated = now
+	return state.PutJSON(ctx, d.store, bucket, c.key(), merged)
+}
+
+func setIf(dst *string, src string) {
+	if src != "" {
+		*dst = src
+	}
+}
+
+// Get returns the contact with the given channel and ID.
+func (d *Directory) Get(ctx context.Context, channel, id string) (Contact, bool, error) {
+	var c Contact
+	err := state.GetJSON(ctx, d.store, bucket, channel+":"+id, &c)
+	if errors.Is(err, state.ErrNotFound) || d.exclude[channel+":"+id] {
+		return Contact{}, false, nil
+	}
+	if err != nil {
+		return Contact{}, false, err
+	}
+	return c, true, nil
+}
+
+// List returns every contact, by name.
+func (d *Directory) List(ctx context.Context) ([]Contact, error) {
+	entries, err := d.store.List(ctx, bucket)
+	if err != nil {
+		return nil, err
+	}
+	contacts := make([]Contact, 0, len(entries))
+	for _, data := range entries {
+		var c Contact
+		if json.Unmarshal(data, &c) == nil && !d.exclude[c.key()] {
+			contacts = append(contacts, c)
+		}
+	}
+	sort.Slice(contacts, func(i, j int) bool {
+		a, b := strings.ToLower(contacts[i].Name), strings.ToLower(contacts[j].Name)
+		if a != b {
+			return a < b
+		}
+		return contacts[i].key() < contacts[j].key()
+	})
+	return contacts, nil
+}
+
+// Forget removes a contact. It comes back if the user is seen again, unless
+// excluded.
+func (d *Directory) Forget(ctx context.Context, channel, id string) error {
+	return d.store.Delete(ctx, bucket, channel+":"+id)
+}
+
+// Resolve finds the contacts query names, on channel if not empty. query
+// is a name, username, or ID. Exact matches win over names containing
+// query, e.g. "Alice" finds "Alice Smith" only when no one is called just
+// Alice.
+func (d *Directory) Resolve(ctx context.Context, query, channel string) ([]Contact, error) {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if query == "" {
+		return nil, nil
+	}
+	all, err := d.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	handle := strings.TrimPrefix(query, "@")
+	var exact, partial []Contact
+	for _, c := range all {
+		if channel != "" && c.Channel != channel {
+			continue
+		}
+		name := strings.ToLower(c.Name)
+		switch {
+		case name == query || strings.ToLower(c.Username) == handle || strings.ToLower(c.ID) == query:
+			exact = append(exact, c)
+		case strings.Contains(name, query):
+			partial = append(partial, c)
+		}
+	}
+	if len(exact) > 0 {
+		return exact, nil
+	}
+	return partial, nil
+}
+
+// RecordInbound adds the sender of msg to the directory. It lets the
+// directory be installed as a bus.Recorder.
+func (d *Directory) RecordInbound(msg bus.InboundMessage) {
+	if constants.IsInternalChannel(msg.Channel) || msg.SenderID == "" {
+		return
+	}
+	md := msg.Metadata
+	direct := md["is_group"] != "true" && md["is_dm"] != "false"
+	if !direct && !d.policy.GroupMembers {
+		return
+	}
+
+	// Telegram sender IDs carry the username after a "|"
+	id, username, _ := strings.Cut(msg.SenderID, "|")
+	if u := md["username"]; u != "" {
+		username = u
+	}
+	c := Contact{Channel: msg.Channel, ID: id, Username: username, Avatar: md["avatar"]}
+	for _, key := range []string{"display_name", "user_name", "first_name", "sender_name"} {
+		if md[key] != "" {
+			c.Name = md[key]
+			break
+		}
+	}
+	if direct {
+		c.ChatID = msg.ChatID
+	}
+	if err := d.Update(context.Background(), c); err != nil {
+		logger.WarnCF("contacts", "Failed to record contact", map[string]interface{}{
+			"channel": msg.Channel,
+			"error":   err.Error(),
+		})
+	}
+}
+
+// RecordOutbound does nothing; contacts come from what users send.
+func (d *Directory) RecordOutbound(bus.OutboundMessage) {}
+
+// Sync adds the contacts list returns, from the channels' address books,
+// after delay and then every interval until ctx is done.
+func (d *Directory) Sync(ctx context.Context, list func(ctx context.Context) []Contact, delay, interval time.Duration) {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		n := 0
+		for _, c := range list(ctx) {
+			if err := d.Update(ctx, c); err != nil {
+				logger.WarnCF("contacts", "Failed to sync contact", map[string]interface{}{
+					"channel": c.Channel,
+					"error":   err.Error(),
+				})
+				continue
+			}
+			n++
+		}
+		logger.InfoCF("contacts", "Synced contacts", map[string]interface{}{"count": n})
+		timer.Reset(interval)
+	}
+}
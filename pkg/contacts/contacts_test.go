@@ -0,0 +1,142 @@
+package contacts
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+func TestRecordInbound(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy Policy
+		msg    bus.InboundMessage
+		want   *Contact
+	}{
+		{"telegram direct", Policy{}, bus.InboundMessage{Channel: "telegram", SenderID: "7|alice", ChatID: "7",
+			Metadata: map[string]string{"username": "alice", "first_name": "Alice", "is_group": "false"}},
+			&Contact{Channel: "telegram", ID: "7", Name: "Alice", Username: "alice", ChatID: "7"}},
+		{"group member skipped", Policy{}, bus.InboundMessage{Channel: "whatsapp", SenderID: "49@s.whatsapp.net", ChatID: "1@g.us",
+			Metadata: map[string]string{"user_name": "Bob", "is_group": "true"}}, nil},
+		{"group member recorded", Policy{GroupMembers: true}, bus.InboundMessage{Channel: "whatsapp", SenderID: "49@s.whatsapp.net", ChatID: "1@g.us",
+			Metadata: map[string]string{"user_name": "Bob", "is_group": "true"}},
+			&Contact{Channel: "whatsapp", ID: "49@s.whatsapp.net", Name: "Bob"}},
+		{"avatar dropped", Policy{}, bus.InboundMessage{Channel: "discord", SenderID: "5", ChatID: "D5",
+			Metadata: map[string]string{"display_name": "Carol", "avatar": "https://cdn/a.png", "is_dm": "true"}},
+			&Contact{Channel: "discord", ID: "5", Name: "Carol", ChatID: "D5"}},
+		{"avatar kept", Policy{Avatars: true}, bus.InboundMessage{Channel: "discord", SenderID: "5", ChatID: "D5",
+			Metadata: map[string]string{"display_name": "Carol", "avatar": "https://cdn/a.png", "is_dm": "true"}},
+			&Contact{Channel: "discord", ID: "5", Name: "Carol", ChatID: "D5", Avatar: "https://cdn/a.png"}},
+		{"excluded", Policy{Exclude: []string{"telegram:7"}}, bus.InboundMessage{Channel: "telegram", SenderID: "7", ChatID: "7"}, nil},
+		{"internal channel", Policy{}, bus.InboundMessage{Channel: "system", SenderID: "cron", ChatID: "telegram:7"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := New(state.NewMemoryStore(), tt.policy)
+			d.RecordInbound(tt.msg)
+			got, err := d.List(context.Background())
+			if err != nil {
+				t.Fatalf("List() error = %v", err)
+			}
+			if tt.want == nil {
+				if len(got) != 0 {
+					t.Errorf("recorded %+v, want nothing", got)
+				}
+				return
+			}
+			if len(got) != 1 {
+				t.Fatalf("recorded %+v, want one contact", got)
+			}
+			got[0].Updated = time.Time{}
+			if got[0] != *tt.want {
+				t.Errorf("recorded %+v, want %+v", got[0], *tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateMerges(t *testing.T) {
+	d := New(state.NewMemoryStore(), Policy{})
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	d.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	d.Update(ctx, Contact{Channel: "slack", ID: "U1", Name: "Alice Smith", Username: "alice", ChatID: "U1"})
+	now = now.Add(time.Hour)
+	d.Update(ctx, Contact{Channel: "slack", ID: "U1", ChatID: "D1"})
+
+	c, ok, err := d.Get(ctx, "slack", "U1")
+	if err != nil || !ok {
+		t.Fatalf("Get() = %v, %v", ok, err)
+	}
+	if c.Name != "Alice Smith" || c.Username != "alice" || c.ChatID != "D1" || !c.Updated.Equal(now) {
+		t.Errorf("merged contact = %+v", c)
+	}
+
+	// Seeing the same details again soon after does not write
+	now = now.Add(time.Hour)
+	d.Update(ctx, Contact{Channel: "slack", ID: "U1", Name: "Alice Smith"})
+	if c, _, _ := d.Get(ctx, "slack", "U1"); !c.Updated.Equal(now.Add(-time.Hour)) {
+		t.Errorf("Updated = %v, want unchanged", c.Updated)
+	}
+
+	if err := d.Forget(ctx, "slack", "U1"); err != nil {
+		t.Fatalf("Forget() error = %v", err)
+	}
+	if _, ok, _ := d.Get(ctx, "slack", "U1"); ok {
+		t.Error("contact still there after Forget()")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	d := New(state.NewMemoryStore(), Policy{})
+	ctx := context.Background()
+	for _, c := range []Contact{
+		{Channel: "telegram", ID: "7", Name: "Alice", Username: "ally"},
+		{Channel: "whatsapp", ID: "49@s.whatsapp.net", Name: "Alice Smith"},
+		{Channel: "slack", ID: "U2", Name: "Bob Alison"},
+		{Channel: "slack", ID: "U3", Name: "Dad"},
+	} {
+		if err := d.Update(ctx, c); err != nil {
+			t.Fatalf("Update() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		query   string
+		channel string
+		want    []string
+	}{
+		{"alice", "", []string{"7"}},
+		{"Alice", "whatsapp", []string{"49@s.whatsapp.net"}},
+		{"@ally", "", []string{"7"}},
+		{"ali", "", []string{"7", "49@s.whatsapp.net", "U2"}},
+		{"smith", "", []string{"49@s.whatsapp.net"}},
+		{"U3", "", []string{"U3"}},
+		{"carol", "", nil},
+		{" ", "", nil},
+	}
+	for _, tt := range tests {
+		found, err := d.Resolve(ctx, tt.query, tt.channel)
+		if err != nil {
+			t.Fatalf("Resolve(%q) error = %v", tt.query, err)
+		}
+		var got []string
+		for _, c := range found {
+			got = append(got, c.ID)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("Resolve(%q, %q) = %v, want %v", tt.query, tt.channel, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("Resolve(%q, %q) = %v, want %v", tt.query, tt.channel, got, tt.want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,146 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package contacts
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/commands"
+	"github.com/sipeed/picoclaw/pkg/i18n"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+const (
+	// seenBucket holds when users were last online by "channel:id".
+	seenBucket = "last_seen"
+	// optOutBucket holds the users who asked for their presence not to be
+	// recorded, by "channel:id".
+	optOutBucket = "presence_optout"
+)
+
+// Seen is when a user was last online, from the presence a channel
+// reports for watched users.
+type Seen struct {
+	Channel string `json:"channel"`
+	ID      string `json:"id"`
+	Online  bool   `json:"online"`
+	// LastSeen is when the user was last online: when they came online,
+	// if they still are.
+	LastSeen time.Time `json:"last_seen"`
+	Updated  time.Time `json:"updated"`
+}
+
+// RecordPresence stores a user's latest presence, unless they are excluded
+// or opted out. Install it with bus.MessageBus.OnPresence.
+func (d *Directory) RecordPresence(p bus.Presence) {
+	id := bus.NormalizeUserID(p.UserID)
+	if p.Channel == "" || id == "" || d.exclude[p.Channel+":"+id] {
+		return
+	}
+	ctx := context.Background()
+	if d.optedOut(ctx, p.Channel, id) {
+		return
+	}
+
+	now := d.now()
+	s := Seen{Channel: p.Channel, ID: id, Online: p.Online, LastSeen: now, Updated: now}
+	if !p.Online && !p.LastSeen.IsZero() {
+		s.LastSeen = p.LastSeen
+	}
+	if err := state.PutJSON(ctx, d.store, seenBucket, p.Channel+":"+id, s); err != nil {
+		logger.WarnCF("contacts", "Failed to record presence", map[string]interface{}{
+			"channel": p.Channel,
+			"error":   err.Error(),
+		})
+	}
+}
+
+// LastSeen returns when the user with the given channel and ID was last
+// online, if that was recorded.
+func (d *Directory) LastSeen(ctx context.Context, channel, id string) (Seen, bool, error) {
+	id = bus.NormalizeUserID(id)
+	var s Seen
+	if d.exclude[channel+":"+id] || d.optedOut(ctx, channel, id) {
+		return s, false, nil
+	}
+	err := state.GetJSON(ctx, d.store, seenBucket, channel+":"+id, &s)
+	if errors.Is(err, state.ErrNotFound) {
+		return Seen{}, false, nil
+	}
+	if err != nil {
+		return Seen{}, false, err
+	}
+	return s, true, nil
+}
+
+// SetPresenceOptOut stops or resumes recording a user's presence. Opting
+// out deletes what was recorded.
+func (d *Directory) SetPresenceOptOut(ctx context.Context, channel, id string, out bool) error {
+	key := channel + ":" + bus.NormalizeUserID(id)
+	if !out {
+		return d.store.Delete(ctx, optOutBucket, key)
+	}
+	if err := d.store.Put(ctx, optOutBucket, key, []byte(time.Now().Format(time.RFC3339))); err != nil {
+		return err
+	}
+	return d.store.Delete(ctx, seenBucket, key)
+}
+
+func (d *Directory) optedOut(ctx context.Context, channel, id string) bool {
+	_, err := d.store.Get(ctx, optOutBucket, channel+":"+bus.NormalizeUserID(id))
+	return err == nil
+}
+
+// Commands implements commands.Provider, letting users opt out of having
+// their presence recorded.
+func (d *Directory) Commands() []commands.Command {
+	return []commands.Command{{
+		Name:        "lastseen",
+		Usage:       "on|off",
+		Description: "Choose whether the bot records when you are online",
+		Handler:     d.lastSeenCommand,
+	}}
+}
+
+func (d *Directory) lastSeenCommand(ctx context.Context, req commands.Request) string {
+	msg := req.Msg
+	// Presence is reported for the phone number, whichever device or LID
+	// the message came from
+	id := bus.SenderUserID(msg)
+	if len(req.Args) != 1 {
+		status := i18n.T(msg.Channel, msg.ChatID, "lastseen.state_on")
+		if d.optedOut(ctx, msg.Channel, id) {
+			status = i18n.T(msg.Channel, msg.ChatID, "lastseen.state_off")
+		}
+		return i18n.T(msg.Channel, msg.ChatID, "lastseen.status", status)
+	}
+
+	var out bool
+	switch strings.ToLower(req.Args[0]) {
+	case "off":
+		out = true
+	case "on":
+	default:
+		return i18n.T(msg.Channel, msg.ChatID, "lastseen.usage")
+	}
+	if err := d.SetPresenceOptOut(ctx, msg.Channel, id, out); err != nil {
+		logger.WarnCF("contacts", "Failed to change presence opt-out", map[string]interface{}{
+			"channel": msg.Channel,
+			"error":   err.Error(),
+		})
+		return i18n.T(msg.Channel, msg.ChatID, "lastseen.failed")
+	}
+	if out {
+		return i18n.T(msg.Channel, msg.ChatID, "lastseen.off")
+	}
+	return i18n.T(msg.Channel, msg.ChatID, "lastseen.on")
+}
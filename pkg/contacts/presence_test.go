@@ -0,0 +1,93 @@
+package contacts
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/commands"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+func TestRecordPresence(t *testing.T) {
+	d := New(state.NewMemoryStore(), Policy{Exclude: []string{"whatsapp:7@s.whatsapp.net"}})
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	d.now = func() time.Time { return now }
+	ctx := context.Background()
+	mom := "4915@s.whatsapp.net"
+
+	d.RecordPresence(bus.Presence{Channel: "whatsapp", UserID: mom, Online: true})
+	if s, ok, _ := d.LastSeen(ctx, "whatsapp", mom); !ok || !s.Online || !s.LastSeen.Equal(now) {
+		t.Errorf("online: LastSeen() = %+v, %v", s, ok)
+	}
+
+	// Going offline keeps the time the platform reports, or now
+	reported := now.Add(-time.Minute)
+	now = now.Add(time.Hour)
+	d.RecordPresence(bus.Presence{Channel: "whatsapp", UserID: mom, LastSeen: reported})
+	if s, ok, _ := d.LastSeen(ctx, "whatsapp", mom); !ok || s.Online || !s.LastSeen.Equal(reported) {
+		t.Errorf("offline: LastSeen() = %+v, %v", s, ok)
+	}
+	d.RecordPresence(bus.Presence{Channel: "telegram", UserID: "9|dad"})
+	if s, ok, _ := d.LastSeen(ctx, "telegram", "9"); !ok || !s.LastSeen.Equal(now) {
+		t.Errorf("offline without time: LastSeen() = %+v, %v", s, ok)
+	}
+
+	d.RecordPresence(bus.Presence{Channel: "whatsapp", UserID: "7@s.whatsapp.net", Online: true})
+	if _, ok, _ := d.LastSeen(ctx, "whatsapp", "7@s.whatsapp.net"); ok {
+		t.Error("excluded user's presence was recorded")
+	}
+
+	// Opting out deletes what was recorded and stops recording
+	run := func(args ...string) string {
+		return d.lastSeenCommand(ctx, commands.Request{
+			Msg:  bus.InboundMessage{Channel: "whatsapp", SenderID: mom, ChatID: mom},
+			Name: "lastseen",
+			Args: args,
+		})
+	}
+	if got := run("off"); !strings.Contains(got, "no longer recorded") {
+		t.Errorf("/lastseen off = %q", got)
+	}
+	if _, ok, _ := d.LastSeen(ctx, "whatsapp", mom); ok {
+		t.Error("presence kept after opting out")
+	}
+	d.RecordPresence(bus.Presence{Channel: "whatsapp", UserID: mom, Online: true})
+	if _, ok, _ := d.LastSeen(ctx, "whatsapp", mom); ok {
+		t.Error("presence recorded after opting out")
+	}
+	if got := run(); !strings.Contains(got, "not recorded") {
+		t.Errorf("/lastseen = %q", got)
+	}
+	run("on")
+	d.RecordPresence(bus.Presence{Channel: "whatsapp", UserID: mom, Online: true})
+	if _, ok, _ := d.LastSeen(ctx, "whatsapp", mom); !ok {
+		t.Error("presence not recorded after opting back in")
+	}
+}
+
+func TestLastSeenOptOutFromOtherDevices(t *testing.T) {
+	d := New(state.NewMemoryStore(), Policy{})
+	ctx := context.Background()
+	mom := "4915@s.whatsapp.net"
+	run := func(msg bus.InboundMessage, args ...string) string {
+		msg.Channel, msg.ChatID = "whatsapp", msg.SenderID
+		return d.lastSeenCommand(ctx, commands.Request{Msg: msg, Name: "lastseen", Args: args})
+	}
+
+	// From a linked device
+	run(bus.InboundMessage{SenderID: "4915:3@s.whatsapp.net"}, "off")
+	d.RecordPresence(bus.Presence{Channel: "whatsapp", UserID: mom, Online: true})
+	if _, ok, _ := d.LastSeen(ctx, "whatsapp", mom); ok {
+		t.Error("presence recorded after opting out from a linked device")
+	}
+
+	// From a LID, with the phone number alongside
+	run(bus.InboundMessage{SenderID: "8877:3@lid", Metadata: map[string]string{"sender_pn": mom}}, "on")
+	d.RecordPresence(bus.Presence{Channel: "whatsapp", UserID: mom, Online: true})
+	if _, ok, _ := d.LastSeen(ctx, "whatsapp", mom); !ok {
+		t.Error("presence not recorded after opting back in from a LID")
+	}
+}
@@ -0,0 +1,166 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+// Package crash provides panic recovery for event handlers, bus consumers,
+// and channel goroutines. A recovered panic is logged as a structured crash
+// report and the failed component is restarted instead of killing the process.
+package crash
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+const maxStoredReports = 20
+
+// Report is a structured description of a recovered panic.
+type Report struct {
+	Component string            `json:"component"`
+	Panic     string            `json:"panic"`
+	Stack     string            `json:"stack"`
+	Context   map[string]string `json:"context,omitempty"`
+	Time      time.Time         `json:"time"`
+}
+
+var (
+	mu      sync.Mutex
+	reports []Report
+	total   int
+)
+
+// Recover must be deferred directly. If the surrounding function panics,
+// the panic is swallowed and a crash report is logged for component.
+// fields carries optional message context and must already be redacted
+// (see MessageContext).
+//
+//	defer crash.Recover("whatsapp", nil)
+func Recover(component string, fields map[string]string) {
+	if r := recover(); r != nil {
+		record(component, r, fields)
+	}
+}
+
+// Capture records an already-recovered panic value. It is for callers that
+// need to convert a panic into an error themselves:
+//
+//	defer func() {
+//		if r := recover(); r != nil {
+//			crash.Capture("cron", r, nil)
+//			err = fmt.Errorf("job panicked: %v", r)
+//		}
+//	}()
+func Capture(component string, r interface{}, fields map[string]string) {
+	record(component, r, fields)
+}
+
+// Go runs fn in a new goroutine with panic recovery. A panic ends fn
+// without taking the process down, but fn is not restarted.
+func Go(component string, fn func()) {
+	go func() {
+		defer Recover(component, nil)
+		fn()
+	}()
+}
+
+// Supervise runs fn until it returns normally or ctx is canceled. If fn
+// panics, the panic is reported and fn is restarted after a backoff that
+// doubles on consecutive panics (capped at one minute).
+func Supervise(ctx context.Context, component string, fn func(ctx context.Context)) {
+	backoff := time.Second
+	for {
+		if !runProtected(component, ctx, fn) {
+			return
+		}
+
+		logger.WarnCF("crash", "Restarting component after panic", map[string]interface{}{
+			"component": component,
+			"backoff":   backoff.String(),
+		})
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > time.Minute {
+			backoff = time.Minute
+		}
+	}
+}
+
+// runProtected calls fn and reports whether it panicked.
+func runProtected(component string, ctx context.Context, fn func(ctx context.Context)) (panicked bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			record(component, r, nil)
+			panicked = true
+		}
+	}()
+	fn(ctx)
+	return false
+}
+
+// MessageContext builds crash report context for a chat message. The message
+// content is never included verbatim; only its length is recorded.
+func MessageContext(channel, chatID, senderID, content string) map[string]string {
+	return map[string]string{
+		"channel":   channel,
+		"chat_id":   chatID,
+		"sender_id": senderID,
+		"content":   fmt.Sprintf("[redacted %d bytes]", len(content)),
+	}
+}
+
+// Reports returns the most recent crash reports, oldest first.
+func Reports() []Report {
+	mu.Lock()
+	defer mu.Unlock()
+	out := make([]Report, len(reports))
+	copy(out, reports)
+	return out
+}
+
+// Count returns the total number of panics recovered since startup.
+func Count() int {
+	mu.Lock()
+	defer mu.Unlock()
+	return total
+}
+
+func record(component string, r interface{}, fields map[string]string) {
+	report := Report{
+		Component: component,
+		Panic:     fmt.Sprintf("%v", r),
+		Stack:     string(debug.Stack()),
+		Context:   fields,
+		Time:      time.Now(),
+	}
+
+	mu.Lock()
+	total++
+	reports = append(reports, report)
+	if len(reports) > maxStoredReports {
+		reports = reports[len(reports)-maxStoredReports:]
+	}
+	mu.Unlock()
+
+	logFields := map[string]interface{}{
+		"component": component,
+		"panic":     report.Panic,
+		"stack":     report.Stack,
+	}
+	for k, v := range fields {
+		logFields["ctx_"+k] = v
+	}
+	logger.ErrorCF("crash", "Recovered from panic", logFields)
+}
@@ -0,0 +1,72 @@
+package crash
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRecoverSwallowsPanic(t *testing.T) {
+	before := Count()
+
+	func() {
+		defer Recover("test", MessageContext("whatsapp", "chat", "sender", "secret text"))
+		panic("boom")
+	}()
+
+	if Count() != before+1 {
+		t.Fatalf("Count() = %d, want %d", Count(), before+1)
+	}
+
+	reports := Reports()
+	last := reports[len(reports)-1]
+	if last.Component != "test" || last.Panic != "boom" {
+		t.Errorf("unexpected report: %+v", last)
+	}
+	if strings.Contains(last.Context["content"], "secret") {
+		t.Error("message content must be redacted in crash report")
+	}
+	if last.Stack == "" {
+		t.Error("expected stack trace in report")
+	}
+}
+
+func TestSuperviseRestartsAfterPanic(t *testing.T) {
+	var runs atomic.Int32
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		Supervise(ctx, "test", func(ctx context.Context) {
+			if runs.Add(1) == 1 {
+				panic("first run fails")
+			}
+		})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		t.Fatal("Supervise did not return after fn completed normally")
+	}
+
+	if runs.Load() != 2 {
+		t.Errorf("runs = %d, want 2", runs.Load())
+	}
+}
+
+func TestReportsAreBounded(t *testing.T) {
+	for i := 0; i < maxStoredReports+5; i++ {
+		func() {
+			defer Recover("bounded", nil)
+			panic(i)
+		}()
+	}
+	if got := len(Reports()); got != maxStoredReports {
+		t.Errorf("len(Reports()) = %d, want %d", got, maxStoredReports)
+	}
+}
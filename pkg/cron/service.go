@@ -3,15 +3,16 @@ package cron
 import (
 	"crypto/rand"
 	"encoding/hex"
-	"encoding/json"
 	"fmt"
 	"log"
-	"os"
-	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/adhocore/gronx"
+
+	"github.com/sipeed/picoclaw/pkg/crash"
+	"github.com/sipeed/picoclaw/pkg/state"
 )
 
 type CronSchedule struct {
@@ -57,21 +58,37 @@ type CronStore struct {
 
 type JobHandler func(job *CronJob) (string, error)
 
+// ConfigJobPrefix marks jobs defined in the config file. They are recreated
+// from config on every start and cannot be removed from chat.
+const ConfigJobPrefix = "config:"
+
+// ConfigJob is a scheduled prompt defined in the config file.
+type ConfigJob struct {
+	Name    string
+	Expr    string
+	TZ      string
+	Prompt  string
+	Channel string
+	ChatID  string
+}
+
+// CronService schedules jobs persisted in the state store, so reminders
+// survive restarts.
 type CronService struct {
-	storePath string
-	store     *CronStore
-	onJob     JobHandler
-	mu        sync.RWMutex
-	running   bool
-	stopChan  chan struct{}
-	gronx     *gronx.Gronx
+	state    state.Store
+	store    *CronStore
+	onJob    JobHandler
+	mu       sync.RWMutex
+	running  bool
+	stopChan chan struct{}
+	gronx    *gronx.Gronx
 }
 
-func NewCronService(storePath string, onJob JobHandler) *CronService {
+func NewCronService(store state.Store, onJob JobHandler) *CronService {
 	cs := &CronService{
-		storePath: storePath,
-		onJob:     onJob,
-		gronx:     gronx.New(),
+		state: store,
+		onJob: onJob,
+		gronx: gronx.New(),
 	}
 	// Initialize and load store on creation
 	cs.loadStore()
@@ -117,6 +134,13 @@ func (cs *CronService) Stop() {
 	}
 }
 
+// Close stops the scheduler. The state store belongs to the caller and is
+// left open.
+func (cs *CronService) Close() error {
+	cs.Stop()
+	return nil
+}
+
 func (cs *CronService) runLoop(stopChan chan struct{}) {
 	ticker := time.NewTicker(1 * time.Second)
 	defer ticker.Stop()
@@ -161,8 +185,10 @@ func (cs *CronService) checkJobs() {
 		}
 	}
 
-	if err := cs.saveStoreUnsafe(); err != nil {
-		log.Printf("[cron] failed to save store: %v", err)
+	if len(dueJobIDs) > 0 {
+		if err := cs.saveStoreUnsafe(); err != nil {
+			log.Printf("[cron] failed to save store: %v", err)
+		}
 	}
 
 	cs.mu.Unlock()
@@ -173,6 +199,22 @@ func (cs *CronService) checkJobs() {
 	}
 }
 
+// runJob invokes the job handler, converting a panic into an error so the
+// job's state is still recorded and the scheduler keeps running.
+func (cs *CronService) runJob(job *CronJob) (err error) {
+	if cs.onJob == nil {
+		return nil
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			crash.Capture("cron", r, map[string]string{"job_id": job.ID})
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	_, err = cs.onJob(job)
+	return err
+}
+
 func (cs *CronService) executeJobByID(jobID string) {
 	startTime := time.Now().UnixMilli()
 
@@ -192,10 +234,7 @@ func (cs *CronService) executeJobByID(jobID string) {
 		return
 	}
 
-	var err error
-	if cs.onJob != nil {
-		_, err = cs.onJob(callbackJob)
-	}
+	err := cs.runJob(callbackJob)
 
 	// Now acquire lock to update state
 	cs.mu.Lock()
@@ -263,8 +302,16 @@ func (cs *CronService) computeNextRun(schedule *CronSchedule, nowMS int64) *int6
 			return nil
 		}
 
-		// Use gronx to calculate next run time
+		// Use gronx to calculate next run time, in the schedule's zone if set
 		now := time.UnixMilli(nowMS)
+		if schedule.TZ != "" {
+			loc, err := time.LoadLocation(schedule.TZ)
+			if err != nil {
+				log.Printf("[cron] unknown time zone '%s': %v", schedule.TZ, err)
+				return nil
+			}
+			now = now.In(loc)
+		}
 		nextTime, err := gronx.NextTickAfter(schedule.Expr, now, false)
 		if err != nil {
 			log.Printf("[cron] failed to compute next run for expr '%s': %v", schedule.Expr, err)
@@ -278,13 +325,22 @@ func (cs *CronService) computeNextRun(schedule *CronSchedule, nowMS int64) *int6
 	return nil
 }
 
+// recomputeNextRuns refreshes next run times after a (re)start. One-time
+// jobs whose time passed while the service was down run right away instead
+// of being silently dropped.
 func (cs *CronService) recomputeNextRuns() {
 	now := time.Now().UnixMilli()
 	for i := range cs.store.Jobs {
 		job := &cs.store.Jobs[i]
-		if job.Enabled {
-			job.State.NextRunAtMS = cs.computeNextRun(&job.Schedule, now)
+		if !job.Enabled {
+			continue
+		}
+		if job.Schedule.Kind == "at" && job.Schedule.AtMS != nil && *job.Schedule.AtMS <= now && job.State.LastRunAtMS == nil {
+			due := now
+			job.State.NextRunAtMS = &due
+			continue
 		}
+		job.State.NextRunAtMS = cs.computeNextRun(&job.Schedule, now)
 	}
 }
 
@@ -318,29 +374,16 @@ func (cs *CronService) loadStore() error {
 		Jobs:    []CronJob{},
 	}
 
-	data, err := os.ReadFile(cs.storePath)
+	jobs, err := loadJobs(cs.state)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil
-		}
 		return err
 	}
-
-	return json.Unmarshal(data, cs.store)
+	cs.store.Jobs = jobs
+	return nil
 }
 
 func (cs *CronService) saveStoreUnsafe() error {
-	dir := filepath.Dir(cs.storePath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return err
-	}
-
-	data, err := json.MarshalIndent(cs.store, "", "  ")
-	if err != nil {
-		return err
-	}
-
-	return os.WriteFile(cs.storePath, data, 0644)
+	return saveJobs(cs.state, cs.store.Jobs)
 }
 
 func (cs *CronService) AddJob(name string, schedule CronSchedule, message string, deliver bool, channel, to string) (*CronJob, error) {
@@ -394,6 +437,98 @@ func (cs *CronService) UpdateJob(job *CronJob) error {
 	return fmt.Errorf("job not found")
 }
 
+// SyncConfigJobs makes the stored config jobs match defs: new definitions
+// are added, changed ones updated, and ones no longer in config removed.
+// The run state of unchanged jobs is kept.
+func (cs *CronService) SyncConfigJobs(defs []ConfigJob) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	now := time.Now().UnixMilli()
+	wanted := make(map[string]ConfigJob, len(defs))
+	for _, def := range defs {
+		if def.Name == "" || def.Expr == "" || def.Prompt == "" {
+			return fmt.Errorf("cron job %q: name, schedule, and prompt are required", def.Name)
+		}
+		if err := validateCronSchedule(def.Expr, def.TZ); err != nil {
+			return fmt.Errorf("cron job %q: %w", def.Name, err)
+		}
+		wanted[ConfigJobPrefix+def.Name] = def
+	}
+
+	jobs := make([]CronJob, 0, len(cs.store.Jobs)+len(defs))
+	for _, job := range cs.store.Jobs {
+		if !IsConfigJob(job.ID) {
+			jobs = append(jobs, job)
+			continue
+		}
+		def, ok := wanted[job.ID]
+		if !ok {
+			continue
+		}
+		delete(wanted, job.ID)
+
+		schedule := CronSchedule{Kind: "cron", Expr: def.Expr, TZ: def.TZ}
+		if job.Schedule != schedule || job.Payload.Message != def.Prompt ||
+			job.Payload.Channel != def.Channel || job.Payload.To != def.ChatID {
+			job.Schedule = schedule
+			job.Payload = configPayload(def)
+			job.State.NextRunAtMS = cs.computeNextRun(&schedule, now)
+			job.UpdatedAtMS = now
+		}
+		jobs = append(jobs, job)
+	}
+
+	for _, def := range defs {
+		id := ConfigJobPrefix + def.Name
+		if _, ok := wanted[id]; !ok {
+			continue
+		}
+		schedule := CronSchedule{Kind: "cron", Expr: def.Expr, TZ: def.TZ}
+		jobs = append(jobs, CronJob{
+			ID:          id,
+			Name:        def.Name,
+			Enabled:     true,
+			Schedule:    schedule,
+			Payload:     configPayload(def),
+			State:       CronJobState{NextRunAtMS: cs.computeNextRun(&schedule, now)},
+			CreatedAtMS: now,
+			UpdatedAtMS: now,
+		})
+	}
+
+	cs.store.Jobs = jobs
+	return cs.saveStoreUnsafe()
+}
+
+// IsConfigJob reports whether jobID belongs to a config-defined job.
+func IsConfigJob(jobID string) bool {
+	return strings.HasPrefix(jobID, ConfigJobPrefix)
+}
+
+func configPayload(def ConfigJob) CronPayload {
+	return CronPayload{
+		Kind:    "agent_turn",
+		Message: def.Prompt,
+		Deliver: false,
+		Channel: def.Channel,
+		To:      def.ChatID,
+	}
+}
+
+// validateCronSchedule checks a cron expression and optional time zone.
+func validateCronSchedule(expr, tz string) error {
+	if !gronx.New().IsValid(expr) {
+		return fmt.Errorf("invalid cron expression %q", expr)
+	}
+	if tz != "" {
+		if _, err := time.LoadLocation(tz); err != nil {
+			return fmt.Errorf("unknown time zone %q", tz)
+		}
+	}
+	return nil
+}
+
 func (cs *CronService) RemoveJob(jobID string) bool {
 	cs.mu.Lock()
 	defer cs.mu.Unlock()
@@ -0,0 +1,218 @@
+package cron
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+func openState(t *testing.T, path string) *state.SQLiteStore {
+	t.Helper()
+	s, err := state.OpenSQLite(path)
+	if err != nil {
+		t.Fatalf("OpenSQLite() error: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestCronService_PersistsAcrossRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+
+	store := openState(t, path)
+	cs := NewCronService(store, nil)
+	atMS := time.Now().Add(time.Hour).UnixMilli()
+	job, err := cs.AddJob("dentist", CronSchedule{Kind: "at", AtMS: &atMS}, "Call the dentist", true, "telegram", "42")
+	if err != nil {
+		t.Fatalf("AddJob() error: %v", err)
+	}
+	cs.Close()
+	store.Close()
+
+	store = openState(t, path)
+	reopened := NewCronService(store, nil)
+	defer reopened.Close()
+
+	jobs := reopened.ListJobs(true)
+	if len(jobs) != 1 {
+		t.Fatalf("len(jobs) = %d, want 1", len(jobs))
+	}
+	got := jobs[0]
+	if got.ID != job.ID || got.Payload.Channel != "telegram" || got.Payload.To != "42" || got.Payload.Message != "Call the dentist" {
+		t.Errorf("reloaded job = %+v", got)
+	}
+	if got.Schedule.AtMS == nil || *got.Schedule.AtMS != atMS {
+		t.Errorf("Schedule.AtMS = %v, want %d", got.Schedule.AtMS, atMS)
+	}
+
+	if !reopened.RemoveJob(job.ID) {
+		t.Fatal("RemoveJob() = false")
+	}
+	reopened.Close()
+
+	again := NewCronService(store, nil)
+	defer again.Close()
+	if n := len(again.ListJobs(true)); n != 0 {
+		t.Errorf("len(jobs) after remove = %d, want 0", n)
+	}
+}
+
+func TestCronService_ImportsLegacyJSON(t *testing.T) {
+	dir := t.TempDir()
+	legacy := `{"version":1,"jobs":[{"id":"abc","name":"water","enabled":true,
+		"schedule":{"kind":"every","everyMs":60000},
+		"payload":{"kind":"agent_turn","message":"Water the plants","deliver":true,"channel":"discord","to":"7"},
+		"state":{},"createdAtMs":1,"updatedAtMs":1,"deleteAfterRun":false}]}`
+	if err := os.WriteFile(filepath.Join(dir, "jobs.json"), []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	store := state.NewMemoryStore()
+	if err := ImportLegacyJobs(store, dir); err != nil {
+		t.Fatalf("ImportLegacyJobs() error: %v", err)
+	}
+	cs := NewCronService(store, nil)
+	defer cs.Close()
+
+	jobs := cs.ListJobs(true)
+	if len(jobs) != 1 || jobs[0].ID != "abc" || jobs[0].Payload.Channel != "discord" {
+		t.Fatalf("imported jobs = %+v", jobs)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "jobs.json.migrated")); err != nil {
+		t.Errorf("legacy file not renamed: %v", err)
+	}
+}
+
+func TestCronService_ImportsLegacyDB(t *testing.T) {
+	dir := t.TempDir()
+	db, err := sql.Open("sqlite", "file:"+filepath.Join(dir, "jobs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`CREATE TABLE jobs (id TEXT PRIMARY KEY, name TEXT NOT NULL, enabled INTEGER NOT NULL,
+		schedule TEXT NOT NULL, payload TEXT NOT NULL, state TEXT NOT NULL, created_at_ms INTEGER NOT NULL,
+		updated_at_ms INTEGER NOT NULL, delete_after_run INTEGER NOT NULL);
+		INSERT INTO jobs VALUES ('abc', 'water', 1, '{"kind":"every","everyMs":60000}',
+		'{"kind":"agent_turn","message":"Water the plants","deliver":true,"channel":"discord","to":"7"}', '{}', 1, 1, 0);`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := state.NewMemoryStore()
+	if err := ImportLegacyJobs(store, dir); err != nil {
+		t.Fatalf("ImportLegacyJobs() error: %v", err)
+	}
+	jobs := NewCronService(store, nil).ListJobs(true)
+	if len(jobs) != 1 || jobs[0].ID != "abc" || jobs[0].Schedule.EveryMS == nil || jobs[0].Payload.To != "7" {
+		t.Fatalf("imported jobs = %+v", jobs)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "jobs.db.migrated")); err != nil {
+		t.Errorf("legacy database not renamed: %v", err)
+	}
+}
+
+func TestCronService_MissedOneTimeJobRunsOnStart(t *testing.T) {
+	store := state.NewMemoryStore()
+
+	cs := NewCronService(store, nil)
+	atMS := time.Now().Add(time.Hour).UnixMilli()
+	job, err := cs.AddJob("late", CronSchedule{Kind: "at", AtMS: &atMS}, "late", true, "slack", "C1")
+	if err != nil {
+		t.Fatalf("AddJob() error: %v", err)
+	}
+	// Simulate the reminder time passing while the service was down.
+	past := time.Now().Add(-time.Minute).UnixMilli()
+	job.Schedule.AtMS = &past
+	if err := cs.UpdateJob(job); err != nil {
+		t.Fatalf("UpdateJob() error: %v", err)
+	}
+	cs.Close()
+
+	ran := make(chan string, 1)
+	restarted := NewCronService(store, func(j *CronJob) (string, error) {
+		ran <- j.ID
+		return "ok", nil
+	})
+	defer restarted.Close()
+	if err := restarted.Start(); err != nil {
+		t.Fatalf("Start() error: %v", err)
+	}
+
+	select {
+	case id := <-ran:
+		if id != job.ID {
+			t.Errorf("ran job %s, want %s", id, job.ID)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("missed one-time job did not run after restart")
+	}
+}
+
+func TestComputeNextRun_CronTimeZone(t *testing.T) {
+	cs := &CronService{}
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	next := cs.computeNextRun(&CronSchedule{Kind: "cron", Expr: "0 9 * * *", TZ: "Asia/Tokyo"}, now.UnixMilli())
+	if next == nil {
+		t.Fatal("computeNextRun() = nil")
+	}
+	want := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC) // 09:00 JST
+	if got := time.UnixMilli(*next).UTC(); !got.Equal(want) {
+		t.Errorf("next run = %v, want %v", got, want)
+	}
+}
+
+func TestCronService_SyncConfigJobs(t *testing.T) {
+	cs := NewCronService(state.NewMemoryStore(), nil)
+	defer cs.Close()
+
+	atMS := time.Now().Add(time.Hour).UnixMilli()
+	if _, err := cs.AddJob("chat reminder", CronSchedule{Kind: "at", AtMS: &atMS}, "hi", true, "telegram", "1"); err != nil {
+		t.Fatalf("AddJob() error: %v", err)
+	}
+
+	defs := []ConfigJob{
+		{Name: "briefing", Expr: "0 7 * * *", Prompt: "Summarize my unread email", Channel: "telegram", ChatID: "1"},
+		{Name: "report", Expr: "0 18 * * 5", TZ: "Europe/Berlin", Prompt: "Weekly report", Channel: "slack", ChatID: "C1"},
+	}
+	if err := cs.SyncConfigJobs(defs); err != nil {
+		t.Fatalf("SyncConfigJobs() error: %v", err)
+	}
+	if n := len(cs.ListJobs(true)); n != 3 {
+		t.Fatalf("len(jobs) = %d, want 3", n)
+	}
+
+	// Drop one definition and change the other.
+	defs = []ConfigJob{
+		{Name: "briefing", Expr: "30 7 * * *", Prompt: "Summarize my unread email", Channel: "telegram", ChatID: "1"},
+	}
+	if err := cs.SyncConfigJobs(defs); err != nil {
+		t.Fatalf("SyncConfigJobs() error: %v", err)
+	}
+
+	jobs := cs.ListJobs(true)
+	if len(jobs) != 2 {
+		t.Fatalf("len(jobs) = %d, want 2", len(jobs))
+	}
+	var briefing *CronJob
+	for i := range jobs {
+		if jobs[i].ID == ConfigJobPrefix+"briefing" {
+			briefing = &jobs[i]
+		}
+	}
+	if briefing == nil {
+		t.Fatal("briefing job missing")
+	}
+	if briefing.Schedule.Expr != "30 7 * * *" || briefing.Payload.Deliver {
+		t.Errorf("briefing = %+v", briefing)
+	}
+
+	if err := cs.SyncConfigJobs([]ConfigJob{{Name: "bad", Expr: "not cron", Prompt: "x"}}); err == nil {
+		t.Error("expected error for invalid cron expression")
+	}
+}
@@ -0,0 +1,144 @@
+package cron
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/sipeed/picoclaw/pkg/state"
+
+	_ "modernc.org/sqlite"
+)
+
+// jobsBucket is the state store bucket holding one JSON job per ID.
+const jobsBucket = "cron_jobs"
+
+func loadJobs(store state.Store) ([]CronJob, error) {
+	entries, err := store.List(context.Background(), jobsBucket)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make([]CronJob, 0, len(entries))
+	for id, data := range entries {
+		var job CronJob
+		if err := json.Unmarshal(data, &job); err != nil {
+			return nil, fmt.Errorf("job %s: %w", id, err)
+		}
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		if jobs[i].CreatedAtMS != jobs[j].CreatedAtMS {
+			return jobs[i].CreatedAtMS < jobs[j].CreatedAtMS
+		}
+		return jobs[i].ID < jobs[j].ID
+	})
+	return jobs, nil
+}
+
+// saveJobs replaces the stored jobs with jobs.
+func saveJobs(store state.Store, jobs []CronJob) error {
+	ctx := context.Background()
+	existing, err := store.List(ctx, jobsBucket)
+	if err != nil {
+		return err
+	}
+
+	for _, job := range jobs {
+		if err := state.PutJSON(ctx, store, jobsBucket, job.ID, job); err != nil {
+			return err
+		}
+		delete(existing, job.ID)
+	}
+	for id := range existing {
+		if err := store.Delete(ctx, jobsBucket, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ImportLegacyJobs copies jobs kept by older versions in dir, either the
+// SQLite jobs.db or the even older jobs.json, into an empty store. The
+// imported file is renamed with a ".migrated" suffix.
+func ImportLegacyJobs(store state.Store, dir string) error {
+	existing, err := store.List(context.Background(), jobsBucket)
+	if err != nil || len(existing) > 0 {
+		return err
+	}
+
+	dbPath := filepath.Join(dir, "jobs.db")
+	if _, err := os.Stat(dbPath); err == nil {
+		jobs, err := readLegacyDB(dbPath)
+		if err != nil {
+			return err
+		}
+		if err := saveJobs(store, jobs); err != nil {
+			return err
+		}
+		log.Printf("[cron] imported %d jobs from %s", len(jobs), dbPath)
+		os.Remove(dbPath + "-wal")
+		os.Remove(dbPath + "-shm")
+		return os.Rename(dbPath, dbPath+".migrated")
+	}
+
+	jsonPath := filepath.Join(dir, "jobs.json")
+	data, err := os.ReadFile(jsonPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	var legacy CronStore
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return err
+	}
+	if err := saveJobs(store, legacy.Jobs); err != nil {
+		return err
+	}
+	log.Printf("[cron] imported %d jobs from %s", len(legacy.Jobs), jsonPath)
+	return os.Rename(jsonPath, jsonPath+".migrated")
+}
+
+// readLegacyDB reads the jobs table of a SQLite jobs.db.
+func readLegacyDB(path string) ([]CronJob, error) {
+	db, err := sql.Open("sqlite", "file:"+path)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT id, name, enabled, schedule, payload, state, created_at_ms, updated_at_ms, delete_after_run
+		FROM jobs`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []CronJob
+	for rows.Next() {
+		var job CronJob
+		var schedule, payload, jobState string
+		if err := rows.Scan(&job.ID, &job.Name, &job.Enabled, &schedule, &payload, &jobState,
+			&job.CreatedAtMS, &job.UpdatedAtMS, &job.DeleteAfterRun); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(schedule), &job.Schedule); err != nil {
+			return nil, fmt.Errorf("job %s: bad schedule: %w", job.ID, err)
+		}
+		if err := json.Unmarshal([]byte(payload), &job.Payload); err != nil {
+			return nil, fmt.Errorf("job %s: bad payload: %w", job.ID, err)
+		}
+		if err := json.Unmarshal([]byte(jobState), &job.State); err != nil {
+			return nil, fmt.Errorf("job %s: bad state: %w", job.ID, err)
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
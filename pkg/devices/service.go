@@ -7,6 +7,7 @@ import (
 
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/crash"
 	"github.com/sipeed/picoclaw/pkg/devices/events"
 	"github.com/sipeed/picoclaw/pkg/devices/sources"
 	"github.com/sipeed/picoclaw/pkg/logger"
@@ -105,6 +106,8 @@ func (s *Service) handleEvents(kind events.Kind, eventCh <-chan *events.DeviceEv
 }
 
 func (s *Service) sendNotification(ev *events.DeviceEvent) {
+	defer crash.Recover("devices", nil)
+
 	s.mu.RLock()
 	msgBus := s.bus
 	s.mu.RUnlock()
@@ -128,9 +131,10 @@ func (s *Service) sendNotification(ev *events.DeviceEvent) {
 
 	msg := ev.FormatMessage()
 	msgBus.PublishOutbound(bus.OutboundMessage{
-		Channel: platform,
-		ChatID:  userID,
-		Content: msg,
+		Channel:  platform,
+		ChatID:   userID,
+		Content:  msg,
+		Priority: bus.PriorityLow,
 	})
 
 	logger.InfoCF("devices", "Device notification sent", map[string]interface{}{
@@ -0,0 +1,231 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+// Package events fans live gateway activity (messages in and out, errors,
+// security decisions) out to subscribers such as the admin event stream.
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// Event types.
+const (
+	TypeInbound  = "inbound"
+	TypeOutbound = "outbound"
+	TypeChat     = "chat"
+	TypeError    = "error"
+	TypeSecurity = "security"
+	// TypeChannel is a channel changing state; Message is the new state.
+	TypeChannel = "channel"
+	// TypeDeliveryFailed is a message given up on after failed sends;
+	// Message is the last error.
+	TypeDeliveryFailed = "delivery_failed"
+	// TypeInteraction is a user pressing a button or picking a quick
+	// reply or menu option.
+	TypeInteraction = "interaction"
+	// TypeDropped is an inbound message a channel did not pass on;
+	// Message is why: "filter", "awaiting_approval", or "duplicate".
+	// Senders off the allowlist are security events instead.
+	TypeDropped = "dropped"
+	// TypeChannelFailing is a channel the supervisor could not keep up;
+	// Message is its state. Fields "restarts" counts the attempts in a
+	// row, and "recovered" is true once it has stayed up again.
+	TypeChannelFailing = "channel_failing"
+)
+
+// Event is one piece of live activity.
+type Event struct {
+	Time      time.Time              `json:"time"`
+	Type      string                 `json:"type"`
+	Component string                 `json:"component,omitempty"`
+	Message   string                 `json:"message,omitempty"`
+	Channel   string                 `json:"channel,omitempty"`
+	ChatID    string                 `json:"chat_id,omitempty"`
+	SenderID  string                 `json:"sender_id,omitempty"`
+	Content   string                 `json:"content,omitempty"`
+	Fields    map[string]interface{} `json:"fields,omitempty"`
+}
+
+// Hub delivers published events to every subscriber. Publishing never
+// blocks: a subscriber whose buffer is full misses events instead of
+// stalling the gateway.
+type Hub struct {
+	mu   sync.RWMutex
+	subs map[chan Event]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{subs: make(map[chan Event]struct{})}
+}
+
+// Subscribe returns a channel of events and a function that ends the
+// subscription and closes the channel.
+func (h *Hub) Subscribe(buffer int) (<-chan Event, func()) {
+	ch := make(chan Event, buffer)
+	h.mu.Lock()
+	h.subs[ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subs, ch)
+			h.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Publish sends e to every subscriber that has room for it.
+func (h *Hub) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for ch := range h.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// RecordInbound publishes an inbound message; it makes Hub a bus.Recorder.
+func (h *Hub) RecordInbound(msg bus.InboundMessage) {
+	if constants.IsInternalChannel(msg.Channel) {
+		return
+	}
+	e := Event{
+		Type:     TypeInbound,
+		Channel:  msg.Channel,
+		ChatID:   msg.ChatID,
+		SenderID: msg.SenderID,
+		Content:  msg.Content,
+	}
+	e.Fields = traceFields(msg.TraceID, msg.ParentID)
+	if msg.CorrelationID != "" {
+		e.Fields["correlation_id"] = msg.CorrelationID
+	}
+	if len(e.Fields) == 0 {
+		e.Fields = nil
+	}
+	h.Publish(e)
+}
+
+// RecordOutbound publishes a message sent to a chat.
+func (h *Hub) RecordOutbound(msg bus.OutboundMessage) {
+	if constants.IsInternalChannel(msg.Channel) {
+		return
+	}
+	e := Event{
+		Type:    TypeOutbound,
+		Channel: msg.Channel,
+		ChatID:  msg.ChatID,
+		Content: msg.Content,
+	}
+	e.Fields = traceFields(msg.TraceID, msg.ParentID)
+	if len(msg.CorrelationIDs) > 0 {
+		e.Fields["correlation_ids"] = msg.CorrelationIDs
+	}
+	if len(e.Fields) == 0 {
+		e.Fields = nil
+	}
+	h.Publish(e)
+}
+
+// traceFields returns a message's trace as event fields.
+func traceFields(traceID, parentID string) map[string]interface{} {
+	fields := make(map[string]interface{}, 3)
+	if traceID != "" {
+		fields["trace_id"] = traceID
+	}
+	if parentID != "" {
+		fields["parent_id"] = parentID
+	}
+	return fields
+}
+
+// RecordChatEvent publishes a change to a chat, such as members joining.
+// Install it with bus.MessageBus.OnChatEvent.
+func (h *Hub) RecordChatEvent(e bus.ChatEvent) {
+	fields := map[string]interface{}{"event": e.Type}
+	if len(e.Members) > 0 {
+		ids := make([]string, len(e.Members))
+		for i, m := range e.Members {
+			ids[i] = m.ID
+		}
+		fields["members"] = ids
+	}
+	if e.ActorID != "" {
+		fields["actor_id"] = e.ActorID
+	}
+	if e.Name != "" {
+		fields["name"] = e.Name
+	}
+	h.Publish(Event{
+		Type:    TypeChat,
+		Channel: e.Channel,
+		ChatID:  e.ChatID,
+		Fields:  fields,
+	})
+}
+
+// RecordInteraction publishes a user's answer to a message's buttons,
+// quick replies, or menu. Install it with bus.MessageBus.OnInteraction.
+func (h *Hub) RecordInteraction(i bus.Interaction) {
+	fields := map[string]interface{}{"kind": i.Kind, "data": i.Data}
+	if i.MessageID != "" {
+		fields["message_id"] = i.MessageID
+	}
+	h.Publish(Event{
+		Type:     TypeInteraction,
+		Channel:  i.Channel,
+		ChatID:   i.ChatID,
+		SenderID: i.SenderID,
+		Fields:   fields,
+	})
+}
+
+// HandleLog publishes error log entries. Install it with logger.AddHook.
+func (h *Hub) HandleLog(entry logger.LogEntry) {
+	if entry.Level != "ERROR" && entry.Level != "FATAL" {
+		return
+	}
+	h.Publish(Event{
+		Type:      TypeError,
+		Component: entry.Component,
+		Message:   entry.Message,
+		Fields:    entry.Fields,
+	})
+}
+
+// Default is the process-wide hub the gateway streams from.
+var Default = NewHub()
+
+// Publish sends e to the default hub.
+func Publish(e Event) {
+	Default.Publish(e)
+}
+
+// Security logs a security decision, such as a rejected sender or a blocked
+// command, and publishes it to the default hub.
+func Security(component, message string, fields map[string]interface{}) {
+	logger.WarnCF(component, message, fields)
+	Default.Publish(Event{
+		Type:      TypeSecurity,
+		Component: component,
+		Message:   message,
+		Fields:    fields,
+	})
+}
@@ -0,0 +1,86 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+func TestHubPublish(t *testing.T) {
+	h := NewHub()
+	a, cancelA := h.Subscribe(4)
+	b, cancelB := h.Subscribe(4)
+	defer cancelA()
+
+	h.Publish(Event{Type: TypeSecurity, Message: "first"})
+	cancelB()
+	cancelB() // Safe to call twice
+	h.Publish(Event{Type: TypeSecurity, Message: "second"})
+
+	if e := <-a; e.Message != "first" || e.Time.IsZero() {
+		t.Errorf("first event = %+v", e)
+	}
+	if e := <-a; e.Message != "second" {
+		t.Errorf("second event = %+v", e)
+	}
+	if e := <-b; e.Message != "first" {
+		t.Errorf("cancelled subscriber got %+v", e)
+	}
+	if _, ok := <-b; ok {
+		t.Error("cancelled subscriber channel should be closed")
+	}
+}
+
+func TestHubDropsForSlowSubscriber(t *testing.T) {
+	h := NewHub()
+	ch, cancel := h.Subscribe(1)
+	defer cancel()
+
+	h.Publish(Event{Message: "kept"})
+	h.Publish(Event{Message: "dropped"}) // Must not block
+
+	if e := <-ch; e.Message != "kept" {
+		t.Errorf("event = %+v, want the first one", e)
+	}
+	select {
+	case e := <-ch:
+		t.Errorf("unexpected event %+v", e)
+	default:
+	}
+}
+
+func TestHubSources(t *testing.T) {
+	h := NewHub()
+	ch, cancel := h.Subscribe(10)
+	defer cancel()
+
+	h.RecordInbound(bus.InboundMessage{Channel: "telegram", ChatID: "1", SenderID: "42", Content: "hi"})
+	h.RecordInbound(bus.InboundMessage{Channel: "system", Content: "internal"})
+	h.RecordOutbound(bus.OutboundMessage{Channel: "telegram", ChatID: "1", Content: "hello"})
+	h.RecordChatEvent(bus.ChatEvent{Channel: "telegram", ChatID: "1", Type: bus.ChatMemberJoined, Members: []bus.ChatMember{{ID: "7"}}})
+	h.RecordInteraction(bus.Interaction{Channel: "telegram", ChatID: "1", SenderID: "42", Kind: bus.InteractionButton, Data: "/approve 1a"})
+	h.HandleLog(logger.LogEntry{Level: "INFO", Message: "ignored"})
+	h.HandleLog(logger.LogEntry{Level: "ERROR", Component: "agent", Message: "failed"})
+
+	want := []Event{
+		{Type: TypeInbound, Channel: "telegram", ChatID: "1", SenderID: "42", Content: "hi"},
+		{Type: TypeOutbound, Channel: "telegram", ChatID: "1", Content: "hello"},
+		{Type: TypeChat, Channel: "telegram", ChatID: "1"},
+		{Type: TypeInteraction, Channel: "telegram", ChatID: "1", SenderID: "42"},
+		{Type: TypeError, Component: "agent", Message: "failed"},
+	}
+	for _, w := range want {
+		got := <-ch
+		got.Time = w.Time
+		if got.Type != w.Type || got.Channel != w.Channel || got.SenderID != w.SenderID ||
+			got.Content != w.Content || got.Component != w.Component || got.Message != w.Message {
+			t.Errorf("event = %+v, want %+v", got, w)
+		}
+	}
+	select {
+	case e := <-ch:
+		t.Errorf("unexpected event %+v", e)
+	default:
+	}
+}
@@ -0,0 +1,238 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+// Package health serves the unauthenticated liveness and readiness
+// endpoints that container orchestrators probe, the WhatsApp pairing QR
+// code when there is no terminal to draw it in (behind the admin token),
+// shared media links, and channel webhooks.
+package health
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"html"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"rsc.io/qr"
+
+	"github.com/sipeed/picoclaw/pkg/admin"
+	"github.com/sipeed/picoclaw/pkg/events"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// ReadyFunc reports whether the gateway can serve traffic, with the state
+// of each channel.
+type ReadyFunc func() (bool, map[string]string)
+
+// Server serves /healthz, /readyz, /pair, and endpoints added with Handle.
+// Without a ReadyFunc it serves only the endpoints added with Handle, for
+// media links and webhooks when the health endpoints are off.
+type Server struct {
+	addr    string
+	ready   ReadyFunc
+	started time.Time
+
+	mu        sync.Mutex
+	qrCode    string // Pending pairing code, "" when not pairing
+	pairToken string // Token /pair requires, "" for loopback clients only
+	server    *http.Server
+	routes    map[string]http.Handler // Added with Handle
+}
+
+func NewServer(host string, port int, ready ReadyFunc) *Server {
+	return &Server{
+		addr:  net.JoinHostPort(host, fmt.Sprintf("%d", port)),
+		ready: ready,
+	}
+}
+
+// Addr returns the listen address.
+func (s *Server) Addr() string {
+	return s.addr
+}
+
+// Handle registers an additional public endpoint, such as shared media
+// links, which must do its own access checks. It must be called before
+// Start.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.routes == nil {
+		s.routes = make(map[string]http.Handler)
+	}
+	s.routes[pattern] = handler
+}
+
+// Handler returns the endpoints without starting a listener.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	if s.ready != nil {
+		mux.HandleFunc("/healthz", s.handleHealth)
+		mux.HandleFunc("/readyz", s.handleReady)
+		mux.HandleFunc("/pair", s.handlePair)
+	}
+	s.mu.Lock()
+	for pattern, handler := range s.routes {
+		mux.Handle(pattern, handler)
+	}
+	s.mu.Unlock()
+	return mux
+}
+
+// Start begins serving in the background.
+func (s *Server) Start(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.addr, err)
+	}
+
+	handler := s.Handler()
+	s.mu.Lock()
+	s.started = time.Now()
+	s.server = &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	srv := s.server
+	s.mu.Unlock()
+
+	go func() {
+		if err := srv.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.ErrorCF("health", "Health server error", map[string]interface{}{"error": err.Error()})
+		}
+	}()
+	return nil
+}
+
+// Stop shuts the server down, waiting for in-flight requests until ctx
+// expires.
+func (s *Server) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	srv := s.server
+	s.server = nil
+	s.mu.Unlock()
+
+	if srv == nil {
+		return nil
+	}
+	return srv.Shutdown(ctx)
+}
+
+// SetPairingToken sets the token /pair requires, as "Authorization:
+// Bearer <token>" or the "token" query parameter, normally the admin
+// token. Without one, /pair only answers clients on the loopback
+// interface, since whoever scans the code links their phone to the bot's
+// account.
+func (s *Server) SetPairingToken(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pairToken = token
+}
+
+// SetPairingCode publishes a QR code to scan at /pair; "" withdraws it.
+func (s *Server) SetPairingCode(code string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.qrCode = code
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	started := s.started
+	s.mu.Unlock()
+
+	admin.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"status":         "ok",
+		"uptime_seconds": int64(time.Since(started).Seconds()),
+	})
+}
+
+// handleReady answers 503 until every channel is up, so traffic and
+// rolling updates wait for a working gateway.
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	ok, channels := s.ready()
+	status, code := "ready", http.StatusOK
+	if !ok {
+		status, code = "not ready", http.StatusServiceUnavailable
+	}
+	admin.WriteJSON(w, code, map[string]interface{}{
+		"status":   status,
+		"channels": channels,
+	})
+}
+
+// handlePair serves the pending pairing QR code as a PNG, or 404 when no
+// pairing is in progress. WhatsApp rotates the code every few seconds, so
+// the page refreshes itself.
+func (s *Server) handlePair(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	code, token := s.qrCode, s.pairToken
+	s.mu.Unlock()
+
+	if !pairAuthorized(r, token) {
+		events.Security("health", "Rejected unauthenticated pairing request", map[string]interface{}{
+			"remote": r.RemoteAddr,
+		})
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if code == "" {
+		http.Error(w, "no pairing in progress", http.StatusNotFound)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "png" {
+		img, err := qr.Encode(code, qr.L)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write(img.PNG())
+		return
+	}
+
+	img := "/pair?format=png"
+	if t := r.URL.Query().Get("token"); t != "" {
+		img += "&token=" + url.QueryEscape(t)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprintf(w, pairPage, html.EscapeString(img))
+}
+
+// pairAuthorized reports whether r may see the pairing code: it carries
+// token, or, without a token configured, comes from the loopback interface.
+func pairAuthorized(r *http.Request, token string) bool {
+	if token == "" {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		ip := net.ParseIP(host)
+		return err == nil && ip != nil && ip.IsLoopback()
+	}
+	provided := r.URL.Query().Get("token")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		provided = strings.TrimPrefix(auth, "Bearer ")
+	}
+	return subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1
+}
+
+const pairPage = `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><meta http-equiv="refresh" content="5">
+<title>PicoClaw pairing</title></head>
+<body style="font-family:sans-serif;text-align:center">
+<p>Open WhatsApp on your phone, go to <b>Linked devices</b>, and scan:</p>
+<img src="%s" width="300" height="300" style="image-rendering:pixelated">
+</body></html>
+`
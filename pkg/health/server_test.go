@@ -0,0 +1,161 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReadyz(t *testing.T) {
+	ready := false
+	s := NewServer("127.0.0.1", 0, func() (bool, map[string]string) {
+		return ready, map[string]string{"whatsapp": "reconnecting"}
+	})
+	handler := s.Handler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503 while not ready", rec.Code)
+	}
+	var body struct {
+		Channels map[string]string `json:"channels"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Channels["whatsapp"] != "reconnecting" {
+		t.Errorf("body = %s", rec.Body.String())
+	}
+
+	ready = true
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want 200 once ready", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("/healthz status = %d", rec.Code)
+	}
+}
+
+func TestPair(t *testing.T) {
+	s := NewServer("127.0.0.1", 0, func() (bool, map[string]string) { return true, nil })
+	handler := s.Handler()
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = "127.0.0.1:4321"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := get("/pair"); rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404 when not pairing", rec.Code)
+	}
+
+	s.SetPairingCode("2@abc,def,ghi")
+	if rec := get("/pair"); rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/html; charset=utf-8" {
+		t.Errorf("page: status = %d, type = %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	rec := get("/pair?format=png")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("png: status = %d, type = %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if b := rec.Body.Bytes(); len(b) < 8 || string(b[1:4]) != "PNG" {
+		t.Error("response is not a PNG")
+	}
+
+	s.SetPairingCode("")
+	if rec := get("/pair?format=png"); rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404 after pairing", rec.Code)
+	}
+}
+
+func TestPairNeedsToken(t *testing.T) {
+	s := NewServer("0.0.0.0", 0, func() (bool, map[string]string) { return true, nil })
+	s.SetPairingCode("2@abc,def,ghi")
+	handler := s.Handler()
+
+	get := func(path, remote, bearer string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = remote
+		if bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Without a token, only loopback clients see the code
+	if rec := get("/pair", "203.0.113.7:5000", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("remote client: status = %d, want 401", rec.Code)
+	}
+	if rec := get("/pair", "[::1]:5000", ""); rec.Code != http.StatusOK {
+		t.Errorf("loopback client: status = %d, want 200", rec.Code)
+	}
+
+	s.SetPairingToken("s3cret")
+	if rec := get("/pair", "127.0.0.1:5000", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("no token: status = %d, want 401", rec.Code)
+	}
+	if rec := get("/pair?format=png", "203.0.113.7:5000", "wrong"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("wrong token: status = %d, want 401", rec.Code)
+	}
+	if rec := get("/pair?format=png", "203.0.113.7:5000", "s3cret"); rec.Code != http.StatusOK {
+		t.Errorf("bearer token: status = %d, want 200", rec.Code)
+	}
+	rec := get("/pair?token=s3cret", "203.0.113.7:5000", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `src="/pair?format=png&amp;token=s3cret"`) {
+		t.Errorf("query token: status = %d, body %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestRoutesOnlyWithoutReady(t *testing.T) {
+	s := NewServer("0.0.0.0", 0, nil)
+	s.SetPairingCode("2@abc,def,ghi")
+	s.Handle("/media/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	handler := s.Handler()
+
+	for _, path := range []string{"/healthz", "/readyz", "/pair"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = "127.0.0.1:4321"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s: status = %d, want 404 without the health endpoints", path, rec.Code)
+		}
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/media/x", nil))
+	if rec.Code != http.StatusTeapot {
+		t.Errorf("/media/x: status = %d", rec.Code)
+	}
+}
+
+func TestWebhookWithoutHealth(t *testing.T) {
+	s := NewServer("0.0.0.0", 0, nil)
+	s.Handle("/twilio/sms", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	handler := s.Handler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/twilio/sms", nil))
+	if rec.Code != http.StatusAccepted {
+		t.Errorf("webhook: status = %d", rec.Code)
+	}
+	for _, path := range []string{"/readyz", "/pair"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("%s: status = %d, want 404 alongside a webhook", path, rec.Code)
+		}
+	}
+}
@@ -16,6 +16,7 @@ import (
 
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/crash"
 	"github.com/sipeed/picoclaw/pkg/logger"
 	"github.com/sipeed/picoclaw/pkg/state"
 	"github.com/sipeed/picoclaw/pkg/tools"
@@ -144,6 +145,8 @@ func (hs *HeartbeatService) runLoop(stopChan chan struct{}) {
 
 // executeHeartbeat performs a single heartbeat check
 func (hs *HeartbeatService) executeHeartbeat() {
+	defer crash.Recover("heartbeat", nil)
+
 	hs.mu.RLock()
 	enabled := hs.enabled
 	handler := hs.handler
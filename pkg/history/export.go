@@ -0,0 +1,49 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// WriteJSONL writes messages as one JSON object per line.
+func WriteJSONL(w io.Writer, msgs []Message) error {
+	enc := json.NewEncoder(w)
+	for _, m := range msgs {
+		if err := enc.Encode(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteMarkdown writes messages as a readable transcript grouped by day.
+func WriteMarkdown(w io.Writer, title string, msgs []Message) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# %s\n", title)
+
+	day := ""
+	for _, m := range msgs {
+		if d := m.Time.Format("2006-01-02"); d != day {
+			day = d
+			fmt.Fprintf(&sb, "\n## %s\n", day)
+		}
+		who := m.SenderID
+		if m.Direction == Outbound {
+			who = "picoclaw"
+		}
+		fmt.Fprintf(&sb, "\n**%s %s:** %s\n", m.Time.Format("15:04"), who, m.Content)
+		if len(m.Media) > 0 {
+			names := make([]string, len(m.Media))
+			for i, path := range m.Media {
+				names[i] = filepath.Base(path)
+			}
+			fmt.Fprintf(&sb, "\n_Attachments: %s_\n", strings.Join(names, ", "))
+		}
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
@@ -0,0 +1,422 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+// Package history keeps a SQLite log of every message exchanged with the
+// chat channels, for backup, export, and analysis. Unlike sessions, which
+// hold the context sent to the model and are summarized over time, the log
+// is verbatim and only shrinks through the retention policy.
+package history
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/logger"
+
+	_ "modernc.org/sqlite"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS messages (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	ts         INTEGER NOT NULL,
+	direction  TEXT NOT NULL,
+	channel    TEXT NOT NULL,
+	chat_id    TEXT NOT NULL,
+	sender_id  TEXT NOT NULL,
+	message_id TEXT NOT NULL,
+	content    TEXT NOT NULL,
+	media      TEXT NOT NULL,
+	metadata   TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_messages_chat ON messages(channel, chat_id, ts);
+CREATE INDEX IF NOT EXISTS idx_messages_ts ON messages(ts);
+`
+
+// Message directions.
+const (
+	Inbound  = "in"
+	Outbound = "out"
+)
+
+// Message is one logged message.
+type Message struct {
+	ID        int64             `json:"id"`
+	Time      time.Time         `json:"time"`
+	Direction string            `json:"direction"`
+	Channel   string            `json:"channel"`
+	ChatID    string            `json:"chat_id"`
+	SenderID  string            `json:"sender_id,omitempty"`
+	MessageID string            `json:"message_id,omitempty"` // Platform message ID, when known
+	Content   string            `json:"content"`
+	Media     []string          `json:"media,omitempty"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+}
+
+// Chat summarizes one chat's log.
+type Chat struct {
+	Channel  string
+	ChatID   string
+	Messages int
+	First    time.Time
+	Last     time.Time
+}
+
+// Store is the message log. It implements bus.Recorder.
+type Store struct {
+	db  *sql.DB
+	now func() time.Time
+}
+
+// Open opens (or creates) the history database at path.
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create history directory: %w", err)
+	}
+
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)", path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history database: %w", err)
+	}
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize history schema: %w", err)
+	}
+	return &Store{db: db, now: time.Now}, nil
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// RecordInbound logs a message received from a chat. Internal channels
+// (system, cli, subagent) are not logged. An edit or deletion of an
+// earlier message is applied to that message rather than logged itself.
+func (s *Store) RecordInbound(msg bus.InboundMessage) {
+	if c := msg.Change; c != nil {
+		if constants.IsInternalChannel(msg.Channel) {
+			return
+		}
+		if err := s.Revise(context.Background(), msg.Channel, msg.ChatID, c.MessageID, msg.Content, c.Deleted); err != nil {
+			logger.WarnCF("history", "Failed to apply message change",
+				map[string]interface{}{"channel": msg.Channel, "message_id": c.MessageID, "error": err.Error()})
+		}
+		return
+	}
+	metadata := msg.Metadata
+	if msg.CorrelationID != "" || msg.ThreadID != "" || msg.TraceID != "" {
+		metadata = make(map[string]string, len(msg.Metadata)+3)
+		for k, v := range msg.Metadata {
+			metadata[k] = v
+		}
+		if msg.CorrelationID != "" {
+			metadata["correlation_id"] = msg.CorrelationID
+		}
+		if msg.ThreadID != "" {
+			metadata["thread_id"] = msg.ThreadID
+		}
+		if msg.TraceID != "" {
+			metadata["trace_id"] = msg.TraceID
+		}
+	}
+	s.record(Message{
+		Direction: Inbound,
+		Channel:   msg.Channel,
+		ChatID:    msg.ChatID,
+		SenderID:  msg.SenderID,
+		MessageID: msg.Metadata["message_id"],
+		Content:   msg.Content,
+		Media:     msg.Media,
+		Metadata:  metadata,
+	})
+}
+
+// RecordOutbound logs a message sent to a chat. The bot's reactions are
+// logged like the user's, under the ID of the message reacted to; the
+// deletion of one of its messages is not logged. The correlation IDs of
+// the messages it answers are kept comma-separated in the
+// "correlation_id" metadata.
+func (s *Store) RecordOutbound(msg bus.OutboundMessage) {
+	if msg.Delete != "" {
+		return
+	}
+	m := Message{
+		Direction: Outbound,
+		Channel:   msg.Channel,
+		ChatID:    msg.ChatID,
+		Content:   msg.Content,
+		Media:     msg.Media,
+		Metadata:  make(map[string]string),
+	}
+	if r := msg.Reaction; r != nil {
+		m.MessageID = r.MessageID
+		m.Metadata["reaction"] = r.Emoji
+		if r.Remove {
+			m.Metadata["reaction_removed"] = "true"
+		}
+	}
+	if len(msg.CorrelationIDs) > 0 {
+		m.Metadata["correlation_id"] = strings.Join(msg.CorrelationIDs, ",")
+	}
+	if msg.ThreadID != "" {
+		m.Metadata["thread_id"] = msg.ThreadID
+	}
+	if msg.TraceID != "" {
+		m.Metadata["trace_id"] = msg.TraceID
+	}
+	if len(m.Metadata) == 0 {
+		m.Metadata = nil
+	}
+	s.record(m)
+}
+
+func (s *Store) record(m Message) {
+	if constants.IsInternalChannel(m.Channel) {
+		return
+	}
+	if m.Time.IsZero() {
+		m.Time = s.now()
+	}
+	if err := s.Add(context.Background(), m); err != nil {
+		logger.WarnCF("history", "Failed to record message",
+			map[string]interface{}{"channel": m.Channel, "error": err.Error()})
+	}
+}
+
+// Add stores a message.
+func (s *Store) Add(ctx context.Context, m Message) error {
+	media, err := json.Marshal(m.Media)
+	if err != nil {
+		return err
+	}
+	metadata, err := json.Marshal(m.Metadata)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `INSERT INTO messages
+		(ts, direction, channel, chat_id, sender_id, message_id, content, media, metadata)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		m.Time.UnixMilli(), m.Direction, m.Channel, m.ChatID, m.SenderID, m.MessageID, m.Content, string(media), string(metadata))
+	return err
+}
+
+// Revise replaces the text of the message a user sent in a chat under the
+// given platform message ID with content, marking it "edited" in its
+// metadata. A deleted message loses its text and attachments and is marked
+// "deleted" instead. Messages not in the log are left alone.
+func (s *Store) Revise(ctx context.Context, channel, chatID, messageID, content string, deleted bool) error {
+	// Reactions are logged under the ID of the message reacted to
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, metadata FROM messages
+		WHERE channel = ? AND chat_id = ? AND message_id = ? AND direction = ?
+			AND json_extract(metadata, '$.reaction') IS NULL`, channel, chatID, messageID, Inbound)
+	if err != nil {
+		return err
+	}
+	revised := make(map[int64]map[string]string)
+	for rows.Next() {
+		var id int64
+		var metadata string
+		if err := rows.Scan(&id, &metadata); err != nil {
+			rows.Close()
+			return err
+		}
+		var md map[string]string
+		json.Unmarshal([]byte(metadata), &md)
+		if md == nil {
+			md = make(map[string]string)
+		}
+		revised[id] = md
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if deleted {
+		content = ""
+	}
+	for id, md := range revised {
+		if deleted {
+			md["deleted"] = "true"
+		} else {
+			md["edited"] = "true"
+		}
+		data, err := json.Marshal(md)
+		if err != nil {
+			return err
+		}
+		if _, err := s.db.ExecContext(ctx, `UPDATE messages
+			SET content = ?, metadata = ?, media = CASE WHEN ? THEN 'null' ELSE media END
+			WHERE id = ?`, content, string(data), deleted, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Messages returns a chat's messages since the given time, oldest first.
+func (s *Store) Messages(ctx context.Context, channel, chatID string, since time.Time) ([]Message, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, ts, direction, channel, chat_id, sender_id, message_id, content, media, metadata
+		FROM messages WHERE channel = ? AND chat_id = ? AND ts >= ?
+		ORDER BY ts, id`, channel, chatID, since.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Message
+	for rows.Next() {
+		m, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+// Find returns the latest logged message in a chat with the given
+// platform message ID. Reactions, which are logged under the ID of the
+// message reacted to, are passed over.
+func (s *Store) Find(ctx context.Context, channel, chatID, messageID string) (Message, bool, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, ts, direction, channel, chat_id, sender_id, message_id, content, media, metadata
+		FROM messages WHERE channel = ? AND chat_id = ? AND message_id = ?
+			AND json_extract(metadata, '$.reaction') IS NULL
+		ORDER BY ts DESC, id DESC LIMIT 1`, channel, chatID, messageID)
+	if err != nil {
+		return Message{}, false, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return Message{}, false, rows.Err()
+	}
+	m, err := scanMessage(rows)
+	return m, err == nil, err
+}
+
+// Correlated returns the messages with the given correlation ID, oldest
+// first: the inbound message and the replies it led to.
+func (s *Store) Correlated(ctx context.Context, correlationID string) ([]Message, error) {
+	return s.query(ctx, `
+		SELECT id, ts, direction, channel, chat_id, sender_id, message_id, content, media, metadata
+		FROM messages
+		WHERE instr(',' || ifnull(json_extract(metadata, '$.correlation_id'), '') || ',', ',' || ? || ',') > 0
+		ORDER BY ts, id`, correlationID)
+}
+
+// Traced returns the messages in the given trace, oldest first: the
+// message that started it and everything it led to, in any chat.
+func (s *Store) Traced(ctx context.Context, traceID string) ([]Message, error) {
+	return s.query(ctx, `
+		SELECT id, ts, direction, channel, chat_id, sender_id, message_id, content, media, metadata
+		FROM messages
+		WHERE json_extract(metadata, '$.trace_id') = ?
+		ORDER BY ts, id`, traceID)
+}
+
+// query returns the messages a SELECT of all columns finds.
+func (s *Store) query(ctx context.Context, query string, args ...interface{}) ([]Message, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Message
+	for rows.Next() {
+		m, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, m)
+	}
+	return out, rows.Err()
+}
+
+// scanMessage reads a row selected with the columns of Messages.
+func scanMessage(rows *sql.Rows) (Message, error) {
+	var m Message
+	var ts int64
+	var media, metadata string
+	if err := rows.Scan(&m.ID, &ts, &m.Direction, &m.Channel, &m.ChatID, &m.SenderID, &m.MessageID, &m.Content, &media, &metadata); err != nil {
+		return Message{}, err
+	}
+	m.Time = time.UnixMilli(ts)
+	json.Unmarshal([]byte(media), &m.Media)
+	json.Unmarshal([]byte(metadata), &m.Metadata)
+	return m, nil
+}
+
+// Chats lists the chats in the log, most recently active first.
+func (s *Store) Chats(ctx context.Context) ([]Chat, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT channel, chat_id, COUNT(*), MIN(ts), MAX(ts)
+		FROM messages GROUP BY channel, chat_id ORDER BY MAX(ts) DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Chat
+	for rows.Next() {
+		var c Chat
+		var first, last int64
+		if err := rows.Scan(&c.Channel, &c.ChatID, &c.Messages, &first, &last); err != nil {
+			return nil, err
+		}
+		c.First, c.Last = time.UnixMilli(first), time.UnixMilli(last)
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// Purge deletes messages older than before and returns how many were
+// removed.
+func (s *Store) Purge(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM messages WHERE ts < ?", before.UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// Retain enforces the retention policy: messages older than maxAge are
+// purged now and then every hour until ctx is done.
+func (s *Store) Retain(ctx context.Context, maxAge time.Duration) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		n, err := s.Purge(ctx, s.now().Add(-maxAge))
+		switch {
+		case err != nil && ctx.Err() == nil:
+			logger.ErrorCF("history", "Failed to purge old messages", map[string]interface{}{"error": err.Error()})
+		case n > 0:
+			logger.InfoCF("history", "Purged old messages", map[string]interface{}{"count": n})
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package history
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := Open(filepath.Join(t.TempDir(), "history", "history.db"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestRecordAndMessages(t *testing.T) {
+	s := newTestStore(t)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.Local)
+	s.now = func() time.Time { return now }
+
+	s.RecordInbound(bus.InboundMessage{
+		Channel:  "telegram",
+		ChatID:   "42",
+		SenderID: "7",
+		Content:  "hello",
+		Media:    []string{"/tmp/photo.jpg"},
+		Metadata: map[string]string{"message_id": "100"},
+	})
+	now = now.Add(time.Second)
+	s.RecordOutbound(bus.OutboundMessage{Channel: "telegram", ChatID: "42", Content: "hi there"})
+	s.RecordInbound(bus.InboundMessage{Channel: "system", ChatID: "telegram:42", Content: "internal"})
+	s.RecordInbound(bus.InboundMessage{Channel: "discord", ChatID: "9", Content: "elsewhere"})
+
+	ctx := context.Background()
+	msgs, err := s.Messages(ctx, "telegram", "42", time.Time{})
+	if err != nil {
+		t.Fatalf("Messages() error = %v", err)
+	}
+	if len(msgs) != 2 {
+		t.Fatalf("Messages() returned %d messages, want 2", len(msgs))
+	}
+	in, out := msgs[0], msgs[1]
+	if in.Direction != Inbound || in.SenderID != "7" || in.MessageID != "100" || in.Content != "hello" {
+		t.Errorf("inbound = %+v", in)
+	}
+	if len(in.Media) != 1 || in.Metadata["message_id"] != "100" {
+		t.Errorf("inbound media/metadata = %v, %v", in.Media, in.Metadata)
+	}
+	if out.Direction != Outbound || out.Content != "hi there" {
+		t.Errorf("outbound = %+v", out)
+	}
+
+	s.RecordOutbound(bus.OutboundMessage{Channel: "discord", ChatID: "9", Reaction: &bus.Reaction{MessageID: "5", Emoji: "✅"}})
+	if got, _ := s.Messages(ctx, "discord", "9", time.Time{}); len(got) != 2 || got[1].MessageID != "5" || got[1].Metadata["reaction"] != "✅" {
+		t.Errorf("reaction logged as %+v", got)
+	}
+
+	since, err := s.Messages(ctx, "telegram", "42", now)
+	if err != nil || len(since) != 1 || since[0].Direction != Outbound {
+		t.Errorf("Messages(since) = %+v, %v; want only the reply", since, err)
+	}
+
+	chats, err := s.Chats(ctx)
+	if err != nil {
+		t.Fatalf("Chats() error = %v", err)
+	}
+	if len(chats) != 2 {
+		t.Fatalf("Chats() = %+v, want telegram and discord", chats)
+	}
+	for _, c := range chats {
+		if c.Channel == "system" {
+			t.Errorf("internal channel logged: %+v", c)
+		}
+		if c.Channel == "telegram" && c.Messages != 2 {
+			t.Errorf("telegram chat has %d messages, want 2", c.Messages)
+		}
+	}
+}
+
+func TestPurge(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	for _, age := range []time.Duration{100 * 24 * time.Hour, 10 * 24 * time.Hour, time.Minute} {
+		if err := s.Add(ctx, Message{Time: now.Add(-age), Direction: Inbound, Channel: "slack", ChatID: "C1", Content: age.String()}); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+	}
+
+	n, err := s.Purge(ctx, now.Add(-90*24*time.Hour))
+	if err != nil || n != 1 {
+		t.Fatalf("Purge() = %d, %v; want 1 removed", n, err)
+	}
+	msgs, _ := s.Messages(ctx, "slack", "C1", time.Time{})
+	if len(msgs) != 2 {
+		t.Errorf("%d messages left, want 2", len(msgs))
+	}
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	day := time.Date(2026, 3, 1, 9, 30, 0, 0, time.Local)
+	msgs := []Message{
+		{Time: day, Direction: Inbound, SenderID: "alice", Content: "what's up?", Media: []string{"/media/a/photo.jpg"}},
+		{Time: day.Add(time.Minute), Direction: Outbound, Content: "not much"},
+		{Time: day.Add(24 * time.Hour), Direction: Inbound, SenderID: "alice", Content: "next day"},
+	}
+
+	var sb strings.Builder
+	if err := WriteMarkdown(&sb, "telegram:42", msgs); err != nil {
+		t.Fatalf("WriteMarkdown() error = %v", err)
+	}
+	got := sb.String()
+	for _, want := range []string{
+		"# telegram:42",
+		"## 2026-03-01",
+		"**09:30 alice:** what's up?",
+		"_Attachments: photo.jpg_",
+		"**09:31 picoclaw:** not much",
+		"## 2026-03-02",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("markdown missing %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestFind(t *testing.T) {
+	s := newTestStore(t)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.Local)
+	s.now = func() time.Time { return now }
+	s.RecordInbound(bus.InboundMessage{Channel: "telegram", ChatID: "42", Content: "first", Metadata: map[string]string{"message_id": "7"}})
+	now = now.Add(time.Second)
+	s.RecordInbound(bus.InboundMessage{Channel: "telegram", ChatID: "42", Content: "edited", Metadata: map[string]string{"message_id": "7"}})
+	s.RecordInbound(bus.InboundMessage{Channel: "telegram", ChatID: "43", Content: "other chat", Metadata: map[string]string{"message_id": "8"}})
+	now = now.Add(time.Second)
+	s.RecordInbound(bus.InboundMessage{Channel: "telegram", ChatID: "42", Metadata: map[string]string{"message_id": "7", "reaction": "📌"}})
+
+	ctx := context.Background()
+	m, found, err := s.Find(ctx, "telegram", "42", "7")
+	if err != nil || !found || m.Content != "edited" {
+		t.Errorf("Find() = %+v, %v, %v; want the latest copy, not the reaction to it", m, found, err)
+	}
+	if _, found, err := s.Find(ctx, "telegram", "42", "8"); found || err != nil {
+		t.Errorf("Find() in the wrong chat = %v, %v", found, err)
+	}
+}
+
+func TestCorrelated(t *testing.T) {
+	s := newTestStore(t)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.Local)
+	s.now = func() time.Time { return now }
+	s.RecordInbound(bus.InboundMessage{Channel: "telegram", ChatID: "42", Content: "first", CorrelationID: "aa"})
+	s.RecordInbound(bus.InboundMessage{Channel: "telegram", ChatID: "42", Content: "second", CorrelationID: "bb",
+		Metadata: map[string]string{"message_id": "7"}})
+	now = now.Add(time.Second)
+	s.RecordOutbound(bus.OutboundMessage{Channel: "telegram", ChatID: "42", Content: "both", CorrelationIDs: []string{"aa", "bb"}})
+	s.RecordOutbound(bus.OutboundMessage{Channel: "telegram", ChatID: "42", Content: "unrelated"})
+
+	ctx := context.Background()
+	tests := []struct {
+		id   string
+		want []string
+	}{
+		{"aa", []string{"first", "both"}},
+		{"bb", []string{"second", "both"}},
+		{"b", nil},
+	}
+	for _, tt := range tests {
+		msgs, err := s.Correlated(ctx, tt.id)
+		if err != nil {
+			t.Fatalf("Correlated(%q) error = %v", tt.id, err)
+		}
+		var got []string
+		for _, m := range msgs {
+			got = append(got, m.Content)
+		}
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("Correlated(%q) = %q, want %q", tt.id, got, tt.want)
+		}
+	}
+
+	msgs, _ := s.Correlated(ctx, "bb")
+	if msgs[0].Metadata["message_id"] != "7" || msgs[1].Metadata["correlation_id"] != "aa,bb" {
+		t.Errorf("metadata = %v, %v", msgs[0].Metadata, msgs[1].Metadata)
+	}
+}
+
+func TestTraced(t *testing.T) {
+	s := newTestStore(t)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.Local)
+	s.now = func() time.Time { return now }
+	s.RecordInbound(bus.InboundMessage{Channel: "telegram", ChatID: "42", Content: "ask", TraceID: "t1"})
+	now = now.Add(time.Second)
+	s.RecordOutbound(bus.OutboundMessage{Channel: "slack", ChatID: "C1", Content: "relayed", TraceID: "t1"})
+	s.RecordOutbound(bus.OutboundMessage{Channel: "telegram", ChatID: "42", Content: "unrelated", TraceID: "t2"})
+
+	msgs, err := s.Traced(context.Background(), "t1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 || msgs[0].Content != "ask" || msgs[1].Content != "relayed" {
+		t.Errorf("Traced() = %+v, want the trace across chats", msgs)
+	}
+}
+
+func TestRecordThreadID(t *testing.T) {
+	s := newTestStore(t)
+	s.RecordInbound(bus.InboundMessage{Channel: "slack", ChatID: "C1/17.1", Content: "in thread", ThreadID: "17.1"})
+	s.RecordOutbound(bus.OutboundMessage{Channel: "slack", ChatID: "C1/17.1", Content: "reply", ThreadID: "17.1"})
+
+	msgs, err := s.Messages(context.Background(), "slack", "C1/17.1", time.Time{})
+	if err != nil {
+		t.Fatalf("Messages() error = %v", err)
+	}
+	if len(msgs) != 2 {
+		t.Fatalf("Messages() returned %d messages, want 2", len(msgs))
+	}
+	for _, m := range msgs {
+		if m.Metadata["thread_id"] != "17.1" {
+			t.Errorf("%s metadata = %v", m.Content, m.Metadata)
+		}
+	}
+}
+
+func TestRecordChange(t *testing.T) {
+	s := newTestStore(t)
+	msg := func(id, content string, change *bus.Change) bus.InboundMessage {
+		return bus.InboundMessage{
+			Channel: "whatsapp", ChatID: "42", SenderID: "alice", Content: content,
+			Media: []string{"/tmp/photo.jpg"}, Metadata: map[string]string{"message_id": id}, Change: change,
+		}
+	}
+	s.RecordInbound(msg("1", "meet at 5", nil))
+	s.RecordInbound(msg("2", "my password is hunter2", nil))
+	s.RecordInbound(bus.InboundMessage{Channel: "whatsapp", ChatID: "42", SenderID: "bob",
+		Metadata: map[string]string{"message_id": "2", "reaction": "😮"}, Reaction: &bus.Reaction{MessageID: "2", Emoji: "😮"}})
+
+	s.RecordInbound(msg("1", "meet at 6", &bus.Change{MessageID: "1"}))
+	s.RecordInbound(msg("2", "", &bus.Change{MessageID: "2", Deleted: true}))
+	s.RecordInbound(msg("9", "never logged", &bus.Change{MessageID: "9"}))
+
+	msgs, err := s.Messages(context.Background(), "whatsapp", "42", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 3 {
+		t.Fatalf("Messages() returned %d, want the 3 originals only", len(msgs))
+	}
+	if m := msgs[0]; m.Content != "meet at 6" || m.Metadata["edited"] != "true" || len(m.Media) != 1 {
+		t.Errorf("edited message = %+v", m)
+	}
+	if m := msgs[1]; m.Content != "" || m.Metadata["deleted"] != "true" || len(m.Media) != 0 {
+		t.Errorf("deleted message = %+v", m)
+	}
+	if m := msgs[2]; m.Metadata["reaction"] != "😮" || m.Metadata["deleted"] != "" {
+		t.Errorf("reaction to the deleted message = %+v", m)
+	}
+}
@@ -0,0 +1,162 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package i18n
+
+import (
+	"strings"
+	"unicode"
+)
+
+// latinLanguage is a language written in Latin script, told apart by its
+// most common words and by letters few other languages use.
+type latinLanguage struct {
+	code    string
+	words   []string
+	letters string
+}
+
+// latinLanguages are the Latin-script languages Detect recognizes.
+var latinLanguages = []latinLanguage{
+	{"en", []string{"the", "and", "is", "are", "you", "i", "to", "of", "it", "that", "what", "how", "can", "do", "this", "with", "for", "my", "me", "have", "please", "not", "was", "your", "will", "would", "there", "why", "when", "hello", "thanks"}, ""},
+	{"de", []string{"der", "die", "das", "und", "ist", "ich", "nicht", "du", "sie", "es", "ein", "eine", "mit", "wie", "was", "auf", "für", "zu", "den", "dem", "bitte", "kannst", "habe", "mir", "mich", "wir", "noch", "auch", "warum", "wann", "hallo", "danke"}, "ß"},
+	{"es", []string{"el", "la", "los", "las", "y", "es", "que", "qué", "en", "un", "una", "por", "para", "con", "no", "cómo", "está", "estoy", "yo", "tú", "mi", "pero", "muy", "puedes", "gracias", "hola", "también", "dónde", "cuándo"}, "ñ¿¡"},
+	{"fr", []string{"le", "la", "les", "et", "est", "je", "tu", "vous", "pas", "un", "une", "des", "que", "qui", "il", "elle", "à", "avec", "pour", "dans", "ce", "c'est", "mon", "ne", "sur", "comment", "pourquoi", "merci", "bonjour", "peux", "suis", "très", "quelle", "quel"}, "œ"},
+	{"it", []string{"il", "lo", "la", "gli", "e", "è", "che", "di", "un", "una", "non", "per", "con", "sono", "come", "cosa", "mi", "ti", "ciao", "grazie", "perché", "anche", "molto", "puoi", "questo", "della", "del"}, ""},
+	{"pt", []string{"o", "a", "os", "as", "e", "é", "que", "de", "um", "uma", "não", "para", "com", "como", "eu", "você", "está", "obrigado", "obrigada", "olá", "muito", "mas", "isso", "do", "da", "em", "também", "porque", "tudo"}, "ãõ"},
+	{"nl", []string{"de", "het", "een", "en", "is", "ik", "je", "niet", "van", "dat", "wat", "hoe", "met", "voor", "op", "zijn", "maar", "ook", "kun", "kan", "dank", "hallo", "waarom", "mij", "jij", "heb", "er"}, ""},
+	{"pl", []string{"i", "w", "nie", "to", "jest", "się", "na", "że", "z", "co", "jak", "do", "ja", "ty", "czy", "dziękuję", "cześć", "mam", "tak", "ale", "już", "dlaczego", "proszę"}, "ąęłńśźż"},
+	{"tr", []string{"ve", "bir", "bu", "ne", "mi", "için", "ben", "sen", "var", "yok", "değil", "çok", "nasıl", "neden", "merhaba", "teşekkür", "ederim", "ile", "gibi", "evet", "hayır"}, "ğış"},
+	{"sv", []string{"och", "är", "jag", "du", "det", "att", "en", "ett", "inte", "på", "med", "för", "som", "vad", "hur", "har", "kan", "tack", "hej", "men", "också", "varför", "mig", "vi"}, "å"},
+}
+
+// languageNames are the English names of the languages Detect recognizes.
+var languageNames = map[string]string{
+	"ar": "Arabic",
+	"de": "German",
+	"el": "Greek",
+	"en": "English",
+	"es": "Spanish",
+	"fr": "French",
+	"he": "Hebrew",
+	"hi": "Hindi",
+	"it": "Italian",
+	"ja": "Japanese",
+	"ko": "Korean",
+	"nl": "Dutch",
+	"pl": "Polish",
+	"pt": "Portuguese",
+	"ru": "Russian",
+	"sv": "Swedish",
+	"th": "Thai",
+	"tr": "Turkish",
+	"uk": "Ukrainian",
+	"zh": "Chinese",
+}
+
+// LanguageName returns the English name of a language Detect returns, or
+// code itself for other languages.
+func LanguageName(code string) string {
+	if name, ok := languageNames[code]; ok {
+		return name
+	}
+	return code
+}
+
+// Detect guesses the language text is written in, as an ISO 639-1 code.
+// It knows the languages in languageNames, from their script or, for Latin
+// script, their most common words, and returns "" when text is too short
+// or too mixed to tell, e.g. "ok" or a bare URL.
+func Detect(text string) string {
+	var letters, latin int
+	scripts := make(map[string]int)
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		switch {
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		case unicode.Is(unicode.Hangul, r):
+			scripts["ko"]++
+		case unicode.Is(unicode.Hiragana, r), unicode.Is(unicode.Katakana, r):
+			scripts["ja"]++
+		case unicode.Is(unicode.Han, r):
+			scripts["zh"]++
+		case unicode.Is(unicode.Cyrillic, r):
+			scripts["ru"]++
+		case unicode.Is(unicode.Greek, r):
+			scripts["el"]++
+		case unicode.Is(unicode.Arabic, r):
+			scripts["ar"]++
+		case unicode.Is(unicode.Hebrew, r):
+			scripts["he"]++
+		case unicode.Is(unicode.Devanagari, r):
+			scripts["hi"]++
+		case unicode.Is(unicode.Thai, r):
+			scripts["th"]++
+		}
+	}
+	if letters == 0 {
+		return ""
+	}
+	if latin*2 < letters {
+		best, bestCount := "", 0
+		for code, n := range scripts {
+			if n > bestCount {
+				best, bestCount = code, n
+			}
+		}
+		switch {
+		case best == "zh" && scripts["ja"] > 0:
+			// Japanese mixes kanji with kana
+			return "ja"
+		case best == "ru" && strings.ContainsAny(strings.ToLower(text), "іїєґ"):
+			return "uk"
+		}
+		return best
+	}
+	return detectLatin(text)
+}
+
+// detectLatin scores text's words against each Latin-script language, and
+// picks the best one if it clearly beats the rest.
+func detectLatin(text string) string {
+	text = strings.ToLower(strings.ReplaceAll(text, "’", "'"))
+	words := strings.FieldsFunc(text, func(r rune) bool { return !unicode.IsLetter(r) && r != '\'' })
+	if len(words) == 0 {
+		return ""
+	}
+	best, bestScore, second := "", 0, 0
+	for _, lang := range latinLanguages {
+		score := 0
+		for _, w := range words {
+			for _, common := range lang.words {
+				if w == common {
+					score++
+					break
+				}
+			}
+		}
+		for _, r := range lang.letters {
+			if strings.ContainsRune(text, r) {
+				score++
+			}
+		}
+		switch {
+		case score > bestScore:
+			best, bestScore, second = lang.code, score, bestScore
+		case score > second:
+			second = score
+		}
+	}
+	// One common word is enough in a greeting, not in a sentence
+	if bestScore == second || (bestScore < 2 && len(words) > 3) {
+		return ""
+	}
+	return best
+}
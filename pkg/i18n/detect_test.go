@@ -0,0 +1,42 @@
+package i18n
+
+import "testing"
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		text, want string
+	}{
+		{"What time is it in Tokyo?", "en"},
+		{"Wie spät ist es in Tokio?", "de"},
+		{"¿Qué hora es en Tokio?", "es"},
+		{"Quelle heure est-il à Tokyo ?", "fr"},
+		{"Come stai oggi?", "it"},
+		{"Olá, tudo bem?", "pt"},
+		{"Hoe laat is het in Tokio?", "nl"},
+		{"Która jest godzina w Tokio? Proszę odpowiedz", "pl"},
+		{"Merhaba, nasılsın?", "tr"},
+		{"Hej, hur mår du?", "sv"},
+		{"Привет, как дела?", "ru"},
+		{"Привіт, як справи? Що нового?", "uk"},
+		{"東京は今何時ですか", "ja"},
+		{"东京现在几点", "zh"},
+		{"안녕하세요", "ko"},
+		{"Καλημέρα", "el"},
+		{"مرحبا كيف حالك", "ar"},
+		{"ok", ""},
+		{"https://example.com/x", ""},
+		{"👍", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := Detect(tt.text); got != tt.want {
+			t.Errorf("Detect(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+	if got := LanguageName("de"); got != "German" {
+		t.Errorf("LanguageName(de) = %q", got)
+	}
+	if got := LanguageName("xx"); got != "xx" {
+		t.Errorf("LanguageName(xx) = %q", got)
+	}
+}
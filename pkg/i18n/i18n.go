@@ -0,0 +1,181 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+// Package i18n holds the bot's own strings (command replies, notices, media
+// placeholders) in per-locale catalogs, so a chat that picked a language
+// gets every built-in reply in it rather than a mix of English and the
+// model's replies.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Fallback is the locale used when a key is missing from the chat's locale.
+const Fallback = "en"
+
+//go:embed locales/*.json
+var builtin embed.FS
+
+// nameKey holds each locale's own name for itself, e.g. "Deutsch".
+const nameKey = "language.name"
+
+// englishNames maps English language names to the built-in locales so
+// "/lang German" finds "de" as well as "/lang Deutsch" does.
+var englishNames = map[string]string{
+	"english": "en",
+	"german":  "de",
+	"spanish": "es",
+	"french":  "fr",
+}
+
+// Catalog maps locales to their messages. Messages are fmt format strings.
+type Catalog struct {
+	mu       sync.RWMutex
+	messages map[string]map[string]string
+}
+
+// NewCatalog returns a catalog holding the built-in locales.
+func NewCatalog() *Catalog {
+	c := &Catalog{messages: make(map[string]map[string]string)}
+	entries, _ := builtin.ReadDir("locales")
+	for _, e := range entries {
+		data, err := builtin.ReadFile("locales/" + e.Name())
+		if err != nil {
+			continue
+		}
+		_ = c.add(strings.TrimSuffix(e.Name(), ".json"), data)
+	}
+	return c
+}
+
+// Load returns the built-in catalog with every dir/<locale>.json merged
+// over it. Files may add locales or override single keys of built-in ones.
+// A missing dir is not an error.
+func Load(dir string) (*Catalog, error) {
+	c := NewCatalog()
+	if dir == "" {
+		return c, nil
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return c, err
+	}
+	for _, path := range files {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return c, err
+		}
+		locale := strings.TrimSuffix(filepath.Base(path), ".json")
+		if err := c.add(locale, data); err != nil {
+			return c, fmt.Errorf("locale %s: %w", path, err)
+		}
+	}
+	return c, nil
+}
+
+func (c *Catalog) add(locale string, data []byte) error {
+	var msgs map[string]string
+	if err := json.Unmarshal(data, &msgs); err != nil {
+		return err
+	}
+	locale = strings.ToLower(locale)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.messages[locale] == nil {
+		c.messages[locale] = make(map[string]string, len(msgs))
+	}
+	for k, v := range msgs {
+		c.messages[locale][k] = v
+	}
+	return nil
+}
+
+// Locales returns the catalog's locales, sorted.
+func (c *Catalog) Locales() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	out := make([]string, 0, len(c.messages))
+	for l := range c.messages {
+		out = append(out, l)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Has reports whether the catalog has locale.
+func (c *Catalog) Has(locale string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	_, ok := c.messages[locale]
+	return ok
+}
+
+// Match finds the locale for a language as users write it: a code ("de"),
+// a regional code ("de-AT", "pt_BR"), the English name ("German"), or the
+// native name ("Deutsch"). It returns "" when the catalog lacks it.
+func (c *Catalog) Match(lang string) string {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if lang == "" {
+		return ""
+	}
+	lang = strings.ReplaceAll(lang, "_", "-")
+	if c.Has(lang) {
+		return lang
+	}
+	if base, _, ok := strings.Cut(lang, "-"); ok && c.Has(base) {
+		return base
+	}
+	if code, ok := englishNames[lang]; ok && c.Has(code) {
+		return code
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for locale, msgs := range c.messages {
+		if strings.EqualFold(msgs[nameKey], lang) {
+			return locale
+		}
+	}
+	return ""
+}
+
+// Name returns locale's name for itself, or the locale when unnamed.
+func (c *Catalog) Name(locale string) string {
+	if name, ok := c.Lookup(locale, nameKey); ok {
+		return name
+	}
+	return locale
+}
+
+// Lookup returns the message for key in locale without falling back.
+func (c *Catalog) Lookup(locale, key string) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	msg, ok := c.messages[locale][key]
+	return msg, ok
+}
+
+// T formats the message for key in locale, falling back to English and
+// then to the key itself so a missing translation is visible but harmless.
+func (c *Catalog) T(locale, key string, args ...interface{}) string {
+	msg, ok := c.Lookup(locale, key)
+	if !ok {
+		if msg, ok = c.Lookup(Fallback, key); !ok {
+			msg = key
+		}
+	}
+	if len(args) == 0 {
+		return msg
+	}
+	return fmt.Sprintf(msg, args...)
+}
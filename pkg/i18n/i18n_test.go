@@ -0,0 +1,130 @@
+package i18n
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+var verb = regexp.MustCompile(`%(\[\d+\])?[-+# 0]*[\d.]*[a-zA-Z%]`)
+
+// Every built-in locale must translate every English key with the same
+// format verbs, or replies would show "%!s(MISSING)".
+func TestBuiltinLocalesComplete(t *testing.T) {
+	c := NewCatalog()
+	en := c.messages[Fallback]
+	if len(en) == 0 {
+		t.Fatal("English catalog is empty")
+	}
+	for _, locale := range c.Locales() {
+		for key, msg := range en {
+			tr, ok := c.Lookup(locale, key)
+			if !ok {
+				t.Errorf("%s: missing %q", locale, key)
+				continue
+			}
+			want, got := verb.FindAllString(msg, -1), verb.FindAllString(tr, -1)
+			sort.Strings(want)
+			sort.Strings(got)
+			if len(want) != len(got) {
+				t.Errorf("%s: %q verbs = %v, want %v", locale, key, got, want)
+				continue
+			}
+			for i := range want {
+				if want[i] != got[i] {
+					t.Errorf("%s: %q verbs = %v, want %v", locale, key, got, want)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	c := NewCatalog()
+	tests := map[string]string{
+		"de":      "de",
+		"DE":      "de",
+		"de-AT":   "de",
+		"fr_CA":   "fr",
+		"German":  "de",
+		"Deutsch": "de",
+		"español": "es",
+		"Klingon": "",
+		"":        "",
+	}
+	for in, want := range tests {
+		if got := c.Match(in); got != want {
+			t.Errorf("Match(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestCatalogFallback(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "de.json"), []byte(`{"mute.off": "Wieder da."}`), 0644)
+	os.WriteFile(filepath.Join(dir, "nl.json"), []byte(`{"language.name": "Nederlands", "mute.off": "Weer aan."}`), 0644)
+	c, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		locale, key, want string
+	}{
+		{"de", "mute.off", "Wieder da."},                    // Override
+		{"de", "thread.new", "Neue Unterhaltung begonnen."}, // Built-in kept
+		{"nl", "mute.off", "Weer aan."},                     // Added locale
+		{"nl", "thread.new", "Started a new conversation."}, // Falls back to English
+		{"nl", "no.such.key", "no.such.key"},
+	}
+	for _, tt := range tests {
+		if got := c.T(tt.locale, tt.key); got != tt.want {
+			t.Errorf("T(%s, %s) = %q, want %q", tt.locale, tt.key, got, tt.want)
+		}
+	}
+	if got := c.Match("nederlands"); got != "nl" {
+		t.Errorf("Match(nederlands) = %q", got)
+	}
+	if got := c.T("en", "media.attachment", "a.pdf"); got != "[attachment: a.pdf]" {
+		t.Errorf("T with args = %q", got)
+	}
+}
+
+func TestLocalizerPersists(t *testing.T) {
+	store := state.NewMemoryStore()
+	l := NewLocalizer(NewCatalog(), "fr", store)
+
+	if got := l.Locale("telegram", "1"); got != "fr" {
+		t.Errorf("default locale = %q, want fr", got)
+	}
+	if err := l.SetLocale("telegram", "1", "de"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A fresh localizer over the same store sees the choice
+	l = NewLocalizer(NewCatalog(), "fr", store)
+	if got := l.T("telegram", "1", "mute.off"); got != "Stummschaltung aufgehoben." {
+		t.Errorf("T = %q", got)
+	}
+	if got := l.Locale("telegram", "2"); got != "fr" {
+		t.Errorf("other chat locale = %q, want fr", got)
+	}
+
+	if err := l.SetLocale("telegram", "1", ""); err != nil {
+		t.Fatal(err)
+	}
+	l = NewLocalizer(NewCatalog(), "fr", store)
+	if got := l.Locale("telegram", "1"); got != "fr" {
+		t.Errorf("cleared locale = %q, want fr", got)
+	}
+
+	// Unknown defaults fall back to English
+	if got := NewLocalizer(nil, "xx", nil).DefaultLocale(); got != Fallback {
+		t.Errorf("unknown default = %q", got)
+	}
+}
@@ -0,0 +1,162 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package i18n
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+// bucket is the state bucket holding each chat's locale.
+const bucket = "locales"
+
+// Localizer picks the locale for each chat and formats messages in it.
+// Chat choices are persisted in the state store when one is set, so they
+// survive restarts and are shared between instances.
+type Localizer struct {
+	mu            sync.RWMutex
+	catalog       *Catalog
+	defaultLocale string
+	store         state.Store
+	chats         map[string]string // "channel:chat_id" -> locale, "" for default
+}
+
+// NewLocalizer returns a localizer over catalog that answers chats without
+// a choice in defaultLocale. store may be nil to keep choices in memory.
+func NewLocalizer(catalog *Catalog, defaultLocale string, store state.Store) *Localizer {
+	if catalog == nil {
+		catalog = NewCatalog()
+	}
+	return &Localizer{
+		catalog:       catalog,
+		defaultLocale: resolveDefault(catalog, defaultLocale),
+		store:         store,
+		chats:         make(map[string]string),
+	}
+}
+
+func resolveDefault(catalog *Catalog, locale string) string {
+	if m := catalog.Match(locale); m != "" {
+		return m
+	}
+	if locale != "" {
+		logger.WarnCF("i18n", "Unknown default locale, using English",
+			map[string]interface{}{"locale": locale})
+	}
+	return Fallback
+}
+
+// Catalog returns the localizer's catalog.
+func (l *Localizer) Catalog() *Catalog {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.catalog
+}
+
+// DefaultLocale returns the locale for chats without a choice.
+func (l *Localizer) DefaultLocale() string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.defaultLocale
+}
+
+// Configure replaces the catalog, default locale, and store, and forgets
+// cached chat choices so they are re-read from the new store.
+func (l *Localizer) Configure(catalog *Catalog, defaultLocale string, store state.Store) {
+	if catalog == nil {
+		catalog = NewCatalog()
+	}
+	def := resolveDefault(catalog, defaultLocale)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.catalog = catalog
+	l.defaultLocale = def
+	l.store = store
+	l.chats = make(map[string]string)
+}
+
+// Locale returns the locale chosen for the chat, or the default.
+func (l *Localizer) Locale(channel, chatID string) string {
+	key := channel + ":" + chatID
+	l.mu.RLock()
+	locale, cached := l.chats[key]
+	store, def := l.store, l.defaultLocale
+	l.mu.RUnlock()
+
+	if !cached {
+		locale = ""
+		if store != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			var saved string
+			err := state.GetJSON(ctx, store, bucket, key, &saved)
+			cancel()
+			switch {
+			case err == nil:
+				locale = saved
+			case errors.Is(err, state.ErrNotFound):
+			default:
+				// Don't cache: the store may be back on the next message.
+				logger.WarnCF("i18n", "Failed to read chat locale",
+					map[string]interface{}{"chat": key, "error": err.Error()})
+				return def
+			}
+		}
+		l.mu.Lock()
+		l.chats[key] = locale
+		l.mu.Unlock()
+	}
+	if locale == "" || !l.Catalog().Has(locale) {
+		return def
+	}
+	return locale
+}
+
+// SetLocale records the chat's locale. An empty locale returns the chat
+// to the default.
+func (l *Localizer) SetLocale(channel, chatID, locale string) error {
+	key := channel + ":" + chatID
+	l.mu.RLock()
+	store := l.store
+	l.mu.RUnlock()
+
+	if store != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		var err error
+		if locale == "" {
+			err = store.Delete(ctx, bucket, key)
+		} else {
+			err = state.PutJSON(ctx, store, bucket, key, locale)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	l.mu.Lock()
+	l.chats[key] = locale
+	l.mu.Unlock()
+	return nil
+}
+
+// T formats the message for key in the chat's locale.
+func (l *Localizer) T(channel, chatID, key string, args ...interface{}) string {
+	return l.Catalog().T(l.Locale(channel, chatID), key, args...)
+}
+
+// Default is the process-wide localizer. Until the gateway configures it
+// every chat gets English from the built-in catalog.
+var Default = NewLocalizer(nil, Fallback, nil)
+
+// T formats the message for key in the chat's locale using Default.
+func T(channel, chatID, key string, args ...interface{}) string {
+	return Default.T(channel, chatID, key, args...)
+}
@@ -0,0 +1,159 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+// Package leader elects one of several gateway instances sharing a state
+// store to hold each role, such as a channel connection, so the others
+// stand by and take over when the holder fails.
+package leader
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+// leasesBucket holds one lease per role.
+const leasesBucket = "leader"
+
+// Elector campaigns for roles on behalf of one instance. A role is held
+// through a lease that is renewed three times per TTL; an instance that
+// stops renewing loses the role to another within one TTL.
+type Elector struct {
+	store state.Store
+	id    string
+	ttl   time.Duration
+
+	mu   sync.Mutex
+	held map[string]bool
+}
+
+// NewElector campaigns as id, which must be unique among the instances.
+func NewElector(store state.Store, id string, ttl time.Duration) *Elector {
+	return &Elector{store: store, id: id, ttl: ttl, held: make(map[string]bool)}
+}
+
+// DefaultID identifies this process as "hostname:pid".
+func DefaultID() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
+}
+
+// ID returns the instance ID.
+func (e *Elector) ID() string {
+	return e.id
+}
+
+// Holds reports whether this instance holds role.
+func (e *Elector) Holds(role string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.held[role]
+}
+
+// Run campaigns for role until ctx is cancelled. onElected runs when this
+// instance takes the role and onDemoted when it loses it or Run returns
+// while holding it. The callbacks run one at a time on their own
+// goroutine, so a slow start, such as waiting for a QR scan, does not hold
+// up renewals. The lease is released only after onDemoted has returned,
+// so two instances never hold the role at once.
+func (e *Elector) Run(ctx context.Context, role string, onElected, onDemoted func()) {
+	var (
+		mu   sync.Mutex
+		want bool
+	)
+	wake := make(chan struct{}, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		applied := false
+		for range wake {
+			mu.Lock()
+			w := want
+			mu.Unlock()
+			if w == applied {
+				continue
+			}
+			applied = w
+			if w {
+				onElected()
+			} else {
+				onDemoted()
+			}
+		}
+		if applied {
+			onDemoted()
+		}
+	}()
+
+	leading := false
+	var renewed time.Time
+	campaign := func() {
+		held, err := e.store.Lease(ctx, leasesBucket, role, e.id, e.ttl)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logger.WarnCF("leader", "Failed to renew lease",
+				map[string]interface{}{"role": role, "error": err.Error()})
+			// Ride out a brief store outage, but give the role up well
+			// before the lease can pass to another instance.
+			held = leading && time.Since(renewed) < e.ttl/2
+		} else if held {
+			renewed = time.Now()
+		}
+		if held == leading {
+			return
+		}
+
+		leading = held
+		e.mu.Lock()
+		e.held[role] = held
+		e.mu.Unlock()
+		if held {
+			logger.InfoCF("leader", "Elected", map[string]interface{}{"role": role, "instance": e.id})
+		} else {
+			logger.WarnCF("leader", "Lost role", map[string]interface{}{"role": role, "instance": e.id})
+		}
+
+		mu.Lock()
+		want = held
+		mu.Unlock()
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+
+	campaign()
+	ticker := time.NewTicker(e.ttl / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			close(wake)
+			<-done
+			e.mu.Lock()
+			delete(e.held, role)
+			e.mu.Unlock()
+			if leading {
+				releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				if err := e.store.Release(releaseCtx, leasesBucket, role, e.id); err != nil {
+					logger.WarnCF("leader", "Failed to release lease",
+						map[string]interface{}{"role": role, "error": err.Error()})
+				}
+				cancel()
+			}
+			return
+		case <-ticker.C:
+			campaign()
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package leader
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestElectorFailover(t *testing.T) {
+	store := state.NewMemoryStore()
+	defer store.Close()
+
+	var active int32
+	var maxActive int32
+	var mu sync.Mutex
+	track := func(delta int32) {
+		mu.Lock()
+		defer mu.Unlock()
+		active += delta
+		if active > maxActive {
+			maxActive = active
+		}
+	}
+
+	a := NewElector(store, "a", 60*time.Millisecond)
+	b := NewElector(store, "b", 60*time.Millisecond)
+
+	ctxA, cancelA := context.WithCancel(context.Background())
+	doneA := make(chan struct{})
+	go func() {
+		a.Run(ctxA, "channel:whatsapp", func() { track(1) }, func() { track(-1) })
+		close(doneA)
+	}()
+	waitFor(t, "a elected", func() bool { return a.Holds("channel:whatsapp") })
+
+	ctxB, cancelB := context.WithCancel(context.Background())
+	defer cancelB()
+	var bElected atomic.Bool
+	go b.Run(ctxB, "channel:whatsapp", func() { bElected.Store(true); track(1) }, func() { track(-1) })
+
+	time.Sleep(150 * time.Millisecond)
+	if b.Holds("channel:whatsapp") || bElected.Load() {
+		t.Fatal("standby took the role while the leader was renewing")
+	}
+
+	cancelA()
+	<-doneA
+	if a.Holds("channel:whatsapp") {
+		t.Error("a still holds the role after Run returned")
+	}
+	waitFor(t, "b elected", func() bool { return b.Holds("channel:whatsapp") && bElected.Load() })
+
+	mu.Lock()
+	defer mu.Unlock()
+	if maxActive != 1 {
+		t.Errorf("max active holders = %d, want 1", maxActive)
+	}
+}
+
+func TestElectorRolesAreIndependent(t *testing.T) {
+	store := state.NewMemoryStore()
+	defer store.Close()
+
+	a := NewElector(store, "a", time.Second)
+	b := NewElector(store, "b", time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	nop := func() {}
+	go a.Run(ctx, "channel:slack", nop, nop)
+	waitFor(t, "a elected", func() bool { return a.Holds("channel:slack") })
+	go b.Run(ctx, "scheduler", nop, nop)
+	waitFor(t, "b elected", func() bool { return b.Holds("scheduler") })
+
+	if a.Holds("scheduler") || b.Holds("channel:slack") {
+		t.Error("an instance holds a role it did not campaign for")
+	}
+}
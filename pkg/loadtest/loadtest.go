@@ -0,0 +1,359 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+// Package loadtest measures how many messages the gateway can take on the
+// machine it runs on. Synthetic messages arrive on a fake channel at a
+// fixed rate, something answers them (Echo, or the agent loop with Model),
+// and Run reports throughput, reply latency, and how the queues behaved.
+package loadtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+const (
+	// tick is how often the generator catches up with the rate.
+	tick = 10 * time.Millisecond
+	// sampleInterval is how often queues and memory are sampled.
+	sampleInterval = 100 * time.Millisecond
+	// blockedAfter is how long a message may wait to get on the inbound
+	// queue before it counts as held back by a full queue.
+	blockedAfter = 10 * time.Millisecond
+)
+
+// Options configures a load test.
+type Options struct {
+	Rate     float64       // Inbound messages per second
+	Duration time.Duration // How long to send messages
+	Chats    int           // Distinct chats the messages come from
+	Size     int           // Characters per message
+	// Drain is how long to wait for outstanding replies after Duration.
+	Drain time.Duration
+	// Progress, when set, is called with the report so far every second.
+	Progress func(Report)
+}
+
+func (o Options) withDefaults() Options {
+	if o.Rate <= 0 {
+		o.Rate = 10
+	}
+	if o.Duration <= 0 {
+		o.Duration = 30 * time.Second
+	}
+	if o.Chats <= 0 {
+		o.Chats = 10
+	}
+	if o.Size <= 0 {
+		o.Size = 100
+	}
+	if o.Drain <= 0 {
+		o.Drain = 10 * time.Second
+	}
+	return o
+}
+
+// Report is the outcome of a load test.
+type Report struct {
+	Rate    float64       // Requested messages per second
+	Sent    int           // Messages received by the fake channel
+	Replied int           // Messages answered
+	Elapsed time.Duration // From the first message to the last reply
+
+	// Latency from a message arriving to its reply being sent.
+	P50, P90, P99, Max time.Duration
+
+	// Blocked counts messages that waited for room on the full inbound
+	// queue; LongestBlock is the longest wait.
+	Blocked      int
+	LongestBlock time.Duration
+
+	MaxInbound, MaxOutbound int // Deepest bus queues seen
+	MaxHeap                 uint64
+	MaxGoroutines           int
+}
+
+// Throughput is replies per second.
+func (r Report) Throughput() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Replied) / r.Elapsed.Seconds()
+}
+
+// Print writes the report for people.
+func (r Report) Print(w io.Writer) {
+	fmt.Fprintf(w, "Messages:    %d sent at %g/s, %d replied", r.Sent, r.Rate, r.Replied)
+	if missing := r.Sent - r.Replied; missing > 0 {
+		fmt.Fprintf(w, " (%d unanswered)", missing)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Throughput:  %.1f replies/s over %s\n", r.Throughput(), r.Elapsed.Round(time.Millisecond))
+	fmt.Fprintf(w, "Latency:     p50 %s  p90 %s  p99 %s  max %s\n",
+		round(r.P50), round(r.P90), round(r.P99), round(r.Max))
+	fmt.Fprintf(w, "Queues:      inbound max %d, outbound max %d", r.MaxInbound, r.MaxOutbound)
+	if r.Blocked > 0 {
+		fmt.Fprintf(w, ", %d messages waited for a full inbound queue (up to %s)", r.Blocked, round(r.LongestBlock))
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Memory:      heap max %.1f MB, goroutines max %d\n", float64(r.MaxHeap)/(1<<20), r.MaxGoroutines)
+}
+
+func round(d time.Duration) time.Duration {
+	if d < time.Millisecond {
+		return d.Round(time.Microsecond)
+	}
+	return d.Round(100 * time.Microsecond)
+}
+
+// seqPattern finds the sequence number a reply answers.
+var seqPattern = regexp.MustCompile(`load #(\d+)`)
+
+// run is one load test in progress.
+type run struct {
+	opts   Options
+	msgBus *bus.MessageBus
+	fake   *channels.Fake
+
+	mu        sync.Mutex
+	report    Report
+	start     time.Time
+	arrived   map[int]time.Time // Sent and not answered yet
+	receiving time.Time         // When the message being put on the bus arrived
+	latencies []time.Duration
+}
+
+// Run sends messages on fake, which must be registered with a started
+// channel manager on msgBus, while something answers them, and waits for
+// the replies. Cancelling ctx ends the test early with what was measured.
+func Run(ctx context.Context, opts Options, msgBus *bus.MessageBus, fake *channels.Fake) (Report, error) {
+	if msgBus == nil || fake == nil {
+		return Report{}, errors.New("load test needs a bus and a fake channel")
+	}
+	r := &run{
+		opts:    opts.withDefaults(),
+		msgBus:  msgBus,
+		fake:    fake,
+		arrived: make(map[int]time.Time),
+	}
+	r.report.Rate = r.opts.Rate
+	r.start = time.Now()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	sending := make(chan struct{})
+	go func() {
+		defer close(sending)
+		r.generate(ctx)
+	}()
+	go r.sample(ctx)
+
+	collectCtx, stopCollecting := context.WithCancel(ctx)
+	defer stopCollecting()
+	collected := make(chan struct{})
+	go func() {
+		defer close(collected)
+		r.collect(collectCtx)
+	}()
+
+	// A generator stuck on a full inbound queue is given up on with the
+	// replies still missing
+	stop := time.After(r.opts.Duration + r.opts.Drain)
+	poll := time.NewTicker(sampleInterval)
+	defer poll.Stop()
+	finished := func() bool {
+		select {
+		case <-sending:
+			return r.answered()
+		default:
+			return false
+		}
+	}
+wait:
+	for !finished() {
+		select {
+		case <-stop:
+			break wait
+		case <-ctx.Done():
+			break wait
+		case <-poll.C:
+		}
+	}
+	stopCollecting()
+	<-collected
+	return r.finish(), nil
+}
+
+// generate sends messages at the requested rate until the duration is up.
+func (r *run) generate(ctx context.Context) {
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	padding := strings.Repeat("x", max(r.opts.Size-len("load #0000 "), 0))
+	sent := 0
+	for {
+		elapsed := min(time.Since(r.start), r.opts.Duration)
+		due := int(r.opts.Rate * elapsed.Seconds())
+		for ; sent < due && ctx.Err() == nil; sent++ {
+			chat := strconv.Itoa(sent % r.opts.Chats)
+			arrived := time.Now()
+			r.mu.Lock()
+			r.arrived[sent] = arrived
+			r.report.Sent++
+			r.receiving = arrived
+			r.mu.Unlock()
+			r.fake.Receive("loadtest-"+chat, chat, fmt.Sprintf("load #%04d %s", sent, padding))
+			r.mu.Lock()
+			r.report = r.blocked(r.report)
+			r.receiving = time.Time{}
+			r.mu.Unlock()
+		}
+		if elapsed == r.opts.Duration {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// collect matches replies to the messages they answer.
+func (r *run) collect(ctx context.Context) {
+	for {
+		msg, err := r.fake.Next(ctx)
+		if err != nil {
+			return
+		}
+		m := seqPattern.FindStringSubmatch(msg.Content)
+		if m == nil {
+			continue
+		}
+		seq, _ := strconv.Atoi(m[1])
+		now := time.Now()
+		r.mu.Lock()
+		if arrived, ok := r.arrived[seq]; ok {
+			delete(r.arrived, seq)
+			r.latencies = append(r.latencies, now.Sub(arrived))
+			r.report.Replied++
+			r.report.Elapsed = now.Sub(r.start)
+		}
+		r.mu.Unlock()
+	}
+}
+
+// sample records queue depths and memory use, and reports progress.
+func (r *run) sample(ctx context.Context) {
+	ticker := time.NewTicker(sampleInterval)
+	defer ticker.Stop()
+	var mem runtime.MemStats
+	for i := 1; ; i++ {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		inbound, outbound := r.msgBus.QueueLengths()
+		goroutines := runtime.NumGoroutine()
+		if i%5 == 1 {
+			runtime.ReadMemStats(&mem)
+		}
+		r.mu.Lock()
+		r.report.MaxInbound = max(r.report.MaxInbound, inbound)
+		r.report.MaxOutbound = max(r.report.MaxOutbound, outbound)
+		r.report.MaxGoroutines = max(r.report.MaxGoroutines, goroutines)
+		r.report.MaxHeap = max(r.report.MaxHeap, mem.HeapAlloc)
+		r.mu.Unlock()
+		if r.opts.Progress != nil && i%10 == 0 {
+			r.opts.Progress(r.finish())
+		}
+	}
+}
+
+func (r *run) answered() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.arrived) == 0
+}
+
+// finish returns the report with latency percentiles filled in.
+func (r *run) finish() Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// A message still waiting for room counts as blocked
+	report := r.blocked(r.report)
+	if report.Elapsed == 0 {
+		report.Elapsed = time.Since(r.start)
+	}
+	latencies := append([]time.Duration(nil), r.latencies...)
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	if n := len(latencies); n > 0 {
+		report.P50 = latencies[n*50/100]
+		report.P90 = latencies[n*90/100]
+		report.P99 = latencies[n*99/100]
+		report.Max = latencies[n-1]
+	}
+	return report
+}
+
+// blocked adds the message being put on the bus to report if it has
+// waited for room long enough. r.mu must be held.
+func (r *run) blocked(report Report) Report {
+	if r.receiving.IsZero() {
+		return report
+	}
+	if wait := time.Since(r.receiving); wait >= blockedAfter {
+		report.Blocked++
+		report.LongestBlock = max(report.LongestBlock, wait)
+	}
+	return report
+}
+
+// Echo answers every inbound message on msgBus with its own text until ctx
+// is done, standing in for the agent to measure the gateway alone.
+func Echo(ctx context.Context, msgBus *bus.MessageBus) {
+	for {
+		msg, ok := msgBus.ConsumeInbound(ctx)
+		if !ok {
+			return
+		}
+		msgBus.PublishOutbound(bus.OutboundMessage{
+			Channel: msg.Channel,
+			ChatID:  msg.ChatID,
+			Content: "re: " + msg.Content,
+		})
+	}
+}
+
+// Model is an LLM provider that answers at once with the latest user
+// message, so the agent loop can be load tested without a real model.
+type Model struct{}
+
+func (Model) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			return &providers.LLMResponse{Content: "re: " + messages[i].Content}, nil
+		}
+	}
+	return &providers.LLMResponse{Content: "ok"}, nil
+}
+
+func (Model) GetDefaultModel() string {
+	return "loadtest"
+}
@@ -0,0 +1,94 @@
+package loadtest
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+func TestRun(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	manager, err := channels.NewManager(&config.Config{}, msgBus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := channels.NewFake("loadtest", msgBus, nil)
+	manager.RegisterChannel("loadtest", fake)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := manager.StartAll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer manager.StopAll(context.Background())
+	go Echo(ctx, msgBus)
+
+	var progress int
+	report, err := Run(ctx, Options{Rate: 200, Duration: 1100 * time.Millisecond, Chats: 3, Size: 50,
+		Progress: func(Report) { progress++ }}, msgBus, fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Sent < 200 || report.Replied != report.Sent {
+		t.Errorf("sent %d, replied %d", report.Sent, report.Replied)
+	}
+	if report.P50 <= 0 || report.P50 > report.P99 || report.P99 > report.Max {
+		t.Errorf("latencies p50 %s p99 %s max %s", report.P50, report.P99, report.Max)
+	}
+	if report.Throughput() < 100 || report.MaxGoroutines == 0 || report.MaxHeap == 0 {
+		t.Errorf("report = %+v", report)
+	}
+	if progress == 0 {
+		t.Error("progress was never reported")
+	}
+	// Chats are answered independently, so the first reply may be to any of them
+	if got := fake.Sent()[0].Content; !strings.HasPrefix(got, "re: load #000") || len(got) != len("re: ")+50 {
+		t.Errorf("first reply = %q", got)
+	}
+
+	var out bytes.Buffer
+	report.Print(&out)
+	for _, want := range []string{"sent at 200/s", "replies/s", "p50", "inbound max", "heap max"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("report missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestRunReportsUnanswered(t *testing.T) {
+	msgBus := bus.NewMessageBus()
+	fake := channels.NewFake("loadtest", msgBus, nil)
+	// Nothing consumes the bus, so the inbound queue fills and stays full
+	report, err := Run(context.Background(), Options{Rate: 1000, Duration: 300 * time.Millisecond, Drain: 100 * time.Millisecond}, msgBus, fake)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Replied != 0 || report.Sent == 0 {
+		t.Errorf("sent %d, replied %d", report.Sent, report.Replied)
+	}
+	if report.MaxInbound != 100 || report.Blocked == 0 {
+		t.Errorf("queue max %d, blocked %d", report.MaxInbound, report.Blocked)
+	}
+	var out bytes.Buffer
+	report.Print(&out)
+	if !strings.Contains(out.String(), "unanswered") || !strings.Contains(out.String(), "waited for a full inbound queue") {
+		t.Errorf("report:\n%s", out.String())
+	}
+}
+
+func TestModel(t *testing.T) {
+	resp, err := Model{}.Chat(context.Background(), []providers.Message{
+		{Role: "system", Content: "be brief"},
+		{Role: "user", Content: "load #0007 x"},
+		{Role: "assistant", Content: "thinking"},
+	}, nil, "", nil)
+	if err != nil || resp.Content != "re: load #0007 x" {
+		t.Errorf("Chat() = %+v, %v", resp, err)
+	}
+}
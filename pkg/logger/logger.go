@@ -40,6 +40,21 @@ type Logger struct {
 	file *os.File
 }
 
+// recentSize is how many formatted lines Recent can return.
+const recentSize = 200
+
+var (
+	recentMu    sync.Mutex
+	recentLines [recentSize]string
+	recentNext  int
+	recentCount int
+)
+
+var (
+	hooksMu sync.RWMutex
+	hooks   []func(LogEntry)
+)
+
 type LogEntry struct {
 	Level     string                 `json:"level"`
 	Timestamp string                 `json:"timestamp"`
@@ -137,12 +152,59 @@ func logMessage(level LogLevel, component string, message string, fields map[str
 	)
 
 	log.Println(logLine)
+	remember(logLine)
+	runHooks(entry)
 
 	if level == FATAL {
 		os.Exit(1)
 	}
 }
 
+// AddHook registers fn to be called with every entry that passes the level
+// filter. fn runs on the logging goroutine, so it must be quick and must
+// not log.
+func AddHook(fn func(LogEntry)) {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	hooks = append(hooks, fn)
+}
+
+func runHooks(entry LogEntry) {
+	hooksMu.RLock()
+	defer hooksMu.RUnlock()
+	for _, fn := range hooks {
+		fn(entry)
+	}
+}
+
+func remember(line string) {
+	recentMu.Lock()
+	defer recentMu.Unlock()
+	recentLines[recentNext] = line
+	recentNext = (recentNext + 1) % recentSize
+	if recentCount < recentSize {
+		recentCount++
+	}
+}
+
+// Recent returns up to the last n logged lines, oldest first.
+func Recent(n int) []string {
+	recentMu.Lock()
+	defer recentMu.Unlock()
+	if n > recentCount {
+		n = recentCount
+	}
+	if n <= 0 {
+		return nil
+	}
+	out := make([]string, n)
+	start := (recentNext - n + recentSize) % recentSize
+	for i := range out {
+		out[i] = recentLines[(start+i)%recentSize]
+	}
+	return out
+}
+
 func formatComponent(component string) string {
 	if component == "" {
 		return ""
@@ -1,6 +1,8 @@
 package logger
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 )
 
@@ -137,3 +139,49 @@ func TestLoggerHelperFunctions(t *testing.T) {
 	DebugC("test", "Debug with component")
 	WarnF("Warning with fields", map[string]interface{}{"key": "value"})
 }
+
+func TestRecent(t *testing.T) {
+	Info("recent test first")
+	Info("recent test second")
+
+	lines := Recent(2)
+	if len(lines) != 2 {
+		t.Fatalf("Recent(2) returned %d lines", len(lines))
+	}
+	if !strings.Contains(lines[0], "recent test first") || !strings.Contains(lines[1], "recent test second") {
+		t.Errorf("Recent(2) = %q, want the last two lines oldest first", lines)
+	}
+
+	for i := 0; i < recentSize+10; i++ {
+		Info(fmt.Sprintf("filler %d", i))
+	}
+	lines = Recent(recentSize + 50)
+	if len(lines) != recentSize {
+		t.Fatalf("Recent returned %d lines, want %d", len(lines), recentSize)
+	}
+	if want := fmt.Sprintf("filler %d", recentSize+9); !strings.HasSuffix(lines[len(lines)-1], want) {
+		t.Errorf("last line = %q, want suffix %q", lines[len(lines)-1], want)
+	}
+	if Recent(0) != nil {
+		t.Error("Recent(0) should be nil")
+	}
+}
+
+func TestAddHook(t *testing.T) {
+	var got []LogEntry
+	AddHook(func(e LogEntry) {
+		if e.Component == "hooktest" {
+			got = append(got, e)
+		}
+	})
+
+	DebugC("hooktest", "filtered out")
+	ErrorCF("hooktest", "boom", map[string]interface{}{"code": 7})
+
+	if len(got) != 1 {
+		t.Fatalf("hook saw %d entries, want 1", len(got))
+	}
+	if got[0].Level != "ERROR" || got[0].Message != "boom" || got[0].Fields["code"] != 7 {
+		t.Errorf("hook entry = %+v", got[0])
+	}
+}
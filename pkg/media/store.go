@@ -0,0 +1,195 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+// Package media keeps copies of files the gateway shares by link, for
+// attachments a channel cannot take, and serves them at signed URLs that
+// expire.
+package media
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/events"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// Prefix is the URL path links are served under.
+const Prefix = "/media/"
+
+// secretFile holds the key links are signed with, so links survive
+// restarts.
+const secretFile = ".secret"
+
+// Store copies files into a directory and hands out links to them.
+type Store struct {
+	dir     string
+	baseURL string
+	ttl     time.Duration
+	secret  []byte
+	now     func() time.Time
+}
+
+// NewStore returns a store keeping files in dir for ttl and linking to
+// them under baseURL, e.g. "https://bot.example.com".
+func NewStore(dir, baseURL string, ttl time.Duration) (*Store, error) {
+	if baseURL == "" {
+		return nil, errors.New("media store needs a public URL")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	secret, err := loadSecret(filepath.Join(dir, secretFile))
+	if err != nil {
+		return nil, err
+	}
+	return &Store{
+		dir:     dir,
+		baseURL: strings.TrimRight(baseURL, "/"),
+		ttl:     ttl,
+		secret:  secret,
+		now:     time.Now,
+	}, nil
+}
+
+func loadSecret(path string) ([]byte, error) {
+	if data, err := os.ReadFile(path); err == nil && len(data) >= 32 {
+		return data, nil
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, secret, 0o600); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// Share copies the file at path into the store and returns a link to it
+// that works until the store's TTL runs out.
+func (s *Store) Share(path string) (string, error) {
+	s.Prune()
+
+	idBytes := make([]byte, 8)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(idBytes)
+	name := filepath.Base(path)
+	if err := os.Mkdir(filepath.Join(s.dir, id), 0o700); err != nil {
+		return "", err
+	}
+	if err := copyFile(path, filepath.Join(s.dir, id, name)); err != nil {
+		os.RemoveAll(filepath.Join(s.dir, id))
+		return "", err
+	}
+
+	expires := strconv.FormatInt(s.now().Add(s.ttl).Unix(), 10)
+	q := url.Values{"expires": {expires}, "sig": {s.sign(id, name, expires)}}
+	return s.baseURL + Prefix + id + "/" + url.PathEscape(name) + "?" + q.Encode(), nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func (s *Store) sign(id, name, expires string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "%s/%s\n%s", id, name, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Prune deletes files shared longer ago than the TTL and returns how many
+// it removed.
+func (s *Store) Prune() int {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return 0
+	}
+	removed := 0
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || !e.IsDir() || s.now().Sub(info.ModTime()) < s.ttl {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(s.dir, e.Name())); err == nil {
+			removed++
+		}
+	}
+	if removed > 0 {
+		logger.DebugCF("media", "Pruned expired shared files", map[string]interface{}{"count": removed})
+	}
+	return removed
+}
+
+// Handler serves shared files at Prefix + "<id>/<name>". Links with a
+// bad signature or past their expiry get 404 and 410.
+func (s *Store) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		id, name, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, Prefix), "/")
+		expires := r.URL.Query().Get("expires")
+		sig := r.URL.Query().Get("sig")
+		if !ok || id == "" || name == "" || strings.ContainsAny(id+name, `/\`) ||
+			subtle.ConstantTimeCompare([]byte(sig), []byte(s.sign(id, name, expires))) != 1 {
+			events.Security("media", "Rejected media link with a bad signature", map[string]interface{}{
+				"remote": r.RemoteAddr,
+				"path":   r.URL.Path,
+			})
+			http.NotFound(w, r)
+			return
+		}
+		exp, err := strconv.ParseInt(expires, 10, 64)
+		if err != nil || s.now().Unix() > exp {
+			http.Error(w, "this link has expired", http.StatusGone)
+			return
+		}
+
+		f, err := os.Open(filepath.Join(s.dir, id, name))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+		http.ServeContent(w, r, name, info.ModTime(), f)
+	})
+}
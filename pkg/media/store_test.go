@@ -0,0 +1,107 @@
+package media
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestStore(t *testing.T) (*Store, string) {
+	t.Helper()
+	dir := t.TempDir()
+	s, err := NewStore(filepath.Join(dir, "store"), "https://bot.example.com/", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(dir, "big report.pdf")
+	if err := os.WriteFile(src, []byte("%PDF report"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return s, src
+}
+
+func get(t *testing.T, s *Store, link string) *httptest.ResponseRecorder {
+	t.Helper()
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, u.RequestURI(), nil))
+	return rec
+}
+
+func TestShare(t *testing.T) {
+	s, src := newTestStore(t)
+	link, err := s.Share(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(link, "https://bot.example.com/media/") || !strings.Contains(link, "big%20report.pdf?") {
+		t.Fatalf("link = %q", link)
+	}
+
+	tests := []struct {
+		name string
+		link string
+		code int
+	}{
+		{"valid", link, http.StatusOK},
+		{"bad signature", link[:len(link)-4] + "0000", http.StatusNotFound},
+		{"other file", strings.Replace(link, "big%20report.pdf", ".secret", 1), http.StatusNotFound},
+		{"no signature", strings.Split(link, "?")[0], http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := get(t, s, tt.link)
+			if rec.Code != tt.code {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.code)
+			}
+			if tt.code == http.StatusOK {
+				if rec.Body.String() != "%PDF report" {
+					t.Errorf("body = %q", rec.Body.String())
+				}
+				if cd := rec.Header().Get("Content-Disposition"); !strings.Contains(cd, "big report.pdf") {
+					t.Errorf("Content-Disposition = %q", cd)
+				}
+			}
+		})
+	}
+}
+
+func TestShareExpires(t *testing.T) {
+	s, src := newTestStore(t)
+	link, err := s.Share(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	later := time.Now().Add(2 * time.Hour)
+	s.now = func() time.Time { return later }
+	if rec := get(t, s, link); rec.Code != http.StatusGone {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusGone)
+	}
+	if n := s.Prune(); n != 1 {
+		t.Errorf("Prune() = %d, want 1", n)
+	}
+}
+
+func TestSecretSurvivesRestart(t *testing.T) {
+	s, src := newTestStore(t)
+	link, err := s.Share(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := NewStore(s.dir, "https://bot.example.com", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec := get(t, reopened, link); rec.Code != http.StatusOK {
+		t.Errorf("status = %d after restart", rec.Code)
+	}
+}
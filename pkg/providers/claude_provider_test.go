@@ -31,6 +31,23 @@ func TestBuildClaudeParams_BasicMessage(t *testing.T) {
 	}
 }
 
+func TestBuildClaudeParams_ImageAttachment(t *testing.T) {
+	messages := []Message{
+		{Role: "user", Content: "What's in this photo?", Images: []Image{{MIMEType: "image/png", Data: []byte("png")}}},
+	}
+	params, err := buildClaudeParams(messages, nil, "claude-sonnet-4-5-20250929", map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("buildClaudeParams() error: %v", err)
+	}
+	blocks := params.Messages[0].Content
+	if len(blocks) != 2 {
+		t.Fatalf("len(Content) = %d, want 2", len(blocks))
+	}
+	if blocks[1].OfImage == nil {
+		t.Errorf("second block is not an image: %+v", blocks[1])
+	}
+}
+
 func TestBuildClaudeParams_SystemMessage(t *testing.T) {
 	messages := []Message{
 		{Role: "system", Content: "You are helpful"},
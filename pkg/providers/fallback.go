@@ -0,0 +1,246 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+const (
+	defaultFailureThreshold = 3
+	defaultBreakerCooldown  = 60 * time.Second
+)
+
+// FallbackEntry is one provider in a fallback chain.
+type FallbackEntry struct {
+	Name     string
+	Provider LLMProvider
+	Model    string // Model to request; empty uses the caller's model
+}
+
+// FallbackOptions tunes failover.
+type FallbackOptions struct {
+	// FailureThreshold is how many consecutive failures open a provider's
+	// circuit breaker.
+	FailureThreshold int
+	// Cooldown is how long an open breaker skips its provider before one
+	// trial request is let through again.
+	Cooldown time.Duration
+	// Timeout bounds each attempt; 0 leaves it to the provider.
+	Timeout time.Duration
+}
+
+// FallbackProvider tries providers in order until one answers. Each
+// provider has a circuit breaker, so one that keeps failing is skipped for
+// a while instead of delaying every request. When every breaker is open all
+// providers are tried anyway, so the assistant degrades rather than going
+// silent.
+type FallbackProvider struct {
+	entries []*breakerEntry
+	opts    FallbackOptions
+	now     func() time.Time
+}
+
+type breakerEntry struct {
+	FallbackEntry
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+func NewFallbackProvider(entries []FallbackEntry, opts FallbackOptions) *FallbackProvider {
+	if opts.FailureThreshold <= 0 {
+		opts.FailureThreshold = defaultFailureThreshold
+	}
+	if opts.Cooldown <= 0 {
+		opts.Cooldown = defaultBreakerCooldown
+	}
+	p := &FallbackProvider{opts: opts, now: time.Now}
+	for _, e := range entries {
+		p.entries = append(p.entries, &breakerEntry{FallbackEntry: e})
+	}
+	return p
+}
+
+func (p *FallbackProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
+	return p.try(ctx, model, func(ctx context.Context, e *breakerEntry, model string) (*LLMResponse, bool, error) {
+		resp, err := e.Provider.Chat(ctx, messages, tools, model, options)
+		return resp, false, err
+	})
+}
+
+// ChatStream streams from the first provider that answers. A provider that
+// fails after it has streamed output is not failed over, since the partial
+// answer has already reached the user.
+func (p *FallbackProvider) ChatStream(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}, onDelta func(delta string)) (*LLMResponse, error) {
+	return p.try(ctx, model, func(ctx context.Context, e *breakerEntry, model string) (*LLMResponse, bool, error) {
+		sp, ok := e.Provider.(StreamingProvider)
+		if !ok {
+			resp, err := e.Provider.Chat(ctx, messages, tools, model, options)
+			return resp, false, err
+		}
+		streamed := false
+		resp, err := sp.ChatStream(ctx, messages, tools, model, options, func(delta string) {
+			streamed = true
+			onDelta(delta)
+		})
+		return resp, streamed, err
+	})
+}
+
+func (p *FallbackProvider) GetDefaultModel() string {
+	if len(p.entries) == 0 {
+		return ""
+	}
+	return p.entries[0].Provider.GetDefaultModel()
+}
+
+// try calls attempt on each available provider in order. attempt reports
+// whether output already reached the user, which stops failover.
+func (p *FallbackProvider) try(ctx context.Context, model string, attempt func(context.Context, *breakerEntry, string) (*LLMResponse, bool, error)) (*LLMResponse, error) {
+	var errs []error
+	for _, e := range p.available() {
+		entryModel := model
+		if e.Model != "" {
+			entryModel = e.Model
+		}
+
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if p.opts.Timeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, p.opts.Timeout)
+		}
+		resp, streamed, err := attempt(attemptCtx, e, entryModel)
+		cancel()
+
+		if err == nil {
+			p.recordSuccess(e)
+			return resp, nil
+		}
+		if ctx.Err() != nil {
+			// The caller gave up; that says nothing about the provider.
+			return nil, err
+		}
+
+		p.recordFailure(e)
+		errs = append(errs, fmt.Errorf("%s: %w", e.Name, err))
+		logger.WarnCF("provider", "Provider failed",
+			map[string]interface{}{
+				"provider": e.Name,
+				"model":    entryModel,
+				"error":    err.Error(),
+			})
+		if streamed {
+			break
+		}
+	}
+
+	if len(errs) == 1 {
+		return nil, errs[0]
+	}
+	return nil, fmt.Errorf("all providers failed: %w", errors.Join(errs...))
+}
+
+// available returns the providers whose breaker lets a request through, or
+// all of them when none does.
+func (p *FallbackProvider) available() []*breakerEntry {
+	now := p.now()
+	var out []*breakerEntry
+	for _, e := range p.entries {
+		e.mu.Lock()
+		open := now.Before(e.openUntil)
+		e.mu.Unlock()
+		if !open {
+			out = append(out, e)
+		}
+	}
+	if len(out) == 0 {
+		return p.entries
+	}
+	return out
+}
+
+func (p *FallbackProvider) recordSuccess(e *breakerEntry) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.failures >= p.opts.FailureThreshold {
+		logger.InfoCF("provider", "Provider recovered", map[string]interface{}{"provider": e.Name})
+	}
+	e.failures = 0
+	e.openUntil = time.Time{}
+}
+
+// recordFailure counts a failure and opens the breaker once the threshold
+// is reached. A failed trial request after the cooldown reopens it at once.
+func (p *FallbackProvider) recordFailure(e *breakerEntry) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.failures++
+	if e.failures >= p.opts.FailureThreshold {
+		e.openUntil = p.now().Add(p.opts.Cooldown)
+		logger.WarnCF("provider", "Circuit breaker open",
+			map[string]interface{}{
+				"provider": e.Name,
+				"failures": e.failures,
+				"cooldown": p.opts.Cooldown.String(),
+			})
+	}
+}
+
+// createFallbackProvider builds the primary provider followed by the
+// configured fallbacks. Entries that cannot be built are skipped so a
+// misconfigured fallback never takes the primary down with it.
+func createFallbackProvider(cfg *config.Config) (LLMProvider, error) {
+	defaults := cfg.Agents.Defaults
+
+	var entries []FallbackEntry
+	var errs []error
+
+	primary, err := createProvider(cfg, defaults.Provider, defaults.Model)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("primary: %w", err))
+	} else {
+		entries = append(entries, FallbackEntry{Name: providerLabel(defaults.Provider, defaults.Model), Provider: primary})
+	}
+
+	for i, fb := range defaults.Fallbacks {
+		var provider LLMProvider
+		if fb.APIBase != "" {
+			provider = NewHTTPProvider(fb.APIKey, fb.APIBase, "")
+		} else {
+			provider, err = createProvider(cfg, fb.Provider, fb.Model)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("fallback %d: %w", i+1, err))
+				continue
+			}
+		}
+		entries = append(entries, FallbackEntry{Name: providerLabel(fb.Provider, fb.Model), Provider: provider, Model: fb.Model})
+	}
+
+	if len(entries) == 0 {
+		return nil, errors.Join(errs...)
+	}
+	for _, err := range errs {
+		logger.WarnCF("provider", "Skipping provider", map[string]interface{}{"error": err.Error()})
+	}
+
+	return NewFallbackProvider(entries, FallbackOptions{
+		Cooldown: time.Duration(defaults.FallbackCooldown) * time.Second,
+		Timeout:  time.Duration(defaults.FallbackTimeout) * time.Second,
+	}), nil
+}
+
+func providerLabel(provider, model string) string {
+	switch {
+	case provider != "" && model != "":
+		return provider + "/" + model
+	case provider != "":
+		return provider
+	default:
+		return model
+	}
+}
@@ -0,0 +1,172 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+type fakeProvider struct {
+	err    error
+	calls  int
+	models []string
+	deltas []string
+}
+
+func (f *fakeProvider) Chat(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) (*LLMResponse, error) {
+	f.calls++
+	f.models = append(f.models, model)
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &LLMResponse{Content: "ok from " + model}, nil
+}
+
+func (f *fakeProvider) GetDefaultModel() string { return "" }
+
+type fakeStreamProvider struct {
+	fakeProvider
+}
+
+func (f *fakeStreamProvider) ChatStream(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}, onDelta func(string)) (*LLMResponse, error) {
+	f.calls++
+	for _, d := range f.deltas {
+		onDelta(d)
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &LLMResponse{Content: strings.Join(f.deltas, "")}, nil
+}
+
+func TestFallbackProvider_FailsOver(t *testing.T) {
+	primary := &fakeProvider{err: errors.New("503 service unavailable")}
+	local := &fakeProvider{}
+	p := NewFallbackProvider([]FallbackEntry{
+		{Name: "cloud", Provider: primary},
+		{Name: "ollama", Provider: local, Model: "llama3.2:3b"},
+	}, FallbackOptions{})
+
+	resp, err := p.Chat(context.Background(), nil, nil, "gpt-4o", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Content != "ok from llama3.2:3b" {
+		t.Errorf("Content = %q", resp.Content)
+	}
+	if primary.models[0] != "gpt-4o" {
+		t.Errorf("primary got model %q, want caller's model", primary.models[0])
+	}
+}
+
+func TestFallbackProvider_CircuitBreaker(t *testing.T) {
+	primary := &fakeProvider{err: errors.New("timeout")}
+	backup := &fakeProvider{}
+	p := NewFallbackProvider([]FallbackEntry{
+		{Name: "primary", Provider: primary},
+		{Name: "backup", Provider: backup},
+	}, FallbackOptions{FailureThreshold: 2, Cooldown: time.Minute})
+	now := time.Now()
+	p.now = func() time.Time { return now }
+
+	for i := 0; i < 4; i++ {
+		if _, err := p.Chat(context.Background(), nil, nil, "m", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if primary.calls != 2 {
+		t.Errorf("primary called %d times, want 2 before the breaker opened", primary.calls)
+	}
+
+	// After the cooldown one trial request reaches the primary again
+	now = now.Add(2 * time.Minute)
+	primary.err = nil
+	resp, err := p.Chat(context.Background(), nil, nil, "m", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if primary.calls != 3 || resp.Content != "ok from m" {
+		t.Errorf("primary not retried after cooldown: calls=%d resp=%q", primary.calls, resp.Content)
+	}
+}
+
+func TestFallbackProvider_AllFailing(t *testing.T) {
+	a := &fakeProvider{err: errors.New("context_length_exceeded")}
+	b := &fakeProvider{err: errors.New("connection refused")}
+	p := NewFallbackProvider([]FallbackEntry{
+		{Name: "a", Provider: a},
+		{Name: "b", Provider: b},
+	}, FallbackOptions{FailureThreshold: 1})
+
+	_, err := p.Chat(context.Background(), nil, nil, "m", nil)
+	if err == nil || !strings.Contains(err.Error(), "context_length_exceeded") || !strings.Contains(err.Error(), "connection refused") {
+		t.Fatalf("error should name every failure, got %v", err)
+	}
+
+	// With every breaker open, all providers are still tried
+	p.Chat(context.Background(), nil, nil, "m", nil)
+	if a.calls != 2 || b.calls != 2 {
+		t.Errorf("calls = %d, %d; want both providers tried again", a.calls, b.calls)
+	}
+}
+
+func TestFallbackProvider_CanceledContextDoesNotFailOver(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	a := &fakeProvider{err: context.Canceled}
+	b := &fakeProvider{}
+	p := NewFallbackProvider([]FallbackEntry{{Name: "a", Provider: a}, {Name: "b", Provider: b}}, FallbackOptions{})
+
+	if _, err := p.Chat(ctx, nil, nil, "m", nil); err == nil {
+		t.Fatal("expected error")
+	}
+	if b.calls != 0 {
+		t.Error("fallback should not run after the caller canceled")
+	}
+}
+
+func TestFallbackProvider_StreamNoFailoverAfterOutput(t *testing.T) {
+	a := &fakeStreamProvider{fakeProvider{err: errors.New("stream reset"), deltas: []string{"Hel"}}}
+	b := &fakeStreamProvider{fakeProvider{deltas: []string{"Hello"}}}
+	p := NewFallbackProvider([]FallbackEntry{{Name: "a", Provider: a}, {Name: "b", Provider: b}}, FallbackOptions{})
+
+	if _, err := p.ChatStream(context.Background(), nil, nil, "m", nil, func(string) {}); err == nil {
+		t.Fatal("expected error once partial output was sent")
+	}
+	if b.calls != 0 {
+		t.Error("fallback should not run after partial output")
+	}
+
+	// A failure before any output fails over
+	a.deltas = nil
+	resp, err := p.ChatStream(context.Background(), nil, nil, "m", nil, func(string) {})
+	if err != nil || resp.Content != "Hello" {
+		t.Fatalf("ChatStream = %v, %v", resp, err)
+	}
+}
+
+func TestCreateProvider_Fallbacks(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Model = "gpt-4o"
+	cfg.Providers.OpenAI.APIKey = "sk-test"
+	cfg.Agents.Defaults.Fallbacks = []config.FallbackConfig{
+		{Model: "llama3.2:3b", APIBase: "http://localhost:11434/v1"},
+		{Provider: "groq"}, // not configured, skipped
+	}
+
+	p, err := CreateProvider(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp, ok := p.(*FallbackProvider)
+	if !ok {
+		t.Fatalf("got %T, want *FallbackProvider", p)
+	}
+	if len(fp.entries) != 2 {
+		t.Errorf("entries = %d, want primary and the Ollama fallback", len(fp.entries))
+	}
+}
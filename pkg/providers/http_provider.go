@@ -9,6 +9,7 @@ package providers
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -53,6 +54,42 @@ func (p *HTTPProvider) Chat(ctx context.Context, messages []Message, tools []Too
 		return nil, fmt.Errorf("API base not configured")
 	}
 
+	resp, err := p.doRequest(ctx, p.buildRequestBody(messages, tools, model, options))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	return p.parseResponse(body)
+}
+
+// ChatStream performs a streaming chat completion (server-sent events) and
+// calls onDelta for every content fragment. Tool call fragments are
+// accumulated and returned in the final response.
+func (p *HTTPProvider) ChatStream(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}, onDelta func(delta string)) (*LLMResponse, error) {
+	if p.apiBase == "" {
+		return nil, fmt.Errorf("API base not configured")
+	}
+
+	requestBody := p.buildRequestBody(messages, tools, model, options)
+	requestBody["stream"] = true
+	requestBody["stream_options"] = map[string]interface{}{"include_usage": true}
+
+	resp, err := p.doRequest(ctx, requestBody)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return parseStream(resp.Body, onDelta)
+}
+
+func (p *HTTPProvider) buildRequestBody(messages []Message, tools []ToolDefinition, model string, options map[string]interface{}) map[string]interface{} {
 	// Strip provider prefix from model name (e.g., nvidia/llama-3 -> llama-3)
 	if idx := strings.Index(model, "/"); idx != -1 {
 		prefix := model[:idx]
@@ -63,7 +100,7 @@ func (p *HTTPProvider) Chat(ctx context.Context, messages []Message, tools []Too
 
 	requestBody := map[string]interface{}{
 		"model":    model,
-		"messages": messages,
+		"messages": wireMessages(messages),
 	}
 
 	if len(tools) > 0 {
@@ -84,6 +121,12 @@ func (p *HTTPProvider) Chat(ctx context.Context, messages []Message, tools []Too
 		requestBody["temperature"] = temperature
 	}
 
+	return requestBody
+}
+
+// doRequest posts requestBody to the chat completions endpoint. On success
+// the caller owns resp.Body.
+func (p *HTTPProvider) doRequest(ctx context.Context, requestBody map[string]interface{}) (*http.Response, error) {
 	jsonData, err := json.Marshal(requestBody)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
@@ -103,18 +146,14 @@ func (p *HTTPProvider) Chat(ctx context.Context, messages []Message, tools []Too
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
 
 	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
 		return nil, fmt.Errorf("API request failed:\n  Status: %d\n  Body:   %s", resp.StatusCode, string(body))
 	}
 
-	return p.parseResponse(body)
+	return resp, nil
 }
 
 func (p *HTTPProvider) parseResponse(body []byte) (*LLMResponse, error) {
@@ -213,9 +252,25 @@ func createCodexAuthProvider() (LLMProvider, error) {
 	return NewCodexProviderWithTokenSource(cred.AccessToken, cred.AccountID, createCodexTokenSource()), nil
 }
 
+// CreateProvider builds the configured provider. When fallbacks are
+// configured the result is a FallbackProvider that fails over between them.
 func CreateProvider(cfg *config.Config) (LLMProvider, error) {
-	model := cfg.Agents.Defaults.Model
-	providerName := strings.ToLower(cfg.Agents.Defaults.Provider)
+	if len(cfg.Agents.Defaults.Fallbacks) == 0 {
+		return createProvider(cfg, cfg.Agents.Defaults.Provider, cfg.Agents.Defaults.Model)
+	}
+	return createFallbackProvider(cfg)
+}
+
+// CreateModelProvider builds a provider for one model without the
+// configured fallbacks. An empty providerName is inferred from the model.
+func CreateModelProvider(cfg *config.Config, providerName, model string) (LLMProvider, error) {
+	return createProvider(cfg, providerName, model)
+}
+
+// createProvider builds a single provider for providerName, or for the
+// provider implied by model when providerName is empty.
+func createProvider(cfg *config.Config, providerName, model string) (LLMProvider, error) {
+	providerName = strings.ToLower(providerName)
 
 	var apiKey, apiBase, proxy string
 
@@ -276,6 +331,10 @@ func CreateProvider(cfg *config.Config) (LLMProvider, error) {
 				apiKey = cfg.Providers.VLLM.APIKey
 				apiBase = cfg.Providers.VLLM.APIBase
 			}
+		case "ollama":
+			return newLocalProvider(cfg.Providers.Ollama, "http://localhost:11434/v1"), nil
+		case "llamacpp", "llama.cpp", "llama-cpp":
+			return newLocalProvider(cfg.Providers.LlamaCpp, "http://localhost:8080/v1"), nil
 		case "claude-cli", "claudecode", "claude-code":
 			workspace := cfg.Agents.Defaults.Workspace
 			if workspace == "" {
@@ -382,3 +441,48 @@ func CreateProvider(cfg *config.Config) (LLMProvider, error) {
 
 	return NewHTTPProvider(apiKey, apiBase, proxy), nil
 }
+
+// localRequestTimeout allows for slow generation on small boards.
+const localRequestTimeout = 5 * time.Minute
+
+// newLocalProvider talks to a local OpenAI-compatible server such as Ollama
+// or llama.cpp. No API key is needed.
+func newLocalProvider(pc config.ProviderConfig, defaultBase string) *HTTPProvider {
+	apiBase := pc.APIBase
+	if apiBase == "" {
+		apiBase = defaultBase
+	}
+	p := NewHTTPProvider(pc.APIKey, apiBase, pc.Proxy)
+	p.httpClient.Timeout = localRequestTimeout
+	return p
+}
+
+// wireMessages converts messages to the OpenAI wire format. Messages with
+// images use the content-parts form; all others are sent unchanged.
+func wireMessages(messages []Message) []interface{} {
+	out := make([]interface{}, 0, len(messages))
+	for _, msg := range messages {
+		if len(msg.Images) == 0 {
+			out = append(out, msg)
+			continue
+		}
+
+		parts := make([]map[string]interface{}, 0, len(msg.Images)+1)
+		if msg.Content != "" {
+			parts = append(parts, map[string]interface{}{"type": "text", "text": msg.Content})
+		}
+		for _, img := range msg.Images {
+			parts = append(parts, map[string]interface{}{
+				"type": "image_url",
+				"image_url": map[string]interface{}{
+					"url": "data:" + img.MIMEType + ";base64," + base64.StdEncoding.EncodeToString(img.Data),
+				},
+			})
+		}
+		out = append(out, map[string]interface{}{
+			"role":    msg.Role,
+			"content": parts,
+		})
+	}
+	return out
+}
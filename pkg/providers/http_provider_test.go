@@ -0,0 +1,40 @@
+package providers
+
+import (
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestCreateProvider_Local(t *testing.T) {
+	tests := []struct {
+		provider string
+		apiBase  string
+		want     string
+	}{
+		{"ollama", "", "http://localhost:11434/v1"},
+		{"llamacpp", "", "http://localhost:8080/v1"},
+		{"llama.cpp", "http://pi.local:8080/v1/", "http://pi.local:8080/v1"},
+	}
+	for _, tt := range tests {
+		cfg := config.DefaultConfig()
+		cfg.Agents.Defaults.Provider = tt.provider
+		cfg.Providers.Ollama.APIBase = tt.apiBase
+		cfg.Providers.LlamaCpp.APIBase = tt.apiBase
+
+		provider, err := CreateProvider(cfg)
+		if err != nil {
+			t.Fatalf("CreateProvider(%s) error = %v", tt.provider, err)
+		}
+		hp, ok := provider.(*HTTPProvider)
+		if !ok {
+			t.Fatalf("CreateProvider(%s) returned %T, want *HTTPProvider", tt.provider, provider)
+		}
+		if hp.apiBase != tt.want {
+			t.Errorf("CreateProvider(%s) apiBase = %q, want %q", tt.provider, hp.apiBase, tt.want)
+		}
+		if hp.httpClient.Timeout != localRequestTimeout {
+			t.Errorf("CreateProvider(%s) timeout = %v, want %v", tt.provider, hp.httpClient.Timeout, localRequestTimeout)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseStream_ContentAndToolCalls(t *testing.T) {
+	stream := strings.Join([]string{
+		`data: {"choices":[{"delta":{"content":"Hel"}}]}`,
+		`data: {"choices":[{"delta":{"content":"lo"}}]}`,
+		`data: {"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"web_search","arguments":"{\"query\":"}}]}}]}`,
+		`data: {"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"go\"}"}}]},"finish_reason":"tool_calls"}]}`,
+		`data: {"choices":[],"usage":{"prompt_tokens":3,"completion_tokens":2,"total_tokens":5}}`,
+		`data: [DONE]`,
+	}, "\n\n")
+
+	var deltas []string
+	resp, err := parseStream(strings.NewReader(stream), func(d string) { deltas = append(deltas, d) })
+	if err != nil {
+		t.Fatalf("parseStream() error: %v", err)
+	}
+
+	if resp.Content != "Hello" {
+		t.Errorf("Content = %q, want %q", resp.Content, "Hello")
+	}
+	if strings.Join(deltas, "|") != "Hel|lo" {
+		t.Errorf("deltas = %v", deltas)
+	}
+	if resp.FinishReason != "tool_calls" {
+		t.Errorf("FinishReason = %q, want tool_calls", resp.FinishReason)
+	}
+	if len(resp.ToolCalls) != 1 {
+		t.Fatalf("len(ToolCalls) = %d, want 1", len(resp.ToolCalls))
+	}
+	tc := resp.ToolCalls[0]
+	if tc.ID != "call_1" || tc.Name != "web_search" || tc.Arguments["query"] != "go" {
+		t.Errorf("ToolCall = %+v", tc)
+	}
+	if resp.Usage == nil || resp.Usage.TotalTokens != 5 {
+		t.Errorf("Usage = %+v", resp.Usage)
+	}
+}
+
+func TestHTTPProvider_ChatStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"hi\"},\"finish_reason\":\"stop\"}]}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	p := NewHTTPProvider("key", server.URL, "")
+	var got strings.Builder
+	resp, err := p.ChatStream(context.Background(), []Message{{Role: "user", Content: "hello"}}, nil, "test", nil, func(d string) {
+		got.WriteString(d)
+	})
+	if err != nil {
+		t.Fatalf("ChatStream() error: %v", err)
+	}
+	if resp.Content != "hi" || got.String() != "hi" {
+		t.Errorf("Content = %q, deltas = %q", resp.Content, got.String())
+	}
+}
+
+func TestWireMessages_Images(t *testing.T) {
+	messages := []Message{
+		{Role: "system", Content: "sys"},
+		{Role: "user", Content: "look", Images: []Image{{MIMEType: "image/jpeg", Data: []byte{1, 2, 3}}}},
+	}
+
+	wire := wireMessages(messages)
+	if _, ok := wire[0].(Message); !ok {
+		t.Errorf("plain message should pass through unchanged, got %T", wire[0])
+	}
+
+	data, err := json.Marshal(wire[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(data)
+	if !strings.Contains(got, `"type":"image_url"`) || !strings.Contains(got, `data:image/jpeg;base64,AQID`) {
+		t.Errorf("image message = %s", got)
+	}
+	if !strings.Contains(got, `"text":"look"`) {
+		t.Errorf("text part missing: %s", got)
+	}
+}
@@ -33,6 +33,15 @@ type Message struct {
 	Content    string     `json:"content"`
 	ToolCalls  []ToolCall `json:"tool_calls,omitempty"`
 	ToolCallID string     `json:"tool_call_id,omitempty"`
+	// Images are attached to a user message for vision-capable models. They
+	// are sent with the request only and never persisted in sessions.
+	Images []Image `json:"-"`
+}
+
+// Image is an inline image attachment.
+type Image struct {
+	MIMEType string
+	Data     []byte
 }
 
 type LLMProvider interface {
@@ -40,6 +49,14 @@ type LLMProvider interface {
 	GetDefaultModel() string
 }
 
+// StreamingProvider is implemented by providers that can deliver the
+// response incrementally. onDelta is called with each content fragment as it
+// arrives; the returned response is the same as Chat would have returned.
+type StreamingProvider interface {
+	LLMProvider
+	ChatStream(ctx context.Context, messages []Message, tools []ToolDefinition, model string, options map[string]interface{}, onDelta func(delta string)) (*LLMResponse, error)
+}
+
 type ToolDefinition struct {
 	Type     string                 `json:"type"`
 	Function ToolFunctionDefinition `json:"function"`
@@ -0,0 +1,58 @@
+package rag
+
+import "strings"
+
+// ChunkText splits text into chunks of roughly size runes with the given
+// overlap, preferring to break on paragraph, line, or word boundaries.
+func ChunkText(text string, size, overlap int) []string {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil
+	}
+	if size <= 0 {
+		size = 800
+	}
+	if overlap < 0 || overlap >= size {
+		overlap = 0
+	}
+
+	runes := []rune(text)
+	var chunks []string
+	for start := 0; start < len(runes); {
+		end := start + size
+		if end >= len(runes) {
+			chunks = appendChunk(chunks, string(runes[start:]))
+			break
+		}
+
+		end = breakPoint(runes, start, end)
+		chunks = appendChunk(chunks, string(runes[start:end]))
+
+		next := end - overlap
+		if next <= start {
+			next = end
+		}
+		start = next
+	}
+	return chunks
+}
+
+// breakPoint moves end back to the last paragraph, line, or space boundary
+// in the second half of the window, if there is one.
+func breakPoint(runes []rune, start, end int) int {
+	window := string(runes[start:end])
+	minPos := len(window) / 2
+	for _, sep := range []string{"\n\n", "\n", ". ", " "} {
+		if idx := strings.LastIndex(window, sep); idx >= minPos {
+			return start + len([]rune(window[:idx+len(sep)]))
+		}
+	}
+	return end
+}
+
+func appendChunk(chunks []string, chunk string) []string {
+	if chunk = strings.TrimSpace(chunk); chunk != "" {
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
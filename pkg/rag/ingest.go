@@ -0,0 +1,117 @@
+package rag
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// filePrefix marks documents that came from the watched folder, so files
+// that disappear can be removed without touching chat-ingested documents.
+const filePrefix = "file:"
+
+var ingestExtensions = map[string]bool{
+	".txt":      true,
+	".md":       true,
+	".markdown": true,
+	".csv":      true,
+	".json":     true,
+	".log":      true,
+}
+
+// maxIngestFileSize skips files too large to embed on a small device.
+const maxIngestFileSize = 2 << 20
+
+// IngestDir (re)ingests every supported text file under dir and removes
+// documents whose files no longer exist.
+func (s *Store) IngestDir(ctx context.Context, dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool)
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if !ingestExtensions[strings.ToLower(filepath.Ext(path))] {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || info.Size() > maxIngestFileSize {
+			return nil
+		}
+
+		rel, _ := filepath.Rel(dir, path)
+		source := filePrefix + filepath.ToSlash(rel)
+		seen[source] = true
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		n, err := s.AddDocument(ctx, source, string(data))
+		if err != nil {
+			logger.ErrorCF("rag", "Failed to ingest document", map[string]interface{}{
+				"source": source,
+				"error":  err.Error(),
+			})
+			return nil
+		}
+		if n > 0 {
+			logger.InfoCF("rag", "Ingested document", map[string]interface{}{
+				"source": source,
+				"chunks": n,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	docs, err := s.Documents(ctx)
+	if err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		if strings.HasPrefix(doc.Source, filePrefix) && !seen[doc.Source] {
+			if err := s.RemoveDocument(ctx, doc.Source); err == nil {
+				logger.InfoCF("rag", "Removed document", map[string]interface{}{
+					"source": doc.Source,
+				})
+			}
+		}
+	}
+	return nil
+}
+
+// Watch ingests dir immediately and then rescans it every interval until
+// ctx is done.
+func (s *Store) Watch(ctx context.Context, dir string, interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.IngestDir(ctx, dir); err != nil && ctx.Err() == nil {
+			logger.ErrorCF("rag", "Document scan failed", map[string]interface{}{
+				"dir":   dir,
+				"error": err.Error(),
+			})
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
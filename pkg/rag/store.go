@@ -0,0 +1,283 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+// Package rag provides local retrieval-augmented generation: documents are
+// chunked, embedded, and stored in SQLite, then retrieved by vector
+// similarity to ground the agent's answers.
+package rag
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+const embedBatchSize = 16
+
+const schema = `
+CREATE TABLE IF NOT EXISTS documents (
+	id       INTEGER PRIMARY KEY AUTOINCREMENT,
+	source   TEXT NOT NULL UNIQUE,
+	hash     TEXT NOT NULL,
+	added_at INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS chunks (
+	id          INTEGER PRIMARY KEY AUTOINCREMENT,
+	document_id INTEGER NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+	position    INTEGER NOT NULL,
+	content     TEXT NOT NULL,
+	embedding   BLOB NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_chunks_document ON chunks(document_id);
+`
+
+// Options controls chunking.
+type Options struct {
+	ChunkSize    int
+	ChunkOverlap int
+}
+
+// Result is a chunk returned by Search.
+type Result struct {
+	Source  string  `json:"source"`
+	Content string  `json:"content"`
+	Score   float64 `json:"score"`
+}
+
+// Citation names where a result came from in a form fit to show the user:
+// the path within the documents folder, or the title of a saved note.
+func (r Result) Citation() string {
+	switch {
+	case strings.HasPrefix(r.Source, filePrefix):
+		return strings.TrimPrefix(r.Source, filePrefix)
+	case strings.HasPrefix(r.Source, "chat:"):
+		return "note: " + strings.TrimPrefix(r.Source, "chat:")
+	default:
+		return r.Source
+	}
+}
+
+// Document describes an ingested document.
+type Document struct {
+	Source  string    `json:"source"`
+	Chunks  int       `json:"chunks"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+// Store is a SQLite-backed vector store. Search is a brute-force cosine scan,
+// which is fast enough for the few thousand chunks a personal assistant holds.
+type Store struct {
+	db       *sql.DB
+	embedder Embedder
+	opts     Options
+}
+
+// Open opens (or creates) the store at path.
+func Open(path string, embedder Embedder, opts Options) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create rag directory: %w", err)
+	}
+
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)", path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open rag database: %w", err)
+	}
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize rag schema: %w", err)
+	}
+
+	return &Store{db: db, embedder: embedder, opts: opts}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// AddDocument chunks, embeds, and stores text under source, replacing any
+// previous version. Unchanged documents are skipped. It returns the number
+// of chunks stored.
+func (s *Store) AddDocument(ctx context.Context, source, text string) (int, error) {
+	hash := contentHash(text)
+
+	var existingHash string
+	err := s.db.QueryRowContext(ctx, "SELECT hash FROM documents WHERE source = ?", source).Scan(&existingHash)
+	if err == nil && existingHash == hash {
+		return 0, nil
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return 0, fmt.Errorf("failed to look up document: %w", err)
+	}
+
+	chunks := ChunkText(text, s.opts.ChunkSize, s.opts.ChunkOverlap)
+	if len(chunks) == 0 {
+		return 0, s.RemoveDocument(ctx, source)
+	}
+
+	vectors := make([][]float32, 0, len(chunks))
+	for start := 0; start < len(chunks); start += embedBatchSize {
+		end := start + embedBatchSize
+		if end > len(chunks) {
+			end = len(chunks)
+		}
+		batch, err := s.embedder.Embed(ctx, chunks[start:end])
+		if err != nil {
+			return 0, fmt.Errorf("failed to embed %s: %w", source, err)
+		}
+		vectors = append(vectors, batch...)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM documents WHERE source = ?", source); err != nil {
+		return 0, fmt.Errorf("failed to replace document: %w", err)
+	}
+	res, err := tx.ExecContext(ctx, "INSERT INTO documents (source, hash, added_at) VALUES (?, ?, ?)", source, hash, time.Now().Unix())
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert document: %w", err)
+	}
+	docID, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	for i, chunk := range chunks {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO chunks (document_id, position, content, embedding) VALUES (?, ?, ?, ?)",
+			docID, i, chunk, encodeVector(vectors[i])); err != nil {
+			return 0, fmt.Errorf("failed to insert chunk: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(chunks), nil
+}
+
+// RemoveDocument deletes a document and its chunks.
+func (s *Store) RemoveDocument(ctx context.Context, source string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM documents WHERE source = ?", source)
+	return err
+}
+
+// Documents lists ingested documents.
+func (s *Store) Documents(ctx context.Context) ([]Document, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT d.source, d.added_at, COUNT(c.id)
+		FROM documents d LEFT JOIN chunks c ON c.document_id = d.id
+		GROUP BY d.id ORDER BY d.source`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var docs []Document
+	for rows.Next() {
+		var doc Document
+		var addedAt int64
+		if err := rows.Scan(&doc.Source, &addedAt, &doc.Chunks); err != nil {
+			return nil, err
+		}
+		doc.AddedAt = time.Unix(addedAt, 0)
+		docs = append(docs, doc)
+	}
+	return docs, rows.Err()
+}
+
+// Search returns the k chunks most similar to query.
+func (s *Store) Search(ctx context.Context, query string, k int) ([]Result, error) {
+	if k <= 0 {
+		k = 4
+	}
+
+	vectors, err := s.embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %w", err)
+	}
+	queryVec := vectors[0]
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT d.source, c.content, c.embedding
+		FROM chunks c JOIN documents d ON d.id = c.document_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []Result
+	for rows.Next() {
+		var r Result
+		var blob []byte
+		if err := rows.Scan(&r.Source, &r.Content, &blob); err != nil {
+			return nil, err
+		}
+		r.Score = cosine(queryVec, decodeVector(blob))
+		results = append(results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if len(results) > k {
+		results = results[:k]
+	}
+	return results, nil
+}
+
+func contentHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+func encodeVector(v []float32) []byte {
+	buf := make([]byte, 4*len(v))
+	for i, f := range v {
+		binary.LittleEndian.PutUint32(buf[i*4:], math.Float32bits(f))
+	}
+	return buf
+}
+
+func decodeVector(buf []byte) []float32 {
+	v := make([]float32, len(buf)/4)
+	for i := range v {
+		v[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[i*4:]))
+	}
+	return v
+}
+
+func cosine(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
@@ -0,0 +1,111 @@
+package rag
+
+import (
+	"context"
+	"hash/fnv"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// wordEmbedder is a deterministic bag-of-words embedder for tests.
+type wordEmbedder struct{}
+
+func (wordEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	out := make([][]float32, len(texts))
+	for i, text := range texts {
+		v := make([]float32, 64)
+		for _, w := range strings.Fields(strings.ToLower(text)) {
+			h := fnv.New32a()
+			h.Write([]byte(strings.Trim(w, ".,!?")))
+			v[h.Sum32()%64]++
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+func openTestStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := Open(filepath.Join(t.TempDir(), "rag.db"), wordEmbedder{}, Options{ChunkSize: 200})
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestStoreSearch(t *testing.T) {
+	s := openTestStore(t)
+	ctx := context.Background()
+
+	if _, err := s.AddDocument(ctx, "chat:router", "The wifi router password is hunter2."); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.AddDocument(ctx, "chat:plants", "Water the basil every two days."); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := s.Search(ctx, "what is the wifi password", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Source != "chat:router" {
+		t.Fatalf("Search() = %+v, want chat:router first", results)
+	}
+}
+
+func TestAddDocumentSkipsUnchangedAndReplaces(t *testing.T) {
+	s := openTestStore(t)
+	ctx := context.Background()
+
+	if n, _ := s.AddDocument(ctx, "doc", "first version"); n != 1 {
+		t.Fatalf("first add stored %d chunks, want 1", n)
+	}
+	if n, _ := s.AddDocument(ctx, "doc", "first version"); n != 0 {
+		t.Errorf("unchanged add stored %d chunks, want 0", n)
+	}
+	if _, err := s.AddDocument(ctx, "doc", "second version"); err != nil {
+		t.Fatal(err)
+	}
+
+	docs, err := s.Documents(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 1 || docs[0].Chunks != 1 {
+		t.Errorf("Documents() = %+v, want one document with one chunk", docs)
+	}
+}
+
+func TestChunkText(t *testing.T) {
+	text := strings.Repeat("word ", 100)
+	chunks := ChunkText(text, 120, 20)
+	if len(chunks) < 4 {
+		t.Fatalf("expected several chunks, got %d", len(chunks))
+	}
+	for _, c := range chunks {
+		if len([]rune(c)) > 120 {
+			t.Errorf("chunk exceeds size: %d runes", len([]rune(c)))
+		}
+	}
+	if ChunkText("   ", 100, 0) != nil {
+		t.Error("blank text should produce no chunks")
+	}
+}
+
+func TestResultCitation(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"file:manuals/router.md", "manuals/router.md"},
+		{"chat:wifi", "note: wifi"},
+		{"other", "other"},
+	}
+	for _, tt := range tests {
+		if got := (Result{Source: tt.source}).Citation(); got != tt.want {
+			t.Errorf("Citation(%q) = %q, want %q", tt.source, got, tt.want)
+		}
+	}
+}
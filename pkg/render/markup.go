@@ -0,0 +1,62 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package render
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	reHeading = regexp.MustCompile(`(?m)^#{1,6}\s+(.+)$`)
+	reBold    = regexp.MustCompile(`\*\*(.+?)\*\*|__(.+?)__`)
+	reStrike  = regexp.MustCompile(`~~(.+?)~~`)
+	reLink    = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+)
+
+// Text converts Markdown to markup. Slack and WhatsApp mark bold with
+// single asterisks and strikethrough with single tildes, and Slack writes
+// links as <url|text>. Plain text drops the markup and spells links out.
+func Text(markdown string, markup Markup) string {
+	switch markup {
+	case HTML:
+		return toHTML(markdown)
+	case Mrkdwn:
+		s := reHeading.ReplaceAllString(markdown, "*$1*")
+		s = replaceBold(s, "*")
+		s = reStrike.ReplaceAllString(s, "~$1~")
+		return reLink.ReplaceAllString(s, "<$2|$1>")
+	case WhatsApp:
+		s := reHeading.ReplaceAllString(markdown, "*$1*")
+		s = replaceBold(s, "*")
+		s = reStrike.ReplaceAllString(s, "~$1~")
+		return reLink.ReplaceAllString(s, "$1 ($2)")
+	case Plain:
+		s := reHeading.ReplaceAllString(markdown, "$1")
+		s = replaceBold(s, "")
+		s = reStrike.ReplaceAllString(s, "$1")
+		s = reLink.ReplaceAllString(s, "$1 ($2)")
+		return strings.ReplaceAll(s, "`", "")
+	default:
+		return markdown
+	}
+}
+
+// replaceBold rewrites **bold** and __bold__ with mark on both sides.
+func replaceBold(s, mark string) string {
+	return reBold.ReplaceAllStringFunc(s, func(m string) string {
+		return mark + m[2:len(m)-2] + mark
+	})
+}
+
+// literal escapes text that must appear as written in markup.
+func literal(text string, markup Markup) string {
+	if markup == HTML {
+		return escapeHTML(text)
+	}
+	return text
+}
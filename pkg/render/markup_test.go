@@ -0,0 +1,30 @@
+package render
+
+import "testing"
+
+func TestText(t *testing.T) {
+	md := "## Outage\n**API** is down, ~~ETA 5m~~. See [status](https://status.example.com) or run `picoclaw status`."
+	tests := []struct {
+		markup Markup
+		want   string
+	}{
+		{Markdown, md},
+		{HTML, "Outage\n<b>API</b> is down, <s>ETA 5m</s>. See <a href=\"https://status.example.com\">status</a> or run <code>picoclaw status</code>."},
+		{Mrkdwn, "*Outage*\n*API* is down, ~ETA 5m~. See <https://status.example.com|status> or run `picoclaw status`."},
+		{WhatsApp, "*Outage*\n*API* is down, ~ETA 5m~. See status (https://status.example.com) or run `picoclaw status`."},
+		{Plain, "Outage\nAPI is down, ETA 5m. See status (https://status.example.com) or run picoclaw status."},
+	}
+	for _, tt := range tests {
+		if got := Text(md, tt.markup); got != tt.want {
+			t.Errorf("Text(%s) =\n%q\nwant\n%q", tt.markup, got, tt.want)
+		}
+	}
+}
+
+func TestHTML(t *testing.T) {
+	got := Text("# Steps\n- one\n> quoted\n```sh\necho <hi> && exit\n```", HTML)
+	want := "Steps\n• one\nquoted\n<pre><code>echo &lt;hi&gt; &amp;&amp; exit\n</code></pre>"
+	if got != want {
+		t.Errorf("Text() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,169 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+// Package render turns channel-neutral outbound messages (Markdown text,
+// attachments, and buttons) into the best form each channel supports, as
+// described by its Capabilities, so channels do not each reinvent their
+// own formatting and fallbacks.
+package render
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/i18n"
+)
+
+// Markup is the text formatting a channel understands.
+type Markup string
+
+const (
+	Markdown Markup = "markdown" // Sent as written; the client renders it
+	HTML     Markup = "html"     // Telegram's HTML subset
+	Mrkdwn   Markup = "mrkdwn"   // Slack's markup
+	WhatsApp Markup = "whatsapp" // WhatsApp's markup
+	Plain    Markup = "plain"    // No formatting
+)
+
+// Capabilities describes what a channel can deliver.
+type Capabilities struct {
+	Markup  Markup `json:"markup"`
+	Media   bool   `json:"media"`   // Sends attachments natively
+	Edits   bool   `json:"edits"`   // Updates streamed replies in place
+	Buttons bool   `json:"buttons"` // Shows buttons, quick replies, and menus with a message
+
+	// MaxLength is the most characters one message may hold; 0 is no limit
+	MaxLength int `json:"max_length,omitempty"`
+	// MaxAttachment is the largest attachment in bytes; 0 is no limit
+	MaxAttachment int64 `json:"max_attachment,omitempty"`
+}
+
+// Policy is a channel's configured handling of replies too long for one
+// message.
+type Policy struct {
+	MaxLength     int    // Characters per message; 0 or above the channel limit uses the limit
+	Continuation  string // Appended to every part but the last, e.g. "(continued)"
+	FileThreshold int    // Replies longer than this go out as a file; 0 never
+	MaxParts      int    // Replies that take more messages go out as a file; 0 never
+	// Delay is the pause between the parts of a split reply, so they
+	// arrive in order and under the platform's rate limits.
+	Delay time.Duration
+}
+
+// Limit returns the per-message length under policy for a channel with
+// caps, or 0 when there is none.
+func (p Policy) Limit(caps Capabilities) int {
+	if p.MaxLength > 0 && (caps.MaxLength == 0 || p.MaxLength < caps.MaxLength) {
+		return p.MaxLength
+	}
+	return caps.MaxLength
+}
+
+// Render converts msg's Markdown to caps.Markup and folds whatever the
+// channel cannot deliver natively into the text: a note per attachment and
+// a numbered line per choice. Streaming updates are left as written, since a
+// half-finished reply may have unbalanced markup.
+func Render(msg bus.OutboundMessage, caps Capabilities) bus.OutboundMessage {
+	if msg.Partial {
+		return msg
+	}
+	msg.Content = Text(msg.Content, caps.Markup)
+
+	var notes []string
+	if len(msg.Media) > 0 && !caps.Media {
+		for _, path := range msg.Media {
+			notes = append(notes, i18n.T(msg.Channel, msg.ChatID, "media.attachment", filepath.Base(path)))
+		}
+		msg.Media = nil
+	}
+	if !caps.Buttons {
+		notes = append(notes, choiceNotes(msg)...)
+		msg.Buttons, msg.QuickReplies, msg.Menu = nil, nil, nil
+	}
+	if len(notes) > 0 {
+		if msg.Content != "" {
+			msg.Content += "\n"
+		}
+		msg.Content += literal(strings.Join(notes, "\n"), caps.Markup)
+	}
+	return msg
+}
+
+// choiceNotes lists msg's link buttons and then numbers its choices, see
+// bus.OutboundMessage.Choices, so the user can answer with a number.
+func choiceNotes(msg bus.OutboundMessage) []string {
+	var notes []string
+	for _, b := range msg.Buttons {
+		if b.URL != "" {
+			notes = append(notes, i18n.T(msg.Channel, msg.ChatID, "button.link", b.Text, b.URL))
+		}
+	}
+	choices := msg.Choices()
+	for i, c := range choices {
+		if c.Kind == bus.InteractionMenu && msg.Menu.Placeholder != "" &&
+			(i == 0 || choices[i-1].Kind != bus.InteractionMenu) {
+			notes = append(notes, msg.Menu.Placeholder)
+		}
+		notes = append(notes, i18n.T(msg.Channel, msg.ChatID, "button.option", i+1, c.Text))
+	}
+	if len(choices) > 0 {
+		notes = append(notes, i18n.T(msg.Channel, msg.ChatID, "button.choose"))
+	}
+	return notes
+}
+
+// Messages renders msg as one or more messages that each fit the limit
+// of policy and caps. Long replies are split with Split before rendering,
+// so every part renders on its own, and are split again more finely if a
+// part grows past the limit in rendering. Attachments and buttons go with
+// the last part. A streaming update too long for the limit is cut short,
+// since the finished reply will be split properly.
+func Messages(msg bus.OutboundMessage, caps Capabilities, policy Policy) []bus.OutboundMessage {
+	limit := policy.Limit(caps)
+	if msg.Partial {
+		if limit > 0 && utf8.RuneCountInString(msg.Content) > limit {
+			msg.Content = string([]rune(msg.Content)[:limit-1]) + "…"
+		}
+		return []bus.OutboundMessage{msg}
+	}
+	whole := Render(msg, caps)
+	if limit <= 0 || utf8.RuneCountInString(whole.Content) <= limit {
+		return []bus.OutboundMessage{whole}
+	}
+
+	marker := ""
+	if policy.Continuation != "" {
+		marker = "\n\n" + policy.Continuation
+	}
+	budget := limit - utf8.RuneCountInString(marker)
+	for {
+		parts := Split(msg.Content, budget)
+		out := make([]bus.OutboundMessage, len(parts))
+		longest := 0
+		for i, part := range parts {
+			m := msg
+			m.Content = part
+			if i > 0 {
+				m.ReplyToID = ""
+			}
+			if i < len(parts)-1 {
+				m.Content += marker
+				m.Media, m.Buttons, m.QuickReplies, m.Menu = nil, nil, nil, nil
+			}
+			out[i] = Render(m, caps)
+			longest = max(longest, utf8.RuneCountInString(out[i].Content))
+		}
+		if longest <= limit || budget <= 1 {
+			return out
+		}
+		// Markup or the notes for attachments and buttons made a part too
+		// long; split more finely until every part fits
+		budget = max(1, min(budget-1, budget*limit/longest))
+	}
+}
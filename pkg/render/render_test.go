@@ -0,0 +1,49 @@
+package render
+
+import (
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+func TestRenderFallbacks(t *testing.T) {
+	buttons := []bus.Button{{Text: "Yes", Data: "/approve 1a"}, {Text: "Docs", URL: "https://example.com/a_b_c"}}
+	tests := []struct {
+		name        string
+		msg         bus.OutboundMessage
+		caps        Capabilities
+		want        string
+		keepMedia   bool
+		keepButtons bool
+	}{
+		{"media only", bus.OutboundMessage{Media: []string{"/ws/images/cat.png"}}, Capabilities{}, "[attachment: cat.png]", false, false},
+		{"text and media", bus.OutboundMessage{Content: "Here you go", Media: []string{"/a/1.png", "/a/2.pdf"}}, Capabilities{},
+			"Here you go\n[attachment: 1.png]\n[attachment: 2.pdf]", false, false},
+		{"native media", bus.OutboundMessage{Content: "Here", Media: []string{"/a/1.png"}}, Capabilities{Media: true}, "Here", true, false},
+		{"buttons as text", bus.OutboundMessage{Content: "Run it?", Buttons: buttons}, Capabilities{Markup: Plain},
+			"Run it?\nDocs: https://example.com/a_b_c\n1. Yes\nReply with a number to choose.", false, false},
+		{"choices numbered", bus.OutboundMessage{Content: "Size?", Buttons: buttons[:1],
+			QuickReplies: []bus.Button{{Text: "Skip", Data: "skip"}},
+			Menu:         &bus.Menu{Placeholder: "Pick a size", Options: []bus.Button{{Text: "S", Data: "s"}, {Text: "M", Data: "m"}}}},
+			Capabilities{Markup: Plain}, "Size?\n1. Yes\n2. Skip\nPick a size\n3. S\n4. M\nReply with a number to choose.", false, false},
+		// Notes are escaped, not converted, so file names and URLs survive
+		{"escaped notes", bus.OutboundMessage{Content: "**Run** it?", Media: []string{"/a/x_y_z.png"}, Buttons: buttons[:1]}, Capabilities{Markup: HTML},
+			"<b>Run</b> it?\n[attachment: x_y_z.png]\n1. Yes\nReply with a number to choose.", false, false},
+		{"native buttons", bus.OutboundMessage{Content: "Run it?", Buttons: buttons}, Capabilities{Markup: HTML, Buttons: true}, "Run it?", false, true},
+		{"partial left alone", bus.OutboundMessage{Content: "**Run", Partial: true}, Capabilities{Markup: HTML}, "**Run", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Render(tt.msg, tt.caps)
+			if got.Content != tt.want {
+				t.Errorf("Content = %q, want %q", got.Content, tt.want)
+			}
+			if (got.Media != nil) != tt.keepMedia {
+				t.Errorf("Media = %v", got.Media)
+			}
+			if (got.Buttons != nil) != tt.keepButtons {
+				t.Errorf("Buttons = %v", got.Buttons)
+			}
+		})
+	}
+}
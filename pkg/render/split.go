@@ -0,0 +1,284 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package render
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Split breaks markdown into parts of at most limit characters. Parts end
+// between blocks (paragraphs, lists, code blocks), never inside a fenced
+// code block or between the items of a list. A block too long for one part
+// is split by line, or by list item, and a code block split this way is
+// closed and reopened around each piece so every part renders on its own.
+func Split(markdown string, limit int) []string {
+	if limit <= 0 || utf8.RuneCountInString(markdown) <= limit {
+		return []string{markdown}
+	}
+
+	var parts []string
+	cur := ""
+	for _, b := range blocks(markdown) {
+		switch n := utf8.RuneCountInString(b); {
+		case cur != "" && utf8.RuneCountInString(cur)+2+n <= limit:
+			cur += "\n\n" + b
+		case n <= limit:
+			if cur != "" {
+				parts = append(parts, cur)
+			}
+			cur = b
+		default:
+			if cur != "" {
+				parts = append(parts, cur)
+			}
+			pieces := splitBlock(b, limit)
+			parts = append(parts, pieces[:len(pieces)-1]...)
+			cur = pieces[len(pieces)-1]
+		}
+	}
+	if cur != "" {
+		parts = append(parts, cur)
+	}
+	return parts
+}
+
+// LastBreak returns the index just past the last blank line in markdown
+// that is safe to split at: outside code blocks and not between list
+// items. It returns -1 when there is none.
+func LastBreak(markdown string) int {
+	last := -1
+	fence := ""
+	inList := false
+	pending := -1 // Offset after a blank line, until the next line decides
+	offset := 0
+	for _, line := range strings.SplitAfter(markdown, "\n") {
+		text := strings.TrimRight(line, "\n")
+		switch {
+		case fence != "":
+			if closesFence(text, fence) {
+				fence = ""
+			}
+		case strings.TrimSpace(text) == "":
+			if offset > 0 {
+				pending = offset + len(line)
+			}
+		default:
+			if pending >= 0 && !(inList && continuesList(text)) {
+				last = pending
+			}
+			pending = -1
+			if open := fenceOpen(text); open != "" {
+				fence = open
+			} else if !isIndented(text) {
+				inList = isListItem(text)
+			}
+		}
+		offset += len(line)
+	}
+	return last
+}
+
+// blocks splits markdown at blank lines outside code blocks, keeping loose
+// lists (items separated by blank lines) together.
+func blocks(markdown string) []string {
+	var out []string
+	var cur []string
+	fence := ""
+	inList := false
+	blank := false
+	for _, line := range strings.Split(markdown, "\n") {
+		if fence != "" {
+			cur = append(cur, line)
+			if closesFence(line, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			blank = len(cur) > 0
+			continue
+		}
+		if blank {
+			if inList && continuesList(line) {
+				cur = append(cur, "")
+			} else {
+				out = append(out, strings.Join(cur, "\n"))
+				cur = nil
+			}
+			blank = false
+		}
+		cur = append(cur, line)
+		if open := fenceOpen(line); open != "" {
+			fence = open
+		} else if !isIndented(line) {
+			inList = isListItem(line)
+		}
+	}
+	if len(cur) > 0 {
+		out = append(out, strings.Join(cur, "\n"))
+	}
+	return out
+}
+
+// splitBlock splits one block longer than limit into pieces, breaking
+// between list items where it can and between lines otherwise.
+func splitBlock(block string, limit int) []string {
+	var parts []string
+	var cur []string
+	curLen := 0
+	fence := "" // Opening line of the code block cur ends inside
+
+	flush := func() {
+		if len(cur) == 0 {
+			return
+		}
+		if fence != "" {
+			cur = append(cur, closingFence(fence))
+		}
+		parts = append(parts, strings.Trim(strings.Join(cur, "\n"), "\n"))
+		cur, curLen = nil, 0
+		if fence != "" {
+			cur, curLen = []string{fence}, utf8.RuneCountInString(fence)
+		}
+	}
+	add := func(s string) {
+		if len(cur) > 0 {
+			curLen++
+		}
+		cur = append(cur, s)
+		curLen += utf8.RuneCountInString(s)
+	}
+
+	lines := strings.Split(block, "\n")
+	for i := 0; i < len(lines); {
+		// The next unit: one line, or a whole list item outside code
+		j := i + 1
+		if fence == "" && isListItem(lines[i]) {
+			for j < len(lines) && isIndented(lines[j]) && fenceOpen(lines[j]) == "" {
+				j++
+			}
+		}
+		unit := strings.Join(lines[i:j], "\n")
+
+		reserve := 0
+		if fence != "" {
+			reserve = 1 + utf8.RuneCountInString(closingFence(fence))
+		}
+		fits := func(s string) bool {
+			sep := 0
+			if len(cur) > 0 {
+				sep = 1
+			}
+			return curLen+sep+utf8.RuneCountInString(s)+reserve <= limit
+		}
+		if !fits(unit) {
+			flush()
+		}
+		if fits(unit) {
+			add(unit)
+		} else {
+			// Too long even for a piece of its own: split it by word
+			room := limit - curLen - reserve
+			if len(cur) > 0 {
+				room--
+			}
+			for _, piece := range splitLong(unit, max(room, 1)) {
+				if !fits(piece) {
+					flush()
+				}
+				add(piece)
+			}
+		}
+
+		for _, line := range lines[i:j] {
+			if fence == "" {
+				fence = fenceOpen(line)
+			} else if closesFence(line, fence) {
+				fence = ""
+			}
+		}
+		i = j
+	}
+	fence = ""
+	flush()
+	return parts
+}
+
+// splitLong breaks text into pieces of at most limit characters at the end
+// of a sentence, or at a space when the last half of a piece has no
+// sentence end, or anywhere when a word is longer than limit.
+func splitLong(text string, limit int) []string {
+	var parts []string
+	for utf8.RuneCountInString(text) > limit {
+		runes := []rune(text)
+		cut, space := limit, -1
+		for k := limit; k > limit/2; k-- {
+			if runes[k] != ' ' {
+				continue
+			}
+			if strings.ContainsRune(".!?…。", runes[k-1]) {
+				cut, space = k, -1
+				break
+			}
+			if space < 0 {
+				space = k
+			}
+		}
+		if space >= 0 {
+			cut = space
+		}
+		parts = append(parts, string(runes[:cut]))
+		text = strings.TrimLeft(string(runes[cut:]), " ")
+	}
+	return append(parts, text)
+}
+
+// fenceOpen returns the trimmed line if it opens a fenced code block.
+func fenceOpen(line string) string {
+	t := strings.TrimSpace(line)
+	if strings.HasPrefix(t, "```") || strings.HasPrefix(t, "~~~") {
+		return t
+	}
+	return ""
+}
+
+// closingFence returns the fence that closes a block opened by open.
+func closingFence(open string) string {
+	return strings.TrimRight(open, strings.Trim(open, "`~"))
+}
+
+func closesFence(line, open string) bool {
+	t := strings.TrimSpace(line)
+	return t != "" && strings.Trim(t, t[:1]) == "" && strings.HasPrefix(t, closingFence(open)[:3])
+}
+
+// isListItem reports whether line starts a list item: "- ", "* ", "+ ",
+// "1. ", or "1) ".
+func isListItem(line string) bool {
+	t := strings.TrimLeft(line, " ")
+	if len(line)-len(t) > 3 || len(t) < 2 {
+		return false
+	}
+	if (t[0] == '-' || t[0] == '*' || t[0] == '+') && t[1] == ' ' {
+		return true
+	}
+	i := 0
+	for i < len(t) && i < 9 && t[i] >= '0' && t[i] <= '9' {
+		i++
+	}
+	return i > 0 && i+1 < len(t) && (t[i] == '.' || t[i] == ')') && t[i+1] == ' '
+}
+
+func isIndented(line string) bool {
+	return strings.HasPrefix(line, "  ") || strings.HasPrefix(line, "\t")
+}
+
+// continuesList reports whether line after a blank line carries on a list.
+func continuesList(line string) bool {
+	return isListItem(line) || isIndented(line)
+}
@@ -0,0 +1,130 @@
+package render
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+func TestSplit(t *testing.T) {
+	code := "```go\nfunc a() {}\n\nfunc b() {}\n```"
+	tests := []struct {
+		name     string
+		markdown string
+		limit    int
+		want     []string
+	}{
+		{"fits", "short", 10, []string{"short"}},
+		{"no limit", "short", 0, []string{"short"}},
+		{"paragraphs", "one one\n\ntwo two\n\nthree", 16, []string{"one one\n\ntwo two", "three"}},
+		// The blank line inside the code block is not a paragraph break
+		{"code block kept whole", "Intro\n\n" + code + "\n\nOutro", 40, []string{"Intro", code, "Outro"}},
+		// Loose lists stay together even with blank lines between items
+		{"list kept whole", "Steps:\n\n- a\n\n- b\n\nDone", 14, []string{"Steps:", "- a\n\n- b\n\nDone"}},
+		{"long list split between items", "- aaa\n  more\n- bbb\n- ccc", 14, []string{"- aaa\n  more", "- bbb\n- ccc"}},
+		{"long code block reopened", "```sh\nline one\nline two\nline three\n```", 24,
+			[]string{"```sh\nline one\n```", "```sh\nline two\n```", "```sh\nline three\n```"}},
+		{"long line split at words", "aaaa bbbb cccc dddd", 10, []string{"aaaa bbbb", "cccc dddd"}},
+		{"long line split at sentences", "It rained. The sun came out", 18, []string{"It rained.", "The sun came out"}},
+		{"long word split anywhere", "abcdefghij", 4, []string{"abcd", "efgh", "ij"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Split(tt.markdown, tt.limit)
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("Split() = %q, want %q", got, tt.want)
+			}
+			for _, part := range got {
+				if tt.limit > 0 && utf8.RuneCountInString(part) > tt.limit {
+					t.Errorf("part %q longer than %d", part, tt.limit)
+				}
+			}
+		})
+	}
+}
+
+func TestLastBreak(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown string
+		want     int
+	}{
+		{"none", "one paragraph", -1},
+		{"paragraph", "one\n\ntwo", 5},
+		{"inside code block", "```\na\n\nb", -1},
+		{"after code block", "```\na\n\nb\n```\n\nnext", 14},
+		{"between list items", "- a\n\n- b", -1},
+		{"before list", "Steps:\n\n- a", 8},
+		{"list not finished", "- a\n\n", -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := LastBreak(tt.markdown); got != tt.want {
+				t.Errorf("LastBreak(%q) = %d, want %d", tt.markdown, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMessages(t *testing.T) {
+	long := "First **bold** paragraph.\n\nSecond paragraph here.\n\nThird."
+	buttons := []bus.Button{{Text: "OK", Data: "ok"}}
+
+	t.Run("fits in one", func(t *testing.T) {
+		got := Messages(bus.OutboundMessage{Content: "hi"}, Capabilities{MaxLength: 10}, Policy{})
+		if len(got) != 1 || got[0].Content != "hi" {
+			t.Errorf("Messages() = %+v", got)
+		}
+	})
+
+	t.Run("split with continuation", func(t *testing.T) {
+		msg := bus.OutboundMessage{Content: long, Buttons: buttons}
+		got := Messages(msg, Capabilities{Markup: Plain, Buttons: true}, Policy{MaxLength: 40, Continuation: "…"})
+		want := []string{"First bold paragraph.\n\n…", "Second paragraph here.\n\nThird."}
+		if len(got) != len(want) {
+			t.Fatalf("got %d parts %+v, want %d", len(got), got, len(want))
+		}
+		for i := range want {
+			if got[i].Content != want[i] {
+				t.Errorf("part %d = %q, want %q", i, got[i].Content, want[i])
+			}
+		}
+		if got[0].Buttons != nil || len(got[1].Buttons) != 1 {
+			t.Errorf("buttons must go with the last part: %+v", got)
+		}
+	})
+
+	t.Run("reply quotes from the first part", func(t *testing.T) {
+		msg := bus.OutboundMessage{Content: long, ReplyToID: "m1"}
+		got := Messages(msg, Capabilities{Markup: Plain}, Policy{MaxLength: 40})
+		if len(got) != 2 || got[0].ReplyToID != "m1" || got[1].ReplyToID != "" {
+			t.Errorf("Messages() = %+v, want only the first part to quote m1", got)
+		}
+	})
+
+	// HTML is longer than the Markdown it came from; parts are split again
+	// until the rendered text fits
+	t.Run("rendered length", func(t *testing.T) {
+		msg := bus.OutboundMessage{Content: strings.Repeat("**a** ", 20)}
+		for _, part := range Messages(msg, Capabilities{Markup: HTML, MaxLength: 80}, Policy{}) {
+			if n := utf8.RuneCountInString(part.Content); n > 80 {
+				t.Errorf("part of %d characters: %q", n, part.Content)
+			}
+		}
+	})
+
+	t.Run("policy limit above platform limit", func(t *testing.T) {
+		if got := (Policy{MaxLength: 5000}).Limit(Capabilities{MaxLength: 4096}); got != 4096 {
+			t.Errorf("Limit() = %d, want 4096", got)
+		}
+	})
+
+	t.Run("partial cut short", func(t *testing.T) {
+		got := Messages(bus.OutboundMessage{Content: "abcdefgh", Partial: true}, Capabilities{MaxLength: 5}, Policy{})
+		if len(got) != 1 || got[0].Content != "abcd…" {
+			t.Errorf("Messages() = %+v", got)
+		}
+	})
+}
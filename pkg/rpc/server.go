@@ -0,0 +1,332 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+// Package rpc serves the gateway's gRPC API, so other services can send
+// and receive chat messages through picoclaw while it owns the channel
+// sessions. The API is defined in gatewaypb/gateway.proto.
+package rpc
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/events"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/rpc/gatewaypb"
+)
+
+// streamBuffer is how many inbound messages wait for a slow stream before
+// it misses new ones.
+const streamBuffer = 64
+
+// Config holds the gRPC server settings.
+type Config struct {
+	Enabled bool
+	Host    string
+	Port    int
+	Token   string
+}
+
+// Gateway is what the API drives. It is implemented by channels.Manager.
+type Gateway interface {
+	Send(ctx context.Context, msg bus.OutboundMessage) (string, error)
+	Delivery(ctx context.Context, id string) (channels.Delivery, bool, error)
+	ChannelStates() map[string]string
+	RestartChannel(ctx context.Context, name string) error
+}
+
+type subscriber struct {
+	ch       chan *gatewaypb.InboundMessage
+	channels map[string]bool // nil streams every channel
+}
+
+// Server is the gRPC server. Every call requires the bearer token. Server
+// is a bus.Recorder: install it with bus.MessageBus.AddRecorder to stream
+// inbound messages.
+type Server struct {
+	gatewaypb.UnimplementedGatewayServer
+
+	config  Config
+	gateway Gateway
+	server  *grpc.Server
+	subs    map[*subscriber]struct{}
+	closed  chan struct{} // Closed by Stop to end the streams
+	mu      sync.Mutex
+}
+
+// NewServer creates a gRPC server for gateway.
+func NewServer(cfg Config, gateway Gateway) *Server {
+	return &Server{
+		config:  cfg,
+		gateway: gateway,
+		subs:    make(map[*subscriber]struct{}),
+		closed:  make(chan struct{}),
+	}
+}
+
+// Addr returns the configured listen address.
+func (s *Server) Addr() string {
+	return net.JoinHostPort(s.config.Host, fmt.Sprintf("%d", s.config.Port))
+}
+
+// Start begins serving in the background. It is a no-op when disabled.
+func (s *Server) Start(ctx context.Context) error {
+	if !s.config.Enabled {
+		return nil
+	}
+	if s.config.Token == "" {
+		return errors.New("gRPC server enabled but no token configured")
+	}
+
+	listener, err := net.Listen("tcp", s.Addr())
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.Addr(), err)
+	}
+	return s.serve(listener)
+}
+
+func (s *Server) serve(listener net.Listener) error {
+	srv := grpc.NewServer(
+		grpc.UnaryInterceptor(s.unaryAuth),
+		grpc.StreamInterceptor(s.streamAuth),
+	)
+	gatewaypb.RegisterGatewayServer(srv, s)
+
+	s.mu.Lock()
+	s.server = srv
+	s.mu.Unlock()
+
+	go func() {
+		if err := srv.Serve(listener); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+			logger.ErrorCF("rpc", "gRPC server error", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
+	}()
+
+	logger.InfoCF("rpc", "gRPC server started", map[string]interface{}{
+		"addr": listener.Addr().String(),
+	})
+	return nil
+}
+
+// Stop ends open streams and shuts the server down, waiting for in-flight
+// calls until ctx expires.
+func (s *Server) Stop(ctx context.Context) {
+	s.mu.Lock()
+	srv := s.server
+	s.server = nil
+	s.mu.Unlock()
+	if srv == nil {
+		return
+	}
+	close(s.closed)
+
+	done := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		srv.Stop()
+	}
+}
+
+// authorize checks the "authorization: Bearer <token>" metadata.
+func (s *Server) authorize(ctx context.Context, method string) error {
+	var provided string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			provided = strings.TrimPrefix(values[0], "Bearer ")
+		}
+	}
+	expected := []byte(s.config.Token)
+	if len(expected) == 0 || subtle.ConstantTimeCompare([]byte(provided), expected) != 1 {
+		events.Security("rpc", "Rejected unauthenticated gRPC call", map[string]interface{}{
+			"method": method,
+		})
+		return status.Error(codes.Unauthenticated, "missing or invalid token")
+	}
+	return nil
+}
+
+func (s *Server) unaryAuth(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := s.authorize(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *Server) streamAuth(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := s.authorize(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+// SendMessage implements gatewaypb.GatewayServer.
+func (s *Server) SendMessage(ctx context.Context, req *gatewaypb.SendMessageRequest) (*gatewaypb.SendMessageResponse, error) {
+	if req.Channel == "" || req.ChatId == "" {
+		return nil, status.Error(codes.InvalidArgument, "channel and chat_id are required")
+	}
+	if strings.TrimSpace(req.Content) == "" && len(req.Media) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "content or media is required")
+	}
+	msg := bus.OutboundMessage{
+		Channel:  req.Channel,
+		ChatID:   req.ChatId,
+		Content:  req.Content,
+		ThreadID: req.ThreadId,
+		Media:    req.Media,
+	}
+	// Callers that trace their requests pass the W3C header as metadata
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("traceparent"); len(values) > 0 {
+			msg.TraceID, msg.ParentID, _ = bus.ParseTraceparent(values[0])
+		}
+	}
+	id, err := s.gateway.Send(ctx, msg)
+	if err != nil && id == "" {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	// A failed first attempt stays in the outbox; GetDelivery shows it
+	return &gatewaypb.SendMessageResponse{DeliveryId: id}, nil
+}
+
+// GetDelivery implements gatewaypb.GatewayServer.
+func (s *Server) GetDelivery(ctx context.Context, req *gatewaypb.GetDeliveryRequest) (*gatewaypb.Delivery, error) {
+	d, ok, err := s.gateway.Delivery(ctx, req.Id)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "no delivery %q", req.Id)
+	}
+	times := make(map[string]*timestamppb.Timestamp, len(d.Times))
+	for st, t := range d.Times {
+		times[st] = timestamppb.New(t)
+	}
+	return &gatewaypb.Delivery{
+		Id:         d.ID,
+		Channel:    d.Channel,
+		ChatId:     d.ChatID,
+		Status:     d.Status,
+		Times:      times,
+		Error:      d.Error,
+		MessageIds: d.MessageIDs,
+	}, nil
+}
+
+// GetStatus implements gatewaypb.GatewayServer.
+func (s *Server) GetStatus(ctx context.Context, req *gatewaypb.GetStatusRequest) (*gatewaypb.GetStatusResponse, error) {
+	return &gatewaypb.GetStatusResponse{Channels: s.gateway.ChannelStates()}, nil
+}
+
+// RestartChannel implements gatewaypb.GatewayServer.
+func (s *Server) RestartChannel(ctx context.Context, req *gatewaypb.RestartChannelRequest) (*gatewaypb.RestartChannelResponse, error) {
+	if err := s.gateway.RestartChannel(ctx, req.Channel); err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return &gatewaypb.RestartChannelResponse{}, nil
+}
+
+// StreamInbound implements gatewaypb.GatewayServer. A stream that falls
+// behind misses messages rather than slowing the gateway down.
+func (s *Server) StreamInbound(req *gatewaypb.StreamInboundRequest, stream gatewaypb.Gateway_StreamInboundServer) error {
+	sub := &subscriber{ch: make(chan *gatewaypb.InboundMessage, streamBuffer)}
+	if len(req.Channels) > 0 {
+		sub.channels = make(map[string]bool, len(req.Channels))
+		for _, name := range req.Channels {
+			sub.channels[name] = true
+		}
+	}
+	s.mu.Lock()
+	s.subs[sub] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.subs, sub)
+		s.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-s.closed:
+			return nil
+		case msg := <-sub.ch:
+			if err := stream.Send(msg); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// RecordInbound streams msg to the open StreamInbound calls; it makes
+// Server a bus.Recorder. Internal channels are left out.
+func (s *Server) RecordInbound(msg bus.InboundMessage) {
+	if constants.IsInternalChannel(msg.Channel) {
+		return
+	}
+	pb := &gatewaypb.InboundMessage{
+		Channel:       msg.Channel,
+		SenderId:      msg.SenderID,
+		ChatId:        msg.ChatID,
+		Content:       msg.Content,
+		Media:         msg.Media,
+		ThreadId:      msg.ThreadID,
+		CorrelationId: msg.CorrelationID,
+		Metadata:      withTrace(msg.Metadata, msg.TraceID),
+		Time:          timestamppb.New(time.Now()),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sub := range s.subs {
+		if sub.channels != nil && !sub.channels[msg.Channel] {
+			continue
+		}
+		select {
+		case sub.ch <- pb:
+		default:
+		}
+	}
+}
+
+// withTrace returns metadata with "trace_id" added, copying it so the
+// message's own map is left alone.
+func withTrace(metadata map[string]string, traceID string) map[string]string {
+	if traceID == "" {
+		return metadata
+	}
+	out := make(map[string]string, len(metadata)+1)
+	for k, v := range metadata {
+		out[k] = v
+	}
+	out["trace_id"] = traceID
+	return out
+}
+
+// RecordOutbound implements bus.Recorder; outbound messages are not
+// streamed.
+func (s *Server) RecordOutbound(msg bus.OutboundMessage) {}
@@ -0,0 +1,173 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/rpc/gatewaypb"
+)
+
+type fakeGateway struct {
+	sent      []bus.OutboundMessage
+	restarted []string
+}
+
+func (g *fakeGateway) Send(ctx context.Context, msg bus.OutboundMessage) (string, error) {
+	if msg.Channel != "slack" {
+		return "", errors.New("channel " + msg.Channel + " not found")
+	}
+	g.sent = append(g.sent, msg)
+	return "d1", nil
+}
+
+func (g *fakeGateway) Delivery(ctx context.Context, id string) (channels.Delivery, bool, error) {
+	if id != "d1" {
+		return channels.Delivery{}, false, nil
+	}
+	return channels.Delivery{ID: "d1", Channel: "slack", ChatID: "C1", Status: channels.DeliverySent,
+		Times: map[string]time.Time{channels.DeliverySent: time.Unix(1700000000, 0)}}, true, nil
+}
+
+func (g *fakeGateway) ChannelStates() map[string]string {
+	return map[string]string{"slack": "connected", "whatsapp": "reconnecting"}
+}
+
+func (g *fakeGateway) RestartChannel(ctx context.Context, name string) error {
+	g.restarted = append(g.restarted, name)
+	return nil
+}
+
+func newTestServer(t *testing.T) (*Server, *fakeGateway, gatewaypb.GatewayClient) {
+	t.Helper()
+	gw := &fakeGateway{}
+	s := NewServer(Config{Enabled: true, Token: "secret"}, gw)
+	lis := bufconn.Listen(1 << 20)
+	if err := s.serve(lis); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Stop(context.Background()) })
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return s, gw, gatewaypb.NewGatewayClient(conn)
+}
+
+func authed(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+func TestServerRequiresToken(t *testing.T) {
+	_, _, client := newTestServer(t)
+	for _, ctx := range []context.Context{context.Background(), authed("wrong")} {
+		_, err := client.GetStatus(ctx, &gatewaypb.GetStatusRequest{})
+		if status.Code(err) != codes.Unauthenticated {
+			t.Errorf("GetStatus error = %v, want Unauthenticated", err)
+		}
+	}
+	stream, err := client.StreamInbound(context.Background(), &gatewaypb.StreamInboundRequest{})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("StreamInbound error = %v, want Unauthenticated", err)
+	}
+}
+
+func TestServerCalls(t *testing.T) {
+	_, gw, client := newTestServer(t)
+	ctx := authed("secret")
+
+	resp, err := client.SendMessage(ctx, &gatewaypb.SendMessageRequest{Channel: "slack", ChatId: "C1", Content: "hi", ThreadId: "17.1"})
+	if err != nil || resp.DeliveryId != "d1" {
+		t.Fatalf("SendMessage = %v, %v", resp, err)
+	}
+	if len(gw.sent) != 1 || gw.sent[0].ChatID != "C1" || gw.sent[0].ThreadID != "17.1" || gw.sent[0].Content != "hi" {
+		t.Errorf("sent = %+v", gw.sent)
+	}
+
+	tests := []struct {
+		req  *gatewaypb.SendMessageRequest
+		code codes.Code
+	}{
+		{&gatewaypb.SendMessageRequest{Channel: "slack", Content: "hi"}, codes.InvalidArgument},
+		{&gatewaypb.SendMessageRequest{Channel: "slack", ChatId: "C1", Content: " "}, codes.InvalidArgument},
+		{&gatewaypb.SendMessageRequest{Channel: "irc", ChatId: "C1", Content: "hi"}, codes.NotFound},
+	}
+	for _, tt := range tests {
+		if _, err := client.SendMessage(ctx, tt.req); status.Code(err) != tt.code {
+			t.Errorf("SendMessage(%v) error = %v, want %v", tt.req, err, tt.code)
+		}
+	}
+
+	d, err := client.GetDelivery(ctx, &gatewaypb.GetDeliveryRequest{Id: "d1"})
+	if err != nil || d.Status != "sent" || d.Times["sent"].GetSeconds() != 1700000000 {
+		t.Errorf("GetDelivery = %v, %v", d, err)
+	}
+	if _, err := client.GetDelivery(ctx, &gatewaypb.GetDeliveryRequest{Id: "nope"}); status.Code(err) != codes.NotFound {
+		t.Errorf("GetDelivery(nope) error = %v", err)
+	}
+
+	st, err := client.GetStatus(ctx, &gatewaypb.GetStatusRequest{})
+	if err != nil || st.Channels["whatsapp"] != "reconnecting" {
+		t.Errorf("GetStatus = %v, %v", st, err)
+	}
+
+	if _, err := client.RestartChannel(ctx, &gatewaypb.RestartChannelRequest{Channel: "whatsapp"}); err != nil || len(gw.restarted) != 1 {
+		t.Errorf("RestartChannel error = %v, restarted = %v", err, gw.restarted)
+	}
+}
+
+func TestServerStreamInbound(t *testing.T) {
+	s, _, client := newTestServer(t)
+	ctx, cancel := context.WithCancel(authed("secret"))
+	defer cancel()
+
+	stream, err := client.StreamInbound(ctx, &gatewaypb.StreamInboundRequest{Channels: []string{"whatsapp"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Wait for the stream to subscribe
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		s.mu.Lock()
+		n := len(s.subs)
+		s.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("stream did not subscribe")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	s.RecordInbound(bus.InboundMessage{Channel: "slack", ChatID: "C1", Content: "filtered"})
+	s.RecordInbound(bus.InboundMessage{Channel: "system", ChatID: "whatsapp:1", Content: "internal"})
+	s.RecordInbound(bus.InboundMessage{Channel: "whatsapp", ChatID: "1@s.whatsapp.net", SenderID: "1", Content: "hello",
+		Metadata: map[string]string{"message_id": "m1"}})
+
+	msg, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Content != "hello" || msg.ChatId != "1@s.whatsapp.net" || msg.Metadata["message_id"] != "m1" || msg.Time == nil {
+		t.Errorf("streamed %v", msg)
+	}
+}
@@ -0,0 +1,52 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package scenario
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels"
+)
+
+// scriptChannel is a fake channel whose next sends can also be made to
+// panic, as a buggy channel would.
+type scriptChannel struct {
+	*channels.Fake
+
+	mu     sync.Mutex
+	panics int
+	reason string
+}
+
+func (c *scriptChannel) Send(ctx context.Context, msg bus.OutboundMessage) error {
+	c.mu.Lock()
+	if c.panics > 0 {
+		c.panics--
+		reason := c.reason
+		c.mu.Unlock()
+		panic(reason)
+	}
+	c.mu.Unlock()
+	return c.Fake.Send(ctx, msg)
+}
+
+// failNext makes the next n sends fail with reason, or panic with it.
+func (c *scriptChannel) failNext(n int, reason string, panics bool) {
+	if reason == "" {
+		reason = "simulated send failure"
+	}
+	if !panics {
+		c.Fake.FailNext(n, errors.New(reason))
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.panics, c.reason = n, reason
+}
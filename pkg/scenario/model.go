@@ -0,0 +1,91 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package scenario
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// scriptedModel answers each request with the next queued turn.
+type scriptedModel struct {
+	mu       sync.Mutex
+	turns    []Turn
+	calls    int
+	problems []string // Requests that did not go as scripted
+}
+
+func (m *scriptedModel) queue(turns []Turn) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.turns = append(m.turns, turns...)
+}
+
+func (m *scriptedModel) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, opts map[string]interface{}) (*providers.LLMResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls++
+	if len(m.turns) == 0 {
+		m.problems = append(m.problems, fmt.Sprintf("model request %d has no scripted turn", m.calls))
+		return nil, errors.New("no scripted model turn left")
+	}
+	turn := m.turns[0]
+	m.turns = m.turns[1:]
+
+	if turn.saw != nil {
+		if last := lastUserMessage(messages); !turn.saw.MatchString(last) {
+			m.problems = append(m.problems, fmt.Sprintf("model request %d: user message %q does not match %q", m.calls, last, turn.Saw))
+		}
+	}
+	switch {
+	case turn.Error != "":
+		return nil, errors.New(turn.Error)
+	case turn.Tool != "":
+		return &providers.LLMResponse{ToolCalls: []providers.ToolCall{{
+			ID:        fmt.Sprintf("call_%d", m.calls),
+			Name:      turn.Tool,
+			Arguments: turn.Args,
+		}}}, nil
+	default:
+		return &providers.LLMResponse{Content: turn.Reply}, nil
+	}
+}
+
+func (m *scriptedModel) GetDefaultModel() string {
+	return "scripted"
+}
+
+// check reports requests that went wrong and turns left unused.
+func (m *scriptedModel) check() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	problems := m.problems
+	if len(m.turns) > 0 {
+		problems = append(problems, fmt.Sprintf("%d model turns were never requested", len(m.turns)))
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	errs := make([]error, len(problems))
+	for i, p := range problems {
+		errs[i] = errors.New(p)
+	}
+	return errors.Join(errs...)
+}
+
+func lastUserMessage(messages []providers.Message) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			return messages[i].Content
+		}
+	}
+	return ""
+}
@@ -0,0 +1,144 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package scenario
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/agent"
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+// Run plays s against a fresh bus, channel manager, and agent loop with an
+// empty workspace, and returns the first step that did not go as
+// scripted, or the model requests that did not.
+func Run(ctx context.Context, s *Script) error {
+	workspace, err := os.MkdirTemp("", "picoclaw-scenario-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(workspace)
+
+	cfg := config.DefaultConfig()
+	cfg.Agents.Defaults.Workspace = workspace
+
+	msgBus := bus.NewMessageBus()
+	manager, err := channels.NewManager(cfg, msgBus)
+	if err != nil {
+		return err
+	}
+	store := &replayWatch{Store: state.NewMemoryStore(), read: make(chan struct{})}
+	manager.SetStateStore(store)
+	channel := &scriptChannel{Fake: channels.NewFake(s.Channel, msgBus, s.AllowFrom)}
+	manager.RegisterChannel(s.Channel, channel)
+
+	model := &scriptedModel{}
+	loop := agent.NewAgentLoop(cfg, msgBus, model)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if err := manager.StartAll(ctx); err != nil {
+		return err
+	}
+	defer manager.StopAll(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		loop.Run(ctx)
+	}()
+	defer func() {
+		loop.Stop()
+		cancel()
+		<-done
+	}()
+
+	select {
+	case <-store.read:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	for i, step := range s.Steps {
+		if err := play(ctx, step, manager, channel, model); err != nil {
+			return fmt.Errorf("step %d (%s): %w", i+1, step, err)
+		}
+	}
+	return model.check()
+}
+
+// replayWatch tells when the manager has read the outbox to replay what
+// an earlier run left. The outbox is empty then, so a send the script
+// makes fail afterwards waits for a retry step.
+type replayWatch struct {
+	state.Store
+	once sync.Once
+	read chan struct{}
+}
+
+func (s *replayWatch) List(ctx context.Context, bucket string) (map[string][]byte, error) {
+	entries, err := s.Store.List(ctx, bucket)
+	if bucket == "outbox" {
+		s.once.Do(func() { close(s.read) })
+	}
+	return entries, err
+}
+
+func play(ctx context.Context, step Step, manager *channels.Manager, channel *scriptChannel, model *scriptedModel) error {
+	switch {
+	case len(step.Model) > 0:
+		model.queue(step.Model)
+	case step.User != "":
+		from, chat := step.From, step.Chat
+		if from == "" {
+			from = "user"
+		}
+		if chat == "" {
+			chat = "chat"
+		}
+		var metadata map[string]string
+		if step.ID != "" {
+			metadata = map[string]string{"message_id": step.ID}
+		}
+		channel.HandleMessage(from, chat, step.User, nil, metadata)
+	case step.Expect != "":
+		waitCtx, cancel := context.WithTimeout(ctx, step.Within)
+		defer cancel()
+		msg, err := channel.Next(waitCtx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("nothing sent within %s", step.Within)
+		}
+		if step.Chat != "" && msg.ChatID != step.Chat {
+			return fmt.Errorf("sent to chat %q: %q", msg.ChatID, msg.Content)
+		}
+		if !step.expect.MatchString(msg.Content) {
+			return fmt.Errorf("sent %q", msg.Content)
+		}
+	case step.Quiet > 0:
+		waitCtx, cancel := context.WithTimeout(ctx, step.Quiet)
+		defer cancel()
+		if msg, err := channel.Next(waitCtx); err == nil {
+			return fmt.Errorf("sent %q to chat %q", msg.Content, msg.ChatID)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	case step.Fail > 0:
+		channel.failNext(step.Fail, step.Error, step.Panic)
+	case step.Retry:
+		manager.RetryOutbox(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package scenario
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestScripts runs every conversation in testdata.
+func TestScripts(t *testing.T) {
+	paths, err := filepath.Glob("testdata/*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no scripts in testdata")
+	}
+	for _, path := range paths {
+		s, err := Load(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			t.Parallel()
+			if err := Run(context.Background(), s); err != nil {
+				t.Errorf("%s: %v", s.Name, err)
+			}
+		})
+	}
+}
+
+func TestRunReportsFailures(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   string
+	}{
+		{"wrong reply", `
+steps:
+  - model: [{reply: "goodbye"}]
+  - user: "hi"
+  - expect: "^hello"
+`, `step 3 (expect "^hello"): sent "goodbye"`},
+		{"wrong chat", `
+steps:
+  - model: [{reply: "hello"}]
+  - user: "hi"
+    chat: "1"
+  - expect: "hello"
+    chat: "2"
+`, `sent to chat "1"`},
+		{"no reply", `
+steps:
+  - fail: 1
+  - model: [{reply: "hello"}]
+  - user: "hi"
+  - expect: "hello"
+    within: 300ms
+`, "nothing sent within 300ms"},
+		{"unexpected reply", `
+steps:
+  - model: [{reply: "hello"}]
+  - user: "hi"
+  - quiet: 2s
+`, `step 3 (quiet 2s): sent "hello"`},
+		{"model saw something else", `
+steps:
+  - model: [{reply: "hello", saw: "^bye$"}]
+  - user: "hi"
+  - expect: "hello"
+`, "does not match"},
+		{"unused model turns", `
+steps:
+  - model: [{reply: "hello"}, {reply: "again"}]
+  - user: "hi"
+  - expect: "hello"
+`, "1 model turns were never requested"},
+		{"missing model turn", `
+steps:
+  - user: "hi"
+  - expect: "Error processing message"
+`, "model request 1 has no scripted turn"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			s, err := Parse([]byte(tt.script))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = Run(context.Background(), s)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Run() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		wantErr string
+	}{
+		{"defaults", "steps:\n  - expect: hi\n", ""},
+		{"no steps", "name: empty\n", "no steps"},
+		{"two actions", "steps:\n  - user: hi\n    expect: hi\n", "step 1: a step needs exactly one"},
+		{"no action", "steps:\n  - chat: \"1\"\n", "step 1: a step needs exactly one"},
+		{"bad regexp", "steps:\n  - expect: \"(\"\n", "step 1: expect:"},
+		{"empty turn", "steps:\n  - model: [{saw: hi}]\n", "model turn 1 needs exactly one"},
+		{"unknown field", "steps:\n  - usr: hi\n", "field usr not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Parse([]byte(tt.script))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Parse() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s.Channel != DefaultChannel || s.Steps[0].Within != defaultWithin {
+				t.Errorf("Parse() = %+v", s)
+			}
+		})
+	}
+}
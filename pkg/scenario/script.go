@@ -0,0 +1,193 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+// Package scenario runs scripted conversations end to end: messages from a
+// fake chat channel go through the real bus, channel manager, and agent
+// loop, answered by a scripted model, and the replies the channel is asked
+// to send are checked against the script. Sends can be made to fail, so
+// retries and error paths are covered without live accounts.
+//
+// Scripts are YAML:
+//
+//	name: Reply survives a failed send
+//	steps:
+//	  - model:
+//	      - reply: "Hello!"
+//	  - fail: 1
+//	  - user: "hi"
+//	  - quiet: 300ms
+//	  - retry: true
+//	  - expect: "^Hello!$"
+package scenario
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// DefaultChannel names the fake channel when a script does not.
+	DefaultChannel = "test"
+	// defaultWithin is how long an expect step waits for a reply.
+	defaultWithin = 5 * time.Second
+)
+
+// Script is a scripted conversation.
+type Script struct {
+	Name string `yaml:"name"`
+	// Channel names the fake channel; DefaultChannel when empty.
+	Channel string `yaml:"channel"`
+	// AllowFrom is the channel's allowlist; empty lets everyone in.
+	AllowFrom []string `yaml:"allow_from"`
+	Steps     []Step   `yaml:"steps"`
+}
+
+// Step is one thing that happens in a conversation. Exactly one of Model,
+// User, Expect, Quiet, Fail, and Retry is set.
+type Step struct {
+	// Model queues what the model answers to its next requests, in order.
+	Model []Turn `yaml:"model"`
+
+	// User is a message from From in Chat, with the platform message ID
+	// ID when set, so redeliveries can be scripted.
+	User string `yaml:"user"`
+	From string `yaml:"from"`
+	Chat string `yaml:"chat"`
+	ID   string `yaml:"id"`
+
+	// Expect is a regular expression the next message sent to the channel
+	// must match, within Within. With Chat set, it must go to that chat.
+	Expect string        `yaml:"expect"`
+	Within time.Duration `yaml:"within"`
+
+	// Quiet expects nothing to be sent for this long.
+	Quiet time.Duration `yaml:"quiet"`
+
+	// Fail makes the channel's next Fail sends return Error, or panic with
+	// Panic set.
+	Fail  int    `yaml:"fail"`
+	Error string `yaml:"error"`
+	Panic bool   `yaml:"panic"`
+
+	// Retry retries the messages in the outbox now.
+	Retry bool `yaml:"retry"`
+
+	expect *regexp.Regexp
+}
+
+// Turn is one model response: a reply, a tool call, or an error.
+type Turn struct {
+	Reply string                 `yaml:"reply"`
+	Tool  string                 `yaml:"tool"`
+	Args  map[string]interface{} `yaml:"args"`
+	Error string                 `yaml:"error"`
+	// Saw is a regular expression the latest user message in the request
+	// must match.
+	Saw string `yaml:"saw"`
+
+	saw *regexp.Regexp
+}
+
+// Load reads the script at path.
+func Load(path string) (*Script, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// Parse parses and checks a script.
+func Parse(data []byte) (*Script, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	var s Script
+	if err := dec.Decode(&s); err != nil {
+		return nil, err
+	}
+	if s.Channel == "" {
+		s.Channel = DefaultChannel
+	}
+	if len(s.Steps) == 0 {
+		return nil, errors.New("script has no steps")
+	}
+	for i := range s.Steps {
+		if err := s.Steps[i].check(); err != nil {
+			return nil, fmt.Errorf("step %d: %w", i+1, err)
+		}
+	}
+	return &s, nil
+}
+
+func (st *Step) check() error {
+	actions := 0
+	for _, set := range []bool{len(st.Model) > 0, st.User != "", st.Expect != "", st.Quiet > 0, st.Fail > 0, st.Retry} {
+		if set {
+			actions++
+		}
+	}
+	if actions != 1 {
+		return errors.New("a step needs exactly one of model, user, expect, quiet, fail, and retry")
+	}
+	if st.Expect != "" {
+		re, err := regexp.Compile(st.Expect)
+		if err != nil {
+			return fmt.Errorf("expect: %w", err)
+		}
+		st.expect = re
+		if st.Within <= 0 {
+			st.Within = defaultWithin
+		}
+	}
+	for i := range st.Model {
+		turn := &st.Model[i]
+		kinds := 0
+		for _, set := range []bool{turn.Reply != "", turn.Tool != "", turn.Error != ""} {
+			if set {
+				kinds++
+			}
+		}
+		if kinds != 1 {
+			return fmt.Errorf("model turn %d needs exactly one of reply, tool, and error", i+1)
+		}
+		if turn.Saw != "" {
+			re, err := regexp.Compile(turn.Saw)
+			if err != nil {
+				return fmt.Errorf("model turn %d: saw: %w", i+1, err)
+			}
+			turn.saw = re
+		}
+	}
+	return nil
+}
+
+// String describes the step for failure messages.
+func (st Step) String() string {
+	switch {
+	case len(st.Model) > 0:
+		return fmt.Sprintf("model (%d turns)", len(st.Model))
+	case st.User != "":
+		return fmt.Sprintf("user %q", st.User)
+	case st.Expect != "":
+		return fmt.Sprintf("expect %q", st.Expect)
+	case st.Quiet > 0:
+		return fmt.Sprintf("quiet %s", st.Quiet)
+	case st.Fail > 0:
+		return fmt.Sprintf("fail %d", st.Fail)
+	default:
+		return "retry"
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -12,11 +13,31 @@ import (
 )
 
 type Session struct {
-	Key      string              `json:"key"`
-	Messages []providers.Message `json:"messages"`
-	Summary  string              `json:"summary,omitempty"`
-	Created  time.Time           `json:"created"`
-	Updated  time.Time           `json:"updated"`
+	Key       string              `json:"key"`
+	Messages  []providers.Message `json:"messages"`
+	Summary   string              `json:"summary,omitempty"`
+	Persona   string              `json:"persona,omitempty"`
+	Language  string              `json:"language,omitempty"`
+	Translate string              `json:"translate,omitempty"`         // "on", "off", or "" for the configured default
+	Detected  string              `json:"detected_language,omitempty"` // Language the user last wrote in, see i18n.Detect
+	Muted     time.Time           `json:"muted_until,omitempty"`
+	Feedback  []Feedback          `json:"feedback,omitempty"`
+	Created   time.Time           `json:"created"`
+	Updated   time.Time           `json:"updated"`
+}
+
+// Feedback is a user's rating of an assistant reply. The rated exchange is
+// copied, since history is later summarized away.
+type Feedback struct {
+	Session  string    `json:"session"`
+	Rating   string    `json:"rating"` // "good" or "bad"
+	SenderID string    `json:"sender_id,omitempty"`
+	Comment  string    `json:"comment,omitempty"`
+	Prompt   string    `json:"prompt"`
+	Response string    `json:"response"`
+	Persona  string    `json:"persona,omitempty"`
+	Model    string    `json:"model,omitempty"`
+	Time     time.Time `json:"time"`
 }
 
 type SessionManager struct {
@@ -122,6 +143,121 @@ func (sm *SessionManager) SetSummary(key string, summary string) {
 	}
 }
 
+// GetPersona returns the persona selected for the session with /persona.
+func (sm *SessionManager) GetPersona(key string) string {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	session, ok := sm.sessions[key]
+	if !ok {
+		return ""
+	}
+	return session.Persona
+}
+
+// SetPersona selects a persona for the session, creating it if needed. An
+// empty name clears the selection.
+func (sm *SessionManager) SetPersona(key string, persona string) {
+	session := sm.GetOrCreate(key)
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	session.Persona = persona
+	session.Updated = time.Now()
+}
+
+// GetLanguage returns the reply language selected for the session with
+// /lang, or "" for none.
+func (sm *SessionManager) GetLanguage(key string) string {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	session, ok := sm.sessions[key]
+	if !ok {
+		return ""
+	}
+	return session.Language
+}
+
+// SetLanguage selects the session's reply language. An empty value clears
+// it.
+func (sm *SessionManager) SetLanguage(key string, language string) {
+	session := sm.GetOrCreate(key)
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	session.Language = language
+	session.Updated = time.Now()
+}
+
+// GetTranslate returns the session's /translate setting: "on", "off", or ""
+// when the configured default applies.
+func (sm *SessionManager) GetTranslate(key string) string {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	session, ok := sm.sessions[key]
+	if !ok {
+		return ""
+	}
+	return session.Translate
+}
+
+// SetTranslate stores the session's /translate setting. An empty value
+// restores the configured default.
+func (sm *SessionManager) SetTranslate(key string, value string) {
+	session := sm.GetOrCreate(key)
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	session.Translate = value
+	session.Updated = time.Now()
+}
+
+// GetDetectedLanguage returns the language the user last wrote in, or "".
+func (sm *SessionManager) GetDetectedLanguage(key string) string {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	session, ok := sm.sessions[key]
+	if !ok {
+		return ""
+	}
+	return session.Detected
+}
+
+// SetDetectedLanguage records the language the user last wrote in.
+func (sm *SessionManager) SetDetectedLanguage(key string, language string) {
+	session := sm.GetOrCreate(key)
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	session.Detected = language
+}
+
+// MutedUntil returns when the session's /mute ends. The zero time means
+// the session is not muted.
+func (sm *SessionManager) MutedUntil(key string) time.Time {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	session, ok := sm.sessions[key]
+	if !ok {
+		return time.Time{}
+	}
+	return session.Muted
+}
+
+// SetMutedUntil mutes the session until t. The zero time unmutes it.
+func (sm *SessionManager) SetMutedUntil(key string, t time.Time) {
+	session := sm.GetOrCreate(key)
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	session.Muted = t
+	session.Updated = time.Now()
+}
+
 func (sm *SessionManager) TruncateHistory(key string, keepLast int) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
@@ -145,6 +281,136 @@ func (sm *SessionManager) TruncateHistory(key string, keepLast int) {
 	session.Updated = time.Now()
 }
 
+// DropOldest removes the first n messages of a session's history. It is used
+// after those messages have been folded into the summary, so messages added
+// while summarization was running are preserved.
+func (sm *SessionManager) DropOldest(key string, n int) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	session, ok := sm.sessions[key]
+	if !ok || n <= 0 {
+		return
+	}
+
+	if n >= len(session.Messages) {
+		session.Messages = []providers.Message{}
+	} else {
+		session.Messages = append([]providers.Message(nil), session.Messages[n:]...)
+	}
+	session.Updated = time.Now()
+}
+
+// ReplaceMessage swaps the content of a session's latest message with the
+// given role and content for replacement. It reports whether there was
+// one.
+func (sm *SessionManager) ReplaceMessage(key, role, content, replacement string) bool {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	session, ok := sm.sessions[key]
+	if !ok {
+		return false
+	}
+	for i := len(session.Messages) - 1; i >= 0; i-- {
+		if m := &session.Messages[i]; m.Role == role && m.Content == content {
+			m.Content = replacement
+			session.Updated = time.Now()
+			return true
+		}
+	}
+	return false
+}
+
+// LastExchange returns the latest assistant reply with text and the user
+// message that prompted it.
+func (sm *SessionManager) LastExchange(key string) (prompt, response string, ok bool) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	session, exists := sm.sessions[key]
+	if !exists {
+		return "", "", false
+	}
+	msgs := session.Messages
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i].Role != "assistant" || msgs[i].Content == "" {
+			continue
+		}
+		for j := i - 1; j >= 0; j-- {
+			if msgs[j].Role == "user" {
+				return msgs[j].Content, msgs[i].Content, true
+			}
+		}
+		return "", msgs[i].Content, true
+	}
+	return "", "", false
+}
+
+// AddFeedback records a rating on the session.
+func (sm *SessionManager) AddFeedback(key string, fb Feedback) {
+	session := sm.GetOrCreate(key)
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	fb.Session = key
+	session.Feedback = append(session.Feedback, fb)
+	session.Updated = time.Now()
+}
+
+// AllFeedback returns the feedback of every session, oldest first.
+func (sm *SessionManager) AllFeedback() []Feedback {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	var out []Feedback
+	for _, session := range sm.sessions {
+		out = append(out, session.Feedback...)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Time.Before(out[j].Time) })
+	return out
+}
+
+// Reset clears a session's history and summary. Settings such as the
+// persona and language are kept, as is recorded feedback.
+func (sm *SessionManager) Reset(key string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	session, ok := sm.sessions[key]
+	if !ok {
+		return
+	}
+	session.Messages = []providers.Message{}
+	session.Summary = ""
+	session.Updated = time.Now()
+}
+
+// Archive copies a session's history and summary to archiveKey and saves
+// the copy. It reports false when there is nothing to archive.
+func (sm *SessionManager) Archive(key, archiveKey string) (bool, error) {
+	sm.mu.Lock()
+	session, ok := sm.sessions[key]
+	if !ok || (len(session.Messages) == 0 && session.Summary == "") {
+		sm.mu.Unlock()
+		return false, nil
+	}
+	archived := &Session{
+		Key:       archiveKey,
+		Messages:  append([]providers.Message(nil), session.Messages...),
+		Summary:   session.Summary,
+		Persona:   session.Persona,
+		Language:  session.Language,
+		Translate: session.Translate,
+		Created:   session.Created,
+		Updated:   time.Now(),
+	}
+	sm.sessions[archiveKey] = archived
+	sm.mu.Unlock()
+
+	return true, sm.Save(archiveKey)
+}
+
 // sanitizeFilename converts a session key into a cross-platform safe filename.
 // Session keys use "channel:chatID" (e.g. "telegram:123456") but ':' is the
 // volume separator on Windows, so filepath.Base would misinterpret the key.
@@ -178,10 +444,16 @@ func (sm *SessionManager) Save(key string) error {
 	}
 
 	snapshot := Session{
-		Key:     stored.Key,
-		Summary: stored.Summary,
-		Created: stored.Created,
-		Updated: stored.Updated,
+		Key:       stored.Key,
+		Summary:   stored.Summary,
+		Persona:   stored.Persona,
+		Language:  stored.Language,
+		Translate: stored.Translate,
+		Detected:  stored.Detected,
+		Muted:     stored.Muted,
+		Feedback:  append([]Feedback(nil), stored.Feedback...),
+		Created:   stored.Created,
+		Updated:   stored.Updated,
 	}
 	if len(stored.Messages) > 0 {
 		snapshot.Messages = make([]providers.Message, len(stored.Messages))
@@ -4,6 +4,9 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
 )
 
 func TestSanitizeFilename(t *testing.T) {
@@ -72,3 +75,157 @@ func TestSave_RejectsPathTraversal(t *testing.T) {
 		}
 	}
 }
+
+func TestDropOldest_KeepsMessagesAddedLater(t *testing.T) {
+	sm := NewSessionManager("")
+	key := "telegram:1"
+	for _, content := range []string{"a", "b", "c", "d"} {
+		sm.AddMessage(key, "user", content)
+	}
+
+	sm.DropOldest(key, 2)
+
+	history := sm.GetHistory(key)
+	if len(history) != 2 || history[0].Content != "c" || history[1].Content != "d" {
+		t.Fatalf("unexpected history after DropOldest: %+v", history)
+	}
+
+	sm.DropOldest(key, 10)
+	if got := len(sm.GetHistory(key)); got != 0 {
+		t.Errorf("expected empty history, got %d messages", got)
+	}
+}
+
+func TestArchiveAndReset(t *testing.T) {
+	tmpDir := t.TempDir()
+	sm := NewSessionManager(tmpDir)
+	key := "telegram:1"
+
+	if archived, err := sm.Archive(key, key+"@old"); archived || err != nil {
+		t.Fatalf("Archive of missing session = %v, %v", archived, err)
+	}
+
+	sm.AddMessage(key, "user", "hello")
+	sm.SetSummary(key, "greetings")
+	sm.SetPersona(key, "formal")
+
+	archived, err := sm.Archive(key, key+"@old")
+	if !archived || err != nil {
+		t.Fatalf("Archive() = %v, %v", archived, err)
+	}
+	sm.Reset(key)
+
+	if len(sm.GetHistory(key)) != 0 || sm.GetSummary(key) != "" {
+		t.Errorf("Reset left history or summary behind")
+	}
+	if sm.GetPersona(key) != "formal" {
+		t.Errorf("Reset should keep the persona")
+	}
+
+	// The archive survives a restart
+	reloaded := NewSessionManager(tmpDir)
+	if h := reloaded.GetHistory(key + "@old"); len(h) != 1 || h[0].Content != "hello" {
+		t.Errorf("archived history = %+v", h)
+	}
+	if reloaded.GetSummary(key+"@old") != "greetings" {
+		t.Errorf("archived summary lost")
+	}
+}
+
+func TestLanguageAndMuteSurviveRestart(t *testing.T) {
+	tmpDir := t.TempDir()
+	sm := NewSessionManager(tmpDir)
+	key := "telegram:1"
+
+	sm.SetLanguage(key, "fr")
+	until := time.Now().Add(30 * time.Minute).Truncate(time.Second)
+	sm.SetMutedUntil(key, until)
+	if err := sm.Save(key); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := NewSessionManager(tmpDir)
+	if got := reloaded.GetLanguage(key); got != "fr" {
+		t.Errorf("language = %q after restart, want fr", got)
+	}
+	if got := reloaded.MutedUntil(key); !got.Equal(until) {
+		t.Errorf("muted until %v after restart, want %v", got, until)
+	}
+}
+
+func TestTranslateSurvivesRestart(t *testing.T) {
+	tmpDir := t.TempDir()
+	sm := NewSessionManager(tmpDir)
+	key := "whatsapp:123@s.whatsapp.net"
+
+	sm.SetTranslate(key, "off")
+	if err := sm.Save(key); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := NewSessionManager(tmpDir).GetTranslate(key); got != "off" {
+		t.Errorf("translate = %q after restart, want off", got)
+	}
+}
+
+func TestDetectedLanguageSurvivesRestart(t *testing.T) {
+	tmpDir := t.TempDir()
+	sm := NewSessionManager(tmpDir)
+	key := "telegram:1"
+
+	sm.SetDetectedLanguage(key, "es")
+	if err := sm.Save(key); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := NewSessionManager(tmpDir).GetDetectedLanguage(key); got != "es" {
+		t.Errorf("detected language = %q after restart, want es", got)
+	}
+}
+
+func TestSettingsAndFeedbackSurviveRestart(t *testing.T) {
+	tmpDir := t.TempDir()
+	sm := NewSessionManager(tmpDir)
+	key := "telegram:1"
+
+	sm.AddMessage(key, "user", "hi")
+	sm.SetLanguage(key, "de")
+	sm.SetTranslate(key, "on")
+	until := time.Now().Add(time.Hour).Truncate(time.Second)
+	sm.SetMutedUntil(key, until)
+	sm.AddFeedback(key, Feedback{Rating: "good", Prompt: "hi", Response: "hello", Time: time.Now()})
+	if err := sm.Save(key); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := NewSessionManager(tmpDir)
+	if reloaded.GetLanguage(key) != "de" || reloaded.GetTranslate(key) != "on" || !reloaded.MutedUntil(key).Equal(until) {
+		t.Errorf("settings lost: language %q, translate %q, muted %v",
+			reloaded.GetLanguage(key), reloaded.GetTranslate(key), reloaded.MutedUntil(key))
+	}
+	fb := reloaded.AllFeedback()
+	if len(fb) != 1 || fb[0].Session != key || fb[0].Response != "hello" {
+		t.Errorf("feedback = %+v", fb)
+	}
+}
+
+func TestLastExchange(t *testing.T) {
+	sm := NewSessionManager("")
+	key := "telegram:1"
+
+	if _, _, ok := sm.LastExchange(key); ok {
+		t.Error("LastExchange on a missing session reported ok")
+	}
+
+	sm.AddMessage(key, "user", "first")
+	sm.AddMessage(key, "assistant", "one")
+	sm.AddMessage(key, "user", "second")
+	sm.AddFullMessage(key, providers.Message{Role: "assistant", ToolCalls: []providers.ToolCall{{ID: "1"}}})
+	sm.AddMessage(key, "tool", "result")
+	sm.AddMessage(key, "assistant", "two")
+
+	prompt, response, ok := sm.LastExchange(key)
+	if !ok || prompt != "second" || response != "two" {
+		t.Errorf("LastExchange() = %q, %q, %v", prompt, response, ok)
+	}
+}
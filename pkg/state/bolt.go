@@ -0,0 +1,187 @@
+package state
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// claimBucketPrefix and leaseBucketPrefix keep claim and lease buckets
+// apart from value buckets.
+const (
+	claimBucketPrefix = "claims/"
+	leaseBucketPrefix = "leases/"
+)
+
+// BoltStore is a Store in a bbolt file. bbolt takes an exclusive lock on
+// the file, so only one process can have it open; CLI commands that need
+// state fail while the gateway is running.
+type BoltStore struct {
+	db  *bolt.DB
+	now func() time.Time
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+// OpenBolt opens (or creates) the bbolt file at path.
+func OpenBolt(path string) (*BoltStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create state directory: %w", err)
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 2 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state database %s (is the gateway running?): %w", path, err)
+	}
+	return &BoltStore{db: db, now: time.Now}, nil
+}
+
+func (s *BoltStore) Get(ctx context.Context, bucket, key string) ([]byte, error) {
+	var value []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return ErrNotFound
+		}
+		v := b.Get([]byte(key))
+		if v == nil {
+			return ErrNotFound
+		}
+		value = append([]byte(nil), v...)
+		return nil
+	})
+	return value, err
+}
+
+func (s *BoltStore) Put(ctx context.Context, bucket, key string, value []byte) error {
+	if value == nil {
+		value = []byte{}
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(key), value)
+	})
+}
+
+func (s *BoltStore) Delete(ctx context.Context, bucket, key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		return b.Delete([]byte(key))
+	})
+}
+
+func (s *BoltStore) List(ctx context.Context, bucket string) (map[string][]byte, error) {
+	out := make(map[string][]byte)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			out[string(k)] = append([]byte(nil), v...)
+			return nil
+		})
+	})
+	return out, err
+}
+
+// Claim stores the expiry as the claim's value, in Unix milliseconds.
+func (s *BoltStore) Claim(ctx context.Context, bucket, key string, ttl time.Duration) (bool, error) {
+	now := s.now()
+	s.mu.Lock()
+	sweep := now.Sub(s.lastSweep) >= sweepInterval
+	if sweep {
+		s.lastSweep = now
+	}
+	s.mu.Unlock()
+
+	claimed := false
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(claimBucketPrefix + bucket))
+		if err != nil {
+			return err
+		}
+		if sweep {
+			if err := sweepBolt(b, now); err != nil {
+				return err
+			}
+		}
+		if v := b.Get([]byte(key)); v != nil && !expired(v, now) {
+			return nil
+		}
+		claimed = true
+		exp := make([]byte, 8)
+		binary.BigEndian.PutUint64(exp, uint64(now.Add(ttl).UnixMilli()))
+		return b.Put([]byte(key), exp)
+	})
+	return claimed, err
+}
+
+// Lease stores the expiry in Unix milliseconds followed by the owner.
+func (s *BoltStore) Lease(ctx context.Context, bucket, key, owner string, ttl time.Duration) (bool, error) {
+	now := s.now()
+	held := false
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(leaseBucketPrefix + bucket))
+		if err != nil {
+			return err
+		}
+		if v := b.Get([]byte(key)); len(v) >= 8 && string(v[8:]) != owner && !expired(v[:8], now) {
+			return nil
+		}
+		held = true
+		v := make([]byte, 8, 8+len(owner))
+		binary.BigEndian.PutUint64(v, uint64(now.Add(ttl).UnixMilli()))
+		return b.Put([]byte(key), append(v, owner...))
+	})
+	return held, err
+}
+
+func (s *BoltStore) Release(ctx context.Context, bucket, key, owner string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(leaseBucketPrefix + bucket))
+		if b == nil {
+			return nil
+		}
+		if v := b.Get([]byte(key)); len(v) >= 8 && string(v[8:]) == owner {
+			return b.Delete([]byte(key))
+		}
+		return nil
+	})
+}
+
+func sweepBolt(b *bolt.Bucket, now time.Time) error {
+	var stale [][]byte
+	b.ForEach(func(k, v []byte) error {
+		if expired(v, now) {
+			stale = append(stale, append([]byte(nil), k...))
+		}
+		return nil
+	})
+	for _, k := range stale {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func expired(v []byte, now time.Time) bool {
+	return len(v) != 8 || int64(binary.BigEndian.Uint64(v)) <= now.UnixMilli()
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,111 @@
+package state
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store that lives in memory only. It suits tests and
+// one-off commands that have no state to keep.
+type MemoryStore struct {
+	mu     sync.Mutex
+	values map[string]map[string][]byte
+	claims map[string]time.Time // bucket + "\x00" + key -> expiry
+	leases map[string]memoryLease
+	now    func() time.Time
+}
+
+type memoryLease struct {
+	owner   string
+	expires time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		values: make(map[string]map[string][]byte),
+		claims: make(map[string]time.Time),
+		leases: make(map[string]memoryLease),
+		now:    time.Now,
+	}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, bucket, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.values[bucket][key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), v...), nil
+}
+
+func (s *MemoryStore) Put(ctx context.Context, bucket, key string, value []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.values[bucket] == nil {
+		s.values[bucket] = make(map[string][]byte)
+	}
+	s.values[bucket][key] = append([]byte(nil), value...)
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, bucket, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.values[bucket], key)
+	return nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, bucket string) (map[string][]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string][]byte, len(s.values[bucket]))
+	for k, v := range s.values[bucket] {
+		out[k] = append([]byte(nil), v...)
+	}
+	return out, nil
+}
+
+func (s *MemoryStore) Claim(ctx context.Context, bucket, key string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	for k, exp := range s.claims {
+		if !now.Before(exp) {
+			delete(s.claims, k)
+		}
+	}
+	id := bucket + "\x00" + key
+	if _, ok := s.claims[id]; ok {
+		return false, nil
+	}
+	s.claims[id] = now.Add(ttl)
+	return true, nil
+}
+
+func (s *MemoryStore) Lease(ctx context.Context, bucket, key, owner string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	id := bucket + "\x00" + key
+	if l, ok := s.leases[id]; ok && l.owner != owner && now.Before(l.expires) {
+		return false, nil
+	}
+	s.leases[id] = memoryLease{owner: owner, expires: now.Add(ttl)}
+	return true, nil
+}
+
+func (s *MemoryStore) Release(ctx context.Context, bucket, key, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := bucket + "\x00" + key
+	if l, ok := s.leases[id]; ok && l.owner == owner {
+		delete(s.leases, id)
+	}
+	return nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
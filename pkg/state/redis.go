@@ -0,0 +1,109 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore is a Store in Redis, for deployments that run several
+// gateways or keep state off the device. Each bucket is a hash; claims are
+// plain keys with an expiry.
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// OpenRedis connects to the server at url, e.g. redis://:password@host:6379/0.
+// prefix is prepended to every key, so several installations can share a
+// server.
+func OpenRedis(url, prefix string) (*RedisStore, error) {
+	if url == "" {
+		return nil, fmt.Errorf("redis backend needs a URL")
+	}
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis URL: %w", err)
+	}
+	client := redis.NewClient(opts)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+	return &RedisStore{client: client, prefix: prefix}, nil
+}
+
+func (s *RedisStore) bucketKey(bucket string) string {
+	return s.prefix + bucket
+}
+
+func (s *RedisStore) Get(ctx context.Context, bucket, key string) ([]byte, error) {
+	value, err := s.client.HGet(ctx, s.bucketKey(bucket), key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrNotFound
+	}
+	return value, err
+}
+
+func (s *RedisStore) Put(ctx context.Context, bucket, key string, value []byte) error {
+	return s.client.HSet(ctx, s.bucketKey(bucket), key, value).Err()
+}
+
+func (s *RedisStore) Delete(ctx context.Context, bucket, key string) error {
+	return s.client.HDel(ctx, s.bucketKey(bucket), key).Err()
+}
+
+func (s *RedisStore) List(ctx context.Context, bucket string) (map[string][]byte, error) {
+	values, err := s.client.HGetAll(ctx, s.bucketKey(bucket)).Result()
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string][]byte, len(values))
+	for k, v := range values {
+		out[k] = []byte(v)
+	}
+	return out, nil
+}
+
+func (s *RedisStore) Claim(ctx context.Context, bucket, key string, ttl time.Duration) (bool, error) {
+	return s.client.SetNX(ctx, s.prefix+claimBucketPrefix+bucket+":"+key, 1, ttl).Result()
+}
+
+// leaseScript takes or renews a lease atomically: KEYS[1] is the lease,
+// ARGV[1] the owner, ARGV[2] the TTL in milliseconds.
+var leaseScript = redis.NewScript(`
+local holder = redis.call("GET", KEYS[1])
+if holder == false or holder == ARGV[1] then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+	return 1
+end
+return 0`)
+
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+func (s *RedisStore) leaseKey(bucket, key string) string {
+	return s.prefix + "leases/" + bucket + ":" + key
+}
+
+func (s *RedisStore) Lease(ctx context.Context, bucket, key, owner string, ttl time.Duration) (bool, error) {
+	n, err := leaseScript.Run(ctx, s.client, []string{s.leaseKey(bucket, key)}, owner, ttl.Milliseconds()).Int()
+	return n == 1, err
+}
+
+func (s *RedisStore) Release(ctx context.Context, bucket, key, owner string) error {
+	return releaseScript.Run(ctx, s.client, []string{s.leaseKey(bucket, key)}, owner).Err()
+}
+
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
@@ -0,0 +1,162 @@
+package state
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS kv (
+	bucket TEXT NOT NULL,
+	key    TEXT NOT NULL,
+	value  BLOB NOT NULL,
+	PRIMARY KEY (bucket, key)
+);
+CREATE TABLE IF NOT EXISTS claims (
+	bucket     TEXT NOT NULL,
+	key        TEXT NOT NULL,
+	expires_ms INTEGER NOT NULL,
+	PRIMARY KEY (bucket, key)
+);
+CREATE INDEX IF NOT EXISTS idx_claims_expires ON claims(expires_ms);
+CREATE TABLE IF NOT EXISTS leases (
+	bucket     TEXT NOT NULL,
+	key        TEXT NOT NULL,
+	owner      TEXT NOT NULL,
+	expires_ms INTEGER NOT NULL,
+	PRIMARY KEY (bucket, key)
+);
+`
+
+// SQLiteStore is a Store in a SQLite database. Several processes may open
+// the same file, so CLI commands work while the gateway is running.
+type SQLiteStore struct {
+	db  *sql.DB
+	now func() time.Time
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+// OpenSQLite opens (or creates) the database at path.
+func OpenSQLite(path string) (*SQLiteStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create state directory: %w", err)
+	}
+
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)", path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state database: %w", err)
+	}
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize state schema: %w", err)
+	}
+	return &SQLiteStore{db: db, now: time.Now}, nil
+}
+
+func (s *SQLiteStore) Get(ctx context.Context, bucket, key string) ([]byte, error) {
+	var value []byte
+	err := s.db.QueryRowContext(ctx, "SELECT value FROM kv WHERE bucket = ? AND key = ?", bucket, key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return value, err
+}
+
+func (s *SQLiteStore) Put(ctx context.Context, bucket, key string, value []byte) error {
+	if value == nil {
+		value = []byte{}
+	}
+	_, err := s.db.ExecContext(ctx, `INSERT INTO kv (bucket, key, value) VALUES (?, ?, ?)
+		ON CONFLICT(bucket, key) DO UPDATE SET value = excluded.value`, bucket, key, value)
+	return err
+}
+
+func (s *SQLiteStore) Delete(ctx context.Context, bucket, key string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM kv WHERE bucket = ? AND key = ?", bucket, key)
+	return err
+}
+
+func (s *SQLiteStore) List(ctx context.Context, bucket string) (map[string][]byte, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT key, value FROM kv WHERE bucket = ?", bucket)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make(map[string][]byte)
+	for rows.Next() {
+		var key string
+		var value []byte
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		out[key] = value
+	}
+	return out, rows.Err()
+}
+
+func (s *SQLiteStore) Claim(ctx context.Context, bucket, key string, ttl time.Duration) (bool, error) {
+	now := s.now()
+	if err := s.sweep(ctx, now); err != nil {
+		return false, err
+	}
+
+	res, err := s.db.ExecContext(ctx, `INSERT INTO claims (bucket, key, expires_ms) VALUES (?, ?, ?)
+		ON CONFLICT(bucket, key) DO UPDATE SET expires_ms = excluded.expires_ms
+		WHERE claims.expires_ms <= ?`,
+		bucket, key, now.Add(ttl).UnixMilli(), now.UnixMilli())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *SQLiteStore) Lease(ctx context.Context, bucket, key, owner string, ttl time.Duration) (bool, error) {
+	now := s.now()
+	res, err := s.db.ExecContext(ctx, `INSERT INTO leases (bucket, key, owner, expires_ms) VALUES (?, ?, ?, ?)
+		ON CONFLICT(bucket, key) DO UPDATE SET owner = excluded.owner, expires_ms = excluded.expires_ms
+		WHERE leases.owner = excluded.owner OR leases.expires_ms <= ?`,
+		bucket, key, owner, now.Add(ttl).UnixMilli(), now.UnixMilli())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (s *SQLiteStore) Release(ctx context.Context, bucket, key, owner string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM leases WHERE bucket = ? AND key = ? AND owner = ?", bucket, key, owner)
+	return err
+}
+
+// sweep deletes expired claims, at most once per sweepInterval.
+func (s *SQLiteStore) sweep(ctx context.Context, now time.Time) error {
+	s.mu.Lock()
+	due := now.Sub(s.lastSweep) >= sweepInterval
+	if due {
+		s.lastSweep = now
+	}
+	s.mu.Unlock()
+	if !due {
+		return nil
+	}
+	_, err := s.db.ExecContext(ctx, "DELETE FROM claims WHERE expires_ms <= ?", now.UnixMilli())
+	return err
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,89 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNotFound is returned by Store.Get for a missing key.
+var ErrNotFound = errors.New("state: key not found")
+
+// Store is a key-value store for runtime state, so features such as the
+// scheduler, preference memory, message dedup, and allowlist grants share
+// one consistent place to persist data instead of each managing its own
+// files. Keys are grouped in buckets, one per feature.
+type Store interface {
+	// Get returns the value stored under key, or ErrNotFound.
+	Get(ctx context.Context, bucket, key string) ([]byte, error)
+	// Put stores value under key, replacing any previous value.
+	Put(ctx context.Context, bucket, key string, value []byte) error
+	// Delete removes key. Deleting a missing key is not an error.
+	Delete(ctx context.Context, bucket, key string) error
+	// List returns every key and value in bucket.
+	List(ctx context.Context, bucket string) (map[string][]byte, error)
+	// Claim records key for ttl unless it is already recorded, and reports
+	// whether this call recorded it. Claims are one-shot markers, such as
+	// "message seen", kept apart from values: Get and List do not see them.
+	Claim(ctx context.Context, bucket, key string, ttl time.Duration) (bool, error)
+	// Lease gives key to owner for ttl if it is free, expired, or already
+	// owner's, in which case it is renewed, and reports whether owner holds
+	// it now. Leases elect one of several processes sharing the store.
+	Lease(ctx context.Context, bucket, key, owner string, ttl time.Duration) (bool, error)
+	// Release ends owner's lease on key early. Releasing a lease held by
+	// someone else does nothing.
+	Release(ctx context.Context, bucket, key, owner string) error
+	Close() error
+}
+
+// Backends.
+const (
+	BackendSQLite = "sqlite"
+	BackendBolt   = "bolt"
+	BackendRedis  = "redis"
+)
+
+// Options selects and configures a backend.
+type Options struct {
+	Backend     string // sqlite (default), bolt, or redis
+	Path        string // Database file for sqlite and bolt
+	RedisURL    string // e.g. redis://localhost:6379/0
+	RedisPrefix string // Prepended to every Redis key
+}
+
+// Open opens the store described by opts.
+func Open(opts Options) (Store, error) {
+	switch opts.Backend {
+	case "", BackendSQLite:
+		return OpenSQLite(opts.Path)
+	case BackendBolt:
+		return OpenBolt(opts.Path)
+	case BackendRedis:
+		return OpenRedis(opts.RedisURL, opts.RedisPrefix)
+	default:
+		return nil, fmt.Errorf("unknown state backend %q, use sqlite, bolt, or redis", opts.Backend)
+	}
+}
+
+// GetJSON decodes the JSON value stored under key into v.
+func GetJSON(ctx context.Context, s Store, bucket, key string, v interface{}) error {
+	data, err := s.Get(ctx, bucket, key)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// PutJSON stores v under key as JSON.
+func PutJSON(ctx context.Context, s Store, bucket, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.Put(ctx, bucket, key, data)
+}
+
+// sweepInterval is how often the embedded backends delete expired claims.
+const sweepInterval = time.Minute
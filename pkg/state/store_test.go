@@ -0,0 +1,206 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStores(t *testing.T) {
+	backends := map[string]func(t *testing.T) Store{
+		"memory": func(t *testing.T) Store { return NewMemoryStore() },
+		"sqlite": func(t *testing.T) Store {
+			s, err := OpenSQLite(filepath.Join(t.TempDir(), "state.db"))
+			if err != nil {
+				t.Fatalf("OpenSQLite() error = %v", err)
+			}
+			return s
+		},
+		"bolt": func(t *testing.T) Store {
+			s, err := OpenBolt(filepath.Join(t.TempDir(), "state.bolt"))
+			if err != nil {
+				t.Fatalf("OpenBolt() error = %v", err)
+			}
+			return s
+		},
+	}
+	// Redis needs a server; point PICOCLAW_TEST_REDIS_URL at a scratch database.
+	if url := os.Getenv("PICOCLAW_TEST_REDIS_URL"); url != "" {
+		backends["redis"] = func(t *testing.T) Store {
+			s, err := OpenRedis(url, "picoclaw-test:"+t.Name()+":")
+			if err != nil {
+				t.Fatalf("OpenRedis() error = %v", err)
+			}
+			return s
+		}
+	}
+
+	for name, open := range backends {
+		t.Run(name, func(t *testing.T) {
+			s := open(t)
+			defer s.Close()
+			testStore(t, s)
+		})
+	}
+}
+
+func testStore(t *testing.T, s Store) {
+	ctx := context.Background()
+
+	if _, err := s.Get(ctx, "b", "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(missing) error = %v, want ErrNotFound", err)
+	}
+
+	if err := s.Put(ctx, "b", "k1", []byte("v1")); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	s.Put(ctx, "b", "k2", []byte("v2"))
+	s.Put(ctx, "other", "k1", []byte("x"))
+	if err := s.Put(ctx, "b", "k1", []byte("v1b")); err != nil {
+		t.Fatalf("Put(replace) error = %v", err)
+	}
+
+	v, err := s.Get(ctx, "b", "k1")
+	if err != nil || string(v) != "v1b" {
+		t.Errorf("Get(k1) = %q, %v; want v1b", v, err)
+	}
+
+	all, err := s.List(ctx, "b")
+	if err != nil || len(all) != 2 || string(all["k2"]) != "v2" {
+		t.Errorf("List() = %v, %v", all, err)
+	}
+
+	if err := s.Delete(ctx, "b", "k1"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if err := s.Delete(ctx, "b", "k1"); err != nil {
+		t.Errorf("Delete(missing) error = %v", err)
+	}
+	if _, err := s.Get(ctx, "b", "k1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(deleted) error = %v, want ErrNotFound", err)
+	}
+	if empty, err := s.List(ctx, "none"); err != nil || len(empty) != 0 {
+		t.Errorf("List(empty bucket) = %v, %v", empty, err)
+	}
+
+	var decoded map[string]int
+	if err := PutJSON(ctx, s, "b", "json", map[string]int{"n": 3}); err != nil {
+		t.Fatalf("PutJSON() error = %v", err)
+	}
+	if err := GetJSON(ctx, s, "b", "json", &decoded); err != nil || decoded["n"] != 3 {
+		t.Errorf("GetJSON() = %v, %v", decoded, err)
+	}
+
+	first, err := s.Claim(ctx, "seen", "m1", time.Hour)
+	if err != nil || !first {
+		t.Fatalf("first Claim() = %v, %v; want true", first, err)
+	}
+	if again, _ := s.Claim(ctx, "seen", "m1", time.Hour); again {
+		t.Error("second Claim() = true, want false")
+	}
+	if other, _ := s.Claim(ctx, "seen", "m2", time.Hour); !other {
+		t.Error("Claim(other key) = false, want true")
+	}
+	if _, err := s.Get(ctx, "seen", "m1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(claimed key) error = %v, claims should not be values", err)
+	}
+
+	if ok, err := s.Lease(ctx, "leader", "whatsapp", "a", time.Hour); !ok || err != nil {
+		t.Fatalf("Lease(a) = %v, %v", ok, err)
+	}
+	if ok, _ := s.Lease(ctx, "leader", "whatsapp", "b", time.Hour); ok {
+		t.Error("Lease(b) = true while a holds it")
+	}
+	if ok, _ := s.Lease(ctx, "leader", "whatsapp", "a", time.Hour); !ok {
+		t.Error("renewing Lease(a) = false")
+	}
+	s.Release(ctx, "leader", "whatsapp", "b") // Not b's to release
+	if ok, _ := s.Lease(ctx, "leader", "whatsapp", "b", time.Hour); ok {
+		t.Error("Release by a non-holder ended the lease")
+	}
+	if err := s.Release(ctx, "leader", "whatsapp", "a"); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if ok, _ := s.Lease(ctx, "leader", "whatsapp", "b", time.Hour); !ok {
+		t.Error("Lease(b) = false after a released it")
+	}
+}
+
+func TestClaimExpires(t *testing.T) {
+	now := time.Now()
+	clock := func() time.Time { return now }
+
+	mem := NewMemoryStore()
+	mem.now = clock
+	sq, err := OpenSQLite(filepath.Join(t.TempDir(), "state.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sq.Close()
+	sq.now = clock
+	bo, err := OpenBolt(filepath.Join(t.TempDir(), "state.bolt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bo.Close()
+	bo.now = clock
+
+	ctx := context.Background()
+	for name, s := range map[string]Store{"memory": mem, "sqlite": sq, "bolt": bo} {
+		if ok, _ := s.Claim(ctx, "seen", name, time.Minute); !ok {
+			t.Errorf("%s: first Claim() = false", name)
+		}
+	}
+	now = now.Add(2 * time.Minute)
+	for name, s := range map[string]Store{"memory": mem, "sqlite": sq, "bolt": bo} {
+		if ok, _ := s.Claim(ctx, "seen", name, time.Minute); !ok {
+			t.Errorf("%s: Claim() after expiry = false, want true", name)
+		}
+	}
+}
+
+func TestLeaseExpires(t *testing.T) {
+	now := time.Now()
+	clock := func() time.Time { return now }
+
+	mem := NewMemoryStore()
+	mem.now = clock
+	sq, err := OpenSQLite(filepath.Join(t.TempDir(), "state.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sq.Close()
+	sq.now = clock
+	bo, err := OpenBolt(filepath.Join(t.TempDir(), "state.bolt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bo.Close()
+	bo.now = clock
+
+	ctx := context.Background()
+	stores := map[string]Store{"memory": mem, "sqlite": sq, "bolt": bo}
+	for name, s := range stores {
+		if ok, _ := s.Lease(ctx, "leader", "telegram", "a", time.Minute); !ok {
+			t.Errorf("%s: Lease(a) = false", name)
+		}
+	}
+	now = now.Add(2 * time.Minute)
+	for name, s := range stores {
+		if ok, _ := s.Lease(ctx, "leader", "telegram", "b", time.Minute); !ok {
+			t.Errorf("%s: Lease(b) after expiry = false, want true", name)
+		}
+		if ok, _ := s.Lease(ctx, "leader", "telegram", "a", time.Minute); ok {
+			t.Errorf("%s: Lease(a) = true after b took over", name)
+		}
+	}
+}
+
+func TestOpenUnknownBackend(t *testing.T) {
+	if _, err := Open(Options{Backend: "etcd"}); err == nil {
+		t.Error("Open(etcd) should fail")
+	}
+}
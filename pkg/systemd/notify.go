@@ -0,0 +1,105 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+// Package systemd speaks the sd_notify protocol, so the gateway can run as
+// a Type=notify service supervised by the systemd watchdog.
+package systemd
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// statusInterval is how often the status line is refreshed when the
+// watchdog is off.
+const statusInterval = 30 * time.Second
+
+// Notify sends state, newline-separated assignments such as "READY=1", to
+// the service manager. It reports false without error when the process is
+// not running under systemd.
+func Notify(state string) (bool, error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return false, nil
+	}
+	addr := &net.UnixAddr{Name: socket, Net: "unixgram"}
+	if strings.HasPrefix(socket, "@") {
+		addr.Name = "\x00" + socket[1:] // Abstract socket
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, addr)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// WatchdogInterval returns how often systemd expects a watchdog ping, or 0
+// when the watchdog is off for this process.
+func WatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// Run reports the service ready and then, until ctx is cancelled, pings
+// the watchdog at half its interval and keeps the status line current.
+// status is called for every update and must return a single line, e.g.
+// "whatsapp: connected, telegram: reconnecting". alive is asked before
+// each ping, which is left out while it reports false, so systemd
+// restarts a gateway that stopped making progress; nil counts as alive.
+// Run returns at once when the process is not running under systemd.
+func Run(ctx context.Context, status func() string, alive func() bool) error {
+	last := status()
+	if ok, err := Notify("READY=1\nSTATUS=" + last); !ok {
+		return err
+	}
+
+	interval := statusInterval
+	watchdog := WatchdogInterval()
+	if watchdog > 0 {
+		interval = watchdog / 2
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			var msg []string
+			if watchdog > 0 && (alive == nil || alive()) {
+				msg = append(msg, "WATCHDOG=1")
+			}
+			if s := status(); s != last {
+				msg = append(msg, "STATUS="+s)
+				last = s
+			}
+			if len(msg) > 0 {
+				Notify(strings.Join(msg, "\n"))
+			}
+		}
+	}
+}
+
+// Stopping tells systemd the service is shutting down.
+func Stopping() {
+	Notify("STOPPING=1\nSTATUS=Shutting down")
+}
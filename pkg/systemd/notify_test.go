@@ -0,0 +1,142 @@
+package systemd
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func listen(t *testing.T) *net.UnixConn {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Skipf("unixgram sockets unavailable: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	t.Setenv("NOTIFY_SOCKET", path)
+	return conn
+}
+
+func receive(t *testing.T, conn *net.UnixConn) string {
+	t.Helper()
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	return string(buf[:n])
+}
+
+func TestNotifyWithoutSystemd(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	if ok, err := Notify("READY=1"); ok || err != nil {
+		t.Errorf("Notify() = %v, %v; want false, nil", ok, err)
+	}
+	if err := Run(context.Background(), func() string { return "" }, nil); err != nil {
+		t.Errorf("Run() error = %v", err)
+	}
+}
+
+func TestNotify(t *testing.T) {
+	conn := listen(t)
+	if ok, err := Notify("READY=1"); !ok || err != nil {
+		t.Fatalf("Notify() = %v, %v", ok, err)
+	}
+	if got := receive(t, conn); got != "READY=1" {
+		t.Errorf("received %q", got)
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	tests := []struct {
+		usec, pid string
+		want      time.Duration
+	}{
+		{"", "", 0},
+		{"garbage", "", 0},
+		{"2000000", "", 2 * time.Second},
+		{"2000000", strconv.Itoa(os.Getpid()), 2 * time.Second},
+		{"2000000", "1", 0},
+	}
+	for _, tt := range tests {
+		t.Setenv("WATCHDOG_USEC", tt.usec)
+		t.Setenv("WATCHDOG_PID", tt.pid)
+		if got := WatchdogInterval(); got != tt.want {
+			t.Errorf("WatchdogInterval() with usec=%q pid=%q = %v, want %v", tt.usec, tt.pid, got, tt.want)
+		}
+	}
+}
+
+func TestRunPingsWatchdog(t *testing.T) {
+	conn := listen(t)
+	t.Setenv("WATCHDOG_USEC", "100000")
+	t.Setenv("WATCHDOG_PID", "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	status := make(chan string, 1)
+	status <- "telegram: connected"
+	current := "telegram: connected"
+	go Run(ctx, func() string {
+		select {
+		case s := <-status:
+			current = s
+		default:
+		}
+		return current
+	}, nil)
+
+	if got := receive(t, conn); got != "READY=1\nSTATUS=telegram: connected" {
+		t.Errorf("first notification = %q", got)
+	}
+	if got := receive(t, conn); got != "WATCHDOG=1" {
+		t.Errorf("ping = %q, want WATCHDOG=1 alone while the status is unchanged", got)
+	}
+	status <- "telegram: reconnecting"
+	for i := 0; i < 5; i++ {
+		if got := receive(t, conn); strings.Contains(got, "STATUS=") {
+			if got != "WATCHDOG=1\nSTATUS=telegram: reconnecting" {
+				t.Errorf("status update = %q", got)
+			}
+			return
+		}
+	}
+	t.Error("status change was not reported")
+}
+
+func TestRunWithholdsPingWhileStalled(t *testing.T) {
+	conn := listen(t)
+	t.Setenv("WATCHDOG_USEC", "100000")
+	t.Setenv("WATCHDOG_PID", "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var alive atomic.Bool
+	var ticks atomic.Int32
+	go Run(ctx, func() string {
+		// A new status every tick, so every tick sends something
+		return strconv.Itoa(int(ticks.Add(1)))
+	}, alive.Load)
+
+	receive(t, conn) // READY=1
+	for i := 0; i < 3; i++ {
+		if got := receive(t, conn); strings.Contains(got, "WATCHDOG=1") {
+			t.Fatalf("notification while stalled = %q, want no ping", got)
+		}
+	}
+	alive.Store(true)
+	for i := 0; i < 3; i++ {
+		if got := receive(t, conn); strings.HasPrefix(got, "WATCHDOG=1\n") {
+			return
+		}
+	}
+	t.Error("no ping once alive again")
+}
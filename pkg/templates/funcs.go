@@ -0,0 +1,299 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+package templates
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// funcs are the helpers available to every template. Helpers that take an
+// option put the value last, so they work in pipelines:
+// {{.title | truncate 40}}, {{.when | date "Jan 2 15:04"}}.
+var funcs = template.FuncMap{
+	"upper":    strings.ToUpper,
+	"lower":    strings.ToLower,
+	"title":    title,
+	"trim":     strings.TrimSpace,
+	"truncate": truncate,
+	"default":  defaultValue,
+	"join":     join,
+	"bullets":  bullets,
+	"bold":     func(s interface{}) string { return "**" + fmt.Sprint(s) + "**" },
+	"code":     func(s interface{}) string { return "`" + fmt.Sprint(s) + "`" },
+	"now":      time.Now,
+	"date":     date,
+	"ago":      ago,
+	"duration": duration,
+	"number":   number,
+	"round":    round,
+	"percent":  percent,
+	"bytes":    bytesize,
+	"plural":   plural,
+	"json":     toJSON,
+}
+
+// title upper-cases the first letter of every word.
+func title(s string) string {
+	runes := []rune(s)
+	for i, r := range runes {
+		if i == 0 || unicode.IsSpace(runes[i-1]) {
+			runes[i] = unicode.ToUpper(r)
+		}
+	}
+	return string(runes)
+}
+
+// truncate shortens s to at most n characters, ending in "…" when cut.
+func truncate(n int, s string) string {
+	if n <= 0 || utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	return strings.TrimRightFunc(string(runes[:n-1]), unicode.IsSpace) + "…"
+}
+
+// defaultValue returns def when v is missing, empty, or zero.
+func defaultValue(def, v interface{}) interface{} {
+	if v == nil {
+		return def
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Map, reflect.String, reflect.Array:
+		if rv.Len() == 0 {
+			return def
+		}
+	default:
+		if rv.IsZero() {
+			return def
+		}
+	}
+	return v
+}
+
+// items converts a list of any element type to strings.
+func items(list interface{}) []string {
+	rv := reflect.ValueOf(list)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		if list == nil {
+			return nil
+		}
+		return []string{fmt.Sprint(list)}
+	}
+	out := make([]string, rv.Len())
+	for i := range out {
+		out[i] = fmt.Sprint(rv.Index(i).Interface())
+	}
+	return out
+}
+
+func join(sep string, list interface{}) string {
+	return strings.Join(items(list), sep)
+}
+
+// bullets renders a list as Markdown bullet points.
+func bullets(list interface{}) string {
+	lines := items(list)
+	for i, line := range lines {
+		lines[i] = "- " + line
+	}
+	return strings.Join(lines, "\n")
+}
+
+// toTime accepts a time.Time, an RFC 3339 string, or Unix seconds.
+func toTime(v interface{}) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, nil
+	case string:
+		parsed, err := time.Parse(time.RFC3339, t)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("not a time: %q", t)
+		}
+		return parsed, nil
+	default:
+		secs, err := toFloat(v)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return time.Unix(int64(secs), 0), nil
+	}
+}
+
+// toFloat accepts any number, a json.Number, or a numeric string.
+func toFloat(v interface{}) (float64, error) {
+	switch n := v.(type) {
+	case json.Number:
+		return n.Float64()
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		if err != nil {
+			return 0, fmt.Errorf("not a number: %q", n)
+		}
+		return f, nil
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	}
+	return 0, fmt.Errorf("not a number: %v", v)
+}
+
+// date formats a time with a Go layout, e.g. "2006-01-02 15:04".
+func date(layout string, v interface{}) (string, error) {
+	t, err := toTime(v)
+	if err != nil {
+		return "", err
+	}
+	return t.Format(layout), nil
+}
+
+// ago describes how long ago a time was, e.g. "3h ago".
+func ago(v interface{}) (string, error) {
+	t, err := toTime(v)
+	if err != nil {
+		return "", err
+	}
+	d := time.Since(t)
+	if d < time.Minute {
+		return "just now", nil
+	}
+	return shortDuration(d) + " ago", nil
+}
+
+// duration formats seconds, or a time.Duration, as e.g. "1h 5m".
+func duration(v interface{}) (string, error) {
+	if d, ok := v.(time.Duration); ok {
+		return shortDuration(d), nil
+	}
+	secs, err := toFloat(v)
+	if err != nil {
+		return "", err
+	}
+	return shortDuration(time.Duration(secs * float64(time.Second))), nil
+}
+
+// shortDuration keeps the two largest units of d.
+func shortDuration(d time.Duration) string {
+	if d < 0 {
+		d = -d
+	}
+	units := []struct {
+		size time.Duration
+		name string
+	}{{24 * time.Hour, "d"}, {time.Hour, "h"}, {time.Minute, "m"}, {time.Second, "s"}}
+	var parts []string
+	for _, u := range units {
+		if n := d / u.size; n > 0 {
+			parts = append(parts, fmt.Sprintf("%d%s", n, u.name))
+			d -= n * u.size
+		}
+		if len(parts) == 2 {
+			break
+		}
+	}
+	if len(parts) == 0 {
+		return "0s"
+	}
+	return strings.Join(parts, " ")
+}
+
+// number formats with thousands separators and at most two decimals,
+// e.g. 1234567.891 as "1,234,567.89".
+func number(v interface{}) (string, error) {
+	f, err := toFloat(v)
+	if err != nil {
+		return "", err
+	}
+	s := strconv.FormatFloat(math.Round(f*100)/100, 'f', -1, 64)
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	whole, frac, _ := strings.Cut(s, ".")
+	var sb strings.Builder
+	for i, r := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteRune(r)
+	}
+	if frac != "" {
+		return sign + sb.String() + "." + frac, nil
+	}
+	return sign + sb.String(), nil
+}
+
+// round formats a number with a fixed number of decimals.
+func round(places int, v interface{}) (string, error) {
+	f, err := toFloat(v)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatFloat(f, 'f', places, 64), nil
+}
+
+// percent formats a fraction, e.g. 0.257 as "25.7%".
+func percent(v interface{}) (string, error) {
+	f, err := toFloat(v)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatFloat(math.Round(f*1000)/10, 'f', -1, 64) + "%", nil
+}
+
+// bytesize formats a byte count, e.g. 1536 as "1.5 KB".
+func bytesize(v interface{}) (string, error) {
+	f, err := toFloat(v)
+	if err != nil {
+		return "", err
+	}
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	i := 0
+	for math.Abs(f) >= 1024 && i < len(units)-1 {
+		f /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d B", int64(f)), nil
+	}
+	return strconv.FormatFloat(math.Round(f*10)/10, 'f', -1, 64) + " " + units[i], nil
+}
+
+// plural picks one or many by count, e.g. {{plural .n "alert" "alerts"}}.
+func plural(n interface{}, one, many string) (string, error) {
+	f, err := toFloat(n)
+	if err != nil {
+		return "", err
+	}
+	if f == 1 {
+		return one, nil
+	}
+	return many, nil
+}
+
+func toJSON(v interface{}) (string, error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,106 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+// Package templates renders named outbound message templates, so scheduled
+// reports and alerts look the same every time and on every channel.
+// Templates are Go text/template source producing Markdown, which channels
+// convert to their own formatting.
+package templates
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// Ext is the file extension of templates kept in a directory.
+const Ext = ".tmpl"
+
+// Engine holds the parsed templates.
+type Engine struct {
+	templates map[string]*template.Template
+}
+
+// Load parses the templates in dir, one per "<name>.tmpl" file, and then
+// defs, which maps names to template source and takes precedence. A
+// missing dir is not an error.
+func Load(defs map[string]string, dir string) (*Engine, error) {
+	e := &Engine{templates: make(map[string]*template.Template)}
+
+	if dir != "" {
+		entries, err := os.ReadDir(dir)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read templates: %w", err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || filepath.Ext(entry.Name()) != Ext {
+				continue
+			}
+			data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read template %s: %w", entry.Name(), err)
+			}
+			if err := e.Add(strings.TrimSuffix(entry.Name(), Ext), string(data)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for name, text := range defs {
+		if err := e.Add(name, text); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// Add parses text as template name, replacing any template of that name.
+func (e *Engine) Add(name, text string) error {
+	tmpl, err := template.New(name).Funcs(funcs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return fmt.Errorf("invalid template %s: %w", name, err)
+	}
+	e.templates[name] = tmpl
+	return nil
+}
+
+// Names returns the template names, sorted.
+func (e *Engine) Names() []string {
+	names := make([]string, 0, len(e.templates))
+	for name := range e.templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Has reports whether a template is defined.
+func (e *Engine) Has(name string) bool {
+	_, ok := e.templates[name]
+	return ok
+}
+
+// Render executes template name with data. Referring to a key data does
+// not have is an error; use the default helper for optional values.
+// Leading and trailing whitespace is trimmed, so template files may end
+// with a newline.
+func (e *Engine) Render(name string, data map[string]interface{}) (string, error) {
+	tmpl, ok := e.templates[name]
+	if !ok {
+		return "", fmt.Errorf("unknown template %q", name)
+	}
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("rendering template %s: %w", name, err)
+	}
+	return strings.TrimSpace(sb.String()), nil
+}
@@ -0,0 +1,115 @@
+package templates
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "alert.tmpl"), []byte("Alert: {{.name}}\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "report.tmpl"), []byte("file report"), 0644)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("{{ broken"), 0644)
+
+	e, err := Load(map[string]string{"report": "config report"}, dir)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got := strings.Join(e.Names(), ","); got != "alert,report" {
+		t.Errorf("Names() = %q", got)
+	}
+	if got, _ := e.Render("alert", map[string]interface{}{"name": "disk"}); got != "Alert: disk" {
+		t.Errorf("alert = %q", got)
+	}
+	if got, _ := e.Render("report", nil); got != "config report" {
+		t.Errorf("report = %q, want the config definition to win", got)
+	}
+
+	if _, err := Load(nil, filepath.Join(dir, "missing")); err != nil {
+		t.Errorf("Load() with missing dir error = %v", err)
+	}
+	if _, err := Load(map[string]string{"bad": "{{ .x"}, ""); err == nil {
+		t.Error("Load() accepted an invalid template")
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	e, _ := Load(map[string]string{"t": "{{.missing}}", "n": "{{number .v}}"}, "")
+	if _, err := e.Render("nope", nil); err == nil {
+		t.Error("Render() of unknown template succeeded")
+	}
+	if _, err := e.Render("t", map[string]interface{}{}); err == nil {
+		t.Error("Render() with missing key succeeded")
+	}
+	if _, err := e.Render("n", map[string]interface{}{"v": "abc"}); err == nil {
+		t.Error("Render() with non-number succeeded")
+	}
+}
+
+func TestHelpers(t *testing.T) {
+	when := time.Date(2026, 3, 1, 9, 30, 0, 0, time.UTC)
+	data := map[string]interface{}{
+		"name":   "disk full on pi",
+		"items":  []interface{}{"a", 2, "c"},
+		"empty":  "",
+		"n":      1,
+		"many":   3.0,
+		"big":    1234567.891,
+		"neg":    -1234,
+		"ratio":  0.257,
+		"size":   1536,
+		"when":   when,
+		"stamp":  "2026-03-01T09:30:00Z",
+		"secs":   3725,
+		"nested": map[string]interface{}{"ok": true},
+	}
+	tests := []struct {
+		tmpl string
+		want string
+	}{
+		{"{{.name | upper}}", "DISK FULL ON PI"},
+		{"{{.name | title}}", "Disk Full On Pi"},
+		{"{{.name | truncate 8}}", "disk fu…"},
+		{"{{.name | truncate 40}}", "disk full on pi"},
+		{"{{.empty | default \"n/a\"}}", "n/a"},
+		{"{{.name | default \"n/a\"}}", "disk full on pi"},
+		{"{{.items | join \", \"}}", "a, 2, c"},
+		{"{{bullets .items}}", "- a\n- 2\n- c"},
+		{"{{bold .name}} {{code \"df -h\"}}", "**disk full on pi** `df -h`"},
+		{"{{.when | date \"2006-01-02 15:04\"}}", "2026-03-01 09:30"},
+		{"{{.stamp | date \"Jan 2\"}}", "Mar 1"},
+		{"{{duration .secs}}", "1h 2m"},
+		{"{{number .big}} {{number .neg}}", "1,234,567.89 -1,234"},
+		{"{{round 1 .big}}", "1234567.9"},
+		{"{{percent .ratio}}", "25.7%"},
+		{"{{bytes .size}}", "1.5 KB"},
+		{"{{.n}} {{plural .n \"alert\" \"alerts\"}}, {{plural .many \"item\" \"items\"}}", "1 alert, items"},
+		{"{{json .nested}}", "{\n  \"ok\": true\n}"},
+	}
+	for _, tt := range tests {
+		e, err := Load(map[string]string{"t": tt.tmpl}, "")
+		if err != nil {
+			t.Fatalf("Load(%q) error = %v", tt.tmpl, err)
+		}
+		got, err := e.Render("t", data)
+		if err != nil {
+			t.Errorf("Render(%q) error = %v", tt.tmpl, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Render(%q) = %q, want %q", tt.tmpl, got, tt.want)
+		}
+	}
+}
+
+func TestAgo(t *testing.T) {
+	if got, _ := ago(time.Now().Add(-90 * time.Minute)); got != "1h 30m ago" {
+		t.Errorf("ago = %q", got)
+	}
+	if got, _ := ago(time.Now()); got != "just now" {
+		t.Errorf("ago = %q", got)
+	}
+}
@@ -0,0 +1,114 @@
+package tools
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/i18n"
+)
+
+// DefaultApprovalTTL is how long a pending command approval stays valid.
+const DefaultApprovalTTL = 10 * time.Minute
+
+// PendingCommand is a shell command waiting for the user's confirmation.
+type PendingCommand struct {
+	ID         string
+	Command    string
+	WorkingDir string
+	Channel    string
+	ChatID     string
+	SenderID   string
+	Created    time.Time
+}
+
+// ApprovalNotifier delivers an approval prompt to the chat that triggered it.
+type ApprovalNotifier func(channel, chatID, content string) error
+
+// ApprovalStore tracks commands that need explicit confirmation before the
+// exec tool runs them. Approvals are bound to the originating chat and
+// sender, so a code cannot be approved from a different conversation, or
+// by another member of a group.
+type ApprovalStore struct {
+	mu       sync.Mutex
+	pending  map[string]*PendingCommand
+	ttl      time.Duration
+	notifier ApprovalNotifier
+}
+
+func NewApprovalStore(ttl time.Duration) *ApprovalStore {
+	if ttl <= 0 {
+		ttl = DefaultApprovalTTL
+	}
+	return &ApprovalStore{
+		pending: make(map[string]*PendingCommand),
+		ttl:     ttl,
+	}
+}
+
+// SetNotifier sets the callback used to ask the user for approval.
+func (s *ApprovalStore) SetNotifier(notifier ApprovalNotifier) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.notifier = notifier
+}
+
+// Request registers a command senderID asked for, for approval, and
+// notifies the chat. It returns the approval ID.
+func (s *ApprovalStore) Request(command, workingDir, channel, chatID, senderID string) (string, error) {
+	id := newApprovalID()
+
+	s.mu.Lock()
+	s.prune()
+	s.pending[id] = &PendingCommand{
+		ID:         id,
+		Command:    command,
+		WorkingDir: workingDir,
+		Channel:    channel,
+		ChatID:     chatID,
+		SenderID:   senderID,
+		Created:    time.Now(),
+	}
+	notifier := s.notifier
+	s.mu.Unlock()
+
+	if notifier != nil {
+		prompt := i18n.T(channel, chatID, "approval.prompt", command, id)
+		if err := notifier(channel, chatID, prompt); err != nil {
+			return id, err
+		}
+	}
+	return id, nil
+}
+
+// Take removes and returns the pending command with id if it was requested
+// by senderID from the same channel and chat and has not expired.
+func (s *ApprovalStore) Take(id, channel, chatID, senderID string) (*PendingCommand, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune()
+
+	p, ok := s.pending[id]
+	if !ok || p.Channel != channel || p.ChatID != chatID || p.SenderID != senderID {
+		return nil, false
+	}
+	delete(s.pending, id)
+	return p, true
+}
+
+// prune drops expired approvals. Callers must hold s.mu.
+func (s *ApprovalStore) prune() {
+	cutoff := time.Now().Add(-s.ttl)
+	for id, p := range s.pending {
+		if p.Created.Before(cutoff) {
+			delete(s.pending, id)
+		}
+	}
+}
+
+func newApprovalID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -17,6 +17,20 @@ type ContextualTool interface {
 	SetContext(channel, chatID string)
 }
 
+// SenderAwareTool is an optional interface for tools that act on behalf of
+// the user who sent the current message.
+type SenderAwareTool interface {
+	Tool
+	SetSender(channel, senderID string)
+}
+
+// MessageAwareTool is an optional interface for tools that act on the
+// inbound message being handled, such as reacting to it.
+type MessageAwareTool interface {
+	Tool
+	SetMessage(channel, chatID, messageID, senderID string)
+}
+
 // AsyncCallback is a function type that async tools use to notify completion.
 // When an async tool finishes its work, it calls this callback with the result.
 //
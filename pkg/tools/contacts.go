@@ -0,0 +1,85 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/contacts"
+)
+
+// ContactResolver finds contacts by name, as contacts.Directory does.
+type ContactResolver interface {
+	Resolve(ctx context.Context, query, channel string) ([]contacts.Contact, error)
+}
+
+// ContactsTool looks people up in the contact directory, so a request
+// like "message Alice" can be sent to the right chat.
+type ContactsTool struct {
+	resolver ContactResolver
+}
+
+func NewContactsTool(resolver ContactResolver) *ContactsTool {
+	return &ContactsTool{resolver: resolver}
+}
+
+func (t *ContactsTool) Name() string {
+	return "contacts"
+}
+
+func (t *ContactsTool) Description() string {
+	return "Look up a person by name, username, or ID in the contact directory. " +
+		"Use it when asked to message someone by name, then send with the message tool to the channel and chat_id found. " +
+		"If several people match, ask which one is meant."
+}
+
+func (t *ContactsTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"query": map[string]interface{}{
+				"type":        "string",
+				"description": "The person's name, @username, or user ID",
+			},
+			"channel": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional: only look on this channel (telegram, whatsapp, etc.)",
+			},
+		},
+		"required": []string{"query"},
+	}
+}
+
+func (t *ContactsTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	query, _ := args["query"].(string)
+	if strings.TrimSpace(query) == "" {
+		return ErrorResult("query is required")
+	}
+	channel, _ := args["channel"].(string)
+
+	found, err := t.resolver.Resolve(ctx, query, channel)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("looking up contacts: %v", err)).WithError(err)
+	}
+	if len(found) == 0 {
+		return SilentResult(fmt.Sprintf("No contact matches %q", query))
+	}
+
+	var sb strings.Builder
+	for _, c := range found {
+		name := c.Name
+		if name == "" {
+			name = c.ID
+		}
+		fmt.Fprintf(&sb, "- %s", name)
+		if c.Username != "" {
+			fmt.Fprintf(&sb, " (@%s)", c.Username)
+		}
+		if c.ChatID != "" {
+			fmt.Fprintf(&sb, ": channel %s, chat_id %s\n", c.Channel, c.ChatID)
+		} else {
+			fmt.Fprintf(&sb, ": on %s, user %s, no direct chat known\n", c.Channel, c.ID)
+		}
+	}
+	return SilentResult(sb.String())
+}
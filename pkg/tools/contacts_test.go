@@ -0,0 +1,35 @@
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/contacts"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+func TestContactsTool(t *testing.T) {
+	dir := contacts.New(state.NewMemoryStore(), contacts.Policy{})
+	ctx := context.Background()
+	dir.Update(ctx, contacts.Contact{Channel: "telegram", ID: "7", Name: "Alice", Username: "ally", ChatID: "7"})
+	dir.Update(ctx, contacts.Contact{Channel: "discord", ID: "5", Name: "Alice B"})
+	tool := NewContactsTool(dir)
+
+	tests := []struct {
+		args    map[string]interface{}
+		want    string
+		wantErr bool
+	}{
+		{map[string]interface{}{"query": "alice"}, "Alice (@ally): channel telegram, chat_id 7", false},
+		{map[string]interface{}{"query": "alice b"}, "on discord, user 5, no direct chat known", false},
+		{map[string]interface{}{"query": "zed"}, `No contact matches "zed"`, false},
+		{map[string]interface{}{"query": ""}, "query is required", true},
+	}
+	for _, tt := range tests {
+		result := tool.Execute(ctx, tt.args)
+		if result.IsError != tt.wantErr || !strings.Contains(result.ForLLM, tt.want) {
+			t.Errorf("Execute(%v) = %q (error %v), want %q", tt.args, result.ForLLM, result.IsError, tt.want)
+		}
+	}
+}
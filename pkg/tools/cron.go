@@ -11,9 +11,11 @@ import (
 	"github.com/sipeed/picoclaw/pkg/utils"
 )
 
-// JobExecutor is the interface for executing cron jobs through the agent
+// JobExecutor is the interface for executing cron jobs through the agent.
+// ProcessScheduled runs content as a user turn and delivers the answer to
+// channel/chatID.
 type JobExecutor interface {
-	ProcessDirectWithChannel(ctx context.Context, content, sessionKey, channel, chatID string) (string, error)
+	ProcessScheduled(ctx context.Context, content, sessionKey, channel, chatID string) (string, error)
 }
 
 // CronTool provides scheduling capabilities for the agent
@@ -44,7 +46,7 @@ func (t *CronTool) Name() string {
 
 // Description returns the tool description
 func (t *CronTool) Description() string {
-	return "Schedule reminders, tasks, or system commands. IMPORTANT: When user asks to be reminded or scheduled, you MUST call this tool. Use 'at_seconds' for one-time reminders (e.g., 'remind me in 10 minutes' → at_seconds=600). Use 'every_seconds' ONLY for recurring tasks (e.g., 'every 2 hours' → every_seconds=7200). Use 'cron_expr' for complex recurring schedules. Use 'command' to execute shell commands directly."
+	return "Schedule reminders, tasks, or system commands. IMPORTANT: When user asks to be reminded or scheduled, you MUST call this tool. Use 'at_seconds' for one-time reminders (e.g., 'remind me in 10 minutes' → at_seconds=600). Use 'at_time' for a one-time reminder at a clock time (e.g., 'remind me tomorrow at 9' → at_time='2026-03-02 09:00'). Use 'every_seconds' ONLY for recurring tasks (e.g., 'every 2 hours' → every_seconds=7200). Use 'cron_expr' for complex recurring schedules. Use 'command' to execute shell commands directly."
 }
 
 // Parameters returns the tool parameters schema
@@ -69,6 +71,10 @@ func (t *CronTool) Parameters() map[string]interface{} {
 				"type":        "integer",
 				"description": "One-time reminder: seconds from now when to trigger (e.g., 600 for 10 minutes later). Use this for one-time reminders like 'remind me in 10 minutes'.",
 			},
+			"at_time": map[string]interface{}{
+				"type":        "string",
+				"description": "One-time reminder at an absolute local time, formatted 'YYYY-MM-DD HH:MM' or RFC3339 (e.g., '2026-03-02 09:00'). Use this for 'tomorrow at 9' or 'on Friday at 14:30'.",
+			},
 			"every_seconds": map[string]interface{}{
 				"type":        "integer",
 				"description": "Recurring interval in seconds (e.g., 3600 for every hour). Use this ONLY for recurring tasks like 'every 2 hours' or 'daily reminder'.",
@@ -77,6 +83,10 @@ func (t *CronTool) Parameters() map[string]interface{} {
 				"type":        "string",
 				"description": "Cron expression for complex recurring schedules (e.g., '0 9 * * *' for daily at 9am). Use this for complex recurring schedules.",
 			},
+			"tz": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional IANA time zone for cron_expr and at_time (e.g., 'Europe/Berlin'). Defaults to the server's local zone.",
+			},
 			"job_id": map[string]interface{}{
 				"type":        "string",
 				"description": "Job ID (for remove/enable/disable)",
@@ -138,18 +148,34 @@ func (t *CronTool) addJob(args map[string]interface{}) *ToolResult {
 
 	var schedule cron.CronSchedule
 
-	// Check for at_seconds (one-time), every_seconds (recurring), or cron_expr
+	// Check for at_seconds/at_time (one-time), every_seconds (recurring), or cron_expr
 	atSeconds, hasAt := args["at_seconds"].(float64)
+	atTime, hasAtTime := args["at_time"].(string)
 	everySeconds, hasEvery := args["every_seconds"].(float64)
 	cronExpr, hasCron := args["cron_expr"].(string)
+	tz, _ := args["tz"].(string)
 
-	// Priority: at_seconds > every_seconds > cron_expr
+	// Priority: at_seconds > at_time > every_seconds > cron_expr
 	if hasAt {
 		atMS := time.Now().UnixMilli() + int64(atSeconds)*1000
 		schedule = cron.CronSchedule{
 			Kind: "at",
 			AtMS: &atMS,
 		}
+	} else if hasAtTime && atTime != "" {
+		at, err := parseAtTime(atTime, tz)
+		if err != nil {
+			return ErrorResult(err.Error())
+		}
+		if !at.After(time.Now()) {
+			return ErrorResult(fmt.Sprintf("at_time %s is in the past", atTime))
+		}
+		atMS := at.UnixMilli()
+		schedule = cron.CronSchedule{
+			Kind: "at",
+			AtMS: &atMS,
+			TZ:   tz,
+		}
 	} else if hasEvery {
 		everyMS := int64(everySeconds) * 1000
 		schedule = cron.CronSchedule{
@@ -157,12 +183,18 @@ func (t *CronTool) addJob(args map[string]interface{}) *ToolResult {
 			EveryMS: &everyMS,
 		}
 	} else if hasCron {
+		if tz != "" {
+			if _, err := time.LoadLocation(tz); err != nil {
+				return ErrorResult(fmt.Sprintf("unknown time zone: %s", tz))
+			}
+		}
 		schedule = cron.CronSchedule{
 			Kind: "cron",
 			Expr: cronExpr,
+			TZ:   tz,
 		}
 	} else {
-		return ErrorResult("one of at_seconds, every_seconds, or cron_expr is required")
+		return ErrorResult("one of at_seconds, at_time, every_seconds, or cron_expr is required")
 	}
 
 	// Read deliver parameter, default to true
@@ -204,6 +236,30 @@ func (t *CronTool) addJob(args map[string]interface{}) *ToolResult {
 	return SilentResult(fmt.Sprintf("Cron job added: %s (id: %s)", job.Name, job.ID))
 }
 
+// parseAtTime parses an absolute reminder time, either RFC3339 or
+// "YYYY-MM-DD HH:MM" in tz (the local zone when empty).
+func parseAtTime(value, tz string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	loc := time.Local
+	if tz != "" {
+		l, err := time.LoadLocation(tz)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("unknown time zone: %s", tz)
+		}
+		loc = l
+	}
+
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02T15:04:05"} {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid at_time %q: use 'YYYY-MM-DD HH:MM' or RFC3339", value)
+}
+
 func (t *CronTool) listJobs() *ToolResult {
 	jobs := t.cronService.ListJobs(false)
 
@@ -218,8 +274,8 @@ func (t *CronTool) listJobs() *ToolResult {
 			scheduleInfo = fmt.Sprintf("every %ds", *j.Schedule.EveryMS/1000)
 		} else if j.Schedule.Kind == "cron" {
 			scheduleInfo = j.Schedule.Expr
-		} else if j.Schedule.Kind == "at" {
-			scheduleInfo = "one-time"
+		} else if j.Schedule.Kind == "at" && j.Schedule.AtMS != nil {
+			scheduleInfo = "once at " + time.UnixMilli(*j.Schedule.AtMS).Format("2006-01-02 15:04")
 		} else {
 			scheduleInfo = "unknown"
 		}
@@ -234,6 +290,9 @@ func (t *CronTool) removeJob(args map[string]interface{}) *ToolResult {
 	if !ok || jobID == "" {
 		return ErrorResult("job_id is required for remove")
 	}
+	if cron.IsConfigJob(jobID) {
+		return ErrorResult(fmt.Sprintf("Job %s is defined in the config file; remove it there", jobID))
+	}
 
 	if t.cronService.RemoveJob(jobID) {
 		return SilentResult(fmt.Sprintf("Cron job removed: %s", jobID))
@@ -309,7 +368,7 @@ func (t *CronTool) ExecuteJob(ctx context.Context, job *cron.CronJob) string {
 	sessionKey := fmt.Sprintf("cron-%s", job.ID)
 
 	// Call agent with job's message
-	response, err := t.executor.ProcessDirectWithChannel(
+	response, err := t.executor.ProcessScheduled(
 		ctx,
 		job.Payload.Message,
 		sessionKey,
@@ -321,7 +380,6 @@ func (t *CronTool) ExecuteJob(ctx context.Context, job *cron.CronJob) string {
 		return fmt.Sprintf("Error: %v", err)
 	}
 
-	// Response is automatically sent via MessageBus by AgentLoop
-	_ = response // Will be sent by AgentLoop
+	_ = response // Already published to the chat by the executor
 	return "ok"
 }
@@ -0,0 +1,36 @@
+package tools
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseAtTime(t *testing.T) {
+	tokyo, _ := time.LoadLocation("Asia/Tokyo")
+
+	tests := []struct {
+		name    string
+		value   string
+		tz      string
+		want    time.Time
+		wantErr bool
+	}{
+		{"local clock time", "2026-03-02 09:00", "", time.Date(2026, 3, 2, 9, 0, 0, 0, time.Local), false},
+		{"with zone", "2026-03-02 09:00", "Asia/Tokyo", time.Date(2026, 3, 2, 9, 0, 0, 0, tokyo), false},
+		{"rfc3339", "2026-03-02T09:00:00Z", "", time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC), false},
+		{"bad zone", "2026-03-02 09:00", "Mars/Olympus", time.Time{}, true},
+		{"garbage", "tomorrow at 9", "", time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseAtTime(tt.value, tt.tz)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseAtTime() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !got.Equal(tt.want) {
+				t.Errorf("parseAtTime() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,428 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/commands"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// emailDraftTTL is how long a draft waits for /send before it is dropped.
+const emailDraftTTL = 30 * time.Minute
+
+// emailSendTimeout bounds a whole SMTP exchange, so a server that stops
+// answering cannot hang the /send command.
+const emailSendTimeout = 60 * time.Second
+
+// EmailToolOptions configures the SMTP account mail is sent from.
+type EmailToolOptions struct {
+	Host     string
+	Port     int // 465 uses implicit TLS, anything else STARTTLS when offered
+	Username string
+	Password string
+	From     string
+	Contacts map[string]string // Name -> address
+}
+
+// EmailDraft is an email waiting for the user's confirmation.
+type EmailDraft struct {
+	ID       string
+	To       []string
+	Cc       []string
+	Subject  string
+	Body     string
+	Channel  string
+	ChatID   string
+	SenderID string
+	Created  time.Time
+}
+
+// mailSender matches smtp.SendMail, plus a context, so tests can capture
+// mail.
+type mailSender func(ctx context.Context, addr string, auth smtp.Auth, from string, to []string, msg []byte) error
+
+// EmailTool drafts emails. The model can only draft: the preview goes
+// straight to the chat, and nothing is sent until the user who asked for
+// the draft replies /send <id> from that chat.
+type EmailTool struct {
+	opts     EmailToolOptions
+	contacts map[string]string // lowercased name -> address
+	send     SendCallback
+	sendMail mailSender
+	now      func() time.Time
+
+	mu       sync.Mutex
+	drafts   map[string]*EmailDraft
+	channel  string
+	chatID   string
+	senderID string
+}
+
+func NewEmailTool(opts EmailToolOptions) *EmailTool {
+	if opts.Port == 0 {
+		opts.Port = 587
+	}
+	if opts.From == "" {
+		opts.From = opts.Username
+	}
+	contacts := make(map[string]string, len(opts.Contacts))
+	for name, addr := range opts.Contacts {
+		contacts[strings.ToLower(strings.TrimSpace(name))] = addr
+	}
+	t := &EmailTool{
+		opts:     opts,
+		contacts: contacts,
+		now:      time.Now,
+		drafts:   make(map[string]*EmailDraft),
+	}
+	t.sendMail = t.dialAndSend
+	return t
+}
+
+func (t *EmailTool) Name() string {
+	return "email"
+}
+
+func (t *EmailTool) Description() string {
+	return "Draft an email for the user to review. The draft is shown in the chat and only sent when the user confirms it with /send, so never claim an email was sent. Recipients may be email addresses or names of saved contacts."
+}
+
+func (t *EmailTool) Parameters() map[string]interface{} {
+	names := make([]string, 0, len(t.contacts))
+	for name := range t.contacts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	toDesc := "Recipient addresses or contact names, comma-separated"
+	if len(names) > 0 {
+		toDesc += ". Saved contacts: " + strings.Join(names, ", ")
+	}
+
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"to": map[string]interface{}{
+				"type":        "string",
+				"description": toDesc,
+			},
+			"cc": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional CC recipients, comma-separated",
+			},
+			"subject": map[string]interface{}{
+				"type":        "string",
+				"description": "Subject line",
+			},
+			"body": map[string]interface{}{
+				"type":        "string",
+				"description": "Plain-text body, written on the user's behalf and signed with their name if known",
+			},
+		},
+		"required": []string{"to", "subject", "body"},
+	}
+}
+
+func (t *EmailTool) SetContext(channel, chatID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.channel = channel
+	t.chatID = chatID
+}
+
+// SetSender implements SenderAwareTool so only the sender who asked for a
+// draft can send or discard it.
+func (t *EmailTool) SetSender(channel, senderID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.senderID = senderID
+}
+
+// SetSendCallback sets how draft previews reach the chat.
+func (t *EmailTool) SetSendCallback(callback SendCallback) {
+	t.send = callback
+}
+
+func (t *EmailTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	toArg, _ := args["to"].(string)
+	ccArg, _ := args["cc"].(string)
+	subject, _ := args["subject"].(string)
+	body, _ := args["body"].(string)
+
+	to, err := t.resolveRecipients(toArg)
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+	if len(to) == 0 {
+		return ErrorResult("at least one recipient is required")
+	}
+	cc, err := t.resolveRecipients(ccArg)
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+	subject = strings.TrimSpace(subject)
+	if subject == "" || strings.ContainsAny(subject, "\r\n") {
+		return ErrorResult("subject is required and must be a single line")
+	}
+	if strings.TrimSpace(body) == "" {
+		return ErrorResult("body is required")
+	}
+
+	t.mu.Lock()
+	channel, chatID, senderID := t.channel, t.chatID, t.senderID
+	t.mu.Unlock()
+	if channel == "" || chatID == "" || t.send == nil {
+		return ErrorResult("emails can only be drafted from a chat")
+	}
+
+	draft := &EmailDraft{
+		ID:       newApprovalID(),
+		To:       to,
+		Cc:       cc,
+		Subject:  subject,
+		Body:     body,
+		Channel:  channel,
+		ChatID:   chatID,
+		SenderID: senderID,
+		Created:  t.now(),
+	}
+	t.mu.Lock()
+	t.prune()
+	t.drafts[draft.ID] = draft
+	t.mu.Unlock()
+
+	if err := t.send(channel, chatID, formatDraft(draft)); err != nil {
+		return ErrorResult(fmt.Sprintf("failed to show draft: %v", err)).WithError(err)
+	}
+	return SilentResult(fmt.Sprintf("Draft %s was shown to the user. It is sent only if they reply /send %s; it has NOT been sent yet.", draft.ID, draft.ID))
+}
+
+// resolveRecipients turns a comma-separated list of addresses and contact
+// names into addresses.
+func (t *EmailTool) resolveRecipients(list string) ([]string, error) {
+	var out []string
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if addr, ok := t.contacts[strings.ToLower(item)]; ok {
+			item = addr
+		}
+		parsed, err := mail.ParseAddress(item)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an email address or a saved contact", item)
+		}
+		out = append(out, parsed.String())
+	}
+	return out, nil
+}
+
+func formatDraft(d *EmailDraft) string {
+	var sb strings.Builder
+	sb.WriteString("Email draft:\n")
+	fmt.Fprintf(&sb, "To: %s\n", strings.Join(d.To, ", "))
+	if len(d.Cc) > 0 {
+		fmt.Fprintf(&sb, "Cc: %s\n", strings.Join(d.Cc, ", "))
+	}
+	fmt.Fprintf(&sb, "Subject: %s\n\n%s\n\n", d.Subject, d.Body)
+	fmt.Fprintf(&sb, "Reply /send %s to send it or /discard %s to drop it.", d.ID, d.ID)
+	return sb.String()
+}
+
+// prune drops expired drafts. Callers hold t.mu.
+func (t *EmailTool) prune() {
+	cutoff := t.now().Add(-emailDraftTTL)
+	for id, d := range t.drafts {
+		if d.Created.Before(cutoff) {
+			delete(t.drafts, id)
+		}
+	}
+}
+
+// take removes the draft with id if it was created in the given chat for
+// the given sender.
+func (t *EmailTool) take(id, channel, chatID, senderID string) (*EmailDraft, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.prune()
+	d, ok := t.drafts[id]
+	if !ok || d.Channel != channel || d.ChatID != chatID || d.SenderID != senderID {
+		return nil, false
+	}
+	delete(t.drafts, id)
+	return d, true
+}
+
+// Commands implements commands.Provider.
+func (t *EmailTool) Commands() []commands.Command {
+	return []commands.Command{
+		{Name: "send", Usage: "<id>", Description: "Send a drafted email", Handler: t.sendCommand},
+		{Name: "discard", Usage: "<id>", Description: "Drop a drafted email", Handler: t.sendCommand},
+	}
+}
+
+func (t *EmailTool) sendCommand(ctx context.Context, req commands.Request) string {
+	if len(req.Args) != 1 {
+		return fmt.Sprintf("Usage: /%s <id>", req.Name)
+	}
+	draft, ok := t.take(req.Args[0], req.Msg.Channel, req.Msg.ChatID, req.Msg.SenderID)
+	if !ok {
+		return fmt.Sprintf("No email draft with ID %s (it may have expired).", req.Args[0])
+	}
+	if req.Name == "discard" {
+		return "Draft discarded."
+	}
+
+	if err := t.deliver(ctx, draft); err != nil {
+		logger.ErrorCF("tool", "Failed to send email",
+			map[string]interface{}{"draft": draft.ID, "error": err.Error()})
+		// Keep the draft so the user can retry
+		t.mu.Lock()
+		t.drafts[draft.ID] = draft
+		t.mu.Unlock()
+		return fmt.Sprintf("Sending failed: %v\nReply /send %s to try again.", err, draft.ID)
+	}
+	logger.InfoCF("tool", "Email sent",
+		map[string]interface{}{"draft": draft.ID, "recipients": len(draft.To) + len(draft.Cc), "channel": draft.Channel})
+	return fmt.Sprintf("Sent to %s.", strings.Join(draft.To, ", "))
+}
+
+func (t *EmailTool) deliver(ctx context.Context, d *EmailDraft) error {
+	from, err := mail.ParseAddress(t.opts.From)
+	if err != nil {
+		return fmt.Errorf("invalid from address %q", t.opts.From)
+	}
+
+	var auth smtp.Auth
+	if t.opts.Username != "" {
+		auth = smtp.PlainAuth("", t.opts.Username, t.opts.Password, t.opts.Host)
+	}
+	var rcpts []string
+	for _, addr := range append(append([]string{}, d.To...), d.Cc...) {
+		parsed, _ := mail.ParseAddress(addr)
+		rcpts = append(rcpts, parsed.Address)
+	}
+
+	addr := net.JoinHostPort(t.opts.Host, strconv.Itoa(t.opts.Port))
+	ctx, cancel := context.WithTimeout(ctx, emailSendTimeout)
+	defer cancel()
+	return t.sendMail(ctx, addr, auth, from.Address, rcpts, buildMessage(from.String(), d, t.now()))
+}
+
+// buildMessage renders a plain-text RFC 5322 message.
+func buildMessage(from string, d *EmailDraft, date time.Time) []byte {
+	var buf bytes.Buffer
+	header := func(k, v string) { fmt.Fprintf(&buf, "%s: %s\r\n", k, v) }
+	header("From", from)
+	header("To", strings.Join(d.To, ", "))
+	if len(d.Cc) > 0 {
+		header("Cc", strings.Join(d.Cc, ", "))
+	}
+	header("Subject", mime.QEncoding.Encode("utf-8", d.Subject))
+	header("Date", date.Format(time.RFC1123Z))
+	domain := "picoclaw"
+	if addr, err := mail.ParseAddress(from); err == nil {
+		if _, host, ok := strings.Cut(addr.Address, "@"); ok && host != "" {
+			domain = host
+		}
+	}
+	header("Message-ID", fmt.Sprintf("<%s.%d@%s>", d.ID, date.Unix(), domain))
+	// Emails drafted in the same chat thread reference a shared ID so mail
+	// clients group them into one conversation.
+	if thread := bus.ThreadOf(d.ChatID); thread != "" {
+		sum := sha256.Sum256([]byte(d.Channel + ":" + d.ChatID))
+		header("References", fmt.Sprintf("<thread-%s@%s>", hex.EncodeToString(sum[:8]), domain))
+	}
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "quoted-printable")
+	buf.WriteString("\r\n")
+
+	qp := quotedprintable.NewWriter(&buf)
+	qp.Write([]byte(strings.ReplaceAll(strings.ReplaceAll(d.Body, "\r\n", "\n"), "\n", "\r\n")))
+	qp.Close()
+	return buf.Bytes()
+}
+
+// dialAndSend is smtp.SendMail bounded by ctx, with support for implicit
+// TLS on port 465. On other ports STARTTLS is used when the server offers it.
+func (t *EmailTool) dialAndSend(ctx context.Context, addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	// The deadline covers every read and write of the exchange
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	tlsConfig := &tls.Config{ServerName: t.opts.Host}
+	if t.opts.Port == 465 {
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return err
+		}
+		conn = tlsConn
+	}
+	c, err := smtp.NewClient(conn, t.opts.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if err := c.Hello("localhost"); err != nil {
+		return err
+	}
+	if t.opts.Port != 465 {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(tlsConfig); err != nil {
+				return err
+			}
+		}
+	}
+	if auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return fmt.Errorf("smtp: server doesn't support AUTH")
+		}
+		if err := c.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
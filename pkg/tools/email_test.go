@@ -0,0 +1,228 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/smtp"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/commands"
+)
+
+type sentMail struct {
+	addr string
+	from string
+	to   []string
+	msg  string
+}
+
+func newTestEmailTool(t *testing.T) (*EmailTool, *[]string, *[]sentMail) {
+	t.Helper()
+	tool := NewEmailTool(EmailToolOptions{
+		Host:     "smtp.example.com",
+		Username: "me@example.com",
+		Contacts: map[string]string{"Landlord": "Pat Smith <pat@example.org>"},
+	})
+	var previews []string
+	var sent []sentMail
+	tool.SetSendCallback(func(channel, chatID, content string) error {
+		previews = append(previews, content)
+		return nil
+	})
+	tool.sendMail = func(_ context.Context, addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
+		sent = append(sent, sentMail{addr, from, to, string(msg)})
+		return nil
+	}
+	tool.SetContext("telegram", "chat1")
+	tool.SetSender("telegram", "alice")
+	return tool, &previews, &sent
+}
+
+var draftID = regexp.MustCompile(`/send (\w+)`)
+
+func runEmailCommand(tool *EmailTool, name, id, chatID string) string {
+	return runEmailCommandAs(tool, name, id, chatID, "alice")
+}
+
+func runEmailCommandAs(tool *EmailTool, name, id, chatID, senderID string) string {
+	return tool.sendCommand(context.Background(), commands.Request{
+		Msg:  bus.InboundMessage{Channel: "telegram", ChatID: chatID, SenderID: senderID},
+		Name: name,
+		Args: []string{id},
+	})
+}
+
+func TestEmailTool_DraftAndSend(t *testing.T) {
+	tool, previews, sent := newTestEmailTool(t)
+
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"to":      "landlord",
+		"cc":      "me@example.com",
+		"subject": "Leak in the bathroom",
+		"body":    "Hi Pat,\nthere is a leak.\n\nThanks",
+	})
+	if result.IsError {
+		t.Fatalf("unexpected error: %s", result.ForLLM)
+	}
+	if !strings.Contains(result.ForLLM, "NOT been sent") {
+		t.Errorf("LLM result should say the mail is not sent yet: %q", result.ForLLM)
+	}
+	if len(*previews) != 1 || !strings.Contains((*previews)[0], `To: "Pat Smith" <pat@example.org>`) {
+		t.Fatalf("previews = %q", *previews)
+	}
+	if len(*sent) != 0 {
+		t.Fatal("mail sent before confirmation")
+	}
+	id := draftID.FindStringSubmatch((*previews)[0])[1]
+
+	if got := runEmailCommand(tool, "send", id, "other-chat"); !strings.Contains(got, "No email draft") {
+		t.Errorf("send from another chat = %q", got)
+	}
+	if got := runEmailCommandAs(tool, "send", id, "chat1", "mallory"); !strings.Contains(got, "No email draft") {
+		t.Errorf("send by another group member = %q", got)
+	}
+	if got := runEmailCommand(tool, "send", id, "chat1"); got != `Sent to "Pat Smith" <pat@example.org>.` {
+		t.Errorf("send = %q", got)
+	}
+	if len(*sent) != 1 {
+		t.Fatalf("sent %d mails, want 1", len(*sent))
+	}
+	m := (*sent)[0]
+	if m.addr != "smtp.example.com:587" || m.from != "me@example.com" || strings.Join(m.to, ",") != "pat@example.org,me@example.com" {
+		t.Errorf("envelope = %+v", m)
+	}
+	for _, want := range []string{"Subject: Leak in the bathroom\r\n", "Cc: <me@example.com>\r\n", "Hi Pat,\r\nthere is a leak."} {
+		if !strings.Contains(m.msg, want) {
+			t.Errorf("message missing %q:\n%s", want, m.msg)
+		}
+	}
+
+	if got := runEmailCommand(tool, "send", id, "chat1"); !strings.Contains(got, "No email draft") {
+		t.Errorf("second send = %q", got)
+	}
+}
+
+func TestBuildMessageThreading(t *testing.T) {
+	date := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		chatID     string
+		references bool
+	}{
+		{"C1", false},
+		{"C1/1700000000.0001", true},
+	}
+	for _, tt := range tests {
+		d := &EmailDraft{ID: "abc", To: []string{"<pat@example.org>"}, Subject: "Hi", Body: "Hello", Channel: "slack", ChatID: tt.chatID}
+		msg := string(buildMessage("<me@example.com>", d, date))
+		if !strings.Contains(msg, "Message-ID: <abc.") || !strings.Contains(msg, "@example.com>\r\n") {
+			t.Errorf("%s: missing Message-ID:\n%s", tt.chatID, msg)
+		}
+		if got := strings.Contains(msg, "References: <thread-"); got != tt.references {
+			t.Errorf("%s: References present = %v, want %v", tt.chatID, got, tt.references)
+		}
+	}
+
+	// Drafts from the same thread share the reference
+	a := &EmailDraft{ID: "a", Channel: "slack", ChatID: "C1/17.1"}
+	b := &EmailDraft{ID: "b", Channel: "slack", ChatID: "C1/17.1"}
+	ref := regexp.MustCompile(`References: (\S+)`)
+	ra := ref.FindString(string(buildMessage("me@example.com", a, date)))
+	rb := ref.FindString(string(buildMessage("me@example.com", b, date)))
+	if ra == "" || ra != rb {
+		t.Errorf("references differ: %q vs %q", ra, rb)
+	}
+}
+
+func TestEmailTool_DiscardAndFailure(t *testing.T) {
+	tool, previews, _ := newTestEmailTool(t)
+	args := map[string]interface{}{"to": "pat@example.org", "subject": "Hello", "body": "Hi"}
+
+	tool.Execute(context.Background(), args)
+	id := draftID.FindStringSubmatch((*previews)[0])[1]
+	if got := runEmailCommand(tool, "discard", id, "chat1"); got != "Draft discarded." {
+		t.Errorf("discard = %q", got)
+	}
+	if got := runEmailCommand(tool, "send", id, "chat1"); !strings.Contains(got, "No email draft") {
+		t.Errorf("send after discard = %q", got)
+	}
+
+	tool.Execute(context.Background(), args)
+	id = draftID.FindStringSubmatch((*previews)[1])[1]
+	tool.sendMail = func(context.Context, string, smtp.Auth, string, []string, []byte) error {
+		return errors.New("connection refused")
+	}
+	if got := runEmailCommand(tool, "send", id, "chat1"); !strings.Contains(got, "Sending failed") {
+		t.Errorf("failed send = %q", got)
+	}
+	if _, ok := tool.take(id, "telegram", "chat1", "alice"); !ok {
+		t.Error("draft should be kept after a failed send")
+	}
+}
+
+func TestDialAndSendTimeout(t *testing.T) {
+	// A server that accepts the connection but never greets
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(5 * time.Second)
+		}
+	}()
+
+	tool := NewEmailTool(EmailToolOptions{Host: "127.0.0.1", From: "me@example.com"})
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := tool.dialAndSend(ctx, ln.Addr().String(), nil, "me@example.com", []string{"pat@example.org"}, []byte("Hi")); err == nil {
+		t.Fatal("dialAndSend() to a silent server succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("dialAndSend() took %v, want it to stop at the deadline", elapsed)
+	}
+}
+
+func TestEmailTool_Expiry(t *testing.T) {
+	tool, previews, _ := newTestEmailTool(t)
+	now := time.Now()
+	tool.now = func() time.Time { return now }
+
+	tool.Execute(context.Background(), map[string]interface{}{"to": "pat@example.org", "subject": "Hello", "body": "Hi"})
+	id := draftID.FindStringSubmatch((*previews)[0])[1]
+
+	now = now.Add(emailDraftTTL + time.Minute)
+	if got := runEmailCommand(tool, "send", id, "chat1"); !strings.Contains(got, "expired") {
+		t.Errorf("send after expiry = %q", got)
+	}
+}
+
+func TestEmailTool_Validation(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    map[string]interface{}
+		wantErr string
+	}{
+		{"unknown contact", map[string]interface{}{"to": "plumber", "subject": "s", "body": "b"}, "not an email address or a saved contact"},
+		{"empty recipients", map[string]interface{}{"to": " , ", "subject": "s", "body": "b"}, "recipient is required"},
+		{"header injection", map[string]interface{}{"to": "pat@example.org", "subject": "s\r\nBcc: x@y.z", "body": "b"}, "single line"},
+		{"empty body", map[string]interface{}{"to": "pat@example.org", "subject": "s", "body": " "}, "body is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tool, _, _ := newTestEmailTool(t)
+			result := tool.Execute(context.Background(), tt.args)
+			if !result.IsError || !strings.Contains(result.ForLLM, tt.wantErr) {
+				t.Errorf("result = %q, want error containing %q", result.ForLLM, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package tools
+
+import "context"
+
+// FuncHandler executes a FuncTool call. Arguments have already been
+// validated against the tool's parameter schema.
+type FuncHandler func(ctx context.Context, args map[string]interface{}) *ToolResult
+
+// FuncTool adapts a plain function into a Tool, for integrations that do not
+// need their own type (home automation hooks, small lookups, etc.).
+//
+//	registry.Register(tools.NewFuncTool("lights", "Turn lights on or off",
+//	    map[string]interface{}{
+//	        "type": "object",
+//	        "properties": map[string]interface{}{
+//	            "state": map[string]interface{}{"type": "string", "enum": []interface{}{"on", "off"}},
+//	        },
+//	        "required": []string{"state"},
+//	    },
+//	    func(ctx context.Context, args map[string]interface{}) *tools.ToolResult {
+//	        return tools.NewToolResult("lights " + args["state"].(string))
+//	    }))
+type FuncTool struct {
+	name        string
+	description string
+	parameters  map[string]interface{}
+	handler     FuncHandler
+}
+
+func NewFuncTool(name, description string, parameters map[string]interface{}, handler FuncHandler) *FuncTool {
+	if parameters == nil {
+		parameters = map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{},
+		}
+	}
+	return &FuncTool{
+		name:        name,
+		description: description,
+		parameters:  parameters,
+		handler:     handler,
+	}
+}
+
+func (t *FuncTool) Name() string {
+	return t.name
+}
+
+func (t *FuncTool) Description() string {
+	return t.description
+}
+
+func (t *FuncTool) Parameters() map[string]interface{} {
+	return t.parameters
+}
+
+func (t *FuncTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	return t.handler(ctx, args)
+}
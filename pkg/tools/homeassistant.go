@@ -0,0 +1,436 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/events"
+)
+
+const maxHomeAssistantStates = 100
+
+// Home Assistant access levels. Control implies read.
+const (
+	HAAccessNone    = "none"
+	HAAccessRead    = "read"
+	HAAccessControl = "control"
+)
+
+// HomeAssistantRule grants Access to entities matching Entities (globs
+// such as "light.*") for Senders ("channel:sender_id", empty for everyone).
+type HomeAssistantRule struct {
+	Entities []string
+	Access   string
+	Senders  []string
+}
+
+// HomeAssistantToolOptions configures the Home Assistant connection.
+type HomeAssistantToolOptions struct {
+	URL   string
+	Token string // Long-lived access token
+	// Rules are checked in order; the first one matching the entity and
+	// sender decides. Entities no rule matches are not accessible.
+	Rules []HomeAssistantRule
+	// MQTTTopics are topic filters ("+" and "#" wildcards) the agent may
+	// publish to through Home Assistant's mqtt.publish service.
+	MQTTTopics []string
+}
+
+// HomeAssistantTool reads and controls Home Assistant entities over its REST
+// API, subject to per-entity, per-sender rules.
+type HomeAssistantTool struct {
+	opts   HomeAssistantToolOptions
+	client *http.Client
+
+	mu       sync.RWMutex
+	channel  string
+	senderID string
+}
+
+func NewHomeAssistantTool(opts HomeAssistantToolOptions) *HomeAssistantTool {
+	opts.URL = strings.TrimRight(opts.URL, "/")
+	return &HomeAssistantTool{
+		opts:   opts,
+		client: &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+func (t *HomeAssistantTool) Name() string {
+	return "home_assistant"
+}
+
+func (t *HomeAssistantTool) Description() string {
+	desc := "Control the smart home through Home Assistant. Use 'states' to find entities (e.g. which light is the living room), 'get' to read one, and 'call' to run a service such as light.turn_off on an entity."
+	if len(t.opts.MQTTTopics) > 0 {
+		desc += " 'mqtt_publish' sends an MQTT message."
+	}
+	return desc
+}
+
+func (t *HomeAssistantTool) Parameters() map[string]interface{} {
+	actions := []string{"states", "get", "call"}
+	if len(t.opts.MQTTTopics) > 0 {
+		actions = append(actions, "mqtt_publish")
+	}
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type": "string",
+				"enum": actions,
+			},
+			"entity_id": map[string]interface{}{
+				"type":        "string",
+				"description": "Entity such as light.living_room (get, call)",
+			},
+			"search": map[string]interface{}{
+				"type":        "string",
+				"description": "Filter for states: matches entity IDs and names, e.g. 'light.' or 'kitchen'",
+			},
+			"service": map[string]interface{}{
+				"type":        "string",
+				"description": "Service for call as domain.service, e.g. light.turn_on, switch.toggle, climate.set_temperature",
+			},
+			"data": map[string]interface{}{
+				"type":        "object",
+				"description": "Extra service data for call, e.g. {\"brightness_pct\": 40}",
+			},
+			"topic": map[string]interface{}{
+				"type":        "string",
+				"description": "MQTT topic for mqtt_publish",
+			},
+			"payload": map[string]interface{}{
+				"type":        "string",
+				"description": "MQTT payload for mqtt_publish",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+// SetSender sets whose permissions apply to the next calls.
+func (t *HomeAssistantTool) SetSender(channel, senderID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.channel = channel
+	t.senderID = senderID
+}
+
+func (t *HomeAssistantTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	action, _ := args["action"].(string)
+	entityID, _ := args["entity_id"].(string)
+	entityID = strings.TrimSpace(entityID)
+
+	switch action {
+	case "states":
+		search, _ := args["search"].(string)
+		return t.states(ctx, search)
+	case "get":
+		if entityID == "" {
+			return ErrorResult("entity_id is required")
+		}
+		if !t.allowed(entityID, HAAccessRead) {
+			t.reportDenied("get", entityID)
+			return ErrorResult(fmt.Sprintf("access to %s is not permitted", entityID))
+		}
+		var state haState
+		if err := t.request(ctx, "GET", "/api/states/"+url.PathEscape(entityID), nil, &state); err != nil {
+			return ErrorResult(err.Error())
+		}
+		return SilentResult(formatHAState(state, true))
+	case "call":
+		service, _ := args["service"].(string)
+		data, _ := args["data"].(map[string]interface{})
+		return t.call(ctx, entityID, service, data)
+	case "mqtt_publish":
+		topic, _ := args["topic"].(string)
+		payload, _ := args["payload"].(string)
+		return t.publish(ctx, topic, payload)
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action %q", action))
+	}
+}
+
+type haState struct {
+	EntityID    string                 `json:"entity_id"`
+	State       string                 `json:"state"`
+	Attributes  map[string]interface{} `json:"attributes"`
+	LastChanged string                 `json:"last_changed"`
+}
+
+func (t *HomeAssistantTool) states(ctx context.Context, search string) *ToolResult {
+	var states []haState
+	if err := t.request(ctx, "GET", "/api/states", nil, &states); err != nil {
+		return ErrorResult(err.Error())
+	}
+	search = strings.ToLower(strings.TrimSpace(search))
+
+	var lines []string
+	for _, s := range states {
+		if !t.allowed(s.EntityID, HAAccessRead) {
+			continue
+		}
+		name, _ := s.Attributes["friendly_name"].(string)
+		if search != "" && !strings.Contains(strings.ToLower(s.EntityID), search) && !strings.Contains(strings.ToLower(name), search) {
+			continue
+		}
+		lines = append(lines, formatHAState(s, false))
+	}
+	sort.Strings(lines)
+	if len(lines) == 0 {
+		return SilentResult("No accessible entities match.")
+	}
+	more := ""
+	if len(lines) > maxHomeAssistantStates {
+		more = fmt.Sprintf("\n(%d more, narrow the search)", len(lines)-maxHomeAssistantStates)
+		lines = lines[:maxHomeAssistantStates]
+	}
+	return SilentResult(strings.Join(lines, "\n") + more)
+}
+
+func (t *HomeAssistantTool) call(ctx context.Context, entityID, service string, data map[string]interface{}) *ToolResult {
+	domain, name, ok := strings.Cut(strings.TrimSpace(service), ".")
+	if !ok || domain == "" || name == "" || strings.ContainsAny(service, "/ ") {
+		return ErrorResult("service must look like domain.service, e.g. light.turn_off")
+	}
+	if entityID == "" {
+		return ErrorResult("entity_id is required for call")
+	}
+	if !t.allowed(entityID, HAAccessControl) {
+		t.reportDenied("call", entityID)
+		return ErrorResult(fmt.Sprintf("controlling %s is not permitted", entityID))
+	}
+	// Services act on whatever targets the data names; only the checked
+	// entity may be targeted.
+	for _, key := range []string{"entity_id", "device_id", "area_id", "floor_id", "label_id"} {
+		if _, ok := data[key]; ok {
+			return ErrorResult(fmt.Sprintf("pass the target as entity_id, not in data.%s", key))
+		}
+	}
+	if domain == "mqtt" {
+		return ErrorResult("use the mqtt_publish action for MQTT")
+	}
+	// Access is granted per entity, so the service must be one of the
+	// entity's own domain: lock.unlock on a lock, not a script or shell
+	// command named after an allowed light
+	if entityDomain, _, _ := strings.Cut(entityID, "."); domain != entityDomain && !haGenericServices[service] {
+		t.reportDenied("call", service+" on "+entityID)
+		return ErrorResult(fmt.Sprintf("%s cannot be called on %s; use a %s service", service, entityID, entityDomain))
+	}
+
+	body := map[string]interface{}{"entity_id": entityID}
+	for k, v := range data {
+		body[k] = v
+	}
+	if err := t.request(ctx, "POST", "/api/services/"+domain+"/"+name, body, nil); err != nil {
+		return ErrorResult(err.Error())
+	}
+
+	// Report the resulting state so the model can confirm what happened
+	var state haState
+	if err := t.request(ctx, "GET", "/api/states/"+url.PathEscape(entityID), nil, &state); err != nil {
+		return SilentResult(fmt.Sprintf("Called %s on %s.", service, entityID))
+	}
+	return SilentResult(fmt.Sprintf("Called %s on %s. Now: %s", service, entityID, formatHAState(state, false)))
+}
+
+// haGenericServices are the homeassistant services that act on any entity
+// by calling its own domain's service, so they need no domain match.
+var haGenericServices = map[string]bool{
+	"homeassistant.turn_on":       true,
+	"homeassistant.turn_off":      true,
+	"homeassistant.toggle":        true,
+	"homeassistant.update_entity": true,
+}
+
+func (t *HomeAssistantTool) publish(ctx context.Context, topic, payload string) *ToolResult {
+	topic = strings.TrimSpace(topic)
+	if topic == "" {
+		return ErrorResult("topic is required")
+	}
+	if strings.ContainsAny(topic, "+#") {
+		return ErrorResult("topic must not contain wildcards")
+	}
+	allowed := false
+	for _, filter := range t.opts.MQTTTopics {
+		if mqttTopicMatch(filter, topic) {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		t.reportDenied("mqtt_publish", topic)
+		return ErrorResult(fmt.Sprintf("publishing to %s is not permitted", topic))
+	}
+	if err := t.request(ctx, "POST", "/api/services/mqtt/publish", map[string]interface{}{"topic": topic, "payload": payload}, nil); err != nil {
+		return ErrorResult(err.Error())
+	}
+	return SilentResult(fmt.Sprintf("Published to %s.", topic))
+}
+
+// allowed reports whether the current sender has at least the given access
+// to entityID.
+func (t *HomeAssistantTool) allowed(entityID, access string) bool {
+	t.mu.RLock()
+	sender := t.channel + ":" + t.senderID
+	t.mu.RUnlock()
+
+	for _, rule := range t.opts.Rules {
+		if !matchesAny(rule.Entities, entityID) || !ruleAppliesTo(rule.Senders, sender) {
+			continue
+		}
+		switch rule.Access {
+		case HAAccessControl:
+			return true
+		case HAAccessRead:
+			return access == HAAccessRead
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// reportDenied publishes a refused request as a security event.
+func (t *HomeAssistantTool) reportDenied(action, target string) {
+	t.mu.RLock()
+	channel, senderID := t.channel, t.senderID
+	t.mu.RUnlock()
+	events.Security("homeassistant", "Denied Home Assistant request",
+		map[string]interface{}{
+			"action":    action,
+			"target":    target,
+			"channel":   channel,
+			"sender_id": senderID,
+		})
+}
+
+func matchesAny(patterns []string, entityID string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, entityID); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ruleAppliesTo matches a sender against a rule's sender list. Composite
+// sender IDs ("123|username") match on any part.
+func ruleAppliesTo(senders []string, sender string) bool {
+	if len(senders) == 0 {
+		return true
+	}
+	channel, id, _ := strings.Cut(sender, ":")
+	for _, s := range senders {
+		if s == sender {
+			return true
+		}
+		for _, part := range strings.Split(id, "|") {
+			if s == channel+":"+part {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// mqttTopicMatch matches a topic against an MQTT filter with "+" (one
+// level) and "#" (the level it replaces and all below) wildcards.
+func mqttTopicMatch(filter, topic string) bool {
+	f := strings.Split(filter, "/")
+	tp := strings.Split(topic, "/")
+	for i, level := range f {
+		if level == "#" {
+			return true
+		}
+		if i >= len(tp) || (level != "+" && level != tp[i]) {
+			return false
+		}
+	}
+	return len(f) == len(tp)
+}
+
+func formatHAState(s haState, detailed bool) string {
+	line := s.EntityID + ": " + s.State
+	if unit, ok := s.Attributes["unit_of_measurement"].(string); ok {
+		line += " " + unit
+	}
+	if name, ok := s.Attributes["friendly_name"].(string); ok && name != "" {
+		line += " (" + name + ")"
+	}
+	if !detailed {
+		return line
+	}
+
+	keys := make([]string, 0, len(s.Attributes))
+	for k := range s.Attributes {
+		if k != "friendly_name" && k != "unit_of_measurement" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var sb strings.Builder
+	sb.WriteString(line)
+	if s.LastChanged != "" {
+		sb.WriteString("\nlast changed: " + s.LastChanged)
+	}
+	for _, k := range keys {
+		v, _ := json.Marshal(s.Attributes[k])
+		fmt.Fprintf(&sb, "\n%s: %s", k, v)
+	}
+	return sb.String()
+}
+
+func (t *HomeAssistantTool) request(ctx context.Context, method, apiPath string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, t.opts.URL+apiPath, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+t.opts.Token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Home Assistant request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read Home Assistant response: %v", err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("not found in Home Assistant: %s", apiPath)
+	case resp.StatusCode == http.StatusUnauthorized:
+		return fmt.Errorf("Home Assistant rejected the access token")
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("Home Assistant error (status %d): %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to parse Home Assistant response: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestHomeAssistant(t *testing.T, calls *[]string) *HomeAssistantTool {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/api/states":
+			w.Write([]byte(`[
+				{"entity_id": "light.living_room", "state": "on", "attributes": {"friendly_name": "Living Room"}},
+				{"entity_id": "lock.front_door", "state": "locked", "attributes": {"friendly_name": "Front Door"}},
+				{"entity_id": "sensor.temp", "state": "21.5", "attributes": {"unit_of_measurement": "°C"}},
+				{"entity_id": "camera.garden", "state": "idle", "attributes": {}}
+			]`))
+		case r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/api/states/"):
+			id := strings.TrimPrefix(r.URL.Path, "/api/states/")
+			w.Write([]byte(`{"entity_id": "` + id + `", "state": "off", "attributes": {"brightness": 0}}`))
+		case r.Method == "POST" && strings.HasPrefix(r.URL.Path, "/api/services/"):
+			var body map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			data, _ := json.Marshal(body)
+			*calls = append(*calls, r.URL.Path+" "+string(data))
+			w.Write([]byte(`[]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	tool := NewHomeAssistantTool(HomeAssistantToolOptions{
+		URL:   server.URL + "/",
+		Token: "secret",
+		Rules: []HomeAssistantRule{
+			{Entities: []string{"lock.*"}, Access: HAAccessControl, Senders: []string{"telegram:1"}},
+			{Entities: []string{"lock.*"}, Access: HAAccessRead},
+			{Entities: []string{"light.*"}, Access: HAAccessControl},
+			{Entities: []string{"sensor.*"}, Access: HAAccessRead},
+		},
+		MQTTTopics: []string{"zigbee2mqtt/+/set"},
+	})
+	tool.SetSender("telegram", "2|bob")
+	return tool
+}
+
+func TestHomeAssistantStatesFiltersByAccess(t *testing.T) {
+	var calls []string
+	tool := newTestHomeAssistant(t, &calls)
+
+	res := tool.Execute(context.Background(), map[string]interface{}{"action": "states"})
+	if res.IsError {
+		t.Fatalf("states failed: %s", res.ForLLM)
+	}
+	for _, want := range []string{"light.living_room: on (Living Room)", "lock.front_door: locked", "sensor.temp: 21.5 °C"} {
+		if !strings.Contains(res.ForLLM, want) {
+			t.Errorf("states missing %q:\n%s", want, res.ForLLM)
+		}
+	}
+	if strings.Contains(res.ForLLM, "camera.garden") {
+		t.Errorf("states listed an entity no rule allows:\n%s", res.ForLLM)
+	}
+
+	res = tool.Execute(context.Background(), map[string]interface{}{"action": "states", "search": "living"})
+	if strings.Contains(res.ForLLM, "lock.") || !strings.Contains(res.ForLLM, "light.living_room") {
+		t.Errorf("search did not filter:\n%s", res.ForLLM)
+	}
+}
+
+func TestHomeAssistantCallAuthorization(t *testing.T) {
+	tests := []struct {
+		name    string
+		sender  string
+		args    map[string]interface{}
+		wantErr bool
+	}{
+		{"light control", "2|bob", map[string]interface{}{"entity_id": "light.living_room", "service": "light.turn_off"}, false},
+		{"lock read only", "2|bob", map[string]interface{}{"entity_id": "lock.front_door", "service": "lock.unlock"}, true},
+		{"lock for listed sender", "1|alice", map[string]interface{}{"entity_id": "lock.front_door", "service": "lock.unlock"}, false},
+		{"sensor read only", "2|bob", map[string]interface{}{"entity_id": "sensor.temp", "service": "homeassistant.update_entity"}, true},
+		{"unlisted entity", "1|alice", map[string]interface{}{"entity_id": "camera.garden", "service": "camera.turn_off"}, true},
+		{"extra target in data", "2|bob", map[string]interface{}{"entity_id": "light.living_room", "service": "light.turn_off", "data": map[string]interface{}{"area_id": "house"}}, true},
+		{"bad service", "2|bob", map[string]interface{}{"entity_id": "light.living_room", "service": "turn_off"}, true},
+		{"service of another domain", "2|bob", map[string]interface{}{"entity_id": "light.living_room", "service": "lock.unlock"}, true},
+		{"script on an allowed entity", "2|bob", map[string]interface{}{"entity_id": "light.living_room", "service": "shell_command.wipe"}, true},
+		{"generic service", "2|bob", map[string]interface{}{"entity_id": "light.living_room", "service": "homeassistant.toggle"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []string
+			tool := newTestHomeAssistant(t, &calls)
+			id, _, _ := strings.Cut(tt.sender, "|")
+			tool.SetSender("telegram", id)
+
+			tt.args["action"] = "call"
+			res := tool.Execute(context.Background(), tt.args)
+			if res.IsError != tt.wantErr {
+				t.Fatalf("IsError = %v, want %v: %s", res.IsError, tt.wantErr, res.ForLLM)
+			}
+			if tt.wantErr && len(calls) > 0 {
+				t.Errorf("service called despite error: %v", calls)
+			}
+			if !tt.wantErr && len(calls) != 1 {
+				t.Errorf("calls = %v, want one", calls)
+			}
+		})
+	}
+}
+
+func TestHomeAssistantCallSendsData(t *testing.T) {
+	var calls []string
+	tool := newTestHomeAssistant(t, &calls)
+
+	res := tool.Execute(context.Background(), map[string]interface{}{
+		"action":    "call",
+		"entity_id": "light.living_room",
+		"service":   "light.turn_on",
+		"data":      map[string]interface{}{"brightness_pct": 40},
+	})
+	if res.IsError {
+		t.Fatalf("call failed: %s", res.ForLLM)
+	}
+	want := `/api/services/light/turn_on {"brightness_pct":40,"entity_id":"light.living_room"}`
+	if len(calls) != 1 || calls[0] != want {
+		t.Errorf("calls = %v, want %s", calls, want)
+	}
+	if !strings.Contains(res.ForLLM, "Now: light.living_room: off") {
+		t.Errorf("result missing new state: %s", res.ForLLM)
+	}
+}
+
+func TestHomeAssistantMQTTPublish(t *testing.T) {
+	var calls []string
+	tool := newTestHomeAssistant(t, &calls)
+
+	res := tool.Execute(context.Background(), map[string]interface{}{"action": "mqtt_publish", "topic": "zigbee2mqtt/fan/set", "payload": `{"state":"ON"}`})
+	if res.IsError {
+		t.Fatalf("publish failed: %s", res.ForLLM)
+	}
+	if len(calls) != 1 || !strings.HasPrefix(calls[0], "/api/services/mqtt/publish ") {
+		t.Errorf("calls = %v", calls)
+	}
+
+	for _, topic := range []string{"zigbee2mqtt/fan/get", "zigbee2mqtt/fan/set/extra", "zigbee2mqtt/+/set", "other"} {
+		res := tool.Execute(context.Background(), map[string]interface{}{"action": "mqtt_publish", "topic": topic, "payload": "x"})
+		if !res.IsError {
+			t.Errorf("publish to %q allowed", topic)
+		}
+	}
+}
+
+func TestMQTTTopicMatch(t *testing.T) {
+	tests := []struct {
+		filter, topic string
+		want          bool
+	}{
+		{"a/b", "a/b", true},
+		{"a/+", "a/b", true},
+		{"a/+", "a/b/c", false},
+		{"a/#", "a/b/c", true},
+		{"a/#", "a", true},
+		{"#", "anything/at/all", true},
+		{"a/b", "a/c", false},
+	}
+	for _, tt := range tests {
+		if got := mqttTopicMatch(tt.filter, tt.topic); got != tt.want {
+			t.Errorf("mqttTopicMatch(%q, %q) = %v, want %v", tt.filter, tt.topic, got, tt.want)
+		}
+	}
+}
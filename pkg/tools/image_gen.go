@@ -0,0 +1,319 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/constants"
+)
+
+const maxGeneratedImageBytes = 20 * 1024 * 1024
+
+// ImageSender delivers a generated image to a chat.
+type ImageSender func(channel, chatID, caption string, media []string) error
+
+// ImageGenToolOptions configures the image generation backend.
+type ImageGenToolOptions struct {
+	Provider  string // "openai", "stability", or "sd" (AUTOMATIC1111 API)
+	APIKey    string
+	APIBase   string
+	Model     string
+	Size      string // "WIDTHxHEIGHT"
+	OutputDir string
+}
+
+// ImageGenTool turns a text prompt into an image and sends it to the
+// current chat as a native image message.
+type ImageGenTool struct {
+	opts    ImageGenToolOptions
+	client  *http.Client
+	send    ImageSender
+	channel string
+	chatID  string
+	mu      sync.RWMutex
+}
+
+func NewImageGenTool(opts ImageGenToolOptions) *ImageGenTool {
+	if opts.Provider == "" {
+		opts.Provider = "openai"
+	}
+	if opts.Size == "" {
+		opts.Size = "1024x1024"
+	}
+	return &ImageGenTool{
+		opts:   opts,
+		client: &http.Client{Timeout: 180 * time.Second},
+	}
+}
+
+func (t *ImageGenTool) Name() string {
+	return "generate_image"
+}
+
+func (t *ImageGenTool) Description() string {
+	return "Generate an image from a text description and send it to the user. Use this when the user asks to draw, paint, render, or create a picture."
+}
+
+func (t *ImageGenTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"prompt": map[string]interface{}{
+				"type":        "string",
+				"description": "Detailed description of the image to generate",
+			},
+			"size": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional image size as WIDTHxHEIGHT (e.g. 1024x1024)",
+			},
+		},
+		"required": []string{"prompt"},
+	}
+}
+
+// SetContext sets the chat generated images are sent to.
+func (t *ImageGenTool) SetContext(channel, chatID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.channel = channel
+	t.chatID = chatID
+}
+
+// SetSendCallback sets how generated images reach the chat.
+func (t *ImageGenTool) SetSendCallback(send ImageSender) {
+	t.send = send
+}
+
+func (t *ImageGenTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	prompt, _ := args["prompt"].(string)
+	if strings.TrimSpace(prompt) == "" {
+		return ErrorResult("prompt is required")
+	}
+	size := t.opts.Size
+	if s, ok := args["size"].(string); ok && s != "" {
+		size = s
+	}
+	width, height, err := parseImageSize(size)
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+
+	var data []byte
+	switch t.opts.Provider {
+	case "openai":
+		data, err = t.generateOpenAI(ctx, prompt, size)
+	case "stability":
+		data, err = t.generateStability(ctx, prompt)
+	case "sd":
+		data, err = t.generateSD(ctx, prompt, width, height)
+	default:
+		err = fmt.Errorf("unknown image provider %q", t.opts.Provider)
+	}
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("image generation failed: %v", err)).WithError(err)
+	}
+
+	path, err := t.save(data)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to save image: %v", err)).WithError(err)
+	}
+
+	t.mu.RLock()
+	channel, chatID := t.channel, t.chatID
+	t.mu.RUnlock()
+
+	if t.send == nil || channel == "" || constants.IsInternalChannel(channel) {
+		return NewToolResult(fmt.Sprintf("Image generated and saved to %s", path))
+	}
+	if err := t.send(channel, chatID, "", []string{path}); err != nil {
+		return ErrorResult(fmt.Sprintf("image generated (%s) but sending failed: %v", path, err)).WithError(err)
+	}
+	return SilentResult(fmt.Sprintf("Image generated and sent to the user (saved to %s). Do not describe it at length.", path))
+}
+
+func (t *ImageGenTool) generateOpenAI(ctx context.Context, prompt, size string) ([]byte, error) {
+	base := strings.TrimRight(t.opts.APIBase, "/")
+	if base == "" {
+		base = "https://api.openai.com/v1"
+	}
+	model := t.opts.Model
+	if model == "" {
+		model = "gpt-image-1"
+	}
+
+	body := map[string]interface{}{
+		"model":  model,
+		"prompt": prompt,
+		"size":   size,
+		"n":      1,
+	}
+	// DALL-E models return URLs unless asked otherwise; gpt-image models
+	// always return base64 and reject the parameter.
+	if strings.HasPrefix(model, "dall-e") {
+		body["response_format"] = "b64_json"
+	}
+	payload, _ := json.Marshal(body)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", base+"/images/generations", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+t.opts.APIKey)
+
+	respBody, err := t.do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Data []struct {
+			B64JSON string `json:"b64_json"`
+			URL     string `json:"url"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+	if len(result.Data) == 0 {
+		return nil, fmt.Errorf("no image returned")
+	}
+	if result.Data[0].B64JSON != "" {
+		return base64.StdEncoding.DecodeString(result.Data[0].B64JSON)
+	}
+
+	req, err = http.NewRequestWithContext(ctx, "GET", result.Data[0].URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	return t.do(req)
+}
+
+func (t *ImageGenTool) generateStability(ctx context.Context, prompt string) ([]byte, error) {
+	base := strings.TrimRight(t.opts.APIBase, "/")
+	if base == "" {
+		base = "https://api.stability.ai"
+	}
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	w.WriteField("prompt", prompt)
+	w.WriteField("output_format", "png")
+	w.Close()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", base+"/v2beta/stable-image/generate/core", &buf)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+t.opts.APIKey)
+	req.Header.Set("Accept", "image/*")
+
+	return t.do(req)
+}
+
+func (t *ImageGenTool) generateSD(ctx context.Context, prompt string, width, height int) ([]byte, error) {
+	base := strings.TrimRight(t.opts.APIBase, "/")
+	if base == "" {
+		base = "http://127.0.0.1:7860"
+	}
+
+	payload, _ := json.Marshal(map[string]interface{}{
+		"prompt": prompt,
+		"width":  width,
+		"height": height,
+		"steps":  20,
+	})
+	req, err := http.NewRequestWithContext(ctx, "POST", base+"/sdapi/v1/txt2img", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	respBody, err := t.do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Images []string `json:"images"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+	if len(result.Images) == 0 {
+		return nil, fmt.Errorf("no image returned")
+	}
+	return base64.StdEncoding.DecodeString(result.Images[0])
+}
+
+// do sends req and returns the body, treating non-2xx responses as errors.
+func (t *ImageGenTool) do(req *http.Request) ([]byte, error) {
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxGeneratedImageBytes))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, truncateError(body))
+	}
+	return body, nil
+}
+
+func (t *ImageGenTool) save(data []byte) (string, error) {
+	dir := t.opts.OutputDir
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "picoclaw_images")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	suffix := make([]byte, 3)
+	rand.Read(suffix)
+	ext := ".png"
+	if http.DetectContentType(data) == "image/jpeg" {
+		ext = ".jpg"
+	}
+	path := filepath.Join(dir, time.Now().Format("20060102-150405")+"-"+hex.EncodeToString(suffix)+ext)
+	return path, os.WriteFile(path, data, 0644)
+}
+
+func parseImageSize(size string) (int, int, error) {
+	w, h, ok := strings.Cut(strings.ToLower(size), "x")
+	if ok {
+		width, errW := strconv.Atoi(w)
+		height, errH := strconv.Atoi(h)
+		if errW == nil && errH == nil && width > 0 && height > 0 {
+			return width, height, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("invalid size %q, expected WIDTHxHEIGHT", size)
+}
+
+func truncateError(body []byte) string {
+	s := strings.TrimSpace(string(body))
+	if len(s) > 300 {
+		s = s[:300] + "..."
+	}
+	return s
+}
@@ -0,0 +1,142 @@
+package tools
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// pngHeader is enough of a PNG for content sniffing.
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func TestImageGenTool_Providers(t *testing.T) {
+	encoded := base64.StdEncoding.EncodeToString(pngHeader)
+
+	tests := []struct {
+		name     string
+		provider string
+		path     string
+		respond  func(w http.ResponseWriter, r *http.Request)
+	}{
+		{
+			name:     "openai",
+			provider: "openai",
+			path:     "/images/generations",
+			respond: func(w http.ResponseWriter, r *http.Request) {
+				var body map[string]interface{}
+				json.NewDecoder(r.Body).Decode(&body)
+				if body["prompt"] != "a cat" || body["size"] != "512x512" {
+					t.Errorf("unexpected request body: %v", body)
+				}
+				if _, ok := body["response_format"]; ok {
+					t.Errorf("response_format must not be sent for gpt-image models")
+				}
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"data": []map[string]string{{"b64_json": encoded}},
+				})
+			},
+		},
+		{
+			name:     "stability",
+			provider: "stability",
+			path:     "/v2beta/stable-image/generate/core",
+			respond: func(w http.ResponseWriter, r *http.Request) {
+				if r.FormValue("prompt") != "a cat" {
+					t.Errorf("prompt = %q", r.FormValue("prompt"))
+				}
+				w.Write(pngHeader)
+			},
+		},
+		{
+			name:     "sd",
+			provider: "sd",
+			path:     "/sdapi/v1/txt2img",
+			respond: func(w http.ResponseWriter, r *http.Request) {
+				var body map[string]interface{}
+				json.NewDecoder(r.Body).Decode(&body)
+				if body["width"] != float64(512) || body["height"] != float64(512) {
+					t.Errorf("unexpected dimensions: %v", body)
+				}
+				json.NewEncoder(w).Encode(map[string]interface{}{"images": []string{encoded}})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != tt.path {
+					t.Errorf("path = %s, want %s", r.URL.Path, tt.path)
+				}
+				tt.respond(w, r)
+			}))
+			defer server.Close()
+
+			tool := NewImageGenTool(ImageGenToolOptions{
+				Provider:  tt.provider,
+				APIBase:   server.URL,
+				Size:      "512x512",
+				OutputDir: t.TempDir(),
+			})
+			var sent []string
+			tool.SetSendCallback(func(channel, chatID, caption string, media []string) error {
+				if channel != "telegram" || chatID != "42" {
+					t.Errorf("sent to %s:%s", channel, chatID)
+				}
+				sent = media
+				return nil
+			})
+			tool.SetContext("telegram", "42")
+
+			result := tool.Execute(context.Background(), map[string]interface{}{"prompt": "a cat"})
+			if result.IsError {
+				t.Fatalf("unexpected error: %s", result.ForLLM)
+			}
+			if !result.Silent {
+				t.Errorf("expected silent result after sending the image")
+			}
+			if len(sent) != 1 {
+				t.Fatalf("expected one image sent, got %v", sent)
+			}
+			data, err := os.ReadFile(sent[0])
+			if err != nil {
+				t.Fatalf("generated image not saved: %v", err)
+			}
+			if string(data) != string(pngHeader) || !strings.HasSuffix(sent[0], ".png") {
+				t.Errorf("unexpected image file %s", sent[0])
+			}
+		})
+	}
+}
+
+func TestImageGenTool_Errors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":"content policy"}`, http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	tool := NewImageGenTool(ImageGenToolOptions{APIBase: server.URL, OutputDir: t.TempDir()})
+
+	tests := []struct {
+		name string
+		args map[string]interface{}
+		want string
+	}{
+		{"missing prompt", map[string]interface{}{}, "prompt is required"},
+		{"bad size", map[string]interface{}{"prompt": "x", "size": "huge"}, "invalid size"},
+		{"api error", map[string]interface{}{"prompt": "x"}, "content policy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := tool.Execute(context.Background(), tt.args)
+			if !result.IsError || !strings.Contains(result.ForLLM, tt.want) {
+				t.Errorf("expected error containing %q, got %+v", tt.want, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/rag"
+)
+
+// KnowledgeSearchTool retrieves relevant passages from the local document
+// store (see pkg/rag).
+type KnowledgeSearchTool struct {
+	store *rag.Store
+	topK  int
+}
+
+func NewKnowledgeSearchTool(store *rag.Store, topK int) *KnowledgeSearchTool {
+	if topK <= 0 {
+		topK = 4
+	}
+	return &KnowledgeSearchTool{store: store, topK: topK}
+}
+
+func (t *KnowledgeSearchTool) Name() string {
+	return "knowledge_search"
+}
+
+func (t *KnowledgeSearchTool) Description() string {
+	return "Search the user's local documents and saved notes for passages relevant to a question. Use this before answering questions about the user's own files, manuals, or previously saved information, and cite the source shown in brackets."
+}
+
+func (t *KnowledgeSearchTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"query": map[string]interface{}{
+				"type":        "string",
+				"description": "What to look for, phrased as a question or keywords",
+			},
+		},
+		"required": []string{"query"},
+	}
+}
+
+func (t *KnowledgeSearchTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	query, ok := args["query"].(string)
+	if !ok || strings.TrimSpace(query) == "" {
+		return ErrorResult("query is required")
+	}
+
+	results, err := t.store.Search(ctx, query, t.topK)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("knowledge search failed: %v", err))
+	}
+	if len(results) == 0 {
+		return SilentResult("No documents have been ingested yet.")
+	}
+
+	var sb strings.Builder
+	for i, r := range results {
+		fmt.Fprintf(&sb, "%d. [%s] (score %.2f)\n%s\n\n", i+1, r.Citation(), r.Score, r.Content)
+	}
+	return SilentResult(strings.TrimSpace(sb.String()))
+}
+
+// KnowledgeAddTool stores text shared in chat so it can be retrieved later.
+type KnowledgeAddTool struct {
+	store *rag.Store
+}
+
+func NewKnowledgeAddTool(store *rag.Store) *KnowledgeAddTool {
+	return &KnowledgeAddTool{store: store}
+}
+
+func (t *KnowledgeAddTool) Name() string {
+	return "knowledge_add"
+}
+
+func (t *KnowledgeAddTool) Description() string {
+	return "Save a document or note to the local knowledge base so it can be found later with knowledge_search. Use when the user shares reference material and asks you to remember it."
+}
+
+func (t *KnowledgeAddTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"title": map[string]interface{}{
+				"type":        "string",
+				"description": "Short unique title; saving again with the same title replaces the document",
+			},
+			"content": map[string]interface{}{
+				"type":        "string",
+				"description": "The text to store",
+			},
+		},
+		"required": []string{"title", "content"},
+	}
+}
+
+func (t *KnowledgeAddTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	title, _ := args["title"].(string)
+	content, _ := args["content"].(string)
+	if strings.TrimSpace(title) == "" || strings.TrimSpace(content) == "" {
+		return ErrorResult("title and content are required")
+	}
+
+	n, err := t.store.AddDocument(ctx, "chat:"+title, content)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to store document: %v", err))
+	}
+	return SilentResult(fmt.Sprintf("Stored %q in the knowledge base (%d chunks).", title, n))
+}
@@ -3,15 +3,28 @@ package tools
 import (
 	"context"
 	"fmt"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/templates"
 )
 
 type SendCallback func(channel, chatID, content string) error
 
+// ButtonSender delivers a message with buttons, quick replies, or a menu.
+type ButtonSender func(msg bus.OutboundMessage) error
+
+// maxButtons keeps button and quick reply sets small enough for every
+// channel's layout.
+const maxButtons = 10
+
 type MessageTool struct {
 	sendCallback   SendCallback
+	buttonSender   ButtonSender // nil disables the buttons argument
 	defaultChannel string
 	defaultChatID  string
-	sentInRound    bool // Tracks whether a message was sent in the current processing round
+	templates      *templates.Engine // nil or empty disables the template argument
+	sentInRound    bool              // Tracks whether a message was sent in the current processing round
 }
 
 func NewMessageTool() *MessageTool {
@@ -23,27 +36,105 @@ func (t *MessageTool) Name() string {
 }
 
 func (t *MessageTool) Description() string {
-	return "Send a message to user on a chat channel. Use this when you want to communicate something."
+	desc := "Send a message to user on a chat channel. Use this when you want to communicate something."
+	if t.hasTemplates() {
+		desc += " Reports and alerts can use a named template instead of content, filled in from data: " +
+			strings.Join(t.templates.Names(), ", ") + "."
+	}
+	return desc
 }
 
 func (t *MessageTool) Parameters() map[string]interface{} {
-	return map[string]interface{}{
-		"type": "object",
-		"properties": map[string]interface{}{
-			"content": map[string]interface{}{
-				"type":        "string",
-				"description": "The message content to send",
+	props := map[string]interface{}{
+		"content": map[string]interface{}{
+			"type":        "string",
+			"description": "The message content to send",
+		},
+		"channel": map[string]interface{}{
+			"type":        "string",
+			"description": "Optional: target channel (telegram, whatsapp, etc.)",
+		},
+		"chat_id": map[string]interface{}{
+			"type":        "string",
+			"description": "Optional: target chat/user ID",
+		},
+	}
+	if t.buttonSender != nil {
+		props["buttons"] = map[string]interface{}{
+			"type": "array",
+			"description": "Optional: choices shown under the message. A button with reply sends that text back " +
+				"from the user when pressed (e.g. a command); a button with url opens the link",
+			"maxItems": maxButtons,
+			"items": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"text":  map[string]interface{}{"type": "string", "description": "Button label"},
+					"reply": map[string]interface{}{"type": "string", "description": "Text sent back when pressed, at most 64 bytes"},
+					"url":   map[string]interface{}{"type": "string", "description": "Link to open instead of replying"},
+				},
+				"required": []string{"text"},
 			},
-			"channel": map[string]interface{}{
-				"type":        "string",
-				"description": "Optional: target channel (telegram, whatsapp, etc.)",
+		}
+		props["quick_replies"] = map[string]interface{}{
+			"type": "array",
+			"description": "Optional: suggested answers the user can send with one tap, e.g. yes and no. " +
+				"Each sends its reply, or its text when it has none",
+			"maxItems": maxButtons,
+			"items": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"text":  map[string]interface{}{"type": "string", "description": "Label"},
+					"reply": map[string]interface{}{"type": "string", "description": "Text sent back when picked, at most 64 bytes"},
+				},
+				"required": []string{"text"},
 			},
-			"chat_id": map[string]interface{}{
-				"type":        "string",
-				"description": "Optional: target chat/user ID",
+		}
+		props["menu"] = map[string]interface{}{
+			"type":        "object",
+			"description": "Optional: a drop-down list to pick one of many options from",
+			"properties": map[string]interface{}{
+				"placeholder": map[string]interface{}{"type": "string", "description": "Shown before anything is picked"},
+				"options": map[string]interface{}{
+					"type":     "array",
+					"maxItems": bus.MaxMenuOptions,
+					"items": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"text":  map[string]interface{}{"type": "string", "description": "Option label"},
+							"reply": map[string]interface{}{"type": "string", "description": "Text sent back when picked, at most 64 bytes"},
+						},
+						"required": []string{"text", "reply"},
+					},
+				},
 			},
-		},
-		"required": []string{"content"},
+			"required": []string{"options"},
+		}
+	}
+	if !t.hasTemplates() {
+		return map[string]interface{}{
+			"type":       "object",
+			"properties": props,
+			"required":   []string{"content"},
+		}
+	}
+
+	// content becomes optional when a template can stand in for it
+	props["content"] = map[string]interface{}{
+		"type":        "string",
+		"description": "The message content to send. Required unless template is given",
+	}
+	props["template"] = map[string]interface{}{
+		"type":        "string",
+		"description": "Optional: name of a message template to render instead of content",
+		"enum":        t.templates.Names(),
+	}
+	props["data"] = map[string]interface{}{
+		"type":        "object",
+		"description": "Optional: values for the template's fields",
+	}
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": props,
 	}
 }
 
@@ -62,12 +153,22 @@ func (t *MessageTool) SetSendCallback(callback SendCallback) {
 	t.sendCallback = callback
 }
 
-func (t *MessageTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
-	content, ok := args["content"].(string)
-	if !ok {
-		return &ToolResult{ForLLM: "content is required", IsError: true}
-	}
+// SetButtonSender enables offering buttons, quick replies, and menus with
+// a message.
+func (t *MessageTool) SetButtonSender(send ButtonSender) {
+	t.buttonSender = send
+}
 
+// SetTemplates enables sending named templates.
+func (t *MessageTool) SetTemplates(engine *templates.Engine) {
+	t.templates = engine
+}
+
+func (t *MessageTool) hasTemplates() bool {
+	return t.templates != nil && len(t.templates.Names()) > 0
+}
+
+func (t *MessageTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
 	channel, _ := args["channel"].(string)
 	chatID, _ := args["chat_id"].(string)
 
@@ -78,15 +179,39 @@ func (t *MessageTool) Execute(ctx context.Context, args map[string]interface{})
 		chatID = t.defaultChatID
 	}
 
+	content, ok := args["content"].(string)
+	if name, _ := args["template"].(string); name != "" {
+		rendered, err := t.renderTemplate(name, args["data"], channel, chatID)
+		if err != nil {
+			return &ToolResult{ForLLM: err.Error(), IsError: true, Err: err}
+		}
+		content, ok = rendered, true
+	}
+	if !ok {
+		return &ToolResult{ForLLM: "content is required", IsError: true}
+	}
+
 	if channel == "" || chatID == "" {
 		return &ToolResult{ForLLM: "No target channel/chat specified", IsError: true}
 	}
 
-	if t.sendCallback == nil {
+	msg, err := parseChoices(args)
+	if err != nil {
+		return &ToolResult{ForLLM: err.Error(), IsError: true, Err: err}
+	}
+	msg.Channel, msg.ChatID, msg.Content = channel, chatID, content
+	msg.TraceID, msg.ParentID = bus.TraceFrom(ctx)
+	interactive := len(msg.Buttons) > 0 || len(msg.QuickReplies) > 0 || msg.Menu != nil
+	// The button sender takes the whole message, so it keeps the trace
+	// also when the message goes to another chat
+	if (interactive || msg.TraceID != "") && t.buttonSender != nil {
+		err = t.buttonSender(msg)
+	} else if t.sendCallback == nil {
 		return &ToolResult{ForLLM: "Message sending not configured", IsError: true}
+	} else {
+		err = t.sendCallback(channel, chatID, content)
 	}
-
-	if err := t.sendCallback(channel, chatID, content); err != nil {
+	if err != nil {
 		return &ToolResult{
 			ForLLM:  fmt.Sprintf("sending message: %v", err),
 			IsError: true,
@@ -101,3 +226,132 @@ func (t *MessageTool) Execute(ctx context.Context, args map[string]interface{})
 		Silent: true,
 	}
 }
+
+// parseChoices reads the buttons, quick_replies, and menu arguments into an
+// outbound message. What each choice sends back must differ, so channels
+// can tell which was picked.
+func parseChoices(args map[string]interface{}) (bus.OutboundMessage, error) {
+	var msg bus.OutboundMessage
+	var err error
+	if msg.Buttons, err = parseButtons(args["buttons"]); err != nil {
+		return msg, err
+	}
+	if msg.QuickReplies, err = parseQuickReplies(args["quick_replies"]); err != nil {
+		return msg, err
+	}
+	if msg.Menu, err = parseMenu(args["menu"]); err != nil {
+		return msg, err
+	}
+	seen := make(map[string]bool)
+	for _, c := range msg.Choices() {
+		if seen[c.Data] {
+			return msg, fmt.Errorf("two choices send back %q", c.Data)
+		}
+		seen[c.Data] = true
+	}
+	return msg, nil
+}
+
+// parseQuickReplies reads the quick_replies argument. A quick reply without
+// a reply sends its text.
+func parseQuickReplies(arg interface{}) ([]bus.Button, error) {
+	items, _ := arg.([]interface{})
+	if len(items) > maxButtons {
+		return nil, fmt.Errorf("at most %d quick replies are allowed", maxButtons)
+	}
+	replies := make([]bus.Button, 0, len(items))
+	for i, item := range items {
+		m, _ := item.(map[string]interface{})
+		text, _ := m["text"].(string)
+		reply, _ := m["reply"].(string)
+		if reply == "" {
+			reply = text
+		}
+		switch {
+		case strings.TrimSpace(text) == "":
+			return nil, fmt.Errorf("quick reply %d has no text", i+1)
+		case len(reply) > bus.MaxButtonData:
+			return nil, fmt.Errorf("quick reply %q is longer than %d bytes", text, bus.MaxButtonData)
+		}
+		replies = append(replies, bus.Button{Text: text, Data: reply})
+	}
+	return replies, nil
+}
+
+// parseMenu reads the menu argument, or returns nil without one. Every
+// option needs a label and a reply.
+func parseMenu(arg interface{}) (*bus.Menu, error) {
+	m, _ := arg.(map[string]interface{})
+	if m == nil {
+		return nil, nil
+	}
+	items, _ := m["options"].([]interface{})
+	switch {
+	case len(items) == 0:
+		return nil, fmt.Errorf("menu has no options")
+	case len(items) > bus.MaxMenuOptions:
+		return nil, fmt.Errorf("at most %d menu options are allowed", bus.MaxMenuOptions)
+	}
+	placeholder, _ := m["placeholder"].(string)
+	menu := &bus.Menu{Placeholder: placeholder}
+	for i, item := range items {
+		o, _ := item.(map[string]interface{})
+		text, _ := o["text"].(string)
+		reply, _ := o["reply"].(string)
+		switch {
+		case strings.TrimSpace(text) == "":
+			return nil, fmt.Errorf("menu option %d has no text", i+1)
+		case reply == "":
+			return nil, fmt.Errorf("menu option %q needs a reply", text)
+		case len(reply) > bus.MaxButtonData:
+			return nil, fmt.Errorf("menu option %q reply is longer than %d bytes", text, bus.MaxButtonData)
+		}
+		menu.Options = append(menu.Options, bus.Button{Text: text, Data: reply})
+	}
+	return menu, nil
+}
+
+// parseButtons reads the buttons argument. Each button needs a label and
+// either a reply short enough for every channel or a URL.
+func parseButtons(arg interface{}) ([]bus.Button, error) {
+	items, _ := arg.([]interface{})
+	if len(items) > maxButtons {
+		return nil, fmt.Errorf("at most %d buttons are allowed", maxButtons)
+	}
+	buttons := make([]bus.Button, 0, len(items))
+	for i, item := range items {
+		m, _ := item.(map[string]interface{})
+		text, _ := m["text"].(string)
+		reply, _ := m["reply"].(string)
+		url, _ := m["url"].(string)
+		switch {
+		case strings.TrimSpace(text) == "":
+			return nil, fmt.Errorf("button %d has no text", i+1)
+		case (reply == "") == (url == ""):
+			return nil, fmt.Errorf("button %q needs either reply or url", text)
+		case len(reply) > bus.MaxButtonData:
+			return nil, fmt.Errorf("button %q reply is longer than %d bytes", text, bus.MaxButtonData)
+		}
+		buttons = append(buttons, bus.Button{Text: text, Data: reply, URL: url})
+	}
+	return buttons, nil
+}
+
+// renderTemplate renders a named template. The data may refer to
+// .channel and .chat_id for the target unless it sets them itself.
+func (t *MessageTool) renderTemplate(name string, data interface{}, channel, chatID string) (string, error) {
+	if t.templates == nil {
+		return "", fmt.Errorf("message templates are not configured")
+	}
+	values := map[string]interface{}{"channel": channel, "chat_id": chatID}
+	if data != nil {
+		m, ok := data.(map[string]interface{})
+		if !ok {
+			return "", fmt.Errorf("data must be an object")
+		}
+		for k, v := range m {
+			values[k] = v
+		}
+	}
+	return t.templates.Render(name, values)
+}
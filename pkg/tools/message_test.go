@@ -3,7 +3,11 @@ package tools
 import (
 	"context"
 	"errors"
+	"strings"
 	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/templates"
 )
 
 func TestMessageTool_Execute_Success(t *testing.T) {
@@ -257,3 +261,142 @@ func TestMessageTool_Parameters(t *testing.T) {
 		t.Error("Expected chat_id type to be 'string'")
 	}
 }
+
+func TestMessageTool_Template(t *testing.T) {
+	engine, err := templates.Load(map[string]string{
+		"alert": "{{bold .title}} on {{.channel}}: {{.value | number}}",
+	}, "")
+	if err != nil {
+		t.Fatalf("templates.Load() error = %v", err)
+	}
+	tool := NewMessageTool()
+	tool.SetContext("telegram", "42")
+	tool.SetTemplates(engine)
+
+	var sent string
+	tool.SetSendCallback(func(channel, chatID, content string) error {
+		sent = content
+		return nil
+	})
+
+	if _, ok := tool.Parameters()["required"]; ok {
+		t.Error("content should be optional when templates are configured")
+	}
+
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"template": "alert",
+		"data":     map[string]interface{}{"title": "Disk", "value": 12345.6},
+	})
+	if result.IsError {
+		t.Fatalf("Execute() error = %s", result.ForLLM)
+	}
+	if sent != "**Disk** on telegram: 12,345.6" {
+		t.Errorf("sent = %q", sent)
+	}
+
+	tests := []map[string]interface{}{
+		{"template": "nope"},
+		{"template": "alert", "data": map[string]interface{}{"value": 1}},
+		{"template": "alert", "data": "not an object"},
+	}
+	for _, args := range tests {
+		if result := tool.Execute(context.Background(), args); !result.IsError {
+			t.Errorf("Execute(%v) succeeded, want an error", args)
+		}
+	}
+}
+
+func TestMessageTool_Buttons(t *testing.T) {
+	tool := NewMessageTool()
+	tool.SetContext("telegram", "42")
+	if _, ok := tool.Parameters()["properties"].(map[string]interface{})["buttons"]; ok {
+		t.Error("buttons offered without a button sender")
+	}
+
+	var sent []bus.Button
+	tool.SetButtonSender(func(msg bus.OutboundMessage) error {
+		sent = msg.Buttons
+		return nil
+	})
+	if _, ok := tool.Parameters()["properties"].(map[string]interface{})["buttons"]; !ok {
+		t.Error("buttons missing from parameters")
+	}
+
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"content": "Restart the service?",
+		"buttons": []interface{}{
+			map[string]interface{}{"text": "Restart", "reply": "yes, restart it"},
+			map[string]interface{}{"text": "Runbook", "url": "https://example.com/runbook"},
+		},
+	})
+	if result.IsError {
+		t.Fatalf("Execute() error = %s", result.ForLLM)
+	}
+	want := []bus.Button{{Text: "Restart", Data: "yes, restart it"}, {Text: "Runbook", URL: "https://example.com/runbook"}}
+	if len(sent) != 2 || sent[0] != want[0] || sent[1] != want[1] {
+		t.Errorf("sent = %+v", sent)
+	}
+
+	bad := []interface{}{
+		map[string]interface{}{"reply": "no label"},
+		map[string]interface{}{"text": "Both", "reply": "x", "url": "https://example.com"},
+		map[string]interface{}{"text": "Neither"},
+		map[string]interface{}{"text": "Long", "reply": strings.Repeat("x", bus.MaxButtonData+1)},
+	}
+	for _, b := range bad {
+		args := map[string]interface{}{"content": "hi", "buttons": []interface{}{b}}
+		if result := tool.Execute(context.Background(), args); !result.IsError {
+			t.Errorf("Execute(%v) succeeded, want an error", b)
+		}
+	}
+}
+
+func TestMessageTool_QuickRepliesAndMenu(t *testing.T) {
+	tool := NewMessageTool()
+	tool.SetContext("whatsapp", "49")
+	var sent bus.OutboundMessage
+	tool.SetButtonSender(func(msg bus.OutboundMessage) error {
+		sent = msg
+		return nil
+	})
+
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"content":       "Which size?",
+		"quick_replies": []interface{}{map[string]interface{}{"text": "Not sure"}},
+		"menu": map[string]interface{}{
+			"placeholder": "Pick a size",
+			"options": []interface{}{
+				map[string]interface{}{"text": "Small", "reply": "size S"},
+				map[string]interface{}{"text": "Large", "reply": "size L"},
+			},
+		},
+	})
+	if result.IsError {
+		t.Fatalf("Execute() error = %s", result.ForLLM)
+	}
+	if sent.Channel != "whatsapp" || sent.ChatID != "49" || sent.Content != "Which size?" {
+		t.Errorf("sent to %s:%s %q", sent.Channel, sent.ChatID, sent.Content)
+	}
+	if len(sent.QuickReplies) != 1 || sent.QuickReplies[0].Data != "Not sure" {
+		t.Errorf("QuickReplies = %+v, want the text as reply", sent.QuickReplies)
+	}
+	if sent.Menu == nil || sent.Menu.Placeholder != "Pick a size" || len(sent.Menu.Options) != 2 {
+		t.Errorf("Menu = %+v", sent.Menu)
+	}
+
+	bad := []map[string]interface{}{
+		{"menu": map[string]interface{}{"options": []interface{}{}}},
+		{"menu": map[string]interface{}{"options": []interface{}{map[string]interface{}{"text": "No reply"}}}},
+		{"quick_replies": []interface{}{map[string]interface{}{"reply": "no label"}}},
+		{
+			"buttons":       []interface{}{map[string]interface{}{"text": "Yes", "reply": "yes"}},
+			"quick_replies": []interface{}{map[string]interface{}{"text": "yes"}},
+		},
+	}
+	for _, args := range bad {
+		args["content"] = "hi"
+		if result := tool.Execute(context.Background(), args); !result.IsError {
+			t.Errorf("Execute(%v) succeeded, want an error", args)
+		}
+	}
+}
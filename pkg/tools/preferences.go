@@ -0,0 +1,296 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+const (
+	maxPreferenceValueLen = 500
+	maxPreferencesPerUser = 50
+)
+
+// preferencesBucket is the state store bucket holding each identity's
+// preferences as a JSON object.
+const preferencesBucket = "preferences"
+
+// PreferenceStore keeps long-term preferences (language, timezone, name,
+// dietary constraints, ...) per person in the state store. A person is
+// "channel:sender_id" unless linked accounts share a named identity, so a
+// preference set on Telegram also applies on Discord.
+type PreferenceStore struct {
+	mu    sync.Mutex // Serializes read-modify-write updates
+	store state.Store
+	links map[string]string // "channel:sender_id" -> identity
+}
+
+// NewPreferenceStore keeps preferences in store. identities maps an
+// identity name to the "channel:sender_id" accounts that belong to it.
+func NewPreferenceStore(store state.Store, identities map[string][]string) *PreferenceStore {
+	s := &PreferenceStore{
+		store: store,
+		links: make(map[string]string),
+	}
+	for name, accounts := range identities {
+		for _, account := range accounts {
+			s.links[strings.TrimSpace(account)] = name
+		}
+	}
+	return s
+}
+
+// WithStore returns a preference store with the same identities that keeps
+// preferences in store instead.
+func (s *PreferenceStore) WithStore(store state.Store) *PreferenceStore {
+	return &PreferenceStore{store: store, links: s.links}
+}
+
+// ImportLegacyPreferences copies preferences from the JSON file used by
+// older versions into an empty store and renames the file with a
+// ".migrated" suffix.
+func ImportLegacyPreferences(store state.Store, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	ctx := context.Background()
+	if existing, err := store.List(ctx, preferencesBucket); err != nil || len(existing) > 0 {
+		return err
+	}
+
+	var legacy map[string]map[string]string
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return fmt.Errorf("failed to parse preferences: %w", err)
+	}
+	for identity, prefs := range legacy {
+		if err := state.PutJSON(ctx, store, preferencesBucket, identity, prefs); err != nil {
+			return err
+		}
+	}
+	return os.Rename(path, path+".migrated")
+}
+
+// Identity resolves the person behind a sender. Channels that report
+// composite sender IDs ("123|username") match a link on any part.
+func (s *PreferenceStore) Identity(channel, senderID string) string {
+	if name, ok := s.links[channel+":"+senderID]; ok {
+		return name
+	}
+	for _, part := range strings.Split(senderID, "|") {
+		if name, ok := s.links[channel+":"+part]; ok {
+			return name
+		}
+	}
+	return channel + ":" + senderID
+}
+
+// Get returns identity's preferences. A store error is logged and yields
+// no preferences, so a turn never fails on them.
+func (s *PreferenceStore) Get(identity string) map[string]string {
+	prefs, err := s.load(identity)
+	if err != nil {
+		logger.WarnCF("preferences", "Failed to load preferences",
+			map[string]interface{}{"identity": identity, "error": err.Error()})
+	}
+	return prefs
+}
+
+func (s *PreferenceStore) load(identity string) (map[string]string, error) {
+	prefs := make(map[string]string)
+	err := state.GetJSON(context.Background(), s.store, preferencesBucket, identity, &prefs)
+	if errors.Is(err, state.ErrNotFound) {
+		return prefs, nil
+	}
+	return prefs, err
+}
+
+// Set stores one preference.
+func (s *PreferenceStore) Set(identity, key, value string) error {
+	key = normalizePreferenceKey(key)
+	value = strings.TrimSpace(value)
+	if key == "" {
+		return fmt.Errorf("key is required")
+	}
+	if value == "" {
+		return fmt.Errorf("value is required")
+	}
+	if len(value) > maxPreferenceValueLen {
+		return fmt.Errorf("value is too long (max %d characters)", maxPreferenceValueLen)
+	}
+	if key == "timezone" {
+		if _, err := time.LoadLocation(value); err != nil {
+			return fmt.Errorf("unknown timezone %q, use an IANA name such as Europe/Berlin", value)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prefs, err := s.load(identity)
+	if err != nil {
+		return err
+	}
+	if _, exists := prefs[key]; !exists && len(prefs) >= maxPreferencesPerUser {
+		return fmt.Errorf("too many preferences (max %d), delete one first", maxPreferencesPerUser)
+	}
+	prefs[key] = value
+	return state.PutJSON(context.Background(), s.store, preferencesBucket, identity, prefs)
+}
+
+// Delete removes one preference. It reports whether the key existed.
+func (s *PreferenceStore) Delete(identity, key string) (bool, error) {
+	key = normalizePreferenceKey(key)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prefs, err := s.load(identity)
+	if err != nil {
+		return false, err
+	}
+	if _, ok := prefs[key]; !ok {
+		return false, nil
+	}
+	delete(prefs, key)
+	ctx := context.Background()
+	if len(prefs) == 0 {
+		return true, s.store.Delete(ctx, preferencesBucket, identity)
+	}
+	return true, state.PutJSON(ctx, s.store, preferencesBucket, identity, prefs)
+}
+
+// FormatPreferences renders preferences as sorted "key: value" lines.
+func FormatPreferences(prefs map[string]string) string {
+	keys := make([]string, 0, len(prefs))
+	for k := range prefs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&sb, "- %s: %s\n", k, prefs[k])
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+// normalizePreferenceKey lowercases a key and joins words with underscores,
+// so "Preferred Language" and "preferred_language" are the same entry.
+func normalizePreferenceKey(key string) string {
+	fields := strings.FieldsFunc(strings.ToLower(key), func(r rune) bool {
+		return r == ' ' || r == '-' || r == '_'
+	})
+	return strings.Join(fields, "_")
+}
+
+// PreferencesTool lets the agent read and update the current user's
+// long-term preferences.
+type PreferencesTool struct {
+	store    *PreferenceStore
+	mu       sync.RWMutex
+	channel  string
+	senderID string
+}
+
+func NewPreferencesTool(store *PreferenceStore) *PreferencesTool {
+	return &PreferencesTool{store: store}
+}
+
+func (t *PreferencesTool) Name() string {
+	return "preferences"
+}
+
+func (t *PreferencesTool) Description() string {
+	return "Remember or look up the current user's long-term preferences, such as name, language, timezone, units, or dietary constraints. Save a preference when the user states one; they are shown to you at the start of every conversation."
+}
+
+func (t *PreferencesTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"get", "set", "delete"},
+				"description": "get lists the user's preferences, set saves one, delete removes one",
+			},
+			"key": map[string]interface{}{
+				"type":        "string",
+				"description": "Preference name, e.g. name, language, timezone, dietary",
+			},
+			"value": map[string]interface{}{
+				"type":        "string",
+				"description": "Preference value for set. Timezones use IANA names such as Europe/Berlin",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+// SetSender sets whose preferences the tool reads and writes.
+func (t *PreferencesTool) SetSender(channel, senderID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.channel = channel
+	t.senderID = senderID
+}
+
+func (t *PreferencesTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	t.mu.RLock()
+	channel, senderID := t.channel, t.senderID
+	t.mu.RUnlock()
+	if senderID == "" {
+		return ErrorResult("no user in the current context")
+	}
+	identity := t.store.Identity(channel, senderID)
+
+	action, _ := args["action"].(string)
+	key, _ := args["key"].(string)
+	value, _ := args["value"].(string)
+
+	switch action {
+	case "get":
+		prefs := t.store.Get(identity)
+		if key != "" {
+			if v, ok := prefs[normalizePreferenceKey(key)]; ok {
+				return SilentResult(fmt.Sprintf("%s: %s", normalizePreferenceKey(key), v))
+			}
+			return SilentResult(fmt.Sprintf("No preference %q saved.", key))
+		}
+		if len(prefs) == 0 {
+			return SilentResult("No preferences saved for this user.")
+		}
+		return SilentResult(FormatPreferences(prefs))
+	case "set":
+		if err := t.store.Set(identity, key, value); err != nil {
+			return ErrorResult(err.Error())
+		}
+		return SilentResult(fmt.Sprintf("Saved %s.", normalizePreferenceKey(key)))
+	case "delete":
+		if key == "" {
+			return ErrorResult("key is required")
+		}
+		ok, err := t.store.Delete(identity, key)
+		if err != nil {
+			return ErrorResult(err.Error()).WithError(err)
+		}
+		if !ok {
+			return SilentResult(fmt.Sprintf("No preference %q saved.", key))
+		}
+		return SilentResult(fmt.Sprintf("Deleted %s.", normalizePreferenceKey(key)))
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action %q, use get, set, or delete", action))
+	}
+}
@@ -0,0 +1,122 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/state"
+)
+
+func TestPreferenceStore_Identity(t *testing.T) {
+	s := NewPreferenceStore(state.NewMemoryStore(), map[string][]string{
+		"alice": {"telegram:123", "discord:987"},
+	})
+
+	tests := []struct {
+		channel, sender, want string
+	}{
+		{"telegram", "123", "alice"},
+		{"telegram", "123|alice_tg", "alice"},
+		{"discord", "987", "alice"},
+		{"discord", "123", "discord:123"},
+		{"slack", "U1", "slack:U1"},
+	}
+	for _, tt := range tests {
+		if got := s.Identity(tt.channel, tt.sender); got != tt.want {
+			t.Errorf("Identity(%q, %q) = %q, want %q", tt.channel, tt.sender, got, tt.want)
+		}
+	}
+}
+
+func TestPreferenceStore_PersistsAcrossRestarts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+	store, err := state.OpenSQLite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewPreferenceStore(store, nil)
+	if err := s.Set("alice", "Preferred Language", "German"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set("alice", "timezone", "Asia/Tokyo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set("alice", "timezone", "Mars/Olympus"); err == nil {
+		t.Error("expected invalid timezone to be rejected")
+	}
+
+	store.Close()
+
+	store, err = state.OpenSQLite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	reloaded := NewPreferenceStore(store, nil)
+	prefs := reloaded.Get("alice")
+	if prefs["preferred_language"] != "German" || prefs["timezone"] != "Asia/Tokyo" {
+		t.Fatalf("unexpected preferences after reload: %v", prefs)
+	}
+
+	if ok, err := reloaded.Delete("alice", "preferred-language"); !ok || err != nil {
+		t.Fatalf("Delete = %v, %v", ok, err)
+	}
+	if ok, _ := reloaded.Delete("alice", "preferred_language"); ok {
+		t.Error("deleting a missing key should report false")
+	}
+}
+
+func TestImportLegacyPreferences(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "preferences.json")
+	if err := os.WriteFile(path, []byte(`{"alice":{"timezone":"Asia/Tokyo"}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	store := state.NewMemoryStore()
+	if err := ImportLegacyPreferences(store, path); err != nil {
+		t.Fatalf("ImportLegacyPreferences() error = %v", err)
+	}
+	if got := NewPreferenceStore(store, nil).Get("alice")["timezone"]; got != "Asia/Tokyo" {
+		t.Errorf("imported timezone = %q", got)
+	}
+	if _, err := os.Stat(path + ".migrated"); err != nil {
+		t.Errorf("legacy file not renamed: %v", err)
+	}
+}
+
+func TestPreferencesTool(t *testing.T) {
+	s := NewPreferenceStore(state.NewMemoryStore(), nil)
+	tool := NewPreferencesTool(s)
+	ctx := context.Background()
+
+	if r := tool.Execute(ctx, map[string]interface{}{"action": "get"}); !r.IsError {
+		t.Error("expected error without a sender")
+	}
+
+	tool.SetSender("telegram", "42")
+	r := tool.Execute(ctx, map[string]interface{}{"action": "set", "key": "dietary", "value": "vegetarian"})
+	if r.IsError {
+		t.Fatalf("set failed: %s", r.ForLLM)
+	}
+	r = tool.Execute(ctx, map[string]interface{}{"action": "get"})
+	if !strings.Contains(r.ForLLM, "dietary: vegetarian") {
+		t.Errorf("get = %q", r.ForLLM)
+	}
+	if got := s.Get("telegram:42")["dietary"]; got != "vegetarian" {
+		t.Errorf("stored value = %q", got)
+	}
+
+	// Other senders have their own preferences
+	tool.SetSender("telegram", "43")
+	r = tool.Execute(ctx, map[string]interface{}{"action": "get"})
+	if strings.Contains(r.ForLLM, "vegetarian") {
+		t.Error("preferences leaked to another sender")
+	}
+
+	if r := tool.Execute(ctx, map[string]interface{}{"action": "nope"}); !r.IsError {
+		t.Error("expected error for unknown action")
+	}
+}
@@ -0,0 +1,219 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/contacts"
+)
+
+// PresenceWatcher watches users come online, as the channel manager does.
+type PresenceWatcher interface {
+	SubscribePresence(ctx context.Context, w bus.PresenceWatch) (bus.PresenceWatch, error)
+	UnsubscribePresence(ctx context.Context, channel, userID string) error
+	PresenceWatches() []bus.PresenceWatch
+}
+
+// PresenceHistory tells when users were last online, as
+// contacts.Directory does when presence tracking is on.
+type PresenceHistory interface {
+	LastSeen(ctx context.Context, channel, id string) (contacts.Seen, bool, error)
+}
+
+// PresenceTool watches contacts' presence, e.g. to tell the user when
+// someone comes online. Notifications go to the chat the watch was set up
+// from. Only operators may watch or unwatch, and list shows the watches
+// that notify the current chat.
+type PresenceTool struct {
+	watcher   PresenceWatcher
+	history   PresenceHistory // nil unless SetHistory
+	operators map[string]bool // "channel:senderID"
+	channel   string
+	chatID    string
+	senderID  string
+}
+
+func NewPresenceTool(watcher PresenceWatcher) *PresenceTool {
+	return &PresenceTool{watcher: watcher, operators: map[string]bool{}}
+}
+
+// SetOperators sets who may watch and unwatch contacts, as admin.operators
+// entries ("telegram:123456").
+func (t *PresenceTool) SetOperators(operators []string) {
+	t.operators = map[string]bool{}
+	for _, op := range operators {
+		if op = strings.TrimSpace(op); op != "" {
+			t.operators[op] = true
+		}
+	}
+}
+
+// SetHistory enables the last_seen action.
+func (t *PresenceTool) SetHistory(history PresenceHistory) {
+	t.history = history
+}
+
+func (t *PresenceTool) Name() string {
+	return "presence"
+}
+
+func (t *PresenceTool) Description() string {
+	return "Watch when contacts come online, where the chat platform shares it (WhatsApp contacts who allow it). " +
+		"Use action 'watch' when the user asks to be told when someone comes online; " +
+		"this chat gets a message each time they do. 'unwatch' stops it and 'list' shows who is watched for this chat. " +
+		"Only admin operators may watch or unwatch. " +
+		"'last_seen' tells when a watched contact was last online, e.g. for \"when was Mom last online?\"."
+}
+
+func (t *PresenceTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"action": map[string]interface{}{
+				"type":        "string",
+				"enum":        []string{"watch", "unwatch", "list", "last_seen"},
+				"description": "What to do",
+			},
+			"user_id": map[string]interface{}{
+				"type":        "string",
+				"description": "For watch/unwatch/last_seen: the contact's user ID or phone number with country code; unwatch and last_seen also take the name given when watching",
+			},
+			"name": map[string]interface{}{
+				"type":        "string",
+				"description": "For watch: how to refer to the contact in notifications, e.g. Dad",
+			},
+			"channel": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional: the channel the contact is on; defaults to this chat's channel",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *PresenceTool) SetContext(channel, chatID string) {
+	t.channel = channel
+	t.chatID = chatID
+}
+
+func (t *PresenceTool) SetSender(channel, senderID string) {
+	t.senderID = senderID
+}
+
+// isOperator reports whether the current sender is an operator. Composite
+// sender IDs ("123|username") match on any part; a sender the message only
+// claimed never does.
+func (t *PresenceTool) isOperator() bool {
+	if bus.IsClaimedSender(t.senderID) {
+		return false
+	}
+	for _, id := range append([]string{t.senderID}, strings.Split(t.senderID, "|")...) {
+		if id != "" && t.operators[t.channel+":"+id] {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *PresenceTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	action, _ := args["action"].(string)
+	userID, _ := args["user_id"].(string)
+	userID = strings.TrimSpace(userID)
+	channel, _ := args["channel"].(string)
+	if channel == "" {
+		channel = t.channel
+	}
+
+	if (action == "watch" || action == "unwatch") && !t.isOperator() {
+		return ErrorResult("only an admin operator may " + action + " contacts")
+	}
+
+	switch action {
+	case "watch":
+		if userID == "" {
+			return ErrorResult("user_id is required to watch")
+		}
+		name, _ := args["name"].(string)
+		w, err := t.watcher.SubscribePresence(ctx, bus.PresenceWatch{
+			Channel:       channel,
+			UserID:        userID,
+			Name:          strings.TrimSpace(name),
+			NotifyChannel: t.channel,
+			NotifyChatID:  t.chatID,
+		})
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("watching presence: %v", err)).WithError(err)
+		}
+		return SilentResult(fmt.Sprintf("Watching %s on %s; this chat is told when they come online", w.UserID, w.Channel))
+	case "unwatch":
+		if userID == "" {
+			return ErrorResult("user_id is required to unwatch")
+		}
+		userID, _ = t.watched(channel, userID)
+		if err := t.watcher.UnsubscribePresence(ctx, channel, userID); err != nil {
+			return ErrorResult(fmt.Sprintf("unwatching presence: %v", err)).WithError(err)
+		}
+		return SilentResult(fmt.Sprintf("Stopped watching %s on %s", userID, channel))
+	case "list":
+		var sb strings.Builder
+		for _, w := range t.watcher.PresenceWatches() {
+			if w.NotifyChannel != t.channel || w.NotifyChatID != t.chatID {
+				continue
+			}
+			fmt.Fprintf(&sb, "- %s on %s", w.UserID, w.Channel)
+			if w.Name != "" {
+				fmt.Fprintf(&sb, " (%s)", w.Name)
+			}
+			sb.WriteString("\n")
+		}
+		if sb.Len() == 0 {
+			return SilentResult("No contacts are watched for this chat")
+		}
+		return SilentResult(sb.String())
+	case "last_seen":
+		return t.lastSeen(ctx, channel, userID)
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action %q", action))
+	}
+}
+
+// watched matches userID to a watch on channel as saved, by name or phone
+// number too, and returns the watch's user ID and name. It returns userID
+// as given when no watch matches.
+func (t *PresenceTool) watched(channel, userID string) (string, string) {
+	phone := strings.TrimPrefix(userID, "+")
+	for _, w := range t.watcher.PresenceWatches() {
+		if w.Channel == channel && (w.UserID == userID || strings.EqualFold(w.Name, userID) || strings.HasPrefix(w.UserID, phone+"@")) {
+			return w.UserID, w.Name
+		}
+	}
+	return userID, ""
+}
+
+func (t *PresenceTool) lastSeen(ctx context.Context, channel, userID string) *ToolResult {
+	if t.history == nil {
+		return ErrorResult("last seen times are not recorded; enable contacts.presence in the config")
+	}
+	if userID == "" {
+		return ErrorResult("user_id is required for last_seen")
+	}
+	userID, name := t.watched(channel, userID)
+	if name == "" {
+		name = userID
+	}
+	seen, ok, err := t.history.LastSeen(ctx, channel, userID)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("looking up last seen: %v", err)).WithError(err)
+	}
+	if !ok {
+		return SilentResult(fmt.Sprintf("No presence is recorded for %s on %s. It is only recorded for watched contacts who share it and have not opted out.", name, channel))
+	}
+	if seen.Online {
+		return SilentResult(fmt.Sprintf("%s is online now (since %s)", name, seen.LastSeen.Format(time.RFC1123)))
+	}
+	return SilentResult(fmt.Sprintf("%s was last online %s (%s ago)", name, seen.LastSeen.Format(time.RFC1123),
+		time.Since(seen.LastSeen).Round(time.Minute)))
+}
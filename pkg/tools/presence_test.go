@@ -0,0 +1,133 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/contacts"
+)
+
+type fakePresenceWatcher struct {
+	watches []bus.PresenceWatch
+}
+
+func (f *fakePresenceWatcher) SubscribePresence(_ context.Context, w bus.PresenceWatch) (bus.PresenceWatch, error) {
+	if w.Channel != "whatsapp" {
+		return w, fmt.Errorf("channel %s does not report presence", w.Channel)
+	}
+	w.UserID = strings.TrimPrefix(w.UserID, "+") + "@s.whatsapp.net"
+	f.watches = append(f.watches, w)
+	return w, nil
+}
+
+func (f *fakePresenceWatcher) UnsubscribePresence(_ context.Context, channel, userID string) error {
+	for i, w := range f.watches {
+		if w.Channel == channel && w.UserID == userID {
+			f.watches = append(f.watches[:i], f.watches[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is not watched on %s", userID, channel)
+}
+
+func (f *fakePresenceWatcher) PresenceWatches() []bus.PresenceWatch {
+	return f.watches
+}
+
+func TestPresenceTool(t *testing.T) {
+	watcher := &fakePresenceWatcher{}
+	tool := NewPresenceTool(watcher)
+	tool.SetOperators([]string{"whatsapp:123@s.whatsapp.net"})
+	tool.SetContext("whatsapp", "456@g.us")
+	tool.SetSender("whatsapp", "789@s.whatsapp.net")
+	ctx := context.Background()
+
+	if result := tool.Execute(ctx, map[string]interface{}{"action": "watch", "user_id": "+4915"}); !result.IsError {
+		t.Errorf("watch by a non-operator = %q, want an error", result.ForLLM)
+	}
+	tool.SetContext("whatsapp", "123@s.whatsapp.net")
+	tool.SetSender("whatsapp", "123@s.whatsapp.net")
+	result := tool.Execute(ctx, map[string]interface{}{"action": "watch", "user_id": "+4915", "name": "Dad"})
+	if result.IsError {
+		t.Fatalf("watch: %s", result.ForLLM)
+	}
+	want := bus.PresenceWatch{Channel: "whatsapp", UserID: "4915@s.whatsapp.net", Name: "Dad",
+		NotifyChannel: "whatsapp", NotifyChatID: "123@s.whatsapp.net"}
+	if len(watcher.watches) != 1 || watcher.watches[0] != want {
+		t.Fatalf("watches = %+v, want %+v", watcher.watches, want)
+	}
+
+	result = tool.Execute(ctx, map[string]interface{}{"action": "list"})
+	if !strings.Contains(result.ForLLM, "4915@s.whatsapp.net on whatsapp (Dad)") || strings.Contains(result.ForLLM, "123@") {
+		t.Errorf("list = %q", result.ForLLM)
+	}
+	// Other chats see only their own watches
+	tool.SetContext("whatsapp", "456@g.us")
+	if result := tool.Execute(ctx, map[string]interface{}{"action": "list"}); strings.Contains(result.ForLLM, "4915") {
+		t.Errorf("list in another chat = %q", result.ForLLM)
+	}
+	tool.SetContext("whatsapp", "123@s.whatsapp.net")
+
+	tests := []struct {
+		name    string
+		args    map[string]interface{}
+		wantErr bool
+	}{
+		{"unsupported channel", map[string]interface{}{"action": "watch", "user_id": "1", "channel": "telegram"}, true},
+		{"watch without user", map[string]interface{}{"action": "watch"}, true},
+		{"unwatch by name", map[string]interface{}{"action": "unwatch", "user_id": "dad"}, false},
+		{"unwatch again", map[string]interface{}{"action": "unwatch", "user_id": "+4915"}, true},
+		{"unknown action", map[string]interface{}{"action": "poke"}, true},
+	}
+	for _, tt := range tests {
+		if result := tool.Execute(ctx, tt.args); result.IsError != tt.wantErr {
+			t.Errorf("%s: IsError = %v: %s", tt.name, result.IsError, result.ForLLM)
+		}
+	}
+	if len(watcher.watches) != 0 {
+		t.Errorf("watches left = %+v", watcher.watches)
+	}
+}
+
+type fakePresenceHistory map[string]contacts.Seen
+
+func (f fakePresenceHistory) LastSeen(_ context.Context, channel, id string) (contacts.Seen, bool, error) {
+	s, ok := f[channel+":"+id]
+	return s, ok, nil
+}
+
+func TestPresenceToolLastSeen(t *testing.T) {
+	watcher := &fakePresenceWatcher{watches: []bus.PresenceWatch{{Channel: "whatsapp", UserID: "4915@s.whatsapp.net", Name: "Mom"}}}
+	tool := NewPresenceTool(watcher)
+	tool.SetContext("whatsapp", "123@s.whatsapp.net")
+	ctx := context.Background()
+
+	if result := tool.Execute(ctx, map[string]interface{}{"action": "last_seen", "user_id": "Mom"}); !result.IsError {
+		t.Errorf("last_seen without tracking = %q, want an error", result.ForLLM)
+	}
+
+	seen := time.Now().Add(-3 * time.Hour)
+	tool.SetHistory(fakePresenceHistory{
+		"whatsapp:4915@s.whatsapp.net": {Channel: "whatsapp", ID: "4915@s.whatsapp.net", LastSeen: seen},
+		"whatsapp:4916@s.whatsapp.net": {Channel: "whatsapp", ID: "4916@s.whatsapp.net", Online: true, LastSeen: seen},
+	})
+	tests := []struct {
+		userID string
+		want   string
+	}{
+		{"mom", "Mom was last online " + seen.Format(time.RFC1123) + " (3h0m0s ago)"},
+		{"+4915", "Mom was last online"},
+		{"4916@s.whatsapp.net", "4916@s.whatsapp.net is online now"},
+		{"4917@s.whatsapp.net", "No presence is recorded for 4917@s.whatsapp.net"},
+	}
+	for _, tt := range tests {
+		result := tool.Execute(ctx, map[string]interface{}{"action": "last_seen", "user_id": tt.userID})
+		if result.IsError || !strings.Contains(result.ForLLM, tt.want) {
+			t.Errorf("last_seen %s = %q, want %q", tt.userID, result.ForLLM, tt.want)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+// ReactSender delivers a reaction to a message in a chat.
+type ReactSender func(channel, chatID string, reaction bus.Reaction) error
+
+// ReactTool adds and removes the bot's emoji reactions, by default on the
+// message being handled, e.g. ✅ once a requested task is done.
+type ReactTool struct {
+	send      ReactSender
+	channel   string
+	chatID    string
+	messageID string
+	senderID  string
+}
+
+func NewReactTool(send ReactSender) *ReactTool {
+	return &ReactTool{send: send}
+}
+
+func (t *ReactTool) Name() string {
+	return "react"
+}
+
+func (t *ReactTool) Description() string {
+	return "React to a chat message with an emoji, by default the user's message being handled. " +
+		"Use it to acknowledge without a reply, e.g. ✅ when a requested task is done or ❌ when it failed. " +
+		"Channels that cannot react ignore it."
+}
+
+func (t *ReactTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"emoji": map[string]interface{}{
+				"type":        "string",
+				"description": "The emoji to react with, e.g. ✅",
+			},
+			"message_id": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional: ID of another message in this chat to react to",
+			},
+			"remove": map[string]interface{}{
+				"type":        "boolean",
+				"description": "Optional: take the reaction back instead of adding it",
+			},
+		},
+		"required": []string{"emoji"},
+	}
+}
+
+func (t *ReactTool) SetMessage(channel, chatID, messageID, senderID string) {
+	t.channel = channel
+	t.chatID = chatID
+	t.messageID = messageID
+	t.senderID = senderID
+}
+
+func (t *ReactTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	emoji, _ := args["emoji"].(string)
+	emoji = strings.TrimSpace(emoji)
+	if emoji == "" {
+		return ErrorResult("emoji is required")
+	}
+	remove, _ := args["remove"].(bool)
+
+	reaction := bus.Reaction{MessageID: t.messageID, Emoji: emoji, Remove: remove, Author: t.senderID}
+	if id, _ := args["message_id"].(string); id != "" && id != t.messageID {
+		// Whoever wrote another message, it was not necessarily this sender
+		reaction.MessageID, reaction.Author = id, ""
+	}
+	if t.channel == "" || t.chatID == "" || reaction.MessageID == "" {
+		return ErrorResult("No message to react to")
+	}
+
+	if err := t.send(t.channel, t.chatID, reaction); err != nil {
+		return ErrorResult(fmt.Sprintf("reacting: %v", err)).WithError(err)
+	}
+	if remove {
+		return SilentResult(fmt.Sprintf("Removed reaction %s", emoji))
+	}
+	return SilentResult(fmt.Sprintf("Reacted with %s", emoji))
+}
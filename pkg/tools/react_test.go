@@ -0,0 +1,55 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+)
+
+func TestReactTool(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    map[string]interface{}
+		want    bus.Reaction
+		wantErr bool
+	}{
+		{"current message", map[string]interface{}{"emoji": "✅"},
+			bus.Reaction{MessageID: "100", Emoji: "✅", Author: "7"}, false},
+		{"remove", map[string]interface{}{"emoji": "👀", "remove": true},
+			bus.Reaction{MessageID: "100", Emoji: "👀", Remove: true, Author: "7"}, false},
+		{"other message", map[string]interface{}{"emoji": "❌", "message_id": "99"},
+			bus.Reaction{MessageID: "99", Emoji: "❌"}, false},
+		{"no emoji", map[string]interface{}{"emoji": " "}, bus.Reaction{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got bus.Reaction
+			tool := NewReactTool(func(channel, chatID string, reaction bus.Reaction) error {
+				if channel != "telegram" || chatID != "42" {
+					t.Errorf("sent to %s:%s", channel, chatID)
+				}
+				got = reaction
+				return nil
+			})
+			tool.SetMessage("telegram", "42", "100", "7")
+
+			result := tool.Execute(context.Background(), tt.args)
+			if result.IsError != tt.wantErr {
+				t.Fatalf("IsError = %v: %s", result.IsError, result.ForLLM)
+			}
+			if !tt.wantErr && (got != tt.want || !result.Silent) {
+				t.Errorf("reaction = %+v, silent = %v; want %+v", got, result.Silent, tt.want)
+			}
+		})
+	}
+}
+
+func TestReactToolWithoutMessage(t *testing.T) {
+	tool := NewReactTool(func(string, string, bus.Reaction) error { return errors.New("unreachable") })
+	tool.SetMessage("cli", "direct", "", "cron")
+	if result := tool.Execute(context.Background(), map[string]interface{}{"emoji": "✅"}); !result.IsError {
+		t.Errorf("Execute() = %+v, want an error", result)
+	}
+}
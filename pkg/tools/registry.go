@@ -3,9 +3,11 @@ package tools
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/logger"
 	"github.com/sipeed/picoclaw/pkg/providers"
 )
@@ -27,6 +29,13 @@ func (r *ToolRegistry) Register(tool Tool) {
 	r.tools[tool.Name()] = tool
 }
 
+// Unregister removes a tool by name.
+func (r *ToolRegistry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.tools, name)
+}
+
 func (r *ToolRegistry) Get(name string) (Tool, bool) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
@@ -43,20 +52,31 @@ func (r *ToolRegistry) Execute(ctx context.Context, name string, args map[string
 // the callback will be set on the tool before execution.
 func (r *ToolRegistry) ExecuteWithContext(ctx context.Context, name string, args map[string]interface{}, channel, chatID string, asyncCallback AsyncCallback) *ToolResult {
 	logger.InfoCF("tool", "Tool execution started",
-		map[string]interface{}{
+		bus.TraceFields(ctx, map[string]interface{}{
 			"tool": name,
 			"args": args,
-		})
+		}))
 
 	tool, ok := r.Get(name)
 	if !ok {
 		logger.ErrorCF("tool", "Tool not found",
-			map[string]interface{}{
+			bus.TraceFields(ctx, map[string]interface{}{
 				"tool": name,
-			})
+			}))
 		return ErrorResult(fmt.Sprintf("tool %q not found", name)).WithError(fmt.Errorf("tool not found"))
 	}
 
+	// Reject malformed calls before they reach the tool; the error goes back
+	// to the LLM so it can retry with corrected arguments.
+	if err := ValidateArgs(tool.Parameters(), args); err != nil {
+		logger.WarnCF("tool", "Invalid tool arguments",
+			bus.TraceFields(ctx, map[string]interface{}{
+				"tool":  name,
+				"error": err.Error(),
+			}))
+		return ErrorResult(fmt.Sprintf("invalid arguments for %s: %v", name, err)).WithError(err)
+	}
+
 	// If tool implements ContextualTool, set context
 	if contextualTool, ok := tool.(ContextualTool); ok && channel != "" && chatID != "" {
 		contextualTool.SetContext(channel, chatID)
@@ -66,9 +86,9 @@ func (r *ToolRegistry) ExecuteWithContext(ctx context.Context, name string, args
 	if asyncTool, ok := tool.(AsyncTool); ok && asyncCallback != nil {
 		asyncTool.SetCallback(asyncCallback)
 		logger.DebugCF("tool", "Async callback injected",
-			map[string]interface{}{
+			bus.TraceFields(ctx, map[string]interface{}{
 				"tool": name,
-			})
+			}))
 	}
 
 	start := time.Now()
@@ -78,24 +98,24 @@ func (r *ToolRegistry) ExecuteWithContext(ctx context.Context, name string, args
 	// Log based on result type
 	if result.IsError {
 		logger.ErrorCF("tool", "Tool execution failed",
-			map[string]interface{}{
+			bus.TraceFields(ctx, map[string]interface{}{
 				"tool":     name,
 				"duration": duration.Milliseconds(),
 				"error":    result.ForLLM,
-			})
+			}))
 	} else if result.Async {
 		logger.InfoCF("tool", "Tool started (async)",
-			map[string]interface{}{
+			bus.TraceFields(ctx, map[string]interface{}{
 				"tool":     name,
 				"duration": duration.Milliseconds(),
-			})
+			}))
 	} else {
 		logger.InfoCF("tool", "Tool execution completed",
-			map[string]interface{}{
+			bus.TraceFields(ctx, map[string]interface{}{
 				"tool":          name,
 				"duration_ms":   duration.Milliseconds(),
 				"result_length": len(result.ForLLM),
-			})
+			}))
 	}
 
 	return result
@@ -118,9 +138,17 @@ func (r *ToolRegistry) ToProviderDefs() []providers.ToolDefinition {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
+	// Sorted so the request is stable across calls (helps provider-side
+	// prompt caching and makes logs comparable).
+	names := make([]string, 0, len(r.tools))
+	for name := range r.tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
 	definitions := make([]providers.ToolDefinition, 0, len(r.tools))
-	for _, tool := range r.tools {
-		schema := ToolToSchema(tool)
+	for _, name := range names {
+		schema := ToolToSchema(r.tools[name])
 
 		// Safely extract nested values with type checks
 		fn, ok := schema["function"].(map[string]interface{})
@@ -128,7 +156,6 @@ func (r *ToolRegistry) ToProviderDefs() []providers.ToolDefinition {
 			continue
 		}
 
-		name, _ := fn["name"].(string)
 		desc, _ := fn["description"].(string)
 		params, _ := fn["parameters"].(map[string]interface{})
 
@@ -0,0 +1,172 @@
+package tools
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// ValidateArgs checks args against a tool's JSON-schema parameters: required
+// properties, primitive types, and enums. Nested objects and array items are
+// validated when they declare their own schema. The error text is written
+// for the LLM so it can correct the call.
+func ValidateArgs(schema map[string]interface{}, args map[string]interface{}) error {
+	return validateObject("", schema, args)
+}
+
+func validateObject(path string, schema map[string]interface{}, obj map[string]interface{}) error {
+	properties, _ := schema["properties"].(map[string]interface{})
+
+	for _, name := range requiredNames(schema["required"]) {
+		if _, ok := obj[name]; !ok {
+			return fmt.Errorf("missing required parameter %q", joinPath(path, name))
+		}
+	}
+
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		propSchema, ok := properties[name].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if err := validateValue(joinPath(path, name), propSchema, obj[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateValue(path string, schema map[string]interface{}, value interface{}) error {
+	if value == nil {
+		return nil
+	}
+
+	if typ, ok := schema["type"].(string); ok {
+		if !matchesType(typ, value) {
+			return fmt.Errorf("parameter %q must be of type %s, got %s", path, typ, jsonTypeName(value))
+		}
+	}
+
+	if allowed := enumValues(schema["enum"]); len(allowed) > 0 {
+		found := false
+		for _, e := range allowed {
+			if e == fmt.Sprintf("%v", value) {
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("parameter %q must be one of [%s]", path, strings.Join(allowed, ", "))
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if _, ok := schema["properties"]; ok {
+			return validateObject(path, schema, v)
+		}
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				if err := validateValue(fmt.Sprintf("%s[%d]", path, i), items, item); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func matchesType(typ string, value interface{}) bool {
+	switch typ {
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "number":
+		switch value.(type) {
+		case float64, float32, int, int64:
+			return true
+		}
+		return false
+	case "integer":
+		switch v := value.(type) {
+		case int, int64:
+			return true
+		case float64:
+			return v == math.Trunc(v)
+		}
+		return false
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	}
+	return true
+}
+
+func jsonTypeName(value interface{}) string {
+	switch value.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64, float32, int, int64:
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// requiredNames accepts both []string (as written in Go tool definitions)
+// and []interface{} (as decoded from JSON).
+func requiredNames(v interface{}) []string {
+	switch r := v.(type) {
+	case []string:
+		return r
+	case []interface{}:
+		names := make([]string, 0, len(r))
+		for _, n := range r {
+			if s, ok := n.(string); ok {
+				names = append(names, s)
+			}
+		}
+		return names
+	}
+	return nil
+}
+
+// enumValues accepts an enum as []string (as written in Go tool
+// definitions) or []interface{} (as decoded from JSON).
+func enumValues(v interface{}) []string {
+	switch e := v.(type) {
+	case []string:
+		return e
+	case []interface{}:
+		values := make([]string, 0, len(e))
+		for _, x := range e {
+			values = append(values, fmt.Sprintf("%v", x))
+		}
+		return values
+	}
+	return nil
+}
+
+func joinPath(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
@@ -0,0 +1,80 @@
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestValidateArgs(t *testing.T) {
+	schema := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"query": map[string]interface{}{"type": "string"},
+			"count": map[string]interface{}{"type": "integer"},
+			"mode":  map[string]interface{}{"type": "string", "enum": []interface{}{"fast", "full"}},
+			"unit":  map[string]interface{}{"type": "string", "enum": []string{"c", "f"}},
+			"tags": map[string]interface{}{
+				"type":  "array",
+				"items": map[string]interface{}{"type": "string"},
+			},
+		},
+		"required": []string{"query"},
+	}
+
+	tests := []struct {
+		name    string
+		args    map[string]interface{}
+		wantErr string
+	}{
+		{"valid", map[string]interface{}{"query": "go", "count": float64(3), "mode": "fast"}, ""},
+		{"missing required", map[string]interface{}{"count": float64(3)}, `missing required parameter "query"`},
+		{"wrong type", map[string]interface{}{"query": 42.0}, `"query" must be of type string`},
+		{"non-integer number", map[string]interface{}{"query": "go", "count": 1.5}, `"count" must be of type integer`},
+		{"enum mismatch", map[string]interface{}{"query": "go", "mode": "slow"}, `"mode" must be one of [fast, full]`},
+		{"string enum", map[string]interface{}{"query": "go", "unit": "c"}, ""},
+		{"string enum mismatch", map[string]interface{}{"query": "go", "unit": "k"}, `"unit" must be one of [c, f]`},
+		{"array item type", map[string]interface{}{"query": "go", "tags": []interface{}{"a", 1.0}}, `"tags[1]" must be of type string`},
+		{"unknown properties ignored", map[string]interface{}{"query": "go", "extra": true}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateArgs(schema, tt.args)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRegistryRejectsInvalidArgs(t *testing.T) {
+	called := false
+	registry := NewToolRegistry()
+	registry.Register(NewFuncTool("echo", "Echo text", map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"text": map[string]interface{}{"type": "string"},
+		},
+		"required": []string{"text"},
+	}, func(ctx context.Context, args map[string]interface{}) *ToolResult {
+		called = true
+		return NewToolResult(args["text"].(string))
+	}))
+
+	result := registry.Execute(context.Background(), "echo", map[string]interface{}{})
+	if !result.IsError || called {
+		t.Fatalf("expected validation error without calling handler, got %+v", result)
+	}
+
+	result = registry.Execute(context.Background(), "echo", map[string]interface{}{"text": "hi"})
+	if result.IsError || result.ForLLM != "hi" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+}
@@ -11,6 +11,9 @@ import (
 	"runtime"
 	"strings"
 	"time"
+
+	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/events"
 )
 
 type ExecTool struct {
@@ -19,6 +22,10 @@ type ExecTool struct {
 	denyPatterns        []*regexp.Regexp
 	allowPatterns       []*regexp.Regexp
 	restrictToWorkspace bool
+	approvals           *ApprovalStore
+	channel             string
+	chatID              string
+	senderID            string
 }
 
 func NewExecTool(workingDir string, restrict bool) *ExecTool {
@@ -86,9 +93,38 @@ func (t *ExecTool) Execute(ctx context.Context, args map[string]interface{}) *To
 	}
 
 	if guardError := t.guardCommand(command, cwd); guardError != "" {
+		events.Security("exec", "Blocked command",
+			map[string]interface{}{
+				"command": command,
+				"reason":  guardError,
+				"channel": t.channel,
+				"chat_id": t.chatID,
+			})
 		return ErrorResult(guardError)
 	}
 
+	if t.approvals != nil && t.channel != "" && !constants.IsInternalChannel(t.channel) {
+		// Only the sender who issued a command can approve it, so without one
+		// (as in a subagent) the approval could never be given
+		if t.senderID == "" {
+			return ErrorResult("This command needs the user's approval, which cannot be asked for here: " +
+				"subagents and other background tasks have no user to approve it. " +
+				"Report the command back so it can be run from the conversation with the user.")
+		}
+		id, err := t.approvals.Request(command, cwd, t.channel, t.chatID, t.senderID)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to request approval: %v", err))
+		}
+		return SilentResult(fmt.Sprintf("The command was not run yet: it needs the user's approval (ID %s). "+
+			"The user has been asked to reply /approve %s or /deny %s; do not repeat the instructions in detail.", id, id, id))
+	}
+
+	return t.Run(ctx, command, cwd)
+}
+
+// Run executes command in cwd without guard or approval checks. Callers must
+// have validated the command already (see Execute and ApprovalStore).
+func (t *ExecTool) Run(ctx context.Context, command, cwd string) *ToolResult {
 	cmdCtx, cancel := context.WithTimeout(ctx, t.timeout)
 	defer cancel()
 
@@ -204,6 +240,26 @@ func (t *ExecTool) guardCommand(command, cwd string) string {
 	return ""
 }
 
+// SetContext implements ContextualTool so approval prompts reach the chat
+// that issued the command.
+func (t *ExecTool) SetContext(channel, chatID string) {
+	t.channel = channel
+	t.chatID = chatID
+}
+
+// SetSender implements SenderAwareTool so only the sender who issued a
+// command can approve it.
+func (t *ExecTool) SetSender(channel, senderID string) {
+	t.senderID = senderID
+}
+
+// SetApprovalStore enables per-command confirmation. Commands from
+// user-facing channels are held until approved; internal channels (CLI)
+// run directly.
+func (t *ExecTool) SetApprovalStore(store *ApprovalStore) {
+	t.approvals = store
+}
+
 func (t *ExecTool) SetTimeout(timeout time.Duration) {
 	t.timeout = timeout
 }
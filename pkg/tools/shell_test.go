@@ -208,3 +208,70 @@ func TestShellTool_RestrictToWorkspace(t *testing.T) {
 		t.Errorf("Expected 'blocked' message for path traversal, got ForLLM: %s, ForUser: %s", result.ForLLM, result.ForUser)
 	}
 }
+
+// TestShellTool_RequiresApproval verifies commands from chat channels wait for /approve
+func TestShellTool_RequiresApproval(t *testing.T) {
+	tmpDir := t.TempDir()
+	marker := filepath.Join(tmpDir, "ran")
+
+	var prompt string
+	store := NewApprovalStore(time.Minute)
+	store.SetNotifier(func(channel, chatID, content string) error {
+		prompt = content
+		return nil
+	})
+
+	tool := NewExecTool(tmpDir, false)
+	tool.SetApprovalStore(store)
+	tool.SetContext("telegram", "chat-1")
+	tool.SetSender("telegram", "alice")
+
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"command": "touch " + marker,
+	})
+	if result.IsError || !result.Silent {
+		t.Fatalf("Expected silent pending result, got: %+v", result)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Fatal("Command ran before approval")
+	}
+	if !strings.Contains(prompt, "/approve ") {
+		t.Fatalf("Expected approval prompt, got: %q", prompt)
+	}
+
+	id := strings.Fields(prompt[strings.Index(prompt, "/approve "):])[1]
+	if _, ok := store.Take(id, "telegram", "other-chat", "alice"); ok {
+		t.Error("Approval must not be usable from another chat")
+	}
+	if _, ok := store.Take(id, "telegram", "chat-1", "mallory"); ok {
+		t.Error("Approval must not be usable by another member of the chat")
+	}
+	pending, ok := store.Take(id, "telegram", "chat-1", "alice")
+	if !ok {
+		t.Fatal("Expected pending command for originating chat")
+	}
+	if _, ok := store.Take(id, "telegram", "chat-1", "alice"); ok {
+		t.Error("Approval must be single use")
+	}
+
+	if r := tool.Run(context.Background(), pending.Command, pending.WorkingDir); r.IsError {
+		t.Fatalf("Approved command failed: %s", r.ForLLM)
+	}
+	if _, err := os.Stat(marker); err != nil {
+		t.Errorf("Approved command did not run: %v", err)
+	}
+}
+
+// TestShellTool_ApprovalSkippedForInternalChannels verifies CLI runs are not gated
+func TestShellTool_ApprovalSkippedForInternalChannels(t *testing.T) {
+	tool := NewExecTool("", false)
+	tool.SetApprovalStore(NewApprovalStore(time.Minute))
+	tool.SetContext("cli", "direct")
+
+	result := tool.Execute(context.Background(), map[string]interface{}{
+		"command": "echo direct",
+	})
+	if result.IsError || !strings.Contains(result.ForLLM, "direct") {
+		t.Errorf("Expected command to run directly, got: %+v", result)
+	}
+}
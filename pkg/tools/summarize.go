@@ -0,0 +1,296 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/rag"
+)
+
+const (
+	minSummaryChunkChars = 2000
+	maxSummaryChunkChars = 100000
+	// maxSummaryChunks bounds the model calls one request can cost
+	maxSummaryChunks    = 100
+	maxSummaryFileBytes = 10 << 20
+	summaryMaxTokens    = 1024
+)
+
+const summaryFormat = `Write the summary in this format:
+
+TL;DR: one or two sentences.
+
+Key points:
+- the most important facts, findings, figures, and conclusions, one per line
+
+Details: a short paragraph with anything else a reader should know.`
+
+// UsageMeter charges the model calls a tool makes to the sender and chat it
+// works for, against the same budgets as the agent's own calls.
+type UsageMeter interface {
+	// CheckBudget returns an error, for the LLM, when the sender or the
+	// chat has used up its budget.
+	CheckBudget(channel, chatID, senderID string) error
+	RecordLLM(channel, chatID, senderID, model string, messages []providers.Message, resp *providers.LLMResponse)
+}
+
+// SummarizeTool summarizes web pages and documents of any length. Text that
+// does not fit in one model call is split into chunks that are summarized
+// one by one (map), and the partial summaries are then merged (reduce),
+// repeatedly if they are still too long.
+type SummarizeTool struct {
+	provider   providers.LLMProvider
+	model      string
+	chunkChars int
+	fetcher    *WebFetchTool
+	workspace  string
+	restrict   bool
+
+	meter    UsageMeter // nil unless SetUsageMeter
+	channel  string
+	chatID   string
+	senderID string
+}
+
+// NewSummarizeTool creates the tool. Chunks are sized to use about half of
+// contextWindow (in tokens), leaving room for the prompt and the answer.
+func NewSummarizeTool(provider providers.LLMProvider, model string, contextWindow int, workspace string, restrict bool) *SummarizeTool {
+	chunkChars := contextWindow * 3 / 2 // ~3 characters per token
+	chunkChars = max(minSummaryChunkChars, min(chunkChars, maxSummaryChunkChars))
+	return &SummarizeTool{
+		provider:   provider,
+		model:      model,
+		chunkChars: chunkChars,
+		fetcher:    NewWebFetchTool(maxFetchBytes),
+		workspace:  workspace,
+		restrict:   restrict,
+	}
+}
+
+// SetUsageMeter charges the tool's model calls to the user who asked.
+func (t *SummarizeTool) SetUsageMeter(meter UsageMeter) {
+	t.meter = meter
+}
+
+func (t *SummarizeTool) SetContext(channel, chatID string) {
+	t.channel = channel
+	t.chatID = chatID
+}
+
+func (t *SummarizeTool) SetSender(channel, senderID string) {
+	t.senderID = senderID
+}
+
+func (t *SummarizeTool) Name() string {
+	return "summarize"
+}
+
+func (t *SummarizeTool) Description() string {
+	return "Summarize a web page, a document file, or a long text, however long it is. Returns a structured summary (TL;DR, key points, details). Prefer this over web_fetch or read_file when the user wants a summary of a link or document."
+}
+
+func (t *SummarizeTool) Parameters() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"url": map[string]interface{}{
+				"type":        "string",
+				"description": "http(s) URL of the page to summarize",
+			},
+			"path": map[string]interface{}{
+				"type":        "string",
+				"description": "Path of a text document to summarize",
+			},
+			"text": map[string]interface{}{
+				"type":        "string",
+				"description": "Text to summarize",
+			},
+			"focus": map[string]interface{}{
+				"type":        "string",
+				"description": "Optional aspect to concentrate on, e.g. 'pricing' or 'action items'",
+			},
+		},
+	}
+}
+
+func (t *SummarizeTool) Execute(ctx context.Context, args map[string]interface{}) *ToolResult {
+	urlStr, _ := args["url"].(string)
+	path, _ := args["path"].(string)
+	text, _ := args["text"].(string)
+	focus, _ := args["focus"].(string)
+
+	var source string
+	switch {
+	case urlStr != "":
+		parsed, err := url.Parse(urlStr)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return ErrorResult("url must be an http or https URL")
+		}
+		page, err := t.fetcher.fetch(ctx, urlStr, maxFetchBytes)
+		if err != nil {
+			return ErrorResult(err.Error())
+		}
+		if page.status >= 400 {
+			return ErrorResult(fmt.Sprintf("fetching %s failed with status %d", urlStr, page.status))
+		}
+		source, text = urlStr, page.text
+	case path != "":
+		resolved, err := validatePath(path, t.workspace, t.restrict)
+		if err != nil {
+			return ErrorResult(err.Error())
+		}
+		info, err := os.Stat(resolved)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to read file: %v", err))
+		}
+		if info.Size() > maxSummaryFileBytes {
+			return ErrorResult(fmt.Sprintf("file is too large to summarize (max %d MB)", maxSummaryFileBytes>>20))
+		}
+		data, err := os.ReadFile(resolved)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("failed to read file: %v", err))
+		}
+		if !utf8.Valid(data) {
+			return ErrorResult("only text documents can be summarized")
+		}
+		source, text = path, string(data)
+	case text != "":
+		source = "text"
+	default:
+		return ErrorResult("one of url, path, or text is required")
+	}
+
+	if strings.TrimSpace(text) == "" {
+		return ErrorResult("there is no text to summarize")
+	}
+
+	summary, chunks, err := t.summarize(ctx, text, focus)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("summarization failed: %v", err)).WithError(err)
+	}
+	logger.InfoCF("tool", "Summarized document",
+		map[string]interface{}{"source": source, "chars": len(text), "chunks": chunks})
+
+	return SilentResult(fmt.Sprintf("Summary of %s:\n\n%s", source, summary))
+}
+
+// summarize runs map-reduce summarization and returns the final summary and
+// the number of chunks the text was split into.
+func (t *SummarizeTool) summarize(ctx context.Context, text, focus string) (string, int, error) {
+	chunks := rag.ChunkText(text, t.chunkChars, 0)
+	truncated := false
+	if len(chunks) > maxSummaryChunks {
+		chunks = chunks[:maxSummaryChunks]
+		truncated = true
+	}
+	if len(chunks) == 1 {
+		summary, err := t.final(ctx, chunks[0], focus)
+		return summary, 1, err
+	}
+
+	// Map: summarize each chunk on its own
+	partials := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		system := "You summarize one part of a longer document. Write a concise summary of this part that keeps the key facts, figures, names, dates, and conclusions. Do not comment on the document being incomplete."
+		summary, err := t.complete(ctx, system+focusInstruction(focus), fmt.Sprintf("Part %d of %d:\n\n%s", i+1, len(chunks), chunk))
+		if err != nil {
+			return "", len(chunks), fmt.Errorf("part %d: %w", i+1, err)
+		}
+		partials[i] = summary
+	}
+
+	// Reduce: merge groups of partial summaries until they fit in one call
+	for len(partials) > 1 && utf8.RuneCountInString(strings.Join(partials, "\n\n")) > t.chunkChars {
+		groups := groupSummaries(partials, t.chunkChars)
+		if len(groups) == len(partials) {
+			// Summaries that no longer shrink are cut to fit below
+			break
+		}
+		merged := make([]string, len(groups))
+		for i, group := range groups {
+			system := "You merge summaries of consecutive parts of one document into a single summary. Keep the key facts, figures, names, dates, and conclusions; drop repetition."
+			summary, err := t.complete(ctx, system+focusInstruction(focus), strings.Join(group, "\n\n"))
+			if err != nil {
+				return "", len(chunks), err
+			}
+			merged[i] = summary
+		}
+		partials = merged
+	}
+
+	combined := strings.Join(partials, "\n\n")
+	if truncated {
+		combined += "\n\n(The document was too long; only the beginning was summarized.)"
+	}
+	summary, err := t.final(ctx, combined, focus)
+	return summary, len(chunks), err
+}
+
+// final writes the structured summary of text, which is either the whole
+// document or the merged partial summaries.
+func (t *SummarizeTool) final(ctx context.Context, text, focus string) (string, error) {
+	if utf8.RuneCountInString(text) > t.chunkChars {
+		text = string([]rune(text)[:t.chunkChars])
+	}
+	system := "You summarize documents accurately and without adding information.\n\n" + summaryFormat + focusInstruction(focus)
+	return t.complete(ctx, system, text)
+}
+
+// complete makes one model call. Each is checked against the budgets and
+// charged, so a long document stops once the budget is used up.
+func (t *SummarizeTool) complete(ctx context.Context, system, prompt string) (string, error) {
+	if t.meter != nil {
+		if err := t.meter.CheckBudget(t.channel, t.chatID, t.senderID); err != nil {
+			return "", err
+		}
+	}
+	messages := []providers.Message{
+		{Role: "system", Content: system},
+		{Role: "user", Content: prompt},
+	}
+	resp, err := t.provider.Chat(ctx, messages, nil, t.model, map[string]interface{}{
+		"max_tokens":  summaryMaxTokens,
+		"temperature": 0.2,
+	})
+	if err != nil {
+		return "", err
+	}
+	if t.meter != nil {
+		t.meter.RecordLLM(t.channel, t.chatID, t.senderID, t.model, messages, resp)
+	}
+	return strings.TrimSpace(resp.Content), nil
+}
+
+func focusInstruction(focus string) string {
+	if focus = strings.TrimSpace(focus); focus == "" {
+		return ""
+	}
+	return "\n\nConcentrate on: " + focus
+}
+
+// groupSummaries packs consecutive summaries into groups of at most size
+// runes. A summary longer than size gets a group of its own.
+func groupSummaries(summaries []string, size int) [][]string {
+	var groups [][]string
+	var current []string
+	n := 0
+	for _, s := range summaries {
+		l := utf8.RuneCountInString(s) + 2
+		if len(current) > 0 && n+l > size {
+			groups = append(groups, current)
+			current, n = nil, 0
+		}
+		current = append(current, s)
+		n += l
+	}
+	if len(current) > 0 {
+		groups = append(groups, current)
+	}
+	return groups
+}
@@ -0,0 +1,142 @@
+package tools
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// summaryProvider labels each answer with the kind of call that produced it.
+type summaryProvider struct {
+	calls []string
+}
+
+func (p *summaryProvider) Chat(ctx context.Context, messages []providers.Message, tools []providers.ToolDefinition, model string, options map[string]interface{}) (*providers.LLMResponse, error) {
+	system := messages[0].Content
+	kind := "final"
+	switch {
+	case strings.HasPrefix(system, "You summarize one part"):
+		kind = "map"
+	case strings.HasPrefix(system, "You merge"):
+		kind = "reduce"
+	}
+	if strings.Contains(system, "Concentrate on: prices") {
+		kind += "+focus"
+	}
+	p.calls = append(p.calls, kind)
+	return &providers.LLMResponse{Content: kind + " summary"}, nil
+}
+
+func (p *summaryProvider) GetDefaultModel() string {
+	return "test-model"
+}
+
+func TestSummarizeTool_ShortText(t *testing.T) {
+	provider := &summaryProvider{}
+	tool := NewSummarizeTool(provider, "test-model", 8192, t.TempDir(), true)
+
+	result := tool.Execute(context.Background(), map[string]interface{}{"text": "A short note.", "focus": "prices"})
+	if result.IsError {
+		t.Fatalf("unexpected error: %s", result.ForLLM)
+	}
+	if strings.Join(provider.calls, ",") != "final+focus" {
+		t.Errorf("calls = %v, want a single final call", provider.calls)
+	}
+	if !strings.Contains(result.ForLLM, "final+focus summary") {
+		t.Errorf("result = %q", result.ForLLM)
+	}
+}
+
+func TestSummarizeTool_MapReduce(t *testing.T) {
+	provider := &summaryProvider{}
+	tool := NewSummarizeTool(provider, "test-model", 8192, t.TempDir(), true)
+	tool.chunkChars = 60
+
+	// Ten ~50-character paragraphs: one chunk each, whose partial
+	// summaries ("map summary", 11 runes) need one round of merging
+	var paragraphs []string
+	for i := 0; i < 10; i++ {
+		paragraphs = append(paragraphs, strings.Repeat("word ", 10))
+	}
+	result := tool.Execute(context.Background(), map[string]interface{}{"text": strings.Join(paragraphs, "\n\n")})
+	if result.IsError {
+		t.Fatalf("unexpected error: %s", result.ForLLM)
+	}
+
+	counts := map[string]int{}
+	for _, c := range provider.calls {
+		counts[c]++
+	}
+	if counts["map"] != 10 || counts["reduce"] == 0 || counts["final"] != 1 {
+		t.Errorf("calls = %v", provider.calls)
+	}
+	if last := provider.calls[len(provider.calls)-1]; last != "final" {
+		t.Errorf("last call = %s, want final", last)
+	}
+}
+
+func TestSummarizeTool_Sources(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html><body><p>Article text</p></body></html>"))
+	}))
+	defer server.Close()
+
+	workspace := t.TempDir()
+	os.WriteFile(filepath.Join(workspace, "notes.md"), []byte("# Notes\nSome notes."), 0644)
+	os.WriteFile(filepath.Join(workspace, "blob.bin"), []byte{0xff, 0xfe, 0x00}, 0644)
+
+	tests := []struct {
+		name    string
+		args    map[string]interface{}
+		wantErr string
+	}{
+		{"url", map[string]interface{}{"url": server.URL}, ""},
+		{"workspace file", map[string]interface{}{"path": "notes.md"}, ""},
+		{"http error", map[string]interface{}{"url": server.URL + "/missing"}, "status 404"},
+		{"bad scheme", map[string]interface{}{"url": "file:///etc/passwd"}, "http or https"},
+		{"outside workspace", map[string]interface{}{"path": "/etc/hostname"}, "outside the workspace"},
+		{"binary file", map[string]interface{}{"path": "blob.bin"}, "only text"},
+		{"nothing", map[string]interface{}{}, "required"},
+		{"blank text", map[string]interface{}{"text": "  \n"}, "no text"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tool := NewSummarizeTool(&summaryProvider{}, "test-model", 8192, workspace, true)
+			result := tool.Execute(context.Background(), tt.args)
+			if tt.wantErr == "" {
+				if result.IsError || !strings.Contains(result.ForLLM, "final summary") {
+					t.Errorf("result = %+v", result)
+				}
+				return
+			}
+			if !result.IsError || !strings.Contains(result.ForLLM, tt.wantErr) {
+				t.Errorf("result = %q, want error containing %q", result.ForLLM, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGroupSummaries(t *testing.T) {
+	groups := groupSummaries([]string{"aaaa", "bbbb", "cccccccccccc", "dd"}, 12)
+	want := [][]string{{"aaaa", "bbbb"}, {"cccccccccccc"}, {"dd"}}
+	if len(groups) != len(want) {
+		t.Fatalf("groups = %v, want %v", groups, want)
+	}
+	for i := range want {
+		if strings.Join(groups[i], "|") != strings.Join(want[i], "|") {
+			t.Errorf("group %d = %v, want %v", i, groups[i], want[i])
+		}
+	}
+}
@@ -4,16 +4,24 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"html"
 	"io"
 	"net/http"
 	"net/url"
 	"regexp"
 	"strings"
 	"time"
+	"unicode/utf8"
+
+	"github.com/sipeed/picoclaw/pkg/utils"
 )
 
 const (
 	userAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+
+	// maxFetchBytes caps how much of a response body web_fetch reads, so a
+	// large download cannot exhaust memory on small devices.
+	maxFetchBytes = 5 << 20
 )
 
 type SearchProvider interface {
@@ -84,6 +92,65 @@ func (p *BraveSearchProvider) Search(ctx context.Context, query string, count in
 	return strings.Join(lines, "\n"), nil
 }
 
+// SearxNGSearchProvider queries a self-hosted SearxNG instance through its
+// JSON API (the instance must have the "json" format enabled).
+type SearxNGSearchProvider struct {
+	baseURL string
+}
+
+func (p *SearxNGSearchProvider) Search(ctx context.Context, query string, count int) (string, error) {
+	searchURL := fmt.Sprintf("%s/search?q=%s&format=json", strings.TrimRight(p.baseURL, "/"), url.QueryEscape(query))
+
+	req, err := http.NewRequestWithContext(ctx, "GET", searchURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", userAgent)
+
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxFetchBytes))
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("searxng returned status %d", resp.StatusCode)
+	}
+
+	var searchResp struct {
+		Results []struct {
+			Title   string `json:"title"`
+			URL     string `json:"url"`
+			Content string `json:"content"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(body, &searchResp); err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	if len(searchResp.Results) == 0 {
+		return fmt.Sprintf("No results for: %s", query), nil
+	}
+
+	lines := []string{fmt.Sprintf("Results for: %s", query)}
+	for i, item := range searchResp.Results {
+		if i >= count {
+			break
+		}
+		lines = append(lines, fmt.Sprintf("%d. %s\n   %s", i+1, item.Title, item.URL))
+		if item.Content != "" {
+			lines = append(lines, fmt.Sprintf("   %s", item.Content))
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
 type DuckDuckGoSearchProvider struct{}
 
 func (p *DuckDuckGoSearchProvider) Search(ctx context.Context, query string, count int) (string, error) {
@@ -182,6 +249,9 @@ type WebSearchTool struct {
 }
 
 type WebSearchToolOptions struct {
+	SearxNGURL           string
+	SearxNGMaxResults    int
+	SearxNGEnabled       bool
 	BraveAPIKey          string
 	BraveMaxResults      int
 	BraveEnabled         bool
@@ -193,8 +263,13 @@ func NewWebSearchTool(opts WebSearchToolOptions) *WebSearchTool {
 	var provider SearchProvider
 	maxResults := 5
 
-	// Priority: Brave > DuckDuckGo
-	if opts.BraveEnabled && opts.BraveAPIKey != "" {
+	// Priority: SearxNG (self-hosted) > Brave > DuckDuckGo
+	if opts.SearxNGEnabled && opts.SearxNGURL != "" {
+		provider = &SearxNGSearchProvider{baseURL: opts.SearxNGURL}
+		if opts.SearxNGMaxResults > 0 {
+			maxResults = opts.SearxNGMaxResults
+		}
+	} else if opts.BraveEnabled && opts.BraveAPIKey != "" {
 		provider = &BraveSearchProvider{apiKey: opts.BraveAPIKey}
 		if opts.BraveMaxResults > 0 {
 			maxResults = opts.BraveMaxResults
@@ -330,9 +405,42 @@ func (t *WebFetchTool) Execute(ctx context.Context, args map[string]interface{})
 		}
 	}
 
+	page, err := t.fetch(ctx, urlStr, maxChars)
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+
+	result := map[string]interface{}{
+		"url":       urlStr,
+		"status":    page.status,
+		"extractor": page.extractor,
+		"truncated": page.truncated,
+		"length":    len(page.text),
+		"text":      page.text,
+	}
+
+	resultJSON, _ := json.MarshalIndent(result, "", "  ")
+
+	// The LLM needs the page text itself to answer questions about it.
+	return &ToolResult{
+		ForLLM:  fmt.Sprintf("Fetched %d bytes from %s (extractor: %s, truncated: %v)\n\n%s", len(page.text), urlStr, page.extractor, page.truncated, page.text),
+		ForUser: string(resultJSON),
+	}
+}
+
+// fetchedPage is the readable text of a fetched URL.
+type fetchedPage struct {
+	status    int
+	extractor string // "json", "text" (from HTML), or "raw"
+	truncated bool
+	text      string
+}
+
+// fetch downloads urlStr and extracts up to maxChars of readable text.
+func (t *WebFetchTool) fetch(ctx context.Context, urlStr string, maxChars int) (*fetchedPage, error) {
 	req, err := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
 	if err != nil {
-		return ErrorResult(fmt.Sprintf("failed to create request: %v", err))
+		return nil, fmt.Errorf("failed to create request: %v", err)
 	}
 
 	req.Header.Set("User-Agent", userAgent)
@@ -355,13 +463,13 @@ func (t *WebFetchTool) Execute(ctx context.Context, args map[string]interface{})
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return ErrorResult(fmt.Sprintf("request failed: %v", err))
+		return nil, fmt.Errorf("request failed: %v", err)
 	}
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxFetchBytes))
 	if err != nil {
-		return ErrorResult(fmt.Sprintf("failed to read response: %v", err))
+		return nil, fmt.Errorf("failed to read response: %v", err)
 	}
 
 	contentType := resp.Header.Get("Content-Type")
@@ -387,40 +495,38 @@ func (t *WebFetchTool) Execute(ctx context.Context, args map[string]interface{})
 		extractor = "raw"
 	}
 
-	truncated := len(text) > maxChars
+	truncated := utf8.RuneCountInString(text) > maxChars
 	if truncated {
-		text = text[:maxChars]
-	}
-
-	result := map[string]interface{}{
-		"url":       urlStr,
-		"status":    resp.StatusCode,
-		"extractor": extractor,
-		"truncated": truncated,
-		"length":    len(text),
-		"text":      text,
+		text = utils.Truncate(text, maxChars)
 	}
 
-	resultJSON, _ := json.MarshalIndent(result, "", "  ")
-
-	return &ToolResult{
-		ForLLM:  fmt.Sprintf("Fetched %d bytes from %s (extractor: %s, truncated: %v)", len(text), urlStr, extractor, truncated),
-		ForUser: string(resultJSON),
-	}
+	return &fetchedPage{
+		status:    resp.StatusCode,
+		extractor: extractor,
+		truncated: truncated,
+		text:      text,
+	}, nil
 }
 
-func (t *WebFetchTool) extractText(htmlContent string) string {
-	re := regexp.MustCompile(`<script[\s\S]*?</script>`)
-	result := re.ReplaceAllLiteralString(htmlContent, "")
-	re = regexp.MustCompile(`<style[\s\S]*?</style>`)
-	result = re.ReplaceAllLiteralString(result, "")
-	re = regexp.MustCompile(`<[^>]+>`)
-	result = re.ReplaceAllLiteralString(result, "")
-
-	result = strings.TrimSpace(result)
+var (
+	reScript     = regexp.MustCompile(`(?is)<script[\s\S]*?</script>`)
+	reStyle      = regexp.MustCompile(`(?is)<style[\s\S]*?</style>`)
+	reNoise      = regexp.MustCompile(`(?is)<(nav|footer|noscript|svg)[\s\S]*?</(nav|footer|noscript|svg)>`)
+	reBlockBreak = regexp.MustCompile(`(?i)<(br|/p|/div|/li|/tr|/h[1-6]|/section|/article)[^>]*>`)
+	reTag        = regexp.MustCompile(`<[^>]+>`)
+	reSpaces     = regexp.MustCompile(`[ \t\r\f\v]+`)
+)
 
-	re = regexp.MustCompile(`\s+`)
-	result = re.ReplaceAllLiteralString(result, " ")
+// extractText strips a page to readable text, keeping one line per block
+// element and dropping scripts, styles, and navigation chrome.
+func (t *WebFetchTool) extractText(htmlContent string) string {
+	result := reScript.ReplaceAllLiteralString(htmlContent, "")
+	result = reStyle.ReplaceAllLiteralString(result, "")
+	result = reNoise.ReplaceAllLiteralString(result, "")
+	result = reBlockBreak.ReplaceAllLiteralString(result, "\n")
+	result = reTag.ReplaceAllLiteralString(result, "")
+	result = html.UnescapeString(result)
+	result = reSpaces.ReplaceAllLiteralString(result, " ")
 
 	lines := strings.Split(result, "\n")
 	var cleanLines []string
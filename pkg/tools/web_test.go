@@ -40,6 +40,11 @@ func TestWebTool_WebFetch_Success(t *testing.T) {
 	if !strings.Contains(result.ForLLM, "bytes") && !strings.Contains(result.ForLLM, "extractor") {
 		t.Errorf("Expected ForLLM to contain summary, got: %s", result.ForLLM)
 	}
+
+	// ForLLM must also carry the page text so the model can answer from it
+	if !strings.Contains(result.ForLLM, "Content here") {
+		t.Errorf("Expected ForLLM to contain page text, got: %s", result.ForLLM)
+	}
 }
 
 // TestWebTool_WebFetch_JSON verifies JSON content handling
@@ -250,3 +255,41 @@ func TestWebTool_WebFetch_MissingDomain(t *testing.T) {
 		t.Errorf("Expected domain error message, got ForLLM: %s", result.ForLLM)
 	}
 }
+
+// TestWebTool_WebSearch_SearxNG verifies the SearxNG JSON provider
+func TestWebTool_WebSearch_SearxNG(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("format") != "json" || r.URL.Query().Get("q") != "weather" {
+			t.Errorf("unexpected query: %s", r.URL.RawQuery)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"results":[{"title":"Forecast","url":"https://example.com/wx","content":"Sunny"},{"title":"Other","url":"https://example.com/o"}]}`))
+	}))
+	defer server.Close()
+
+	tool := NewWebSearchTool(WebSearchToolOptions{SearxNGEnabled: true, SearxNGURL: server.URL, BraveEnabled: true, BraveAPIKey: "key"})
+	if tool == nil {
+		t.Fatal("expected SearxNG-backed search tool")
+	}
+
+	result := tool.Execute(context.Background(), map[string]interface{}{"query": "weather", "count": float64(1)})
+	if result.IsError {
+		t.Fatalf("unexpected error: %s", result.ForLLM)
+	}
+	if !strings.Contains(result.ForLLM, "Forecast") || !strings.Contains(result.ForLLM, "Sunny") {
+		t.Errorf("expected first result in output, got: %s", result.ForLLM)
+	}
+	if strings.Contains(result.ForLLM, "Other") {
+		t.Errorf("expected count to limit results, got: %s", result.ForLLM)
+	}
+}
+
+// TestWebTool_ExtractText_KeepsBlocksOnSeparateLines verifies readable text extraction
+func TestWebTool_ExtractText_KeepsBlocksOnSeparateLines(t *testing.T) {
+	tool := NewWebFetchTool(1000)
+	got := tool.extractText("<nav>Menu</nav><h1>Title</h1><p>Fish &amp; chips</p><p>Second</p>")
+	want := "Title\nFish & chips\nSecond"
+	if got != want {
+		t.Errorf("extractText() = %q, want %q", got, want)
+	}
+}
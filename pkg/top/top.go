@@ -0,0 +1,351 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+// Package top is the live terminal monitor behind "picoclaw top": channel
+// states, queue depths, message rates, and a feed of gateway events, read
+// from a running gateway's admin API. It draws with plain ANSI escapes, so
+// it works over SSH on small devices.
+package top
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sipeed/picoclaw/pkg/admin"
+	"github.com/sipeed/picoclaw/pkg/events"
+)
+
+const (
+	// feedSize is how many feed lines are kept for scrolling back.
+	feedSize = 500
+	// rateWindow is the window message rates are counted over.
+	rateWindow = time.Minute
+	// statusInterval is how often channel states and queues are polled.
+	statusInterval = 2 * time.Second
+	// reconnectDelay is the wait before reconnecting a dropped stream.
+	reconnectDelay = 3 * time.Second
+)
+
+// ANSI escapes.
+const (
+	reset  = "\x1b[0m"
+	bold   = "\x1b[1m"
+	dim    = "\x1b[2m"
+	red    = "\x1b[31m"
+	green  = "\x1b[32m"
+	yellow = "\x1b[33m"
+	cyan   = "\x1b[36m"
+)
+
+// Monitor holds what the screen shows. It is safe for concurrent use.
+type Monitor struct {
+	// ShowContent shows message text in the feed instead of its length.
+	ShowContent bool
+
+	mu        sync.Mutex
+	status    admin.Status
+	statusErr string
+	streaming bool
+	feed      []string
+	inbound   []time.Time // Within rateWindow
+	outbound  []time.Time
+	totals    map[string]int // By event type
+	scroll    int            // Lines scrolled back from the newest
+	now       func() time.Time
+}
+
+// New returns an empty monitor.
+func New() *Monitor {
+	return &Monitor{totals: make(map[string]int), now: time.Now}
+}
+
+// SetStatus records the latest GET /status result, or the error getting it.
+func (m *Monitor) SetStatus(st admin.Status, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err != nil {
+		m.statusErr = err.Error()
+		return
+	}
+	m.status, m.statusErr = st, ""
+}
+
+// SetStreaming records whether the event stream is connected.
+func (m *Monitor) SetStreaming(ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.streaming = ok
+}
+
+// Scroll moves the feed back (positive) or forward (negative) by lines.
+func (m *Monitor) Scroll(lines int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.scroll = max(0, min(m.scroll+lines, len(m.feed)-1))
+}
+
+// Add counts an event and adds it to the feed.
+func (m *Monitor) Add(e events.Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	m.totals[e.Type]++
+	switch e.Type {
+	case events.TypeInbound:
+		m.inbound = append(m.inbound, now)
+	case events.TypeOutbound:
+		m.outbound = append(m.outbound, now)
+	}
+	m.feed = append(m.feed, m.format(e))
+	if len(m.feed) > feedSize {
+		m.feed = m.feed[len(m.feed)-feedSize:]
+	}
+	if m.scroll > 0 {
+		// Keep the lines being read in place
+		m.scroll = min(m.scroll+1, len(m.feed)-1)
+	}
+}
+
+// format turns e into one feed line. Chat and sender IDs are masked, and
+// message text is replaced by its length unless ShowContent is set.
+func (m *Monitor) format(e events.Event) string {
+	t := e.Time
+	if t.IsZero() {
+		t = m.now()
+	}
+	ts := dim + t.Local().Format("15:04:05") + reset + " "
+	switch e.Type {
+	case events.TypeInbound:
+		return ts + cyan + "← " + reset + e.Channel + " " + maskID(e.ChatID) + " from " + maskID(e.SenderID) + " " + m.content(e.Content)
+	case events.TypeOutbound:
+		return ts + green + "→ " + reset + e.Channel + " " + maskID(e.ChatID) + " " + m.content(e.Content)
+	case events.TypeChannel:
+		return ts + yellow + "◆ " + reset + e.Channel + " " + e.Message + dim + fmt.Sprintf(" (was %v)", e.Fields["previous"]) + reset
+	case events.TypeChat:
+		return ts + "◇ " + e.Channel + " " + maskID(e.ChatID) + " " + fmt.Sprint(e.Fields["event"])
+	case events.TypeDeliveryFailed:
+		return ts + red + "✗ " + reset + e.Channel + " " + maskID(e.ChatID) + " not delivered: " + e.Message
+	case events.TypeError:
+		return ts + red + "! " + reset + e.Component + ": " + e.Message
+	case events.TypeSecurity:
+		return ts + yellow + "⚠ " + reset + e.Component + ": " + e.Message
+	case events.TypeDropped:
+		reason := e.Message
+		if filter, ok := e.Fields["filter"]; ok {
+			reason = fmt.Sprintf("filter %v", filter)
+		}
+		return ts + dim + "⊘ " + reset + e.Channel + " " + maskID(e.ChatID) + " from " + maskID(e.SenderID) + " dropped: " + reason
+	case events.TypeChannelFailing:
+		if e.Fields["recovered"] == true {
+			return ts + green + "◆ " + reset + e.Channel + " recovered" + dim + fmt.Sprintf(" (after %v restarts)", e.Fields["restarts"]) + reset
+		}
+		return ts + red + "◆ " + reset + e.Channel + " failing: " + e.Message + dim + fmt.Sprintf(" (%v restarts)", e.Fields["restarts"]) + reset
+	default:
+		return ts + e.Type + " " + e.Message
+	}
+}
+
+func (m *Monitor) content(s string) string {
+	if !m.ShowContent {
+		return dim + fmt.Sprintf("[%d chars]", utf8.RuneCountInString(s)) + reset
+	}
+	s, _, _ = strings.Cut(s, "\n")
+	return fmt.Sprintf("%q", s)
+}
+
+// maskID keeps the last four characters of an ID, enough to tell chats
+// apart without showing phone numbers on screen.
+func maskID(id string) string {
+	if id == "" {
+		return "-"
+	}
+	r := []rune(id)
+	if len(r) <= 4 {
+		return id
+	}
+	return "…" + string(r[len(r)-4:])
+}
+
+// rate drops times older than rateWindow and returns how many are left.
+func (m *Monitor) rate(times *[]time.Time) int {
+	cutoff := m.now().Add(-rateWindow)
+	i := 0
+	for i < len(*times) && (*times)[i].Before(cutoff) {
+		i++
+	}
+	*times = (*times)[i:]
+	return len(*times)
+}
+
+// Render draws the screen for a terminal of the given size. Lines end in
+// "\r\n" so they also draw in raw mode.
+func (m *Monitor) Render(title string, width, height int) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var lines []string
+	stream := green + "live" + reset
+	if !m.streaming {
+		stream = red + "disconnected" + reset
+	}
+	lines = append(lines, bold+"picoclaw top"+reset+" — "+title+"  "+stream+"  "+dim+m.now().Format("15:04:05")+"  q quit, ↑/↓ scroll"+reset)
+	if m.statusErr != "" {
+		lines = append(lines, red+"status: "+m.statusErr+reset)
+	}
+	lines = append(lines, "")
+
+	names := make([]string, 0, len(m.status.Channels))
+	for name := range m.status.Channels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	lines = append(lines, bold+fmt.Sprintf("%-12s %-14s %7s %7s %7s %7s %7s", "CHANNEL", "STATE", "IN", "OUT", "FAILED", "DROPPED", "PANICS")+reset)
+	for _, name := range names {
+		st := m.status.Stats[name]
+		// Padded after coloring, since the escapes take no room
+		state := colorState(m.status.Channels[name]) + strings.Repeat(" ", max(14-len(m.status.Channels[name]), 0))
+		lines = append(lines, fmt.Sprintf("%-12s %s %7d %7d %7d %7d %7d", name, state,
+			st.Received, st.Sent, st.SendFailed, st.Dropped+st.Filtered, st.Panics))
+	}
+	if len(names) == 0 {
+		lines = append(lines, dim+"no channels"+reset)
+	}
+	lines = append(lines, "")
+
+	lines = append(lines, fmt.Sprintf("Queues    inbound %d  outbound %d  outbox %d",
+		m.status.InboundQueue, m.status.OutboundQueue, m.status.Outbox))
+	lines = append(lines, fmt.Sprintf("Per min   in %d  out %d", m.rate(&m.inbound), m.rate(&m.outbound)))
+	lines = append(lines, fmt.Sprintf("Total     in %d  out %d  failed %d  errors %d  security %d",
+		m.totals[events.TypeInbound], m.totals[events.TypeOutbound], m.totals[events.TypeDeliveryFailed],
+		m.totals[events.TypeError], m.totals[events.TypeSecurity]))
+	lines = append(lines, dim+strings.Repeat("─", max(width, 1))+reset)
+
+	// The feed fills the rest, newest at the bottom
+	rows := max(height-len(lines), 1)
+	// Scrolled to the top, the oldest lines still fill the screen
+	end := max(len(m.feed)-m.scroll, min(rows, len(m.feed)))
+	start := max(end-rows, 0)
+	lines = append(lines, m.feed[start:end]...)
+
+	for i, l := range lines {
+		lines[i] = clip(l, width)
+	}
+	return strings.Join(lines, "\r\n")
+}
+
+func colorState(state string) string {
+	switch state {
+	case "connected", "running":
+		return green + state + reset
+	case "reconnecting", "degraded", "standby":
+		return yellow + state + reset
+	default:
+		return red + state + reset
+	}
+}
+
+// clip cuts s to width visible characters, not counting escapes.
+func clip(s string, width int) string {
+	if width <= 0 {
+		return s
+	}
+	var b strings.Builder
+	visible := 0
+	inEscape := false
+	for _, r := range s {
+		switch {
+		case r == '\x1b':
+			inEscape = true
+		case inEscape:
+			if r >= '@' && r <= '~' && r != '[' {
+				inEscape = false
+			}
+		default:
+			if visible == width {
+				b.WriteString(reset)
+				return b.String()
+			}
+			visible++
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Source is the admin API of the gateway being watched. It is implemented
+// by admin.Client.
+type Source interface {
+	Status(ctx context.Context) (admin.Status, error)
+	Events(ctx context.Context, types ...string) (<-chan events.Event, error)
+}
+
+// Run polls src for status and follows its event stream, reconnecting when
+// it drops, and redraws m on out every second and on each event until ctx
+// is cancelled. size returns the terminal size.
+func Run(ctx context.Context, src Source, m *Monitor, title string, out io.Writer, size func() (int, int)) {
+	redraw := make(chan struct{}, 1)
+	poke := func() {
+		select {
+		case redraw <- struct{}{}:
+		default:
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(statusInterval)
+		defer ticker.Stop()
+		for {
+			m.SetStatus(src.Status(ctx))
+			poke()
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	go func() {
+		for ctx.Err() == nil {
+			ch, err := src.Events(ctx)
+			if err == nil {
+				m.SetStreaming(true)
+				poke()
+				for e := range ch {
+					m.Add(e)
+					poke()
+				}
+			}
+			m.SetStreaming(false)
+			poke()
+			select {
+			case <-ctx.Done():
+			case <-time.After(reconnectDelay):
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		w, h := size()
+		fmt.Fprint(out, "\x1b[H\x1b[2J"+m.Render(title, w, h))
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-redraw:
+			// Batch bursts of events into one frame
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+}
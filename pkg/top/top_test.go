@@ -0,0 +1,169 @@
+package top
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/admin"
+	"github.com/sipeed/picoclaw/pkg/events"
+)
+
+// plain strips ANSI escapes.
+func plain(s string) string {
+	var b strings.Builder
+	inEscape := false
+	for _, r := range s {
+		switch {
+		case r == '\x1b':
+			inEscape = true
+		case inEscape:
+			if r >= '@' && r <= '~' && r != '[' {
+				inEscape = false
+			}
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func TestMonitorRender(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	m := New()
+	m.now = func() time.Time { return now }
+	m.SetStatus(admin.Status{Channels: map[string]string{"whatsapp": "reconnecting", "slack": "connected"}, InboundQueue: 4, Outbox: 2}, nil)
+	m.SetStreaming(true)
+
+	m.Add(events.Event{Type: events.TypeInbound, Channel: "whatsapp", ChatID: "4915112345678@s.whatsapp.net", SenderID: "4915112345678", Content: "my pin is 1234"})
+	m.Add(events.Event{Type: events.TypeOutbound, Channel: "whatsapp", ChatID: "4915112345678@s.whatsapp.net", Content: "noted"})
+	m.Add(events.Event{Type: events.TypeChannel, Channel: "whatsapp", Message: "reconnecting", Fields: map[string]interface{}{"previous": "connected"}})
+	now = now.Add(2 * time.Minute)
+	m.Add(events.Event{Type: events.TypeInbound, Channel: "slack", ChatID: "C1", Content: "hi"})
+
+	screen := plain(m.Render("127.0.0.1:18791", 200, 40))
+	for _, want := range []string{
+		"slack        connected",
+		"whatsapp     reconnecting",
+		"inbound 4  outbound 0  outbox 2",
+		"Per min   in 1  out 0",
+		"Total     in 2  out 1",
+		"whatsapp ….net from …5678 [14 chars]",
+		"whatsapp reconnecting (was connected)",
+		"live",
+	} {
+		if !strings.Contains(screen, want) {
+			t.Errorf("screen missing %q:\n%s", want, screen)
+		}
+	}
+	if strings.Contains(screen, "pin") || strings.Contains(screen, "4915112345678") {
+		t.Errorf("screen shows message content or full IDs:\n%s", screen)
+	}
+
+	m.ShowContent = true
+	m.Add(events.Event{Type: events.TypeInbound, Channel: "slack", ChatID: "C1", Content: "first line\nsecond"})
+	if screen := plain(m.Render("x", 200, 40)); !strings.Contains(screen, `"first line"`) || strings.Contains(screen, "second") {
+		t.Errorf("content line missing:\n%s", screen)
+	}
+
+	m.SetStatus(admin.Status{}, errors.New("connection refused"))
+	m.SetStreaming(false)
+	if screen := plain(m.Render("x", 200, 40)); !strings.Contains(screen, "status: connection refused") || !strings.Contains(screen, "disconnected") {
+		t.Errorf("errors not shown:\n%s", screen)
+	}
+}
+
+func TestMonitorFeedFitsAndScrolls(t *testing.T) {
+	m := New()
+	for i := 0; i < 50; i++ {
+		m.Add(events.Event{Type: events.TypeError, Component: "test", Message: strings.Repeat("x", i) + "|"})
+	}
+	screen := m.Render("x", 30, 20)
+	lines := strings.Split(screen, "\r\n")
+	if len(lines) != 20 {
+		t.Errorf("rendered %d lines, want 20", len(lines))
+	}
+	for _, l := range lines {
+		if n := len([]rune(plain(l))); n > 30 {
+			t.Errorf("line %q is %d wide", plain(l), n)
+		}
+	}
+	if last := plain(lines[len(lines)-1]); !strings.Contains(last, "test: xxxxxxxxxx") {
+		t.Errorf("last line = %q, want the newest event", last)
+	}
+
+	m.Scroll(1000)
+	lines = strings.Split(m.Render("x", 200, 20), "\r\n")
+	if len(lines) != 20 {
+		t.Errorf("scrolled back, rendered %d lines, want 20", len(lines))
+	}
+	if first := plain(lines[9]); !strings.HasSuffix(first, "test: |") {
+		t.Errorf("scrolled back, first feed line = %q, want the oldest event", first)
+	}
+	m.Scroll(-1000)
+	if last := plain(strings.Split(m.Render("x", 200, 20), "\r\n")[19]); !strings.Contains(last, strings.Repeat("x", 49)) {
+		t.Errorf("scrolled forward, last line = %q", last)
+	}
+}
+
+type fakeSource struct {
+	mu     sync.Mutex
+	events chan events.Event
+	dials  int
+}
+
+func (f *fakeSource) Status(ctx context.Context) (admin.Status, error) {
+	return admin.Status{Channels: map[string]string{"slack": "connected"}}, nil
+}
+
+func (f *fakeSource) Events(ctx context.Context, types ...string) (<-chan events.Event, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.dials++
+	return f.events, nil
+}
+
+type syncBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (s *syncBuffer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.Write(p)
+}
+
+func (s *syncBuffer) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.String()
+}
+
+func TestRun(t *testing.T) {
+	src := &fakeSource{events: make(chan events.Event, 1)}
+	src.events <- events.Event{Type: events.TypeSecurity, Component: "admin", Message: "Rejected admin command"}
+	var out syncBuffer
+	m := New()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		Run(ctx, src, m, "gw", &out, func() (int, int) { return 100, 30 })
+		close(done)
+	}()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for !strings.Contains(plain(out.String()), "admin: Rejected admin command") || !strings.Contains(plain(out.String()), "slack        connected") {
+		if time.Now().After(deadline) {
+			t.Fatalf("screen never showed the event and status:\n%s", plain(out.String()))
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	cancel()
+	close(src.events)
+	<-done
+}
@@ -0,0 +1,108 @@
+// Package translation talks to LibreTranslate-compatible translation APIs.
+package translation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Client is a LibreTranslate API client. Languages are ISO 639-1 codes.
+type Client struct {
+	apiBase    string
+	apiKey     string
+	httpClient *http.Client
+}
+
+func NewClient(apiBase, apiKey string) *Client {
+	return &Client{
+		apiBase: strings.TrimRight(apiBase, "/"),
+		apiKey:  apiKey,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+// Detect returns the most likely language of text.
+func (c *Client) Detect(ctx context.Context, text string) (string, error) {
+	var out []struct {
+		Language   string  `json:"language"`
+		Confidence float64 `json:"confidence"`
+	}
+	if err := c.post(ctx, "/detect", map[string]interface{}{"q": text}, &out); err != nil {
+		return "", err
+	}
+	if len(out) == 0 {
+		return "", fmt.Errorf("no language detected")
+	}
+	best := out[0]
+	for _, d := range out[1:] {
+		if d.Confidence > best.Confidence {
+			best = d
+		}
+	}
+	return best.Language, nil
+}
+
+// Translate translates text from source to target. source may be "auto".
+func (c *Client) Translate(ctx context.Context, text, source, target string) (string, error) {
+	var out struct {
+		TranslatedText string `json:"translatedText"`
+	}
+	err := c.post(ctx, "/translate", map[string]interface{}{
+		"q":      text,
+		"source": source,
+		"target": target,
+		"format": "text",
+	}, &out)
+	if err != nil {
+		return "", err
+	}
+	return out.TranslatedText, nil
+}
+
+func (c *Client) post(ctx context.Context, path string, body map[string]interface{}, out interface{}) error {
+	if c.apiKey != "" {
+		body["api_key"] = c.apiKey
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.apiBase+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("translation request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read translation response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(respBody, &apiErr) == nil && apiErr.Error != "" {
+			return fmt.Errorf("translation API error (status %d): %s", resp.StatusCode, apiErr.Error)
+		}
+		return fmt.Errorf("translation API error (status %d)", resp.StatusCode)
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("failed to parse translation response: %w", err)
+	}
+	return nil
+}
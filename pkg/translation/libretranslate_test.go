@@ -0,0 +1,59 @@
+package translation
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["api_key"] != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"error":"Invalid API key"}`))
+			return
+		}
+		switch r.URL.Path {
+		case "/detect":
+			w.Write([]byte(`[{"language":"fr","confidence":40},{"language":"de","confidence":90}]`))
+		case "/translate":
+			if body["source"] != "de" || body["target"] != "en" || body["format"] != "text" {
+				t.Errorf("unexpected translate request: %v", body)
+			}
+			w.Write([]byte(`{"translatedText":"Good morning"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestClient(t *testing.T) {
+	srv := newTestServer(t)
+	defer srv.Close()
+	c := NewClient(srv.URL+"/", "secret")
+
+	lang, err := c.Detect(context.Background(), "Guten Morgen")
+	if err != nil || lang != "de" {
+		t.Errorf("Detect = %q, %v; want de", lang, err)
+	}
+
+	text, err := c.Translate(context.Background(), "Guten Morgen", "de", "en")
+	if err != nil || text != "Good morning" {
+		t.Errorf("Translate = %q, %v", text, err)
+	}
+}
+
+func TestClientAPIError(t *testing.T) {
+	srv := newTestServer(t)
+	defer srv.Close()
+
+	_, err := NewClient(srv.URL, "wrong").Detect(context.Background(), "hi")
+	if err == nil || !strings.Contains(err.Error(), "Invalid API key") {
+		t.Errorf("err = %v, want the API's message", err)
+	}
+}
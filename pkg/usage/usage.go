@@ -0,0 +1,203 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+// Package usage records LLM and transcription usage per sender and per chat
+// and prices it, so monthly budgets can be enforced.
+package usage
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS usage (
+	id                INTEGER PRIMARY KEY AUTOINCREMENT,
+	ts                INTEGER NOT NULL,
+	month             TEXT NOT NULL,
+	channel           TEXT NOT NULL,
+	chat_id           TEXT NOT NULL,
+	sender_id         TEXT NOT NULL,
+	kind              TEXT NOT NULL,
+	model             TEXT NOT NULL,
+	prompt_tokens     INTEGER NOT NULL,
+	completion_tokens INTEGER NOT NULL,
+	audio_seconds     REAL NOT NULL,
+	cost              REAL NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_usage_sender ON usage(month, channel, sender_id);
+CREATE INDEX IF NOT EXISTS idx_usage_chat ON usage(month, channel, chat_id);
+`
+
+// Kinds of usage records.
+const (
+	KindLLM           = "llm"
+	KindTranscription = "transcription"
+)
+
+// Price is the cost of a model in USD per million tokens.
+type Price struct {
+	Input  float64
+	Output float64
+}
+
+// defaultPrices covers common models; config entries override them. Keys
+// match model names by prefix, ignoring any "vendor/" routing prefix.
+var defaultPrices = map[string]Price{
+	"claude-opus":       {Input: 15, Output: 75},
+	"claude-sonnet":     {Input: 3, Output: 15},
+	"claude-3-5-sonnet": {Input: 3, Output: 15},
+	"claude-3-7-sonnet": {Input: 3, Output: 15},
+	"claude-haiku":      {Input: 0.8, Output: 4},
+	"claude-3-5-haiku":  {Input: 0.8, Output: 4},
+	"gpt-5":             {Input: 1.25, Output: 10},
+	"gpt-5-mini":        {Input: 0.25, Output: 2},
+	"gpt-4.1":           {Input: 2, Output: 8},
+	"gpt-4.1-mini":      {Input: 0.4, Output: 1.6},
+	"gpt-4o":            {Input: 2.5, Output: 10},
+	"gpt-4o-mini":       {Input: 0.15, Output: 0.6},
+	"gemini-2.5-pro":    {Input: 1.25, Output: 10},
+	"gemini-2.5-flash":  {Input: 0.3, Output: 2.5},
+	"deepseek-chat":     {Input: 0.27, Output: 1.1},
+}
+
+// Options configures pricing.
+type Options struct {
+	// Prices adds to or overrides the built-in price table.
+	Prices map[string]Price
+	// TranscriptionPerMinute is the USD cost of one minute of audio.
+	TranscriptionPerMinute float64
+}
+
+// Totals summarizes usage over a period.
+type Totals struct {
+	Requests         int
+	PromptTokens     int
+	CompletionTokens int
+	AudioSeconds     float64
+	Cost             float64
+}
+
+// Tracker is a SQLite-backed usage ledger.
+type Tracker struct {
+	db                     *sql.DB
+	prices                 map[string]Price
+	transcriptionPerMinute float64
+	now                    func() time.Time
+}
+
+// Open opens (or creates) the usage database at path.
+func Open(path string, opts Options) (*Tracker, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create usage directory: %w", err)
+	}
+
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)", path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open usage database: %w", err)
+	}
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize usage schema: %w", err)
+	}
+
+	prices := make(map[string]Price, len(defaultPrices)+len(opts.Prices))
+	for model, p := range defaultPrices {
+		prices[model] = p
+	}
+	for model, p := range opts.Prices {
+		prices[strings.ToLower(model)] = p
+	}
+
+	return &Tracker{
+		db:                     db,
+		prices:                 prices,
+		transcriptionPerMinute: opts.TranscriptionPerMinute,
+		now:                    time.Now,
+	}, nil
+}
+
+// Close closes the database.
+func (t *Tracker) Close() error {
+	return t.db.Close()
+}
+
+// priceFor returns the price of model using the longest matching prefix.
+// Unknown models are free, so only priced models count toward budgets.
+func (t *Tracker) priceFor(model string) Price {
+	name := strings.ToLower(model)
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	var best string
+	for prefix := range t.prices {
+		if strings.HasPrefix(name, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	return t.prices[best]
+}
+
+// LLMCost returns the USD cost of one LLM call.
+func (t *Tracker) LLMCost(model string, promptTokens, completionTokens int) float64 {
+	p := t.priceFor(model)
+	return (float64(promptTokens)*p.Input + float64(completionTokens)*p.Output) / 1e6
+}
+
+// RecordLLM records one LLM call made on behalf of senderID in a chat.
+func (t *Tracker) RecordLLM(channel, chatID, senderID, model string, promptTokens, completionTokens int) error {
+	return t.insert(channel, chatID, senderID, KindLLM, model, promptTokens, completionTokens, 0,
+		t.LLMCost(model, promptTokens, completionTokens))
+}
+
+// RecordTranscription records seconds of transcribed audio.
+func (t *Tracker) RecordTranscription(channel, chatID, senderID string, seconds float64) error {
+	return t.insert(channel, chatID, senderID, KindTranscription, "whisper", 0, 0, seconds,
+		seconds/60*t.transcriptionPerMinute)
+}
+
+func (t *Tracker) insert(channel, chatID, senderID, kind, model string, promptTokens, completionTokens int, seconds, cost float64) error {
+	now := t.now()
+	_, err := t.db.Exec(`INSERT INTO usage
+		(ts, month, channel, chat_id, sender_id, kind, model, prompt_tokens, completion_tokens, audio_seconds, cost)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		now.Unix(), monthKey(now), channel, chatID, senderID, kind, model,
+		promptTokens, completionTokens, seconds, cost)
+	return err
+}
+
+// SenderMonth returns this month's usage by a sender on a channel.
+func (t *Tracker) SenderMonth(channel, senderID string) (Totals, error) {
+	return t.totals("sender_id", channel, senderID)
+}
+
+// ChatMonth returns this month's usage in a chat.
+func (t *Tracker) ChatMonth(channel, chatID string) (Totals, error) {
+	return t.totals("chat_id", channel, chatID)
+}
+
+func (t *Tracker) totals(column, channel, id string) (Totals, error) {
+	var tot Totals
+	err := t.db.QueryRow(`SELECT COUNT(*), COALESCE(SUM(prompt_tokens), 0), COALESCE(SUM(completion_tokens), 0),
+		COALESCE(SUM(audio_seconds), 0), COALESCE(SUM(cost), 0)
+		FROM usage WHERE month = ? AND channel = ? AND `+column+` = ?`,
+		monthKey(t.now()), channel, id,
+	).Scan(&tot.Requests, &tot.PromptTokens, &tot.CompletionTokens, &tot.AudioSeconds, &tot.Cost)
+	return tot, err
+}
+
+// monthKey buckets usage by calendar month in local time.
+func monthKey(t time.Time) string {
+	return t.Format("2006-01")
+}
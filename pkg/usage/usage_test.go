@@ -0,0 +1,81 @@
+package usage
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTestTracker(t *testing.T, opts Options) *Tracker {
+	t.Helper()
+	tr, err := Open(filepath.Join(t.TempDir(), "usage.db"), opts)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() { tr.Close() })
+	return tr
+}
+
+func TestLLMCost(t *testing.T) {
+	tr := openTestTracker(t, Options{Prices: map[string]Price{"my-local": {Input: 1, Output: 2}}})
+
+	tests := []struct {
+		model string
+		want  float64
+	}{
+		{"gpt-4o", 2.5 + 10},
+		{"gpt-4o-mini-2024-07-18", 0.15 + 0.6},
+		{"anthropic/claude-sonnet-4-5", 3 + 15},
+		{"My-Local-7B", 1 + 2},
+		{"unknown-model", 0},
+	}
+	for _, tt := range tests {
+		if got := tr.LLMCost(tt.model, 1_000_000, 1_000_000); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("LLMCost(%q) = %v, want %v", tt.model, got, tt.want)
+		}
+	}
+}
+
+func TestTrackerTotals(t *testing.T) {
+	tr := openTestTracker(t, Options{TranscriptionPerMinute: 0.006})
+	now := time.Date(2026, 3, 31, 23, 0, 0, 0, time.Local)
+	tr.now = func() time.Time { return now }
+
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	must(tr.RecordLLM("telegram", "group", "alice", "gpt-4o", 1000, 100))
+	must(tr.RecordLLM("telegram", "group", "bob", "gpt-4o", 2000, 200))
+	must(tr.RecordLLM("telegram", "alice-dm", "alice", "gpt-4o", 500, 50))
+	must(tr.RecordTranscription("telegram", "group", "alice", 120))
+
+	alice, err := tr.SenderMonth("telegram", "alice")
+	must(err)
+	if alice.Requests != 3 || alice.PromptTokens != 1500 || alice.CompletionTokens != 150 || alice.AudioSeconds != 120 {
+		t.Errorf("alice totals = %+v", alice)
+	}
+	wantCost := tr.LLMCost("gpt-4o", 1500, 150) + 2*0.006
+	if math.Abs(alice.Cost-wantCost) > 1e-9 {
+		t.Errorf("alice cost = %v, want %v", alice.Cost, wantCost)
+	}
+
+	group, err := tr.ChatMonth("telegram", "group")
+	must(err)
+	if group.Requests != 3 || group.PromptTokens != 3000 {
+		t.Errorf("group totals = %+v", group)
+	}
+
+	if other, _ := tr.SenderMonth("discord", "alice"); other.Requests != 0 {
+		t.Errorf("usage leaked across channels: %+v", other)
+	}
+
+	// A new month starts from zero
+	now = now.Add(2 * time.Hour)
+	if next, _ := tr.SenderMonth("telegram", "alice"); next.Requests != 0 || next.Cost != 0 {
+		t.Errorf("next month totals = %+v, want zero", next)
+	}
+}
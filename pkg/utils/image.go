@@ -0,0 +1,222 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxRawImageBytes is the largest image passed through without re-encoding.
+const maxRawImageBytes = 4 * 1024 * 1024
+
+// MediaDir returns the temp directory channels download attachments into.
+func MediaDir() string {
+	return filepath.Join(os.TempDir(), "picoclaw_media")
+}
+
+// RemoveMedia deletes downloaded attachments once they are no longer needed.
+// Paths outside MediaDir, such as remote URLs, are left alone.
+func RemoveMedia(paths []string) {
+	dir := MediaDir() + string(filepath.Separator)
+	for _, p := range paths {
+		if strings.HasPrefix(filepath.Clean(p), dir) {
+			os.Remove(p)
+		}
+	}
+}
+
+// IsImageFile checks if a file is an image based on its filename extension and content type.
+func IsImageFile(filename, contentType string) bool {
+	if strings.HasPrefix(strings.ToLower(contentType), "image/") {
+		return true
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".jpg", ".jpeg", ".png", ".gif", ".webp":
+		return true
+	}
+	return false
+}
+
+// LoadImage reads an image file for a multimodal LLM request. Images larger
+// than maxDim pixels on their longest side are downscaled and re-encoded as
+// JPEG; smaller JPEG and PNG files are returned unchanged. Only files small
+// enough to pass through are read into memory whole; larger ones are
+// decoded straight from disk.
+func LoadImage(path string, maxDim int) (mimeType string, data []byte, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", nil, err
+	}
+	sniff := make([]byte, 512)
+	n, err := io.ReadFull(f, sniff)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", nil, err
+	}
+	mimeType = http.DetectContentType(sniff[:n])
+	if !strings.HasPrefix(mimeType, "image/") {
+		return "", nil, fmt.Errorf("%s is not an image (%s)", filepath.Base(path), mimeType)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", nil, err
+	}
+
+	var raw []byte
+	var src io.Reader = bufio.NewReader(f)
+	if info.Size() <= maxRawImageBytes {
+		if raw, err = io.ReadAll(f); err != nil {
+			return "", nil, err
+		}
+		src = bytes.NewReader(raw)
+	}
+
+	img, format, err := image.Decode(src)
+	if err != nil {
+		// Formats the standard library cannot decode (e.g. WebP) are sent
+		// as-is when small enough.
+		if raw != nil {
+			return mimeType, raw, nil
+		}
+		return "", nil, fmt.Errorf("cannot decode %s: %w", filepath.Base(path), err)
+	}
+
+	b := img.Bounds()
+	longest := b.Dx()
+	if b.Dy() > longest {
+		longest = b.Dy()
+	}
+	if (maxDim <= 0 || longest <= maxDim) && (format == "jpeg" || format == "png") && raw != nil {
+		return mimeType, raw, nil
+	}
+
+	if maxDim > 0 && longest > maxDim {
+		img = downscale(img, maxDim)
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85}); err != nil {
+		return "", nil, fmt.Errorf("failed to encode %s: %w", filepath.Base(path), err)
+	}
+	return "image/jpeg", buf.Bytes(), nil
+}
+
+// errTooLarge stops an encoding that has outgrown its cappedBuffer.
+var errTooLarge = errors.New("encoded image too large")
+
+// cappedBuffer is a buffer that refuses to grow past limit bytes, so an
+// attempt that will not fit is abandoned before it is fully in memory.
+type cappedBuffer struct {
+	bytes.Buffer
+	limit int64
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if int64(b.Len()+len(p)) > b.limit {
+		return 0, errTooLarge
+	}
+	return b.Buffer.Write(p)
+}
+
+// CompressImage re-encodes the image at path as a JPEG of at most maxBytes,
+// shrinking it step by step until it fits.
+func CompressImage(path string, maxBytes int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bufio.NewReader(f))
+	f.Close()
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode %s: %w", filepath.Base(path), err)
+	}
+
+	b := img.Bounds()
+	longest := max(b.Dx(), b.Dy())
+	for _, step := range []struct{ dim, quality int }{
+		{longest, 85}, {4096, 80}, {2048, 80}, {1600, 75}, {1024, 70},
+	} {
+		if step.dim > longest {
+			continue
+		}
+		scaled := img
+		if step.dim < longest {
+			scaled = downscale(img, step.dim)
+		}
+		buf := &cappedBuffer{limit: maxBytes}
+		err := jpeg.Encode(buf, scaled, &jpeg.Options{Quality: step.quality})
+		if err == nil {
+			return buf.Bytes(), nil
+		}
+		if !errors.Is(err, errTooLarge) {
+			return nil, fmt.Errorf("failed to encode %s: %w", filepath.Base(path), err)
+		}
+	}
+	return nil, fmt.Errorf("%s does not fit in %d bytes", filepath.Base(path), maxBytes)
+}
+
+// downscale resizes img so its longest side is maxDim, averaging the source
+// pixels that fall into each destination pixel.
+func downscale(img image.Image, maxDim int) image.Image {
+	src := img.Bounds()
+	w, h := src.Dx(), src.Dy()
+	if w >= h {
+		h = h * maxDim / w
+		w = maxDim
+	} else {
+		w = w * maxDim / h
+		h = maxDim
+	}
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0 := src.Min.Y + y*src.Dy()/h
+		y1 := src.Min.Y + (y+1)*src.Dy()/h
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < w; x++ {
+			x0 := src.Min.X + x*src.Dx()/w
+			x1 := src.Min.X + (x+1)*src.Dx()/w
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(bl / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+	return dst
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"context"
 	"io"
 	"net/http"
 	"os"
@@ -51,11 +52,20 @@ type DownloadOptions struct {
 	Timeout      time.Duration
 	ExtraHeaders map[string]string
 	LoggerPrefix string
+	// Kind is what the file was sent as, one of the Media constants. The
+	// download is rejected when its content is something else.
+	Kind string
 }
 
 // DownloadFile downloads a file from URL to a local temp directory.
-// Returns the local file path or empty string on error.
+// Returns the local file path or empty string on error. The file gets the
+// extension its content has, see NormalizeMedia.
 func DownloadFile(url, filename string, opts DownloadOptions) string {
+	return DownloadFileContext(context.Background(), url, filename, opts)
+}
+
+// DownloadFileContext is DownloadFile giving up when ctx is done.
+func DownloadFileContext(ctx context.Context, url, filename string, opts DownloadOptions) string {
 	// Set defaults
 	if opts.Timeout == 0 {
 		opts.Timeout = 60 * time.Second
@@ -64,7 +74,7 @@ func DownloadFile(url, filename string, opts DownloadOptions) string {
 		opts.LoggerPrefix = "utils"
 	}
 
-	mediaDir := filepath.Join(os.TempDir(), "picoclaw_media")
+	mediaDir := MediaDir()
 	if err := os.MkdirAll(mediaDir, 0700); err != nil {
 		logger.ErrorCF(opts.LoggerPrefix, "Failed to create media directory", map[string]interface{}{
 			"error": err.Error(),
@@ -78,7 +88,7 @@ func DownloadFile(url, filename string, opts DownloadOptions) string {
 	localPath := filepath.Join(mediaDir, uuid.New().String()[:8]+"_"+safeName+ext)
 
 	// Create HTTP request
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		logger.ErrorCF(opts.LoggerPrefix, "Failed to create download request", map[string]interface{}{
 			"error": err.Error(),
@@ -117,7 +127,6 @@ func DownloadFile(url, filename string, opts DownloadOptions) string {
 		})
 		return ""
 	}
-	defer out.Close()
 
 	if _, err := io.Copy(out, resp.Body); err != nil {
 		out.Close()
@@ -127,6 +136,15 @@ func DownloadFile(url, filename string, opts DownloadOptions) string {
 		})
 		return ""
 	}
+	if err := out.Close(); err != nil {
+		os.Remove(localPath)
+		return ""
+	}
+
+	localPath, err = CheckDownload(opts.LoggerPrefix, localPath, opts.Kind)
+	if err != nil {
+		return ""
+	}
 
 	logger.DebugCF(opts.LoggerPrefix, "File downloaded successfully", map[string]interface{}{
 		"path": localPath,
@@ -0,0 +1,256 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/events"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// Media kinds a download is expected to be, for NormalizeMedia.
+const (
+	MediaAny   = ""
+	MediaImage = "image"
+	MediaAudio = "audio"
+	MediaVideo = "video"
+)
+
+var (
+	// ErrDangerousMedia is returned for programs and scripts, which are
+	// never passed on whatever they are called.
+	ErrDangerousMedia = errors.New("executable content")
+	// ErrMediaMismatch is returned when a file is not the kind of media
+	// it was sent as, such as a photo that is no image.
+	ErrMediaMismatch = errors.New("content does not match the media kind")
+)
+
+// mediaExtensions maps the types SniffMedia finds to the extension files
+// of the type get.
+var mediaExtensions = map[string]string{
+	"image/jpeg":                   ".jpg",
+	"image/png":                    ".png",
+	"image/gif":                    ".gif",
+	"image/webp":                   ".webp",
+	"image/bmp":                    ".bmp",
+	"image/heic":                   ".heic",
+	"image/x-icon":                 ".ico",
+	"video/mp4":                    ".mp4",
+	"video/webm":                   ".webm",
+	"video/3gpp":                   ".3gp",
+	"video/quicktime":              ".mov",
+	"video/avi":                    ".avi",
+	"audio/ogg":                    ".ogg",
+	"audio/mpeg":                   ".mp3",
+	"audio/aac":                    ".aac",
+	"audio/amr":                    ".amr",
+	"audio/wave":                   ".wav",
+	"audio/mp4":                    ".m4a",
+	"audio/flac":                   ".flac",
+	"audio/aiff":                   ".aiff",
+	"audio/midi":                   ".mid",
+	"application/pdf":              ".pdf",
+	"application/x-gzip":           ".gz",
+	"application/x-rar-compressed": ".rar",
+	"text/html":                    ".html",
+}
+
+// extensionAliases are other extensions files of a type commonly have.
+var extensionAliases = map[string]string{
+	".jpeg": "image/jpeg",
+	".oga":  "audio/ogg",
+	".opus": "audio/ogg",
+	".m4v":  "video/mp4",
+	".htm":  "text/html",
+}
+
+// genericTypes say too little about a file to pick its extension, so the
+// one it came with is kept.
+var genericTypes = map[string]bool{
+	"application/octet-stream": true,
+	"application/zip":          true,
+	"text/plain":               true,
+	"text/xml":                 true,
+}
+
+// dangerousExtensions run as programs when opened on some system.
+var dangerousExtensions = map[string]bool{
+	".exe": true, ".dll": true, ".scr": true, ".com": true, ".msi": true,
+	".bat": true, ".cmd": true, ".ps1": true, ".vbs": true, ".jar": true,
+	".apk": true,
+}
+
+// SniffMedia returns the MIME type of a file from its first bytes, without
+// parameters: "image/jpeg", "text/plain", or "application/octet-stream"
+// when nothing matches. Programs are reported as
+// "application/x-executable".
+func SniffMedia(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	return sniff(head[:n]), nil
+}
+
+// sniff adds the types http.DetectContentType does not know to it.
+func sniff(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte("\x7fELF")),
+		bytes.HasPrefix(head, []byte("MZ")) && bytes.IndexByte(head, 0) >= 0,
+		bytes.HasPrefix(head, []byte{0xfe, 0xed, 0xfa, 0xce}), bytes.HasPrefix(head, []byte{0xfe, 0xed, 0xfa, 0xcf}),
+		bytes.HasPrefix(head, []byte{0xce, 0xfa, 0xed, 0xfe}), bytes.HasPrefix(head, []byte{0xcf, 0xfa, 0xed, 0xfe}),
+		bytes.HasPrefix(head, []byte{0xca, 0xfe, 0xba, 0xbe}):
+		return "application/x-executable"
+	case bytes.HasPrefix(head, []byte("fLaC")):
+		return "audio/flac"
+	case bytes.HasPrefix(head, []byte("#!AMR")):
+		return "audio/amr"
+	// MPEG audio without tags starts with a frame header; AAC's has layer 0
+	case len(head) >= 2 && head[0] == 0xff && head[1]&0xf6 == 0xf0:
+		return "audio/aac"
+	case len(head) >= 2 && head[0] == 0xff && head[1]&0xe0 == 0xe0:
+		return "audio/mpeg"
+	}
+	// ISO media files name their flavour in the ftyp box
+	if len(head) >= 12 && string(head[4:8]) == "ftyp" {
+		switch brand := string(head[8:12]); {
+		case brand == "M4A " || brand == "M4B ":
+			return "audio/mp4"
+		case brand == "qt  ":
+			return "video/quicktime"
+		case strings.HasPrefix(brand, "3gp"):
+			return "video/3gpp"
+		case brand == "heic" || brand == "heix" || brand == "mif1":
+			return "image/heic"
+		}
+	}
+
+	mimeType, _, _ := strings.Cut(http.DetectContentType(head), ";")
+	if mimeType == "application/ogg" {
+		// Ogg files sent to a chat are voice notes or other audio
+		mimeType = "audio/ogg"
+	}
+	return mimeType
+}
+
+// NormalizeMedia checks a downloaded file against its content and gives
+// it the extension that content has, renaming it if needed. kind is what
+// the file was sent as, one of the Media constants; MediaAny takes
+// anything but programs. The file is removed when it is rejected.
+// It returns the file's path and MIME type.
+func NormalizeMedia(path, kind string) (string, string, error) {
+	mimeType, err := SniffMedia(path)
+	if err != nil {
+		os.Remove(path)
+		return "", "", err
+	}
+	ext := strings.ToLower(filepath.Ext(path))
+	if err := checkMedia(mimeType, ext, kind); err != nil {
+		os.Remove(path)
+		return "", mimeType, fmt.Errorf("%s: %w (%s)", filepath.Base(path), err, mimeType)
+	}
+
+	want := mediaExtension(mimeType, ext)
+	if want == ext {
+		return path, mimeType, nil
+	}
+	renamed := strings.TrimSuffix(path, filepath.Ext(path)) + want
+	if err := os.Rename(path, renamed); err != nil {
+		os.Remove(path)
+		return "", mimeType, err
+	}
+	return renamed, mimeType, nil
+}
+
+// CheckDownload is NormalizeMedia for a file a channel downloaded,
+// logging a rejection for component; a program is reported as a security
+// event.
+func CheckDownload(component, path, kind string) (string, error) {
+	normalized, mimeType, err := NormalizeMedia(path, kind)
+	switch {
+	case errors.Is(err, ErrDangerousMedia):
+		events.Security(component, "Rejected executable attachment",
+			map[string]interface{}{"file": filepath.Base(path), "mime_type": mimeType})
+	case err != nil:
+		logger.WarnCF(component, "Rejected attachment", map[string]interface{}{
+			"error": err.Error(),
+			"kind":  kind,
+		})
+	}
+	return normalized, err
+}
+
+// checkMedia rejects programs, and files whose content is not kind.
+func checkMedia(mimeType, ext, kind string) error {
+	if mimeType == "application/x-executable" || (genericTypes[mimeType] && dangerousExtensions[ext]) {
+		return ErrDangerousMedia
+	}
+	switch kind {
+	case MediaImage:
+		if !strings.HasPrefix(mimeType, "image/") {
+			return ErrMediaMismatch
+		}
+	case MediaVideo:
+		if !strings.HasPrefix(mimeType, "video/") {
+			return ErrMediaMismatch
+		}
+	case MediaAudio:
+		// Audio also comes in video containers, as voice messages do, and
+		// in more formats than are recognized
+		if !strings.HasPrefix(mimeType, "audio/") && mimeType != "video/mp4" && mimeType != "video/webm" &&
+			mimeType != "application/octet-stream" {
+			return ErrMediaMismatch
+		}
+	}
+	return nil
+}
+
+// mediaExtension returns the extension a file of mimeType should have,
+// keeping ext where it fits.
+func mediaExtension(mimeType, ext string) string {
+	if genericTypes[mimeType] {
+		if ext != "" {
+			return ext
+		}
+		if strings.HasPrefix(mimeType, "text/") {
+			return ".txt"
+		}
+		return ".bin"
+	}
+	if extensionAliases[ext] == mimeType {
+		return ext
+	}
+	if want, ok := mediaExtensions[mimeType]; ok {
+		return want
+	}
+	if ext != "" {
+		return ext
+	}
+	return ".bin"
+}
+
+// MediaKind returns the Media constant for a file a platform describes
+// with filename and contentType, or MediaAny.
+func MediaKind(filename, contentType string) string {
+	switch {
+	case IsImageFile(filename, contentType):
+		return MediaImage
+	case IsAudioFile(filename, contentType):
+		return MediaAudio
+	case strings.HasPrefix(strings.ToLower(contentType), "video/"):
+		return MediaVideo
+	}
+	return MediaAny
+}
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNormalizeMedia(t *testing.T) {
+	jpeg := []byte("\xff\xd8\xff\xe0\x00\x10JFIF\x00")
+	png := []byte("\x89PNG\r\n\x1a\n")
+	m4a := []byte("\x00\x00\x00\x20ftypM4A \x00\x00\x00\x00")
+	elf := []byte("\x7fELF\x02\x01\x01")
+
+	tests := []struct {
+		name     string
+		data     []byte
+		kind     string
+		wantName string
+		wantType string
+		wantErr  error
+	}{
+		{"photo.jpg", jpeg, MediaImage, "photo.jpg", "image/jpeg", nil},
+		{"photo.jpeg", jpeg, MediaImage, "photo.jpeg", "image/jpeg", nil},
+		{"photo.jpg", png, MediaImage, "photo.png", "image/png", nil},
+		{"report.pdf", png, MediaAny, "report.png", "image/png", nil},
+		{"voice.ogg", m4a, MediaAudio, "voice.m4a", "audio/mp4", nil},
+		{"notes.md", []byte("# Notes\n"), MediaAny, "notes.md", "text/plain", nil},
+		{"upload", []byte("plain"), MediaAny, "upload.txt", "text/plain", nil},
+		{"photo.jpg", []byte("<html><body>hi"), MediaImage, "", "text/html", ErrMediaMismatch},
+		{"cat.png", elf, MediaAny, "", "application/x-executable", ErrDangerousMedia},
+		{"setup.exe", []byte("\x00\x01"), MediaAny, "", "application/octet-stream", ErrDangerousMedia},
+		{"run.bat", []byte("@echo off\r\n"), MediaAny, "", "text/plain", ErrDangerousMedia},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		path := filepath.Join(dir, tt.name)
+		if err := os.WriteFile(path, tt.data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		got, mimeType, err := NormalizeMedia(path, tt.kind)
+		if !errors.Is(err, tt.wantErr) || mimeType != tt.wantType {
+			t.Errorf("%s: NormalizeMedia() = %q, %v; want %q, %v", tt.name, mimeType, err, tt.wantType, tt.wantErr)
+			continue
+		}
+		if tt.wantErr != nil {
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("%s: rejected file was kept", tt.name)
+			}
+			continue
+		}
+		if got != filepath.Join(dir, tt.wantName) {
+			t.Errorf("%s: path = %q, want %s", tt.name, got, tt.wantName)
+		}
+		if _, err := os.Stat(got); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"time"
 
 	"github.com/sipeed/picoclaw/pkg/logger"
@@ -62,51 +63,29 @@ func (t *GroqTranscriber) Transcribe(ctx context.Context, audioFilePath string)
 		"file_name":  filepath.Base(audioFilePath),
 	})
 
-	var requestBody bytes.Buffer
-	writer := multipart.NewWriter(&requestBody)
-
-	part, err := writer.CreateFormFile("file", filepath.Base(audioFilePath))
-	if err != nil {
-		logger.ErrorCF("voice", "Failed to create form file", map[string]interface{}{"error": err})
-		return nil, fmt.Errorf("failed to create form file: %w", err)
-	}
-
-	copied, err := io.Copy(part, audioFile)
+	body, contentType, size, err := multipartBody(audioFile, filepath.Base(audioFilePath), fileInfo.Size(), map[string]string{
+		"model":           "whisper-large-v3",
+		"response_format": "verbose_json",
+	})
 	if err != nil {
-		logger.ErrorCF("voice", "Failed to copy file content", map[string]interface{}{"error": err})
-		return nil, fmt.Errorf("failed to copy file content: %w", err)
-	}
-
-	logger.DebugCF("voice", "File copied to request", map[string]interface{}{"bytes_copied": copied})
-
-	if err := writer.WriteField("model", "whisper-large-v3"); err != nil {
-		logger.ErrorCF("voice", "Failed to write model field", map[string]interface{}{"error": err})
-		return nil, fmt.Errorf("failed to write model field: %w", err)
-	}
-
-	if err := writer.WriteField("response_format", "json"); err != nil {
-		logger.ErrorCF("voice", "Failed to write response_format field", map[string]interface{}{"error": err})
-		return nil, fmt.Errorf("failed to write response_format field: %w", err)
-	}
-
-	if err := writer.Close(); err != nil {
-		logger.ErrorCF("voice", "Failed to close multipart writer", map[string]interface{}{"error": err})
-		return nil, fmt.Errorf("failed to close multipart writer: %w", err)
+		logger.ErrorCF("voice", "Failed to build multipart request", map[string]interface{}{"error": err})
+		return nil, fmt.Errorf("failed to build multipart request: %w", err)
 	}
 
 	url := t.apiBase + "/audio/transcriptions"
-	req, err := http.NewRequestWithContext(ctx, "POST", url, &requestBody)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, body)
 	if err != nil {
 		logger.ErrorCF("voice", "Failed to create request", map[string]interface{}{"error": err})
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.ContentLength = size
+	req.Header.Set("Content-Type", contentType)
 	req.Header.Set("Authorization", "Bearer "+t.apiKey)
 
 	logger.DebugCF("voice", "Sending transcription request to Groq API", map[string]interface{}{
 		"url":                url,
-		"request_size_bytes": requestBody.Len(),
+		"request_size_bytes": size,
 		"file_size_bytes":    fileInfo.Size(),
 	})
 
@@ -117,7 +96,7 @@ func (t *GroqTranscriber) Transcribe(ctx context.Context, audioFilePath string)
 	}
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
 		logger.ErrorCF("voice", "Failed to read response", map[string]interface{}{"error": err})
 		return nil, fmt.Errorf("failed to read response: %w", err)
@@ -126,18 +105,18 @@ func (t *GroqTranscriber) Transcribe(ctx context.Context, audioFilePath string)
 	if resp.StatusCode != http.StatusOK {
 		logger.ErrorCF("voice", "API error", map[string]interface{}{
 			"status_code": resp.StatusCode,
-			"response":    string(body),
+			"response":    string(respBody),
 		})
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(respBody))
 	}
 
 	logger.DebugCF("voice", "Received response from Groq API", map[string]interface{}{
 		"status_code":         resp.StatusCode,
-		"response_size_bytes": len(body),
+		"response_size_bytes": len(respBody),
 	})
 
 	var result TranscriptionResponse
-	if err := json.Unmarshal(body, &result); err != nil {
+	if err := json.Unmarshal(respBody, &result); err != nil {
 		logger.ErrorCF("voice", "Failed to unmarshal response", map[string]interface{}{"error": err})
 		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
 	}
@@ -152,6 +131,39 @@ func (t *GroqTranscriber) Transcribe(ctx context.Context, audioFilePath string)
 	return &result, nil
 }
 
+// multipartBody returns a multipart/form-data request body uploading file,
+// of size bytes, as the form field "file" followed by fields. The file is
+// streamed into the body rather than copied into memory, and the body's
+// length is still known up front.
+func multipartBody(file io.Reader, name string, size int64, fields map[string]string) (io.Reader, string, int64, error) {
+	var form bytes.Buffer
+	writer := multipart.NewWriter(&form)
+	if _, err := writer.CreateFormFile("file", name); err != nil {
+		return nil, "", 0, err
+	}
+	// The file's content goes here, between its part header and the
+	// parts that follow
+	split := form.Len()
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := writer.WriteField(key, fields[key]); err != nil {
+			return nil, "", 0, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, "", 0, err
+	}
+
+	data := form.Bytes()
+	body := io.MultiReader(bytes.NewReader(data[:split]), io.LimitReader(file, size), bytes.NewReader(data[split:]))
+	return body, writer.FormDataContentType(), int64(len(data)) + size, nil
+}
+
 func (t *GroqTranscriber) IsAvailable() bool {
 	available := t.apiKey != ""
 	logger.DebugCF("voice", "Checking transcriber availability", map[string]interface{}{"available": available})
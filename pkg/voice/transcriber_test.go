@@ -0,0 +1,77 @@
+package voice
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTranscribeStreamsUpload(t *testing.T) {
+	audio := strings.Repeat("ogg-data ", 100000)
+	path := filepath.Join(t.TempDir(), "voice.ogg")
+	if err := os.WriteFile(path, []byte(audio), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength <= int64(len(audio)) {
+			t.Errorf("Content-Length = %d, want the whole form", r.ContentLength)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer key" {
+			t.Errorf("Authorization = %q", got)
+		}
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("ParseMultipartForm() error: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if got := r.FormValue("model"); got != "whisper-large-v3" {
+			t.Errorf("model = %q", got)
+		}
+		if got := r.FormValue("response_format"); got != "verbose_json" {
+			t.Errorf("response_format = %q", got)
+		}
+		f, header, err := r.FormFile("file")
+		if err != nil {
+			t.Errorf("FormFile() error: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer f.Close()
+		data, _ := io.ReadAll(f)
+		if header.Filename != "voice.ogg" || string(data) != audio {
+			t.Errorf("file %q of %d bytes, want voice.ogg of %d", header.Filename, len(data), len(audio))
+		}
+		json.NewEncoder(w).Encode(TranscriptionResponse{Text: "hello", Duration: 1.5})
+	}))
+	defer srv.Close()
+
+	tr := NewGroqTranscriber("key")
+	tr.apiBase = srv.URL
+	result, err := tr.Transcribe(context.Background(), path)
+	if err != nil {
+		t.Fatalf("Transcribe() error: %v", err)
+	}
+	if result.Text != "hello" || result.Duration != 1.5 {
+		t.Errorf("Transcribe() = %+v", result)
+	}
+}
+
+func TestMultipartBodyLength(t *testing.T) {
+	for _, fields := range []map[string]string{nil, {"model": "m"}, {"a": "1", "b": "2"}} {
+		body, _, size, err := multipartBody(strings.NewReader("content"), "f.ogg", 7, fields)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(body)
+		if int64(len(data)) != size {
+			t.Errorf("fields %v: length %d, read %d bytes", fields, size, len(data))
+		}
+	}
+}
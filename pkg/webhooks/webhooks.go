@@ -0,0 +1,268 @@
+// PicoClaw - Ultra-lightweight personal AI agent
+// Inspired by and based on nanobot: https://github.com/HKUDS/nanobot
+// License: MIT
+//
+// Copyright (c) 2026 PicoClaw contributors
+
+// Package webhooks posts gateway events to external URLs, so other systems
+// can react to the bot's activity without polling the admin API.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/events"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+// Request headers sent with every post.
+const (
+	HeaderEvent     = "X-PicoClaw-Event"
+	HeaderDelivery  = "X-PicoClaw-Delivery"
+	HeaderTimestamp = "X-PicoClaw-Timestamp"
+	HeaderSignature = "X-PicoClaw-Signature"
+	// HeaderTraceparent carries a message event's trace in the W3C format,
+	// so receivers that trace requests join the message's trace.
+	HeaderTraceparent = "traceparent"
+)
+
+const (
+	// queueSize is how many posts wait for a target before new ones are
+	// dropped, so a slow endpoint never stalls the gateway.
+	queueSize = 256
+	// maxRetryDelay caps the doubling delay between attempts.
+	maxRetryDelay = 5 * time.Minute
+)
+
+// Target is one URL events are posted to. Events limits the event types
+// sent; empty sends all. With Secret set, posts are signed, see Sign.
+type Target struct {
+	URL    string
+	Secret string
+	Events []string
+}
+
+// Payload is the JSON body of a post: the event plus a unique ID, which
+// is also sent in the X-PicoClaw-Delivery header. Retries reuse the ID.
+type Payload struct {
+	ID string `json:"id"`
+	events.Event
+}
+
+type post struct {
+	id          string
+	event       string
+	body        []byte
+	traceparent string
+}
+
+type target struct {
+	Target
+	types map[string]bool // nil accepts every type
+	queue chan post
+}
+
+// Dispatcher posts the events it reads from a hub to its targets. Each
+// target gets the events in order; a failed post is retried with a
+// doubling delay before the next one is sent.
+type Dispatcher struct {
+	targets    []*target
+	maxRetries int
+	client     *http.Client
+	retryDelay time.Duration // First delay between attempts
+}
+
+// New returns a dispatcher for targets. Targets without a valid http(s)
+// URL are skipped with a warning.
+func New(targets []Target, maxRetries int) *Dispatcher {
+	d := &Dispatcher{
+		maxRetries: maxRetries,
+		client:     &http.Client{Timeout: 15 * time.Second},
+		retryDelay: time.Second,
+	}
+	for _, t := range targets {
+		u, err := url.Parse(t.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			logger.WarnCF("webhooks", "Skipping webhook with invalid URL", map[string]interface{}{"url": t.URL})
+			continue
+		}
+		tt := &target{Target: t, queue: make(chan post, queueSize)}
+		if len(t.Events) > 0 {
+			tt.types = make(map[string]bool, len(t.Events))
+			for _, e := range t.Events {
+				tt.types[e] = true
+			}
+		}
+		d.targets = append(d.targets, tt)
+	}
+	return d
+}
+
+// Len returns the number of targets.
+func (d *Dispatcher) Len() int {
+	return len(d.targets)
+}
+
+// Start subscribes to hub and posts its events in the background until
+// ctx is cancelled.
+func (d *Dispatcher) Start(ctx context.Context, hub *events.Hub) {
+	if len(d.targets) == 0 {
+		return
+	}
+	ch, cancel := hub.Subscribe(queueSize)
+	for _, t := range d.targets {
+		go d.deliver(ctx, t)
+	}
+	go func() {
+		defer cancel()
+		d.run(ctx, ch)
+	}()
+}
+
+func (d *Dispatcher) run(ctx context.Context, ch <-chan events.Event) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+			d.enqueue(e)
+		}
+	}
+}
+
+// enqueue hands e to every target that wants it.
+func (d *Dispatcher) enqueue(e events.Event) {
+	p := Payload{ID: newID(), Event: e}
+	body, err := json.Marshal(p)
+	if err != nil {
+		logger.WarnCF("webhooks", "Failed to encode event", map[string]interface{}{"type": e.Type, "error": err.Error()})
+		return
+	}
+	for _, t := range d.targets {
+		if t.types != nil && !t.types[e.Type] {
+			continue
+		}
+		select {
+		case t.queue <- post{id: p.ID, event: e.Type, body: body, traceparent: traceparent(e)}:
+		default:
+			logger.WarnCF("webhooks", "Webhook queue full, dropping event",
+				map[string]interface{}{"url": t.URL, "type": e.Type})
+		}
+	}
+}
+
+// deliver sends t's queued posts one at a time until ctx is cancelled.
+func (d *Dispatcher) deliver(ctx context.Context, t *target) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case p := <-t.queue:
+			d.send(ctx, t, p)
+		}
+	}
+}
+
+// send posts p to t, retrying failed attempts. Giving up is logged as a
+// warning: an error would be published as an event and posted again.
+func (d *Dispatcher) send(ctx context.Context, t *target, p post) {
+	delay := d.retryDelay
+	for attempt := 0; ; attempt++ {
+		retry, err := d.attempt(ctx, t, p)
+		if err == nil {
+			return
+		}
+		if !retry || attempt >= d.maxRetries {
+			logger.WarnCF("webhooks", "Giving up on webhook", map[string]interface{}{
+				"url":      t.URL,
+				"type":     p.event,
+				"attempts": attempt + 1,
+				"error":    err.Error(),
+			})
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxRetryDelay)
+	}
+}
+
+// attempt posts p once. retry reports whether a failure may be temporary:
+// network errors, 429, and 5xx responses are retried, other statuses not.
+func (d *Dispatcher) attempt(ctx context.Context, t *target, p post) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.URL, bytes.NewReader(p.body))
+	if err != nil {
+		return false, err
+	}
+	ts := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "PicoClaw-Webhook")
+	req.Header.Set(HeaderEvent, p.event)
+	req.Header.Set(HeaderDelivery, p.id)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(ts, 10))
+	if t.Secret != "" {
+		req.Header.Set(HeaderSignature, Sign(t.Secret, ts, p.body))
+	}
+	if p.traceparent != "" {
+		req.Header.Set(HeaderTraceparent, p.traceparent)
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry = resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("HTTP %d", resp.StatusCode)
+}
+
+// Sign returns the X-PicoClaw-Signature value for a post: "sha256=" and
+// the hex HMAC-SHA256, keyed with secret, of the X-PicoClaw-Timestamp
+// value, a dot, and the body. Receivers recompute it to check a post came
+// from the gateway, and can reject old timestamps to stop replays.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// traceparent returns the traceparent header for e, or "" when it is not
+// part of a trace. The parent is the message itself for inbound messages,
+// and the message answered for outbound ones.
+func traceparent(e events.Event) string {
+	traceID, _ := e.Fields["trace_id"].(string)
+	spanID, _ := e.Fields["correlation_id"].(string)
+	if spanID == "" {
+		spanID, _ = e.Fields["parent_id"].(string)
+	}
+	return bus.Traceparent(traceID, spanID)
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,140 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/events"
+)
+
+type received struct {
+	header http.Header
+	body   []byte
+}
+
+// newReceiver returns a server that answers with the given statuses in
+// turn, then 200, and the channel of posts it got.
+func newReceiver(t *testing.T, statuses ...int) (*httptest.Server, <-chan received) {
+	t.Helper()
+	posts := make(chan received, 16)
+	var mu sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		posts <- received{r.Header.Clone(), body}
+		mu.Lock()
+		status := http.StatusOK
+		if len(statuses) > 0 {
+			status, statuses = statuses[0], statuses[1:]
+		}
+		mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, posts
+}
+
+func startDispatcher(t *testing.T, d *Dispatcher) *events.Hub {
+	t.Helper()
+	d.retryDelay = time.Millisecond
+	hub := events.NewHub()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	d.Start(ctx, hub)
+	return hub
+}
+
+func waitPost(t *testing.T, posts <-chan received) received {
+	t.Helper()
+	select {
+	case p := <-posts:
+		return p
+	case <-time.After(2 * time.Second):
+		t.Fatal("no webhook post")
+		return received{}
+	}
+}
+
+func TestDispatcherSignsAndFilters(t *testing.T) {
+	srv, posts := newReceiver(t)
+	d := New([]Target{{URL: srv.URL, Secret: "s3cret", Events: []string{events.TypeInbound}}}, 0)
+	hub := startDispatcher(t, d)
+
+	hub.Publish(events.Event{Type: events.TypeOutbound, Channel: "slack", Content: "skipped"})
+	hub.Publish(events.Event{Type: events.TypeInbound, Channel: "slack", ChatID: "C1", Content: "hi",
+		Fields: map[string]interface{}{"trace_id": "4bf92f3577b34da6a3ce929d0e0e4736", "correlation_id": "00f067aa0ba902b7"}})
+
+	p := waitPost(t, posts)
+	var payload Payload
+	if err := json.Unmarshal(p.body, &payload); err != nil {
+		t.Fatalf("body is not JSON: %v", err)
+	}
+	if payload.Type != events.TypeInbound || payload.Content != "hi" || payload.ID == "" {
+		t.Errorf("payload = %+v", payload)
+	}
+	if p.header.Get(HeaderEvent) != events.TypeInbound || p.header.Get(HeaderDelivery) != payload.ID {
+		t.Errorf("headers = %v", p.header)
+	}
+	if got := p.header.Get(HeaderTraceparent); got != "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01" {
+		t.Errorf("traceparent = %q", got)
+	}
+	ts, _ := strconv.ParseInt(p.header.Get(HeaderTimestamp), 10, 64)
+	if got := p.header.Get(HeaderSignature); got != Sign("s3cret", ts, p.body) {
+		t.Errorf("signature = %q", got)
+	}
+	select {
+	case extra := <-posts:
+		t.Errorf("unexpected post %s", extra.body)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestDispatcherRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		retries  int
+		want     int
+	}{
+		{"server error is retried", []int{500, 502}, 3, 3},
+		{"rate limit is retried", []int{429}, 3, 2},
+		{"retries run out", []int{500, 500, 500}, 1, 2},
+		{"client error is not retried", []int{400}, 3, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, posts := newReceiver(t, tt.statuses...)
+			d := New([]Target{{URL: srv.URL}}, tt.retries)
+			hub := startDispatcher(t, d)
+			hub.Publish(events.Event{Type: events.TypeDeliveryFailed, Message: "boom"})
+
+			var ids []string
+			for i := 0; i < tt.want; i++ {
+				ids = append(ids, waitPost(t, posts).header.Get(HeaderDelivery))
+			}
+			select {
+			case extra := <-posts:
+				t.Errorf("unexpected post %s", extra.body)
+			case <-time.After(50 * time.Millisecond):
+			}
+			for _, id := range ids {
+				if id != ids[0] {
+					t.Errorf("retries changed the delivery ID: %q", ids)
+				}
+			}
+		})
+	}
+}
+
+func TestNewSkipsInvalidURLs(t *testing.T) {
+	d := New([]Target{{URL: "ftp://example.com"}, {URL: "not a url"}, {URL: "https://example.com/hook"}}, 0)
+	if d.Len() != 1 {
+		t.Errorf("Len() = %d, want 1", d.Len())
+	}
+}